@@ -17,6 +17,162 @@ USE `mstf`;
 /*!40101 SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='NO_AUTO_VALUE_ON_ZERO' */;
 /*!40111 SET @OLD_SQL_NOTES=@@SQL_NOTES, SQL_NOTES=0 */;
 
+--
+-- Table structure for table `ApiKeys`
+--
+
+DROP TABLE IF EXISTS `ApiKeys`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!50503 SET character_set_client = utf8mb4 */;
+CREATE TABLE `ApiKeys` (
+  `IdApiKey` int NOT NULL AUTO_INCREMENT COMMENT 'PK de la tabla ApiKeys.',
+  `Nombre` varchar(60) NOT NULL COMMENT 'Nombre de la API key. Es único.',
+  `Sistema` varchar(60) NOT NULL COMMENT 'Sistema cliente externo que usa la API key (actor SISTEMA).',
+  `Prefijo` varchar(12) NOT NULL COMMENT 'Primeros caracteres de la API key, para identificarla sin guardarla.',
+  `Hash` char(64) NOT NULL COMMENT 'SHA-256 de la API key. La API key solo la conoce el sistema cliente.',
+  `Alcances` set('admin','lectura','transferencias') NOT NULL COMMENT 'Permisos del rol S que otorga la API key: admin (todos) - lectura (los de consulta) - transferencias (cuentas y transferencias). Ver f_permiso_en_alcances.',
+  `IPsPermitidas` json NOT NULL COMMENT 'Array de IPs o redes CIDR desde las que se acepta la API key. Vacío: cualquiera. Lo verifica el MS.',
+  `FechaAlta` datetime NOT NULL,
+  `FechaExpiracion` datetime DEFAULT NULL COMMENT 'Vencimiento de la API key. NULL: no vence.',
+  `FechaRotacion` datetime DEFAULT NULL COMMENT 'Fecha de la última rotación.',
+  `FechaUltimoUso` datetime DEFAULT NULL COMMENT 'Último request autenticado con la API key. El MS la cachea 5 minutos, por lo que se actualiza como mucho cada 5 minutos.',
+  `Estado` char(1) NOT NULL DEFAULT 'A' COMMENT 'A: Activa - R: Revocada.',
+  PRIMARY KEY (`IdApiKey`),
+  UNIQUE KEY `UI_ApiKeys_Nombre` (`Nombre`),
+  UNIQUE KEY `UI_ApiKeys_Hash` (`Hash`)
+) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='API keys de los sistemas cliente externos (actor SISTEMA). Se guarda solo su SHA-256.';
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Dumping data for table `ApiKeys`
+--
+
+LOCK TABLES `ApiKeys` WRITE;
+/*!40000 ALTER TABLE `ApiKeys` DISABLE KEYS */;
+INSERT INTO `ApiKeys` VALUES (1,'sistema','Sistema cliente externo','CAMBIAR_ESTE','63da2ed94e7306c2162eba2bf64cb3a9010ce734d1dbb60aeb9ed238bcd606a8','admin','[]','2025-01-01 00:00:00',NULL,NULL,NULL,'A');
+/*!40000 ALTER TABLE `ApiKeys` ENABLE KEYS */;
+UNLOCK TABLES;
+
+--
+-- Table structure for table `BloqueosLogin`
+--
+
+DROP TABLE IF EXISTS `BloqueosLogin`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!50503 SET character_set_client = utf8mb4 */;
+CREATE TABLE `BloqueosLogin` (
+  `Usuario` varchar(30) NOT NULL COMMENT 'PK de la tabla BloqueosLogin. Nombre de usuario informado en el login, exista o no.',
+  `IntentosFallidos` int NOT NULL DEFAULT '0' COMMENT 'Intentos fallidos seguidos (contraseña o código del segundo factor) desde el último bloqueo, incluidos los que el MS está verificando.',
+  `Bloqueos` int NOT NULL DEFAULT '0' COMMENT 'Bloqueos aplicados. Cada uno dura el doble que el anterior, hasta LOGINBLOQUEOMAXMIN.',
+  `FechaUltimoFallo` datetime NOT NULL COMMENT 'Fecha del último intento fallido. Pasadas LOGINVENTANAHORAS se olvidan intentos y bloqueos.',
+  `UltimaIP` varchar(45) DEFAULT NULL COMMENT 'IP del cliente del último intento fallido. Informativa.',
+  `BloqueadoHasta` datetime DEFAULT NULL COMMENT 'Fin del bloqueo vigente o del último aplicado. Hasta entonces se rechaza el login sin verificar la contraseña.',
+  PRIMARY KEY (`Usuario`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Intentos de login fallidos y bloqueos temporales por usuario, compartidos por todas las instancias del MS.';
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `CadenaOperaciones`
+--
+
+DROP TABLE IF EXISTS `CadenaOperaciones`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!50503 SET character_set_client = utf8mb4 */;
+CREATE TABLE `CadenaOperaciones` (
+  `IdCadena` tinyint NOT NULL COMMENT 'PK de la tabla CadenaOperaciones. Única fila, 1.',
+  `IdOperacion` int NOT NULL COMMENT 'IdOperacion de la última operación de la cadena (0 si está vacía).',
+  `Hash` char(64) NOT NULL COMMENT 'Hash de la última operación de la cadena (64 ceros si está vacía).',
+  PRIMARY KEY (`IdCadena`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Cabeza de la cadena de hashes de Operaciones. La mantiene trg_operaciones_encadenar.';
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Dumping data for table `CadenaOperaciones`
+--
+
+LOCK TABLES `CadenaOperaciones` WRITE;
+/*!40000 ALTER TABLE `CadenaOperaciones` DISABLE KEYS */;
+INSERT INTO `CadenaOperaciones` VALUES (1,0,'0000000000000000000000000000000000000000000000000000000000000000');
+/*!40000 ALTER TABLE `CadenaOperaciones` ENABLE KEYS */;
+UNLOCK TABLES;
+
+--
+-- Table structure for table `CodigosRecuperacion`
+--
+
+DROP TABLE IF EXISTS `CodigosRecuperacion`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!50503 SET character_set_client = utf8mb4 */;
+CREATE TABLE `CodigosRecuperacion` (
+  `IdUsuario` int NOT NULL COMMENT 'FK a la tabla SegundoFactor.',
+  `Hash` char(64) NOT NULL COMMENT 'SHA-256 del código de recuperación normalizado (sin guiones, en minúsculas). El código solo lo conoce el usuario.',
+  PRIMARY KEY (`IdUsuario`,`Hash`),
+  CONSTRAINT `RefSegundoFactor1` FOREIGN KEY (`IdUsuario`) REFERENCES `SegundoFactor` (`IdUsuario`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Códigos de recuperación de un solo uso del segundo factor: se borran al usarse para iniciar sesión.';
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `DesafiosLogin`
+--
+
+DROP TABLE IF EXISTS `DesafiosLogin`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!50503 SET character_set_client = utf8mb4 */;
+CREATE TABLE `DesafiosLogin` (
+  `IdDesafio` int NOT NULL AUTO_INCREMENT COMMENT 'PK de la tabla DesafiosLogin.',
+  `IdUsuario` int NOT NULL COMMENT 'FK a la tabla Usuarios.',
+  `TokenHash` char(64) NOT NULL COMMENT 'SHA-256 del token del desafío. El token solo lo conoce el cliente que inició el login.',
+  `Tipo` char(1) NOT NULL COMMENT 'V: verificar el código del segundo factor - I: inscribir el segundo factor (lo exige el rol) y verificar su primer código.',
+  `FechaExpiracion` datetime NOT NULL COMMENT 'Vencimiento del desafío: 5 minutos desde el login.',
+  `Intentos` int NOT NULL DEFAULT '0' COMMENT 'Códigos inválidos informados. Al quinto se borra el desafío.',
+  PRIMARY KEY (`IdDesafio`),
+  UNIQUE KEY `UI_DesafiosLogin_TokenHash` (`TokenHash`),
+  KEY `IX_DesafiosLogin_IdUsuario` (`IdUsuario`),
+  CONSTRAINT `RefUsuarios4` FOREIGN KEY (`IdUsuario`) REFERENCES `Usuarios` (`IdUsuario`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Logins con contraseña válida que esperan el código del segundo factor para crear la sesión.';
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `EstadosTransferencias`
+--
+
+DROP TABLE IF EXISTS `EstadosTransferencias`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!50503 SET character_set_client = utf8mb4 */;
+CREATE TABLE `EstadosTransferencias` (
+  `IdTransferencia` varchar(50) NOT NULL COMMENT 'PK de la tabla EstadosTransferencias. Id de la transferencia (decimal).',
+  `IdCorrelacion` varchar(64) NOT NULL COMMENT 'IdCorrelacion de la request o mensaje que originó la transferencia.',
+  `Estado` char(1) NOT NULL COMMENT 'Estado final notificado: F (finalizada) o E (error).',
+  `Mensaje` varchar(255) NOT NULL COMMENT 'Mensaje del resultado notificado.',
+  `Tipo` char(1) NOT NULL COMMENT 'Tipo de la transferencia: I (ingreso), E (egreso) o R (reversión).',
+  `IdMoneda` int unsigned NOT NULL COMMENT 'Moneda de la transferencia.',
+  `IdUsuarioFinal` bigint unsigned NOT NULL COMMENT 'Usuario final de la transferencia.',
+  `FechaAlta` datetime NOT NULL COMMENT 'Fecha en que se registró el primer resultado.',
+  `FechaModificacion` datetime NOT NULL COMMENT 'Fecha del último resultado registrado.',
+  PRIMARY KEY (`IdTransferencia`),
+  KEY `IX_IdCorrelacion` (`IdCorrelacion`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Último resultado notificado de cada transferencia, con su IdCorrelacion.';
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `MensajesCuarentena`
+--
+
+DROP TABLE IF EXISTS `MensajesCuarentena`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!50503 SET character_set_client = utf8mb4 */;
+CREATE TABLE `MensajesCuarentena` (
+  `IdMensaje` int NOT NULL AUTO_INCREMENT COMMENT 'PK de la tabla MensajesCuarentena.',
+  `Origen` varchar(255) NOT NULL COMMENT 'Ubicación del mensaje en la fuente de ingesta (ej: kafka:topic/partición/offset).',
+  `IdTransferencia` varchar(50) NOT NULL COMMENT 'IdTransferencia del mensaje, vacío si no se pudo leer.',
+  `Contenido` mediumtext NOT NULL COMMENT 'Payload original del mensaje.',
+  `Error` varchar(500) NOT NULL COMMENT 'Último error obtenido al procesar el mensaje.',
+  `FechaAlta` datetime NOT NULL COMMENT 'Fecha en que el mensaje fue puesto en cuarentena.',
+  PRIMARY KEY (`IdMensaje`),
+  KEY `IX_IdTransferencia` (`IdTransferencia`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Mensajes aislados por el consumidor porque hacían fallar su lote de forma repetida.';
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `Monedas`
 --
@@ -45,14 +201,93 @@ DROP TABLE IF EXISTS `Operaciones`;
 CREATE TABLE `Operaciones` (
   `IdOperacion` int NOT NULL AUTO_INCREMENT COMMENT 'PK de la tabla Operaciones.',
   `IdUsuario` int DEFAULT NULL COMMENT 'FK a la tabla Usuarios. NULL cuando la operación la realiza el sistema.',
-  `TipoOperacion` char(2) NOT NULL COMMENT 'Tipo de operación que se audita: CM (creación de moneda) - AM (activación de moneda) - DM (desactivación de moneda) - BM (borrado de moneda) - MP (modificación de parámetro) - CU (creación de usuario) - AU (activación de usuario) - DU (desactivación de usuario) - BU (borrado de usuario)',
+  `TipoOperacion` char(2) NOT NULL COMMENT 'Tipo de operación que se audita: CM (creación de moneda) - AM (activación de moneda) - DM (desactivación de moneda) - BM (borrado de moneda) - MP (modificación de parámetro) - CU (creación de usuario) - AU (activación de usuario) - DU (desactivación de usuario) - BU (borrado de usuario) - RS (revocación de las sesiones de un usuario) - CR (creación de rol) - MR (modificación de rol) - BR (borrado de rol) - AR (asignación de rol a un usuario) - CK (creación de API key) - RK (rotación de API key) - VK (revocación de API key) - RF (restablecimiento del segundo factor de un usuario) - CC (creación de cuenta) - AC (activación de cuenta) - DC (desactivación de cuenta) - RT (reversión de transferencia)',
   `FechaOperacion` datetime NOT NULL,
   `Detalles` json NOT NULL,
+  `Hash` char(64) NOT NULL COMMENT 'SHA-256 de la operación encadenada con la anterior (ver trg_operaciones_encadenar). Lo calcula el trigger.',
   PRIMARY KEY (`IdOperacion`),
   KEY `Ref22` (`IdUsuario`),
+  KEY `IX_Operaciones_FechaOperacion` (`FechaOperacion`),
   CONSTRAINT `RefUsuarios2` FOREIGN KEY (`IdUsuario`) REFERENCES `Usuarios` (`IdUsuario`)
-) ENGINE=InnoDB AUTO_INCREMENT=444 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Tabla de auditoría de operaciones administrativas realizadas en el MSTF.';
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Tabla de auditoría de operaciones administrativas y de las cuentas y reversiones en TigerBeetle realizadas en el MSTF. Solo admite inserciones: cada operación se encadena con la anterior por su Hash.';
 /*!40101 SET character_set_client = @saved_cs_client */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+/*!50003 CREATE*/ /*!50017 DEFINER=`root`@`localhost`*/ /*!50003 TRIGGER `trg_operaciones_encadenar` BEFORE INSERT ON `Operaciones` FOR EACH ROW BEGIN
+    /*
+    Encadena la operación con la anterior: le asigna el IdOperacion siguiente al de la cabeza de la cadena
+    (sin huecos) y su Hash = SHA-256 de 'HashAnterior|IdOperacion|IdUsuario|TipoOperacion|FechaOperacion|Detalles',
+    con IdUsuario vacío si es NULL y FechaOperacion como 'YYYY-MM-DD HH:MM:SS'. El bloqueo de la cabeza serializa
+    las inserciones concurrentes. El MS recalcula el mismo hash al verificar la cadena (models.Operaciones.CalcularHash).
+    */
+    DECLARE pIdAnterior int;
+    DECLARE pHashAnterior char(64);
+
+    SELECT  IdOperacion, Hash
+    INTO    pIdAnterior, pHashAnterior
+    FROM    CadenaOperaciones
+    WHERE   IdCadena = 1
+    FOR UPDATE;
+
+    SET NEW.IdOperacion = pIdAnterior + 1;
+    SET NEW.Hash = SHA2(CONCAT_WS('|', pHashAnterior, NEW.IdOperacion, IFNULL(NEW.IdUsuario, ''), NEW.TipoOperacion,
+        DATE_FORMAT(NEW.FechaOperacion, '%Y-%m-%d %H:%i:%s'), CAST(NEW.Detalles AS CHAR)), 256);
+
+    UPDATE  CadenaOperaciones
+    SET     IdOperacion = NEW.IdOperacion,
+            Hash = NEW.Hash
+    WHERE   IdCadena = 1;
+END */;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+/*!50003 CREATE*/ /*!50017 DEFINER=`root`@`localhost`*/ /*!50003 TRIGGER `trg_operaciones_sin_modificar` BEFORE UPDATE ON `Operaciones` FOR EACH ROW BEGIN
+    /*
+    La auditoría solo admite inserciones. Quien pueda quitar el trigger puede modificar la tabla, pero la
+    verificación de la cadena y de sus anclajes firmados lo detecta.
+    */
+    SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'Operaciones solo admite inserciones.';
+END */;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+/*!50003 CREATE*/ /*!50017 DEFINER=`root`@`localhost`*/ /*!50003 TRIGGER `trg_operaciones_sin_borrar` BEFORE DELETE ON `Operaciones` FOR EACH ROW BEGIN
+    SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'Operaciones solo admite inserciones.';
+END */;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
 
 
 --
@@ -77,10 +312,132 @@ CREATE TABLE `Parametros` (
 
 LOCK TABLES `Parametros` WRITE;
 /*!40000 ALTER TABLE `Parametros` DISABLE KEYS */;
-INSERT INTO `Parametros` VALUES ('APIKEY_SISTEMA','CAMBIAR_ESTE_VALOR','API Key del sistema cliente externo','N'),('KAFKABATCHSIZE','8189','Cantidad máxima de transferencias que se procesan en un lote desde Kafka','N'),('KAFKABATCHTIMEOUTMS','500','Tiempo máximo en milisegundos para armar un lote de transferencias desde Kafka antes de procesarlo','N'),('LIMITEBUSCARCUENTAS','500','Cantidad máxima de cuentas a devolver en una búsqueda cuando no se especifica límite en la consulta','S'),('LIMITEBUSCARTRANSFERENCIAS','500','Cantidad máxima de transferencias a devolver en una búsqueda cuando no se especifica límite en la consulta','S'),('LIMITEHISTORIALBALANCE','500','Cantidad máxima de entradas a devolver en el historial de balances de una cuenta cuando no se especifica\n   límite en la consulta','S'),('LIMITEMAXIMOBUSCARCUENTAS','500','Cantidad máxima absoluta de cuentas que puede solicitar un cliente en una búsqueda','S'),('MONTOMAXTRANSFER','100000','Monto máximo permitido para transferencias','S'),('MONTOMINTRANSFER','100','Monto mínimo permitido para transferencias','S'),('RETRYBACKOFFMAXSEG','20','Tiempo máximo en segundos del backoff exponencial al reintentar un lote fallido','N'),('version_api','1.0.0','Versión actual de la API','N');
+INSERT INTO `Parametros` VALUES ('APAGADODRENADOSEG','30','Plazo en segundos para que las fuentes de ingesta terminen y confirmen sus lotes en curso al apagar el MS','N'),('APAGADOESPERASEG','5','Segundos que el MS sigue atendiendo HTTP con /health/ready en APAGANDO antes de dejar de aceptar requests','N'),('AUDITORIAANCLAJEMIN','15','Intervalo en minutos con el que se anclan (firmados) los hashes de la cabeza de la cadena de Operaciones','S'),('INGESTACARPETASEG','10','Intervalo en segundos con el que se revisa la carpeta de carga masiva de archivos NDJSON','N'),('INGESTAHTTPVENTANAMS','5','Tiempo máximo en milisegundos que se esperan otras requests síncronas para agruparlas en un mismo lote de TigerBeetle','N'),('KAFKABATCHSIZE','8189','Cantidad máxima de transferencias que se procesan en un lote (Kafka, lotes HTTP y archivos NDJSON)','N'),('KAFKABATCHTIMEOUTMS','500','Tiempo máximo en milisegundos para armar un lote de transferencias desde Kafka antes de procesarlo','N'),('KAFKAINTENTOSAISLAR','5','Cantidad de fallos consecutivos de un lote a partir de la cual el motor de ingesta lo divide para aislar los mensajes que lo hacen fallar','N'),('KAFKAPIPELINES','4','Cantidad de pipelines paralelos del consumidor Kafka. Las transferencias de una misma cuenta siempre se procesan en el mismo pipeline','N'),('LIMITEBUSCARCUENTAS','500','Cantidad máxima de cuentas a devolver en una búsqueda cuando no se especifica límite en la consulta','S'),('LIMITEBUSCARTRANSFERENCIAS','500','Cantidad máxima de transferencias a devolver en una búsqueda cuando no se especifica límite en la consulta','S'),('LIMITEHISTORIALBALANCE','500','Cantidad máxima de entradas a devolver en el historial de balances de una cuenta cuando no se especifica\n   límite en la consulta','S'),('LIMITEMAXIMOBUSCARCUENTAS','500','Cantidad máxima absoluta de cuentas que puede solicitar un cliente en una búsqueda','S'),('LOGINBLOQUEOMAXMIN','60','Duración máxima en minutos del bloqueo del login de un usuario por intentos fallidos','S'),('LOGINBLOQUEOSEG','60','Duración en segundos del primer bloqueo del login de un usuario por intentos fallidos. Cada bloqueo siguiente dura el doble','S'),('LOGININTENTOSMAX','5','Intentos de login fallidos seguidos (contraseña o código del segundo factor) que bloquean temporalmente el login de un usuario','S'),('LOGINVENTANAHORAS','24','Horas sin intentos de login fallidos tras las que se olvidan los intentos y bloqueos anteriores de un usuario','S'),('MONTOMAXTRANSFER','100000','Monto máximo permitido para transferencias','S'),('MONTOMINTRANSFER','100','Monto mínimo permitido para transferencias','S'),('PASSWORDLONGITUDMIN','8','Longitud mínima de las contraseñas de usuarios','S'),('PASSWORDREQUIEREMAYUSCULA','S','S si las contraseñas de usuarios deben incluir al menos una mayúscula','S'),('PASSWORDREQUIERENUMERO','S','S si las contraseñas de usuarios deben incluir al menos un número','S'),('PASSWORDREQUIERESIMBOLO','N','S si las contraseñas de usuarios deben incluir al menos un símbolo','S'),('RETRYBACKOFFMAXSEG','20','Tiempo máximo en segundos del backoff exponencial al reintentar un lote fallido','N'),('SALUDTIMEOUTMS','2000','Tiempo máximo en milisegundos de cada verificación de dependencia en /health/ready','N'),('SALUDUMBRALLOTESEG','60','Segundos que un pipeline del consumidor puede estar con el mismo lote (procesando o reintentando) antes de que /health/ready lo informe como trabado','N'),('SESIONDURACIONHORAS','12','Duración máxima en horas de una sesión de usuario desde el login, aunque se renueve','S'),('SESIONESMAXUSUARIO','10','Cantidad máxima de sesiones simultáneas por usuario. Al superarla, el login cierra la usada hace más tiempo','S'),('SESIONINACTIVIDADMIN','30','Minutos sin uso tras los cuales vence una sesión de usuario','S'),('SESIONTOKENMIN','15','Minutos de validez del token de sesión. Se renueva con el refresh token','S'),('TASAAPIKEYMIN','1200','Requests por minuto permitidas a cada API key, por instancia del MS. 0 desactiva el límite','S'),('TASAAPIKEYRAFAGA','200','Requests seguidas que puede hacer una API key antes de quedar limitada a TASAAPIKEYMIN','S'),('TASAIPMIN','600','Requests por minuto permitidas a cada IP, por instancia del MS. 0 desactiva el límite','S'),('TASAIPRAFAGA','100','Requests seguidas que puede hacer una IP antes de quedar limitada a TASAIPMIN','S'),('TASASESIONMIN','300','Requests por minuto permitidas a cada sesión de usuario, por instancia del MS. 0 desactiva el límite','S'),('TASASESIONRAFAGA','60','Requests seguidas que puede hacer una sesión de usuario antes de quedar limitada a TASASESIONMIN','S'),('TOTPROLESOBLIGATORIOS','','Roles separados por coma (por ejemplo A,O) cuyos usuarios deben usar segundo factor (TOTP) para iniciar sesión. Vacío: opcional para todos','S'),('version_api','1.0.0','Versión actual de la API','N');
 /*!40000 ALTER TABLE `Parametros` ENABLE KEYS */;
 UNLOCK TABLES;
 
+--
+-- Table structure for table `Permisos`
+--
+
+DROP TABLE IF EXISTS `Permisos`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!50503 SET character_set_client = utf8mb4 */;
+CREATE TABLE `Permisos` (
+  `Permiso` varchar(50) NOT NULL COMMENT 'Nombre del permiso (recurso:acción). Es único y PK. Lo usa el MS para autorizar cada ruta.',
+  `Descripcion` varchar(255) NOT NULL COMMENT 'Descripción de lo que habilita el permiso.',
+  PRIMARY KEY (`Permiso`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Catálogo de permisos que se pueden otorgar a los roles.';
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Dumping data for table `Permisos`
+--
+
+LOCK TABLES `Permisos` WRITE;
+/*!40000 ALTER TABLE `Permisos` DISABLE KEYS */;
+INSERT INTO `Permisos` VALUES ('apikeys:read','Consultar las API keys de los sistemas cliente'),('apikeys:write','Crear, rotar y revocar API keys de los sistemas cliente'),('auditoria:read','Consultar y exportar la auditoría de operaciones'),('consumidor:read','Consultar el estado, los offsets y la cuarentena del consumidor Kafka'),('consumidor:write','Pausar y reanudar el consumidor Kafka y reprocesar mensajes en cuarentena'),('cuentas:close','Activar y desactivar cuentas'),('cuentas:read','Consultar cuentas, sus balances y sus transferencias'),('cuentas:write','Crear cuentas'),('monedas:read','Consultar monedas'),('monedas:write','Crear, activar, desactivar y borrar monedas'),('parametros:read','Consultar parámetros'),('parametros:write','Modificar parámetros'),('roles:read','Consultar roles y permisos'),('roles:write','Crear, modificar y borrar roles y asignar roles a usuarios'),('sistema:admin','Administrar niveles de log e inyección de fallas'),('transferencias:read','Consultar transferencias y sus estados'),('transferencias:write','Crear transferencias'),('usuarios:admin','Crear, activar, desactivar y borrar usuarios, restablecer contraseñas y cerrar sus sesiones'),('usuarios:read','Consultar usuarios');
+/*!40000 ALTER TABLE `Permisos` ENABLE KEYS */;
+UNLOCK TABLES;
+
+--
+-- Table structure for table `Roles`
+--
+
+DROP TABLE IF EXISTS `Roles`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!50503 SET character_set_client = utf8mb4 */;
+CREATE TABLE `Roles` (
+  `Rol` char(1) NOT NULL COMMENT 'Código del rol (una letra mayúscula). Es único y PK.',
+  `Nombre` varchar(50) NOT NULL COMMENT 'Nombre del rol. Es único.',
+  PRIMARY KEY (`Rol`),
+  UNIQUE KEY `UI_Nombre` (`Nombre`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Roles de los usuarios administrativos. A (Administrador) tiene siempre todos los permisos y S (Sistema) es el rol de las API keys de los sistemas cliente: ninguno de los dos se puede borrar.';
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Dumping data for table `Roles`
+--
+
+LOCK TABLES `Roles` WRITE;
+/*!40000 ALTER TABLE `Roles` DISABLE KEYS */;
+INSERT INTO `Roles` VALUES ('A','Administrador'),('O','Operador'),('S','Sistema');
+/*!40000 ALTER TABLE `Roles` ENABLE KEYS */;
+UNLOCK TABLES;
+
+--
+-- Table structure for table `RolesPermisos`
+--
+
+DROP TABLE IF EXISTS `RolesPermisos`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!50503 SET character_set_client = utf8mb4 */;
+CREATE TABLE `RolesPermisos` (
+  `Rol` char(1) NOT NULL COMMENT 'FK a la tabla Roles.',
+  `Permiso` varchar(50) NOT NULL COMMENT 'FK a la tabla Permisos.',
+  PRIMARY KEY (`Rol`,`Permiso`),
+  KEY `IX_RolesPermisos_Permiso` (`Permiso`),
+  CONSTRAINT `RefRoles1` FOREIGN KEY (`Rol`) REFERENCES `Roles` (`Rol`) ON DELETE CASCADE,
+  CONSTRAINT `RefPermisos1` FOREIGN KEY (`Permiso`) REFERENCES `Permisos` (`Permiso`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Permisos otorgados a cada rol.';
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Dumping data for table `RolesPermisos`
+--
+
+LOCK TABLES `RolesPermisos` WRITE;
+/*!40000 ALTER TABLE `RolesPermisos` DISABLE KEYS */;
+INSERT INTO `RolesPermisos` VALUES ('A','apikeys:read'),('A','apikeys:write'),('A','auditoria:read'),('A','consumidor:read'),('A','consumidor:write'),('A','cuentas:close'),('A','cuentas:read'),('A','cuentas:write'),('A','monedas:read'),('A','monedas:write'),('A','parametros:read'),('A','parametros:write'),('A','roles:read'),('A','roles:write'),('A','sistema:admin'),('A','transferencias:read'),('A','transferencias:write'),('A','usuarios:admin'),('A','usuarios:read'),('O','consumidor:read'),('O','cuentas:close'),('O','cuentas:read'),('O','cuentas:write'),('O','monedas:read'),('O','parametros:read'),('O','transferencias:read'),('O','transferencias:write'),('S','apikeys:read'),('S','apikeys:write'),('S','auditoria:read'),('S','consumidor:read'),('S','consumidor:write'),('S','cuentas:close'),('S','cuentas:read'),('S','cuentas:write'),('S','monedas:read'),('S','monedas:write'),('S','parametros:read'),('S','parametros:write'),('S','roles:read'),('S','roles:write'),('S','sistema:admin'),('S','transferencias:read'),('S','transferencias:write'),('S','usuarios:admin'),('S','usuarios:read');
+/*!40000 ALTER TABLE `RolesPermisos` ENABLE KEYS */;
+UNLOCK TABLES;
+
+--
+-- Table structure for table `SegundoFactor`
+--
+
+DROP TABLE IF EXISTS `SegundoFactor`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!50503 SET character_set_client = utf8mb4 */;
+CREATE TABLE `SegundoFactor` (
+  `IdUsuario` int NOT NULL COMMENT 'PK y FK a la tabla Usuarios.',
+  `Secreto` varchar(64) NOT NULL COMMENT 'Secreto TOTP (RFC 6238) en base32. Lo usa el MS para verificar los códigos.',
+  `Estado` char(1) NOT NULL COMMENT 'P: Pendiente (inscripto, falta verificar el primer código) - A: Activo.',
+  `UltimoPaso` bigint NOT NULL DEFAULT '0' COMMENT 'Último paso de 30 segundos aceptado. Un código no se acepta dos veces.',
+  `FechaAlta` datetime NOT NULL COMMENT 'Fecha de la inscripción.',
+  `FechaActivacion` datetime DEFAULT NULL COMMENT 'Fecha en que se verificó el primer código.',
+  PRIMARY KEY (`IdUsuario`),
+  CONSTRAINT `RefUsuarios5` FOREIGN KEY (`IdUsuario`) REFERENCES `Usuarios` (`IdUsuario`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Segundo factor de autenticación (TOTP) de los usuarios administrativos.';
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `Sesiones`
+--
+
+DROP TABLE IF EXISTS `Sesiones`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!50503 SET character_set_client = utf8mb4 */;
+CREATE TABLE `Sesiones` (
+  `IdSesion` int NOT NULL AUTO_INCREMENT COMMENT 'PK de la tabla Sesiones.',
+  `IdUsuario` int NOT NULL COMMENT 'FK a la tabla Usuarios.',
+  `TokenHash` char(64) NOT NULL COMMENT 'SHA-256 del token de sesión (Bearer). El token solo lo conoce el cliente.',
+  `RefreshHash` char(64) NOT NULL COMMENT 'SHA-256 del refresh token. Se rota en cada renovación.',
+  `Dispositivo` varchar(255) DEFAULT NULL COMMENT 'User-Agent del cliente que inició la sesión.',
+  `IP` varchar(45) DEFAULT NULL COMMENT 'IP del cliente que inició la sesión.',
+  `FechaInicio` datetime NOT NULL COMMENT 'Fecha del login.',
+  `FechaUltimoUso` datetime NOT NULL COMMENT 'Fecha del último request autenticado o renovación. Base del vencimiento por inactividad.',
+  `FechaExpiracionToken` datetime NOT NULL COMMENT 'Vencimiento del token de sesión actual. Se extiende al renovar con el refresh token.',
+  `FechaExpiracion` datetime NOT NULL COMMENT 'Vencimiento absoluto de la sesión: no se extiende al renovar.',
+  `MinutosInactividad` int NOT NULL COMMENT 'Minutos sin uso tras los cuales la sesión vence (SESIONINACTIVIDADMIN al iniciarla).',
+  PRIMARY KEY (`IdSesion`),
+  UNIQUE KEY `UI_TokenHash` (`TokenHash`),
+  UNIQUE KEY `UI_RefreshHash` (`RefreshHash`),
+  KEY `IX_Sesiones_IdUsuario` (`IdUsuario`),
+  CONSTRAINT `RefUsuarios3` FOREIGN KEY (`IdUsuario`) REFERENCES `Usuarios` (`IdUsuario`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Sesiones de los usuarios administrativos: un usuario puede tener varias (una por dispositivo).';
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `Usuarios`
 --
@@ -91,14 +448,14 @@ DROP TABLE IF EXISTS `Usuarios`;
 CREATE TABLE `Usuarios` (
   `IdUsuario` int NOT NULL AUTO_INCREMENT COMMENT 'PK de la tabla Usuarios.',
   `Usuario` varchar(30) NOT NULL COMMENT 'Nombre de usuario del mismo. Es único.',
-  `Password` char(32) NOT NULL COMMENT 'Clave encriptada en MD5.',
-  `TokenSesion` char(32) NOT NULL COMMENT 'Token de sesión del cliente. Generado aleatoriamente y hasheado en MD5.',
+  `Password` varchar(255) NOT NULL COMMENT 'Hash argon2id de la clave en formato PHC (incluye sal y parámetros). Los MD5 heredados se migran en el próximo login.',
   `FechaAlta` datetime NOT NULL COMMENT 'Fecha de creación del Usuario.',
   `Estado` char(1) NOT NULL COMMENT 'Estado del Usuario: A (Activo) - I (Inactivo)',
-  `Rol` char(1) NOT NULL DEFAULT 'O',
+  `Rol` char(1) NOT NULL DEFAULT 'O' COMMENT 'FK a la tabla Roles. Define los permisos del usuario: A (Administrador) - O (Operador) o un rol creado.',
   PRIMARY KEY (`IdUsuario`),
   UNIQUE KEY `UI_Usuario` (`Usuario`),
-  UNIQUE KEY `UI_TokenSesion` (`TokenSesion`)
+  KEY `IX_Usuarios_Rol` (`Rol`),
+  CONSTRAINT `RefRoles2` FOREIGN KEY (`Rol`) REFERENCES `Roles` (`Rol`)
 ) ENGINE=InnoDB AUTO_INCREMENT=28 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Tabla que almacena los Usuarios Administradores que gestionan aspectos del MSTF mediante el sitio administrativo.';
 /*!40101 SET character_set_client = @saved_cs_client */;
 
@@ -108,9 +465,33 @@ CREATE TABLE `Usuarios` (
 
 LOCK TABLES `Usuarios` WRITE;
 /*!40000 ALTER TABLE `Usuarios` DISABLE KEYS */;
-INSERT INTO `Usuarios` VALUES (1,'admin','e64b78fc3bc91bcbc7dc232ba8ec59e0','257f899c88eb27dd7b281f6b8ba29872','2026-02-13 21:29:32','A','A');
+INSERT INTO `Usuarios` VALUES (1,'admin','e64b78fc3bc91bcbc7dc232ba8ec59e0','2026-02-13 21:29:32','A','A');
 /*!40000 ALTER TABLE `Usuarios` ENABLE KEYS */;
 UNLOCK TABLES;
+
+--
+-- Table structure for table `VersionApiKeys`
+--
+
+DROP TABLE IF EXISTS `VersionApiKeys`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!50503 SET character_set_client = utf8mb4 */;
+CREATE TABLE `VersionApiKeys` (
+  `IdVersion` tinyint NOT NULL COMMENT 'PK de la tabla VersionApiKeys. Única fila, 1.',
+  `Version` bigint NOT NULL COMMENT 'Aumenta con cada revocación o rotación de una API key y con cada cambio del rol S.',
+  PRIMARY KEY (`IdVersion`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Versión de las API keys. Cada réplica del MS la consulta en cada request de un sistema y vacía su caché de API keys cuando cambia.';
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Dumping data for table `VersionApiKeys`
+--
+
+LOCK TABLES `VersionApiKeys` WRITE;
+/*!40000 ALTER TABLE `VersionApiKeys` DISABLE KEYS */;
+INSERT INTO `VersionApiKeys` VALUES (1,0);
+/*!40000 ALTER TABLE `VersionApiKeys` ENABLE KEYS */;
+UNLOCK TABLES;
 /*!40103 SET TIME_ZONE=@OLD_TIME_ZONE */;
 
 /*!40101 SET SQL_MODE=@OLD_SQL_MODE */;
@@ -125,6 +506,89 @@ UNLOCK TABLES;
 --
 -- Dumping routines for database 'mstf'
 --
+/*!50003 DROP FUNCTION IF EXISTS `f_permiso_en_alcances` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` FUNCTION `f_permiso_en_alcances`(pAlcances varchar(100), pPermiso varchar(50)) RETURNS tinyint
+    DETERMINISTIC
+BEGIN
+	/*
+    Devuelve 1 si alguno de los alcances de una API key (ApiKeys.Alcances) otorga el permiso, 0 en caso contrario.
+    admin: todos los permisos. lectura: los de consulta (:read). transferencias: operar cuentas y transferencias.
+    */
+    RETURN FIND_IN_SET('admin', pAlcances) > 0
+        OR (FIND_IN_SET('lectura', pAlcances) > 0 AND pPermiso LIKE '%:read')
+        OR (FIND_IN_SET('transferencias', pAlcances) > 0 AND pPermiso IN ('cuentas:read', 'cuentas:write', 'monedas:read',
+            'transferencias:read', 'transferencias:write'));
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP FUNCTION IF EXISTS `f_tiene_permiso` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` FUNCTION `f_tiene_permiso`(pIdUsuario int, pPermiso varchar(50)) RETURNS tinyint
+    READS SQL DATA
+BEGIN
+	/*
+    Devuelve 1 si el rol del usuario tiene el permiso (RolesPermisos), 0 en caso contrario.
+    */
+    RETURN EXISTS (	SELECT	1
+					FROM	Usuarios u
+					INNER JOIN RolesPermisos rp ON rp.Rol = u.Rol
+					WHERE	u.IdUsuario = pIdUsuario AND rp.Permiso = pPermiso);
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP FUNCTION IF EXISTS `f_valida_sesion` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` FUNCTION `f_valida_sesion`(pTokenSesion char(32)) RETURNS int
+    READS SQL DATA
+BEGIN
+	/*
+    Valida que el token corresponda a una sesión vigente: token sin vencer, sin superar los minutos de
+    inactividad de la sesión y antes de su vencimiento absoluto. No controla el estado del usuario.
+    En caso que no se valide, devuelve 0. Si es válido, devuelve el IdSesion.
+    */
+    RETURN (SELECT	COALESCE(MAX(IdSesion),0)
+			FROM	Sesiones
+			WHERE	TokenHash = SHA2(pTokenSesion, 256)
+					AND FechaExpiracionToken > NOW()
+					AND FechaUltimoUso > NOW() - INTERVAL MinutosInactividad MINUTE
+					AND FechaExpiracion > NOW());
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
 /*!50003 DROP FUNCTION IF EXISTS `f_valida_usuario` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
@@ -137,13 +601,15 @@ UNLOCK TABLES;
 DELIMITER ;;
 CREATE DEFINER=`root`@`localhost` FUNCTION `f_valida_usuario`(pTokenSesion char(32)) RETURNS int
     READS SQL DATA
-    DETERMINISTIC
 BEGIN
 	/*
-    Valida que exista el token del usuario y que éste se encuentre activo. 
+    Valida que el token corresponda a una sesión vigente (f_valida_sesion) de un usuario activo.
     En caso que no se valide, devuelve 0. Si es válido, devuelve el IdUsuario.
     */
-    RETURN (SELECT COALESCE(MAX(IdUsuario),0) FROM Usuarios WHERE TokenSesion = pTokenSesion AND Estado = 'A');
+    RETURN (SELECT	COALESCE(MAX(u.IdUsuario),0)
+			FROM	Sesiones s
+			INNER JOIN Usuarios u ON u.IdUsuario = s.IdUsuario
+			WHERE	s.IdSesion = f_valida_sesion(pTokenSesion) AND u.Estado = 'A');
 END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
@@ -222,50 +688,125 @@ DELIMITER ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `tsp_activar_usuario` */;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_activar_segundo_factor` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
 /*!50003 SET character_set_client  = utf8mb4 */ ;
 /*!50003 SET character_set_results = utf8mb4 */ ;
-/*!50003 SET collation_connection  = utf8mb4_unicode_ci */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_activar_usuario`(pIdUsuario int, pCredencial VARCHAR(255), pActor
-  CHAR(10))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_activar_segundo_factor`(pTokenSesion char(32), pPaso bigint,
+    pCodigosRecuperacion json)
 SALIR: BEGIN
       /*
-      Permite cambiar el estado de un usuario a A: Activo siempre y cuando esté inactivo.
+      Permite al usuario de la sesión activar su segundo factor pendiente, una vez que el MS verificó un código
+      TOTP del paso pPaso. Guarda los códigos de recuperación (pCodigosRecuperacion: array JSON con el SHA-256
+      de cada uno, generados por el MS) y reemplaza los anteriores.
       Devuelve OK o el mensaje de error en Mensaje.
       Mensaje varchar(100)
       */
-      DECLARE pEstado char(1);
-      DECLARE pIdUsuarioActor INT DEFAULT NULL;
-      -- Manejo de error en la transacción
+      DECLARE pIdUsuario INT;
+      DECLARE pEstado CHAR(1);
+      DECLARE pUltimoPaso BIGINT;
+
       DECLARE EXIT HANDLER FOR SQLEXCEPTION
       BEGIN
+          ROLLBACK;
           SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
       END;
-      -- Resuelve identidad del actor
-      IF pActor = 'USUARIO' THEN
-          SET pIdUsuarioActor = f_valida_usuario(pCredencial);
-          IF pIdUsuarioActor = 0 THEN
-              SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje;
-              LEAVE SALIR;
-          END IF;
+
+      SET pIdUsuario = f_valida_usuario(pTokenSesion);
+      IF pIdUsuario = 0 THEN
+          SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje;
+          LEAVE SALIR;
       END IF;
-      -- Controla que el actor tenga rol Administrador
-      IF pActor = 'USUARIO' AND (SELECT Rol FROM Usuarios WHERE IdUsuario = pIdUsuarioActor) != 'A' THEN
-          SELECT 'No tienes permisos para realizar esta acción.' Mensaje;
+      SELECT  Estado, UltimoPaso
+      INTO    pEstado, pUltimoPaso
+      FROM    SegundoFactor
+      WHERE   IdUsuario = pIdUsuario;
+      IF pEstado IS NULL THEN
+          SELECT 'No hay una inscripción pendiente del segundo factor.' Mensaje;
           LEAVE SALIR;
       END IF;
-      -- Controla que el actor no se modifique a sí mismo
-      IF pActor = 'USUARIO' AND pIdUsuarioActor = pIdUsuario THEN
-          SELECT 'No puedes realizar esta acción sobre tu propia cuenta.' Mensaje;
+      IF pEstado = 'A' THEN
+          SELECT 'El segundo factor ya está activo.' Mensaje;
           LEAVE SALIR;
       END IF;
-      -- Controla parámetros
+      -- Un código ya usado no se acepta de nuevo
+      IF pPaso IS NULL OR pPaso <= pUltimoPaso THEN
+          SELECT 'El código es inválido.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      IF pCodigosRecuperacion IS NULL OR JSON_LENGTH(pCodigosRecuperacion) = 0 THEN
+          SELECT 'Los códigos de recuperación son obligatorios.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+
+      START TRANSACTION;
+          UPDATE  SegundoFactor
+          SET     Estado = 'A',
+                  UltimoPaso = pPaso,
+                  FechaActivacion = NOW()
+          WHERE   IdUsuario = pIdUsuario;
+          DELETE FROM CodigosRecuperacion WHERE IdUsuario = pIdUsuario;
+          INSERT INTO CodigosRecuperacion (IdUsuario, Hash)
+          SELECT  pIdUsuario, c.Hash
+          FROM    JSON_TABLE(pCodigosRecuperacion, '$[*]' COLUMNS (Hash char(64) PATH '$')) c;
+      COMMIT;
+      SELECT 'OK' Mensaje;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_activar_usuario` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_unicode_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_activar_usuario`(pIdUsuario int, pCredencial VARCHAR(255), pActor
+  CHAR(10))
+SALIR: BEGIN
+      /*
+      Permite cambiar el estado de un usuario a A: Activo siempre y cuando esté inactivo.
+      Devuelve OK o el mensaje de error en Mensaje.
+      Mensaje varchar(100)
+      */
+      DECLARE pEstado char(1);
+      DECLARE pIdUsuarioActor INT DEFAULT NULL;
+      -- Manejo de error en la transacción
+      DECLARE EXIT HANDLER FOR SQLEXCEPTION
+      BEGIN
+          SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
+      END;
+      -- Resuelve identidad del actor
+      IF pActor = 'USUARIO' THEN
+          SET pIdUsuarioActor = f_valida_usuario(pCredencial);
+          IF pIdUsuarioActor = 0 THEN
+              SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje;
+              LEAVE SALIR;
+          END IF;
+      END IF;
+      -- Controla que el actor tenga el permiso usuarios:admin
+      IF pActor = 'USUARIO' AND f_tiene_permiso(pIdUsuarioActor, 'usuarios:admin') = 0 THEN
+          SELECT 'No tienes permisos para realizar esta acción.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      -- Controla que el actor no se modifique a sí mismo
+      IF pActor = 'USUARIO' AND pIdUsuarioActor = pIdUsuario THEN
+          SELECT 'No puedes realizar esta acción sobre tu propia cuenta.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      -- Controla parámetros
       SET pEstado = (SELECT Estado FROM Usuarios WHERE IdUsuario = pIdUsuario);
       IF pEstado IS NULL THEN
           SELECT 'El usuario no existe.' Mensaje;
@@ -293,6 +834,83 @@ DELIMITER ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_asignar_rol_usuario` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_asignar_rol_usuario`(pIdUsuario int, pRol char(1),
+  pCredencial VARCHAR(255), pActor CHAR(10))
+SALIR: BEGIN
+      /*
+      Permite asignar un rol a un usuario. Los permisos nuevos rigen desde el próximo request del usuario.
+      El rol S (Sistema) es exclusivo de la API key del sistema. Requiere el permiso roles:write.
+      Devuelve OK o el mensaje de error en Mensaje.
+      Mensaje varchar(100)
+      */
+      DECLARE pIdUsuarioActor INT DEFAULT NULL;
+      DECLARE pRolAnterior char(1);
+
+      DECLARE EXIT HANDLER FOR SQLEXCEPTION
+      BEGIN
+          SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
+      END;
+
+      -- Resuelve identidad del actor
+      IF pActor = 'USUARIO' THEN
+          SET pIdUsuarioActor = f_valida_usuario(pCredencial);
+          IF pIdUsuarioActor = 0 THEN
+              SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje;
+              LEAVE SALIR;
+          END IF;
+          -- Controla que el actor tenga el permiso roles:write
+          IF f_tiene_permiso(pIdUsuarioActor, 'roles:write') = 0 THEN
+              SELECT 'No tienes permisos para realizar esta acción.' Mensaje;
+              LEAVE SALIR;
+          END IF;
+      END IF;
+      -- Controla que el actor no se modifique a sí mismo
+      IF pActor = 'USUARIO' AND pIdUsuarioActor = pIdUsuario THEN
+          SELECT 'No puedes realizar esta acción sobre tu propia cuenta.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      -- Controla parámetros
+      SET pRolAnterior = (SELECT Rol FROM Usuarios WHERE IdUsuario = pIdUsuario);
+      IF pRolAnterior IS NULL THEN
+          SELECT 'El usuario no existe.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      IF NOT EXISTS (SELECT 1 FROM Roles WHERE Rol = pRol) THEN
+          SELECT 'El rol no existe.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      IF pRol = 'S' THEN
+          SELECT 'El rol Sistema es exclusivo de la API key del sistema.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      IF pRolAnterior = pRol THEN
+          SELECT 'El usuario ya tiene ese rol.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      -- Asigna
+      UPDATE  Usuarios
+      SET     Rol = pRol
+      WHERE   IdUsuario = pIdUsuario;
+      -- Audita
+      INSERT INTO Operaciones (IdUsuario, TipoOperacion, FechaOperacion, Detalles)
+      VALUES (pIdUsuarioActor, 'AR', NOW(), JSON_OBJECT('IdUsuario', pIdUsuario, 'Rol', pRol, 'RolAnterior', pRolAnterior));
+      SELECT 'OK' Mensaje;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
 /*!50003 DROP PROCEDURE IF EXISTS `tsp_autenticar_actor` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
@@ -307,27 +925,52 @@ CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_autenticar_actor`(pCredencial V
 BEGIN
     /*
     Valida las credenciales de un actor (USUARIO o SISTEMA).
-    Para USUARIO: verifica que el token de sesión sea válido y el usuario esté activo.
-    Para SISTEMA: verifica que la API key coincida con el parámetro APIKEY_SISTEMA.
-    Devuelve 'OK' o un mensaje de error.
+    Para USUARIO: verifica que el token de sesión sea válido y el usuario esté activo, y registra el uso
+    de la sesión (reinicia el plazo de inactividad).
+    Para SISTEMA: verifica que la API key (por su SHA-256) esté activa y no haya vencido, y registra su uso.
+    Devuelve 'OK' o un mensaje de error en Mensaje, y en Permisos los permisos del actor separados por
+    coma: los del rol del usuario, o los del rol S (Sistema) que otorgan los alcances de la API key.
+    Para SISTEMA devuelve también IPsPermitidas (las verifica el MS) y SegundosVigencia hasta el vencimiento
+    de la API key (NULL si no vence), con los que el MS la cachea.
     */
+    DECLARE pIdUsuario INT;
+    DECLARE pIdApiKey INT;
+    DECLARE pAlcances varchar(100);
+    DECLARE pIPsPermitidas json;
+    DECLARE pFechaExpiracion datetime;
     IF pActor = 'USUARIO' THEN
-        IF f_valida_usuario(pCredencial) = 0 THEN
-            SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje;
+        SET pIdUsuario = f_valida_usuario(pCredencial);
+        IF pIdUsuario = 0 THEN
+            SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje, NULL Permisos, NULL IPsPermitidas, NULL SegundosVigencia;
         ELSE
-            SELECT 'OK' Mensaje;
+            UPDATE  Sesiones
+            SET     FechaUltimoUso = NOW()
+            WHERE   TokenHash = SHA2(pCredencial, 256);
+            SELECT  'OK' Mensaje, GROUP_CONCAT(rp.Permiso ORDER BY rp.Permiso) Permisos, NULL IPsPermitidas, NULL SegundosVigencia
+            FROM    Usuarios u
+            LEFT JOIN RolesPermisos rp ON rp.Rol = u.Rol
+            WHERE   u.IdUsuario = pIdUsuario;
         END IF;
     ELSEIF pActor = 'SISTEMA' THEN
-        IF NOT EXISTS (
-            SELECT 1 FROM Parametros
-            WHERE Parametro = 'APIKEY_SISTEMA' AND Valor = pCredencial
-        ) THEN
-            SELECT 'API Key inválida.' Mensaje;
+        SELECT  IdApiKey, Alcances, IPsPermitidas, FechaExpiracion
+        INTO    pIdApiKey, pAlcances, pIPsPermitidas, pFechaExpiracion
+        FROM    ApiKeys
+        WHERE   Hash = SHA2(pCredencial, 256) AND Estado = 'A';
+        IF pIdApiKey IS NULL THEN
+            SELECT 'API Key inválida.' Mensaje, NULL Permisos, NULL IPsPermitidas, NULL SegundosVigencia;
+        ELSEIF pFechaExpiracion IS NOT NULL AND pFechaExpiracion <= NOW() THEN
+            SELECT 'La API key expiró.' Mensaje, NULL Permisos, NULL IPsPermitidas, NULL SegundosVigencia;
         ELSE
-            SELECT 'OK' Mensaje;
+            UPDATE  ApiKeys
+            SET     FechaUltimoUso = NOW()
+            WHERE   IdApiKey = pIdApiKey;
+            SELECT  'OK' Mensaje, GROUP_CONCAT(Permiso ORDER BY Permiso) Permisos, pIPsPermitidas IPsPermitidas,
+                    TIMESTAMPDIFF(SECOND, NOW(), pFechaExpiracion) SegundosVigencia
+            FROM    RolesPermisos
+            WHERE   Rol = 'S' AND f_permiso_en_alcances(pAlcances, Permiso);
         END IF;
     ELSE
-        SELECT 'Actor inválido.' Mensaje;
+        SELECT 'Actor inválido.' Mensaje, NULL Permisos, NULL IPsPermitidas, NULL SegundosVigencia;
     END IF;
 END ;;
 DELIMITER ;
@@ -403,6 +1046,69 @@ DELIMITER ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_borrar_rol` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_borrar_rol`(pRol char(1), pCredencial VARCHAR(255), pActor CHAR(10))
+SALIR: BEGIN
+      /*
+      Permite borrar un rol sin usuarios asignados. Los roles A (Administrador) y S (Sistema) no se pueden
+      borrar. Requiere el permiso roles:write.
+      Devuelve OK o el mensaje de error en Mensaje.
+      Mensaje varchar(100)
+      */
+      DECLARE pIdUsuarioActor INT DEFAULT NULL;
+
+      DECLARE EXIT HANDLER FOR SQLEXCEPTION
+      BEGIN
+          SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
+      END;
+
+      -- Resuelve identidad del actor
+      IF pActor = 'USUARIO' THEN
+          SET pIdUsuarioActor = f_valida_usuario(pCredencial);
+          IF pIdUsuarioActor = 0 THEN
+              SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje;
+              LEAVE SALIR;
+          END IF;
+          -- Controla que el actor tenga el permiso roles:write
+          IF f_tiene_permiso(pIdUsuarioActor, 'roles:write') = 0 THEN
+              SELECT 'No tienes permisos para realizar esta acción.' Mensaje;
+              LEAVE SALIR;
+          END IF;
+      END IF;
+      -- Controla parámetros
+      IF NOT EXISTS (SELECT 1 FROM Roles WHERE Rol = pRol) THEN
+          SELECT 'El rol no existe.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      IF pRol IN ('A', 'S') THEN
+          SELECT 'El rol no se puede borrar.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      IF EXISTS (SELECT 1 FROM Usuarios WHERE Rol = pRol) THEN
+          SELECT 'El rol tiene usuarios asignados.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      -- Borra (RolesPermisos en cascada)
+      DELETE FROM Roles WHERE Rol = pRol;
+      -- Audita
+      INSERT INTO Operaciones (IdUsuario, TipoOperacion, FechaOperacion, Detalles)
+      VALUES (pIdUsuarioActor, 'BR', NOW(), JSON_OBJECT('Rol', pRol));
+      SELECT 'OK' Mensaje;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
 /*!50003 DROP PROCEDURE IF EXISTS `tsp_borrar_usuario` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
@@ -436,8 +1142,8 @@ SALIR: BEGIN
               LEAVE SALIR;
           END IF;
       END IF;
-      -- Controla que el actor tenga rol Administrador
-      IF pActor = 'USUARIO' AND (SELECT Rol FROM Usuarios WHERE IdUsuario = pIdUsuarioActor) != 'A' THEN
+      -- Controla que el actor tenga el permiso usuarios:admin
+      IF pActor = 'USUARIO' AND f_tiene_permiso(pIdUsuarioActor, 'usuarios:admin') = 0 THEN
           SELECT 'No tienes permisos para realizar esta acción.' Mensaje;
           LEAVE SALIR;
       END IF;
@@ -473,6 +1179,115 @@ DELIMITER ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_buscar_estados_transferencias` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_buscar_estados_transferencias`(pIdTransferencia varchar(50), pIdCorrelacion varchar(64), pLimite int)
+BEGIN
+    /*
+    Permite buscar el último resultado registrado de las transferencias, del más reciente al más antiguo.
+    pIdTransferencia y pIdCorrelacion vacíos no filtran.
+    */
+    SELECT  IdTransferencia, IdCorrelacion, Estado, Mensaje, Tipo, IdMoneda, IdUsuarioFinal, FechaAlta, FechaModificacion
+    FROM    EstadosTransferencias
+    WHERE   (pIdTransferencia IS NULL OR pIdTransferencia = '' OR IdTransferencia = pIdTransferencia)
+            AND (pIdCorrelacion IS NULL OR pIdCorrelacion = '' OR IdCorrelacion = pIdCorrelacion)
+    ORDER BY FechaModificacion DESC
+    LIMIT   pLimite;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_buscar_mensajes_cuarentena` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_buscar_mensajes_cuarentena`(pIdTransferencia varchar(50), pLimite int)
+BEGIN
+    /*
+    Permite buscar los mensajes en cuarentena, del más reciente al más antiguo.
+    pIdTransferencia vacío no filtra.
+    */
+    SELECT  IdMensaje, Origen, IdTransferencia, Contenido, `Error`, FechaAlta
+    FROM    MensajesCuarentena
+    WHERE   (pIdTransferencia IS NULL OR pIdTransferencia = '' OR IdTransferencia = pIdTransferencia)
+    ORDER BY IdMensaje DESC
+    LIMIT   pLimite;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_buscar_operaciones` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_buscar_operaciones`(pIdUsuario int, pTipoOperacion char(2),
+    pEntidad varchar(20), pIdEntidad varchar(40), pFechaInicio datetime, pFechaFin datetime, pLimite int)
+BEGIN
+    /*
+    Permite buscar las operaciones auditadas, de la más reciente a la más antigua.
+    pIdUsuario es el usuario que realizó la operación; pEntidad (Moneda, Parametro, Usuario, Rol, ApiKey, Cuenta
+    o Transferencia) y pIdEntidad filtran por la entidad sobre la que se realizó, según su clave en Detalles.
+    pFechaInicio inclusive y pFechaFin exclusive. Los parámetros en 0, vacíos o NULL no filtran.
+    Sin pLimite devuelve las últimas 100.
+    */
+    DECLARE pRuta varchar(30);
+
+    IF pLimite IS NULL OR pLimite <= 0 THEN
+        SET pLimite = 100;
+    END IF;
+
+    SET pRuta = CASE pEntidad
+        WHEN 'Moneda' THEN '$.IdMoneda'
+        WHEN 'Parametro' THEN '$.Parametro'
+        WHEN 'Usuario' THEN '$.IdUsuario'
+        WHEN 'Rol' THEN '$.Rol'
+        WHEN 'ApiKey' THEN '$.IdApiKey'
+        WHEN 'Cuenta' THEN '$.IdCuenta'
+        WHEN 'Transferencia' THEN '$.IdTransferencia'
+        ELSE NULL
+    END;
+
+    SELECT  IdOperacion, IdUsuario, TipoOperacion, FechaOperacion, Detalles, Hash
+    FROM    Operaciones
+    WHERE   (pIdUsuario IS NULL OR pIdUsuario = 0 OR IdUsuario = pIdUsuario)
+            AND (pTipoOperacion IS NULL OR pTipoOperacion = '' OR TipoOperacion = pTipoOperacion)
+            AND (pRuta IS NULL OR JSON_CONTAINS_PATH(Detalles, 'one', pRuta))
+            AND (pRuta IS NULL OR pIdEntidad IS NULL OR pIdEntidad = ''
+                OR JSON_UNQUOTE(JSON_EXTRACT(Detalles, pRuta)) = pIdEntidad)
+            AND (pFechaInicio IS NULL OR FechaOperacion >= pFechaInicio)
+            AND (pFechaFin IS NULL OR FechaOperacion < pFechaFin)
+    ORDER BY IdOperacion DESC
+    LIMIT   pLimite;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
 /*!50003 DROP PROCEDURE IF EXISTS `tsp_buscar_parametros` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
@@ -492,9 +1307,12 @@ SALIR: BEGIN
 
     SET SESSION TRANSACTION ISOLATION LEVEL READ UNCOMMITTED;
     
+    SET pCadena = COALESCE(pCadena, '');
+
     SELECT		Parametro, Valor, Descripcion, EsModificable
     FROM		Parametros
-    WHERE		(pSoloModificables = 'N' OR (EsModificable = 'S' AND pSoloModificables = 'S'))
+    WHERE		(Parametro LIKE CONCAT('%', TRIM(pCadena), '%')) AND
+				(pSoloModificables = 'N' OR (EsModificable = 'S' AND pSoloModificables = 'S'))
     ORDER BY	Parametro;
     
 	SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ;
@@ -504,6 +1322,35 @@ DELIMITER ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_buscar_sesiones` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_buscar_sesiones`(pTokenSesion char(32))
+BEGIN
+	/*
+    Lista las sesiones vigentes del usuario de la sesión, de la usada más recientemente a la más antigua.
+    Actual = 'S' indica la sesión del token. Las sesiones vencidas no se listan.
+    */
+    SELECT	IdSesion, Dispositivo, IP, FechaInicio, FechaUltimoUso, FechaExpiracionToken, FechaExpiracion,
+			IF(TokenHash = SHA2(pTokenSesion, 256), 'S', 'N') Actual
+    FROM	Sesiones
+    WHERE	IdUsuario = f_valida_usuario(pTokenSesion)
+			AND FechaUltimoUso > NOW() - INTERVAL MinutosInactividad MINUTE
+			AND FechaExpiracion > NOW()
+    ORDER BY FechaUltimoUso DESC, IdSesion DESC;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
 /*!50003 DROP PROCEDURE IF EXISTS `tsp_buscar_usuarios` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
@@ -526,11 +1373,12 @@ SALIR: BEGIN
 
       SET SESSION TRANSACTION ISOLATION LEVEL READ UNCOMMITTED;
 
-      SELECT      IdUsuario, Usuario, FechaAlta, Estado, Rol
-      FROM        Usuarios
-      WHERE       (Usuario LIKE CONCAT('%', TRIM(pCadena), '%')) AND
-                  (pIncluyeInactivosPendientes = 'S' OR (Estado = 'A' AND pIncluyeInactivosPendientes = 'N'))
-      ORDER BY    Usuario;
+      SELECT      u.IdUsuario, u.Usuario, u.FechaAlta, u.Estado, u.Rol, IF(sf.Estado = 'A', 'S', 'N') SegundoFactor
+      FROM        Usuarios u
+      LEFT JOIN   SegundoFactor sf ON sf.IdUsuario = u.IdUsuario
+      WHERE       (u.Usuario LIKE CONCAT('%', TRIM(pCadena), '%')) AND
+                  (pIncluyeInactivosPendientes = 'S' OR (u.Estado = 'A' AND pIncluyeInactivosPendientes = 'N'))
+      ORDER BY    u.Usuario;
 
       SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ;
   END ;;
@@ -539,32 +1387,179 @@ DELIMITER ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `tsp_confirmar_cuenta_usuario` */;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_completar_login_usuario` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
 /*!50003 SET character_set_client  = utf8mb4 */ ;
 /*!50003 SET character_set_results = utf8mb4 */ ;
-/*!50003 SET collation_connection  = utf8mb4_unicode_ci */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_confirmar_cuenta_usuario`(pTokenSesion char(32), pPassword varchar(50), pConfirmarPassword
-  varchar(50))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_completar_login_usuario`(pTokenDesafio char(32), pPaso bigint,
+    pCodigoRecuperacion char(64), pCodigosRecuperacion json, pTokenSesion char(32), pRefreshToken char(32),
+    pDispositivo varchar(255), pIP varchar(45), pMinutosToken int, pMinutosInactividad int, pHorasDuracion int,
+    pMaxSesiones int)
 SALIR: BEGIN
+      /*
+      Completa el login de un desafío de segundo factor (ver tsp_login_usuario) y crea la sesión (tsp_crear_sesion).
+      El MS verifica el código TOTP e informa su paso en pPaso (debe ser posterior al último usado), o informa el
+      SHA-256 de un código de recuperación en pCodigoRecuperacion, que se consume (solo en desafíos V).
+      Sin un código válido cuenta un intento fallido: al quinto se borra el desafío y hay que volver a iniciar sesión.
+      En un desafío de inscripción (I) activa el segundo factor pendiente y guarda los códigos de recuperación
+      pCodigosRecuperacion (array JSON con el SHA-256 de cada uno).
+      Devuelve OK + datos del usuario y la sesión (como tsp_login_usuario) o el mensaje de error en Mensaje.
+      */
+      DECLARE pIdDesafio INT;
       DECLARE pIdUsuario INT;
+      DECLARE pTipo CHAR(1);
+      DECLARE pIntentos INT;
       DECLARE pEstado CHAR(1);
+      DECLARE pUltimoPaso BIGINT;
+      DECLARE pValido BOOLEAN DEFAULT FALSE;
+      DECLARE pIdSesion INT;
 
       DECLARE EXIT HANDLER FOR SQLEXCEPTION
       BEGIN
-          SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
+          ROLLBACK;
+          SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje,
+                 0 IdUsuario, NULL Usuario, NULL FechaAlta, NULL Estado, NULL Rol,
+                 0 IdSesion, NULL FechaInicio, NULL FechaExpiracionToken, NULL FechaExpiracion, NULL Desafio;
       END;
 
-      -- Verifica sesión (acepta estado P o A)
-      SELECT  IdUsuario, Estado
-      INTO    pIdUsuario, pEstado
-      FROM    Usuarios
-      WHERE   TokenSesion = pTokenSesion AND Estado IN ('A', 'P');
+      START TRANSACTION;
+          -- Controla el desafío. Se bloquean el desafío y el segundo factor hasta el final de la transacción:
+          -- los intentos concurrentes del mismo desafío se serializan (un TOTP no se acepta dos veces y
+          -- los intentos no superan 5)
+          SELECT  d.IdDesafio, d.IdUsuario, d.Tipo, d.Intentos
+          INTO    pIdDesafio, pIdUsuario, pTipo, pIntentos
+          FROM    DesafiosLogin d
+          INNER JOIN Usuarios u ON u.IdUsuario = d.IdUsuario
+          WHERE   d.TokenHash = SHA2(pTokenDesafio, 256) AND d.FechaExpiracion > NOW() AND u.Estado = 'A'
+          FOR UPDATE OF d;
+          IF pIdDesafio IS NULL THEN
+              ROLLBACK;
+              SELECT 'El desafío expiró. Vuelva a iniciar sesión.' Mensaje,
+                     0 IdUsuario, NULL Usuario, NULL FechaAlta, NULL Estado, NULL Rol,
+                     0 IdSesion, NULL FechaInicio, NULL FechaExpiracionToken, NULL FechaExpiracion, NULL Desafio;
+              LEAVE SALIR;
+          END IF;
+          SELECT  Estado, UltimoPaso
+          INTO    pEstado, pUltimoPaso
+          FROM    SegundoFactor
+          WHERE   IdUsuario = pIdUsuario
+          FOR UPDATE;
+          IF pTipo = 'I' AND (pEstado IS NULL OR pEstado != 'P') THEN
+              ROLLBACK;
+              SELECT 'Debe inscribir el segundo factor antes de verificar el código.' Mensaje,
+                     0 IdUsuario, NULL Usuario, NULL FechaAlta, NULL Estado, NULL Rol,
+                     0 IdSesion, NULL FechaInicio, NULL FechaExpiracionToken, NULL FechaExpiracion, NULL Desafio;
+              LEAVE SALIR;
+          END IF;
+          IF pTipo = 'I' AND (pCodigosRecuperacion IS NULL OR JSON_LENGTH(pCodigosRecuperacion) = 0) THEN
+              ROLLBACK;
+              SELECT 'Los códigos de recuperación son obligatorios.' Mensaje,
+                     0 IdUsuario, NULL Usuario, NULL FechaAlta, NULL Estado, NULL Rol,
+                     0 IdSesion, NULL FechaInicio, NULL FechaExpiracionToken, NULL FechaExpiracion, NULL Desafio;
+              LEAVE SALIR;
+          END IF;
+
+          -- Controla el código: TOTP con un paso posterior al último usado (el UPDATE condicional lo consume)
+          -- o código de recuperación sin usar
+          IF pPaso IS NOT NULL AND (pTipo = 'I' OR pEstado = 'A') THEN
+              UPDATE SegundoFactor SET UltimoPaso = pPaso WHERE IdUsuario = pIdUsuario AND UltimoPaso < pPaso;
+              SET pValido = ROW_COUNT() > 0;
+          END IF;
+          IF NOT pValido AND pCodigoRecuperacion IS NOT NULL AND pTipo = 'V' THEN
+              DELETE FROM CodigosRecuperacion WHERE IdUsuario = pIdUsuario AND Hash = pCodigoRecuperacion;
+              SET pValido = ROW_COUNT() > 0;
+          END IF;
+
+          IF NOT pValido THEN
+              IF pIntentos + 1 >= 5 THEN
+                  DELETE FROM DesafiosLogin WHERE IdDesafio = pIdDesafio;
+              ELSE
+                  UPDATE DesafiosLogin SET Intentos = Intentos + 1 WHERE IdDesafio = pIdDesafio;
+              END IF;
+              COMMIT;
+              SELECT IF(pIntentos + 1 >= 5, 'Demasiados códigos inválidos. Vuelva a iniciar sesión.',
+                        'El código es inválido.') Mensaje,
+                 0 IdUsuario, NULL Usuario, NULL FechaAlta, NULL Estado, NULL Rol,
+                 0 IdSesion, NULL FechaInicio, NULL FechaExpiracionToken, NULL FechaExpiracion, NULL Desafio;
+              LEAVE SALIR;
+          END IF;
+
+          -- El desafío se consume una sola vez
+          DELETE FROM DesafiosLogin WHERE IdDesafio = pIdDesafio;
+          IF ROW_COUNT() = 0 THEN
+              ROLLBACK;
+              SELECT 'El desafío expiró. Vuelva a iniciar sesión.' Mensaje,
+                     0 IdUsuario, NULL Usuario, NULL FechaAlta, NULL Estado, NULL Rol,
+                     0 IdSesion, NULL FechaInicio, NULL FechaExpiracionToken, NULL FechaExpiracion, NULL Desafio;
+              LEAVE SALIR;
+          END IF;
+
+          -- Inscripción: activa el segundo factor con sus códigos de recuperación
+          IF pTipo = 'I' THEN
+              UPDATE  SegundoFactor
+              SET     Estado = 'A',
+                      FechaActivacion = NOW()
+              WHERE   IdUsuario = pIdUsuario;
+              DELETE FROM CodigosRecuperacion WHERE IdUsuario = pIdUsuario;
+              INSERT INTO CodigosRecuperacion (IdUsuario, Hash)
+              SELECT  pIdUsuario, c.Hash
+              FROM    JSON_TABLE(pCodigosRecuperacion, '$[*]' COLUMNS (Hash char(64) PATH '$')) c;
+          END IF;
+
+          CALL tsp_crear_sesion(pIdUsuario, pTokenSesion, pRefreshToken, pDispositivo, pIP, pMinutosToken,
+              pMinutosInactividad, pHorasDuracion, pMaxSesiones, pIdSesion);
+      COMMIT;
+
+      SELECT  'OK' Mensaje, u.IdUsuario, u.Usuario, u.FechaAlta, u.Estado, u.Rol,
+              s.IdSesion, s.FechaInicio, s.FechaExpiracionToken, s.FechaExpiracion, NULL Desafio
+      FROM    Usuarios u
+      INNER JOIN Sesiones s ON s.IdUsuario = u.IdUsuario
+      WHERE   s.IdSesion = pIdSesion;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_confirmar_cuenta_usuario` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_unicode_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_confirmar_cuenta_usuario`(pTokenSesion char(32), pPassword varchar(255))
+SALIR: BEGIN
+      /*
+      Permite al usuario Pendiente reemplazar su contraseña temporal y activarse.
+      pPassword es el hash argon2id de la nueva contraseña; la política de contraseñas
+      (parámetros PASSWORD*) y la confirmación se validan en el MS.
+      Cierra todas las sesiones del usuario: debe volver a iniciar sesión con la nueva contraseña.
+      Devuelve OK o el mensaje de error en Mensaje.
+      */
+      DECLARE pIdUsuario INT;
+      DECLARE pEstado CHAR(1);
+
+      DECLARE EXIT HANDLER FOR SQLEXCEPTION
+      BEGIN
+          SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
+      END;
+
+      -- Verifica sesión (acepta estado P o A)
+      SELECT  u.IdUsuario, u.Estado
+      INTO    pIdUsuario, pEstado
+      FROM    Sesiones s
+      INNER JOIN Usuarios u ON u.IdUsuario = s.IdUsuario
+      WHERE   s.IdSesion = f_valida_sesion(pTokenSesion) AND u.Estado IN ('A', 'P');
 
       IF pIdUsuario IS NULL THEN
           SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje;
@@ -581,41 +1576,160 @@ SALIR: BEGIN
           SELECT 'La contraseña es obligatoria.' Mensaje;
           LEAVE SALIR;
       END IF;
-      IF (pConfirmarPassword IS NULL OR pConfirmarPassword = '') THEN
-          SELECT 'La confirmación de contraseña es obligatoria.' Mensaje;
+
+      -- Actualiza contraseña, activa usuario y cierra sus sesiones
+      UPDATE  Usuarios
+      SET     `Password` = pPassword,
+              Estado = 'A'
+      WHERE   IdUsuario = pIdUsuario;
+      DELETE FROM Sesiones WHERE IdUsuario = pIdUsuario;
+
+      SELECT 'OK' Mensaje;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_crear_apikey` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_crear_apikey`(pNombre varchar(60), pSistema varchar(60),
+  pHash char(64), pPrefijo varchar(12), pAlcances json, pIPsPermitidas json, pFechaExpiracion datetime,
+  pCredencial VARCHAR(255), pActor CHAR(10))
+SALIR: BEGIN
+      /*
+      Permite crear una API key para un sistema cliente. pHash: SHA-256 de la API key, generada por el MS.
+      pAlcances: array JSON con admin, lectura y/o transferencias. pIPsPermitidas: array JSON de IPs o redes
+      CIDR, ya validadas por el MS (vacío: cualquiera). pFechaExpiracion: NULL si no vence.
+      Requiere el permiso apikeys:write.
+      Devuelve OK o el mensaje de error en Mensaje, y el Id de la API key creada en IdApiKey.
+      Mensaje varchar(100)
+      */
+      DECLARE pIdUsuarioActor INT DEFAULT NULL;
+      DECLARE pIdApiKey INT;
+      DECLARE pAlcanceInvalido varchar(20);
+
+      DECLARE EXIT HANDLER FOR SQLEXCEPTION
+      BEGIN
+          ROLLBACK;
+          SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje, NULL IdApiKey;
+      END;
+
+      -- Resuelve identidad del actor
+      IF pActor = 'USUARIO' THEN
+          SET pIdUsuarioActor = f_valida_usuario(pCredencial);
+          IF pIdUsuarioActor = 0 THEN
+              SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje, NULL IdApiKey;
+              LEAVE SALIR;
+          END IF;
+          -- Controla que el actor tenga el permiso apikeys:write
+          IF f_tiene_permiso(pIdUsuarioActor, 'apikeys:write') = 0 THEN
+              SELECT 'No tienes permisos para realizar esta acción.' Mensaje, NULL IdApiKey;
+              LEAVE SALIR;
+          END IF;
+      END IF;
+      -- Controla parámetros
+      IF pNombre IS NULL OR TRIM(pNombre) = '' THEN
+          SELECT 'El nombre de la API key es obligatorio.' Mensaje, NULL IdApiKey;
+          LEAVE SALIR;
+      END IF;
+      IF pSistema IS NULL OR TRIM(pSistema) = '' THEN
+          SELECT 'El sistema de la API key es obligatorio.' Mensaje, NULL IdApiKey;
           LEAVE SALIR;
       END IF;
-      IF (CHAR_LENGTH(pPassword) < 6) THEN
-          SELECT 'La contraseña debe tener al menos 6 caracteres.' Mensaje;
+      IF EXISTS (SELECT 1 FROM ApiKeys WHERE Nombre = pNombre) THEN
+          SELECT 'Ya existe una API key con ese nombre.' Mensaje, NULL IdApiKey;
           LEAVE SALIR;
       END IF;
-      IF (pPassword NOT REGEXP '[A-Za-z]') THEN
-          SELECT 'La contraseña debe incluir al menos una letra.' Mensaje;
+      IF pAlcances IS NULL OR JSON_TYPE(pAlcances) <> 'ARRAY' THEN
+          SELECT 'Los alcances deben ser un array JSON.' Mensaje, NULL IdApiKey;
           LEAVE SALIR;
       END IF;
-      IF (pPassword NOT REGEXP '[0-9]') THEN
-          SELECT 'La contraseña debe incluir al menos un número.' Mensaje;
+      IF JSON_LENGTH(pAlcances) = 0 THEN
+          SELECT 'Debe indicar al menos un alcance.' Mensaje, NULL IdApiKey;
           LEAVE SALIR;
       END IF;
-      IF (pPassword != pConfirmarPassword) THEN
-          SELECT 'La contraseña no coincide con su confirmación.' Mensaje;
+      SET pAlcanceInvalido = (
+          SELECT  COALESCE(a.Alcance, 'null')
+          FROM    JSON_TABLE(pAlcances, '$[*]' COLUMNS (Alcance varchar(20) PATH '$')) a
+          WHERE   a.Alcance IS NULL OR a.Alcance NOT IN ('admin', 'lectura', 'transferencias')
+          LIMIT   1);
+      IF pAlcanceInvalido IS NOT NULL THEN
+          SELECT CONCAT('El alcance ', pAlcanceInvalido, ' no existe.') Mensaje, NULL IdApiKey;
+          LEAVE SALIR;
+      END IF;
+      IF pIPsPermitidas IS NULL OR JSON_TYPE(pIPsPermitidas) <> 'ARRAY' THEN
+          SELECT 'Las IPs permitidas deben ser un array JSON.' Mensaje, NULL IdApiKey;
+          LEAVE SALIR;
+      END IF;
+      IF pFechaExpiracion IS NOT NULL AND pFechaExpiracion <= NOW() THEN
+          SELECT 'La fecha de expiración debe ser futura.' Mensaje, NULL IdApiKey;
           LEAVE SALIR;
       END IF;
 
-      -- Actualiza contraseña, activa usuario y regenera token
-      UPDATE  Usuarios
-      SET     `Password` = pPassword,
-              Estado = 'A',
-              TokenSesion = md5(CONCAT(pIdUsuario, UNIX_TIMESTAMP(), RAND()))
-      WHERE   IdUsuario = pIdUsuario;
-
-      SELECT 'OK' Mensaje;
+      START TRANSACTION;
+          INSERT INTO ApiKeys (Nombre, Sistema, Prefijo, Hash, Alcances, IPsPermitidas, FechaAlta, FechaExpiracion, Estado)
+          SELECT  pNombre, pSistema, pPrefijo, pHash, GROUP_CONCAT(DISTINCT a.Alcance), pIPsPermitidas, NOW(), pFechaExpiracion, 'A'
+          FROM    JSON_TABLE(pAlcances, '$[*]' COLUMNS (Alcance varchar(20) PATH '$')) a;
+          SET pIdApiKey = LAST_INSERT_ID();
+          -- Audita
+          INSERT INTO Operaciones (IdUsuario, TipoOperacion, FechaOperacion, Detalles)
+          VALUES (pIdUsuarioActor, 'CK', NOW(), JSON_OBJECT('IdApiKey', pIdApiKey, 'Nombre', pNombre, 'Sistema', pSistema,
+              'Alcances', pAlcances, 'IPsPermitidas', pIPsPermitidas, 'FechaExpiracion', pFechaExpiracion));
+      COMMIT;
+      SELECT 'OK' Mensaje, pIdApiKey IdApiKey;
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_crear_mensaje_cuarentena` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_crear_mensaje_cuarentena`(pOrigen varchar(255), pIdTransferencia varchar(50),
+  pContenido mediumtext, pError varchar(500))
+SALIR: BEGIN
+    /*
+    Registra un mensaje aislado por el consumidor. Lo invoca únicamente el MS, sin actor.
+    Devuelve OK o el mensaje de error en Mensaje.
+    Mensaje varchar(100)
+    */
+    DECLARE EXIT HANDLER FOR SQLEXCEPTION
+    BEGIN
+        SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
+    END;
+
+    IF (pOrigen IS NULL OR pOrigen = '') THEN
+        SELECT 'El origen es obligatorio.' Mensaje;
+        LEAVE SALIR;
+    END IF;
+
+    INSERT INTO MensajesCuarentena (Origen, IdTransferencia, Contenido, `Error`, FechaAlta)
+    VALUES (pOrigen, COALESCE(pIdTransferencia, ''), COALESCE(pContenido, ''), LEFT(COALESCE(pError, ''), 500), NOW());
+
+    SELECT 'OK' Mensaje;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
 /*!50003 DROP PROCEDURE IF EXISTS `tsp_crear_moneda` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
@@ -691,6 +1805,154 @@ DELIMITER ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_crear_rol` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_crear_rol`(pRol char(1), pNombre varchar(50), pPermisos json,
+  pCredencial VARCHAR(255), pActor CHAR(10))
+SALIR: BEGIN
+      /*
+      Permite crear un rol con sus permisos. pRol: una letra mayúscula. pPermisos: array JSON de permisos
+      del catálogo (Permisos). Requiere el permiso roles:write.
+      Devuelve OK o el mensaje de error en Mensaje.
+      Mensaje varchar(100)
+      */
+      DECLARE pIdUsuarioActor INT DEFAULT NULL;
+      DECLARE pPermisoInvalido varchar(50);
+
+      DECLARE EXIT HANDLER FOR SQLEXCEPTION
+      BEGIN
+          ROLLBACK;
+          SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
+      END;
+
+      -- Resuelve identidad del actor
+      IF pActor = 'USUARIO' THEN
+          SET pIdUsuarioActor = f_valida_usuario(pCredencial);
+          IF pIdUsuarioActor = 0 THEN
+              SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje;
+              LEAVE SALIR;
+          END IF;
+          -- Controla que el actor tenga el permiso roles:write
+          IF f_tiene_permiso(pIdUsuarioActor, 'roles:write') = 0 THEN
+              SELECT 'No tienes permisos para realizar esta acción.' Mensaje;
+              LEAVE SALIR;
+          END IF;
+      END IF;
+      -- Controla parámetros
+      IF pRol IS NULL OR NOT REGEXP_LIKE(pRol, '^[A-Z]$', 'c') THEN
+          SELECT 'El código del rol debe ser una letra mayúscula.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      IF EXISTS (SELECT 1 FROM Roles WHERE Rol = pRol) THEN
+          SELECT 'El rol ya existe.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      IF pNombre IS NULL OR TRIM(pNombre) = '' THEN
+          SELECT 'El nombre del rol es obligatorio.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      IF EXISTS (SELECT 1 FROM Roles WHERE Nombre = pNombre AND Rol != pRol) THEN
+          SELECT 'Ya existe un rol con ese nombre.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      IF pPermisos IS NULL OR JSON_TYPE(pPermisos) <> 'ARRAY' THEN
+          SELECT 'Los permisos deben ser un array JSON.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      SET pPermisoInvalido = (
+          SELECT  COALESCE(p.Permiso, 'null')
+          FROM    JSON_TABLE(pPermisos, '$[*]' COLUMNS (Permiso varchar(50) PATH '$')) p
+          WHERE   p.Permiso IS NULL
+               OR NOT EXISTS (SELECT 1 FROM Permisos WHERE Permiso = p.Permiso COLLATE utf8mb4_0900_ai_ci)
+          LIMIT   1);
+      IF pPermisoInvalido IS NOT NULL THEN
+          SELECT CONCAT('El permiso ', pPermisoInvalido, ' no existe.') Mensaje;
+          LEAVE SALIR;
+      END IF;
+
+      START TRANSACTION;
+          INSERT INTO Roles (Rol, Nombre) VALUES (pRol, pNombre);
+          INSERT INTO RolesPermisos (Rol, Permiso)
+          SELECT  DISTINCT pRol, p.Permiso
+          FROM    JSON_TABLE(pPermisos, '$[*]' COLUMNS (Permiso varchar(50) PATH '$')) p;
+          -- Audita
+          INSERT INTO Operaciones (IdUsuario, TipoOperacion, FechaOperacion, Detalles)
+          VALUES (pIdUsuarioActor, 'CR', NOW(), JSON_OBJECT('Rol', pRol, 'Nombre', pNombre, 'Permisos', pPermisos));
+      COMMIT;
+      SELECT 'OK' Mensaje;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_crear_sesion` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_crear_sesion`(pIdUsuario int, pTokenSesion char(32),
+    pRefreshToken char(32), pDispositivo varchar(255), pIP varchar(45), pMinutosToken int, pMinutosInactividad int,
+    pHorasDuracion int, pMaxSesiones int, OUT pIdSesion int)
+BEGIN
+	/*
+    Crea una sesión del usuario (uso interno de tsp_login_usuario y tsp_completar_login_usuario, que validan
+    las credenciales). No devuelve resultados: el Id de la sesión queda en pIdSesion.
+    pTokenSesion y pRefreshToken los genera el MS; se guarda solo su SHA-256.
+    El token vence a los pMinutosToken, la sesión a los pMinutosInactividad sin uso o a las pHorasDuracion.
+    Borra las sesiones vencidas del usuario y, si tiene pMaxSesiones, cierra las usadas hace más tiempo.
+    Borra sus intentos de login fallidos (BloqueosLogin).
+    */
+    DECLARE pCantidadSesiones INT;
+    DECLARE pSobrantes INT;
+
+    -- Borra las sesiones vencidas (por inactividad o vencimiento absoluto)
+    DELETE FROM Sesiones
+    WHERE   IdUsuario = pIdUsuario
+            AND (FechaUltimoUso <= NOW() - INTERVAL MinutosInactividad MINUTE OR FechaExpiracion <= NOW());
+
+    -- Límite de sesiones simultáneas: cierra las usadas hace más tiempo
+    SET pCantidadSesiones = (SELECT COUNT(*) FROM Sesiones WHERE IdUsuario = pIdUsuario);
+    SET pSobrantes = pCantidadSesiones - pMaxSesiones + 1;
+    IF pSobrantes > 0 THEN
+        DELETE FROM Sesiones
+        WHERE   IdUsuario = pIdUsuario
+        ORDER BY FechaUltimoUso, IdSesion
+        LIMIT pSobrantes;
+    END IF;
+
+    -- Login exitoso: olvida los intentos fallidos y bloqueos del usuario
+    DELETE  b
+    FROM    BloqueosLogin b
+    INNER JOIN Usuarios u ON u.Usuario = b.Usuario
+    WHERE   u.IdUsuario = pIdUsuario;
+
+    -- Crea la sesión
+    INSERT INTO Sesiones (IdUsuario, TokenHash, RefreshHash, Dispositivo, IP, FechaInicio, FechaUltimoUso,
+                          FechaExpiracionToken, FechaExpiracion, MinutosInactividad)
+    VALUES (pIdUsuario, SHA2(pTokenSesion, 256), SHA2(pRefreshToken, 256), pDispositivo, pIP, NOW(), NOW(),
+            LEAST(NOW() + INTERVAL pMinutosToken MINUTE, NOW() + INTERVAL pHorasDuracion HOUR),
+            NOW() + INTERVAL pHorasDuracion HOUR, pMinutosInactividad);
+    SET pIdSesion = LAST_INSERT_ID();
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
 /*!50003 DROP PROCEDURE IF EXISTS `tsp_crear_usuario` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
@@ -701,71 +1963,87 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_crear_usuario`(pUsuario varchar(30), pCredencial VARCHAR(255), pActor
-   CHAR(10))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_crear_usuario`(pUsuario varchar(30), pPassword varchar(255), pCredencial
+   VARCHAR(255), pActor CHAR(10))
 SALIR: BEGIN
       /*
       Permite crear un usuario administrativo en estado P: Pendiente.
-      Genera una contraseña aleatoria que se devuelve para informar al usuario.
+      pPassword es el hash argon2id de la contraseña temporal, que genera e informa el MS.
       Al iniciar sesión por primera vez, deberá cambiar su contraseña y se activará.
-      Devuelve OK + Id + PasswordTemporal o el mensaje de error.
-      Mensaje varchar(100), Id int, PasswordTemporal char(32)
+      Devuelve OK + Id o el mensaje de error.
+      Mensaje varchar(100), Id int
       */
       DECLARE pIdUsuario INT;
       DECLARE pIdUsuarioActor INT DEFAULT NULL;
-      DECLARE pTokenNuevo CHAR(32);
-      DECLARE pPasswordTemporal char(32);
       -- Manejo de error en la transacción
       DECLARE EXIT HANDLER FOR SQLEXCEPTION
       BEGIN
-          SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje, NULL Id, NULL PasswordTemporal;
+          SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje, NULL Id;
       END;
       -- Resuelve identidad del actor
       IF pActor = 'USUARIO' THEN
           SET pIdUsuarioActor = f_valida_usuario(pCredencial);
           IF pIdUsuarioActor = 0 THEN
-              SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje, NULL Id, NULL PasswordTemporal;
+              SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje, NULL Id;
               LEAVE SALIR;
           END IF;
       END IF;
-      -- Controla que el actor tenga rol Administrador
-      IF pActor = 'USUARIO' AND (SELECT Rol FROM Usuarios WHERE IdUsuario = pIdUsuarioActor) != 'A' THEN
-          SELECT 'No tienes permisos para realizar esta acción.' Mensaje, NULL Id, NULL PasswordTemporal;
+      -- Controla que el actor tenga el permiso usuarios:admin
+      IF pActor = 'USUARIO' AND f_tiene_permiso(pIdUsuarioActor, 'usuarios:admin') = 0 THEN
+          SELECT 'No tienes permisos para realizar esta acción.' Mensaje, NULL Id;
           LEAVE SALIR;
       END IF;
       -- Controla parámetros
       IF (pUsuario IS NULL OR pUsuario = '') THEN
-          SELECT 'El nombre de usuario es obligatorio.' Mensaje, NULL Id, NULL PasswordTemporal;
+          SELECT 'El nombre de usuario es obligatorio.' Mensaje, NULL Id;
           LEAVE SALIR;
       END IF;
       IF EXISTS(SELECT Usuario FROM Usuarios WHERE Usuario = pUsuario) THEN
-          SELECT 'El nombre de usuario ya existe.' Mensaje, NULL Id, NULL PasswordTemporal;
-          LEAVE SALIR;
-      END IF;
-      -- Genera password y token de sesión de forma aleatoria
-      SET pPasswordTemporal = CONCAT(
-          SUBSTRING('ABCDEFGHJKLMNPQRSTUVWXYZ', FLOOR(1 + RAND() * 24), 1),
-          SUBSTRING('abcdefghjkmnpqrstuvwxyz', FLOOR(1 + RAND() * 23), 1),
-          SUBSTRING('0123456789', FLOOR(1 + RAND() * 10), 1),
-          SUBSTRING('0123456789', FLOOR(1 + RAND() * 10), 1),
-          SUBSTRING('ABCDEFGHJKLMNPQRSTUVWXYZ', FLOOR(1 + RAND() * 24), 1),
-          SUBSTRING('abcdefghjkmnpqrstuvwxyz', FLOOR(1 + RAND() * 23), 1)
-      );
-      SET pTokenNuevo = md5(CONCAT(pUsuario, UNIX_TIMESTAMP(), RAND()));
+          SELECT 'El nombre de usuario ya existe.' Mensaje, NULL Id;
+          LEAVE SALIR;
+      END IF;
+      IF (pPassword IS NULL OR pPassword = '') THEN
+          SELECT 'La contraseña es obligatoria.' Mensaje, NULL Id;
+          LEAVE SALIR;
+      END IF;
       -- Crea al usuario
-      INSERT INTO Usuarios (Usuario, `Password`, TokenSesion, FechaAlta, Estado)
-      VALUES (pUsuario, md5(pPasswordTemporal), pTokenNuevo, NOW(), 'P');
+      INSERT INTO Usuarios (Usuario, `Password`, FechaAlta, Estado)
+      VALUES (pUsuario, pPassword, NOW(), 'P');
       SET pIdUsuario = LAST_INSERT_ID();
       -- Audita
       INSERT INTO Operaciones (IdUsuario, TipoOperacion, FechaOperacion, Detalles)
       VALUES (pIdUsuarioActor, 'CU', NOW(), JSON_OBJECT('IdUsuario', pIdUsuario, 'Usuario', pUsuario));
-      SELECT 'OK' Mensaje, pIdUsuario Id, pPasswordTemporal PasswordTemporal;
+      SELECT 'OK' Mensaje, pIdUsuario Id;
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_dame_cabeza_operaciones` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_dame_cabeza_operaciones`()
+BEGIN
+    /*
+    Permite obtener la cabeza de la cadena de hashes de Operaciones: IdOperacion y Hash de la última operación.
+    */
+    SELECT  IdOperacion, Hash
+    FROM    CadenaOperaciones
+    WHERE   IdCadena = 1;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
 /*!50003 DROP PROCEDURE IF EXISTS `tsp_dame_moneda` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
@@ -829,60 +2107,197 @@ DELIMITER ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `tsp_dame_usuario` */;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_dame_password_usuario` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
 /*!50003 SET character_set_client  = utf8mb4 */ ;
 /*!50003 SET character_set_results = utf8mb4 */ ;
-/*!50003 SET collation_connection  = utf8mb4_unicode_ci */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_dame_usuario`(pIdUsuarioBuscado int)
-SALIR: BEGIN
-      /*
-      Devuelve los datos de un usuario específico por su ID.
-      */
-
-      SELECT  'OK' Mensaje, IdUsuario, Usuario, FechaAlta, Estado, Rol
-      FROM    Usuarios
-      WHERE   IdUsuario = pIdUsuarioBuscado;
-  END ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_dame_password_usuario`(pUsuario varchar(30), pTokenSesion char(32))
+BEGIN
+	/*
+    Devuelve el hash de contraseña guardado de un usuario para que el MS lo verifique (argon2id o MD5 heredado).
+    Busca por nombre de usuario, o por el token de sesión de un usuario activo si pUsuario es NULL.
+    Si no existe devuelve IdUsuario 0.
+    IdUsuario int, Password varchar(255)
+    */
+    SELECT	COALESCE(MAX(IdUsuario), 0) IdUsuario, MAX(`Password`) `Password`
+    FROM	Usuarios
+    WHERE	(pUsuario IS NOT NULL AND Usuario = pUsuario)
+			OR (pUsuario IS NULL AND IdUsuario = f_valida_usuario(pTokenSesion));
+END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `tsp_desactivar_moneda` */;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_dame_rol` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
 /*!50003 SET character_set_client  = utf8mb4 */ ;
 /*!50003 SET character_set_results = utf8mb4 */ ;
-/*!50003 SET collation_connection  = utf8mb4_unicode_ci */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_desactivar_moneda`(
-    pCredencial VARCHAR(255),
-    pActor CHAR(10),
-    pIdMoneda INT
-)
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_dame_rol`(pRol char(1))
 SALIR: BEGIN
     /*
-    Desactiva una moneda activa.
-    Mensaje varchar(100)
+    Permite instanciar un rol desde la base de datos, con sus permisos separados por coma.
+    Devuelve OK o el mensaje de error en Mensaje.
     */
-    DECLARE pIdUsuario INT DEFAULT NULL;
-    DECLARE pEstado CHAR(1);
-
-    DECLARE EXIT HANDLER FOR SQLEXCEPTION
-    BEGIN
-        SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
-    END;
+    IF NOT EXISTS (SELECT 1 FROM Roles WHERE Rol = pRol) THEN
+        SELECT 'El rol no existe.' Mensaje, NULL Rol, NULL Nombre, NULL Permisos;
+        LEAVE SALIR;
+    END IF;
 
-    IF pActor = 'USUARIO' THEN
+    SELECT      'OK' Mensaje, r.Rol, r.Nombre, GROUP_CONCAT(rp.Permiso ORDER BY rp.Permiso) Permisos
+    FROM        Roles r
+    LEFT JOIN   RolesPermisos rp ON rp.Rol = r.Rol
+    WHERE       r.Rol = pRol
+    GROUP BY    r.Rol, r.Nombre;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_dame_segundo_factor` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_dame_segundo_factor`(pTokenSesion char(32), pTokenDesafio char(32))
+SALIR: BEGIN
+      /*
+      Devuelve el segundo factor (TOTP) del usuario del desafío de login pTokenDesafio o, si es NULL, del
+      usuario activo de la sesión, para que el MS verifique el código.
+      Estado: NULL sin segundo factor - P pendiente - A activo.
+      Mensaje varchar(100), IdUsuario int, Usuario varchar(30), Secreto varchar(64), Estado char(1), UltimoPaso bigint
+      */
+      DECLARE pIdUsuario INT;
+      DECLARE pTipoDesafio CHAR(1);
+
+      -- Resuelve el usuario: por el desafío de login vigente o por la sesión
+      IF pTokenDesafio IS NOT NULL AND pTokenDesafio != '' THEN
+          SELECT  d.IdUsuario, d.Tipo
+          INTO    pIdUsuario, pTipoDesafio
+          FROM    DesafiosLogin d
+          INNER JOIN Usuarios u ON u.IdUsuario = d.IdUsuario
+          WHERE   d.TokenHash = SHA2(pTokenDesafio, 256) AND d.FechaExpiracion > NOW() AND u.Estado = 'A';
+          IF pIdUsuario IS NULL THEN
+              SELECT 'El desafío expiró. Vuelva a iniciar sesión.' Mensaje, 0 IdUsuario, NULL Usuario, NULL Secreto, NULL Estado, 0 UltimoPaso;
+              LEAVE SALIR;
+          END IF;
+      ELSE
+          SET pIdUsuario = f_valida_usuario(pTokenSesion);
+          IF pIdUsuario = 0 THEN
+              SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje, 0 IdUsuario, NULL Usuario, NULL Secreto, NULL Estado, 0 UltimoPaso;
+              LEAVE SALIR;
+          END IF;
+      END IF;
+
+      SELECT  'OK' Mensaje, u.IdUsuario, u.Usuario, sf.Secreto, sf.Estado, COALESCE(sf.UltimoPaso, 0) UltimoPaso
+      FROM    Usuarios u
+      LEFT JOIN SegundoFactor sf ON sf.IdUsuario = u.IdUsuario
+      WHERE   u.IdUsuario = pIdUsuario;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_dame_usuario` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_unicode_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_dame_usuario`(pIdUsuarioBuscado int)
+SALIR: BEGIN
+      /*
+      Devuelve los datos de un usuario específico por su ID.
+      */
+
+      SELECT  'OK' Mensaje, u.IdUsuario, u.Usuario, u.FechaAlta, u.Estado, u.Rol,
+              IF(sf.Estado = 'A', 'S', 'N') SegundoFactor
+      FROM    Usuarios u
+      LEFT JOIN SegundoFactor sf ON sf.IdUsuario = u.IdUsuario
+      WHERE   u.IdUsuario = pIdUsuarioBuscado;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_dame_version_apikeys` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_dame_version_apikeys`()
+BEGIN
+    /*
+    Permite obtener la versión de las API keys (ver VersionApiKeys). Si cambió desde la última consulta,
+    el MS vacía su caché de API keys.
+    */
+    SELECT  Version
+    FROM    VersionApiKeys
+    WHERE   IdVersion = 1;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_desactivar_moneda` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_unicode_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_desactivar_moneda`(
+    pCredencial VARCHAR(255),
+    pActor CHAR(10),
+    pIdMoneda INT
+)
+SALIR: BEGIN
+    /*
+    Desactiva una moneda activa.
+    Mensaje varchar(100)
+    */
+    DECLARE pIdUsuario INT DEFAULT NULL;
+    DECLARE pEstado CHAR(1);
+
+    DECLARE EXIT HANDLER FOR SQLEXCEPTION
+    BEGIN
+        SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
+    END;
+
+    IF pActor = 'USUARIO' THEN
         SET pIdUsuario = f_valida_usuario(pCredencial);
         IF pIdUsuario = 0 THEN
             SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje;
@@ -937,7 +2352,7 @@ CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_desactivar_usuario`(pIdUsuario
   CHAR(10))
 SALIR: BEGIN
       /*
-      Permite cambiar el estado de un usuario a I: Inactivo siempre y cuando esté activo.
+      Permite cambiar el estado de un usuario a I: Inactivo siempre y cuando esté activo. Cierra sus sesiones.
       Devuelve OK o el mensaje de error en Mensaje.
       Mensaje varchar(100)
       */
@@ -956,8 +2371,8 @@ SALIR: BEGIN
               LEAVE SALIR;
           END IF;
       END IF;
-      -- Controla que el actor tenga rol Administrador
-      IF pActor = 'USUARIO' AND (SELECT Rol FROM Usuarios WHERE IdUsuario = pIdUsuarioActor) != 'A' THEN
+      -- Controla que el actor tenga el permiso usuarios:admin
+      IF pActor = 'USUARIO' AND f_tiene_permiso(pIdUsuarioActor, 'usuarios:admin') = 0 THEN
           SELECT 'No tienes permisos para realizar esta acción.' Mensaje;
           LEAVE SALIR;
       END IF;
@@ -976,11 +2391,11 @@ SALIR: BEGIN
           SELECT 'El usuario ya está inactivo.' Mensaje;
           LEAVE SALIR;
       END IF;
-      -- Desactiva
+      -- Desactiva y cierra las sesiones
       UPDATE  Usuarios
-      SET     Estado = 'I',
-              TokenSesion = md5(CONCAT(pIdUsuario, UNIX_TIMESTAMP()))
+      SET     Estado = 'I'
       WHERE   IdUsuario = pIdUsuario;
+      DELETE FROM Sesiones WHERE IdUsuario = pIdUsuario;
       -- Audita
       INSERT INTO Operaciones (IdUsuario, TipoOperacion, FechaOperacion, Detalles)
       VALUES (pIdUsuarioActor, 'DU', NOW(), JSON_OBJECT('IdUsuario', pIdUsuario));
@@ -991,6 +2406,162 @@ DELIMITER ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_inscribir_segundo_factor` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_inscribir_segundo_factor`(pTokenSesion char(32), pTokenDesafio char(32),
+    pSecreto varchar(64))
+SALIR: BEGIN
+      /*
+      Permite a un usuario inscribir su segundo factor (TOTP) con el secreto pSecreto generado por el MS: desde
+      su sesión (opcional) o desde un desafío de login de inscripción (su rol lo exige, ver tsp_login_usuario).
+      Queda Pendiente hasta verificar el primer código (tsp_activar_segundo_factor o tsp_completar_login_usuario).
+      Reemplaza una inscripción pendiente anterior.
+      Devuelve OK y el nombre de usuario (para la URI del secreto) o el mensaje de error en Mensaje.
+      Mensaje varchar(100), Usuario varchar(30)
+      */
+      DECLARE pIdUsuario INT;
+      DECLARE pTipoDesafio CHAR(1);
+
+      DECLARE EXIT HANDLER FOR SQLEXCEPTION
+      BEGIN
+          ROLLBACK;
+          SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje, NULL Usuario;
+      END;
+
+      -- Resuelve el usuario: por el desafío de login vigente o por la sesión
+      IF pTokenDesafio IS NOT NULL AND pTokenDesafio != '' THEN
+          SELECT  d.IdUsuario, d.Tipo
+          INTO    pIdUsuario, pTipoDesafio
+          FROM    DesafiosLogin d
+          INNER JOIN Usuarios u ON u.IdUsuario = d.IdUsuario
+          WHERE   d.TokenHash = SHA2(pTokenDesafio, 256) AND d.FechaExpiracion > NOW() AND u.Estado = 'A';
+          IF pIdUsuario IS NULL THEN
+              SELECT 'El desafío expiró. Vuelva a iniciar sesión.' Mensaje, NULL Usuario;
+              LEAVE SALIR;
+          END IF;
+      ELSE
+          SET pIdUsuario = f_valida_usuario(pTokenSesion);
+          IF pIdUsuario = 0 THEN
+              SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje, NULL Usuario;
+              LEAVE SALIR;
+          END IF;
+      END IF;
+      IF pTipoDesafio = 'V' OR EXISTS(SELECT IdUsuario FROM SegundoFactor WHERE IdUsuario = pIdUsuario AND Estado = 'A') THEN
+          SELECT 'El segundo factor ya está activo.' Mensaje, NULL Usuario;
+          LEAVE SALIR;
+      END IF;
+      IF pSecreto IS NULL OR pSecreto = '' THEN
+          SELECT 'El secreto es obligatorio.' Mensaje, NULL Usuario;
+          LEAVE SALIR;
+      END IF;
+
+      START TRANSACTION;
+          DELETE FROM CodigosRecuperacion WHERE IdUsuario = pIdUsuario;
+          INSERT INTO SegundoFactor (IdUsuario, Secreto, Estado, UltimoPaso, FechaAlta, FechaActivacion)
+          VALUES (pIdUsuario, pSecreto, 'P', 0, NOW(), NULL)
+          ON DUPLICATE KEY UPDATE Secreto = pSecreto, Estado = 'P', UltimoPaso = 0, FechaAlta = NOW(), FechaActivacion = NULL;
+      COMMIT;
+
+      SELECT 'OK' Mensaje, Usuario FROM Usuarios WHERE IdUsuario = pIdUsuario;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_liberar_intento_login` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_liberar_intento_login`(pUsuario varchar(30))
+BEGIN
+	/*
+    Devuelve un intento reservado con tsp_reservar_intento_login cuyas credenciales resultaron válidas (ej: la
+    contraseña de un login que sigue con el segundo factor, o un error que no es del usuario). Devuelve OK.
+    */
+    UPDATE  BloqueosLogin
+    SET     IntentosFallidos = GREATEST(IntentosFallidos - 1, 0)
+    WHERE   Usuario = pUsuario;
+
+    SELECT 'OK' Mensaje;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_listar_apikeys` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_listar_apikeys`()
+BEGIN
+	/*
+    Permite listar las API keys de los sistemas cliente, sin su hash, ordenadas por nombre.
+    */
+    SELECT      IdApiKey, Nombre, Sistema, Prefijo, Alcances, IPsPermitidas, FechaAlta, FechaExpiracion,
+                FechaUltimoUso, Estado
+    FROM        ApiKeys
+    ORDER BY    Nombre;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_listar_cadena_operaciones` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_listar_cadena_operaciones`(pDesdeIdOperacion int, pLimite int)
+BEGIN
+    /*
+    Permite recorrer la cadena de hashes de Operaciones: devuelve hasta pLimite operaciones posteriores a
+    pDesdeIdOperacion, por IdOperacion ascendente, con la fecha y los detalles como texto tal como los encadena
+    trg_operaciones_encadenar. Sin pLimite devuelve 1000.
+    */
+    IF pLimite IS NULL OR pLimite <= 0 THEN
+        SET pLimite = 1000;
+    END IF;
+
+    SELECT      IdOperacion, IdUsuario, TipoOperacion, DATE_FORMAT(FechaOperacion, '%Y-%m-%d %H:%i:%s') FechaOperacion,
+                CAST(Detalles AS CHAR) Detalles, Hash
+    FROM        Operaciones
+    WHERE       IdOperacion > IFNULL(pDesdeIdOperacion, 0)
+    ORDER BY    IdOperacion
+    LIMIT       pLimite;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
 /*!50003 DROP PROCEDURE IF EXISTS `tsp_listar_monedas` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
@@ -1027,6 +2598,58 @@ DELIMITER ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_listar_permisos` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_listar_permisos`()
+BEGIN
+    /*
+    Permite listar el catálogo de permisos que se pueden otorgar a los roles. Ordena por Permiso.
+    */
+    SELECT      Permiso, Descripcion
+    FROM        Permisos
+    ORDER BY    Permiso;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_listar_roles` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_listar_roles`()
+BEGIN
+    /*
+    Permite listar los roles con sus permisos separados por coma y la cantidad de usuarios que lo tienen.
+    Ordena por Rol.
+    */
+    SELECT      r.Rol, r.Nombre, GROUP_CONCAT(rp.Permiso ORDER BY rp.Permiso) Permisos,
+                (SELECT COUNT(*) FROM Usuarios u WHERE u.Rol = r.Rol) Usuarios
+    FROM        Roles r
+    LEFT JOIN   RolesPermisos rp ON rp.Rol = r.Rol
+    GROUP BY    r.Rol, r.Nombre
+    ORDER BY    r.Rol;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
 /*!50003 DROP PROCEDURE IF EXISTS `tsp_login_usuario` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
@@ -1037,55 +2660,96 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_login_usuario`(pUsuario varchar(30), pPassword char(32))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_login_usuario`(pUsuario varchar(30), pPassword varchar(255),
+    pTokenSesion char(32), pRefreshToken char(32), pDispositivo varchar(255), pIP varchar(45),
+    pMinutosToken int, pMinutosInactividad int, pHorasDuracion int, pMaxSesiones int,
+    pTokenDesafio char(32), pRolesSegundoFactor varchar(255))
 SALIR: BEGIN
       /*
       Permite a un usuario iniciar sesión en el sistema administrativo de MSTF.
-      Valida credenciales, regenera el token de sesión y devuelve los datos del usuario.
+      Valida credenciales, crea una sesión nueva (las demás sesiones del usuario siguen vigentes, ver
+      tsp_crear_sesion) y devuelve los datos del usuario y de la sesión.
       Si el usuario está Pendiente (Estado='P'), permite login pero debe cambiar contraseña.
-      pPassword debe venir ya hasheado con md5 desde el cliente.
-      Devuelve OK + datos del usuario o el mensaje de error en Mensaje.
+      pPassword es el hash guardado de la contraseña, ya verificado por el MS (tsp_dame_password_usuario):
+      si cambió en el medio, las credenciales son inválidas.
+      Si el usuario activo tiene segundo factor, o su rol está en pRolesSegundoFactor (separados por coma),
+      no crea la sesión: guarda el desafío pTokenDesafio (SHA-256), que vence en 5 minutos y se completa con
+      tsp_completar_login_usuario. Desafio indica su tipo (V: verificar código - I: inscribir el segundo factor)
+      y FechaExpiracion su vencimiento; sin desafío, Desafio es NULL.
+      Devuelve OK + datos del usuario y la sesión (o el desafío) o el mensaje de error en Mensaje.
       */
       DECLARE pIdUsuario INT;
       DECLARE pEstado CHAR(1);
-      DECLARE pTokenSesion CHAR(32);
+      DECLARE pRol CHAR(1);
+      DECLARE pIdSesion INT;
+      DECLARE pTipoDesafio CHAR(1);
 
       DECLARE EXIT HANDLER FOR SQLEXCEPTION
       BEGIN
           SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje,
-                 0 IdUsuario, NULL Usuario, NULL TokenSesion, NULL FechaAlta, NULL Estado, NULL Rol;
+                 0 IdUsuario, NULL Usuario, NULL FechaAlta, NULL Estado, NULL Rol,
+                 0 IdSesion, NULL FechaInicio, NULL FechaExpiracionToken, NULL FechaExpiracion, NULL Desafio;
       END;
 
       -- Busca al usuario
-      SELECT  IdUsuario, Estado
-      INTO    pIdUsuario, pEstado
+      SELECT  IdUsuario, Estado, Rol
+      INTO    pIdUsuario, pEstado, pRol
       FROM    Usuarios
       WHERE   Usuario = pUsuario AND `Password` = pPassword;
 
       -- Controla existencia
       IF pIdUsuario IS NULL THEN
           SELECT 'Credenciales inválidas.' Mensaje,
-                 0 IdUsuario, NULL Usuario, NULL TokenSesion, NULL FechaAlta, NULL Estado, NULL Rol;
+                 0 IdUsuario, NULL Usuario, NULL FechaAlta, NULL Estado, NULL Rol,
+                 0 IdSesion, NULL FechaInicio, NULL FechaExpiracionToken, NULL FechaExpiracion, NULL Desafio;
           LEAVE SALIR;
       END IF;
 
       -- Controla estado Inactivo
       IF pEstado = 'I' THEN
           SELECT 'El usuario está inactivo.' Mensaje,
-                 0 IdUsuario, NULL Usuario, NULL TokenSesion, NULL FechaAlta, NULL Estado, NULL Rol;
+                 0 IdUsuario, NULL Usuario, NULL FechaAlta, NULL Estado, NULL Rol,
+                 0 IdSesion, NULL FechaInicio, NULL FechaExpiracionToken, NULL FechaExpiracion, NULL Desafio;
           LEAVE SALIR;
       END IF;
 
-      -- Regenera token de sesión
-      SET pTokenSesion = md5(CONCAT(pIdUsuario, UNIX_TIMESTAMP(), RAND()));
-      UPDATE  Usuarios
-      SET     TokenSesion = pTokenSesion
-      WHERE   IdUsuario = pIdUsuario;
+      -- Segundo factor: el pendiente solo puede confirmar su cuenta, así que se exige a partir de la activación
+      IF pEstado = 'A' THEN
+          IF EXISTS(SELECT IdUsuario FROM SegundoFactor WHERE IdUsuario = pIdUsuario AND Estado = 'A') THEN
+              SET pTipoDesafio = 'V';
+          ELSEIF FIND_IN_SET(pRol, REPLACE(COALESCE(pRolesSegundoFactor, ''), ' ', '')) > 0 THEN
+              SET pTipoDesafio = 'I';
+          END IF;
+      END IF;
 
-      -- Devuelve datos del usuario (Estado='P' indica que debe cambiar contraseña)
-      SELECT  'OK' Mensaje, IdUsuario, Usuario, pTokenSesion TokenSesion, FechaAlta, Estado, Rol
-      FROM    Usuarios
-      WHERE   IdUsuario = pIdUsuario;
+      IF pTipoDesafio IS NOT NULL THEN
+          IF pTokenDesafio IS NULL OR pTokenDesafio = '' THEN
+              SELECT 'El token del desafío es obligatorio.' Mensaje,
+                 0 IdUsuario, NULL Usuario, NULL FechaAlta, NULL Estado, NULL Rol,
+                 0 IdSesion, NULL FechaInicio, NULL FechaExpiracionToken, NULL FechaExpiracion, NULL Desafio;
+              LEAVE SALIR;
+          END IF;
+          DELETE FROM DesafiosLogin WHERE IdUsuario = pIdUsuario AND FechaExpiracion <= NOW();
+          INSERT INTO DesafiosLogin (IdUsuario, TokenHash, Tipo, FechaExpiracion, Intentos)
+          VALUES (pIdUsuario, SHA2(pTokenDesafio, 256), pTipoDesafio, NOW() + INTERVAL 5 MINUTE, 0);
+
+          SELECT  'OK' Mensaje, IdUsuario, Usuario, FechaAlta, Estado, Rol,
+                  0 IdSesion, NULL FechaInicio, NULL FechaExpiracionToken, NOW() + INTERVAL 5 MINUTE FechaExpiracion,
+                  pTipoDesafio Desafio
+          FROM    Usuarios
+          WHERE   IdUsuario = pIdUsuario;
+          LEAVE SALIR;
+      END IF;
+
+      CALL tsp_crear_sesion(pIdUsuario, pTokenSesion, pRefreshToken, pDispositivo, pIP, pMinutosToken,
+          pMinutosInactividad, pHorasDuracion, pMaxSesiones, pIdSesion);
+
+      -- Devuelve datos del usuario y la sesión (Estado='P' indica que debe cambiar contraseña)
+      SELECT  'OK' Mensaje, u.IdUsuario, u.Usuario, u.FechaAlta, u.Estado, u.Rol,
+              s.IdSesion, s.FechaInicio, s.FechaExpiracionToken, s.FechaExpiracion, NULL Desafio
+      FROM    Usuarios u
+      INNER JOIN Sesiones s ON s.IdUsuario = u.IdUsuario
+      WHERE   s.IdSesion = pIdSesion;
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
@@ -1106,32 +2770,30 @@ CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_logout_usuario`(pTokenSesion ch
 SALIR: BEGIN
 	/*
     Permite a un usuario cerrar su sesión activa en el sistema administrativo de MSTF.
-    Invalida el token actual generando uno nuevo desconocido para el cliente.
+    Borra la sesión del token; las demás sesiones del usuario (otros dispositivos) siguen vigentes.
     Devuelve OK o el mensaje de error.
     Mensaje varchar(100)
     */
-    DECLARE pIdUsuario INT;
+    DECLARE pIdSesion INT;
 
     DECLARE EXIT HANDLER FOR SQLEXCEPTION
     BEGIN
         SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
     END;
 
-    -- Busca el usuario activo por token
-    SELECT  IdUsuario
-    INTO    pIdUsuario
-    FROM    Usuarios
-    WHERE   TokenSesion = pTokenSesion AND Estado = 'A';
+    -- Busca la sesión vigente del usuario activo por token
+    SELECT  s.IdSesion
+    INTO    pIdSesion
+    FROM    Sesiones s
+    INNER JOIN Usuarios u ON u.IdUsuario = s.IdUsuario
+    WHERE   s.IdSesion = f_valida_sesion(pTokenSesion) AND u.Estado = 'A';
 
-    IF pIdUsuario IS NULL THEN
+    IF pIdSesion IS NULL THEN
         SELECT 'La sesión no existe o ya fue cerrada.' Mensaje;
         LEAVE SALIR;
     END IF;
 
-    -- Invalida el token rotándolo a un valor nuevo desconocido para el cliente
-    UPDATE  Usuarios
-    SET     TokenSesion = md5(CONCAT(pIdUsuario, UNIX_TIMESTAMP(), RAND()))
-    WHERE   IdUsuario = pIdUsuario;
+    DELETE FROM Sesiones WHERE IdSesion = pIdSesion;
 
     SELECT 'OK' Mensaje;
 END ;;
@@ -1140,30 +2802,76 @@ DELIMITER ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `tsp_modificar_parametro` */;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_migrar_password_usuario` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
 /*!50003 SET character_set_client  = utf8mb4 */ ;
 /*!50003 SET character_set_results = utf8mb4 */ ;
-/*!50003 SET collation_connection  = utf8mb4_unicode_ci */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_modificar_parametro`(pCredencial VARCHAR(255), pActor CHAR(10), pParametro varchar(50), pValor text)
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_migrar_password_usuario`(pIdUsuario int, pPasswordAnterior varchar(255),
+                                                   pPasswordNuevo varchar(255))
 SALIR: BEGIN
 	/*
-    Permite modificar el valor de un parámetro siempre y cuando exista y sea modificable.
+    Reemplaza el hash de la contraseña de un usuario por uno argon2id al iniciar sesión con un hash heredado
+    (MD5) o con parámetros desactualizados. Solo lo reemplaza si sigue siendo pPasswordAnterior, el que
+    verificó el MS, para no pisar un cambio de contraseña concurrente.
     Devuelve OK o el mensaje de error en Mensaje.
     Mensaje varchar(100)
     */
-    DECLARE pIdUsuario INT DEFAULT NULL;
-    DECLARE pEsModificable, pEstado char(1);
-    DECLARE pValorAnterior TEXT;
-	-- Manejo de error en la transacción
-    DECLARE EXIT HANDLER FOR SQLEXCEPTION
-    BEGIN
-		SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
+	DECLARE EXIT HANDLER FOR SQLEXCEPTION
+	BEGIN
+		SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
+	END;
+    IF NOT EXISTS(SELECT IdUsuario FROM Usuarios WHERE IdUsuario = pIdUsuario) THEN
+        SELECT 'El usuario no existe.' Mensaje;
+        LEAVE SALIR;
+	END IF;
+    IF (pPasswordNuevo IS NULL OR pPasswordNuevo = '') THEN
+        SELECT 'La nueva contraseña es obligatoria.' Mensaje;
+        LEAVE SALIR;
+	END IF;
+    UPDATE	Usuarios
+    SET		`Password` = pPasswordNuevo
+    WHERE	IdUsuario = pIdUsuario AND `Password` = pPasswordAnterior;
+    IF ROW_COUNT() = 0 THEN
+        SELECT 'La contraseña fue modificada.' Mensaje;
+        LEAVE SALIR;
+	END IF;
+    SELECT 'OK' Mensaje;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_modificar_parametro` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_unicode_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_modificar_parametro`(pCredencial VARCHAR(255), pActor CHAR(10), pParametro varchar(50), pValor text)
+SALIR: BEGIN
+	/*
+    Permite modificar el valor de un parámetro siempre y cuando exista y sea modificable.
+    Devuelve OK o el mensaje de error en Mensaje.
+    Mensaje varchar(100)
+    */
+    DECLARE pIdUsuario INT DEFAULT NULL;
+    DECLARE pEsModificable, pEstado char(1);
+    DECLARE pValorAnterior TEXT;
+	-- Manejo de error en la transacción
+    DECLARE EXIT HANDLER FOR SQLEXCEPTION
+    BEGIN
+		SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
 	END;
     IF pActor = 'USUARIO' THEN
         SET pIdUsuario = f_valida_usuario(pCredencial);
@@ -1220,12 +2928,14 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_modificar_password_usuario`(pTokenSesion char(32), pPasswordAnterior char(32), 
-                                                   pPasswordNuevo varchar(50), pConfirmarPassword varchar(50))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_modificar_password_usuario`(pTokenSesion char(32), pPasswordAnterior varchar(255),
+                                                   pPasswordNuevo varchar(255))
 SALIR: BEGIN
 	/*
-    Permite al usuario modificar su contraseña. Debe ingresar la contraseña anterior (hasheada con md5),
-    la nueva y su confirmación.
+    Permite al usuario modificar su contraseña. pPasswordAnterior es el hash guardado, ya verificado
+    por el MS (tsp_dame_password_usuario); pPasswordNuevo es el hash argon2id de la nueva contraseña.
+    La política de contraseñas y la confirmación se validan en el MS.
+    Cierra todas las sesiones del usuario, incluida la actual.
     Devuelve OK o el mensaje de error en Mensaje.
     Mensaje varchar(100)
     */
@@ -1246,20 +2956,12 @@ SALIR: BEGIN
         SELECT 'La nueva contraseña es obligatoria.' Mensaje;
         LEAVE SALIR;
 	END IF;
-    IF (pConfirmarPassword IS NULL OR pConfirmarPassword = '') THEN
-        SELECT 'La confirmación de contraseña es obligatoria.' Mensaje;
-        LEAVE SALIR;
-	END IF;
-    IF (pPasswordNuevo != pConfirmarPassword) THEN
-        SELECT 'La nueva contraseña no coincide con su confirmación.' Mensaje;
-        LEAVE SALIR;
-	END IF;
     
-    -- Modifica la contraseña
+    -- Modifica la contraseña y cierra las sesiones
     UPDATE	Usuarios
-    SET		`Password` = pPasswordNuevo,
-    TokenSesion = md5(CONCAT(pIdUsuario, UNIX_TIMESTAMP()))
+    SET		`Password` = pPasswordNuevo
     WHERE	IdUsuario = pIdUsuario;
+    DELETE FROM Sesiones WHERE IdUsuario = pIdUsuario;
     
     SELECT 'OK' Mensaje;
 END ;;
@@ -1268,6 +2970,403 @@ DELIMITER ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_modificar_rol` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_modificar_rol`(pRol char(1), pNombre varchar(50), pPermisos json,
+  pCredencial VARCHAR(255), pActor CHAR(10))
+SALIR: BEGIN
+      /*
+      Permite modificar el nombre de un rol y reemplazar sus permisos por pPermisos (array JSON de permisos
+      del catálogo). El rol A (Administrador) no se puede modificar: tiene siempre todos los permisos.
+      Requiere el permiso roles:write.
+      Devuelve OK o el mensaje de error en Mensaje.
+      Mensaje varchar(100)
+      */
+      DECLARE pIdUsuarioActor INT DEFAULT NULL;
+      DECLARE pPermisoInvalido varchar(50);
+
+      DECLARE EXIT HANDLER FOR SQLEXCEPTION
+      BEGIN
+          ROLLBACK;
+          SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
+      END;
+
+      -- Resuelve identidad del actor
+      IF pActor = 'USUARIO' THEN
+          SET pIdUsuarioActor = f_valida_usuario(pCredencial);
+          IF pIdUsuarioActor = 0 THEN
+              SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje;
+              LEAVE SALIR;
+          END IF;
+          -- Controla que el actor tenga el permiso roles:write
+          IF f_tiene_permiso(pIdUsuarioActor, 'roles:write') = 0 THEN
+              SELECT 'No tienes permisos para realizar esta acción.' Mensaje;
+              LEAVE SALIR;
+          END IF;
+      END IF;
+      -- Controla parámetros
+      IF NOT EXISTS (SELECT 1 FROM Roles WHERE Rol = pRol) THEN
+          SELECT 'El rol no existe.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      IF pRol = 'A' THEN
+          SELECT 'El rol Administrador no se puede modificar.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      IF pNombre IS NULL OR TRIM(pNombre) = '' THEN
+          SELECT 'El nombre del rol es obligatorio.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      IF EXISTS (SELECT 1 FROM Roles WHERE Nombre = pNombre AND Rol != pRol) THEN
+          SELECT 'Ya existe un rol con ese nombre.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      IF pPermisos IS NULL OR JSON_TYPE(pPermisos) <> 'ARRAY' THEN
+          SELECT 'Los permisos deben ser un array JSON.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      SET pPermisoInvalido = (
+          SELECT  COALESCE(p.Permiso, 'null')
+          FROM    JSON_TABLE(pPermisos, '$[*]' COLUMNS (Permiso varchar(50) PATH '$')) p
+          WHERE   p.Permiso IS NULL
+               OR NOT EXISTS (SELECT 1 FROM Permisos WHERE Permiso = p.Permiso COLLATE utf8mb4_0900_ai_ci)
+          LIMIT   1);
+      IF pPermisoInvalido IS NOT NULL THEN
+          SELECT CONCAT('El permiso ', pPermisoInvalido, ' no existe.') Mensaje;
+          LEAVE SALIR;
+      END IF;
+
+      START TRANSACTION;
+          UPDATE  Roles
+          SET     Nombre = pNombre
+          WHERE   Rol = pRol;
+          DELETE FROM RolesPermisos WHERE Rol = pRol;
+          INSERT INTO RolesPermisos (Rol, Permiso)
+          SELECT  DISTINCT pRol, p.Permiso
+          FROM    JSON_TABLE(pPermisos, '$[*]' COLUMNS (Permiso varchar(50) PATH '$')) p;
+          -- Los permisos de las API keys salen del rol S
+          IF pRol = 'S' THEN
+              UPDATE  VersionApiKeys
+              SET     Version = Version + 1
+              WHERE   IdVersion = 1;
+          END IF;
+          -- Audita
+          INSERT INTO Operaciones (IdUsuario, TipoOperacion, FechaOperacion, Detalles)
+          VALUES (pIdUsuarioActor, 'MR', NOW(), JSON_OBJECT('Rol', pRol, 'Nombre', pNombre, 'Permisos', pPermisos));
+      COMMIT;
+      SELECT 'OK' Mensaje;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_registrar_estados_transferencias` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_registrar_estados_transferencias`(pEstados json)
+SALIR: BEGIN
+    /*
+    Registra el resultado notificado de un lote de transferencias. Lo invoca únicamente el MS, sin actor.
+    pEstados: array JSON de TransferenciaNotificada.
+    Una transferencia finalizada (F) conserva su primer registro: los reintentos no cambian su IdCorrelacion.
+    Devuelve OK o el mensaje de error en Mensaje.
+    Mensaje varchar(100)
+    */
+    DECLARE EXIT HANDLER FOR SQLEXCEPTION
+    BEGIN
+        SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
+    END;
+
+    IF (pEstados IS NULL OR JSON_TYPE(pEstados) <> 'ARRAY') THEN
+        SELECT 'Los estados deben ser un array JSON.' Mensaje;
+        LEAVE SALIR;
+    END IF;
+
+    INSERT INTO EstadosTransferencias (IdTransferencia, IdCorrelacion, Estado, Mensaje, Tipo, IdMoneda, IdUsuarioFinal, FechaAlta, FechaModificacion)
+    SELECT  e.IdTransferencia, COALESCE(e.IdCorrelacion, ''), e.Estado, LEFT(COALESCE(e.Mensaje, ''), 255), COALESCE(e.Tipo, ''),
+            COALESCE(e.IdMoneda, 0), COALESCE(e.IdUsuarioFinal, 0), NOW(), NOW()
+    FROM    JSON_TABLE(pEstados, '$[*]' COLUMNS (
+                IdTransferencia varchar(50) PATH '$.IdTransferencia',
+                IdCorrelacion varchar(64) PATH '$.IdCorrelacion',
+                Estado char(1) PATH '$.Estado',
+                Mensaje varchar(500) PATH '$.Mensaje',
+                Tipo char(1) PATH '$.Tipo',
+                IdMoneda int unsigned PATH '$.IdMoneda',
+                IdUsuarioFinal bigint unsigned PATH '$.IdUsuarioFinal')) e
+    WHERE   e.IdTransferencia IS NOT NULL AND e.IdTransferencia <> '' AND e.Estado IS NOT NULL
+    ON DUPLICATE KEY UPDATE
+        IdCorrelacion = IF(EstadosTransferencias.Estado = 'F', EstadosTransferencias.IdCorrelacion, VALUES(IdCorrelacion)),
+        Mensaje = IF(EstadosTransferencias.Estado = 'F', EstadosTransferencias.Mensaje, VALUES(Mensaje)),
+        Estado = IF(EstadosTransferencias.Estado = 'F', EstadosTransferencias.Estado, VALUES(Estado)),
+        FechaModificacion = NOW();
+
+    SELECT 'OK' Mensaje;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_registrar_login_fallido` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_registrar_login_fallido`(pUsuario varchar(30),
+    pIntentosMax int, pSegundosBloqueo int, pMinutosBloqueoMax int)
+SALIR: BEGIN
+	/*
+    Confirma como fallido un intento de login del usuario pUsuario reservado con tsp_reservar_intento_login
+    (contraseña o código del segundo factor inválidos).
+    Al llegar a pIntentosMax intentos seguidos bloquea el login pSegundosBloqueo segundos, el doble en cada
+    bloqueo siguiente, hasta pMinutosBloqueoMax minutos. Los intentos reservados que siguen en curso cuentan
+    como fallidos.
+    Devuelve OK + los segundos del bloqueo aplicado (0 si no se bloqueó), o el mensaje de error en Mensaje.
+    */
+    DECLARE pIntentos INT;
+    DECLARE pBloqueos INT;
+    DECLARE pSegundos INT DEFAULT 0;
+
+    DECLARE EXIT HANDLER FOR SQLEXCEPTION
+    BEGIN
+        ROLLBACK;
+        SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje, 0 SegundosBloqueo;
+    END;
+
+    IF pUsuario IS NULL OR pUsuario = '' THEN
+        SELECT 'El usuario es obligatorio.' Mensaje, 0 SegundosBloqueo;
+        LEAVE SALIR;
+    END IF;
+
+    START TRANSACTION;
+        -- Sin fila (un login exitoso en paralelo borró los intentos) no hay nada que confirmar
+        SELECT  IntentosFallidos, Bloqueos
+        INTO    pIntentos, pBloqueos
+        FROM    BloqueosLogin
+        WHERE   Usuario = pUsuario
+        FOR UPDATE;
+
+        -- Bloqueo progresivo: pSegundosBloqueo * 2^Bloqueos, hasta pMinutosBloqueoMax
+        IF pIntentos >= pIntentosMax THEN
+            SET pSegundos = LEAST(pSegundosBloqueo * POW(2, LEAST(pBloqueos, 20)), pMinutosBloqueoMax * 60);
+            UPDATE  BloqueosLogin
+            SET     IntentosFallidos = 0,
+                    Bloqueos = Bloqueos + 1,
+                    BloqueadoHasta = NOW() + INTERVAL pSegundos SECOND
+            WHERE   Usuario = pUsuario;
+        END IF;
+    COMMIT;
+
+    SELECT 'OK' Mensaje, pSegundos SegundosBloqueo;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_registrar_operacion` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_registrar_operacion`(pCredencial VARCHAR(255), pActor CHAR(10), pTipoOperacion char(2),
+  pDetalles json)
+SALIR: BEGIN
+    /*
+    Registra en auditoría una operación que el MS realiza fuera de los SPs administrativos.
+    El actor se resuelve igual que en el resto de los SPs: IdUsuario NULL cuando es el sistema.
+    Devuelve OK o el mensaje de error en Mensaje.
+    Mensaje varchar(100)
+    */
+    DECLARE pIdUsuario INT DEFAULT NULL;
+
+    DECLARE EXIT HANDLER FOR SQLEXCEPTION
+    BEGIN
+        SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
+    END;
+
+    IF pActor = 'USUARIO' THEN
+        SET pIdUsuario = f_valida_usuario(pCredencial);
+        IF pIdUsuario = 0 THEN
+            SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje;
+            LEAVE SALIR;
+        END IF;
+    END IF;
+
+    IF (pTipoOperacion IS NULL OR pTipoOperacion = '') THEN
+        SELECT 'El tipo de operación es obligatorio.' Mensaje;
+        LEAVE SALIR;
+    END IF;
+
+    INSERT INTO Operaciones (IdUsuario, TipoOperacion, FechaOperacion, Detalles)
+    VALUES (pIdUsuario, pTipoOperacion, NOW(), COALESCE(pDetalles, JSON_OBJECT()));
+
+    SELECT 'OK' Mensaje;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_renovar_sesion` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_renovar_sesion`(pRefreshToken char(32), pTokenSesion char(32),
+    pRefreshTokenNuevo char(32), pMinutosToken int)
+SALIR: BEGIN
+	/*
+    Renueva el token de una sesión con su refresh token, aunque el token haya vencido, siempre que la
+    sesión no haya vencido por inactividad ni por su vencimiento absoluto (que no se extiende).
+    Rota ambos tokens: pTokenSesion y pRefreshTokenNuevo los genera el MS; se guarda solo su SHA-256.
+    Devuelve OK + datos de la sesión o el mensaje de error en Mensaje.
+    */
+    DECLARE pIdSesion INT;
+
+	DECLARE EXIT HANDLER FOR SQLEXCEPTION
+	BEGIN
+		SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje,
+			   0 IdSesion, 0 IdUsuario, NULL FechaInicio, NULL FechaExpiracionToken, NULL FechaExpiracion;
+	END;
+
+    SELECT	s.IdSesion
+    INTO	pIdSesion
+    FROM	Sesiones s
+    INNER JOIN Usuarios u ON u.IdUsuario = s.IdUsuario
+    WHERE	s.RefreshHash = SHA2(pRefreshToken, 256)
+			AND s.FechaUltimoUso > NOW() - INTERVAL s.MinutosInactividad MINUTE
+			AND s.FechaExpiracion > NOW()
+			AND u.Estado IN ('A', 'P');
+
+    IF pIdSesion IS NULL THEN
+        SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje,
+			   0 IdSesion, 0 IdUsuario, NULL FechaInicio, NULL FechaExpiracionToken, NULL FechaExpiracion;
+        LEAVE SALIR;
+	END IF;
+
+    UPDATE	Sesiones
+    SET		TokenHash = SHA2(pTokenSesion, 256),
+			RefreshHash = SHA2(pRefreshTokenNuevo, 256),
+			FechaUltimoUso = NOW(),
+			FechaExpiracionToken = LEAST(NOW() + INTERVAL pMinutosToken MINUTE, FechaExpiracion)
+    WHERE	IdSesion = pIdSesion;
+
+    SELECT	'OK' Mensaje, IdSesion, IdUsuario, FechaInicio, FechaExpiracionToken, FechaExpiracion
+    FROM	Sesiones
+    WHERE	IdSesion = pIdSesion;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_reservar_intento_login` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_reservar_intento_login`(pUsuario varchar(30), pIP varchar(45),
+    pIntentosMax int, pSegundosBloqueo int, pHorasVentana int)
+SALIR: BEGIN
+	/*
+    Reserva un intento de login del usuario pUsuario antes de que el MS verifique la contraseña o el código del
+    segundo factor: lo cuenta de antemano como fallido, con la fila bloqueada, para que los intentos en paralelo
+    no superen pIntentosMax. El MS lo confirma como fallido (tsp_registrar_login_fallido) o, si las credenciales
+    son válidas, lo devuelve (tsp_liberar_intento_login); un login exitoso borra los intentos (tsp_crear_sesion).
+    Se reserva aunque el usuario no exista, para no revelar cuáles existen.
+    Pasadas pHorasVentana horas sin intentos fallidos se olvidan los intentos y bloqueos anteriores.
+    Devuelve OK + 0 si se reservó el intento, u OK + los segundos a esperar si el login está bloqueado o los
+    intentos en curso ya llegan a pIntentosMax (pSegundosBloqueo). Si hay error, el mensaje en Mensaje.
+    */
+    DECLARE pIntentos INT;
+    DECLARE pSegundos INT;
+
+    DECLARE EXIT HANDLER FOR SQLEXCEPTION
+    BEGIN
+        ROLLBACK;
+        SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje, 0 SegundosBloqueo;
+    END;
+
+    IF pUsuario IS NULL OR pUsuario = '' THEN
+        SELECT 'El usuario es obligatorio.' Mensaje, 0 SegundosBloqueo;
+        LEAVE SALIR;
+    END IF;
+
+    START TRANSACTION;
+        -- Olvida los intentos y bloqueos viejos
+        UPDATE  BloqueosLogin
+        SET     IntentosFallidos = 0,
+                Bloqueos = 0
+        WHERE   Usuario = pUsuario AND FechaUltimoFallo <= NOW() - INTERVAL pHorasVentana HOUR;
+
+        INSERT INTO BloqueosLogin (Usuario, IntentosFallidos, Bloqueos, FechaUltimoFallo, UltimaIP)
+        VALUES (pUsuario, 0, 0, NOW(), pIP)
+        ON DUPLICATE KEY UPDATE Usuario = Usuario;
+
+        SELECT  IntentosFallidos, GREATEST(COALESCE(TIMESTAMPDIFF(SECOND, NOW(), BloqueadoHasta), 0), 0)
+        INTO    pIntentos, pSegundos
+        FROM    BloqueosLogin
+        WHERE   Usuario = pUsuario
+        FOR UPDATE;
+
+        -- Los intentos en curso completan el máximo: se rechaza como si ya estuviera bloqueado
+        IF pSegundos = 0 AND pIntentos >= pIntentosMax THEN
+            SET pSegundos = pSegundosBloqueo;
+        END IF;
+
+        IF pSegundos = 0 THEN
+            UPDATE  BloqueosLogin
+            SET     IntentosFallidos = IntentosFallidos + 1,
+                    FechaUltimoFallo = NOW(),
+                    UltimaIP = pIP
+            WHERE   Usuario = pUsuario;
+        END IF;
+    COMMIT;
+
+    SELECT 'OK' Mensaje, pSegundos SegundosBloqueo;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
 /*!50003 DROP PROCEDURE IF EXISTS `tsp_restablecer_password_usuario` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
@@ -1278,74 +3377,392 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_restablecer_password_usuario`(pIdUsuario int, pCredencial
-  VARCHAR(255), pActor CHAR(10))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_restablecer_password_usuario`(pIdUsuario int, pPassword
+  varchar(255), pCredencial VARCHAR(255), pActor CHAR(10))
 SALIR: BEGIN
       /*
-      Permite restablecer la contraseña de un usuario. Solo puede hacerlo un Administrador.
-      Genera una contraseña temporal, deja al usuario en estado Pendiente y regenera su token.
-      Devuelve OK + PasswordTemporal o el mensaje de error.
-      Mensaje varchar(100), PasswordTemporal varchar(10)
+      Permite restablecer la contraseña de un usuario. Requiere el permiso usuarios:admin.
+      Guarda la contraseña temporal (pPassword: hash argon2id generado por el MS), deja al usuario
+      en estado Pendiente y cierra todas sus sesiones.
+      Devuelve OK o el mensaje de error en Mensaje.
+      Mensaje varchar(100)
       */
       DECLARE pEstado CHAR(1);
-      DECLARE pTokenNuevo CHAR(32);
-      DECLARE pPasswordTemporal VARCHAR(10);
       DECLARE pIdUsuarioActor INT DEFAULT NULL;
 
       DECLARE EXIT HANDLER FOR SQLEXCEPTION
       BEGIN
-          SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje, NULL PasswordTemporal;
+          SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
       END;
 
       -- Resuelve identidad del actor
       IF pActor = 'USUARIO' THEN
           SET pIdUsuarioActor = f_valida_usuario(pCredencial);
           IF pIdUsuarioActor = 0 THEN
-              SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje, NULL PasswordTemporal;
+              SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje;
               LEAVE SALIR;
           END IF;
-          -- Controla que el actor tenga rol Administrador
-          IF (SELECT Rol FROM Usuarios WHERE IdUsuario = pIdUsuarioActor) != 'A' THEN
-              SELECT 'No tienes permisos para realizar esta acción.' Mensaje, NULL PasswordTemporal;
+          -- Controla que el actor tenga el permiso usuarios:admin
+          IF f_tiene_permiso(pIdUsuarioActor, 'usuarios:admin') = 0 THEN
+              SELECT 'No tienes permisos para realizar esta acción.' Mensaje;
               LEAVE SALIR;
           END IF;
       END IF;
       -- Controla parámetros del usuario objetivo
       SET pEstado = (SELECT Estado FROM Usuarios WHERE IdUsuario = pIdUsuario);
       IF pEstado IS NULL THEN
-          SELECT 'El usuario no existe.' Mensaje, NULL PasswordTemporal;
+          SELECT 'El usuario no existe.' Mensaje;
           LEAVE SALIR;
       END IF;
       IF pEstado = 'P' THEN
-          SELECT 'El usuario ya está en estado pendiente.' Mensaje, NULL PasswordTemporal;
+          SELECT 'El usuario ya está en estado pendiente.' Mensaje;
           LEAVE SALIR;
       END IF;
       IF pEstado = 'I' THEN
-          SELECT 'El usuario está inactivo.' Mensaje, NULL PasswordTemporal;
+          SELECT 'El usuario está inactivo.' Mensaje;
           LEAVE SALIR;
       END IF;
 
-      -- Genera contraseña temporal (6 chars alfanuméricos)
-      SET pPasswordTemporal = CONCAT(
-          SUBSTRING('ABCDEFGHJKLMNPQRSTUVWXYZ', FLOOR(1 + RAND() * 24), 1),
-          SUBSTRING('abcdefghjkmnpqrstuvwxyz', FLOOR(1 + RAND() * 23), 1),
-          SUBSTRING('0123456789', FLOOR(1 + RAND() * 10), 1),
-          SUBSTRING('0123456789', FLOOR(1 + RAND() * 10), 1),
-          SUBSTRING('ABCDEFGHJKLMNPQRSTUVWXYZ', FLOOR(1 + RAND() * 24), 1),
-          SUBSTRING('abcdefghjkmnpqrstuvwxyz', FLOOR(1 + RAND() * 23), 1)
-      );
-
-      -- Genera nuevo token
-      SET pTokenNuevo = md5(CONCAT(pIdUsuario, UNIX_TIMESTAMP(), RAND()));
+      IF (pPassword IS NULL OR pPassword = '') THEN
+          SELECT 'La contraseña es obligatoria.' Mensaje;
+          LEAVE SALIR;
+      END IF;
 
-      -- Resetea Password, Token y Estado
+      -- Resetea Password y Estado, y cierra las sesiones
       UPDATE  Usuarios
-      SET     `Password` = md5(pPasswordTemporal),
-              TokenSesion = pTokenNuevo,
+      SET     `Password` = pPassword,
               Estado = 'P'
       WHERE   IdUsuario = pIdUsuario;
+      DELETE FROM Sesiones WHERE IdUsuario = pIdUsuario;
+
+      SELECT 'OK' Mensaje;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_restablecer_segundo_factor_usuario` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_restablecer_segundo_factor_usuario`(pIdUsuario int,
+  pCredencial VARCHAR(255), pActor CHAR(10))
+SALIR: BEGIN
+      /*
+      Permite a un usuario con el permiso usuarios:admin borrar el segundo factor de otro usuario (por ejemplo, si
+      perdió el dispositivo y sus códigos de recuperación). Cierra sus sesiones y sus desafíos de login: si su rol
+      exige segundo factor, se inscribe de nuevo en el próximo login.
+      Devuelve OK o el mensaje de error en Mensaje.
+      Mensaje varchar(100)
+      */
+      DECLARE pIdUsuarioActor INT DEFAULT NULL;
+      DECLARE pSesiones INT;
+
+      DECLARE EXIT HANDLER FOR SQLEXCEPTION
+      BEGIN
+          ROLLBACK;
+          SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
+      END;
+
+      -- Resuelve identidad del actor
+      IF pActor = 'USUARIO' THEN
+          SET pIdUsuarioActor = f_valida_usuario(pCredencial);
+          IF pIdUsuarioActor = 0 THEN
+              SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje;
+              LEAVE SALIR;
+          END IF;
+          -- Controla que el actor tenga el permiso usuarios:admin
+          IF f_tiene_permiso(pIdUsuarioActor, 'usuarios:admin') = 0 THEN
+              SELECT 'No tienes permisos para realizar esta acción.' Mensaje;
+              LEAVE SALIR;
+          END IF;
+          IF pIdUsuarioActor = pIdUsuario THEN
+              SELECT 'No puedes realizar esta acción sobre tu propia cuenta.' Mensaje;
+              LEAVE SALIR;
+          END IF;
+      END IF;
+      IF NOT EXISTS(SELECT IdUsuario FROM Usuarios WHERE IdUsuario = pIdUsuario) THEN
+          SELECT 'El usuario no existe.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      IF NOT EXISTS(SELECT IdUsuario FROM SegundoFactor WHERE IdUsuario = pIdUsuario) THEN
+          SELECT 'El usuario no tiene segundo factor.' Mensaje;
+          LEAVE SALIR;
+      END IF;
 
-      SELECT 'OK' Mensaje, pPasswordTemporal PasswordTemporal;
+      START TRANSACTION;
+          -- Los códigos de recuperación se borran en cascada
+          DELETE FROM SegundoFactor WHERE IdUsuario = pIdUsuario;
+          DELETE FROM DesafiosLogin WHERE IdUsuario = pIdUsuario;
+          DELETE FROM Sesiones WHERE IdUsuario = pIdUsuario;
+          SET pSesiones = ROW_COUNT();
+          -- Audita
+          INSERT INTO Operaciones (IdUsuario, TipoOperacion, FechaOperacion, Detalles)
+          VALUES (pIdUsuarioActor, 'RF', NOW(), JSON_OBJECT('IdUsuario', pIdUsuario, 'Sesiones', pSesiones));
+      COMMIT;
+      SELECT 'OK' Mensaje;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_revocar_apikey` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_revocar_apikey`(pIdApiKey int, pCredencial VARCHAR(255), pActor CHAR(10))
+SALIR: BEGIN
+      /*
+      Permite revocar una API key (A -> R). Se conserva para la auditoría. Requiere el permiso apikeys:write.
+      Devuelve OK o el mensaje de error en Mensaje.
+      Mensaje varchar(100)
+      */
+      DECLARE pIdUsuarioActor INT DEFAULT NULL;
+      DECLARE pNombre varchar(60);
+      DECLARE pEstado char(1);
+
+      DECLARE EXIT HANDLER FOR SQLEXCEPTION
+      BEGIN
+          ROLLBACK;
+          SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
+      END;
+
+      -- Resuelve identidad del actor
+      IF pActor = 'USUARIO' THEN
+          SET pIdUsuarioActor = f_valida_usuario(pCredencial);
+          IF pIdUsuarioActor = 0 THEN
+              SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje;
+              LEAVE SALIR;
+          END IF;
+          -- Controla que el actor tenga el permiso apikeys:write
+          IF f_tiene_permiso(pIdUsuarioActor, 'apikeys:write') = 0 THEN
+              SELECT 'No tienes permisos para realizar esta acción.' Mensaje;
+              LEAVE SALIR;
+          END IF;
+      END IF;
+      -- Controla la API key
+      SELECT  Nombre, Estado
+      INTO    pNombre, pEstado
+      FROM    ApiKeys
+      WHERE   IdApiKey = pIdApiKey;
+      IF pEstado IS NULL THEN
+          SELECT 'La API key no existe.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      IF pEstado != 'A' THEN
+          SELECT 'La API key ya está revocada.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+
+      START TRANSACTION;
+          UPDATE  ApiKeys
+          SET     Estado = 'R'
+          WHERE   IdApiKey = pIdApiKey;
+          UPDATE  VersionApiKeys
+          SET     Version = Version + 1
+          WHERE   IdVersion = 1;
+          -- Audita
+          INSERT INTO Operaciones (IdUsuario, TipoOperacion, FechaOperacion, Detalles)
+          VALUES (pIdUsuarioActor, 'VK', NOW(), JSON_OBJECT('IdApiKey', pIdApiKey, 'Nombre', pNombre));
+      COMMIT;
+      SELECT 'OK' Mensaje;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_revocar_sesion` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_revocar_sesion`(pTokenSesion char(32), pIdSesion int)
+SALIR: BEGIN
+	/*
+    Permite al usuario cerrar una de sus sesiones (por ejemplo, la de otro dispositivo).
+    Si es la sesión actual equivale al logout.
+    Devuelve OK o el mensaje de error en Mensaje.
+    Mensaje varchar(100)
+    */
+    DECLARE pIdUsuario INT;
+
+	DECLARE EXIT HANDLER FOR SQLEXCEPTION
+	BEGIN
+		SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
+	END;
+
+    SET pIdUsuario = f_valida_usuario(pTokenSesion);
+    IF pIdUsuario = 0 THEN
+        SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje;
+        LEAVE SALIR;
+	END IF;
+
+    DELETE FROM Sesiones WHERE IdSesion = pIdSesion AND IdUsuario = pIdUsuario;
+    IF ROW_COUNT() = 0 THEN
+        SELECT 'La sesión no existe.' Mensaje;
+        LEAVE SALIR;
+	END IF;
+
+    SELECT 'OK' Mensaje;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_revocar_sesiones_usuario` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_revocar_sesiones_usuario`(pIdUsuario int, pCredencial VARCHAR(255),
+  pActor CHAR(10))
+SALIR: BEGIN
+      /*
+      Permite a un usuario con el permiso usuarios:admin cerrar todas las sesiones de un usuario (por ejemplo, ante un dispositivo
+      perdido). El usuario conserva su estado y contraseña.
+      Devuelve OK o el mensaje de error en Mensaje.
+      Mensaje varchar(100)
+      */
+      DECLARE pIdUsuarioActor INT DEFAULT NULL;
+      DECLARE pSesiones INT;
+
+      DECLARE EXIT HANDLER FOR SQLEXCEPTION
+      BEGIN
+          SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
+      END;
+
+      -- Resuelve identidad del actor
+      IF pActor = 'USUARIO' THEN
+          SET pIdUsuarioActor = f_valida_usuario(pCredencial);
+          IF pIdUsuarioActor = 0 THEN
+              SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje;
+              LEAVE SALIR;
+          END IF;
+          -- Controla que el actor tenga el permiso usuarios:admin
+          IF f_tiene_permiso(pIdUsuarioActor, 'usuarios:admin') = 0 THEN
+              SELECT 'No tienes permisos para realizar esta acción.' Mensaje;
+              LEAVE SALIR;
+          END IF;
+      END IF;
+      IF NOT EXISTS(SELECT IdUsuario FROM Usuarios WHERE IdUsuario = pIdUsuario) THEN
+          SELECT 'El usuario no existe.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+
+      DELETE FROM Sesiones WHERE IdUsuario = pIdUsuario;
+      SET pSesiones = ROW_COUNT();
+      -- Audita
+      INSERT INTO Operaciones (IdUsuario, TipoOperacion, FechaOperacion, Detalles)
+      VALUES (pIdUsuarioActor, 'RS', NOW(), JSON_OBJECT('IdUsuario', pIdUsuario, 'Sesiones', pSesiones));
+      SELECT 'OK' Mensaje;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `tsp_rotar_apikey` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8mb4 */ ;
+/*!50003 SET character_set_results = utf8mb4 */ ;
+/*!50003 SET collation_connection  = utf8mb4_0900_ai_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `tsp_rotar_apikey`(pIdApiKey int, pHash char(64), pPrefijo varchar(12),
+  pCredencial VARCHAR(255), pActor CHAR(10))
+SALIR: BEGIN
+      /*
+      Permite reemplazar una API key activa y vigente por una nueva (pHash: SHA-256 de la API key generada
+      por el MS), conservando su nombre, alcances, IPs permitidas y vencimiento. La anterior deja de valer.
+      Requiere el permiso apikeys:write.
+      Devuelve OK o el mensaje de error en Mensaje.
+      Mensaje varchar(100)
+      */
+      DECLARE pIdUsuarioActor INT DEFAULT NULL;
+      DECLARE pNombre varchar(60);
+      DECLARE pEstado char(1);
+      DECLARE pFechaExpiracion datetime;
+
+      DECLARE EXIT HANDLER FOR SQLEXCEPTION
+      BEGIN
+          ROLLBACK;
+          SELECT 'Error en la transacción. Contáctese con el administrador.' Mensaje;
+      END;
+
+      -- Resuelve identidad del actor
+      IF pActor = 'USUARIO' THEN
+          SET pIdUsuarioActor = f_valida_usuario(pCredencial);
+          IF pIdUsuarioActor = 0 THEN
+              SELECT 'La sesión expiró. Vuelva a iniciar sesión.' Mensaje;
+              LEAVE SALIR;
+          END IF;
+          -- Controla que el actor tenga el permiso apikeys:write
+          IF f_tiene_permiso(pIdUsuarioActor, 'apikeys:write') = 0 THEN
+              SELECT 'No tienes permisos para realizar esta acción.' Mensaje;
+              LEAVE SALIR;
+          END IF;
+      END IF;
+      -- Controla la API key
+      SELECT  Nombre, Estado, FechaExpiracion
+      INTO    pNombre, pEstado, pFechaExpiracion
+      FROM    ApiKeys
+      WHERE   IdApiKey = pIdApiKey;
+      IF pEstado IS NULL THEN
+          SELECT 'La API key no existe.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      IF pEstado != 'A' THEN
+          SELECT 'La API key está revocada.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+      IF pFechaExpiracion IS NOT NULL AND pFechaExpiracion <= NOW() THEN
+          SELECT 'La API key expiró.' Mensaje;
+          LEAVE SALIR;
+      END IF;
+
+      START TRANSACTION;
+          UPDATE  ApiKeys
+          SET     Hash = pHash,
+                  Prefijo = pPrefijo,
+                  FechaRotacion = NOW()
+          WHERE   IdApiKey = pIdApiKey;
+          UPDATE  VersionApiKeys
+          SET     Version = Version + 1
+          WHERE   IdVersion = 1;
+          -- Audita
+          INSERT INTO Operaciones (IdUsuario, TipoOperacion, FechaOperacion, Detalles)
+          VALUES (pIdUsuarioActor, 'RK', NOW(), JSON_OBJECT('IdApiKey', pIdApiKey, 'Nombre', pNombre));
+      COMMIT;
+      SELECT 'OK' Mensaje;
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
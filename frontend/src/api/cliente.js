@@ -15,11 +15,47 @@ cliente.interceptors.request.use((config) => {
   return config
 })
 
-// si 401 cierra sesión y redirige, salvo que la request tenga _noRedirect: true
+// Renovación en curso, compartida por las requests que reciben 401 a la vez (el refresh token se rota)
+let renovacion = null
+
+function renovarToken() {
+  const { refreshToken, renovarSesion } = useAuth()
+  if (!refreshToken.value) return Promise.reject(new Error('sin refresh token'))
+  if (!renovacion) {
+    renovacion = axios
+      .post('/api/usuarios/sesiones/renovar', { RefreshToken: refreshToken.value })
+      .then((res) => renovarSesion(res.data))
+      .finally(() => { renovacion = null })
+  }
+  return renovacion
+}
+
+// Espera máxima (segundos) de un 429 para reintentar solo; con esperas mayores se muestra el error.
+// El login no se reintenta: su 429 es un bloqueo por intentos fallidos
+const ESPERA_MAXIMA_429 = 5
+
+// si 401 renueva el token una vez y reintenta; si no se puede, cierra sesión y redirige,
+// salvo que la request tenga _noRedirect: true
 cliente.interceptors.response.use(
   (response) => response,
-  (error) => {
-    if (error.response?.status === 401 && !error.config._noRedirect) {
+  async (error) => {
+    const config = error.config
+    if (error.response?.status === 429 && config && !config._reintento429 && !config.url?.startsWith('/usuarios/login')) {
+      const espera = Number(error.response.headers?.['retry-after'])
+      if (espera > 0 && espera <= ESPERA_MAXIMA_429) {
+        await new Promise((resolve) => setTimeout(resolve, espera * 1000))
+        return cliente({ ...config, _reintento429: true })
+      }
+    }
+    if (error.response?.status === 401 && config && !config._reintento) {
+      try {
+        await renovarToken()
+        return cliente({ ...config, _reintento: true })
+      } catch {
+        // la sesión venció: se sigue con el 401 original
+      }
+    }
+    if (error.response?.status === 401 && !config?._noRedirect) {
       const { cerrarSesion } = useAuth()
       cerrarSesion()
       window.location.href = '/login'
@@ -52,3 +52,21 @@ export async function confirmarCuenta(password, confirmarPassword) {
   })
   return res.data
 }
+
+// POST /usuarios/segundo-factor
+export async function inscribirSegundoFactor() {
+  const res = await cliente.post('/usuarios/segundo-factor')
+  return res.data
+}
+
+// PUT /usuarios/segundo-factor/activar
+export async function activarSegundoFactor(codigo) {
+  const res = await cliente.put('/usuarios/segundo-factor/activar', { Codigo: codigo })
+  return res.data
+}
+
+// DELETE /usuarios/:id/segundo-factor
+export async function restablecerSegundoFactor(id) {
+  const res = await cliente.delete(`/usuarios/${id}/segundo-factor`)
+  return res.data
+}
@@ -28,31 +28,31 @@ const router = createRouter({
           path: 'usuarios',
           name: 'usuarios',
           component: () => import('../views/UsuariosView.vue'),
-          meta: { titulo: 'Usuarios' }
+          meta: { titulo: 'Usuarios', permiso: 'usuarios:read' }
         },
         {
           path: 'monedas',
           name: 'monedas',
           component: () => import('../views/MonedasView.vue'),
-          meta: { titulo: 'Monedas' }
+          meta: { titulo: 'Monedas', permiso: 'monedas:read' }
         },
         {
           path: 'parametros',
           name: 'parametros',
           component: () => import('../views/ParametrosView.vue'),
-          meta: { titulo: 'Parámetros' }
+          meta: { titulo: 'Parámetros', permiso: 'parametros:read' }
         },
         {
           path: 'cuentas',
           name: 'cuentas',
           component: () => import('../views/CuentasView.vue'),
-          meta: { titulo: 'Cuentas' }
+          meta: { titulo: 'Cuentas', permiso: 'cuentas:read' }
         },
         {
           path: 'transferencias',
           name: 'transferencias',
           component: () => import('../views/TransferenciasView.vue'),
-          meta: { titulo: 'Transferencias' }
+          meta: { titulo: 'Transferencias', permiso: 'transferencias:read' }
         }
       ]
     },
@@ -61,15 +61,25 @@ const router = createRouter({
   ]
 })
 
+// Primera vista que el usuario puede ver según sus permisos
+function vistaInicial(tienePermiso) {
+  const vista = router.getRoutes().find(r => r.meta.permiso && tienePermiso(r.meta.permiso))
+  return vista ? { name: vista.name } : null
+}
+
 router.beforeEach((to) => {
-  const { verificarExpiracion } = useAuth()
+  const { verificarExpiracion, tienePermiso } = useAuth()
   const autenticado = verificarExpiracion()
 
   if (!to.meta.publica && !autenticado) {
     return { name: 'login' }
   }
   if (to.name === 'login' && autenticado) {
-    return { name: 'usuarios' }
+    return vistaInicial(tienePermiso) ?? true
+  }
+  if (to.meta.permiso && !tienePermiso(to.meta.permiso)) {
+    const inicial = vistaInicial(tienePermiso)
+    if (inicial && inicial.name !== to.name) return inicial
   }
 })
 
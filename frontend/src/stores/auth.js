@@ -1,7 +1,6 @@
 import { ref, computed } from 'vue'
 
 const SESSION_KEY = 'mstf_session'
-const SESSION_DURATION = 15 * 60 * 1000 // 15 minutos en ms
 
 function cargarSesion() {
   try {
@@ -25,13 +24,33 @@ export function useAuth() {
   const estaAutenticado = computed(() => sesion.value !== null)
   const token = computed(() => sesion.value?.token ?? null)
   const nombreUsuario = computed(() => sesion.value?.nombreUsuario ?? null)
+  const refreshToken = computed(() => sesion.value?.refreshToken ?? null)
+  const permisos = computed(() => sesion.value?.permisos ?? [])
 
-  function iniciarSesion(tokenRecibido, nombreUsuarioRecibido) {
-    const data = {
-      token: tokenRecibido,
+  // respuesta: la del login (TokenSesion, RefreshToken, FechaExpiracion, Permisos)
+  // expira es el vencimiento absoluto de la sesión; el token se renueva con el refresh token (api/cliente.js)
+  function iniciarSesion(respuesta, nombreUsuarioRecibido) {
+    guardar({
+      token: respuesta.TokenSesion,
+      refreshToken: respuesta.RefreshToken,
       nombreUsuario: nombreUsuarioRecibido,
-      expira: Date.now() + SESSION_DURATION
-    }
+      permisos: respuesta.Permisos ?? [],
+      expira: Date.parse(respuesta.FechaExpiracion)
+    })
+  }
+
+  // respuesta: la de /usuarios/sesiones/renovar
+  function renovarSesion(respuesta) {
+    if (!sesion.value) return
+    guardar({ ...sesion.value, token: respuesta.TokenSesion, refreshToken: respuesta.RefreshToken })
+  }
+
+  // Solo para mostrar u ocultar opciones: el backend valida cada permiso
+  function tienePermiso(permiso) {
+    return permisos.value.includes(permiso)
+  }
+
+  function guardar(data) {
     sesion.value = data
     sessionStorage.setItem(SESSION_KEY, JSON.stringify(data))
   }
@@ -49,5 +68,5 @@ export function useAuth() {
     return sesion.value !== null
   }
 
-  return { estaAutenticado, token, nombreUsuario, iniciarSesion, cerrarSesion, verificarExpiracion }
+  return { estaAutenticado, token, refreshToken, nombreUsuario, permisos, tienePermiso, iniciarSesion, renovarSesion, cerrarSesion, verificarExpiracion }
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/infra/logs"
+	"MSTransaccionesFinancieras/internal/ingesta"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"MSTransaccionesFinancieras/internal/salud"
+)
+
+// Lo que se cierra al apagar el MS (ver apagar)
+type apagado struct {
+	parametros repositorios.Parametros
+	// Server HTTP (echo)
+	servidor interface {
+		Shutdown(ctx context.Context) error
+	}
+	// Motor de ingesta con sus fuentes
+	motor interface{ Close(ctx context.Context) }
+	// Anclador de la cadena de auditoría, nil si no se ancla
+	anclador interface{ Close(ctx context.Context) }
+	// Cierre de los clientes de datos (Kafka, TB, MySQL), en orden
+	clientes []func()
+	// Listener interno de métricas, nil si está deshabilitado
+	servidorMetricas interface {
+		Shutdown(ctx context.Context) error
+	}
+	// Exporta las últimas trazas
+	cerrarTrazas func(ctx context.Context) error
+}
+
+// Drenado ordenado al recibir SIGINT o SIGTERM. Ningún cliente de datos se cierra mientras quede algo que lo use.
+func (a apagado) apagar() {
+	// 1. /health/ready pasa a APAGANDO y se espera a que los balanceadores dejen de enviar requests
+	salud.MarcarApagando()
+	time.Sleep(salud.ObtenerEsperaApagado(a.parametros))
+
+	// 2. dejar de aceptar requests y esperar las que están en curso (los lotes síncronos usan el motor)
+	ctxHTTP, cancelHTTP := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelHTTP()
+	if err := a.servidor.Shutdown(ctxHTTP); err != nil {
+		logs.L(logs.App).Warn("shutdown forzado", logs.Err(err))
+	}
+
+	// 3. las fuentes de ingesta terminan, notifican y confirman sus lotes en curso (con plazo)
+	ctxDrenado, cancelDrenado := context.WithTimeout(context.Background(), ingesta.ObtenerTimeoutDrenado(a.parametros))
+	defer cancelDrenado()
+	a.motor.Close(ctxDrenado)
+	// y se ancla la cabeza de la cadena de auditoría con las últimas operaciones
+	if a.anclador != nil {
+		ctxAnclaje, cancelAnclaje := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelAnclaje()
+		a.anclador.Close(ctxAnclaje)
+	}
+
+	// 4. recién ahora se cierran los clientes de datos
+	for _, cerrar := range a.clientes {
+		cerrar()
+	}
+
+	// 5. las métricas se siguen exponiendo durante el drenado
+	if a.servidorMetricas != nil {
+		ctxMetricas, cancelMetricas := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelMetricas()
+		if err := a.servidorMetricas.Shutdown(ctxMetricas); err != nil {
+			logs.L(logs.App).Warn("shutdown forzado del listener de métricas", logs.Err(err))
+		}
+	}
+
+	ctxTrazas, cancelTrazas := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelTrazas()
+	if err := a.cerrarTrazas(ctxTrazas); err != nil {
+		logs.L(logs.App).Warn("no se pudieron exportar las últimas trazas", logs.Err(err))
+	}
+}
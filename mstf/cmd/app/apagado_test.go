@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/ingesta"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios/memoria"
+	"MSTransaccionesFinancieras/internal/salud"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Pasos del apagado en el orden en que ocurrieron
+type registro struct {
+	mu    sync.Mutex
+	pasos []string
+}
+
+func (r *registro) agregar(paso string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pasos = append(r.pasos, paso)
+}
+
+func (r *registro) contiene(paso string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Contains(r.pasos, paso)
+}
+
+// Fuente con un lote en curso que termina y se confirma recién después de que Close deja de aceptar lotes
+type fuentePrueba struct {
+	registro *registro
+	detener  chan struct{}
+	enCurso  sync.WaitGroup
+}
+
+func (f *fuentePrueba) Nombre() string {
+	return "prueba"
+}
+
+func (f *fuentePrueba) Start(*ingesta.Motor) {
+	f.enCurso.Go(func() {
+		<-f.detener
+		time.Sleep(20 * time.Millisecond)
+		f.registro.agregar("lote confirmado")
+	})
+}
+
+func (f *fuentePrueba) Close(ctx context.Context) {
+	f.registro.agregar("fuente deja de aceptar")
+	close(f.detener)
+	ingesta.EsperarDrenado(ctx, &f.enCurso)
+	f.registro.agregar("fuente cerrada")
+}
+
+type cierrePrueba struct {
+	registro *registro
+	paso     string
+}
+
+func (c cierrePrueba) Close(context.Context) {
+	c.registro.agregar(c.paso)
+}
+
+func (c cierrePrueba) Shutdown(context.Context) error {
+	c.registro.agregar(c.paso)
+	return nil
+}
+
+// Las requests y los lotes en curso terminan y se confirman antes de cerrar los clientes de datos
+func TestApagadoOrdenado(t *testing.T) {
+	bd := memoria.New()
+	bd.GuardarParametro(models.Parametros{Parametro: "APAGADOESPERASEG", Valor: "0"})
+	r := &registro{}
+
+	e := echo.New()
+	e.HideBanner, e.HidePort = true, true
+	e.GET("/lento", func(c echo.Context) error {
+		r.agregar("request en curso")
+		time.Sleep(50 * time.Millisecond)
+		r.agregar("request terminada")
+		return c.NoContent(http.StatusOK)
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Listener = ln
+	go e.Start("")
+
+	motor := ingesta.NewMotor(nil, nil, nil, bd.Repositorios().Parametros, nil)
+	motor.Registrar(&fuentePrueba{registro: r, detener: make(chan struct{})})
+	motor.Start()
+
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/lento")
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	for limite := time.Now().Add(5 * time.Second); !r.contiene("request en curso"); {
+		if time.Now().After(limite) {
+			t.Fatal("la request no llegó al servidor")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cerrar := func(paso string) func() { return func() { r.agregar(paso) } }
+	apagado{
+		parametros:       bd.Repositorios().Parametros,
+		servidor:         e,
+		motor:            motor,
+		anclador:         cierrePrueba{registro: r, paso: "cabeza anclada"},
+		clientes:         []func(){cerrar("kafka cerrado"), cerrar("tb cerrado"), cerrar("mysql cerrado")},
+		servidorMetricas: cierrePrueba{registro: r, paso: "métricas cerradas"},
+		cerrarTrazas: func(context.Context) error {
+			r.agregar("trazas exportadas")
+			return nil
+		},
+	}.apagar()
+
+	if s := <-status; s != http.StatusOK {
+		t.Fatalf("request en curso durante el apagado: status %d", s)
+	}
+	esperados := []string{
+		"request en curso", "request terminada",
+		"fuente deja de aceptar", "lote confirmado", "fuente cerrada", "cabeza anclada",
+		"kafka cerrado", "tb cerrado", "mysql cerrado", "métricas cerradas", "trazas exportadas",
+	}
+	if !slices.Equal(r.pasos, esperados) {
+		t.Fatalf("orden del apagado:\n%v\nse esperaba\n%v", r.pasos, esperados)
+	}
+	if reporte := salud.Verificar(t.Context(), bd.Repositorios().Parametros); reporte.Estado != salud.EstadoApagando {
+		t.Fatalf("/health/ready durante el apagado: %s", reporte.Estado)
+	}
+	if _, err := http.Get("http://" + ln.Addr().String() + "/lento"); err == nil {
+		t.Fatal("el servidor siguió aceptando requests después del apagado")
+	}
+}
@@ -2,106 +2,231 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"MSTransaccionesFinancieras/internal/auditoria"
 	"MSTransaccionesFinancieras/internal/auth"
 	"MSTransaccionesFinancieras/internal/config"
 	"MSTransaccionesFinancieras/internal/gestores"
 	httpRouter "MSTransaccionesFinancieras/internal/http"
+	"MSTransaccionesFinancieras/internal/infra/fallas"
 	"MSTransaccionesFinancieras/internal/infra/kafkamstf"
+	"MSTransaccionesFinancieras/internal/infra/logs"
+	"MSTransaccionesFinancieras/internal/infra/metricas"
 	"MSTransaccionesFinancieras/internal/infra/persistence"
+	"MSTransaccionesFinancieras/internal/infra/trazas"
 	"MSTransaccionesFinancieras/internal/infra/webhook"
+	"MSTransaccionesFinancieras/internal/ingesta"
 	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"MSTransaccionesFinancieras/internal/repositorios/sps"
+	"MSTransaccionesFinancieras/internal/salud"
 	"MSTransaccionesFinancieras/internal/utils"
 
+	tigerbeetle "github.com/tigerbeetle/tigerbeetle-go"
 	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
 )
 
 func main() {
 	cfg := config.Load()
 
-	// Client de TigerBeetle
+	// Logs estructurados (JSON) con nivel por subsistema, modificable en runtime (/admin/logs)
+	if err := logs.Init(cfg.NivelLog); err != nil {
+		logs.Fatal("no se pudo configurar el nivel de log", logs.Err(err))
+	}
+
+	// Trazas OpenTelemetry (sin exportador por defecto)
+	cerrarTrazas, err := trazas.Init(cfg)
+	if err != nil {
+		logs.Fatal("no se pudo inicializar el exportador de trazas", logs.Err(err))
+	}
+
+	// Inyección de fallas (solo pruebas): debe habilitarse antes de crear los clientes que decora
+	if err := fallas.Init(cfg); err != nil {
+		logs.Fatal("no se pudo configurar la inyección de fallas", logs.Err(err))
+	}
+
+	// Client de TigerBeetle: se inyecta en los gestores, el motor de ingesta y el router
 	if err := persistence.InitTBClient(cfg); err != nil {
-		log.Fatalf("FATAL: No se pudo conectar a TigerBeetle: %v", err)
+		logs.Fatal("no se pudo conectar a TigerBeetle", logs.Err(err))
 	}
+	tb := persistence.ClienteTB
 
 	// Conexión a db MySQL
 	if err := persistence.InitMySQLClient(cfg); err != nil {
-		log.Fatalf("FATAL: No se pudo conectar a MySQL: %v", err)
-	}
-
-	// Inicializar cuentas empresa para cada moneda activa y activar monedas pendientes
-	err := inicializarCuentasEmpresa()
-	if err != nil {
-		log.Fatalf("FATAL: No se pudo inicializar cuentas empresa: %v", err)
+		logs.Fatal("no se pudo conectar a MySQL", logs.Err(err))
 	}
 
 	// Notificador Webhook
 	webhook.Init(cfg)
 
+	// Clave con la que se firman los anclajes de la cadena de auditoría
+	if err := auditoria.Init(cfg); err != nil {
+		logs.Fatal("no se pudo leer la clave de auditoría", logs.Err(err))
+	}
+
+	// Repositorios sobre los SPs de MySQL
+	monedas := sps.NewMonedas(persistence.ClienteMySQL)
+	parametros := sps.NewParametros(persistence.ClienteMySQL)
+	autenticacion := sps.NewAutenticacion(persistence.ClienteMySQL)
+	repos := repositorios.Repositorios{
+		Parametros:    parametros,
+		Monedas:       monedas,
+		Usuarios:      sps.NewUsuarios(persistence.ClienteMySQL),
+		Sesiones:      sps.NewSesiones(persistence.ClienteMySQL),
+		SegundoFactor: sps.NewSegundoFactor(persistence.ClienteMySQL),
+		Roles:         sps.NewRoles(persistence.ClienteMySQL),
+		ApiKeys:       sps.NewApiKeys(persistence.ClienteMySQL, autenticacion),
+		Autenticacion: autenticacion,
+		Auditoria:     sps.NewAuditoria(persistence.ClienteMySQL),
+		Cuarentena:    sps.NewCuarentena(persistence.ClienteMySQL),
+		Estados:       sps.NewEstadosTransferencias(persistence.ClienteMySQL),
+	}
+
+	// Métricas de los cachés en memoria (hit ratio)
+	metricas.RegistrarCache("monedas", monedas.Cache())
+	metricas.RegistrarCache("parametros", parametros.Cache())
+
 	// Gestor de Transferencias
-	gestorTransferencias := gestores.NewGestorTransferencias()
+	gestorTransferencias := gestores.NewGestorTransferencias(tb, repos.Parametros, repos.Monedas, repos.Auditoria, gestores.NewGestorEstadosTransferencias(repos.Estados))
 
-	// Consumidor Kafka
-	consumidor := kafkamstf.NewConsumidor(cfg, gestorTransferencias)
-	consumidor.Start()
+	// Motor de ingesta y sus fuentes: Kafka, lotes HTTP síncronos y (opcional) carpeta NDJSON
+	motor := ingesta.NewMotor(tb, gestorTransferencias, gestores.NewGestorCuarentena(repos.Cuarentena), repos.Parametros, repos.Monedas)
+	consumidor := kafkamstf.NewConsumidor(cfg, repos.Parametros)
+	motor.Registrar(consumidor)
+	fuenteHTTP := ingesta.NewFuenteHTTP()
+	motor.Registrar(fuenteHTTP)
+	if cfg.CarpetaIngesta != "" {
+		motor.Registrar(ingesta.NewFuenteCarpeta(cfg.CarpetaIngesta))
+	}
 
 	// Productor Kafka (unicamente p endpoint de test)
 	productor, err := kafkamstf.InitProductor(cfg)
 	if err != nil {
-		log.Fatalf("FATAL: No se pudo conectar a Kafka (Productor): %v", err)
+		logs.Fatal("no se pudo conectar a Kafka (productor)", logs.Err(err))
 	}
 
+	// Health checks de las dependencias (GET /health/ready). El productor solo se usa en el endpoint de test.
+	salud.Registrar("tigerbeetle", true, func(ctx context.Context) error { return persistence.VerificarTB(ctx, tb) })
+	salud.Registrar("mysql", true, persistence.VerificarMySQL)
+	salud.Registrar("kafka_consumidor", true, consumidor.VerificarConexion)
+	salud.Registrar("kafka_productor", false, productor.VerificarConexion)
+	salud.Registrar("progreso_consumidor", true, func(context.Context) error { return consumidor.VerificarProgreso() })
+	salud.Registrar("webhook", true, webhook.Cliente.VerificarConexion)
+
 	// Inicializar router HTTP
-	e := httpRouter.InitRouter(productor)
+	e := httpRouter.InitRouter(repos, tb, productor, consumidor, fuenteHTTP, cfg.ProxiesConfiables)
 
 	// Arranque del server
 	go func() {
 		addr := fmt.Sprintf(":%d", cfg.Puerto)
-		log.Printf("HTTP escuchando en  %s", addr)
+		logs.L(logs.App).Info("HTTP escuchando", "direccion", addr)
 		if err := e.Start(addr); err != nil {
-			log.Printf("Servidor parado: %v", err)
+			logs.L(logs.App).Info("servidor parado", logs.Err(err))
 		}
 	}()
 
+	// Métricas en un listener interno, separado de la API (el puerto no se publica fuera de la red interna)
+	var servidorMetricas *http.Server
+	if cfg.PuertoMetricas != 0 {
+		servidorMetricas = &http.Server{
+			Addr:              fmt.Sprintf(":%d", cfg.PuertoMetricas),
+			Handler:           httpRouter.HandlerMetricas(),
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		go func() {
+			logs.L(logs.App).Info("métricas escuchando", "direccion", servidorMetricas.Addr)
+			if err := servidorMetricas.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				logs.L(logs.App).Error("listener de métricas parado", logs.Err(err))
+			}
+		}()
+	}
+
+	// Inicializar cuentas empresa para cada moneda activa y activar monedas pendientes.
+	// El HTTP ya responde /health/live; /health/ready falla hasta que termine y arranque el motor.
+	err = inicializarCuentasEmpresa(repos, tb)
+	if err != nil {
+		logs.Fatal("no se pudieron inicializar las cuentas empresa", logs.Err(err))
+	}
+	motor.Start()
+	anclador, publicadorAnclajes := iniciarAnclajes(cfg, repos)
+	salud.MarcarInicializado()
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
 
-	log.Println("Apagando servidor...")
+	logs.L(logs.App).Info("apagando servidor")
 
-	// apagar consumer y producer kafka y cerrar conexiones a TB y MySQL
-	consumidor.Close()
-	productor.Close()
-	persistence.CloseTBClient()
-	persistence.CloseMySQLClient()
+	a := apagado{parametros: repos.Parametros, servidor: e, motor: motor, cerrarTrazas: cerrarTrazas}
+	// un *Anclador nil no es una interfaz nil
+	if anclador != nil {
+		a.anclador = anclador
+	}
+	if servidorMetricas != nil {
+		a.servidorMetricas = servidorMetricas
+	}
+	a.clientes = append(a.clientes, productor.Close)
+	if publicadorAnclajes != nil {
+		a.clientes = append(a.clientes, publicadorAnclajes.Close)
+	}
+	a.clientes = append(a.clientes, persistence.CloseTBClient, persistence.CloseMySQLClient)
+	a.apagar()
+	logs.L(logs.App).Info("el servidor dejó de funcionar")
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	if err := e.Shutdown(ctx); err != nil {
-		log.Printf("Shutdown forzado: %v", err)
+// Arranca el anclaje periódico de la cadena de auditoría en el archivo y/o el topic de Kafka configurados.
+// Sin clave o sin destinos no se ancla: la cadena sigue detectando modificaciones, pero no una reescritura completa.
+func iniciarAnclajes(cfg config.Config, repos repositorios.Repositorios) (*auditoria.Anclador, *kafkamstf.PublicadorAnclajes) {
+	l := logs.L(logs.App)
+	if auditoria.Clave() == nil {
+		l.Warn("AUDITORIA_CLAVE no configurada, no se anclan los hashes de la cadena de auditoría")
+		return nil, nil
 	}
-	log.Println("El servidor dejó de funcionar.")
+	var destinos []auditoria.Destino
+	if cfg.ArchivoAnclajesAuditoria != "" {
+		destinos = append(destinos, auditoria.NewArchivo(cfg.ArchivoAnclajesAuditoria))
+	}
+	var publicador *kafkamstf.PublicadorAnclajes
+	if cfg.TopicKafkaAuditoria != "" {
+		publicador = kafkamstf.NewPublicadorAnclajes(cfg)
+		destinos = append(destinos, publicador)
+	}
+	if len(destinos) == 0 {
+		l.Warn("sin AUDITORIA_ANCLAJES_ARCHIVO ni KAFKA_TOPIC_AUDITORIA, no se anclan los hashes de la cadena de auditoría")
+		return nil, nil
+	}
+	l.Info("anclaje de la cadena de auditoría habilitado", "ClavePublica", base64.StdEncoding.EncodeToString(auditoria.ClavePublica()))
+	anclador := auditoria.NewAnclador(repos.Auditoria, repos.Parametros, auditoria.Clave(), destinos...)
+	anclador.Start()
+	return anclador, publicador
 }
 
 // Inicializa las cuentas empresa en TigerBeetle para cada moneda activa,
 // y recupera monedas que quedaron en estado P por caída del ms.
-func inicializarCuentasEmpresa() error {
-	log.Println("Inicializando cuentas empresa...")
+func inicializarCuentasEmpresa(repos repositorios.Repositorios, tb tigerbeetle.Client) error {
+	l := logs.L(logs.Cuentas)
+	l.Info("inicializando cuentas empresa")
+
+	// las monedas pendientes se activan a nombre del SISTEMA
+	ctxSistema := context.WithValue(context.Background(), auth.ClaveCredencial, "")
+	ctxSistema = context.WithValue(ctxSistema, auth.ClaveActor, "SISTEMA")
 
-	gm := gestores.NewGestorMonedas()
-	monedas, err := gm.Listar("T")
+	gm := gestores.NewGestorMonedas(repos.Monedas)
+	monedas, err := gm.Listar(ctxSistema, "T")
 	if err != nil {
-		log.Printf("ERROR [inicializarCuentasEmpresa]: No se pudieron listar monedas: %v", err)
+		l.Error("no se pudieron listar las monedas", logs.Err(err))
 		return err
 	}
 	if len(monedas) == 0 {
-		log.Println("No hay monedas activas o pendientes. No se inicializan cuentas empresa.")
+		l.Info("no hay monedas activas o pendientes, no se inicializan cuentas empresa")
 		return nil
 	}
 
@@ -116,12 +241,12 @@ func inicializarCuentasEmpresa() error {
 
 	for _, m := range monedas {
 		if m.IdCuentaEmpresa == "" {
-			log.Printf("ADVERTENCIA: Moneda %d sin IdCuentaEmpresa, omitiendo", m.IdMoneda)
+			l.Warn("moneda sin IdCuentaEmpresa, se omite", "IdMoneda", m.IdMoneda)
 			continue
 		}
 		tbId, err := utils.ParsearUint128(m.IdCuentaEmpresa)
 		if err != nil {
-			log.Printf("ADVERTENCIA: IdCuentaEmpresa '%s' inválido para moneda %d, omitiendo", m.IdCuentaEmpresa, m.IdMoneda)
+			l.Warn("IdCuentaEmpresa inválido, se omite", "IdMoneda", m.IdMoneda, "IdCuentaEmpresa", m.IdCuentaEmpresa)
 			continue
 		}
 		ids = append(ids, tbId)
@@ -134,15 +259,15 @@ func inicializarCuentasEmpresa() error {
 	}
 
 	if len(ids) == 0 {
-		log.Println("No hay cuentas empresa para verificar.")
+		l.Info("no hay cuentas empresa para verificar")
 		return nil
 	}
 
 	// Llamado a TB
-	cuentasExistentes, err := persistence.ClienteTB.LookupAccounts(ids)
-	log.Printf("Cuentas empresa encontradas en TB: %d de %d", len(cuentasExistentes), len(ids))
+	cuentasExistentes, err := tb.LookupAccounts(ids)
+	l.Info("cuentas empresa encontradas en TB", "encontradas", len(cuentasExistentes), "total", len(ids))
 	if err != nil {
-		log.Printf("ERROR [inicializarCuentasEmpresa]: No se pudieron consultar cuentas empresa en TigerBeetle: %v", err)
+		l.Error("no se pudieron consultar las cuentas empresa en TigerBeetle", logs.Err(err))
 		return err
 	}
 
@@ -151,7 +276,7 @@ func inicializarCuentasEmpresa() error {
 		existe[c.ID] = true
 	}
 
-	gc := gestores.NewGestorCuentas()
+	gc := gestores.NewGestorCuentas(tb, repos.Monedas, repos.Auditoria)
 
 	// Monedas activas: crea las cuentas empresa que faltan en TB
 	var faltantes []gestores.CuentaNueva
@@ -168,15 +293,15 @@ func inicializarCuentasEmpresa() error {
 		})
 	}
 	if len(faltantes) > 0 {
-		log.Printf("Creando %d cuentas empresa faltantes para monedas activas...", len(faltantes))
-		idsCreados, err := gc.CrearLote(faltantes)
+		l.Info("creando cuentas empresa faltantes para monedas activas", "cantidad", len(faltantes))
+		idsCreados, err := gc.CrearLote(ctxSistema, faltantes)
 		if err != nil {
-			log.Printf("ERROR [inicializarCuentasEmpresa]: No se pudieron crear cuentas empresa: %v", err)
+			l.Error("no se pudieron crear las cuentas empresa", logs.Err(err))
 			return err
 		}
-		log.Printf("Cuentas empresa creadas exitosamente: %v", idsCreados)
+		l.Info("cuentas empresa creadas", "IdsCuentas", idsCreados)
 	} else {
-		log.Println("Todas las cuentas empresa de monedas activas ya existen en TigerBeetle.")
+		l.Info("todas las cuentas empresa de monedas activas ya existen en TigerBeetle")
 	}
 
 	// Monedas pendientes: retoma y completa la creación interrumpida por caída del MS
@@ -185,32 +310,29 @@ func inicializarCuentasEmpresa() error {
 		if mi.estado != "P" {
 			continue
 		}
-		log.Printf("Recuperando moneda pendiente %d...", mi.idMoneda)
+		l.Info("recuperando moneda pendiente", "IdMoneda", mi.idMoneda)
 
 		if !existe[tbId] {
-			log.Printf("Creando cuenta empresa faltante para moneda pendiente %d...", mi.idMoneda)
-			_, _, err := gc.Crear(models.Cuentas{IdMoneda: uint32(mi.idMoneda), IdUsuarioFinal: 0, Fecha: mi.fechaAlta})
+			l.Info("creando cuenta empresa faltante para moneda pendiente", "IdMoneda", mi.idMoneda)
+			_, _, err := gc.Crear(ctxSistema, models.Cuentas{IdMoneda: uint32(mi.idMoneda), IdUsuarioFinal: 0, Fecha: mi.fechaAlta})
 			if err != nil {
-				log.Printf("ERROR [inicializarCuentasEmpresa]: No se pudo crear cuenta empresa para moneda pendiente %d: %v", mi.idMoneda, err)
+				l.Error("no se pudo crear la cuenta empresa de la moneda pendiente", "IdMoneda", mi.idMoneda, logs.Err(err))
 				return err
 			}
-			log.Printf("Cuenta empresa creada para moneda pendiente %d.", mi.idMoneda)
+			l.Info("cuenta empresa creada para moneda pendiente", "IdMoneda", mi.idMoneda)
 		}
 
 		// Activar la moneda
-		ctxSistema := context.WithValue(context.Background(), auth.ClaveCredencial, "")
-		ctxSistema = context.WithValue(ctxSistema, auth.ClaveActor, "SISTEMA")
-		moneda := &models.Monedas{IdMoneda: mi.idMoneda}
-		mensaje, err := moneda.Activar(ctxSistema)
+		mensaje, err := gm.Activar(ctxSistema, models.Monedas{IdMoneda: mi.idMoneda})
 		if err != nil {
-			log.Printf("ERROR [inicializarCuentasEmpresa]: No se pudo activar moneda pendiente %d: %v", mi.idMoneda, err)
+			l.Error("no se pudo activar la moneda pendiente", "IdMoneda", mi.idMoneda, logs.Err(err))
 			return err
 		}
 		if mensaje != "OK" {
-			log.Printf("ERROR [inicializarCuentasEmpresa]: No se pudo activar moneda pendiente %d: %s", mi.idMoneda, mensaje)
+			l.Error("no se pudo activar la moneda pendiente", "IdMoneda", mi.idMoneda, "mensaje", mensaje)
 			return fmt.Errorf("no se pudo activar moneda %d: %s", mi.idMoneda, mensaje)
 		}
-		log.Printf("Moneda pendiente %d activada exitosamente.", mi.idMoneda)
+		l.Info("moneda pendiente activada", "IdMoneda", mi.idMoneda)
 	}
 
 	return nil
@@ -0,0 +1,81 @@
+// Verifica la cadena de hashes de la auditoría (tabla Operaciones) contra los anclajes firmados, sin levantar el MS.
+// Usa la configuración de MySQL del MS (.env o variables de entorno). Imprime el resultado en JSON en stdout (los
+// logs van a stderr) y termina con código 1 si la cadena tiene incidencias o no se pudo verificar.
+//
+//	verificar-auditoria [-anclajes anclajes.ndjson] [-clave-publica <base64>]
+//
+// Los anclajes publicados en Kafka se verifican exportando el topic a NDJSON (un mensaje por línea).
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/auditoria"
+	"MSTransaccionesFinancieras/internal/config"
+	"MSTransaccionesFinancieras/internal/gestores"
+	"MSTransaccionesFinancieras/internal/infra/logs"
+	"MSTransaccionesFinancieras/internal/infra/persistence"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios/sps"
+)
+
+func main() {
+	if err := logs.InitEn(os.Stderr, "WARN"); err != nil {
+		logs.Fatal("no se pudo configurar el nivel de log", logs.Err(err))
+	}
+	cfg := config.LoadAuditoria()
+	archivo := flag.String("anclajes", cfg.ArchivoAnclajesAuditoria, "archivo NDJSON con los anclajes (vacío: sin anclajes)")
+	clavePublica := flag.String("clave-publica", os.Getenv("AUDITORIA_CLAVE_PUBLICA"), "clave pública ed25519 en base64 (por defecto la de AUDITORIA_CLAVE)")
+	timeout := flag.Duration("timeout", 10*time.Minute, "plazo para recorrer la cadena")
+	flag.Parse()
+
+	// sin clave pública no se pueden verificar los anclajes
+	if err := auditoria.Init(cfg); err != nil {
+		logs.Fatal("no se pudo leer la clave de auditoría", logs.Err(err))
+	}
+	publica := auditoria.ClavePublica()
+	if *clavePublica != "" {
+		p, err := auditoria.ParsearClavePublica(*clavePublica)
+		if err != nil {
+			logs.Fatal("clave pública inválida", logs.Err(err))
+		}
+		publica = p
+	}
+
+	var anclajes []models.AnclajesOperaciones
+	if *archivo != "" {
+		if publica == nil {
+			logs.Fatal("los anclajes requieren la clave pública (-clave-publica, AUDITORIA_CLAVE_PUBLICA o AUDITORIA_CLAVE)")
+		}
+		a, err := auditoria.LeerAnclajes(*archivo)
+		if err != nil {
+			logs.Fatal("no se pudieron leer los anclajes", logs.Err(err))
+		}
+		anclajes = a
+	}
+
+	if err := persistence.InitMySQLClient(cfg); err != nil {
+		logs.Fatal("no se pudo conectar a MySQL", logs.Err(err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	v, err := gestores.NewGestorOperaciones(sps.NewAuditoria(persistence.ClienteMySQL)).Verificar(ctx, anclajes, publica)
+	cancel()
+	persistence.CloseMySQLClient()
+	if err != nil {
+		logs.Fatal("no se pudo verificar la cadena de auditoría", logs.Err(err))
+	}
+
+	salida := json.NewEncoder(os.Stdout)
+	salida.SetIndent("", "  ")
+	if err := salida.Encode(v); err != nil {
+		logs.Fatal("no se pudo escribir el resultado", logs.Err(err))
+	}
+	if !v.Integra {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,112 @@
+package auditoria
+
+import (
+	"context"
+	"crypto/ed25519"
+	"strconv"
+	"sync"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/infra/logs"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+)
+
+// Ancla periódicamente (AUDITORIAANCLAJEMIN) la cabeza de la cadena de Operaciones en los destinos, si cambió
+// desde el último anclaje. Con varias réplicas cada una ancla por su cuenta: los anclajes repetidos no molestan.
+type Anclador struct {
+	auditoria  repositorios.Auditoria
+	parametros repositorios.Parametros
+	clave      ed25519.PrivateKey
+	destinos   []Destino
+	// IdOperacion del último anclaje publicado
+	ultimo   int
+	detener  chan struct{}
+	wg       sync.WaitGroup
+	ahora    func() time.Time
+	anclando sync.Mutex
+}
+
+func NewAnclador(auditoria repositorios.Auditoria, parametros repositorios.Parametros, clave ed25519.PrivateKey, destinos ...Destino) *Anclador {
+	return &Anclador{
+		auditoria:  auditoria,
+		parametros: parametros,
+		clave:      clave,
+		destinos:   destinos,
+		ultimo:     -1,
+		detener:    make(chan struct{}),
+		ahora:      time.Now,
+	}
+}
+
+func (a *Anclador) Start() {
+	a.wg.Add(1)
+	go a.loop()
+}
+
+// Detiene el anclaje periódico y ancla la cabeza de la cadena una última vez
+func (a *Anclador) Close(ctx context.Context) {
+	close(a.detener)
+	a.wg.Wait()
+	if _, err := a.Anclar(ctx); err != nil {
+		logs.L(logs.App).Error("no se pudo anclar la cadena de auditoría al apagar", logs.Err(err))
+	}
+}
+
+func (a *Anclador) loop() {
+	defer a.wg.Done()
+	for {
+		if _, err := a.Anclar(context.Background()); err != nil {
+			logs.L(logs.App).Error("no se pudo anclar la cadena de auditoría", logs.Err(err))
+		}
+		select {
+		case <-a.detener:
+			return
+		case <-time.After(obtenerIntervaloAnclaje(a.parametros)):
+		}
+	}
+}
+
+// Firma la cabeza de la cadena y la publica en todos los destinos. Si no cambió desde el último anclaje no hace
+// nada y retorna nil. Si falla algún destino se reintenta en el próximo ciclo.
+func (a *Anclador) Anclar(ctx context.Context) (*models.AnclajesOperaciones, error) {
+	a.anclando.Lock()
+	defer a.anclando.Unlock()
+
+	idOperacion, hash, err := a.auditoria.DameCabeza(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if idOperacion == a.ultimo {
+		return nil, nil
+	}
+	anclaje := &models.AnclajesOperaciones{IdOperacion: idOperacion, Hash: hash, Fecha: a.ahora().UTC()}
+	anclaje.Firmar(a.clave)
+
+	var errPublicar error
+	for _, d := range a.destinos {
+		if err := d.Publicar(ctx, *anclaje); err != nil {
+			logs.L(logs.App).ErrorContext(ctx, "no se pudo publicar el anclaje de auditoría", "destino", d.Nombre(), "IdOperacion", idOperacion, logs.Err(err))
+			errPublicar = err
+		}
+	}
+	if errPublicar != nil {
+		return nil, errPublicar
+	}
+	a.ultimo = idOperacion
+	logs.L(logs.App).InfoContext(ctx, "cadena de auditoría anclada", "IdOperacion", idOperacion, "Hash", hash)
+	return anclaje, nil
+}
+
+// Intervalo entre anclajes (AUDITORIAANCLAJEMIN), por defecto 15 minutos
+func obtenerIntervaloAnclaje(parametros repositorios.Parametros) time.Duration {
+	p := &models.Parametros{Parametro: "AUDITORIAANCLAJEMIN"}
+	if _, err := parametros.Dame(context.Background(), p); err != nil || p.Valor == "" {
+		return 15 * time.Minute
+	}
+	val, err := strconv.Atoi(p.Valor)
+	if err != nil || val <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(val) * time.Minute
+}
@@ -0,0 +1,59 @@
+package auditoria
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/config"
+	"MSTransaccionesFinancieras/internal/repositorios/memoria"
+)
+
+func TestAnclarEnArchivo(t *testing.T) {
+	publica, clave, _ := ed25519.GenerateKey(nil)
+	ruta := filepath.Join(t.TempDir(), "anclajes.ndjson")
+	repos := memoria.New().Repositorios()
+	anclador := NewAnclador(repos.Auditoria, repos.Parametros, clave, NewArchivo(ruta))
+
+	// la cadena vacía se ancla una vez; sin operaciones nuevas no se vuelve a anclar
+	for range 2 {
+		if _, err := anclador.Anclar(t.Context()); err != nil {
+			t.Fatalf("Anclar: %v", err)
+		}
+	}
+	if mensaje, err := repos.Auditoria.Registrar(t.Context(), "MP", map[string]any{"Parametro": "MONTOMAXTRANSFER"}); err != nil || mensaje != "OK" {
+		t.Fatalf("Registrar: %q %v", mensaje, err)
+	}
+	if a, err := anclador.Anclar(t.Context()); err != nil || a == nil || a.IdOperacion != 1 {
+		t.Fatalf("Anclar tras una operación: %+v %v", a, err)
+	}
+
+	anclajes, err := LeerAnclajes(ruta)
+	if err != nil || len(anclajes) != 2 || anclajes[0].IdOperacion != 0 || anclajes[1].IdOperacion != 1 {
+		t.Fatalf("LeerAnclajes: %+v %v", anclajes, err)
+	}
+	_, hash, _ := repos.Auditoria.DameCabeza(t.Context())
+	if anclajes[1].Hash != hash || !anclajes[1].FirmaValida(publica) {
+		t.Fatalf("anclaje: %+v", anclajes[1])
+	}
+}
+
+func TestInitClave(t *testing.T) {
+	publica, clave, _ := ed25519.GenerateKey(nil)
+	for _, s := range []string{base64.StdEncoding.EncodeToString(clave.Seed()), base64.StdEncoding.EncodeToString(clave)} {
+		if err := Init(config.Config{ClaveAuditoria: s}); err != nil || !ClavePublica().Equal(publica) {
+			t.Fatalf("Init: %v", err)
+		}
+	}
+	if err := Init(config.Config{ClaveAuditoria: base64.StdEncoding.EncodeToString([]byte("corta"))}); err == nil {
+		t.Fatal("Init con una clave inválida debe fallar")
+	}
+	if err := Init(config.Config{}); err != nil || ClavePublica() != nil {
+		t.Fatalf("Init sin clave: %v", err)
+	}
+	// sin archivo configurado no hay anclajes
+	if anclajes, err := Anclajes(); err != nil || len(anclajes) != 0 {
+		t.Fatalf("Anclajes: %+v %v", anclajes, err)
+	}
+}
@@ -0,0 +1,157 @@
+package auditoria
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"MSTransaccionesFinancieras/internal/config"
+	"MSTransaccionesFinancieras/internal/models"
+)
+
+// Anclaje de la cadena de hashes de Operaciones (ver models.AnclajesOperaciones): la cabeza de la cadena se firma
+// con la clave ed25519 del MS y se publica fuera de MySQL, en un archivo NDJSON y/o un topic de Kafka.
+// La verificación (GET /operaciones/verificar, cmd/verificar-auditoria) compara la cadena con esos anclajes.
+
+var (
+	clave           ed25519.PrivateKey
+	archivoAnclajes string
+)
+
+// Lee la clave y el archivo de anclajes de la configuración. Sin clave no se anclan ni se verifican anclajes.
+func Init(cfg config.Config) error {
+	clave, archivoAnclajes = nil, cfg.ArchivoAnclajesAuditoria
+	if cfg.ClaveAuditoria == "" {
+		return nil
+	}
+	c, err := ParsearClavePrivada(cfg.ClaveAuditoria)
+	if err != nil {
+		return err
+	}
+	clave = c
+	return nil
+}
+
+// Clave privada del MS (nil si no se configuró AUDITORIA_CLAVE)
+func Clave() ed25519.PrivateKey {
+	return clave
+}
+
+// Clave pública con la que se verifican los anclajes (nil si no se configuró AUDITORIA_CLAVE)
+func ClavePublica() ed25519.PublicKey {
+	if clave == nil {
+		return nil
+	}
+	return clave.Public().(ed25519.PublicKey)
+}
+
+// Anclajes del archivo configurado (ninguno si no hay archivo o todavía no existe)
+func Anclajes() ([]models.AnclajesOperaciones, error) {
+	if archivoAnclajes == "" {
+		return nil, nil
+	}
+	anclajes, err := LeerAnclajes(archivoAnclajes)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return anclajes, err
+}
+
+// Clave privada ed25519 en base64: la semilla de 32 bytes o la clave completa de 64
+func ParsearClavePrivada(s string) (ed25519.PrivateKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, errors.New("la clave de auditoría no está en base64")
+	}
+	switch len(b) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(b), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(b), nil
+	}
+	return nil, fmt.Errorf("la clave de auditoría debe tener %d o %d bytes", ed25519.SeedSize, ed25519.PrivateKeySize)
+}
+
+// Clave pública ed25519 en base64 (32 bytes)
+func ParsearClavePublica(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("la clave pública de auditoría debe ser de %d bytes en base64", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// Lee los anclajes de un archivo NDJSON (un anclaje JSON por línea). Sirve también para los anclajes exportados
+// del topic de Kafka, que publica el mismo JSON. Ignora las líneas vacías.
+func LeerAnclajes(ruta string) ([]models.AnclajesOperaciones, error) {
+	fd, err := os.Open(ruta)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	anclajes := make([]models.AnclajesOperaciones, 0)
+	scanner := bufio.NewScanner(fd)
+	for n := 1; scanner.Scan(); n++ {
+		linea := strings.TrimSpace(scanner.Text())
+		if linea == "" {
+			continue
+		}
+		var a models.AnclajesOperaciones
+		if err := json.Unmarshal([]byte(linea), &a); err != nil {
+			return nil, fmt.Errorf("línea %d de %s: %w", n, ruta, err)
+		}
+		anclajes = append(anclajes, a)
+	}
+	return anclajes, scanner.Err()
+}
+
+// Destino donde se publican los anclajes
+type Destino interface {
+	Nombre() string
+	Publicar(ctx context.Context, Anclaje models.AnclajesOperaciones) error
+}
+
+// Publica los anclajes agregándolos a un archivo NDJSON. Conviene que esté en un almacenamiento que no
+// administren quienes administran MySQL (ej: un volumen con retención WORM).
+type Archivo struct {
+	ruta string
+	mu   sync.Mutex
+}
+
+func NewArchivo(ruta string) *Archivo {
+	return &Archivo{ruta: ruta}
+}
+
+func (a *Archivo) Nombre() string {
+	return "archivo"
+}
+
+func (a *Archivo) Publicar(ctx context.Context, Anclaje models.AnclajesOperaciones) error {
+	linea, err := json.Marshal(Anclaje)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	fd, err := os.OpenFile(a.ruta, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := fd.Write(append(linea, '\n')); err != nil {
+		fd.Close()
+		return err
+	}
+	if err := fd.Sync(); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
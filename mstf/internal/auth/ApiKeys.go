@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// Alcances de las API keys (columna ApiKeys.Alcances). Cada alcance otorga una parte de los permisos del
+// rol S (Sistema); la API key tiene la unión de los de sus alcances.
+const (
+	AlcanceAdmin          = "admin"
+	AlcanceLectura        = "lectura"
+	AlcanceTransferencias = "transferencias"
+)
+
+// Todos los alcances, ordenados
+var Alcances = []string{AlcanceAdmin, AlcanceLectura, AlcanceTransferencias}
+
+// Permisos del alcance transferencias: operar cuentas y transferencias de un sistema cliente
+var permisosTransferencias = []string{
+	PermisoCuentasLeer, PermisoCuentasEscribir, PermisoMonedasLeer, PermisoTransferenciasLeer, PermisoTransferenciasEscribir,
+}
+
+// Indica si alguno de los alcances otorga el permiso (f_permiso_en_alcances): admin todos, lectura los de
+// consulta (:read) y transferencias los de cuentas y transferencias
+func PermisoEnAlcances(Alcances []string, Permiso string) bool {
+	for _, a := range Alcances {
+		switch a {
+		case AlcanceAdmin:
+			return true
+		case AlcanceLectura:
+			if strings.HasSuffix(Permiso, ":read") {
+				return true
+			}
+		case AlcanceTransferencias:
+			if slices.Contains(permisosTransferencias, Permiso) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Indica si la IP está en la lista de IPs o redes CIDR permitidas de una API key. Sin lista se acepta cualquiera
+func IPPermitida(IP string, Permitidas []string) bool {
+	if len(Permitidas) == 0 {
+		return true
+	}
+	ip, err := netip.ParseAddr(IP)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, p := range Permitidas {
+		if red, err := ParsearRed(p); err == nil && red.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IP (como red de un solo host) o red CIDR de la lista de IPs permitidas de una API key
+func ParsearRed(Red string) (netip.Prefix, error) {
+	if strings.Contains(Red, "/") {
+		red, err := netip.ParsePrefix(Red)
+		return red.Masked(), err
+	}
+	ip, err := netip.ParseAddr(Red)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	ip = ip.Unmap()
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"context"
+	"slices"
+)
+
+// Permisos que se otorgan a los roles (tabla Permisos). Cada ruta del router requiere uno.
+const (
+	PermisoApiKeysLeer            = "apikeys:read"
+	PermisoApiKeysEscribir        = "apikeys:write"
+	PermisoAuditoriaLeer          = "auditoria:read"
+	PermisoConsumidorLeer         = "consumidor:read"
+	PermisoConsumidorEscribir     = "consumidor:write"
+	PermisoCuentasCerrar          = "cuentas:close"
+	PermisoCuentasLeer            = "cuentas:read"
+	PermisoCuentasEscribir        = "cuentas:write"
+	PermisoMonedasLeer            = "monedas:read"
+	PermisoMonedasEscribir        = "monedas:write"
+	PermisoParametrosLeer         = "parametros:read"
+	PermisoParametrosEscribir     = "parametros:write"
+	PermisoRolesLeer              = "roles:read"
+	PermisoRolesEscribir          = "roles:write"
+	PermisoSistemaAdmin           = "sistema:admin"
+	PermisoTransferenciasLeer     = "transferencias:read"
+	PermisoTransferenciasEscribir = "transferencias:write"
+	PermisoUsuariosAdmin          = "usuarios:admin"
+	PermisoUsuariosLeer           = "usuarios:read"
+)
+
+// Todos los permisos del catálogo, ordenados
+var Permisos = []string{
+	PermisoApiKeysLeer, PermisoApiKeysEscribir, PermisoAuditoriaLeer, PermisoConsumidorLeer, PermisoConsumidorEscribir,
+	PermisoCuentasCerrar, PermisoCuentasLeer, PermisoCuentasEscribir, PermisoMonedasLeer, PermisoMonedasEscribir,
+	PermisoParametrosLeer, PermisoParametrosEscribir, PermisoRolesLeer, PermisoRolesEscribir, PermisoSistemaAdmin, PermisoTransferenciasLeer, PermisoTransferenciasEscribir,
+	PermisoUsuariosAdmin, PermisoUsuariosLeer,
+}
+
+// Permisos del actor autenticado de la request (nil si no hay actor)
+func PermisosDesdeCtx(ctx context.Context) []string {
+	permisos, _ := ctx.Value(ClavePermisos).([]string)
+	return permisos
+}
+
+// Indica si el actor de la request tiene el permiso
+func TienePermiso(ctx context.Context, Permiso string) bool {
+	return slices.Contains(PermisosDesdeCtx(ctx), Permiso)
+}
@@ -8,6 +8,7 @@ type claveCtx string
 const (
 	ClaveCredencial claveCtx = "Credencial"
 	ClaveActor      claveCtx = "Actor"
+	ClavePermisos   claveCtx = "Permisos"
 )
 
 // Eextrae la credencial y el actor del contexto de la request
@@ -1,38 +1,62 @@
 package config
 
 import (
-	"log"
+	"net"
 	"os"
 	"strconv"
 	"strings"
 
+	"MSTransaccionesFinancieras/internal/infra/logs"
+
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Puerto                 int
+	Puerto int
+	// Puerto del listener interno de GET /metrics (Prometheus), separado de la API (0 = sin métricas)
+	PuertoMetricas int
+	// Proxies (IPs o redes CIDR) cuyo X-Forwarded-For se acepta para obtener la IP del cliente (vacío = la de la conexión)
+	ProxiesConfiables      []*net.IPNet
 	DireccionesTigerBeetle []string
 	URLWebhook             string
 	// Kafka
 	BrokersKafka []string
 	TopicKafka   string
 	GroupIDKafka string
+	// Topic opcional donde se publican los mensajes puestos en cuarentena ("" = solo se registran en MySQL)
+	TopicKafkaDLQ string
+	// Carpeta de carga masiva de archivos NDJSON ("" = fuente deshabilitada)
+	CarpetaIngesta string
 	// MySQL
 	MySQLHost     string
 	MySQLPort     int
 	MySQLUser     string
 	MySQLPassword string
 	MySQLDatabase string
+	// Exportador de trazas OpenTelemetry: none (default) u otlp
+	ExportadorTrazas string
+	// Nivel inicial de log de todos los subsistemas: DEBUG, INFO (default), WARN, ERROR
+	NivelLog string
+	// Inyección de fallas en TB, MySQL y webhook (solo pruebas) y sus reglas iniciales en JSON
+	InyeccionFallas bool
+	FallasIniciales string
+	// Anclaje de la cadena de auditoría: clave ed25519 del MS en base64 ("" = sin anclajes), archivo NDJSON
+	// y topic de Kafka donde se publican los anclajes firmados ("" = ese destino deshabilitado)
+	ClaveAuditoria           string
+	ArchivoAnclajesAuditoria string
+	TopicKafkaAuditoria      string
 }
 
 func Load() Config {
 	if err := godotenv.Load(); err != nil {
-		log.Printf("Archivo .env no encontrado, se usarán variables de entorno del sistema: %v", err)
+		logs.L(logs.App).Warn("archivo .env no encontrado, se usarán variables de entorno del sistema", logs.Err(err))
 	}
 
 	cfg := Config{}
 
 	cfg.Puerto = getEnvInt("PORT", 8080)
+	cfg.PuertoMetricas = getEnvInt("METRICS_PORT", 9090)
+	cfg.ProxiesConfiables = getEnvRedes("PROXIES_CONFIABLES")
 
 	// TB
 	cfg.DireccionesTigerBeetle = []string{requireEnv("TB_ADDRESSES")}
@@ -44,21 +68,55 @@ func Load() Config {
 	cfg.BrokersKafka = strings.Split(requireEnv("KAFKA_BROKERS"), ",")
 	cfg.TopicKafka = requireEnv("KAFKA_TOPIC_TRANSFERS")
 	cfg.GroupIDKafka = requireEnv("KAFKA_GROUP_ID")
+	cfg.TopicKafkaDLQ = getEnv("KAFKA_TOPIC_DLQ", "")
+	// Ingesta por carpeta
+	cfg.CarpetaIngesta = getEnv("INGESTA_CARPETA", "")
 	// MySQL
+	cargarMySQL(&cfg)
+	// Trazas (el endpoint OTLP se configura con las variables estándar OTEL_EXPORTER_OTLP_*)
+	cfg.ExportadorTrazas = getEnv("OTEL_TRACES_EXPORTER", "none")
+	// Logs
+	cfg.NivelLog = getEnv("LOG_LEVEL", "INFO")
+	// Inyección de fallas (ver internal/infra/fallas)
+	cfg.InyeccionFallas = getEnv("FALLAS_HABILITADAS", "false") == "true"
+	cfg.FallasIniciales = getEnv("FALLAS", "")
+	// Auditoría
+	cargarAuditoria(&cfg)
+
+	return cfg
+}
+
+// Solo la configuración de MySQL y de la auditoría, para las herramientas que verifican la cadena de auditoría
+// sin levantar el MS (cmd/verificar-auditoria)
+func LoadAuditoria() Config {
+	if err := godotenv.Load(); err != nil {
+		logs.L(logs.App).Warn("archivo .env no encontrado, se usarán variables de entorno del sistema", logs.Err(err))
+	}
+	cfg := Config{}
+	cargarMySQL(&cfg)
+	cargarAuditoria(&cfg)
+	return cfg
+}
+
+func cargarMySQL(cfg *Config) {
 	cfg.MySQLHost = requireEnv("MYSQL_HOST")
 	cfg.MySQLPort = getEnvInt("MYSQL_PORT", 3306)
 	cfg.MySQLUser = requireEnv("MYSQL_USER")
 	cfg.MySQLPassword = requireEnv("MYSQL_PASSWORD")
 	cfg.MySQLDatabase = requireEnv("MYSQL_DATABASE")
+}
 
-	return cfg
+func cargarAuditoria(cfg *Config) {
+	cfg.ClaveAuditoria = getEnv("AUDITORIA_CLAVE", "")
+	cfg.ArchivoAnclajesAuditoria = getEnv("AUDITORIA_ANCLAJES_ARCHIVO", "")
+	cfg.TopicKafkaAuditoria = getEnv("KAFKA_TOPIC_AUDITORIA", "")
 }
 
 // lee variable entorno dle sistema, si no existe, error fatal
 func requireEnv(key string) string {
 	value, exists := os.LookupEnv(key)
 	if !exists || value == "" {
-		log.Fatalf("FATAL: variable de entorno requerida no configurada: %s", key)
+		logs.Fatal("variable de entorno requerida no configurada", "variable", key)
 	}
 	return value
 }
@@ -70,6 +128,30 @@ func getEnv(key string, defaultValue string) string {
 	return defaultValue
 }
 
+// Lista de IPs o redes CIDR separadas por coma. Un valor inválido es error fatal
+func getEnvRedes(key string) []*net.IPNet {
+	var redes []*net.IPNet
+	for _, valor := range strings.Split(getEnv(key, ""), ",") {
+		valor = strings.TrimSpace(valor)
+		if valor == "" {
+			continue
+		}
+		if !strings.Contains(valor, "/") {
+			if ip := net.ParseIP(valor); ip != nil && ip.To4() != nil {
+				valor += "/32"
+			} else {
+				valor += "/128"
+			}
+		}
+		_, red, err := net.ParseCIDR(valor)
+		if err != nil {
+			logs.Fatal("variable de entorno con una IP o red CIDR inválida", "variable", key, "valor", valor)
+		}
+		redes = append(redes, red)
+	}
+	return redes
+}
+
 func getEnvInt(key string, defaultValue int) int {
 	if value, exists := os.LookupEnv(key); exists {
 		if i, err := strconv.Atoi(value); err == nil {
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"MSTransaccionesFinancieras/internal/gestores"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/utils"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ApiKeysControlador struct {
+	Gestor *gestores.GestorApiKeys
+}
+
+func NewApiKeysControlador(gk *gestores.GestorApiKeys) *ApiKeysControlador {
+	return &ApiKeysControlador{Gestor: gk}
+}
+
+func (kc *ApiKeysControlador) Listar(c echo.Context) error {
+	apiKeys, err := kc.Gestor.Listar(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al listar API keys: "+utils.SanitizarError(err)))
+	}
+	return c.JSON(http.StatusOK, apiKeys)
+}
+
+func (kc *ApiKeysControlador) Crear(c echo.Context) error {
+	type Request struct {
+		Nombre          string     `json:"Nombre"`
+		Sistema         string     `json:"Sistema"`
+		Alcances        []string   `json:"Alcances"`
+		IPsPermitidas   []string   `json:"IPsPermitidas"`
+		FechaExpiracion *time.Time `json:"FechaExpiracion"`
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	if req.Nombre == "" || req.Sistema == "" || len(req.Alcances) == 0 {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Nombre, Sistema y Alcances son campos obligatorios"))
+	}
+	apiKey := &models.ApiKeys{
+		Nombre:          req.Nombre,
+		Sistema:         req.Sistema,
+		Alcances:        req.Alcances,
+		IPsPermitidas:   req.IPsPermitidas,
+		FechaExpiracion: req.FechaExpiracion,
+	}
+	mensaje, err := kc.Gestor.Crear(c.Request().Context(), apiKey)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al crear API key: "+utils.SanitizarError(err)))
+	}
+	if mensaje != "OK" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta(mensaje))
+	}
+	return c.JSON(http.StatusCreated, map[string]any{"Mensaje": mensaje, "IdApiKey": apiKey.IdApiKey, "Prefijo": apiKey.Prefijo, "ApiKey": apiKey.ApiKey})
+}
+
+func (kc *ApiKeysControlador) Rotar(c echo.Context) error {
+	type Request struct {
+		IdApiKey int `param:"IdApiKey"`
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	if req.IdApiKey <= 0 {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("IdApiKey es campo obligatorio"))
+	}
+	mensaje, clave, err := kc.Gestor.Rotar(c.Request().Context(), models.ApiKeys{IdApiKey: req.IdApiKey})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al rotar API key: "+utils.SanitizarError(err)))
+	}
+	if mensaje != "OK" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta(mensaje))
+	}
+	return c.JSON(http.StatusOK, map[string]any{"Mensaje": mensaje, "IdApiKey": req.IdApiKey, "ApiKey": clave})
+}
+
+func (kc *ApiKeysControlador) Revocar(c echo.Context) error {
+	type Request struct {
+		IdApiKey int `param:"IdApiKey"`
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	if req.IdApiKey <= 0 {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("IdApiKey es campo obligatorio"))
+	}
+	mensaje, err := kc.Gestor.Revocar(c.Request().Context(), models.ApiKeys{IdApiKey: req.IdApiKey})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al revocar API key: "+utils.SanitizarError(err)))
+	}
+	if mensaje != "OK" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta(mensaje))
+	}
+	return c.JSON(http.StatusOK, map[string]string{"Mensaje": mensaje})
+}
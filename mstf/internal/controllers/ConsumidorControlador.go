@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"MSTransaccionesFinancieras/internal/gestores"
+	kafka "MSTransaccionesFinancieras/internal/infra/kafkamstf"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/utils"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ConsumidorControlador struct {
+	Consumidor       *kafka.Consumidor
+	GestorCuarentena *gestores.GestorCuarentena
+}
+
+func NewConsumidorControlador(consumidor *kafka.Consumidor, gc *gestores.GestorCuarentena) *ConsumidorControlador {
+	return &ConsumidorControlador{Consumidor: consumidor, GestorCuarentena: gc}
+}
+
+// Devuelve las métricas del consumidor y los mensajes en cuarentena (más recientes primero)
+func (cc *ConsumidorControlador) Cuarentena(c echo.Context) error {
+	type Request struct {
+		IdTransferencia string `query:"IdTransferencia"`
+		Limite          int    `query:"Limite"`
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	if req.Limite == 0 {
+		req.Limite = 100
+	}
+	if req.Limite < 0 || req.Limite > 1000 {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Limite debe estar entre 1 y 1000"))
+	}
+	mensajes, err := cc.GestorCuarentena.Buscar(c.Request().Context(), req.IdTransferencia, req.Limite)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al buscar mensajes en cuarentena: "+utils.SanitizarError(err)))
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"Metricas": cc.Consumidor.Metricas(),
+		"Total":    len(mensajes),
+		"Mensajes": mensajes,
+	})
+}
+
+// Estado del consumidor: pausa, lote en curso y backoff de cada pipeline
+func (cc *ConsumidorControlador) Estado(c echo.Context) error {
+	return c.JSON(http.StatusOK, cc.Consumidor.Estado())
+}
+
+// Offsets y lag por partición
+func (cc *ConsumidorControlador) Offsets(c echo.Context) error {
+	ctx, cancelar := context.WithTimeout(c.Request().Context(), 15*time.Second)
+	defer cancelar()
+	offsets, err := cc.Consumidor.Offsets(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al obtener offsets: "+utils.SanitizarError(err)))
+	}
+	return c.JSON(http.StatusOK, offsets)
+}
+
+func (cc *ConsumidorControlador) Pausar(c echo.Context) error {
+	if !cc.Consumidor.Pausar() {
+		return c.JSON(http.StatusConflict, models.NewErrorRespuesta("El consumidor ya está pausado"))
+	}
+	return c.JSON(http.StatusOK, map[string]string{"Mensaje": "OK"})
+}
+
+func (cc *ConsumidorControlador) Reanudar(c echo.Context) error {
+	if err := cc.Consumidor.Reanudar(); errors.Is(err, kafka.ErrConsumidorNoPausado) {
+		return c.JSON(http.StatusConflict, models.NewErrorRespuesta("El consumidor no está pausado"))
+	} else if err != nil {
+		return c.JSON(http.StatusConflict, models.NewErrorRespuesta("No se puede reanudar: "+err.Error()))
+	}
+	return c.JSON(http.StatusOK, map[string]string{"Mensaje": "OK"})
+}
+
+// Reprocesa un rango de una partición en modo SIMULACION (no escribe) o REAL.
+func (cc *ConsumidorControlador) Reprocesar(c echo.Context) error {
+	type Request struct {
+		Particion   *int   `json:"Particion"`
+		DesdeOffset *int64 `json:"DesdeOffset"`
+		DesdeFecha  string `json:"DesdeFecha"`
+		HastaOffset *int64 `json:"HastaOffset"`
+		HastaFecha  string `json:"HastaFecha"`
+		Modo        string `json:"Modo"`
+		Limite      int    `json:"Limite"`
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	if req.Particion == nil || *req.Particion < 0 {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Particion es campo obligatorio"))
+	}
+	if req.Modo == "" {
+		req.Modo = kafka.ModoReprocesoSimulacion
+	}
+	if req.Modo != kafka.ModoReprocesoSimulacion && req.Modo != kafka.ModoReprocesoReal {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Modo debe ser '"+kafka.ModoReprocesoSimulacion+"' o '"+kafka.ModoReprocesoReal+"'"))
+	}
+	if (req.DesdeOffset == nil) == (req.DesdeFecha == "") {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Se debe indicar DesdeOffset o DesdeFecha (solo uno)"))
+	}
+	if req.Limite == 0 {
+		req.Limite = 1000
+	}
+	if req.Limite < 0 || req.Limite > 10000 {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Limite debe estar entre 1 y 10000"))
+	}
+
+	pedido := kafka.PedidoReproceso{
+		Particion:   *req.Particion,
+		DesdeOffset: req.DesdeOffset,
+		HastaOffset: req.HastaOffset,
+		Modo:        req.Modo,
+		Limite:      req.Limite,
+	}
+	if req.DesdeFecha != "" {
+		ts, err := utils.FechaATimestampNS(req.DesdeFecha)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("DesdeFecha inválida: "+utils.SanitizarError(err)))
+		}
+		desde := time.Unix(0, int64(ts))
+		pedido.DesdeFecha = &desde
+	}
+	if req.HastaFecha != "" {
+		ts, err := utils.FechaATimestampNS(req.HastaFecha)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("HastaFecha inválida: "+utils.SanitizarError(err)))
+		}
+		hasta := time.Unix(0, int64(ts))
+		pedido.HastaFecha = &hasta
+	}
+
+	ctx, cancelar := context.WithTimeout(c.Request().Context(), 2*time.Minute)
+	defer cancelar()
+	resultado, err := cc.Consumidor.Reprocesar(ctx, pedido)
+	if errors.Is(err, kafka.ErrReprocesoEnCurso) || errors.Is(err, kafka.ErrReprocesoSinPausa) {
+		return c.JSON(http.StatusConflict, models.NewErrorRespuesta(err.Error()))
+	}
+	if err != nil && resultado == nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al reprocesar: "+utils.SanitizarError(err)))
+	}
+	if err != nil {
+		// reproceso parcial: se informa lo procesado junto con el error
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"Error":     "Error al reprocesar: " + utils.SanitizarError(err),
+			"Resultado": resultado,
+		})
+	}
+	return c.JSON(http.StatusOK, resultado)
+}
@@ -2,8 +2,11 @@ package controllers
 
 import (
 	"MSTransaccionesFinancieras/internal/gestores"
+	"MSTransaccionesFinancieras/internal/infra/logs"
 	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
 	"MSTransaccionesFinancieras/internal/utils"
+	"context"
 	"fmt"
 	"math/big"
 	"net/http"
@@ -16,10 +19,11 @@ import (
 type CuentasControlador struct {
 	Gestor               *gestores.GestorCuentas
 	GestorTransferencias *gestores.GestorTransferencias
+	parametros           repositorios.Parametros
 }
 
-func NewCuentasControlador(gc *gestores.GestorCuentas, gt *gestores.GestorTransferencias) *CuentasControlador {
-	return &CuentasControlador{Gestor: gc, GestorTransferencias: gt}
+func NewCuentasControlador(gc *gestores.GestorCuentas, gt *gestores.GestorTransferencias, parametros repositorios.Parametros) *CuentasControlador {
+	return &CuentasControlador{Gestor: gc, GestorTransferencias: gt, parametros: parametros}
 }
 
 func (cc *CuentasControlador) Dame(c echo.Context) error {
@@ -39,7 +43,7 @@ func (cc *CuentasControlador) Dame(c echo.Context) error {
 	}
 
 	cuenta := &models.Cuentas{IdUsuarioFinal: req.IdUsuarioFinal, IdMoneda: req.IdMoneda}
-	err := cuenta.Dame()
+	err := cc.Gestor.Dame(c.Request().Context(), cuenta)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Error al obtener cuenta: "+utils.SanitizarError(err)))
 	}
@@ -110,7 +114,11 @@ func (cc *CuentasControlador) DameHistorial(c echo.Context) error {
 
 	//obtener historial
 	cuenta := &models.Cuentas{IdUsuarioFinal: req.IdUsuarioFinal, IdMoneda: req.IdMoneda}
-	balances, err := cuenta.ListarHistorialBalances(timestampMin, timestampMax, limite)
+	if limite == 0 {
+		limite = obtenerLimiteHistorialBalances(cc.parametros)
+	}
+
+	balances, err := cc.Gestor.ListarHistorialBalances(c.Request().Context(), cuenta, timestampMin, timestampMax, limite)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al obtener historial: "+utils.SanitizarError(err)))
 	}
@@ -204,8 +212,12 @@ func (cc *CuentasControlador) DameTransferencias(c echo.Context) error {
 		incluyeRevertidas = parsed
 	}
 
+	if limite == 0 {
+		limite = obtenerLimiteHistorialBalances(cc.parametros)
+	}
+
 	transferencias, err := cc.GestorTransferencias.BuscarPorCuenta(
-		req.IdUsuarioFinal, req.IdMoneda, incluyeRevertidas, timestampMin, timestampMax, limite,
+		c.Request().Context(), req.IdUsuarioFinal, req.IdMoneda, incluyeRevertidas, timestampMin, timestampMax, limite,
 	)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al obtener transferencias: "+utils.SanitizarError(err)))
@@ -238,8 +250,8 @@ func (cc *CuentasControlador) Crear(c echo.Context) error {
 	}
 
 	// cuentas creadas vía APIREST: DebitsMustNotExceedCredits = true (IdUsuarioFinal > 0)
-	_, existe, err := cc.Gestor.Crear(models.Cuentas{IdMoneda: req.IdMoneda, IdUsuarioFinal: req.IdUsuarioFinal, Fecha: req.Fecha})
-	//log.Printf("\n\nCuentasControlador.Crear: Resultado de creación en GestorCuentas: mensaje='%s', existe=%v, error='%v'", idCuentaTBString, existe, err)
+	_, existe, err := cc.Gestor.Crear(c.Request().Context(), models.Cuentas{IdMoneda: req.IdMoneda, IdUsuarioFinal: req.IdUsuarioFinal, Fecha: req.Fecha})
+	logs.L(logs.Cuentas).DebugContext(c.Request().Context(), "Crear: resultado de GestorCuentas.Crear", "IdMoneda", req.IdMoneda, "IdUsuarioFinal", req.IdUsuarioFinal, "existe", existe, logs.Err(err))
 	if err != nil {
 		return c.JSON(http.StatusConflict, models.NewErrorRespuesta("Error al crear cuenta: "+utils.SanitizarError(err)))
 	}
@@ -269,13 +281,13 @@ func (cc *CuentasControlador) Desactivar(c echo.Context) error {
 	}
 
 	cuenta := models.Cuentas{IdMoneda: req.IdMoneda, IdUsuarioFinal: req.IdUsuarioFinal}
-	if err := cuenta.Dame(); err != nil {
+	if err := cc.Gestor.Dame(c.Request().Context(), &cuenta); err != nil {
 		return c.JSON(http.StatusNotFound, models.NewErrorRespuesta("Cuenta no encontrada: "+utils.SanitizarError(err)))
 	}
 	if cuenta.Estado != "A" {
 		return c.JSON(http.StatusConflict, models.NewErrorRespuesta("La cuenta ya se encuentra inactiva"))
 	}
-	if err := cuenta.Desactivar(); err != nil {
+	if err := cc.Gestor.Desactivar(c.Request().Context(), &cuenta); err != nil {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Error al desactivar cuenta: "+utils.SanitizarError(err)))
 	}
 	return c.JSON(http.StatusOK, map[string]interface{}{
@@ -297,13 +309,13 @@ func (cc *CuentasControlador) Activar(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("IdUsuarioFinal e IdMoneda son requeridos y deben ser mayores a cero"))
 	}
 	cuenta := models.Cuentas{IdMoneda: req.IdMoneda, IdUsuarioFinal: req.IdUsuarioFinal}
-	if err := cuenta.Dame(); err != nil {
+	if err := cc.Gestor.Dame(c.Request().Context(), &cuenta); err != nil {
 		return c.JSON(http.StatusNotFound, models.NewErrorRespuesta("Cuenta no encontrada: "+utils.SanitizarError(err)))
 	}
 	if cuenta.Estado != "I" {
 		return c.JSON(http.StatusConflict, models.NewErrorRespuesta("La cuenta ya se encuentra activa"))
 	}
-	if err := cuenta.Activar(); err != nil {
+	if err := cc.Gestor.Activar(c.Request().Context(), &cuenta); err != nil {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Error al activar cuenta: "+utils.SanitizarError(err)))
 	}
 	return c.JSON(http.StatusOK, map[string]interface{}{
@@ -368,8 +380,8 @@ func (cc *CuentasControlador) Buscar(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Estado debe ser 'A' (activo), 'I' (inactivo), o vacío"))
 	}
 
-	limiteMaximo := obtenerLimiteMaximoBuscarCuentas()
-	var limit uint32 = obtenerLimiteBuscarCuentas()
+	limiteMaximo := obtenerLimiteMaximoBuscarCuentas(cc.parametros)
+	var limit uint32 = obtenerLimiteBuscarCuentas(cc.parametros)
 	if limitStr != "" {
 		parsed, err := strconv.ParseUint(limitStr, 10, 32)
 		if err != nil {
@@ -384,7 +396,7 @@ func (cc *CuentasControlador) Buscar(c echo.Context) error {
 		limit = uint32(parsed)
 	}
 
-	cuentas, err := cc.Gestor.BuscarAvanzado(idsCuenta, idUsuarioFinal, idMoneda, estado, limit)
+	cuentas, err := cc.Gestor.BuscarAvanzado(c.Request().Context(), idsCuenta, idUsuarioFinal, idMoneda, estado, limit)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al buscar cuentas: "+utils.SanitizarError(err)))
 	}
@@ -427,9 +439,9 @@ func (cc *CuentasControlador) Buscar(c echo.Context) error {
 	})
 }
 
-func obtenerLimiteBuscarCuentas() uint32 {
+func obtenerLimiteBuscarCuentas(parametros repositorios.Parametros) uint32 {
 	p := &models.Parametros{Parametro: "LIMITEBUSCARCUENTAS"}
-	if _, err := p.Dame(); err != nil || p.Valor == "" {
+	if _, err := parametros.Dame(context.Background(), p); err != nil || p.Valor == "" {
 		return 100
 	}
 	val, err := strconv.ParseUint(p.Valor, 10, 32)
@@ -439,9 +451,9 @@ func obtenerLimiteBuscarCuentas() uint32 {
 	return uint32(val)
 }
 
-func obtenerLimiteMaximoBuscarCuentas() uint32 {
+func obtenerLimiteMaximoBuscarCuentas(parametros repositorios.Parametros) uint32 {
 	p := &models.Parametros{Parametro: "LIMITEMAXIMOBUSCARCUENTAS"}
-	if _, err := p.Dame(); err != nil || p.Valor == "" {
+	if _, err := parametros.Dame(context.Background(), p); err != nil || p.Valor == "" {
 		return 500
 	}
 	val, err := strconv.ParseUint(p.Valor, 10, 32)
@@ -450,3 +462,15 @@ func obtenerLimiteMaximoBuscarCuentas() uint32 {
 	}
 	return uint32(val)
 }
+
+func obtenerLimiteHistorialBalances(parametros repositorios.Parametros) uint32 {
+	p := &models.Parametros{Parametro: "LIMITEHISTORIALBALANCE"}
+	if _, err := parametros.Dame(context.Background(), p); err != nil || p.Valor == "" {
+		return 100
+	}
+	val, err := strconv.ParseUint(p.Valor, 10, 32)
+	if err != nil {
+		return 100
+	}
+	return uint32(val)
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"MSTransaccionesFinancieras/internal/infra/fallas"
+	"MSTransaccionesFinancieras/internal/infra/logs"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/utils"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type FallasControlador struct {
+}
+
+func NewFallasControlador() *FallasControlador {
+	return &FallasControlador{}
+}
+
+// Reglas de inyección de fallas vigentes por destino
+func (fc *FallasControlador) Reglas(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"Destinos": fallas.Destinos(),
+		"Reglas":   fallas.Reglas(),
+	})
+}
+
+// Reemplaza la regla de inyección de un destino (tigerbeetle, mysql, webhook).
+// El cambio no persiste: al reiniciar el MS se vuelve a FALLAS.
+func (fc *FallasControlador) Configurar(c echo.Context) error {
+	type Request struct {
+		Destino string `param:"destino"`
+		fallas.Regla
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	if req.Modo == "" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Modo es campo obligatorio"))
+	}
+	if err := fallas.Configurar(req.Destino, req.Regla); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta(err.Error()))
+	}
+	logs.L(logs.App).WarnContext(c.Request().Context(), "regla de inyección de fallas modificada", "destino", req.Destino, "modo", req.Modo)
+	return c.JSON(http.StatusOK, map[string]string{"Mensaje": "OK"})
+}
+
+// Quita la regla de inyección de un destino
+func (fc *FallasControlador) Quitar(c echo.Context) error {
+	destino := c.Param("destino")
+	fallas.Quitar(destino)
+	logs.L(logs.App).InfoContext(c.Request().Context(), "regla de inyección de fallas quitada", "destino", destino)
+	return c.JSON(http.StatusOK, map[string]string{"Mensaje": "OK"})
+}
@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"MSTransaccionesFinancieras/internal/infra/logs"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/utils"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type LogsControlador struct {
+}
+
+func NewLogsControlador() *LogsControlador {
+	return &LogsControlador{}
+}
+
+// Nivel de log actual de cada subsistema
+func (lc *LogsControlador) Niveles(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"Subsistemas": logs.Subsistemas(),
+		"Niveles":     logs.Niveles(),
+	})
+}
+
+// Cambia el nivel de log de un subsistema en runtime (ej: DEBUG en kafka sin redeploy).
+// El cambio no persiste: al reiniciar el MS se vuelve a LOG_LEVEL.
+func (lc *LogsControlador) ModificarNivel(c echo.Context) error {
+	type Request struct {
+		Subsistema string `param:"subsistema"`
+		Nivel      string `json:"Nivel"`
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	if req.Subsistema == "" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Subsistema es campo obligatorio"))
+	}
+	if req.Nivel == "" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Nivel es campo obligatorio"))
+	}
+	if err := logs.CambiarNivel(req.Subsistema, req.Nivel); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta(err.Error()))
+	}
+	logs.L(logs.App).InfoContext(c.Request().Context(), "nivel de log modificado", "subsistemaModificado", req.Subsistema, "nivel", req.Nivel)
+	return c.JSON(http.StatusOK, map[string]string{"Mensaje": "OK"})
+}
@@ -2,9 +2,9 @@ package controllers
 
 import (
 	"MSTransaccionesFinancieras/internal/gestores"
+	"MSTransaccionesFinancieras/internal/infra/logs"
 	"MSTransaccionesFinancieras/internal/models"
 	"MSTransaccionesFinancieras/internal/utils"
-	"log"
 	"net/http"
 	"time"
 
@@ -32,7 +32,7 @@ func (mc *MonedasControlador) Dame(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("IdMoneda es campo obligatorio"))
 	}
 	param := &models.Monedas{IdMoneda: req.IdMoneda}
-	mensaje, err := param.Dame()
+	mensaje, err := mc.Gestor.Dame(c.Request().Context(), param)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al obtener moneda: "+utils.SanitizarError(err)))
 	}
@@ -55,7 +55,7 @@ func (mc *MonedasControlador) Listar(c echo.Context) error {
 	} else if req.IncluyeInactivos != "N" && req.IncluyeInactivos != "S" {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("IncluyeInactivos debe ser 'S' o 'N'"))
 	}
-	monedas, err := mc.Gestor.Listar(req.IncluyeInactivos)
+	monedas, err := mc.Gestor.Listar(c.Request().Context(), req.IncluyeInactivos)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al buscar monedas: "+utils.SanitizarError(err)))
 	}
@@ -76,7 +76,7 @@ func (mc *MonedasControlador) Crear(c echo.Context) error {
 	// crea la moneda (estado P), crea la cuenta empresa en TB y activa la moneda (estado A)
 	ctx := c.Request().Context()
 	mensaje, err := mc.Gestor.Crear(ctx, models.Monedas{IdMoneda: req.IdMoneda, IdCuentaEmpresa: utils.ConcatenarIDString(uint64(req.IdMoneda), uint64(0))})
-	//log.Printf("\n\nMonedasControlador.Crear: Resultado de creación en GestorMonedas: mensaje='%s', error='%v'", mensaje, err)
+	logs.L(logs.HTTP).DebugContext(ctx, "Crear moneda: resultado de GestorMonedas.Crear", "IdMoneda", req.IdMoneda, "mensaje", mensaje, logs.Err(err))
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al crear moneda: "+utils.SanitizarError(err)))
 	}
@@ -85,28 +85,21 @@ func (mc *MonedasControlador) Crear(c echo.Context) error {
 	}
 
 	// intenta crear la cuenta empresa en TB, si falla, borra la moneda creada
-	mensaje, _, err = mc.GestorCuentas.Crear(models.Cuentas{IdMoneda: uint32(req.IdMoneda), IdUsuarioFinal: 0, Fecha: time.Now().Format("2006-01-02")})
+	mensaje, _, err = mc.GestorCuentas.Crear(ctx, models.Cuentas{IdMoneda: uint32(req.IdMoneda), IdUsuarioFinal: 0, Fecha: time.Now().Format("2006-01-02")})
 	if err != nil {
 		msjBorrar, errBorrar := mc.Gestor.Borrar(ctx, models.Monedas{IdMoneda: req.IdMoneda})
-		if errBorrar != nil {
-			log.Printf("Error en rollback de creación moneda después de fallo en creación de cuenta: %v", errBorrar)
-		}
-		if msjBorrar != "OK" {
-			log.Printf("Error en rollback de creación moneda después de fallo en creación de cuenta: %s", msjBorrar)
+		if errBorrar != nil || msjBorrar != "OK" {
+			logs.L(logs.HTTP).ErrorContext(ctx, "rollback de la moneda fallido tras error al crear la cuenta empresa", "IdMoneda", req.IdMoneda, "mensaje", msjBorrar, logs.Err(errBorrar))
 		}
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al crear cuenta empresa: "+utils.SanitizarError(err)))
 	}
 
 	// si se creó la cuenta en TB, intenta activar la moneda, si falla, borra la moneda pero no la cuenta empresa (TB no permite borrado)
-	moneda := &models.Monedas{IdMoneda: req.IdMoneda}
-	mensaje, err = moneda.Activar(ctx)
+	mensaje, err = mc.Gestor.Activar(ctx, models.Monedas{IdMoneda: req.IdMoneda})
 	if err != nil || mensaje != "OK" {
 		msjBorrar, errBorrar := mc.Gestor.Borrar(ctx, models.Monedas{IdMoneda: req.IdMoneda})
-		if errBorrar != nil {
-			log.Printf("Error en rollback de creación moneda después de fallo en activación de moneda: %v", errBorrar)
-		}
-		if msjBorrar != "OK" {
-			log.Printf("Error en rollback de creación moneda después de fallo en activación de moneda: %s", msjBorrar)
+		if errBorrar != nil || msjBorrar != "OK" {
+			logs.L(logs.HTTP).ErrorContext(ctx, "rollback de la moneda fallido tras error al activarla", "IdMoneda", req.IdMoneda, "mensaje", msjBorrar, logs.Err(errBorrar))
 		}
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al activar moneda: "+utils.SanitizarError(err)))
@@ -131,7 +124,7 @@ func (mc *MonedasControlador) Borrar(c echo.Context) error {
 
 	// Verificar que la moneda exista y obtener su IdCuentaEmpresa
 	moneda := &models.Monedas{IdMoneda: req.IdMoneda}
-	mensaje, err := moneda.Dame()
+	mensaje, err := mc.Gestor.Dame(c.Request().Context(), moneda)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al obtener moneda: "+utils.SanitizarError(err)))
 	}
@@ -140,7 +133,7 @@ func (mc *MonedasControlador) Borrar(c echo.Context) error {
 	}
 
 	// Verificar que no existan cuentas de usuario en esta moneda en TigerBeetle
-	cuentas, err := mc.GestorCuentas.BuscarAvanzado(nil, 0, uint32(req.IdMoneda), "", 2)
+	cuentas, err := mc.GestorCuentas.BuscarAvanzado(c.Request().Context(), nil, 0, uint32(req.IdMoneda), "", 2)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al verificar cuentas: "+utils.SanitizarError(err)))
 	}
@@ -175,8 +168,7 @@ func (mc *MonedasControlador) Activar(c echo.Context) error {
 	if req.IdMoneda <= 0 {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("IdMoneda es campo obligatorio"))
 	}
-	moneda := &models.Monedas{IdMoneda: req.IdMoneda}
-	mensaje, err := moneda.Activar(c.Request().Context())
+	mensaje, err := mc.Gestor.Activar(c.Request().Context(), models.Monedas{IdMoneda: req.IdMoneda})
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al activar moneda: "+utils.SanitizarError(err)))
 	}
@@ -197,8 +189,7 @@ func (mc *MonedasControlador) Desactivar(c echo.Context) error {
 	if req.IdMoneda <= 0 {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("IdMoneda es campo obligatorio"))
 	}
-	moneda := &models.Monedas{IdMoneda: req.IdMoneda}
-	mensaje, err := moneda.Desactivar(c.Request().Context())
+	mensaje, err := mc.Gestor.Desactivar(c.Request().Context(), models.Monedas{IdMoneda: req.IdMoneda})
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al desactivar moneda: "+utils.SanitizarError(err)))
 	}
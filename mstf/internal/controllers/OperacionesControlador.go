@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"MSTransaccionesFinancieras/internal/auditoria"
+	"MSTransaccionesFinancieras/internal/gestores"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"MSTransaccionesFinancieras/internal/utils"
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type OperacionesControlador struct {
+	Gestor *gestores.GestorOperaciones
+}
+
+func NewOperacionesControlador(ga *gestores.GestorOperaciones) *OperacionesControlador {
+	return &OperacionesControlador{Gestor: ga}
+}
+
+// Busca las operaciones auditadas. Con Formato=csv (o Accept: text/csv) las exporta como archivo CSV.
+func (oc *OperacionesControlador) Buscar(c echo.Context) error {
+	filtro := repositorios.FiltroOperaciones{
+		TipoOperacion: c.QueryParam("TipoOperacion"),
+		Entidad:       c.QueryParam("Entidad"),
+		IdEntidad:     c.QueryParam("IdEntidad"),
+	}
+
+	if s := c.QueryParam("IdUsuario"); s != "" {
+		parsed, err := strconv.Atoi(s)
+		if err != nil || parsed <= 0 {
+			return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("IdUsuario debe ser un número válido"))
+		}
+		filtro.IdUsuario = parsed
+	}
+
+	if s := c.QueryParam("FechaInicio"); s != "" {
+		ts, err := utils.FechaATimestampNS(s)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("FechaInicio: "+err.Error()))
+		}
+		filtro.FechaInicio = time.Unix(0, int64(ts))
+	}
+
+	if s := c.QueryParam("FechaFin"); s != "" {
+		ts, err := utils.FechaATimestampNS(s)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("FechaFin: "+err.Error()))
+		}
+		filtro.FechaFin = time.Unix(0, int64(ts))
+	}
+
+	if s := c.QueryParam("Limite"); s != "" {
+		parsed, err := strconv.Atoi(s)
+		if err != nil || parsed <= 0 {
+			return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Limite debe ser un número mayor a cero"))
+		}
+		filtro.Limite = parsed
+	}
+
+	formato := strings.ToLower(c.QueryParam("Formato"))
+	if formato == "" && strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/csv") {
+		formato = "csv"
+	}
+	if formato != "" && formato != "csv" && formato != "json" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Formato debe ser json o csv"))
+	}
+
+	mensaje, operaciones, err := oc.Gestor.Buscar(c.Request().Context(), filtro)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al buscar operaciones: "+utils.SanitizarError(err)))
+	}
+	if mensaje != "OK" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta(mensaje))
+	}
+	if formato != "csv" {
+		return c.JSON(http.StatusOK, operaciones)
+	}
+	return exportarOperacionesCSV(c, operaciones)
+}
+
+// Recorre la cadena de hashes de las operaciones y la compara con los anclajes del archivo configurado.
+// Responde 200 con el resultado aunque la cadena no esté íntegra (Integra false e Incidencias).
+func (oc *OperacionesControlador) Verificar(c echo.Context) error {
+	anclajes, err := auditoria.Anclajes()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al leer los anclajes de auditoría: "+utils.SanitizarError(err)))
+	}
+	verificacion, err := oc.Gestor.Verificar(c.Request().Context(), anclajes, auditoria.ClavePublica())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al verificar las operaciones: "+utils.SanitizarError(err)))
+	}
+	return c.JSON(http.StatusOK, verificacion)
+}
+
+// Escribe las operaciones como CSV (una fila por operación, Detalles como JSON)
+func exportarOperacionesCSV(c echo.Context, operaciones []models.Operaciones) error {
+	respuesta := c.Response()
+	respuesta.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	respuesta.Header().Set(echo.HeaderContentDisposition, `attachment; filename="operaciones-`+time.Now().Format("20060102-150405")+`.csv"`)
+	respuesta.WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(respuesta)
+	if err := w.Write([]string{"IdOperacion", "IdUsuario", "TipoOperacion", "FechaOperacion", "Detalles", "Hash"}); err != nil {
+		return err
+	}
+	for _, op := range operaciones {
+		idUsuario := ""
+		if op.IdUsuario != nil {
+			idUsuario = strconv.Itoa(*op.IdUsuario)
+		}
+		fila := []string{
+			strconv.Itoa(op.IdOperacion),
+			idUsuario,
+			op.TipoOperacion,
+			op.FechaOperacion.Format(time.RFC3339),
+			string(op.Detalles),
+			op.Hash,
+		}
+		for i := range fila {
+			fila[i] = neutralizarCeldaCSV(fila[i])
+		}
+		if err := w.Write(fila); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// Una planilla interpreta como fórmula la celda que empieza con =, +, -, @, tab o CR (inyección CSV):
+// se antepone ' para que se muestre como texto
+func neutralizarCeldaCSV(celda string) string {
+	if celda != "" && strings.ContainsRune("=+-@\t\r", rune(celda[0])) {
+		return "'" + celda
+	}
+	return celda
+}
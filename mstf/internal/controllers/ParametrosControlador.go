@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"MSTransaccionesFinancieras/internal/gestores"
 	"MSTransaccionesFinancieras/internal/models"
 	"MSTransaccionesFinancieras/internal/utils"
 	"net/http"
@@ -9,10 +10,11 @@ import (
 )
 
 type ParametrosControlador struct {
+	Gestor *gestores.GestorParametros
 }
 
-func NewParametrosControlador() *ParametrosControlador {
-	return &ParametrosControlador{}
+func NewParametrosControlador(gp *gestores.GestorParametros) *ParametrosControlador {
+	return &ParametrosControlador{Gestor: gp}
 }
 
 func (pc *ParametrosControlador) Dame(c echo.Context) error {
@@ -27,7 +29,7 @@ func (pc *ParametrosControlador) Dame(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetro es campo obligatorio"))
 	}
 	param := &models.Parametros{Parametro: req.Parametro}
-	mensaje, err := param.Dame()
+	mensaje, err := pc.Gestor.Dame(c.Request().Context(), param)
 	if mensaje != "OK" {
 		return c.JSON(http.StatusNotFound, models.NewErrorRespuesta(mensaje))
 	}
@@ -53,8 +55,7 @@ func (pc *ParametrosControlador) Modificar(c echo.Context) error {
 	if req.Valor == "" {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Valor es campo obligatorio"))
 	}
-	param := &models.Parametros{Parametro: req.Parametro}
-	mensaje, err := param.ModificarParametro(c.Request().Context(), req.Valor)
+	mensaje, err := pc.Gestor.Modificar(c.Request().Context(), models.Parametros{Parametro: req.Parametro}, req.Valor)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al modificar parámetro: "+utils.SanitizarError(err)))
 	}
@@ -72,8 +73,7 @@ func (pc *ParametrosControlador) Buscar(c echo.Context) error {
 	if err := c.Bind(req); err != nil {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
 	}
-	param := &models.Parametros{}
-	parametros, err := param.BuscarParametros(req.Cadena)
+	parametros, err := pc.Gestor.Buscar(c.Request().Context(), req.Cadena)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al buscar parámetros: "+utils.SanitizarError(err)))
 	}
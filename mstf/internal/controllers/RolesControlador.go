@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"MSTransaccionesFinancieras/internal/gestores"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/utils"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type RolesControlador struct {
+	Gestor *gestores.GestorRoles
+}
+
+func NewRolesControlador(gr *gestores.GestorRoles) *RolesControlador {
+	return &RolesControlador{Gestor: gr}
+}
+
+func (rc *RolesControlador) Dame(c echo.Context) error {
+	type Request struct {
+		Rol string `param:"Rol"`
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	rol := &models.Roles{Rol: req.Rol}
+	mensaje, err := rc.Gestor.Dame(c.Request().Context(), rol)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al obtener rol: "+utils.SanitizarError(err)))
+	}
+	if mensaje != "OK" {
+		return c.JSON(http.StatusNotFound, models.NewErrorRespuesta(mensaje))
+	}
+	return c.JSON(http.StatusOK, rol)
+}
+
+func (rc *RolesControlador) Listar(c echo.Context) error {
+	roles, err := rc.Gestor.Listar(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al listar roles: "+utils.SanitizarError(err)))
+	}
+	return c.JSON(http.StatusOK, roles)
+}
+
+func (rc *RolesControlador) Permisos(c echo.Context) error {
+	permisos, err := rc.Gestor.ListarPermisos(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al listar permisos: "+utils.SanitizarError(err)))
+	}
+	return c.JSON(http.StatusOK, permisos)
+}
+
+func (rc *RolesControlador) Crear(c echo.Context) error {
+	type Request struct {
+		Rol      string   `json:"Rol"`
+		Nombre   string   `json:"Nombre"`
+		Permisos []string `json:"Permisos"`
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	if req.Rol == "" || req.Nombre == "" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Rol y Nombre son campos obligatorios"))
+	}
+	mensaje, err := rc.Gestor.Crear(c.Request().Context(), models.Roles{Rol: req.Rol, Nombre: req.Nombre, Permisos: req.Permisos})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al crear rol: "+utils.SanitizarError(err)))
+	}
+	if mensaje != "OK" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta(mensaje))
+	}
+	return c.JSON(http.StatusCreated, map[string]string{"Mensaje": mensaje})
+}
+
+func (rc *RolesControlador) Modificar(c echo.Context) error {
+	type Request struct {
+		Rol      string   `param:"Rol"`
+		Nombre   string   `json:"Nombre"`
+		Permisos []string `json:"Permisos"`
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	if req.Nombre == "" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Nombre es campo obligatorio"))
+	}
+	mensaje, err := rc.Gestor.Modificar(c.Request().Context(), models.Roles{Rol: req.Rol, Nombre: req.Nombre, Permisos: req.Permisos})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al modificar rol: "+utils.SanitizarError(err)))
+	}
+	if mensaje != "OK" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta(mensaje))
+	}
+	return c.JSON(http.StatusOK, map[string]string{"Mensaje": mensaje})
+}
+
+func (rc *RolesControlador) Borrar(c echo.Context) error {
+	type Request struct {
+		Rol string `param:"Rol"`
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	mensaje, err := rc.Gestor.Borrar(c.Request().Context(), models.Roles{Rol: req.Rol})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al borrar rol: "+utils.SanitizarError(err)))
+	}
+	if mensaje != "OK" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta(mensaje))
+	}
+	return c.JSON(http.StatusOK, map[string]string{"Mensaje": mensaje})
+}
+
+func (rc *RolesControlador) AsignarUsuario(c echo.Context) error {
+	type Request struct {
+		IdUsuario int    `param:"IdUsuario"`
+		Rol       string `json:"Rol"`
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	if req.IdUsuario <= 0 || req.Rol == "" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("IdUsuario y Rol son campos obligatorios"))
+	}
+	mensaje, err := rc.Gestor.AsignarUsuario(c.Request().Context(), models.Usuarios{IdUsuario: req.IdUsuario, Rol: req.Rol})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al asignar rol: "+utils.SanitizarError(err)))
+	}
+	if mensaje != "OK" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta(mensaje))
+	}
+	return c.JSON(http.StatusOK, map[string]string{"Mensaje": mensaje})
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"MSTransaccionesFinancieras/internal/salud"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type SaludControlador struct {
+	parametros repositorios.Parametros
+}
+
+func NewSaludControlador(parametros repositorios.Parametros) *SaludControlador {
+	return &SaludControlador{parametros: parametros}
+}
+
+// Liveness: el proceso responde. No verifica dependencias para que una caída externa no reinicie el MS.
+func (sc *SaludControlador) Live(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"Estado": salud.EstadoOK})
+}
+
+// Readiness: estado de cada dependencia. Responde 503 si alguna dependencia crítica falla,
+// si no terminó la inicialización de cuentas empresa o si el consumidor está trabado reintentando.
+func (sc *SaludControlador) Ready(c echo.Context) error {
+	reporte := salud.Verificar(c.Request().Context(), sc.parametros)
+	if reporte.Estado != salud.EstadoOK {
+		return c.JSON(http.StatusServiceUnavailable, reporte)
+	}
+	return c.JSON(http.StatusOK, reporte)
+}
@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"MSTransaccionesFinancieras/internal/gestores"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/utils"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+type SegundoFactorControlador struct {
+	Gestor *gestores.GestorSegundoFactor
+}
+
+func NewSegundoFactorControlador(gf *gestores.GestorSegundoFactor) *SegundoFactorControlador {
+	return &SegundoFactorControlador{Gestor: gf}
+}
+
+// Inscripción opcional desde la sesión
+func (fc *SegundoFactorControlador) Inscribir(c echo.Context) error {
+	return fc.inscribir(c, "")
+}
+
+// Inscripción exigida por el rol, desde el desafío del login (ruta pública)
+func (fc *SegundoFactorControlador) InscribirDesafio(c echo.Context) error {
+	type Request struct {
+		TokenDesafio string `json:"TokenDesafio"`
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	if req.TokenDesafio == "" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("TokenDesafio es campo obligatorio"))
+	}
+	return fc.inscribir(c, req.TokenDesafio)
+}
+
+func (fc *SegundoFactorControlador) inscribir(c echo.Context, TokenDesafio string) error {
+	mensaje, secreto, uri, err := fc.Gestor.Inscribir(c.Request().Context(), TokenDesafio)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al inscribir segundo factor: "+utils.SanitizarError(err)))
+	}
+	if mensaje != "OK" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta(mensaje))
+	}
+	return c.JSON(http.StatusOK, map[string]string{"Mensaje": mensaje, "Secreto": secreto, "URI": uri})
+}
+
+func (fc *SegundoFactorControlador) Activar(c echo.Context) error {
+	type Request struct {
+		Codigo string `json:"Codigo"`
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	if strings.TrimSpace(req.Codigo) == "" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Codigo es campo obligatorio"))
+	}
+	mensaje, codigos, err := fc.Gestor.Activar(c.Request().Context(), req.Codigo)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al activar segundo factor: "+utils.SanitizarError(err)))
+	}
+	if mensaje != "OK" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta(mensaje))
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"Mensaje": mensaje, "CodigosRecuperacion": codigos})
+}
+
+// Segundo paso del login (ruta pública): crea la sesión si el código es válido
+func (fc *SegundoFactorControlador) CompletarLogin(c echo.Context) error {
+	type Request struct {
+		TokenDesafio string `json:"TokenDesafio"`
+		Codigo       string `json:"Codigo"`
+		Dispositivo  string `json:"Dispositivo"`
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	if req.TokenDesafio == "" || strings.TrimSpace(req.Codigo) == "" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("TokenDesafio y Codigo son campos obligatorios"))
+	}
+	// Sin Dispositivo informado, la sesión se identifica por el User-Agent
+	if req.Dispositivo == "" {
+		req.Dispositivo = c.Request().UserAgent()
+	}
+	usuario := &models.Usuarios{}
+	sesion := &models.Sesiones{Dispositivo: truncar(req.Dispositivo, 255), IP: c.RealIP()}
+	mensaje, codigos, err := fc.Gestor.CompletarLogin(c.Request().Context(), req.TokenDesafio, req.Codigo, usuario, sesion)
+	if bloqueado, err := responderBloqueoLogin(c, err); bloqueado {
+		return err
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al iniciar sesión: "+utils.SanitizarError(err)))
+	}
+	if mensaje != "OK" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta(mensaje))
+	}
+	respuesta := map[string]interface{}{
+		"Mensaje":              mensaje,
+		"TokenSesion":          sesion.TokenSesion,
+		"RefreshToken":         sesion.RefreshToken,
+		"IdSesion":             sesion.IdSesion,
+		"FechaExpiracionToken": sesion.FechaExpiracionToken,
+		"FechaExpiracion":      sesion.FechaExpiracion,
+		"Rol":                  usuario.Rol,
+		"Permisos":             usuario.Permisos,
+	}
+	// Solo al completar una inscripción
+	if codigos != nil {
+		respuesta["CodigosRecuperacion"] = codigos
+	}
+	return c.JSON(http.StatusOK, respuesta)
+}
+
+func (fc *SegundoFactorControlador) Restablecer(c echo.Context) error {
+	type Request struct {
+		IdUsuario int `param:"IdUsuario"`
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	if req.IdUsuario <= 0 {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("IdUsuario es campo obligatorio"))
+	}
+	mensaje, err := fc.Gestor.Restablecer(c.Request().Context(), models.Usuarios{IdUsuario: req.IdUsuario})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al restablecer segundo factor: "+utils.SanitizarError(err)))
+	}
+	if mensaje != "OK" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta(mensaje))
+	}
+	return c.JSON(http.StatusOK, map[string]string{"Mensaje": mensaje})
+}
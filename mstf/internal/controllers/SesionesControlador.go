@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"MSTransaccionesFinancieras/internal/gestores"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/utils"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type SesionesControlador struct {
+	Gestor *gestores.GestorSesiones
+}
+
+func NewSesionesControlador(gs *gestores.GestorSesiones) *SesionesControlador {
+	return &SesionesControlador{Gestor: gs}
+}
+
+// Esta ruta se omite del middleware de auth: el refresh token es la credencial
+func (sc *SesionesControlador) Renovar(c echo.Context) error {
+	type Request struct {
+		RefreshToken string `json:"RefreshToken"`
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	if req.RefreshToken == "" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("RefreshToken es campo obligatorio"))
+	}
+	sesion := &models.Sesiones{}
+	mensaje, err := sc.Gestor.Renovar(c.Request().Context(), req.RefreshToken, sesion)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al renovar sesión: "+utils.SanitizarError(err)))
+	}
+	if mensaje != "OK" {
+		return c.JSON(http.StatusUnauthorized, models.NewErrorRespuesta(mensaje))
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"Mensaje":              mensaje,
+		"TokenSesion":          sesion.TokenSesion,
+		"RefreshToken":         sesion.RefreshToken,
+		"IdSesion":             sesion.IdSesion,
+		"FechaExpiracionToken": sesion.FechaExpiracionToken,
+		"FechaExpiracion":      sesion.FechaExpiracion,
+	})
+}
+
+func (sc *SesionesControlador) Listar(c echo.Context) error {
+	sesiones, err := sc.Gestor.Listar(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al listar sesiones: "+utils.SanitizarError(err)))
+	}
+	return c.JSON(http.StatusOK, sesiones)
+}
+
+func (sc *SesionesControlador) Revocar(c echo.Context) error {
+	type Request struct {
+		IdSesion int `param:"IdSesion"`
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	if req.IdSesion <= 0 {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("IdSesion es campo obligatorio"))
+	}
+	mensaje, err := sc.Gestor.Revocar(c.Request().Context(), req.IdSesion)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al revocar sesión: "+utils.SanitizarError(err)))
+	}
+	if mensaje != "OK" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta(mensaje))
+	}
+	return c.JSON(http.StatusOK, map[string]string{"Mensaje": mensaje})
+}
+
+func (sc *SesionesControlador) RevocarUsuario(c echo.Context) error {
+	type Request struct {
+		IdUsuario int `param:"IdUsuario"`
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	if req.IdUsuario <= 0 {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("IdUsuario es campo obligatorio"))
+	}
+	mensaje, err := sc.Gestor.RevocarUsuario(c.Request().Context(), models.Usuarios{IdUsuario: req.IdUsuario})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al revocar sesiones: "+utils.SanitizarError(err)))
+	}
+	if mensaje != "OK" {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta(mensaje))
+	}
+	return c.JSON(http.StatusOK, map[string]string{"Mensaje": mensaje})
+}
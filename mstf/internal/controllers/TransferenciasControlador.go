@@ -3,8 +3,12 @@ package controllers
 import (
 	"MSTransaccionesFinancieras/internal/gestores"
 	kafka "MSTransaccionesFinancieras/internal/infra/kafkamstf"
+	"MSTransaccionesFinancieras/internal/ingesta"
 	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
 	"MSTransaccionesFinancieras/internal/utils"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -13,12 +17,17 @@ import (
 )
 
 type TransferenciasControlador struct {
-	Gestor    *gestores.GestorTransferencias
-	Productor *kafka.ProductorKafka
+	Gestor     *gestores.GestorTransferencias
+	Productor  *kafka.ProductorKafka
+	FuenteHTTP *ingesta.FuenteHTTP
+	parametros repositorios.Parametros
 }
 
-func NewTransferenciasControlador(gt *gestores.GestorTransferencias, pr *kafka.ProductorKafka) *TransferenciasControlador {
-	return &TransferenciasControlador{Gestor: gt, Productor: pr}
+// Máximo de transferencias por request en el endpoint de lote síncrono
+const maxTransferenciasLote = 10000
+
+func NewTransferenciasControlador(gt *gestores.GestorTransferencias, pr *kafka.ProductorKafka, fh *ingesta.FuenteHTTP, parametros repositorios.Parametros) *TransferenciasControlador {
+	return &TransferenciasControlador{Gestor: gt, Productor: pr, FuenteHTTP: fh, parametros: parametros}
 }
 func (tc *TransferenciasControlador) Dame(c echo.Context) error {
 	type Request struct {
@@ -35,7 +44,7 @@ func (tc *TransferenciasControlador) Dame(c echo.Context) error {
 	}
 
 	transferencia := &models.Transferencias{IdTransferencia: req.IdTransferencia}
-	if err := transferencia.Dame(); err != nil {
+	if err := tc.Gestor.Dame(c.Request().Context(), transferencia); err != nil {
 		return c.JSON(http.StatusNotFound, models.NewErrorRespuesta("Transferencia no encontrada"))
 	}
 	return c.JSON(http.StatusOK, transferencia)
@@ -77,6 +86,92 @@ func (tc *TransferenciasControlador) Crear(c echo.Context) error {
 	})
 }
 
+// Procesa una transferencia de forma síncrona (sin pasar por Kafka) y responde con su resultado final,
+// el mismo que se notifica en el webhook. Una transferencia rechazada se informa con Estado E.
+// Las requests concurrentes se agrupan en un mismo batch de TB.
+func (tc *TransferenciasControlador) CrearSincronica(c echo.Context) error {
+	var transferencia json.RawMessage
+	if err := json.NewDecoder(c.Request().Body).Decode(&transferencia); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("JSON inválido: "+utils.SanitizarError(err)))
+	}
+	if len(transferencia) == 0 || transferencia[0] != '{' {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Se espera una transferencia; para varias usar /transferencias/lote"))
+	}
+
+	resultados, codigo, err := tc.procesarSincronico(c, [][]byte{transferencia})
+	if err != nil {
+		return c.JSON(codigo, models.NewErrorRespuesta(err.Error()))
+	}
+	return c.JSON(http.StatusOK, resultados[0])
+}
+
+// Procesa un lote de transferencias de forma síncrona y responde con el resultado de cada una,
+// en el mismo orden en que se recibieron.
+func (tc *TransferenciasControlador) CrearLote(c echo.Context) error {
+	var transferencias []json.RawMessage
+	if err := json.NewDecoder(c.Request().Body).Decode(&transferencias); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("JSON inválido, se espera un array de transferencias: "+utils.SanitizarError(err)))
+	}
+	if len(transferencias) == 0 {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("El lote no puede estar vacío"))
+	}
+	if len(transferencias) > maxTransferenciasLote {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("El lote supera el máximo de "+strconv.Itoa(maxTransferenciasLote)+" transferencias"))
+	}
+
+	valores := make([][]byte, len(transferencias))
+	for i, t := range transferencias {
+		valores[i] = t
+	}
+	resultados, codigo, err := tc.procesarSincronico(c, valores)
+	if err != nil {
+		return c.JSON(codigo, models.NewErrorRespuesta(err.Error()))
+	}
+	return c.JSON(http.StatusOK, models.LoteNotificado{
+		CantidadProcesada: len(resultados),
+		Transferencias:    resultados,
+	})
+}
+
+func (tc *TransferenciasControlador) procesarSincronico(c echo.Context, valores [][]byte) ([]models.TransferenciaNotificada, int, error) {
+	resultados, err := tc.FuenteHTTP.Recibir(c.Request().Context(), valores)
+	if errors.Is(err, ingesta.ErrFuenteCerrada) {
+		return nil, http.StatusServiceUnavailable, err
+	}
+	if err != nil {
+		// se puede reenviar completo: las ya registradas se informan como "OK - Reintento"
+		return nil, http.StatusServiceUnavailable, errors.New("Error al procesar, puede reenviarse: " + utils.SanitizarError(err))
+	}
+	return resultados, http.StatusOK, nil
+}
+
+// Último resultado registrado de las transferencias, filtrando por IdTransferencia y/o IdCorrelacion
+func (tc *TransferenciasControlador) Estados(c echo.Context) error {
+	type Request struct {
+		IdTransferencia string `query:"IdTransferencia"`
+		IdCorrelacion   string `query:"IdCorrelacion"`
+		Limite          int    `query:"Limite"`
+	}
+	req := &Request{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
+	}
+	if req.Limite == 0 {
+		req.Limite = 100
+	}
+	if req.Limite < 0 || req.Limite > 1000 {
+		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Limite debe estar entre 1 y 1000"))
+	}
+	estados, err := tc.Gestor.Estados.Buscar(c.Request().Context(), req.IdTransferencia, req.IdCorrelacion, req.Limite)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al buscar estados de transferencias: "+utils.SanitizarError(err)))
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"Total":   len(estados),
+		"Estados": estados,
+	})
+}
+
 func (tc *TransferenciasControlador) Buscar(c echo.Context) error {
 	// IdsTransferencia: array de IDs - si se recibe, camino directo LookupTransfers.
 	idsStr := c.QueryParams()["IdsTransferencia"]
@@ -170,7 +265,7 @@ func (tc *TransferenciasControlador) Buscar(c echo.Context) error {
 
 	pLimite := &models.Parametros{Parametro: "LIMITEBUSCARTRANSFERENCIAS"}
 	var limite uint32 = 100
-	if _, err := pLimite.Dame(); err == nil {
+	if _, err := tc.parametros.Dame(c.Request().Context(), pLimite); err == nil {
 		if val, err := strconv.ParseUint(pLimite.Valor, 10, 32); err == nil {
 			limite = uint32(val)
 		}
@@ -189,7 +284,7 @@ func (tc *TransferenciasControlador) Buscar(c echo.Context) error {
 		limite = uint32(parsed)
 	}
 
-	respuesta, err := tc.Gestor.BuscarAvanzado(idsTransferencia, idUsuarioFinal, idCategoria, idMoneda, incluyeRevertidas, montoMin, montoMax, timestampMin, timestampMax, limite)
+	respuesta, err := tc.Gestor.BuscarAvanzado(c.Request().Context(), idsTransferencia, idUsuarioFinal, idCategoria, idMoneda, incluyeRevertidas, montoMin, montoMax, timestampMin, timestampMax, limite)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al buscar transferencias: "+utils.SanitizarError(err)))
 	}
@@ -6,7 +6,9 @@ import (
 	"MSTransaccionesFinancieras/internal/models"
 	"MSTransaccionesFinancieras/internal/utils"
 	"context"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/labstack/echo/v4"
@@ -56,7 +58,7 @@ func (uc *UsuariosControlador) Buscar(c echo.Context) error {
 	} else if req.IncluyeInactivos != "S" && req.IncluyeInactivos != "N" {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("IncluyeInactivos debe ser 'S' o 'N'"))
 	}
-	usuarios, err := uc.Gestor.Buscar(req.Cadena, req.IncluyeInactivos)
+	usuarios, err := uc.Gestor.Buscar(c.Request().Context(), req.Cadena, req.IncluyeInactivos)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al buscar usuarios: "+utils.SanitizarError(err)))
 	}
@@ -91,18 +93,16 @@ func (uc *UsuariosControlador) ModificarPassword(c echo.Context) error {
 	if err := c.Bind(req); err != nil {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Parámetros inválidos: "+utils.SanitizarError(err)))
 	}
-	//log.Printf("\n\n\n  Request: %+v\n\n\n", req)
 	if strings.TrimSpace(req.PasswordAnterior) == "" || strings.TrimSpace(req.PasswordNuevo) == "" || strings.TrimSpace(req.ConfirmarPassword) == "" {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("PasswordAnterior, PasswordNuevo y ConfirmarPassword son campos obligatorios"))
 	}
-	if err := utils.ValidarFormatoPassword(req.PasswordNuevo); err != nil {
-		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Formato de contraseña inválido: "+utils.SanitizarError(err)))
-	}
 	if req.PasswordNuevo != req.ConfirmarPassword {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("La confirmación de la nueva contraseña no coincide"))
 	}
-	u := models.Usuarios{}
-	mensaje, err := u.ModificarPassword(c.Request().Context(), utils.MD5Hash(req.PasswordAnterior), utils.MD5Hash(req.PasswordNuevo), utils.MD5Hash(req.ConfirmarPassword))
+	mensaje, err := uc.Gestor.ModificarPassword(c.Request().Context(), req.PasswordAnterior, req.PasswordNuevo, c.RealIP())
+	if bloqueado, err := responderBloqueoLogin(c, err); bloqueado {
+		return err
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al modificar contraseña: "+utils.SanitizarError(err)))
 	}
@@ -123,15 +123,15 @@ func (uc *UsuariosControlador) ReestablecerPassword(c echo.Context) error {
 	if req.IdUsuario <= 0 {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("IdUsuario es campo obligatorio"))
 	}
-	u := models.Usuarios{IdUsuario: req.IdUsuario}
-	res, err := u.Dame()
+	u := &models.Usuarios{IdUsuario: req.IdUsuario}
+	res, err := uc.Gestor.Dame(c.Request().Context(), u)
 	if res != "OK" {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Error al obtener usuario: "+res))
 	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al obtener usuario: "+utils.SanitizarError(err)))
 	}
-	mensaje, passTemporal, err := u.RestablecerPassword(c.Request().Context())
+	mensaje, passTemporal, err := uc.Gestor.RestablecerPassword(c.Request().Context(), *u)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al restablecer contraseña: "+utils.SanitizarError(err)))
 	}
@@ -153,7 +153,7 @@ func (uc *UsuariosControlador) Dame(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("IdUsuario es campo obligatorio"))
 	}
 	usuario := &models.Usuarios{IdUsuario: req.IdUsuario}
-	mensaje, err := usuario.Dame()
+	mensaje, err := uc.Gestor.Dame(c.Request().Context(), usuario)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al obtener usuario: "+utils.SanitizarError(err)))
 	}
@@ -165,8 +165,9 @@ func (uc *UsuariosControlador) Dame(c echo.Context) error {
 
 func (uc *UsuariosControlador) Login(c echo.Context) error {
 	type Request struct {
-		Usuario  string `json:"Usuario"`
-		Password string `json:"Password"`
+		Usuario     string `json:"Usuario"`
+		Password    string `json:"Password"`
+		Dispositivo string `json:"Dispositivo"`
 	}
 	req := &Request{}
 	if err := c.Bind(req); err != nil {
@@ -175,15 +176,42 @@ func (uc *UsuariosControlador) Login(c echo.Context) error {
 	if req.Usuario == "" || req.Password == "" {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Usuario y Password son campos obligatorios"))
 	}
-	usuario := &models.Usuarios{}
-	mensaje, tokenSesion, err := usuario.Login(req.Usuario, utils.MD5Hash(req.Password))
+	// Sin Dispositivo informado, la sesión se identifica por el User-Agent
+	if req.Dispositivo == "" {
+		req.Dispositivo = c.Request().UserAgent()
+	}
+	usuario := &models.Usuarios{Usuario: req.Usuario}
+	sesion := &models.Sesiones{Dispositivo: truncar(req.Dispositivo, 255), IP: c.RealIP()}
+	desafio := &models.DesafiosLogin{}
+	mensaje, err := uc.Gestor.Login(c.Request().Context(), usuario, req.Password, sesion, desafio)
+	if bloqueado, err := responderBloqueoLogin(c, err); bloqueado {
+		return err
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al iniciar sesión: "+utils.SanitizarError(err)))
 	}
 	if mensaje[:2] != "OK" {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta(mensaje))
 	}
-	return c.JSON(http.StatusOK, map[string]string{"Mensaje": mensaje, "TokenSesion": tokenSesion, "Rol": usuario.Rol})
+	// Con segundo factor la sesión se crea en POST /usuarios/login/segundo-factor
+	if desafio.TokenDesafio != "" {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"Mensaje":         mensaje,
+			"TokenDesafio":    desafio.TokenDesafio,
+			"Inscripcion":     desafio.Inscripcion,
+			"FechaExpiracion": desafio.FechaExpiracion,
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"Mensaje":              mensaje,
+		"TokenSesion":          sesion.TokenSesion,
+		"RefreshToken":         sesion.RefreshToken,
+		"IdSesion":             sesion.IdSesion,
+		"FechaExpiracionToken": sesion.FechaExpiracionToken,
+		"FechaExpiracion":      sesion.FechaExpiracion,
+		"Rol":                  usuario.Rol,
+		"Permisos":             usuario.Permisos,
+	})
 }
 
 func (uc *UsuariosControlador) Activar(c echo.Context) error {
@@ -197,8 +225,7 @@ func (uc *UsuariosControlador) Activar(c echo.Context) error {
 	if req.IdUsuario <= 0 {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("IdUsuario es campo obligatorio"))
 	}
-	usuario := &models.Usuarios{IdUsuario: req.IdUsuario}
-	mensaje, err := usuario.Activar(c.Request().Context())
+	mensaje, err := uc.Gestor.Activar(c.Request().Context(), models.Usuarios{IdUsuario: req.IdUsuario})
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al activar usuario: "+utils.SanitizarError(err)))
 	}
@@ -219,8 +246,7 @@ func (uc *UsuariosControlador) Desactivar(c echo.Context) error {
 	if req.IdUsuario <= 0 {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("IdUsuario es campo obligatorio"))
 	}
-	usuario := &models.Usuarios{IdUsuario: req.IdUsuario}
-	mensaje, err := usuario.Desactivar(c.Request().Context())
+	mensaje, err := uc.Gestor.Desactivar(c.Request().Context(), models.Usuarios{IdUsuario: req.IdUsuario})
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al desactivar usuario: "+utils.SanitizarError(err)))
 	}
@@ -231,8 +257,7 @@ func (uc *UsuariosControlador) Desactivar(c echo.Context) error {
 }
 
 func (uc *UsuariosControlador) Logout(c echo.Context) error {
-	usuario := &models.Usuarios{}
-	mensaje, err := usuario.Logout(c.Request().Context())
+	mensaje, err := uc.Gestor.Logout(c.Request().Context())
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al cerrar sesión: "+utils.SanitizarError(err)))
 	}
@@ -254,9 +279,6 @@ func (uc *UsuariosControlador) ConfirmarUsuario(c echo.Context) error {
 	if req.Password == "" || req.ConfirmarPassword == "" {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Password y ConfirmarPassword son campos obligatorios"))
 	}
-	if err := utils.ValidarFormatoPassword(req.Password); err != nil {
-		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("Formato de contraseña inválido: "+utils.SanitizarError(err)))
-	}
 	if req.Password != req.ConfirmarPassword {
 		return c.JSON(http.StatusBadRequest, models.NewErrorRespuesta("La confirmación de la contraseña no coincide"))
 	}
@@ -267,8 +289,7 @@ func (uc *UsuariosControlador) ConfirmarUsuario(c echo.Context) error {
 		return c.JSON(http.StatusUnauthorized, models.NewErrorRespuesta("Se requiere token de sesión Bearer"))
 	}
 	ctx := context.WithValue(c.Request().Context(), auth.ClaveCredencial, partes[1])
-	usuario := &models.Usuarios{}
-	mensaje, err := usuario.ConfirmarCuenta(ctx, utils.MD5Hash(req.Password), utils.MD5Hash(req.ConfirmarPassword))
+	mensaje, err := uc.Gestor.ConfirmarCuenta(ctx, req.Password)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, models.NewErrorRespuesta("Error al confirmar cuenta del usuario: "+utils.SanitizarError(err)))
 	}
@@ -277,3 +298,21 @@ func (uc *UsuariosControlador) ConfirmarUsuario(c echo.Context) error {
 	}
 	return c.JSON(http.StatusOK, map[string]string{"Mensaje": mensaje})
 }
+
+// Si err es un bloqueo por intentos fallidos responde 429 con Retry-After y devuelve true
+func responderBloqueoLogin(c echo.Context, err error) (bool, error) {
+	var bloqueo *gestores.ErrorBloqueoLogin
+	if !errors.As(err, &bloqueo) {
+		return false, nil
+	}
+	c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(bloqueo.Segundos))
+	return true, c.JSON(http.StatusTooManyRequests, models.NewErrorRespuesta(bloqueo.Error()))
+}
+
+// Primeros n caracteres de s (columnas varchar de largo fijo)
+func truncar(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
@@ -0,0 +1,49 @@
+package correlacion
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+)
+
+// Headers con los que viaja el IdCorrelacion
+const (
+	HeaderHTTP = "X-Correlation-ID"
+	// header alternativo que envían algunos clientes; se acepta si no viene HeaderHTTP
+	HeaderHTTPAlternativo = "X-Request-ID"
+	HeaderKafka           = "mstf-correlacion"
+)
+
+// tipo privado para evitar colisiones con otras claves de context.
+type claveCtx string
+
+const claveCorrelacion claveCtx = "IdCorrelacion"
+
+// IdCorrelacion aceptado de un cliente: hasta 64 caracteres alfanuméricos, '.', '_', ':' o '-'
+var formatoValido = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// Genera un IdCorrelacion nuevo (16 bytes aleatorios en hexadecimal)
+func Nuevo() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Retorna el id recibido si tiene un formato válido, o uno nuevo si no.
+func Normalizar(id string) string {
+	if formatoValido.MatchString(id) {
+		return id
+	}
+	return Nuevo()
+}
+
+func EnContexto(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, claveCorrelacion, id)
+}
+
+// String vacío si el contexto no tiene IdCorrelacion
+func DesdeContexto(ctx context.Context) string {
+	id, _ := ctx.Value(claveCorrelacion).(string)
+	return id
+}
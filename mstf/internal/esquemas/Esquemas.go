@@ -0,0 +1,299 @@
+package esquemas
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/utils"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// Formatos de mensaje, elegidos por el header HeaderFormato del mensaje de Kafka ("" = JSON)
+const (
+	HeaderFormato   = "mstf-formato"
+	FormatoJSON     = "json"
+	FormatoProtobuf = "protobuf"
+	// Versión que entiende el MS; las anteriores se actualizan al decodificar
+	VersionActual = 2
+)
+
+//go:embed transferencia_v1.json
+var esquemaV1 []byte
+
+//go:embed transferencia_v2.json
+var esquemaV2 []byte
+
+var esquemas = compilarEsquemas()
+
+// Pasos de actualización: actualizaciones[v] convierte un mensaje de la versión v a la v+1
+var actualizaciones = map[int]func(map[string]any) (map[string]any, error){
+	1: v1aV2,
+}
+
+// Sobre del mensaje v2
+type sobreV2 struct {
+	Version       int             `json:"Version"`
+	Transferencia transferenciaV2 `json:"Transferencia"`
+}
+
+type transferenciaV2 struct {
+	IdTransferencia string `json:"IdTransferencia"`
+	IdUsuarioFinal  uint64 `json:"IdUsuarioFinal"`
+	Monto           string `json:"Monto,omitempty"`
+	IdMoneda        uint32 `json:"IdMoneda"`
+	Tipo            string `json:"Tipo"`
+	IdCategoria     uint64 `json:"IdCategoria"`
+	Fecha           string `json:"Fecha,omitempty"`
+}
+
+func compilarEsquemas() map[int]*jsonschema.Schema {
+	fuentes := map[int][]byte{1: esquemaV1, 2: esquemaV2}
+	compilados := make(map[int]*jsonschema.Schema, len(fuentes))
+	for version, fuente := range fuentes {
+		doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(fuente))
+		if err != nil {
+			panic(fmt.Sprintf("esquema de transferencia v%d inválido: %v", version, err))
+		}
+		url := fmt.Sprintf("mstf:transferencia/v%d", version)
+		c := jsonschema.NewCompiler()
+		if err := c.AddResource(url, doc); err != nil {
+			panic(fmt.Sprintf("esquema de transferencia v%d inválido: %v", version, err))
+		}
+		compilados[version] = c.MustCompile(url)
+	}
+	return compilados
+}
+
+// Decodifica y valida un mensaje de transferencia en cualquiera de las versiones y formatos soportados,
+// actualizándolo a la versión actual. Si el mensaje es inválido devuelve, además del error, los campos
+// que se hayan podido leer (para notificar el rechazo).
+func Decodificar(valor []byte, formato string) (models.KafkaTransferencias, error) {
+	var doc any
+	var err error
+	switch formato {
+	case "", FormatoJSON:
+		doc, err = jsonschema.UnmarshalJSON(bytes.NewReader(valor))
+		if err != nil {
+			return mejorEsfuerzo(valor), errors.New("Fallo al parsear JSON: " + err.Error())
+		}
+	case FormatoProtobuf:
+		doc, err = decodificarProtobuf(valor)
+		if err != nil {
+			return models.KafkaTransferencias{}, errors.New("Fallo al parsear Protobuf: " + err.Error())
+		}
+	default:
+		return models.KafkaTransferencias{}, fmt.Errorf("Formato de mensaje '%s' no soportado", formato)
+	}
+
+	version, err := versionDe(doc)
+	if err != nil {
+		return mejorEsfuerzoDoc(doc), err
+	}
+	if err := validar(doc, version); err != nil {
+		return mejorEsfuerzoDoc(doc), err
+	}
+	for v := version; v < VersionActual; v++ {
+		obj, _ := doc.(map[string]any)
+		doc, err = actualizaciones[v](obj)
+		if err != nil {
+			return mejorEsfuerzoDoc(doc), fmt.Errorf("No se pudo actualizar el mensaje de v%d a v%d: %v", v, v+1, err)
+		}
+	}
+
+	sobre, err := aSobre(doc)
+	if err != nil {
+		return models.KafkaTransferencias{}, err
+	}
+	return aModelo(sobre.Transferencia)
+}
+
+// Serializa la transferencia como JSON v2
+func CodificarJSON(t models.KafkaTransferencias) ([]byte, error) {
+	return json.Marshal(sobreV2{Version: VersionActual, Transferencia: desdeModelo(t)})
+}
+
+// Extrae la cuenta afectada (IdMoneda, IdUsuarioFinal) sin validar el mensaje.
+func ExtraerCuenta(valor []byte, formato string) (uint32, uint64, bool) {
+	t := models.KafkaTransferencias{}
+	if formato == FormatoProtobuf {
+		doc, err := decodificarProtobuf(valor)
+		if err != nil {
+			return 0, 0, false
+		}
+		t = mejorEsfuerzoDoc(doc)
+	} else {
+		t = mejorEsfuerzo(valor)
+	}
+	return t.IdMoneda, t.IdUsuarioFinal, t.IdUsuarioFinal != 0
+}
+
+// El mensaje sin campo Version es el formato legado (v1)
+func versionDe(doc any) (int, error) {
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		return 0, errors.New("El mensaje debe ser un objeto JSON")
+	}
+	v, ok := obj["Version"]
+	if !ok {
+		return 1, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, errors.New("Version debe ser un número entero")
+	}
+	version, err := strconv.Atoi(n.String())
+	if err != nil || esquemas[version] == nil {
+		return 0, fmt.Errorf("Versión de mensaje %s no soportada", n.String())
+	}
+	return version, nil
+}
+
+// Valida contra el esquema de la versión y arma un error con la ubicación de cada campo inválido
+func validar(doc any, version int) error {
+	err := esquemas[version].Validate(doc)
+	if err == nil {
+		return nil
+	}
+	var errValidacion *jsonschema.ValidationError
+	if !errors.As(err, &errValidacion) {
+		return err
+	}
+	var detalles []string
+	for _, u := range errValidacion.BasicOutput().Errors {
+		if u.Error == nil {
+			continue
+		}
+		ubicacion := u.InstanceLocation
+		if ubicacion == "" {
+			ubicacion = "/"
+		}
+		detalles = append(detalles, ubicacion+": "+u.Error.String())
+	}
+	return fmt.Errorf("Mensaje inválido según el esquema v%d: %s", version, strings.Join(detalles, "; "))
+}
+
+// v2 agrega el sobre con la versión y pasa Monto a string decimal de hasta 2 cifras
+func v1aV2(doc map[string]any) (map[string]any, error) {
+	t := make(map[string]any, len(doc))
+	for k, v := range doc {
+		t[k] = v
+	}
+	if m, ok := doc["Monto"]; ok {
+		n, ok := m.(json.Number)
+		if !ok {
+			return nil, errors.New("Monto debe ser numérico")
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return nil, err
+		}
+		// mismo redondeo que se aplicaba a los mensajes v1 al pasarlos a unidad mínima
+		t["Monto"] = centavosADecimal(utils.MontoDecimalAUnidadMinima(f))
+	}
+	return map[string]any{"Version": json.Number("2"), "Transferencia": t}, nil
+}
+
+func aSobre(doc any) (sobreV2, error) {
+	var sobre sobreV2
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return sobre, err
+	}
+	if err := json.Unmarshal(b, &sobre); err != nil {
+		return sobre, errors.New("Fallo al leer el mensaje v2: " + err.Error())
+	}
+	return sobre, nil
+}
+
+func aModelo(t transferenciaV2) (models.KafkaTransferencias, error) {
+	m := models.KafkaTransferencias{
+		IdTransferencia: t.IdTransferencia,
+		IdUsuarioFinal:  t.IdUsuarioFinal,
+		IdMoneda:        t.IdMoneda,
+		Tipo:            t.Tipo,
+		IdCategoria:     t.IdCategoria,
+		Fecha:           t.Fecha,
+	}
+	if t.Monto != "" {
+		monto, err := strconv.ParseFloat(t.Monto, 64)
+		if err != nil {
+			return m, errors.New("Monto formato incorrecto")
+		}
+		m.Monto = monto
+	}
+	return m, nil
+}
+
+func desdeModelo(m models.KafkaTransferencias) transferenciaV2 {
+	t := transferenciaV2{
+		IdTransferencia: m.IdTransferencia,
+		IdUsuarioFinal:  m.IdUsuarioFinal,
+		IdMoneda:        m.IdMoneda,
+		Tipo:            m.Tipo,
+		IdCategoria:     m.IdCategoria,
+		Fecha:           m.Fecha,
+	}
+	if m.Monto > 0 {
+		t.Monto = centavosADecimal(utils.MontoDecimalAUnidadMinima(m.Monto))
+	}
+	return t
+}
+
+func centavosADecimal(c uint64) string {
+	return fmt.Sprintf("%d.%02d", c/100, c%100)
+}
+
+// Lee los campos que se puedan de un mensaje JSON inválido, en formato v1 o v2
+func mejorEsfuerzo(valor []byte) models.KafkaTransferencias {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(valor))
+	if err != nil {
+		var m models.KafkaTransferencias
+		_ = json.Unmarshal(valor, &m)
+		return m
+	}
+	return mejorEsfuerzoDoc(doc)
+}
+
+func mejorEsfuerzoDoc(doc any) models.KafkaTransferencias {
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		return models.KafkaTransferencias{}
+	}
+	if t, ok := obj["Transferencia"].(map[string]any); ok {
+		obj = t
+	}
+	var m models.KafkaTransferencias
+	if s, ok := obj["IdTransferencia"].(string); ok {
+		m.IdTransferencia = s
+	}
+	if n, ok := obj["IdUsuarioFinal"].(json.Number); ok {
+		m.IdUsuarioFinal, _ = strconv.ParseUint(n.String(), 10, 64)
+	}
+	if n, ok := obj["IdMoneda"].(json.Number); ok {
+		v, _ := strconv.ParseUint(n.String(), 10, 32)
+		m.IdMoneda = uint32(v)
+	}
+	if n, ok := obj["IdCategoria"].(json.Number); ok {
+		m.IdCategoria, _ = strconv.ParseUint(n.String(), 10, 64)
+	}
+	switch v := obj["Monto"].(type) {
+	case json.Number:
+		m.Monto, _ = v.Float64()
+	case string:
+		m.Monto, _ = strconv.ParseFloat(v, 64)
+	}
+	if s, ok := obj["Tipo"].(string); ok {
+		m.Tipo = s
+	}
+	if s, ok := obj["Fecha"].(string); ok {
+		m.Fecha = s
+	}
+	return m
+}
@@ -0,0 +1,214 @@
+package esquemas
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/models"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestDecodificarV1AV2(t *testing.T) {
+	casos := []struct {
+		nombre  string
+		mensaje string
+		monto   float64
+	}{
+		{"monto con decimales", `{"IdTransferencia":"1","IdUsuarioFinal":7,"Monto":15.5,"IdMoneda":1,"Tipo":"I"}`, 15.5},
+		{"monto entero", `{"IdTransferencia":"1","IdUsuarioFinal":7,"Monto":100,"IdMoneda":1,"Tipo":"E"}`, 100},
+		{"monto truncado en 2 decimales", `{"IdTransferencia":"1","IdUsuarioFinal":7,"Monto":15.559,"IdMoneda":1,"Tipo":"I"}`, 15.55},
+		{"reversión sin monto", `{"IdTransferencia":"1","IdUsuarioFinal":7,"IdMoneda":1,"Tipo":"R"}`, 0},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			m, err := Decodificar([]byte(c.mensaje), FormatoJSON)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.IdTransferencia != "1" || m.IdUsuarioFinal != 7 || m.IdMoneda != 1 || m.Monto != c.monto {
+				t.Fatalf("transferencia: %+v", m)
+			}
+		})
+	}
+
+	// el paso de actualización deja Monto como string decimal, que es lo que valida el esquema v2
+	doc, err := v1aV2(map[string]any{"IdTransferencia": "1", "Monto": json.Number("15.5")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transferencia := doc["Transferencia"].(map[string]any)
+	if doc["Version"] != json.Number("2") || transferencia["Monto"] != "15.50" {
+		t.Fatalf("v1aV2: %+v", doc)
+	}
+	if err := validar(doc, 2); err == nil {
+		t.Fatal("el mensaje actualizado tiene los campos obligatorios faltantes y debía ser inválido")
+	} else if strings.Contains(err.Error(), "/Transferencia/Monto") {
+		t.Fatalf("el Monto actualizado no cumple el esquema v2: %v", err)
+	}
+	// un Monto v1 que no es numérico no se actualiza
+	if _, err := v1aV2(map[string]any{"Monto": "15.50"}); err == nil {
+		t.Fatal("v1aV2 aceptó un Monto string")
+	}
+}
+
+// Los mensajes inválidos se rechazan informando la ubicación de cada campo con error
+func TestDecodificarInvalidos(t *testing.T) {
+	casos := []struct {
+		nombre    string
+		mensaje   string
+		ubicacion []string
+	}{
+		{"v1 con Monto string", `{"IdTransferencia":"1","IdUsuarioFinal":7,"Monto":"15.50","IdMoneda":1,"Tipo":"I"}`,
+			[]string{"/Monto"}},
+		{"v1 sin campos obligatorios", `{"IdTransferencia":"1","Monto":10}`,
+			[]string{"/: "}},
+		{"v2 campo desconocido en el sobre", `{"Version":2,"Extra":1,"Transferencia":{"IdTransferencia":"1","IdUsuarioFinal":7,"Monto":"10","IdMoneda":1,"Tipo":"I"}}`,
+			[]string{"/: ", "Extra"}},
+		{"v2 campo desconocido en la transferencia", `{"Version":2,"Transferencia":{"IdTransferencia":"1","IdUsuarioFinal":7,"Monto":"10","IdMoneda":1,"Tipo":"I","Cuenta":3}}`,
+			[]string{"/Transferencia: ", "Cuenta"}},
+		{"v2 Monto numérico", `{"Version":2,"Transferencia":{"IdTransferencia":"1","IdUsuarioFinal":7,"Monto":10,"IdMoneda":1,"Tipo":"I"}}`,
+			[]string{"/Transferencia/Monto"}},
+		{"v2 Monto con 3 decimales", `{"Version":2,"Transferencia":{"IdTransferencia":"1","IdUsuarioFinal":7,"Monto":"10.125","IdMoneda":1,"Tipo":"I"}}`,
+			[]string{"/Transferencia/Monto"}},
+		{"v2 ingreso sin Monto", `{"Version":2,"Transferencia":{"IdTransferencia":"1","IdUsuarioFinal":7,"IdMoneda":1,"Tipo":"I"}}`,
+			[]string{"/Transferencia: ", "Monto"}},
+		{"v2 varios campos inválidos", `{"Version":2,"Transferencia":{"IdTransferencia":"abc","IdUsuarioFinal":0,"Monto":"10","IdMoneda":1,"Tipo":"X","Fecha":"ayer"}}`,
+			[]string{"/Transferencia/IdTransferencia", "/Transferencia/IdUsuarioFinal", "/Transferencia/Tipo", "/Transferencia/Fecha"}},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			m, err := Decodificar([]byte(c.mensaje), FormatoJSON)
+			if err == nil {
+				t.Fatalf("se aceptó el mensaje: %+v", m)
+			}
+			for _, u := range c.ubicacion {
+				if !strings.Contains(err.Error(), u) {
+					t.Fatalf("el error no informa %q: %v", u, err)
+				}
+			}
+			// para notificar el rechazo se devuelven los campos legibles
+			if m.IdTransferencia == "" {
+				t.Fatalf("no se leyó IdTransferencia: %+v", m)
+			}
+		})
+	}
+
+	otros := []struct {
+		nombre  string
+		mensaje string
+		error   string
+	}{
+		{"JSON mal formado", `{"IdTransferencia":"1",`, "Fallo al parsear JSON"},
+		{"no es un objeto", `[1,2]`, "debe ser un objeto"},
+		{"versión no soportada", `{"Version":3,"Transferencia":{}}`, "Versión de mensaje 3 no soportada"},
+		{"versión no numérica", `{"Version":"2","Transferencia":{}}`, "Version debe ser un número entero"},
+	}
+	for _, c := range otros {
+		t.Run(c.nombre, func(t *testing.T) {
+			if _, err := Decodificar([]byte(c.mensaje), FormatoJSON); err == nil || !strings.Contains(err.Error(), c.error) {
+				t.Fatalf("error: %v", err)
+			}
+		})
+	}
+	if _, err := Decodificar([]byte(`{}`), "avro"); err == nil {
+		t.Fatal("se aceptó un formato no soportado")
+	}
+}
+
+func TestProtobufIdaYVuelta(t *testing.T) {
+	casos := []models.KafkaTransferencias{
+		{IdTransferencia: "123456789012345678901234567890123456789", IdUsuarioFinal: 1<<64 - 1, Monto: 15.5, IdMoneda: 1<<32 - 1, Tipo: "I", IdCategoria: 9, Fecha: "2026-01-02T10:00:00Z"},
+		{IdTransferencia: "2", IdUsuarioFinal: 7, Monto: 0.01, IdMoneda: 1, Tipo: "E"},
+		{IdTransferencia: "3", IdUsuarioFinal: 7, IdMoneda: 1, Tipo: "R"},
+	}
+	for _, esperado := range casos {
+		b := CodificarProtobuf(esperado)
+		m, err := Decodificar(b, FormatoProtobuf)
+		if err != nil {
+			t.Fatalf("%s: %v", esperado.IdTransferencia, err)
+		}
+		if m != esperado {
+			t.Fatalf("ida y vuelta: %+v, se esperaba %+v", m, esperado)
+		}
+		// mismo resultado que el JSON v2 equivalente
+		j, err := CodificarJSON(esperado)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mj, err := Decodificar(j, FormatoJSON); err != nil || mj != m {
+			t.Fatalf("JSON: %+v %v", mj, err)
+		}
+		if idMoneda, idUsuarioFinal, ok := ExtraerCuenta(b, FormatoProtobuf); !ok || idMoneda != esperado.IdMoneda || idUsuarioFinal != esperado.IdUsuarioFinal {
+			t.Fatalf("ExtraerCuenta: %d %d %v", idMoneda, idUsuarioFinal, ok)
+		}
+	}
+}
+
+// Ningún prefijo de un mensaje válido se acepta ni hace fallar al decodificador: el último campo (Tipo) es obligatorio
+func TestProtobufTruncado(t *testing.T) {
+	b := CodificarProtobuf(models.KafkaTransferencias{IdTransferencia: "42", IdUsuarioFinal: 300, Monto: 1234.5, IdMoneda: 70000, Tipo: "E"})
+	for i := range len(b) {
+		if m, err := Decodificar(b[:i], FormatoProtobuf); err == nil {
+			t.Fatalf("se aceptó el mensaje truncado a %d bytes: %+v", i, m)
+		}
+		ExtraerCuenta(b[:i], FormatoProtobuf)
+	}
+}
+
+func TestProtobufMalFormado(t *testing.T) {
+	valido := CodificarProtobuf(models.KafkaTransferencias{IdTransferencia: "1", IdUsuarioFinal: 7, Monto: 10, IdMoneda: 1, Tipo: "I"})
+
+	// campo desconocido de cada tipo de dato: se ignora (compatibilidad hacia adelante)
+	desconocidos := valido
+	desconocidos = protowire.AppendTag(desconocidos, 20, protowire.VarintType)
+	desconocidos = protowire.AppendVarint(desconocidos, 5)
+	desconocidos = protowire.AppendTag(desconocidos, 21, protowire.BytesType)
+	desconocidos = protowire.AppendString(desconocidos, "x")
+	desconocidos = protowire.AppendTag(desconocidos, 22, protowire.Fixed64Type)
+	desconocidos = protowire.AppendFixed64(desconocidos, 1)
+	desconocidos = protowire.AppendTag(desconocidos, 23, protowire.Fixed32Type)
+	desconocidos = protowire.AppendFixed32(desconocidos, 1)
+	if m, err := Decodificar(desconocidos, FormatoProtobuf); err != nil || m.IdTransferencia != "1" {
+		t.Fatalf("con campos desconocidos: %+v %v", m, err)
+	}
+
+	casos := []struct {
+		nombre  string
+		mensaje []byte
+		error   string
+	}{
+		{"vacío", nil, "no soportada"},
+		{"campo conocido con otro tipo de dato",
+			append(protowire.AppendTag(append([]byte{}, valido...), campoIdUsuarioFinal, protowire.BytesType), 1, 'x'),
+			"campo 3 con tipo de dato incorrecto"},
+		{"Version con otro tipo de dato",
+			protowire.AppendFixed32(protowire.AppendTag(nil, campoVersion, protowire.Fixed32Type), 2),
+			"campo 1 con tipo de dato incorrecto"},
+		{"largo mayor al mensaje",
+			append(protowire.AppendTag(nil, campoIdTransferencia, protowire.BytesType), 0xff, 0xff, 0x03, '1'),
+			"Fallo al parsear Protobuf"},
+		{"varint sin terminar",
+			append(protowire.AppendTag(nil, campoIdUsuarioFinal, protowire.VarintType), 0xff, 0xff, 0xff),
+			"Fallo al parsear Protobuf"},
+		{"varint de más de 10 bytes",
+			append(protowire.AppendTag(nil, campoIdUsuarioFinal, protowire.VarintType), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01),
+			"Fallo al parsear Protobuf"},
+		{"número de campo 0", []byte{0x00, 0x01}, "Fallo al parsear Protobuf"},
+		{"grupo sin cerrar", protowire.AppendTag(append([]byte{}, valido...), 30, protowire.StartGroupType), "Fallo al parsear Protobuf"},
+		{"cierre de grupo suelto", protowire.AppendTag(append([]byte{}, valido...), 30, protowire.EndGroupType), "Fallo al parsear Protobuf"},
+		{"Monto inválido", CodificarProtobuf(models.KafkaTransferencias{IdTransferencia: "1", IdUsuarioFinal: 7, IdMoneda: 1, Tipo: "I"}), "/Transferencia"},
+		{"Version 1", append(protowire.AppendVarint(protowire.AppendTag(nil, campoVersion, protowire.VarintType), 1), valido[2:]...), "esquema v1"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			if m, err := Decodificar(c.mensaje, FormatoProtobuf); err == nil || !strings.Contains(err.Error(), c.error) {
+				t.Fatalf("error: %v (%+v)", err, m)
+			}
+			if _, _, ok := ExtraerCuenta(c.mensaje, FormatoProtobuf); ok && strings.HasPrefix(c.error, "Fallo") {
+				t.Fatal("ExtraerCuenta leyó la cuenta de un mensaje que no se puede decodificar")
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package esquemas
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"MSTransaccionesFinancieras/internal/models"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Números de campo de mstf.v2.Transferencia (ver transferencia.proto)
+const (
+	campoVersion         protowire.Number = 1
+	campoIdTransferencia protowire.Number = 2
+	campoIdUsuarioFinal  protowire.Number = 3
+	campoMonto           protowire.Number = 4
+	campoIdMoneda        protowire.Number = 5
+	campoTipo            protowire.Number = 6
+	campoIdCategoria     protowire.Number = 7
+	campoFecha           protowire.Number = 8
+)
+
+// Decodifica el mensaje Protobuf al mismo documento que el JSON v2, para validarlo con el mismo esquema.
+// Los campos desconocidos se ignoran (compatibilidad hacia adelante de Protobuf).
+func decodificarProtobuf(b []byte) (any, error) {
+	t := make(map[string]any)
+	version := json.Number("0")
+
+	for len(b) > 0 {
+		num, tipo, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch {
+		case tipo == protowire.VarintType && (num == campoVersion || num == campoIdUsuarioFinal || num == campoIdMoneda || num == campoIdCategoria):
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+			valor := json.Number(strconv.FormatUint(v, 10))
+			switch num {
+			case campoVersion:
+				version = valor
+			case campoIdUsuarioFinal:
+				t["IdUsuarioFinal"] = valor
+			case campoIdMoneda:
+				t["IdMoneda"] = valor
+			case campoIdCategoria:
+				t["IdCategoria"] = valor
+			}
+		case tipo == protowire.BytesType && (num == campoIdTransferencia || num == campoMonto || num == campoTipo || num == campoFecha):
+			v, n := protowire.ConsumeString(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+			switch num {
+			case campoIdTransferencia:
+				t["IdTransferencia"] = v
+			case campoMonto:
+				t["Monto"] = v
+			case campoTipo:
+				t["Tipo"] = v
+			case campoFecha:
+				t["Fecha"] = v
+			}
+		default:
+			if num == campoVersion || (num >= campoIdTransferencia && num <= campoFecha) {
+				return nil, errors.New("campo " + strconv.Itoa(int(num)) + " con tipo de dato incorrecto")
+			}
+			n := protowire.ConsumeFieldValue(num, tipo, b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	// proto3 no distingue un escalar en cero de uno ausente: los ceros se omiten para que el esquema los informe como faltantes
+	return map[string]any{"Version": version, "Transferencia": t}, nil
+}
+
+// Serializa la transferencia como Protobuf v2
+func CodificarProtobuf(m models.KafkaTransferencias) []byte {
+	t := desdeModelo(m)
+	var b []byte
+	b = protowire.AppendTag(b, campoVersion, protowire.VarintType)
+	b = protowire.AppendVarint(b, VersionActual)
+	b = appendString(b, campoIdTransferencia, t.IdTransferencia)
+	b = appendVarint(b, campoIdUsuarioFinal, t.IdUsuarioFinal)
+	b = appendString(b, campoMonto, t.Monto)
+	b = appendVarint(b, campoIdMoneda, uint64(t.IdMoneda))
+	b = appendString(b, campoTipo, t.Tipo)
+	b = appendVarint(b, campoIdCategoria, t.IdCategoria)
+	b = appendString(b, campoFecha, t.Fecha)
+	return b
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
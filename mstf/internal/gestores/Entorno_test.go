@@ -0,0 +1,132 @@
+package gestores
+
+import (
+	"strconv"
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/config"
+	"MSTransaccionesFinancieras/internal/infra/persistence"
+	"MSTransaccionesFinancieras/internal/infra/tbmemoria"
+	"MSTransaccionesFinancieras/internal/infra/webhook"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"MSTransaccionesFinancieras/internal/repositorios/memoria"
+	"MSTransaccionesFinancieras/internal/utils"
+
+	tigerbeetle "github.com/tigerbeetle/tigerbeetle-go"
+	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+)
+
+// Entorno hermético para los tests de gestores: TigerBeetle en memoria, webhook sin URL (envío simulado)
+// y parámetros/monedas precargados en repositorios en memoria para no depender de MySQL.
+
+const (
+	monedaTest   uint32 = 1
+	montoMaxTest        = 1000000
+	montoMinTest        = 100
+)
+
+var idCuentaEmpresaTest = utils.ConcatenarIDString(uint64(monedaTest), 0)
+
+type entorno struct {
+	// cliente de TB instrumentado sobre TigerBeetle en memoria, el que reciben los gestores
+	tb    tigerbeetle.Client
+	repos repositorios.Repositorios
+}
+
+func nuevoEntorno(t *testing.T) *entorno {
+	t.Helper()
+	webhook.Init(config.Config{})
+
+	bd := memoria.New()
+	bd.GuardarParametro(models.Parametros{Parametro: "MONTOMAXTRANSFER", Valor: strconv.Itoa(montoMaxTest)})
+	bd.GuardarParametro(models.Parametros{Parametro: "MONTOMINTRANSFER", Valor: strconv.Itoa(montoMinTest)})
+	bd.GuardarMoneda(models.Monedas{IdMoneda: int(monedaTest), IdCuentaEmpresa: idCuentaEmpresaTest})
+	e := &entorno{tb: persistence.InstrumentarTB(tbmemoria.New()), repos: bd.Repositorios()}
+
+	// cuenta empresa de la moneda (sin límite de saldo)
+	if _, _, err := e.gestorCuentas().Crear(t.Context(), models.Cuentas{IdMoneda: monedaTest, Fecha: "2026-01-01"}); err != nil {
+		t.Fatalf("no se pudo crear la cuenta empresa: %v", err)
+	}
+	return e
+}
+
+func (e *entorno) crearCuentaUsuario(t *testing.T, idUsuarioFinal uint64) {
+	t.Helper()
+	if _, _, err := e.gestorCuentas().Crear(t.Context(), models.Cuentas{IdMoneda: monedaTest, IdUsuarioFinal: idUsuarioFinal, Fecha: "2026-01-01"}); err != nil {
+		t.Fatalf("no se pudo crear la cuenta del usuario %d: %v", idUsuarioFinal, err)
+	}
+}
+
+func (e *entorno) gestorCuentas() *GestorCuentas {
+	return NewGestorCuentas(e.tb, e.repos.Monedas, e.repos.Auditoria)
+}
+
+func (e *entorno) gestorTransferencias() *GestorTransferencias {
+	return NewGestorTransferencias(e.tb, e.repos.Parametros, e.repos.Monedas, e.repos.Auditoria, NewGestorEstadosTransferencias(e.repos.Estados))
+}
+
+func idCuenta(idUsuarioFinal uint64) types.Uint128 {
+	id, _ := utils.ParsearUint128(utils.ConcatenarIDString(uint64(monedaTest), idUsuarioFinal))
+	return id
+}
+
+// Arma la transferencia igual que ingesta.ParsearMensaje: Tipo "I" acredita al usuario desde la
+// cuenta empresa, "E" debita al usuario. Monto en unidad mínima.
+func transferencia(idTransferencia uint64, idUsuarioFinal uint64, tipo string, monto uint64) (types.Transfer, models.KafkaTransferencias) {
+	debito, credito := idCuenta(0), idCuenta(idUsuarioFinal)
+	if tipo == "E" {
+		debito, credito = credito, debito
+	}
+	fecha, _ := utils.FechaAUserData32("2026-01-02")
+	t := types.Transfer{
+		ID:              types.ToUint128(idTransferencia),
+		DebitAccountID:  debito,
+		CreditAccountID: credito,
+		Amount:          types.ToUint128(monto),
+		Ledger:          monedaTest,
+		Code:            models.CodigoTransferenciaNormal,
+		UserData128:     types.ToUint128(idUsuarioFinal),
+		UserData32:      fecha,
+	}
+	msg := models.KafkaTransferencias{
+		IdTransferencia: strconv.FormatUint(idTransferencia, 10),
+		IdUsuarioFinal:  idUsuarioFinal,
+		Monto:           float64(monto) / 100,
+		IdMoneda:        monedaTest,
+		Tipo:            tipo,
+		Fecha:           "2026-01-02",
+	}
+	return t, msg
+}
+
+// Arma la reversión de una transferencia igual que ingesta.buildReversion
+func reversion(original types.Transfer, idUsuarioFinal uint64) (types.Transfer, models.KafkaTransferencias) {
+	id := original.ID
+	id[8] |= 0x01
+	t := types.Transfer{
+		ID:              id,
+		DebitAccountID:  original.CreditAccountID,
+		CreditAccountID: original.DebitAccountID,
+		Amount:          original.Amount,
+		Ledger:          original.Ledger,
+		Code:            models.CodigoTransferenciaReversion,
+		UserData128:     original.ID,
+	}
+	msg := models.KafkaTransferencias{
+		IdTransferencia: utils.Uint128AStringDecimal(original.ID),
+		IdUsuarioFinal:  idUsuarioFinal,
+		IdMoneda:        original.Ledger,
+		Tipo:            "R",
+	}
+	return t, msg
+}
+
+func (e *entorno) dameCuenta(t *testing.T, idUsuarioFinal uint64) models.Cuentas {
+	t.Helper()
+	c := models.Cuentas{IdMoneda: monedaTest, IdUsuarioFinal: idUsuarioFinal}
+	if err := c.Dame(e.tb); err != nil {
+		t.Fatalf("Dame(%d): %v", idUsuarioFinal, err)
+	}
+	return c
+}
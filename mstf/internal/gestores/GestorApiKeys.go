@@ -0,0 +1,85 @@
+package gestores
+
+import (
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"MSTransaccionesFinancieras/internal/utils"
+	"context"
+	"strings"
+)
+
+type GestorApiKeys struct {
+	apiKeys repositorios.ApiKeys
+}
+
+func NewGestorApiKeys(apiKeys repositorios.ApiKeys) *GestorApiKeys {
+	return &GestorApiKeys{apiKeys: apiKeys}
+}
+
+// Permite listar las API keys de los sistemas cliente (sin la API key: solo su prefijo).
+// tsp_listar_apikeys
+func (gk *GestorApiKeys) Listar(ctx context.Context) ([]models.ApiKeys, error) {
+	return gk.apiKeys.Listar(ctx)
+}
+
+// Permite crear una API key para un sistema cliente. Genera la API key, que se devuelve en ApiKey para
+// informarla al sistema (se guarda solo su hash).
+// tsp_crear_apikey
+// - ApiKey.Nombre: nombre único de la API key
+// - ApiKey.Sistema: sistema cliente que la usa
+// - ApiKey.Alcances: admin, lectura y/o transferencias (ver auth.Alcances)
+// - ApiKey.IPsPermitidas: IPs o redes CIDR desde las que se acepta (vacía: cualquiera)
+// - ApiKey.FechaExpiracion: vencimiento (nil: no vence)
+func (gk *GestorApiKeys) Crear(ctx context.Context, ApiKey *models.ApiKeys) (string, error) {
+	ApiKey.Nombre = strings.TrimSpace(ApiKey.Nombre)
+	ApiKey.Sistema = strings.TrimSpace(ApiKey.Sistema)
+	if ApiKey.Alcances == nil {
+		ApiKey.Alcances = []string{}
+	}
+	for i, a := range ApiKey.Alcances {
+		ApiKey.Alcances[i] = strings.ToLower(strings.TrimSpace(a))
+	}
+	ips := make([]string, 0, len(ApiKey.IPsPermitidas))
+	for _, ip := range ApiKey.IPsPermitidas {
+		red, err := auth.ParsearRed(strings.TrimSpace(ip))
+		if err != nil {
+			return "La IP o red " + ip + " no es válida.", nil
+		}
+		ips = append(ips, red.String())
+	}
+	ApiKey.IPsPermitidas = ips
+
+	clave, err := utils.GenerarApiKey()
+	if err != nil {
+		return "", err
+	}
+	ApiKey.ApiKey = clave
+	mensaje, err := gk.apiKeys.Crear(ctx, ApiKey)
+	if err != nil || mensaje != "OK" {
+		ApiKey.ApiKey = ""
+		return mensaje, err
+	}
+	return mensaje, nil
+}
+
+// Permite reemplazar una API key activa por una nueva con la misma configuración. La anterior deja de valer
+// de inmediato. Devuelve la API key nueva para informarla al sistema.
+// tsp_rotar_apikey
+func (gk *GestorApiKeys) Rotar(ctx context.Context, ApiKey models.ApiKeys) (string, string, error) {
+	clave, err := utils.GenerarApiKey()
+	if err != nil {
+		return "", "", err
+	}
+	mensaje, err := gk.apiKeys.Rotar(ctx, ApiKey.IdApiKey, clave)
+	if err != nil || mensaje != "OK" {
+		return mensaje, "", err
+	}
+	return mensaje, clave, nil
+}
+
+// Permite revocar una API key. Deja de valer de inmediato, aunque esté en el caché de autenticación.
+// tsp_revocar_apikey
+func (gk *GestorApiKeys) Revocar(ctx context.Context, ApiKey models.ApiKeys) (string, error) {
+	return gk.apiKeys.Revocar(ctx, ApiKey.IdApiKey)
+}
@@ -0,0 +1,51 @@
+package gestores
+
+import (
+	"strings"
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios/memoria"
+)
+
+func TestCrearYRotarApiKey(t *testing.T) {
+	bd := memoria.New()
+	admin := bd.GuardarUsuario(models.Usuarios{Usuario: "admin"}, "Admin123")
+	repos := bd.Repositorios()
+	gk := NewGestorApiKeys(repos.ApiKeys)
+	ctx := ctxSesion(admin.TokenSesion)
+
+	mensaje, err := gk.Crear(ctx, &models.ApiKeys{Nombre: "pagos", Sistema: "Pagos", Alcances: []string{"Admin"}, IPsPermitidas: []string{"10.0.0.300"}})
+	if err != nil || mensaje != "La IP o red 10.0.0.300 no es válida." {
+		t.Fatalf("Crear con IP inválida: %q %v", mensaje, err)
+	}
+
+	k := &models.ApiKeys{Nombre: " pagos ", Sistema: "Pagos", Alcances: []string{"Transferencias"}, IPsPermitidas: []string{"10.0.0.7", "192.168.1.77/24"}}
+	mensaje, err = gk.Crear(ctx, k)
+	if err != nil || mensaje != "OK" {
+		t.Fatalf("Crear: %q %v", mensaje, err)
+	}
+	if !strings.HasPrefix(k.ApiKey, "mstf_") || len(k.ApiKey) != 69 || k.Prefijo != k.ApiKey[:12] || k.Nombre != "pagos" ||
+		k.Alcances[0] != auth.AlcanceTransferencias || k.IPsPermitidas[0] != "10.0.0.7/32" || k.IPsPermitidas[1] != "192.168.1.0/24" {
+		t.Fatalf("API key creada: %+v", k)
+	}
+	if mensaje, _, _ := repos.Autenticacion.Autenticar(t.Context(), k.ApiKey, "SISTEMA", "192.168.1.10"); mensaje != "OK" {
+		t.Fatalf("Autenticar desde la red permitida: %q", mensaje)
+	}
+	if mensaje, _, _ := repos.Autenticacion.Autenticar(t.Context(), k.ApiKey, "SISTEMA", "10.0.0.8"); mensaje == "OK" {
+		t.Fatal("la API key no debe aceptarse desde una IP fuera de la lista")
+	}
+
+	mensaje, nueva, err := gk.Rotar(ctx, models.ApiKeys{IdApiKey: k.IdApiKey})
+	if err != nil || mensaje != "OK" || nueva == k.ApiKey || !strings.HasPrefix(nueva, "mstf_") {
+		t.Fatalf("Rotar: %q %q %v", mensaje, nueva, err)
+	}
+	if mensaje, _, _ := repos.Autenticacion.Autenticar(t.Context(), nueva, "SISTEMA", "10.0.0.7"); mensaje != "OK" {
+		t.Fatalf("Autenticar con la API key rotada: %q", mensaje)
+	}
+	mensaje, nueva, err = gk.Rotar(ctx, models.ApiKeys{IdApiKey: 99})
+	if err != nil || mensaje != "La API key no existe." || nueva != "" {
+		t.Fatalf("Rotar inexistente: %q %q %v", mensaje, nueva, err)
+	}
+}
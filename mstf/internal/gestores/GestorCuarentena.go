@@ -0,0 +1,30 @@
+package gestores
+
+import (
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"context"
+)
+
+type GestorCuarentena struct {
+	cuarentena repositorios.Cuarentena
+}
+
+func NewGestorCuarentena(cuarentena repositorios.Cuarentena) *GestorCuarentena {
+	return &GestorCuarentena{cuarentena: cuarentena}
+}
+
+// Registra un mensaje aislado por el motor de ingesta.
+// - Mensaje.Origen: ubicación del mensaje en la fuente (ej: topic/partición/offset)
+// - Mensaje.Contenido: payload original del mensaje
+// - Mensaje.Error: último error obtenido al procesarlo
+func (gc *GestorCuarentena) Crear(ctx context.Context, Mensaje models.MensajesCuarentena) (string, error) {
+	return gc.cuarentena.Crear(ctx, Mensaje)
+}
+
+// Permite buscar los mensajes en cuarentena, del más reciente al más antiguo.
+// - IdTransferencia: filtra por IdTransferencia ("" = todos)
+// - Limite: cantidad máxima de mensajes a devolver
+func (gc *GestorCuarentena) Buscar(ctx context.Context, IdTransferencia string, Limite int) ([]models.MensajesCuarentena, error) {
+	return gc.cuarentena.Buscar(ctx, IdTransferencia, Limite)
+}
@@ -1,13 +1,16 @@
 package gestores
 
 import (
+	"MSTransaccionesFinancieras/internal/infra/logs"
 	"MSTransaccionesFinancieras/internal/infra/persistence"
 	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
 	"MSTransaccionesFinancieras/internal/utils"
+	"context"
 	"errors"
 	"fmt"
-	"log"
 
+	tigerbeetle "github.com/tigerbeetle/tigerbeetle-go"
 	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
 )
 
@@ -19,10 +22,23 @@ type CuentaNueva struct {
 }
 
 type GestorCuentas struct {
+	tb        tigerbeetle.Client
+	monedas   repositorios.Monedas
+	auditoria repositorios.Auditoria
 }
 
-func NewGestorCuentas() *GestorCuentas {
-	return &GestorCuentas{}
+func NewGestorCuentas(tb tigerbeetle.Client, monedas repositorios.Monedas, auditoria repositorios.Auditoria) *GestorCuentas {
+	return &GestorCuentas{tb: tb, monedas: monedas, auditoria: auditoria}
+}
+
+// Instancia la cuenta desde TigerBeetle a partir de Cuenta.IdUsuarioFinal y Cuenta.IdMoneda
+func (gc *GestorCuentas) Dame(ctx context.Context, Cuenta *models.Cuentas) error {
+	return Cuenta.Dame(persistence.TB(ctx, gc.tb))
+}
+
+// Historial de balances de la cuenta (ver models.Cuentas.ListarHistorialBalances)
+func (gc *GestorCuentas) ListarHistorialBalances(ctx context.Context, Cuenta *models.Cuentas, FechaInicio uint64, FechaFin uint64, Limite uint32) ([]types.AccountBalance, error) {
+	return Cuenta.ListarHistorialBalances(persistence.TB(ctx, gc.tb), FechaInicio, FechaFin, Limite)
 }
 
 // Busca cuentas según los filtros especificados.
@@ -31,6 +47,7 @@ func NewGestorCuentas() *GestorCuentas {
 // Estado: "A" para activas, "I" para inactivas/cerradas, "" para todas.
 // Limit: máximo número de cuentas a retornar (0 = sin límite).
 func (gc *GestorCuentas) BuscarAvanzado(
+	ctx context.Context,
 	IdsCuenta []types.Uint128,
 	IdUsuarioFinal uint64,
 	IdMoneda uint32,
@@ -38,13 +55,14 @@ func (gc *GestorCuentas) BuscarAvanzado(
 	Limit uint32,
 ) ([]types.Account, error) {
 
-	if persistence.ClienteTB == nil {
+	if gc.tb == nil {
 		return nil, errors.New("Conexión a TigerBeetle no inicializada")
 	}
+	tb := persistence.TB(ctx, gc.tb)
 
 	// lookup directo por IDs (ignora el resto de parámetros)
 	if len(IdsCuenta) > 0 {
-		return persistence.ClienteTB.LookupAccounts(IdsCuenta)
+		return tb.LookupAccounts(IdsCuenta)
 	}
 
 	resultados := make([]types.Account, 0)
@@ -55,7 +73,7 @@ func (gc *GestorCuentas) BuscarAvanzado(
 	for {
 		restantes := Limit - uint32(len(resultados))
 		if restantes == 0 {
-			// log.Printf("GestorCuentas.BuscarAvanzado: Límite alcanzado (%d cuentas)", Limit)
+			logs.L(logs.Cuentas).Debug("BuscarAvanzado: límite alcanzado", "Limite", Limit)
 			break
 		}
 
@@ -73,14 +91,14 @@ func (gc *GestorCuentas) BuscarAvanzado(
 			}.ToUint32(),
 		}
 
-		// log.Printf("GestorCuentas.BuscarAvanzado: Ejecutando QueryAccounts (TimestampMin=%d, Limit=%d)", timestampMin, restantes)
-		accounts, err := persistence.ClienteTB.QueryAccounts(filter)
+		logs.L(logs.Cuentas).Debug("BuscarAvanzado: ejecutando QueryAccounts", "TimestampMin", timestampMin, "Limite", restantes)
+		accounts, err := tb.QueryAccounts(filter)
 		if err != nil {
-			log.Printf("ERROR [GestorCuentas.BuscarAvanzado]: Fallo QueryAccounts: %v", err)
+			logs.L(logs.Cuentas).Error("BuscarAvanzado: falló QueryAccounts", "IdMoneda", IdMoneda, logs.Err(err))
 			return nil, err
 		}
 
-		// log.Printf("GestorCuentas.BuscarAvanzado: Obtenidos %d resultados en esta iteración", len(accounts))
+		logs.L(logs.Cuentas).Debug("BuscarAvanzado: resultados de la iteración", "obtenidas", len(accounts))
 
 		if len(accounts) == 0 {
 			break
@@ -89,25 +107,20 @@ func (gc *GestorCuentas) BuscarAvanzado(
 		resultados = append(resultados, accounts...)
 
 		if uint32(len(accounts)) < restantes {
-			// log.Printf("GestorCuentas.BuscarAvanzado: Obtenidos %d < %d, no hay más resultados", len(accounts), restantes)
 			break
 		}
 		ultimoTimestamp := accounts[len(accounts)-1].Timestamp
 		timestampMin = ultimoTimestamp + 1
 
-		// log.Printf("GestorCuentas.BuscarAvanzado: Obtenidos %d == %d, continuando iteración", len(accounts), restantes)
-
 		if len(resultados) > 50000 {
-			// log.Printf("ADVERTENCIA: Se alcanzó el límite de seguridad de 50,000 cuentas")
+			logs.L(logs.Cuentas).Warn("BuscarAvanzado: límite de seguridad alcanzado (50.000 cuentas)")
 			break
 		}
 	}
 
-	// log.Printf("GestorCuentas.BuscarAvanzado: Total acumulado antes de filtrar por estado: %d cuentas", len(resultados))
-
 	if Estado != "" {
 		resultados = filtrarPorEstado(resultados, Estado)
-		// log.Printf("GestorCuentas.BuscarAvanzado: Después de filtrar por estado '%s': %d cuentas", Estado, len(resultados))
+		logs.L(logs.Cuentas).Debug("BuscarAvanzado: filtrado por estado", "Estado", Estado, "cuentas", len(resultados))
 	}
 
 	return resultados, nil
@@ -117,19 +130,20 @@ func (gc *GestorCuentas) BuscarAvanzado(
 // Retorna (idCuenta, existe, error).
 // existe=true indica que la cuenta ya existía con los mismos parámetros (idempotencia ante reintentos).
 // Si IdUsuarioFinal es 0, se trata como cuenta empresa (DebitsMustNotExceedCredits=false).
-func (gc *GestorCuentas) Crear(Cuenta models.Cuentas) (string, bool, error) {
+// Audita la creación (CC) solo si la cuenta no existía.
+func (gc *GestorCuentas) Crear(ctx context.Context, Cuenta models.Cuentas) (string, bool, error) {
 	idMoneda := Cuenta.IdMoneda
 	idUsuarioFinal := Cuenta.IdUsuarioFinal
 	fechaAlta := Cuenta.Fecha
 	debitosNoDebenExcederCreditos := Cuenta.IdUsuarioFinal != 0
 
-	if persistence.ClienteTB == nil {
+	if gc.tb == nil {
 		return "", false, errors.New("Conexión a TigerBeetle no inicializada")
 	}
 
 	// Verificar que la moneda exista y esté activa
 	moneda := &models.Monedas{IdMoneda: int(idMoneda)}
-	if _, err := moneda.Dame(); err != nil {
+	if mensaje, err := gc.monedas.Dame(ctx, moneda); err != nil || mensaje != "OK" {
 		return "", false, errors.New("La moneda no existe o no está activa")
 	}
 	// Solo si la cuenta no es cuentaempresa
@@ -165,7 +179,7 @@ func (gc *GestorCuentas) Crear(Cuenta models.Cuentas) (string, bool, error) {
 		}.ToUint16(),
 	}
 
-	results, err := persistence.ClienteTB.CreateAccounts([]types.Account{cuentaTB})
+	results, err := persistence.TB(ctx, gc.tb).CreateAccounts([]types.Account{cuentaTB})
 	if err != nil {
 		return "", false, errors.New("error de comunicación con TigerBeetle")
 	}
@@ -176,13 +190,15 @@ func (gc *GestorCuentas) Crear(Cuenta models.Cuentas) (string, bool, error) {
 		}
 		return "", false, errors.New("fallo en la creación de la cuenta: " + results[0].Result.String())
 	}
+	gc.auditarCreacion(ctx, idCuenta, idMoneda, idUsuarioFinal, fechaAlta, debitosNoDebenExcederCreditos)
 	return idCuenta, false, nil
 }
 
 // Crea múltiples cuentas en TigerBeetle en un solo llamado.
 // Recibe los mismos datos que Crear pero como array.
-func (gc *GestorCuentas) CrearLote(Cuentas []CuentaNueva) ([]string, error) {
-	if persistence.ClienteTB == nil {
+// Audita la creación (CC) de cada cuenta que no existía, aunque falle la creación de otras del lote.
+func (gc *GestorCuentas) CrearLote(ctx context.Context, Cuentas []CuentaNueva) ([]string, error) {
+	if gc.tb == nil {
 		return nil, errors.New("Conexión a TigerBeetle no inicializada")
 	}
 	if len(Cuentas) == 0 {
@@ -192,7 +208,7 @@ func (gc *GestorCuentas) CrearLote(Cuentas []CuentaNueva) ([]string, error) {
 	// Verificar que la moneda de cada cuenta exista y esté activa
 	for _, c := range Cuentas {
 		moneda := &models.Monedas{IdMoneda: int(c.IdMoneda)}
-		if _, err := moneda.Dame(); err != nil {
+		if mensaje, err := gc.monedas.Dame(ctx, moneda); err != nil || mensaje != "OK" {
 			return nil, fmt.Errorf("La moneda no existe o no está activa (IdMoneda=%d)", c.IdMoneda)
 		}
 		if moneda.Estado != "A" {
@@ -235,18 +251,25 @@ func (gc *GestorCuentas) CrearLote(Cuentas []CuentaNueva) ([]string, error) {
 		ids = append(ids, idCuenta)
 	}
 
-	results, err := persistence.ClienteTB.CreateAccounts(cuentasTB)
+	results, err := persistence.TB(ctx, gc.tb).CreateAccounts(cuentasTB)
 	if err != nil {
 		return nil, errors.New("error de comunicación con TigerBeetle")
 	}
 	fallosReales := 0
+	noCreadas := make(map[uint32]bool, len(results))
 	for _, r := range results {
+		noCreadas[r.Index] = true
 		if r.Result == types.AccountExists {
 			continue
 		}
 		fallosReales++
 		if int(r.Index) < len(ids) {
-			log.Printf("ERROR [GestorCuentas.CrearLote]: Cuenta %s falló: %s", ids[r.Index], r.Result.String())
+			logs.L(logs.Cuentas).Error("CrearLote: falló la creación de la cuenta", "IdCuenta", ids[r.Index], "IdMoneda", cuentasTB[r.Index].Ledger, "resultado", r.Result.String())
+		}
+	}
+	for i, c := range Cuentas {
+		if !noCreadas[uint32(i)] {
+			gc.auditarCreacion(ctx, ids[i], c.IdMoneda, c.IdUsuarioFinal, c.Fecha, c.DebitosNoDebenExcederCreditos)
 		}
 	}
 	if fallosReales > 0 {
@@ -256,6 +279,76 @@ func (gc *GestorCuentas) CrearLote(Cuentas []CuentaNueva) ([]string, error) {
 	return ids, nil
 }
 
+// Cierra una cuenta de usuario en TigerBeetle contra la cuenta empresa de su moneda.
+// La moneda debe existir y estar activa. Idempotente: si la cuenta ya está cerrada, retorna nil.
+// - Cuenta: estado anterior que se audita (DC); si el llamador no la instanció, se instancia con Dame
+func (gc *GestorCuentas) Desactivar(ctx context.Context, Cuenta *models.Cuentas) error {
+	if Cuenta.Estado == "" {
+		if err := gc.Dame(ctx, Cuenta); err != nil {
+			return err
+		}
+	}
+	moneda := &models.Monedas{IdMoneda: int(Cuenta.IdMoneda)}
+	if mensaje, err := gc.monedas.Dame(ctx, moneda); err != nil || mensaje != "OK" {
+		return errors.New("La moneda no existe o no está activa")
+	}
+	if err := Cuenta.Desactivar(persistence.TB(ctx, gc.tb), *moneda); err != nil {
+		return err
+	}
+	gc.auditarCambioEstado(ctx, models.OperacionDesactivacionCuenta, Cuenta)
+	return nil
+}
+
+// Reabre una cuenta cerrada en TigerBeetle. Idempotente: si la cuenta ya está activa, retorna nil.
+// - Cuenta: estado anterior que se audita (AC); si el llamador no la instanció, se instancia con Dame
+func (gc *GestorCuentas) Activar(ctx context.Context, Cuenta *models.Cuentas) error {
+	if Cuenta.Estado == "" {
+		if err := gc.Dame(ctx, Cuenta); err != nil {
+			return err
+		}
+	}
+	if err := Cuenta.Activar(persistence.TB(ctx, gc.tb)); err != nil {
+		return err
+	}
+	gc.auditarCambioEstado(ctx, models.OperacionActivacionCuenta, Cuenta)
+	return nil
+}
+
+// Audita la creación de una cuenta (CC)
+func (gc *GestorCuentas) auditarCreacion(ctx context.Context, IdCuenta string, IdMoneda uint32, IdUsuarioFinal uint64, Fecha string, DebitosNoDebenExcederCreditos bool) {
+	auditar(ctx, gc.auditoria, models.OperacionCreacionCuenta, map[string]any{
+		"IdCuenta":       IdCuenta,
+		"IdMoneda":       IdMoneda,
+		"IdUsuarioFinal": IdUsuarioFinal,
+		"Fecha":          Fecha,
+		"Antes":          nil,
+		"Despues":        map[string]any{"Estado": "A", "DebitosNoDebenExcederCreditos": DebitosNoDebenExcederCreditos},
+	})
+}
+
+// Audita la activación o desactivación de una cuenta releyendo su estado en TigerBeetle; si el estado no cambió
+// (operación idempotente sobre una cuenta que ya estaba así) no audita.
+// - Cuenta: la cuenta antes de la operación; se instancia con su estado posterior
+func (gc *GestorCuentas) auditarCambioEstado(ctx context.Context, TipoOperacion string, Cuenta *models.Cuentas) {
+	antes := *Cuenta
+	despues := models.Cuentas{IdMoneda: antes.IdMoneda, IdUsuarioFinal: antes.IdUsuarioFinal}
+	if err := gc.Dame(ctx, &despues); err != nil {
+		logs.L(logs.Cuentas).ErrorContext(ctx, "no se pudo releer la cuenta para auditar", "tipo_operacion", TipoOperacion, "IdMoneda", antes.IdMoneda, "IdUsuarioFinal", antes.IdUsuarioFinal, logs.Err(err))
+		return
+	}
+	*Cuenta = despues
+	if despues.Estado == antes.Estado {
+		return
+	}
+	auditar(ctx, gc.auditoria, TipoOperacion, map[string]any{
+		"IdCuenta":       despues.IdCuenta,
+		"IdMoneda":       despues.IdMoneda,
+		"IdUsuarioFinal": despues.IdUsuarioFinal,
+		"Antes":          map[string]any{"Estado": antes.Estado, "Creditos": antes.Creditos, "Debitos": antes.Debitos},
+		"Despues":        map[string]any{"Estado": despues.Estado, "Creditos": despues.Creditos, "Debitos": despues.Debitos},
+	})
+}
+
 // --------------------------------------------------------------------------------
 // Funciones aux
 // --------------------------------------------------------------------------------
@@ -0,0 +1,145 @@
+package gestores
+
+import (
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/models"
+
+	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+)
+
+func TestCrearCuentaIdempotente(t *testing.T) {
+	e := nuevoEntorno(t)
+	gc := e.gestorCuentas()
+
+	id, existe, err := gc.Crear(t.Context(), models.Cuentas{IdMoneda: monedaTest, IdUsuarioFinal: 7, Fecha: "2026-01-01"})
+	if err != nil || existe {
+		t.Fatalf("Crear: id=%s existe=%v err=%v", id, existe, err)
+	}
+	idReintento, existe, err := gc.Crear(t.Context(), models.Cuentas{IdMoneda: monedaTest, IdUsuarioFinal: 7, Fecha: "2026-01-01"})
+	if err != nil || !existe || idReintento != id {
+		t.Fatalf("reintento: id=%s existe=%v err=%v", idReintento, existe, err)
+	}
+	if _, _, err := gc.Crear(t.Context(), models.Cuentas{IdMoneda: monedaTest, IdUsuarioFinal: 7, Fecha: "2026-02-01"}); err == nil {
+		t.Fatal("crear la misma cuenta con otra fecha debe fallar")
+	}
+
+	c := e.dameCuenta(t, 7)
+	if c.Estado != "A" || c.Creditos != "0.00" || c.Fecha == "" {
+		t.Fatalf("cuenta: %+v", c)
+	}
+}
+
+func TestCrearCuentaMonedaInexistente(t *testing.T) {
+	e := nuevoEntorno(t)
+	if _, _, err := e.gestorCuentas().Crear(t.Context(), models.Cuentas{IdMoneda: 99, IdUsuarioFinal: 7, Fecha: "2026-01-01"}); err == nil {
+		t.Fatal("se esperaba error por moneda inexistente")
+	}
+	if _, err := e.gestorCuentas().CrearLote(t.Context(), []CuentaNueva{{IdMoneda: 99, IdUsuarioFinal: 7, Fecha: "2026-01-01"}}); err == nil {
+		t.Fatal("se esperaba error por moneda inexistente en el lote")
+	}
+}
+
+func TestCrearLoteYBuscarAvanzado(t *testing.T) {
+	e := nuevoEntorno(t)
+	gc := e.gestorCuentas()
+
+	nuevas := make([]CuentaNueva, 0, 5)
+	for i := uint64(1); i <= 5; i++ {
+		nuevas = append(nuevas, CuentaNueva{IdMoneda: monedaTest, IdUsuarioFinal: i, Fecha: "2026-01-01", DebitosNoDebenExcederCreditos: true})
+	}
+	ids, err := gc.CrearLote(t.Context(), nuevas)
+	if err != nil || len(ids) != 5 {
+		t.Fatalf("CrearLote: %v %v", ids, err)
+	}
+	// reintento del lote completo: las cuentas existentes no cuentan como falla
+	if _, err := gc.CrearLote(t.Context(), nuevas); err != nil {
+		t.Fatalf("reintento de CrearLote: %v", err)
+	}
+
+	// 5 usuarios + cuenta empresa, paginando de a 2
+	todas, err := gc.BuscarAvanzado(t.Context(), nil, 0, monedaTest, "", 2)
+	if err != nil || len(todas) != 2 {
+		t.Fatalf("BuscarAvanzado con límite: %d %v", len(todas), err)
+	}
+	todas, err = gc.BuscarAvanzado(t.Context(), nil, 0, monedaTest, "", 100)
+	if err != nil || len(todas) != 6 {
+		t.Fatalf("BuscarAvanzado: %d %v", len(todas), err)
+	}
+	for i := 1; i < len(todas); i++ {
+		if todas[i].Timestamp <= todas[i-1].Timestamp {
+			t.Fatal("las cuentas deben devolverse por timestamp ascendente")
+		}
+	}
+
+	porUsuario, err := gc.BuscarAvanzado(t.Context(), nil, 3, 0, "", 100)
+	if err != nil || len(porUsuario) != 1 || porUsuario[0].ID != idCuenta(3) {
+		t.Fatalf("BuscarAvanzado por usuario: %v %v", porUsuario, err)
+	}
+	porId, err := gc.BuscarAvanzado(t.Context(), []types.Uint128{idCuenta(2), idCuenta(42)}, 0, 0, "", 0)
+	if err != nil || len(porId) != 1 {
+		t.Fatalf("BuscarAvanzado por IDs: %v %v", porId, err)
+	}
+}
+
+func TestDesactivarYActivarCuenta(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearCuentaUsuario(t, 7)
+	gc := e.gestorCuentas()
+	cuenta := &models.Cuentas{IdMoneda: monedaTest, IdUsuarioFinal: 7}
+
+	if err := gc.Desactivar(t.Context(), cuenta); err != nil {
+		t.Fatalf("Desactivar: %v", err)
+	}
+	if err := gc.Desactivar(t.Context(), cuenta); err != nil {
+		t.Fatalf("Desactivar debe ser idempotente: %v", err)
+	}
+	if c := e.dameCuenta(t, 7); c.Estado != "I" {
+		t.Fatalf("estado luego de desactivar: %s", c.Estado)
+	}
+	inactivas, err := gc.BuscarAvanzado(t.Context(), nil, 0, monedaTest, "I", 100)
+	if err != nil || len(inactivas) != 1 {
+		t.Fatalf("BuscarAvanzado inactivas: %d %v", len(inactivas), err)
+	}
+
+	if err := cuenta.Activar(e.tb); err != nil {
+		t.Fatalf("Activar: %v", err)
+	}
+	if err := cuenta.Activar(e.tb); err != nil {
+		t.Fatalf("Activar debe ser idempotente: %v", err)
+	}
+	if c := e.dameCuenta(t, 7); c.Estado != "A" {
+		t.Fatalf("estado luego de activar: %s", c.Estado)
+	}
+
+	empresa := &models.Cuentas{IdMoneda: monedaTest, IdUsuarioFinal: 0}
+	if err := gc.Desactivar(t.Context(), empresa); err == nil {
+		t.Fatal("no se debe poder desactivar la cuenta empresa")
+	}
+}
+
+func TestHistorialBalances(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearCuentaUsuario(t, 7)
+	gt := e.gestorTransferencias()
+
+	for i, tipo := range []string{"I", "I", "E"} {
+		tr, msg := transferencia(uint64(100+i), 7, tipo, 1000)
+		if _, err := gt.CrearLote(t.Context(), []types.Transfer{tr}, []models.KafkaTransferencias{msg}, nil); err != nil {
+			t.Fatalf("CrearLote: %v", err)
+		}
+	}
+
+	cuenta := &models.Cuentas{IdMoneda: monedaTest, IdUsuarioFinal: 7}
+	balances, err := e.gestorCuentas().ListarHistorialBalances(t.Context(), cuenta, 0, 0, 10)
+	if err != nil || len(balances) != 3 {
+		t.Fatalf("ListarHistorialBalances: %d %v", len(balances), err)
+	}
+	// del más reciente al más antiguo
+	if balances[0].DebitsPosted != types.ToUint128(1000) || balances[0].CreditsPosted != types.ToUint128(2000) {
+		t.Fatalf("último balance: %+v", balances[0])
+	}
+	if balances[2].CreditsPosted != types.ToUint128(1000) {
+		t.Fatalf("primer balance: %+v", balances[2])
+	}
+}
@@ -0,0 +1,40 @@
+package gestores
+
+import (
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"context"
+	"errors"
+)
+
+type GestorEstadosTransferencias struct {
+	estados repositorios.EstadosTransferencias
+}
+
+func NewGestorEstadosTransferencias(estados repositorios.EstadosTransferencias) *GestorEstadosTransferencias {
+	return &GestorEstadosTransferencias{estados: estados}
+}
+
+// Registra el resultado notificado de un lote de transferencias.
+// - Notificaciones: resultados tal como se enviaron en el webhook
+func (ge *GestorEstadosTransferencias) Registrar(ctx context.Context, Notificaciones []models.TransferenciaNotificada) error {
+	if len(Notificaciones) == 0 {
+		return nil
+	}
+	mensaje, err := ge.estados.Registrar(ctx, Notificaciones)
+	if err != nil {
+		return err
+	}
+	if mensaje != "OK" {
+		return errors.New(mensaje)
+	}
+	return nil
+}
+
+// Permite buscar el último resultado registrado de las transferencias, del más reciente al más antiguo.
+// - IdTransferencia: filtra por IdTransferencia ("" = todas)
+// - IdCorrelacion: filtra por IdCorrelacion ("" = todas)
+// - Limite: cantidad máxima de estados a devolver
+func (ge *GestorEstadosTransferencias) Buscar(ctx context.Context, IdTransferencia string, IdCorrelacion string, Limite int) ([]models.EstadosTransferencias, error) {
+	return ge.estados.Buscar(ctx, IdTransferencia, IdCorrelacion, Limite)
+}
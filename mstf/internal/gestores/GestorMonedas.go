@@ -1,18 +1,23 @@
 package gestores
 
 import (
-	"MSTransaccionesFinancieras/internal/auth"
-	"MSTransaccionesFinancieras/internal/infra/persistence"
 	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
 	"context"
-	"strconv"
 )
 
 type GestorMonedas struct {
+	monedas repositorios.Monedas
 }
 
-func NewGestorMonedas() *GestorMonedas {
-	return &GestorMonedas{}
+func NewGestorMonedas(monedas repositorios.Monedas) *GestorMonedas {
+	return &GestorMonedas{monedas: monedas}
+}
+
+// Instancia los atributos de la moneda (Moneda.IdMoneda).
+// tsp_dame_moneda
+func (gm *GestorMonedas) Dame(ctx context.Context, Moneda *models.Monedas) (string, error) {
+	return gm.monedas.Dame(ctx, Moneda)
 }
 
 // Crea una moneda en estado P: Pendiente.
@@ -20,47 +25,33 @@ func NewGestorMonedas() *GestorMonedas {
 // - Moneda.IdMoneda: Id de la moneda a crear (viene de MisGastos)
 // - Moneda.IdCuentaEmpresa: Id de la cuenta empresa en TB asociada a esta moneda
 func (gm *GestorMonedas) Crear(ctx context.Context, Moneda models.Monedas) (string, error) {
-	credencial, actor := auth.CredencialDesdeCtx(ctx)
-	var mensaje string
-	err := persistence.ClienteMySQL.QueryRow("CALL tsp_crear_moneda(?, ?, ?, ?)", credencial, actor, Moneda.IdMoneda, Moneda.IdCuentaEmpresa).Scan(&mensaje)
-	if err != nil {
-		return "", err
-	}
-	return mensaje, nil
+	return gm.monedas.Crear(ctx, Moneda)
 }
 
 // Permite listar todas las monedas.
 // tsp_listar_monedas
 // - IncluyeInactivos: 'S' o 'N' para incluir o no las monedas inactivas
-func (gm *GestorMonedas) Listar(IncluyeInactivos string) ([]models.Monedas, error) {
-	rows, err := persistence.ClienteMySQL.Query("CALL tsp_listar_monedas(?)", IncluyeInactivos)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+func (gm *GestorMonedas) Listar(ctx context.Context, IncluyeInactivos string) ([]models.Monedas, error) {
+	return gm.monedas.Listar(ctx, IncluyeInactivos)
+}
+
+// Activa una moneda, siempre y cuando esté en estado Pendiente o Inactiva ('P' | 'I').
+// tsp_activar_moneda
+// - Moneda.IdMoneda: Id de la moneda a activar
+func (gm *GestorMonedas) Activar(ctx context.Context, Moneda models.Monedas) (string, error) {
+	return gm.monedas.Activar(ctx, Moneda.IdMoneda)
+}
 
-	monedas := make([]models.Monedas, 0)
-	for rows.Next() {
-		var m models.Monedas
-		err = rows.Scan(&m.IdMoneda, &m.IdCuentaEmpresa, &m.Estado, &m.FechaAlta)
-		if err != nil {
-			return nil, err
-		}
-		monedas = append(monedas, m)
-	}
-	return monedas, nil
+// Desactiva una moneda en estado Activo ('A').
+// tsp_desactivar_moneda
+// - Moneda.IdMoneda: Id de la moneda a desactivar
+func (gm *GestorMonedas) Desactivar(ctx context.Context, Moneda models.Monedas) (string, error) {
+	return gm.monedas.Desactivar(ctx, Moneda.IdMoneda)
 }
 
 // Borra una moneda únicamente si está en estado Inactivo.
 // tsp_borrar_moneda
 // - Moneda.IdMoneda: Id de la moneda a borrar
 func (gm *GestorMonedas) Borrar(ctx context.Context, Moneda models.Monedas) (string, error) {
-	credencial, actor := auth.CredencialDesdeCtx(ctx)
-	var mensaje string
-	err := persistence.ClienteMySQL.QueryRow("CALL tsp_borrar_moneda(?, ?, ?)", credencial, actor, Moneda.IdMoneda).Scan(&mensaje)
-	if err != nil {
-		return "", err
-	}
-	models.CacheMonedas.Borrar(strconv.Itoa(Moneda.IdMoneda))
-	return mensaje, nil
+	return gm.monedas.Borrar(ctx, Moneda.IdMoneda)
 }
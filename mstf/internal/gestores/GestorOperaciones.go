@@ -0,0 +1,150 @@
+package gestores
+
+import (
+	"MSTransaccionesFinancieras/internal/infra/logs"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"sort"
+)
+
+// Máximo de operaciones que devuelve una búsqueda (también al exportar a CSV)
+const limiteMaximoOperaciones = 5000
+
+// Operaciones que se leen por llamada al recorrer la cadena
+const paginaCadenaOperaciones = 1000
+
+type GestorOperaciones struct {
+	auditoria repositorios.Auditoria
+}
+
+func NewGestorOperaciones(auditoria repositorios.Auditoria) *GestorOperaciones {
+	return &GestorOperaciones{auditoria: auditoria}
+}
+
+// Permite buscar las operaciones auditadas, de la más reciente a la más antigua.
+// tsp_buscar_operaciones
+// - Filtro.IdUsuario: usuario que realizó la operación
+// - Filtro.Entidad, Filtro.IdEntidad: entidad sobre la que se realizó (ver repositorios.EntidadesOperaciones)
+// - Filtro.FechaInicio, Filtro.FechaFin: rango [inicio, fin)
+// - Filtro.Limite: por defecto 100, hasta limiteMaximoOperaciones
+func (ga *GestorOperaciones) Buscar(ctx context.Context, Filtro repositorios.FiltroOperaciones) (string, []models.Operaciones, error) {
+	if _, ok := repositorios.EntidadesOperaciones[Filtro.Entidad]; Filtro.Entidad != "" && !ok {
+		return "La entidad debe ser Moneda, Parametro, Usuario, Rol, ApiKey, Cuenta o Transferencia.", nil, nil
+	}
+	if Filtro.IdEntidad != "" && Filtro.Entidad == "" {
+		return "IdEntidad requiere Entidad.", nil, nil
+	}
+	if !Filtro.FechaInicio.IsZero() && !Filtro.FechaFin.IsZero() && !Filtro.FechaFin.After(Filtro.FechaInicio) {
+		return "FechaFin debe ser posterior a FechaInicio.", nil, nil
+	}
+	if Filtro.Limite > limiteMaximoOperaciones {
+		Filtro.Limite = limiteMaximoOperaciones
+	}
+	operaciones, err := ga.auditoria.Buscar(ctx, Filtro)
+	if err != nil {
+		return "", nil, err
+	}
+	return "OK", operaciones, nil
+}
+
+// Recorre la cadena de hashes de Operaciones y reporta las operaciones modificadas o eliminadas.
+// - Cada operación debe tener el IdOperacion siguiente al de la anterior (si no, se eliminaron las del medio) y su
+// Hash debe ser el recalculado a partir del Hash guardado de la anterior y su contenido (si no, se modificó).
+// Después de un hueco no se puede recalcular el Hash de la siguiente: solo se reporta la eliminación.
+// - La cabeza de la cadena (CadenaOperaciones) debe ser la última operación (si no, se eliminaron las últimas).
+// - Quien reescriba la cadena completa la deja consistente: lo detectan los anclajes, firmados fuera de MySQL.
+// Los anclajes con firma válida para ClavePublica deben coincidir con el Hash de su operación; sin ClavePublica
+// no se verifican los anclajes.
+func (ga *GestorOperaciones) Verificar(ctx context.Context, Anclajes []models.AnclajesOperaciones, ClavePublica ed25519.PublicKey) (*models.VerificacionOperaciones, error) {
+	idCabeza, hashCabeza, err := ga.auditoria.DameCabeza(ctx)
+	if err != nil {
+		return nil, err
+	}
+	v := &models.VerificacionOperaciones{IdOperacion: idCabeza, Hash: hashCabeza, Incidencias: make([]models.IncidenciasOperaciones, 0)}
+	incidencia := func(IdOperacion int, Tipo string, Detalle string, args ...any) {
+		v.Incidencias = append(v.Incidencias, models.IncidenciasOperaciones{IdOperacion: IdOperacion, Tipo: Tipo, Detalle: fmt.Sprintf(Detalle, args...)})
+	}
+
+	// anclajes válidos por IdOperacion
+	anclajes := make(map[int][]models.AnclajesOperaciones)
+	if ClavePublica != nil {
+		for _, a := range Anclajes {
+			if !a.FirmaValida(ClavePublica) {
+				incidencia(a.IdOperacion, models.IncidenciaAnclajeInvalido, "La firma del anclaje del %s no es válida.", a.Fecha.Format("2006-01-02 15:04:05"))
+				continue
+			}
+			anclajes[a.IdOperacion] = append(anclajes[a.IdOperacion], a)
+		}
+	}
+	verificarAnclajes := func(op models.Operaciones) {
+		for _, a := range anclajes[op.IdOperacion] {
+			v.AnclajesVerificados++
+			if a.Hash != op.Hash {
+				incidencia(op.IdOperacion, models.IncidenciaOperacionModificada, "El Hash no coincide con el anclado el %s: la cadena se recalculó hasta esta operación o una posterior.", a.Fecha.Format("2006-01-02 15:04:05"))
+			}
+		}
+		delete(anclajes, op.IdOperacion)
+	}
+
+	idAnterior, hashAnterior := 0, models.HashInicialOperaciones
+	// la operación anterior coincide con su contenido y con la cadena hasta ella
+	anteriorValida := false
+	for {
+		operaciones, err := ga.auditoria.ListarCadena(ctx, idAnterior, paginaCadenaOperaciones)
+		if err != nil {
+			return nil, err
+		}
+		for _, op := range operaciones {
+			v.OperacionesVerificadas++
+			valida := true
+			if op.IdOperacion != idAnterior+1 {
+				incidencia(idAnterior+1, models.IncidenciaOperacionEliminada, "Se eliminaron las operaciones %d a %d.", idAnterior+1, op.IdOperacion-1)
+			} else if op.CalcularHash(hashAnterior) != op.Hash {
+				valida = false
+				incidencia(op.IdOperacion, models.IncidenciaOperacionModificada, "El Hash no coincide con el contenido de la operación y el Hash de la anterior.")
+				// si la anterior es consistente, pudo ser ella la modificada junto con su Hash (la cadena se recalculó
+				// desde ella, pero no las siguientes): no se puede distinguir sin un anclaje
+				if anteriorValida {
+					incidencia(idAnterior, models.IncidenciaOperacionModificada, "La operación %d no encadena con esta: esta pudo modificarse recalculando su Hash (la cadena se recalculó desde aquí).", op.IdOperacion)
+				}
+			}
+			anteriorValida = valida
+			verificarAnclajes(op)
+			idAnterior, hashAnterior = op.IdOperacion, op.Hash
+		}
+		if len(operaciones) < paginaCadenaOperaciones {
+			break
+		}
+	}
+
+	// operaciones posteriores a la última de la tabla, según la cabeza o los anclajes
+	ultimaEliminada := idCabeza
+	for id := range anclajes {
+		ultimaEliminada = max(ultimaEliminada, id)
+	}
+	if ultimaEliminada > idAnterior {
+		incidencia(idAnterior+1, models.IncidenciaOperacionEliminada, "Se eliminaron las operaciones %d a %d.", idAnterior+1, ultimaEliminada)
+	} else if idCabeza != idAnterior || hashCabeza != hashAnterior {
+		incidencia(idAnterior, models.IncidenciaOperacionModificada, "La cabeza de la cadena (IdOperacion %d) no coincide con la última operación.", idCabeza)
+	}
+
+	sort.SliceStable(v.Incidencias, func(i, j int) bool { return v.Incidencias[i].IdOperacion < v.Incidencias[j].IdOperacion })
+	v.Integra = len(v.Incidencias) == 0
+	if !v.Integra {
+		logs.L(logs.App).WarnContext(ctx, "la cadena de auditoría tiene incidencias", "incidencias", len(v.Incidencias), "IdOperacion", idCabeza)
+	}
+	return v, nil
+}
+
+// Audita una operación que el MS realiza en TigerBeetle, a nombre del actor del contexto.
+// Es best-effort: la operación ya se realizó y no se puede deshacer, así que si no se registra solo se loguea.
+// tsp_registrar_operacion
+func auditar(ctx context.Context, auditoria repositorios.Auditoria, TipoOperacion string, Detalles map[string]any) {
+	mensaje, err := auditoria.Registrar(ctx, TipoOperacion, Detalles)
+	if err != nil || mensaje != "OK" {
+		logs.L(logs.App).ErrorContext(ctx, "no se pudo auditar la operación", "tipo_operacion", TipoOperacion, "mensaje", mensaje, logs.Err(err), "detalles", Detalles)
+	}
+}
@@ -0,0 +1,256 @@
+package gestores
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"MSTransaccionesFinancieras/internal/repositorios/memoria"
+
+	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+)
+
+// Operaciones auditadas de un tipo, de la más antigua a la más reciente, con sus Detalles decodificados
+func (e *entorno) operacionesAuditadas(t *testing.T, TipoOperacion string) []map[string]any {
+	t.Helper()
+	_, ops, err := NewGestorOperaciones(e.repos.Auditoria).Buscar(t.Context(), repositorios.FiltroOperaciones{TipoOperacion: TipoOperacion})
+	if err != nil {
+		t.Fatalf("Buscar %s: %v", TipoOperacion, err)
+	}
+	detalles := make([]map[string]any, 0, len(ops))
+	for i := len(ops) - 1; i >= 0; i-- {
+		if ops[i].IdUsuario != nil {
+			t.Fatalf("operación %s sin credencial debe ser del sistema: %+v", TipoOperacion, ops[i])
+		}
+		d := map[string]any{}
+		if err := json.Unmarshal(ops[i].Detalles, &d); err != nil {
+			t.Fatalf("Detalles de %s: %v", TipoOperacion, err)
+		}
+		detalles = append(detalles, d)
+	}
+	return detalles
+}
+
+func TestAuditoriaCuentas(t *testing.T) {
+	e := nuevoEntorno(t)
+	gc := e.gestorCuentas()
+
+	// la cuenta empresa del entorno y la del usuario; el reintento idempotente no se audita
+	e.crearCuentaUsuario(t, 7)
+	e.crearCuentaUsuario(t, 7)
+	if _, err := gc.CrearLote(t.Context(), []CuentaNueva{
+		{IdMoneda: monedaTest, IdUsuarioFinal: 7, Fecha: "2026-01-01", DebitosNoDebenExcederCreditos: true},
+		{IdMoneda: monedaTest, IdUsuarioFinal: 8, Fecha: "2026-01-01", DebitosNoDebenExcederCreditos: true},
+	}); err != nil {
+		t.Fatalf("CrearLote: %v", err)
+	}
+	creadas := e.operacionesAuditadas(t, models.OperacionCreacionCuenta)
+	if len(creadas) != 3 || creadas[0]["IdUsuarioFinal"] != float64(0) || creadas[1]["IdUsuarioFinal"] != float64(7) ||
+		creadas[2]["IdUsuarioFinal"] != float64(8) || creadas[2]["Antes"] != nil {
+		t.Fatalf("auditoría CC: %+v", creadas)
+	}
+	if despues := creadas[2]["Despues"].(map[string]any); despues["Estado"] != "A" || despues["DebitosNoDebenExcederCreditos"] != true {
+		t.Fatalf("auditoría CC, Despues: %+v", despues)
+	}
+
+	// desactivar y activar auditan el cambio de estado; las llamadas idempotentes no
+	cuenta := &models.Cuentas{IdMoneda: monedaTest, IdUsuarioFinal: 7}
+	for range 2 {
+		if err := gc.Desactivar(t.Context(), cuenta); err != nil {
+			t.Fatalf("Desactivar: %v", err)
+		}
+	}
+	if cuenta.Estado != "I" {
+		t.Fatalf("Desactivar debe instanciar el estado posterior: %+v", cuenta)
+	}
+	for range 2 {
+		if err := gc.Activar(t.Context(), cuenta); err != nil {
+			t.Fatalf("Activar: %v", err)
+		}
+	}
+	desactivadas := e.operacionesAuditadas(t, models.OperacionDesactivacionCuenta)
+	activadas := e.operacionesAuditadas(t, models.OperacionActivacionCuenta)
+	if len(desactivadas) != 1 || len(activadas) != 1 {
+		t.Fatalf("auditoría DC/AC: %+v %+v", desactivadas, activadas)
+	}
+	antes, despues := desactivadas[0]["Antes"].(map[string]any), desactivadas[0]["Despues"].(map[string]any)
+	if antes["Estado"] != "A" || despues["Estado"] != "I" || despues["Creditos"] != "0.00" {
+		t.Fatalf("auditoría DC: %+v", desactivadas[0])
+	}
+	if activadas[0]["Antes"].(map[string]any)["Estado"] != "I" || activadas[0]["Despues"].(map[string]any)["Estado"] != "A" {
+		t.Fatalf("auditoría AC: %+v", activadas[0])
+	}
+}
+
+func TestAuditoriaReversion(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearCuentaUsuario(t, 7)
+	original := nueva(1, 7, "I", 1000)
+	e.crearLote(t, original)
+
+	tr, msg := reversion(original.tr, 7)
+	e.crearLote(t, transferenciaTest{tr, msg})
+	// reintento de la misma reversión (OK - Reintento): ya se auditó
+	e.crearLote(t, transferenciaTest{tr, msg})
+
+	revertidas := e.operacionesAuditadas(t, models.OperacionReversionTransferencia)
+	if len(revertidas) != 1 || revertidas[0]["IdTransferencia"] != "1" || revertidas[0]["Monto"] != "10.00" {
+		t.Fatalf("auditoría RT: %+v", revertidas)
+	}
+	verificarEstadosReversion(t, revertidas[0])
+
+	// búsqueda por entidad: la transferencia original
+	ga := NewGestorOperaciones(e.repos.Auditoria)
+	mensaje, ops, err := ga.Buscar(t.Context(), repositorios.FiltroOperaciones{Entidad: "Transferencia", IdEntidad: "1"})
+	if err != nil || mensaje != "OK" || len(ops) != 1 || ops[0].TipoOperacion != models.OperacionReversionTransferencia {
+		t.Fatalf("Buscar por transferencia: %q %+v %v", mensaje, ops, err)
+	}
+}
+
+// TB registra la reversión pero la respuesta se pierde antes de auditarla: el reintento (TransferExists) la audita
+// una única vez, con los estados leídos de TB
+func TestAuditoriaReversionRespuestaPerdida(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearCuentaUsuario(t, 7)
+	original := nueva(1, 7, "I", 1000)
+	e.crearLote(t, original)
+
+	tr, msg := reversion(original.tr, 7)
+	if results, err := e.tb.CreateTransfers([]types.Transfer{tr}); err != nil || len(results) != 0 {
+		t.Fatalf("CreateTransfers: %+v %v", results, err)
+	}
+	if revertidas := e.operacionesAuditadas(t, models.OperacionReversionTransferencia); len(revertidas) != 0 {
+		t.Fatalf("la reversión no llegó a auditarse: %+v", revertidas)
+	}
+
+	for range 2 {
+		notificaciones := e.crearLote(t, transferenciaTest{tr, msg})
+		if notificaciones[0].Mensaje != "OK - Reintento" {
+			t.Fatalf("reintento: %+v", notificaciones[0])
+		}
+	}
+	revertidas := e.operacionesAuditadas(t, models.OperacionReversionTransferencia)
+	if len(revertidas) != 1 || revertidas[0]["IdTransferencia"] != "1" || revertidas[0]["IdCorrelacion"] != msg.IdCorrelacion {
+		t.Fatalf("auditoría RT: %+v", revertidas)
+	}
+	verificarEstadosReversion(t, revertidas[0])
+}
+
+// Reversión de un ingreso de 10.00: la original pasa de F a R y la cuenta del usuario suma 10.00 de débitos
+func verificarEstadosReversion(t *testing.T, detalles map[string]any) {
+	t.Helper()
+	antes, despues := detalles["Antes"].(map[string]any), detalles["Despues"].(map[string]any)
+	if antes["Estado"] != "F" || antes["Creditos"] != "10.00" || antes["Debitos"] != "0.00" {
+		t.Fatalf("auditoría RT, Antes: %+v", antes)
+	}
+	if despues["Estado"] != "R" || despues["Creditos"] != "10.00" || despues["Debitos"] != "10.00" {
+		t.Fatalf("auditoría RT, Despues: %+v", despues)
+	}
+}
+
+func TestBuscarOperacionesValidaciones(t *testing.T) {
+	e := nuevoEntorno(t)
+	ga := NewGestorOperaciones(e.repos.Auditoria)
+	ahora := time.Now()
+
+	casos := []struct {
+		filtro  repositorios.FiltroOperaciones
+		mensaje string
+	}{
+		{repositorios.FiltroOperaciones{Entidad: "Sesion"}, "La entidad debe ser Moneda, Parametro, Usuario, Rol, ApiKey, Cuenta o Transferencia."},
+		{repositorios.FiltroOperaciones{IdEntidad: "1"}, "IdEntidad requiere Entidad."},
+		{repositorios.FiltroOperaciones{FechaInicio: ahora, FechaFin: ahora}, "FechaFin debe ser posterior a FechaInicio."},
+	}
+	for _, c := range casos {
+		if mensaje, _, _ := ga.Buscar(t.Context(), c.filtro); mensaje != c.mensaje {
+			t.Fatalf("Buscar %+v: %q", c.filtro, mensaje)
+		}
+	}
+
+	// la cuenta empresa del entorno se creó antes de ahora
+	if _, ops, _ := ga.Buscar(t.Context(), repositorios.FiltroOperaciones{FechaInicio: ahora.Add(-time.Minute), FechaFin: ahora.Add(time.Minute)}); len(ops) != 1 {
+		t.Fatalf("Buscar en el rango: %+v", ops)
+	}
+	if _, ops, _ := ga.Buscar(t.Context(), repositorios.FiltroOperaciones{FechaInicio: ahora.Add(time.Minute)}); len(ops) != 0 {
+		t.Fatalf("Buscar después del rango: %+v", ops)
+	}
+}
+
+// Base con n operaciones auditadas (MP) y un anclaje firmado de la cabeza de la cadena
+func cadenaOperaciones(t *testing.T, n int, clave ed25519.PrivateKey) (*memoria.BaseDatos, models.AnclajesOperaciones) {
+	t.Helper()
+	bd := memoria.New()
+	auditoria := bd.Repositorios().Auditoria
+	for i := range n {
+		if mensaje, err := auditoria.Registrar(t.Context(), "MP", map[string]any{"Parametro": "MONTOMAXTRANSFER", "Valor": i}); err != nil || mensaje != "OK" {
+			t.Fatalf("Registrar: %q %v", mensaje, err)
+		}
+	}
+	id, hash, err := auditoria.DameCabeza(t.Context())
+	if err != nil || id != n {
+		t.Fatalf("DameCabeza: %d %v", id, err)
+	}
+	anclaje := models.AnclajesOperaciones{IdOperacion: id, Hash: hash, Fecha: time.Now()}
+	anclaje.Firmar(clave)
+	return bd, anclaje
+}
+
+func TestVerificarOperaciones(t *testing.T) {
+	publica, clave, _ := ed25519.GenerateKey(nil)
+	_, otraClave, _ := ed25519.GenerateKey(nil)
+
+	casos := []struct {
+		nombre      string
+		alterar     func(bd *memoria.BaseDatos)
+		incidencias []models.IncidenciasOperaciones
+	}{
+		{"íntegra", func(*memoria.BaseDatos) {}, nil},
+		// la anterior se informa como posible modificada con su Hash: sin un anclaje no se distingue del caso siguiente
+		{"modificada", func(bd *memoria.BaseDatos) { bd.AlterarOperacion(3, `{"Valor": 100}`, false) },
+			[]models.IncidenciasOperaciones{{IdOperacion: 2, Tipo: models.IncidenciaOperacionModificada}, {IdOperacion: 3, Tipo: models.IncidenciaOperacionModificada}}},
+		// modificada junto con su Hash: es consistente, la que no encadena es la siguiente
+		{"modificada con su hash", func(bd *memoria.BaseDatos) { bd.ReescribirOperacion(3, `{"Valor": 100}`) },
+			[]models.IncidenciasOperaciones{{IdOperacion: 3, Tipo: models.IncidenciaOperacionModificada}, {IdOperacion: 4, Tipo: models.IncidenciaOperacionModificada}}},
+		{"primera modificada con su hash", func(bd *memoria.BaseDatos) { bd.ReescribirOperacion(1, `{"Valor": 100}`) },
+			[]models.IncidenciasOperaciones{{IdOperacion: 1, Tipo: models.IncidenciaOperacionModificada}, {IdOperacion: 2, Tipo: models.IncidenciaOperacionModificada}}},
+		{"primera modificada", func(bd *memoria.BaseDatos) { bd.AlterarOperacion(1, `{"Valor": 100}`, false) },
+			[]models.IncidenciasOperaciones{{IdOperacion: 1, Tipo: models.IncidenciaOperacionModificada}}},
+		{"eliminada en el medio", func(bd *memoria.BaseDatos) { bd.EliminarOperacion(2); bd.EliminarOperacion(3) },
+			[]models.IncidenciasOperaciones{{IdOperacion: 2, Tipo: models.IncidenciaOperacionEliminada}}},
+		{"eliminada al final", func(bd *memoria.BaseDatos) { bd.EliminarOperacion(5) },
+			[]models.IncidenciasOperaciones{{IdOperacion: 5, Tipo: models.IncidenciaOperacionEliminada}}},
+		// la cadena recalculada queda consistente: solo la delata el anclaje
+		{"recalculada", func(bd *memoria.BaseDatos) { bd.AlterarOperacion(3, `{"Valor": 100}`, true) },
+			[]models.IncidenciasOperaciones{{IdOperacion: 5, Tipo: models.IncidenciaOperacionModificada}}},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			bd, anclaje := cadenaOperaciones(t, 5, clave)
+			c.alterar(bd)
+			v, err := NewGestorOperaciones(bd.Repositorios().Auditoria).Verificar(t.Context(), []models.AnclajesOperaciones{anclaje}, publica)
+			if err != nil {
+				t.Fatalf("Verificar: %v", err)
+			}
+			if v.Integra != (len(c.incidencias) == 0) || len(v.Incidencias) != len(c.incidencias) {
+				t.Fatalf("Verificar: %+v", v)
+			}
+			for i, inc := range c.incidencias {
+				if v.Incidencias[i].IdOperacion != inc.IdOperacion || v.Incidencias[i].Tipo != inc.Tipo {
+					t.Fatalf("incidencia %d: %+v", i, v.Incidencias[i])
+				}
+			}
+		})
+	}
+
+	// anclaje con firma de otra clave: se reporta y no se usa para verificar
+	bd, anclaje := cadenaOperaciones(t, 2, clave)
+	anclaje.Firmar(otraClave)
+	bd.AlterarOperacion(1, `{}`, true)
+	v, err := NewGestorOperaciones(bd.Repositorios().Auditoria).Verificar(t.Context(), []models.AnclajesOperaciones{anclaje}, publica)
+	if err != nil || v.Integra || len(v.Incidencias) != 1 || v.Incidencias[0].Tipo != models.IncidenciaAnclajeInvalido || v.AnclajesVerificados != 0 {
+		t.Fatalf("Verificar con anclaje inválido: %+v %v", v, err)
+	}
+}
@@ -0,0 +1,36 @@
+package gestores
+
+import (
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"context"
+)
+
+type GestorParametros struct {
+	parametros repositorios.Parametros
+}
+
+func NewGestorParametros(parametros repositorios.Parametros) *GestorParametros {
+	return &GestorParametros{parametros: parametros}
+}
+
+// Instancia el valor del parámetro (Parametro.Parametro).
+// tsp_dame_parametro
+func (gp *GestorParametros) Dame(ctx context.Context, Parametro *models.Parametros) (string, error) {
+	return gp.parametros.Dame(ctx, Parametro)
+}
+
+// Permite buscar los parámetros modificables del sistema según su nombre.
+// tsp_buscar_parametros
+// - Cadena: texto a buscar dentro del nombre del parámetro (puede ser parte del nombre o el nombre completo)
+func (gp *GestorParametros) Buscar(ctx context.Context, Cadena string) ([]models.Parametros, error) {
+	return gp.parametros.Buscar(ctx, Cadena, "S")
+}
+
+// Permite modificar el valor de un parámetro siempre y cuando exista y sea modificable.
+// tsp_modificar_parametro
+// - Parametro.Parametro: clave del parámetro a modificar
+// - Valor: nuevo valor del parámetro
+func (gp *GestorParametros) Modificar(ctx context.Context, Parametro models.Parametros, Valor string) (string, error) {
+	return gp.parametros.Modificar(ctx, Parametro.Parametro, Valor)
+}
@@ -0,0 +1,76 @@
+package gestores
+
+import (
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"context"
+	"strings"
+)
+
+type GestorRoles struct {
+	roles repositorios.Roles
+}
+
+func NewGestorRoles(roles repositorios.Roles) *GestorRoles {
+	return &GestorRoles{roles: roles}
+}
+
+// Instancia el rol (Rol.Rol) con sus permisos.
+// tsp_dame_rol
+func (gr *GestorRoles) Dame(ctx context.Context, Rol *models.Roles) (string, error) {
+	Rol.Rol = strings.ToUpper(Rol.Rol)
+	return gr.roles.Dame(ctx, Rol)
+}
+
+// Permite listar los roles con sus permisos y la cantidad de usuarios de cada uno.
+// tsp_listar_roles
+func (gr *GestorRoles) Listar(ctx context.Context) ([]models.Roles, error) {
+	return gr.roles.Listar(ctx)
+}
+
+// Permite listar el catálogo de permisos que se pueden otorgar a los roles.
+// tsp_listar_permisos
+func (gr *GestorRoles) ListarPermisos(ctx context.Context) ([]models.Permisos, error) {
+	return gr.roles.ListarPermisos(ctx)
+}
+
+// Permite crear un rol con sus permisos.
+// tsp_crear_rol
+// - Rol.Rol: código del rol, una letra
+// - Rol.Nombre: nombre único del rol
+// - Rol.Permisos: permisos del catálogo que otorga el rol
+func (gr *GestorRoles) Crear(ctx context.Context, Rol models.Roles) (string, error) {
+	return gr.roles.Crear(ctx, normalizarRol(Rol))
+}
+
+// Permite modificar el nombre de un rol y reemplazar sus permisos. El rol A (Administrador) no se puede modificar.
+// Los permisos nuevos rigen desde el próximo request de los usuarios del rol (para la API key del sistema,
+// rol S, hasta 5 minutos después).
+// tsp_modificar_rol
+func (gr *GestorRoles) Modificar(ctx context.Context, Rol models.Roles) (string, error) {
+	return gr.roles.Modificar(ctx, normalizarRol(Rol))
+}
+
+// Permite borrar un rol sin usuarios asignados. Los roles A (Administrador) y S (Sistema) no se pueden borrar.
+// tsp_borrar_rol
+func (gr *GestorRoles) Borrar(ctx context.Context, Rol models.Roles) (string, error) {
+	return gr.roles.Borrar(ctx, strings.ToUpper(Rol.Rol))
+}
+
+// Permite asignar un rol a un usuario distinto del de la sesión.
+// tsp_asignar_rol_usuario
+// - Usuario.IdUsuario: usuario al que se asigna el rol
+// - Usuario.Rol: código del rol
+func (gr *GestorRoles) AsignarUsuario(ctx context.Context, Usuario models.Usuarios) (string, error) {
+	return gr.roles.AsignarUsuario(ctx, Usuario.IdUsuario, strings.ToUpper(Usuario.Rol))
+}
+
+// Código en mayúscula, nombre sin espacios en los extremos y lista de permisos no nula
+func normalizarRol(Rol models.Roles) models.Roles {
+	Rol.Rol = strings.ToUpper(Rol.Rol)
+	Rol.Nombre = strings.TrimSpace(Rol.Nombre)
+	if Rol.Permisos == nil {
+		Rol.Permisos = []string{}
+	}
+	return Rol
+}
@@ -0,0 +1,146 @@
+package gestores
+
+import (
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"MSTransaccionesFinancieras/internal/utils"
+	"context"
+	"slices"
+	"time"
+)
+
+// Cantidad de códigos de recuperación que se generan al activar el segundo factor
+const cantidadCodigosRecuperacion = 10
+
+// Mensajes de tsp_completar_login_usuario por código inválido, que cuentan como intento de login fallido
+var mensajesCodigoInvalido = []string{"El código es inválido.", "Demasiados códigos inválidos. Vuelva a iniciar sesión."}
+
+type GestorSegundoFactor struct {
+	segundoFactor repositorios.SegundoFactor
+	usuarios      repositorios.Usuarios
+	roles         repositorios.Roles
+	parametros    repositorios.Parametros
+}
+
+func NewGestorSegundoFactor(segundoFactor repositorios.SegundoFactor, usuarios repositorios.Usuarios, roles repositorios.Roles, parametros repositorios.Parametros) *GestorSegundoFactor {
+	return &GestorSegundoFactor{segundoFactor: segundoFactor, usuarios: usuarios, roles: roles, parametros: parametros}
+}
+
+// Inicia la inscripción del segundo factor (TOTP): genera el secreto y devuelve también la URI otpauth://
+// para darlo de alta en una app autenticadora. Queda pendiente hasta verificar el primer código.
+// Con TokenDesafio "" inscribe al usuario de la sesión (opcional, se activa con Activar); si no, al del desafío
+// de login de inscripción (su rol lo exige, se activa con CompletarLogin).
+// tsp_inscribir_segundo_factor
+func (gf *GestorSegundoFactor) Inscribir(ctx context.Context, TokenDesafio string) (string, string, string, error) {
+	secreto, err := utils.GenerarSecretoTOTP()
+	if err != nil {
+		return "", "", "", err
+	}
+	mensaje, usuario, err := gf.segundoFactor.Inscribir(ctx, TokenDesafio, secreto)
+	if err != nil || mensaje != "OK" {
+		return mensaje, "", "", err
+	}
+	return mensaje, secreto, utils.URITOTP(usuario, secreto), nil
+}
+
+// Permite al usuario de la sesión activar su segundo factor pendiente con un código de su app autenticadora.
+// Devuelve los códigos de recuperación, que se informan solo esta vez (se guarda su SHA-256).
+// tsp_dame_segundo_factor, tsp_activar_segundo_factor
+func (gf *GestorSegundoFactor) Activar(ctx context.Context, Codigo string) (string, []string, error) {
+	f := &models.SegundoFactor{}
+	mensaje, err := gf.segundoFactor.Dame(ctx, "", f)
+	if err != nil || mensaje != "OK" {
+		return mensaje, nil, err
+	}
+	switch f.Estado {
+	case "":
+		return "No hay una inscripción pendiente del segundo factor.", nil, nil
+	case "A":
+		return "El segundo factor ya está activo.", nil, nil
+	}
+	paso := utils.VerificarTOTP(f.Secreto, Codigo, time.Now(), f.UltimoPaso)
+	if paso == 0 {
+		return "El código es inválido.", nil, nil
+	}
+	codigos, hashes, err := nuevosCodigosRecuperacion()
+	if err != nil {
+		return "", nil, err
+	}
+	mensaje, err = gf.segundoFactor.Activar(ctx, paso, hashes)
+	if err != nil || mensaje != "OK" {
+		return mensaje, nil, err
+	}
+	return mensaje, codigos, nil
+}
+
+// Completa un login que requiere segundo factor (GestorUsuarios.Login) con un código TOTP o un código de
+// recuperación, que se consume. Cinco códigos inválidos descartan el desafío. Cada código inválido cuenta
+// además como intento de login fallido del usuario (ver GestorUsuarios.Login y *ErrorBloqueoLogin).
+// Si el desafío es de inscripción, activa el segundo factor y devuelve los códigos de recuperación generados.
+// Instancia Usuario con los datos del usuario y los permisos de su rol, y Sesion con la sesión y sus tokens.
+// tsp_dame_segundo_factor, tsp_reservar_intento_login, tsp_completar_login_usuario, tsp_registrar_login_fallido,
+// tsp_liberar_intento_login, tsp_dame_rol
+// - Sesion.Dispositivo, Sesion.IP: datos informativos del cliente
+func (gf *GestorSegundoFactor) CompletarLogin(ctx context.Context, TokenDesafio string, Codigo string, Usuario *models.Usuarios, Sesion *models.Sesiones) (string, []string, error) {
+	f := &models.SegundoFactor{}
+	mensaje, err := gf.segundoFactor.Dame(ctx, TokenDesafio, f)
+	if err != nil || mensaje != "OK" {
+		return mensaje, nil, err
+	}
+	if err := reservarIntentoLogin(ctx, gf.usuarios, gf.parametros, f.Usuario, Sesion.IP); err != nil {
+		return "", nil, err
+	}
+	// Sin código TOTP válido se prueba como código de recuperación; el SP cuenta el intento si tampoco lo es
+	var paso int64
+	if f.Secreto != "" {
+		paso = utils.VerificarTOTP(f.Secreto, Codigo, time.Now(), f.UltimoPaso)
+	}
+	codigoRecuperacion := ""
+	if normalizado := utils.NormalizarCodigoRecuperacion(Codigo); paso == 0 && normalizado != "" {
+		codigoRecuperacion = utils.HashToken(normalizado)
+	}
+	var codigos, hashes []string
+	if f.Estado == "P" {
+		if codigos, hashes, err = nuevosCodigosRecuperacion(); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := generarTokens(Sesion); err != nil {
+		return "", nil, err
+	}
+	mensaje, err = gf.segundoFactor.CompletarLogin(ctx, TokenDesafio, paso, codigoRecuperacion, hashes, Usuario, Sesion,
+		obtenerPoliticaSesion(gf.parametros))
+	if err != nil || mensaje != "OK" {
+		Sesion.TokenSesion, Sesion.RefreshToken = "", ""
+		if err == nil && slices.Contains(mensajesCodigoInvalido, mensaje) {
+			err = registrarLoginFallido(ctx, gf.usuarios, gf.parametros, f.Usuario, Sesion.IP)
+		} else {
+			liberarIntentoLogin(ctx, gf.usuarios, f.Usuario)
+		}
+		return mensaje, nil, err
+	}
+	if err := cargarPermisos(ctx, gf.roles, Usuario); err != nil {
+		return "", nil, err
+	}
+	return mensaje, codigos, nil
+}
+
+// Permite a un administrador borrar el segundo factor de un usuario que perdió su dispositivo. Cierra sus
+// sesiones; si su rol lo exige, se inscribe de nuevo en el próximo login.
+// tsp_restablecer_segundo_factor_usuario
+func (gf *GestorSegundoFactor) Restablecer(ctx context.Context, Usuario models.Usuarios) (string, error) {
+	return gf.segundoFactor.Restablecer(ctx, Usuario.IdUsuario)
+}
+
+// Códigos de recuperación para informar al usuario y sus SHA-256 para guardar
+func nuevosCodigosRecuperacion() ([]string, []string, error) {
+	codigos, err := utils.GenerarCodigosRecuperacion(cantidadCodigosRecuperacion)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codigos))
+	for i, c := range codigos {
+		hashes[i] = utils.HashToken(utils.NormalizarCodigoRecuperacion(c))
+	}
+	return codigos, hashes, nil
+}
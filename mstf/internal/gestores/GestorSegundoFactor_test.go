@@ -0,0 +1,172 @@
+package gestores
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"MSTransaccionesFinancieras/internal/repositorios/memoria"
+	"MSTransaccionesFinancieras/internal/utils"
+)
+
+func codigoTOTP(t *testing.T, secreto string, paso int64) string {
+	t.Helper()
+	codigo, err := utils.CodigoTOTP(secreto, paso)
+	if err != nil {
+		t.Fatalf("CodigoTOTP: %v", err)
+	}
+	return codigo
+}
+
+// Login con contraseña que debe devolver un desafío de segundo factor en lugar de la sesión
+func loginConDesafio(t *testing.T, gu *GestorUsuarios, usuario string, password string) *models.DesafiosLogin {
+	t.Helper()
+	s := &models.Sesiones{}
+	d := &models.DesafiosLogin{}
+	mensaje, err := gu.Login(t.Context(), &models.Usuarios{Usuario: usuario}, password, s, d)
+	if err != nil || !strings.HasPrefix(mensaje, "OK - Se requiere") || len(d.TokenDesafio) != 32 || s.TokenSesion != "" {
+		t.Fatalf("Login %s con segundo factor: %q %v %+v %+v", usuario, mensaje, err, d, s)
+	}
+	return d
+}
+
+func TestSegundoFactorOpcional(t *testing.T) {
+	bd := memoria.New()
+	bd.GuardarUsuario(models.Usuarios{Usuario: "operador", Rol: "O"}, "Operador1")
+	repos := bd.Repositorios()
+	gu := NewGestorUsuarios(repos.Usuarios, repos.Roles, repos.Parametros)
+	gf := NewGestorSegundoFactor(repos.SegundoFactor, repos.Usuarios, repos.Roles, repos.Parametros)
+	ctx := ctxSesion(iniciarSesion(t, gu, "operador", "Operador1", "notebook").TokenSesion)
+
+	mensaje, secreto, uri, err := gf.Inscribir(ctx, "")
+	if err != nil || mensaje != "OK" || len(secreto) != 32 || !strings.HasPrefix(uri, "otpauth://totp/MSTF:operador?") ||
+		!strings.Contains(uri, "secret="+secreto) {
+		t.Fatalf("Inscribir: %q %q %q %v", mensaje, secreto, uri, err)
+	}
+	// pendiente: el login sigue sin pedir código
+	iniciarSesion(t, gu, "operador", "Operador1", "celular")
+
+	paso := utils.PasoTOTP(time.Now())
+	if mensaje, _, _ := gf.Activar(ctx, "000000x"); mensaje != "El código es inválido." {
+		t.Fatalf("Activar con código inválido: %q", mensaje)
+	}
+	mensaje, codigos, err := gf.Activar(ctx, codigoTOTP(t, secreto, paso))
+	if err != nil || mensaje != "OK" || len(codigos) != 10 || len(codigos[0]) != 11 {
+		t.Fatalf("Activar: %q %v %v", mensaje, codigos, err)
+	}
+	if mensaje, _, _ := gf.Activar(ctx, codigoTOTP(t, secreto, paso+1)); mensaje != "El segundo factor ya está activo." {
+		t.Fatalf("Activar dos veces: %q", mensaje)
+	}
+
+	// el login pide el código; el ya usado al activar no vale de nuevo
+	d := loginConDesafio(t, gu, "operador", "Operador1")
+	if d.Inscripcion || time.Until(d.FechaExpiracion) > 5*time.Minute {
+		t.Fatalf("desafío de verificación: %+v", d)
+	}
+	u := &models.Usuarios{}
+	s := &models.Sesiones{}
+	if mensaje, _, _ := gf.CompletarLogin(t.Context(), d.TokenDesafio, codigoTOTP(t, secreto, paso), u, s); mensaje != "El código es inválido." || s.TokenSesion != "" {
+		t.Fatalf("CompletarLogin con código reutilizado: %q %+v", mensaje, s)
+	}
+	mensaje, nuevos, err := gf.CompletarLogin(t.Context(), d.TokenDesafio, codigoTOTP(t, secreto, paso+1), u, s)
+	if err != nil || mensaje != "OK" || nuevos != nil || len(s.TokenSesion) != 32 || u.SegundoFactor != "S" || len(u.Permisos) == 0 {
+		t.Fatalf("CompletarLogin: %q %v %v %+v %+v", mensaje, nuevos, err, u, s)
+	}
+	if mensaje, _, _ := repos.Autenticacion.Autenticar(t.Context(), s.TokenSesion, "USUARIO", "10.0.0.1"); mensaje != "OK" {
+		t.Fatalf("sesión del segundo paso: %q", mensaje)
+	}
+	if mensaje, _, _ := gf.CompletarLogin(t.Context(), d.TokenDesafio, codigoTOTP(t, secreto, paso+2), u, &models.Sesiones{}); mensaje != "El desafío expiró. Vuelva a iniciar sesión." {
+		t.Fatalf("CompletarLogin con desafío usado: %q", mensaje)
+	}
+
+	// código de recuperación (en mayúsculas y sin guion también vale), una sola vez
+	d = loginConDesafio(t, gu, "operador", "Operador1")
+	recuperacion := strings.ToUpper(strings.ReplaceAll(codigos[3], "-", ""))
+	if mensaje, _, err := gf.CompletarLogin(t.Context(), d.TokenDesafio, recuperacion, u, &models.Sesiones{}); err != nil || mensaje != "OK" {
+		t.Fatalf("CompletarLogin con código de recuperación: %q %v", mensaje, err)
+	}
+	d = loginConDesafio(t, gu, "operador", "Operador1")
+	if mensaje, _, _ := gf.CompletarLogin(t.Context(), d.TokenDesafio, codigos[3], u, &models.Sesiones{}); mensaje != "El código es inválido." {
+		t.Fatalf("CompletarLogin con código de recuperación usado: %q", mensaje)
+	}
+
+	// al quinto código inválido se descarta el desafío; como cada código inválido cuenta como login fallido,
+	// con LOGININTENTOSMAX por defecto (5) además se bloquea el usuario
+	for i := 2; i <= 5; i++ {
+		mensaje, _, err = gf.CompletarLogin(t.Context(), d.TokenDesafio, "123456", u, &models.Sesiones{})
+	}
+	var bloqueo *ErrorBloqueoLogin
+	if mensaje != "Demasiados códigos inválidos. Vuelva a iniciar sesión." || !errors.As(err, &bloqueo) {
+		t.Fatalf("quinto código inválido: %q %v", mensaje, err)
+	}
+	if _, err := gu.Login(t.Context(), &models.Usuarios{Usuario: "operador"}, "Operador1", &models.Sesiones{}, &models.DesafiosLogin{}); !errors.As(err, &bloqueo) {
+		t.Fatalf("login tras el bloqueo por códigos inválidos: %v", err)
+	}
+	if mensaje, _, _ := gf.CompletarLogin(t.Context(), d.TokenDesafio, codigos[4], u, &models.Sesiones{}); mensaje != "El desafío expiró. Vuelva a iniciar sesión." {
+		t.Fatalf("CompletarLogin con desafío descartado: %q", mensaje)
+	}
+}
+
+func TestSegundoFactorObligatorioYRestablecer(t *testing.T) {
+	bd := memoria.New()
+	admin := bd.GuardarUsuario(models.Usuarios{Usuario: "admin"}, "Admin123")
+	operador := bd.GuardarUsuario(models.Usuarios{Usuario: "operador", Rol: "O"}, "Operador1")
+	bd.GuardarParametro(models.Parametros{Parametro: "TOTPROLESOBLIGATORIOS", Valor: " o "})
+	repos := bd.Repositorios()
+	gu := NewGestorUsuarios(repos.Usuarios, repos.Roles, repos.Parametros)
+	gf := NewGestorSegundoFactor(repos.SegundoFactor, repos.Usuarios, repos.Roles, repos.Parametros)
+
+	// el rol A no lo exige
+	iniciarSesion(t, gu, "admin", "Admin123", "notebook")
+
+	d := loginConDesafio(t, gu, "operador", "Operador1")
+	if !d.Inscripcion {
+		t.Fatalf("el rol O exige inscribirse: %+v", d)
+	}
+	u := &models.Usuarios{}
+	if mensaje, _, _ := gf.CompletarLogin(t.Context(), d.TokenDesafio, "123456", u, &models.Sesiones{}); mensaje != "Debe inscribir el segundo factor antes de verificar el código." {
+		t.Fatalf("CompletarLogin sin inscribir: %q", mensaje)
+	}
+	mensaje, secreto, _, err := gf.Inscribir(t.Context(), d.TokenDesafio)
+	if err != nil || mensaje != "OK" {
+		t.Fatalf("Inscribir desde el desafío: %q %v", mensaje, err)
+	}
+	s := &models.Sesiones{}
+	mensaje, codigos, err := gf.CompletarLogin(t.Context(), d.TokenDesafio, codigoTOTP(t, secreto, utils.PasoTOTP(time.Now())), u, s)
+	if err != nil || mensaje != "OK" || len(codigos) != 10 || s.TokenSesion == "" || u.IdUsuario != operador.IdUsuario {
+		t.Fatalf("CompletarLogin de inscripción: %q %v %v %+v", mensaje, codigos, err, u)
+	}
+	if mensaje, _, _, _ := gf.Inscribir(ctxSesion(s.TokenSesion), ""); mensaje != "El segundo factor ya está activo." {
+		t.Fatalf("Inscribir con segundo factor activo: %q", mensaje)
+	}
+
+	// restablecer: solo un administrador, sobre otra cuenta; cierra las sesiones y audita
+	gs := NewGestorSesiones(repos.Sesiones, repos.Parametros)
+	if mensaje, _ := gf.Restablecer(ctxSesion(s.TokenSesion), operador); mensaje != "No tienes permisos para realizar esta acción." {
+		t.Fatalf("Restablecer sin usuarios:admin: %q", mensaje)
+	}
+	ctxAdmin := ctxSesion(admin.TokenSesion)
+	if mensaje, _ := gf.Restablecer(ctxAdmin, admin); mensaje != "No puedes realizar esta acción sobre tu propia cuenta." {
+		t.Fatalf("Restablecer la propia cuenta: %q", mensaje)
+	}
+	if mensaje, err := gf.Restablecer(ctxAdmin, operador); err != nil || mensaje != "OK" {
+		t.Fatalf("Restablecer: %q %v", mensaje, err)
+	}
+	if sesiones, _ := gs.Listar(ctxSesion(s.TokenSesion)); len(sesiones) != 0 {
+		t.Fatalf("Restablecer debe cerrar las sesiones: %+v", sesiones)
+	}
+	ops, _ := repos.Auditoria.Buscar(t.Context(), repositorios.FiltroOperaciones{TipoOperacion: "RF"})
+	if len(ops) != 1 || ops[0].IdUsuario == nil || *ops[0].IdUsuario != admin.IdUsuario {
+		t.Fatalf("auditoría RF: %+v", ops)
+	}
+	if mensaje, _ := gf.Restablecer(ctxAdmin, operador); mensaje != "El usuario no tiene segundo factor." {
+		t.Fatalf("Restablecer sin segundo factor: %q", mensaje)
+	}
+	// se inscribe de nuevo en el próximo login
+	if d := loginConDesafio(t, gu, "operador", "Operador1"); !d.Inscripcion {
+		t.Fatalf("tras restablecer debe inscribirse de nuevo: %+v", d)
+	}
+}
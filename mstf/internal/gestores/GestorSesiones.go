@@ -0,0 +1,90 @@
+package gestores
+
+import (
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"MSTransaccionesFinancieras/internal/utils"
+	"context"
+	"strconv"
+	"strings"
+)
+
+type GestorSesiones struct {
+	sesiones   repositorios.Sesiones
+	parametros repositorios.Parametros
+}
+
+func NewGestorSesiones(sesiones repositorios.Sesiones, parametros repositorios.Parametros) *GestorSesiones {
+	return &GestorSesiones{sesiones: sesiones, parametros: parametros}
+}
+
+// Renueva el token de una sesión con su refresh token. Ambos tokens se rotan: el refresh token usado deja
+// de ser válido. El vencimiento por inactividad se reinicia, pero no el vencimiento absoluto de la sesión.
+// Instancia Sesion con la sesión y sus tokens nuevos.
+// tsp_renovar_sesion
+func (gs *GestorSesiones) Renovar(ctx context.Context, RefreshToken string, Sesion *models.Sesiones) (string, error) {
+	if err := generarTokens(Sesion); err != nil {
+		return "", err
+	}
+	mensaje, err := gs.sesiones.Renovar(ctx, RefreshToken, Sesion, obtenerPoliticaSesion(gs.parametros).MinutosToken)
+	if err != nil || mensaje != "OK" {
+		Sesion.TokenSesion, Sesion.RefreshToken = "", ""
+	}
+	return mensaje, err
+}
+
+// Sesiones vigentes del usuario de la sesión. Actual indica la sesión del token con el que se consulta.
+// tsp_buscar_sesiones
+func (gs *GestorSesiones) Listar(ctx context.Context) ([]models.Sesiones, error) {
+	return gs.sesiones.Listar(ctx)
+}
+
+// Permite al usuario de la sesión cerrar una de sus sesiones (por ejemplo, la de otro dispositivo).
+// tsp_revocar_sesion
+func (gs *GestorSesiones) Revocar(ctx context.Context, IdSesion int) (string, error) {
+	return gs.sesiones.Revocar(ctx, IdSesion)
+}
+
+// Permite a un administrador cerrar todas las sesiones de un usuario.
+// tsp_revocar_sesiones_usuario
+func (gs *GestorSesiones) RevocarUsuario(ctx context.Context, Usuario models.Usuarios) (string, error) {
+	return gs.sesiones.RevocarUsuario(ctx, Usuario.IdUsuario)
+}
+
+// Genera el token de sesión y el refresh token de una sesión nueva o renovada
+func generarTokens(Sesion *models.Sesiones) error {
+	var err error
+	if Sesion.TokenSesion, err = utils.GenerarToken(); err != nil {
+		return err
+	}
+	Sesion.RefreshToken, err = utils.GenerarToken()
+	return err
+}
+
+// Política de sesiones desde los parámetros SESIONTOKENMIN, SESIONINACTIVIDADMIN, SESIONDURACIONHORAS,
+// SESIONESMAXUSUARIO y TOTPROLESOBLIGATORIOS (roles separados por coma). Los faltantes o inválidos toman el
+// valor por defecto.
+func obtenerPoliticaSesion(parametros repositorios.Parametros) repositorios.PoliticaSesion {
+	politica := repositorios.PoliticaSesionPorDefecto
+	obtenerEntero := func(parametro string, valor *int) {
+		p := &models.Parametros{Parametro: parametro}
+		if _, err := parametros.Dame(context.Background(), p); err == nil {
+			if val, err := strconv.Atoi(p.Valor); err == nil && val > 0 {
+				*valor = val
+			}
+		}
+	}
+	obtenerEntero("SESIONTOKENMIN", &politica.MinutosToken)
+	obtenerEntero("SESIONINACTIVIDADMIN", &politica.MinutosInactividad)
+	obtenerEntero("SESIONDURACIONHORAS", &politica.HorasDuracion)
+	obtenerEntero("SESIONESMAXUSUARIO", &politica.MaxSesiones)
+	p := &models.Parametros{Parametro: "TOTPROLESOBLIGATORIOS"}
+	if _, err := parametros.Dame(context.Background(), p); err == nil {
+		for _, rol := range strings.Split(p.Valor, ",") {
+			if rol = strings.ToUpper(strings.TrimSpace(rol)); rol != "" {
+				politica.RolesSegundoFactor = append(politica.RolesSegundoFactor, rol)
+			}
+		}
+	}
+	return politica
+}
@@ -0,0 +1,90 @@
+package gestores
+
+import (
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios/memoria"
+)
+
+func iniciarSesion(t *testing.T, gu *GestorUsuarios, usuario string, password string, dispositivo string) *models.Sesiones {
+	t.Helper()
+	s := &models.Sesiones{Dispositivo: dispositivo}
+	if mensaje, err := gu.Login(t.Context(), &models.Usuarios{Usuario: usuario}, password, s, &models.DesafiosLogin{}); err != nil || mensaje != "OK" {
+		t.Fatalf("Login %s desde %s: %q %v", usuario, dispositivo, mensaje, err)
+	}
+	return s
+}
+
+func TestSesionesPorDispositivo(t *testing.T) {
+	bd := memoria.New()
+	admin := bd.GuardarUsuario(models.Usuarios{Usuario: "admin"}, "Admin123")
+	bd.GuardarUsuario(models.Usuarios{Usuario: "operador", Rol: "O"}, "Operador1")
+	bd.GuardarParametro(models.Parametros{Parametro: "SESIONTOKENMIN", Valor: "5"})
+	repos := bd.Repositorios()
+	gu := NewGestorUsuarios(repos.Usuarios, repos.Roles, repos.Parametros)
+	gs := NewGestorSesiones(repos.Sesiones, repos.Parametros)
+
+	notebook := iniciarSesion(t, gu, "operador", "Operador1", "notebook")
+	celular := iniciarSesion(t, gu, "operador", "Operador1", "celular")
+	if len(notebook.TokenSesion) != 32 || len(notebook.RefreshToken) != 32 || notebook.TokenSesion == celular.TokenSesion {
+		t.Fatalf("tokens de sesión: %+v %+v", notebook, celular)
+	}
+	if d := notebook.FechaExpiracionToken.Sub(notebook.FechaInicio); d.Minutes() != 5 {
+		t.Fatalf("vencimiento del token desde SESIONTOKENMIN: %v", d)
+	}
+
+	// renovar rota ambos tokens
+	renovada := &models.Sesiones{}
+	if mensaje, err := gs.Renovar(t.Context(), celular.RefreshToken, renovada); err != nil || mensaje != "OK" {
+		t.Fatalf("Renovar: %q %v", mensaje, err)
+	}
+	if renovada.IdSesion != celular.IdSesion || renovada.TokenSesion == celular.TokenSesion || renovada.RefreshToken == celular.RefreshToken {
+		t.Fatalf("Renovar debe rotar los tokens de la misma sesión: %+v", renovada)
+	}
+	if mensaje, _, _ := repos.Autenticacion.Autenticar(t.Context(), celular.TokenSesion, "USUARIO", "10.0.0.1"); mensaje == "OK" {
+		t.Fatal("el token anterior a la renovación no debe ser válido")
+	}
+	usado := &models.Sesiones{}
+	if mensaje, _ := gs.Renovar(t.Context(), celular.RefreshToken, usado); mensaje != "La sesión expiró. Vuelva a iniciar sesión." || usado.TokenSesion != "" {
+		t.Fatalf("Renovar con refresh token usado: %q %+v", mensaje, usado)
+	}
+
+	// desde el celular se lista y se cierra la sesión de la notebook (GuardarUsuario creó otra sesión)
+	ctxCelular := ctxSesion(renovada.TokenSesion)
+	sesiones, err := gs.Listar(ctxCelular)
+	if err != nil || len(sesiones) != 3 || !sesiones[0].Actual || sesiones[0].Dispositivo != "celular" || sesiones[1].TokenSesion != "" {
+		t.Fatalf("Listar: %+v %v", sesiones, err)
+	}
+	if mensaje, err := gs.Revocar(ctxCelular, notebook.IdSesion); err != nil || mensaje != "OK" {
+		t.Fatalf("Revocar: %q %v", mensaje, err)
+	}
+	if mensaje, _, _ := repos.Autenticacion.Autenticar(t.Context(), notebook.TokenSesion, "USUARIO", "10.0.0.1"); mensaje == "OK" {
+		t.Fatal("la sesión revocada no debe ser válida")
+	}
+	if mensaje, _ := gs.Revocar(ctxCelular, notebook.IdSesion); mensaje != "La sesión no existe." {
+		t.Fatalf("Revocar dos veces: %q", mensaje)
+	}
+
+	// el administrador cierra todas las sesiones del operador; cambiar la contraseña también las cierra
+	tablet := iniciarSesion(t, gu, "operador", "Operador1", "tablet")
+	if mensaje, _ := gs.RevocarUsuario(ctxCelular, models.Usuarios{IdUsuario: admin.IdUsuario}); mensaje != "No tienes permisos para realizar esta acción." {
+		t.Fatalf("RevocarUsuario sin permisos: %q", mensaje)
+	}
+	if mensaje, err := gs.RevocarUsuario(ctxSesion(admin.TokenSesion), models.Usuarios{IdUsuario: tablet.IdUsuario}); err != nil || mensaje != "OK" {
+		t.Fatalf("RevocarUsuario: %q %v", mensaje, err)
+	}
+	for _, token := range []string{renovada.TokenSesion, tablet.TokenSesion} {
+		if mensaje, _, _ := repos.Autenticacion.Autenticar(t.Context(), token, "USUARIO", "10.0.0.1"); mensaje == "OK" {
+			t.Fatal("RevocarUsuario debe cerrar todas las sesiones del usuario")
+		}
+	}
+	notebook = iniciarSesion(t, gu, "operador", "Operador1", "notebook")
+	celular = iniciarSesion(t, gu, "operador", "Operador1", "celular")
+	if mensaje, err := gu.ModificarPassword(ctxSesion(celular.TokenSesion), "Operador1", "Operador2", "10.0.0.1"); err != nil || mensaje != "OK" {
+		t.Fatalf("ModificarPassword: %q %v", mensaje, err)
+	}
+	if mensaje, _, _ := repos.Autenticacion.Autenticar(t.Context(), notebook.TokenSesion, "USUARIO", "10.0.0.1"); mensaje == "OK" {
+		t.Fatal("modificar la contraseña debe cerrar las sesiones de los otros dispositivos")
+	}
+}
@@ -1,23 +1,49 @@
 package gestores
 
 import (
+	"MSTransaccionesFinancieras/internal/infra/logs"
+	"MSTransaccionesFinancieras/internal/infra/metricas"
 	"MSTransaccionesFinancieras/internal/infra/persistence"
+	"MSTransaccionesFinancieras/internal/infra/trazas"
 	"MSTransaccionesFinancieras/internal/infra/webhook"
 	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
 	"MSTransaccionesFinancieras/internal/utils"
+	"context"
 	"encoding/binary"
 	"errors"
-	"log"
 	"strconv"
 
+	tigerbeetle "github.com/tigerbeetle/tigerbeetle-go"
 	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type GestorTransferencias struct {
+	Estados    *GestorEstadosTransferencias
+	tb         tigerbeetle.Client
+	parametros repositorios.Parametros
+	monedas    repositorios.Monedas
+	auditoria  repositorios.Auditoria
 }
 
-func NewGestorTransferencias() *GestorTransferencias {
-	return &GestorTransferencias{}
+func NewGestorTransferencias(tb tigerbeetle.Client, parametros repositorios.Parametros, monedas repositorios.Monedas, auditoria repositorios.Auditoria, estados *GestorEstadosTransferencias) *GestorTransferencias {
+	return &GestorTransferencias{Estados: estados, tb: tb, parametros: parametros, monedas: monedas, auditoria: auditoria}
+}
+
+// Instancia la transferencia desde TigerBeetle (Transferencia.IdTransferencia) y deriva
+// Tipo e IdUsuarioFinal a partir de la cuenta empresa de su moneda.
+func (gt *GestorTransferencias) Dame(ctx context.Context, Transferencia *models.Transferencias) error {
+	tb := persistence.TB(ctx, gt.tb)
+	if err := Transferencia.Dame(tb); err != nil {
+		return err
+	}
+	moneda := &models.Monedas{IdMoneda: int(Transferencia.IdMoneda)}
+	if mensaje, err := gt.monedas.Dame(ctx, moneda); err == nil && mensaje == "OK" {
+		Transferencia.DerivarTipo(tb, moneda.IdCuentaEmpresa)
+	}
+	return nil
 }
 
 // Busca transferencias según los filtros especificados.
@@ -30,6 +56,7 @@ func NewGestorTransferencias() *GestorTransferencias {
 // FechaInicio/FechaFin: nanosegundos epoch (Timestamp de TB, no UserData32).
 // Los resultados se ordenan de más reciente a más antigua.
 func (gt *GestorTransferencias) BuscarAvanzado(
+	ctx context.Context,
 	IdsTransferencia []types.Uint128,
 	IdUsuarioFinal uint64,
 	IdCategoria uint64,
@@ -41,17 +68,18 @@ func (gt *GestorTransferencias) BuscarAvanzado(
 	FechaFin uint64,
 	Limit uint32,
 ) ([]models.Transferencias, error) {
-	if persistence.ClienteTB == nil {
+	if gt.tb == nil {
 		return nil, errors.New("Conexión a TigerBeetle no inicializada")
 	}
+	tb := persistence.TB(ctx, gt.tb)
 
 	// lookup directo por IDs (ignora el resto de parámetros)
 	if len(IdsTransferencia) > 0 {
-		tbTransfers, err := persistence.ClienteTB.LookupTransfers(IdsTransferencia)
+		tbTransfers, err := tb.LookupTransfers(IdsTransferencia)
 		if err != nil {
 			return nil, err
 		}
-		return gt.convertirYFiltrar(tbTransfers, IncluyeRevertidas)
+		return gt.convertirYFiltrar(ctx, tbTransfers, IncluyeRevertidas)
 	}
 
 	tbResultados := make([]types.Transfer, 0)
@@ -75,10 +103,10 @@ func (gt *GestorTransferencias) BuscarAvanzado(
 			Flags:        types.QueryFilterFlags{Reversed: true}.ToUint32(),
 		}
 
-		//log.Printf("GestorTransferencias.BuscarAvanzado: Ejecutando QueryTransfers (TimestampMax=%d, Limit=%d)", cursorTimestampMax, restantes)
-		transfers, err := persistence.ClienteTB.QueryTransfers(filter)
+		logs.L(logs.Transferencias).Debug("BuscarAvanzado: ejecutando QueryTransfers", "TimestampMax", cursorTimestampMax, "Limite", restantes)
+		transfers, err := tb.QueryTransfers(filter)
 		if err != nil {
-			log.Printf("ERROR [GestorTransferencias.BuscarAvanzado]: QueryTransfers falló: %v", err)
+			logs.L(logs.Transferencias).Error("BuscarAvanzado: QueryTransfers falló", logs.Err(err))
 			return nil, err
 		}
 
@@ -115,18 +143,18 @@ func (gt *GestorTransferencias) BuscarAvanzado(
 		cursorTimestampMax = ultimoTimestamp - 1
 
 		if len(tbResultados) > 50000 {
-			//log.Printf("ADVERTENCIA [GestorTransferencias.BuscarAvanzado]: Límite de seguridad alcanzado (50.000 transferencias)")
+			logs.L(logs.Transferencias).Warn("BuscarAvanzado: límite de seguridad alcanzado (50.000 transferencias)")
 			break
 		}
 	}
 
-	//log.Printf("GestorTransferencias.BuscarAvanzado: Total encontrado: %d transferencias", len(tbResultados))
-	return gt.convertirYFiltrar(tbResultados, IncluyeRevertidas)
+	logs.L(logs.Transferencias).Debug("BuscarAvanzado: búsqueda finalizada", "encontradas", len(tbResultados))
+	return gt.convertirYFiltrar(ctx, tbResultados, IncluyeRevertidas)
 }
 
 // Convierte un slice de transfers de TigerBeetle a models.Transferencias, marca como "R" las
 // revertidas, y si IncluyeRevertidas es false las excluye del resultado final.
-func (gt *GestorTransferencias) convertirYFiltrar(tbTransfers []types.Transfer, IncluyeRevertidas bool) ([]models.Transferencias, error) {
+func (gt *GestorTransferencias) convertirYFiltrar(ctx context.Context, tbTransfers []types.Transfer, IncluyeRevertidas bool) ([]models.Transferencias, error) {
 	resultados := make([]models.Transferencias, 0, len(tbTransfers))
 	idsALookup := make([]types.Uint128, 0)
 	mapaIndice := make(map[types.Uint128]int) // idReversion → índice en resultados
@@ -146,9 +174,9 @@ func (gt *GestorTransferencias) convertirYFiltrar(tbTransfers []types.Transfer,
 	}
 
 	if len(idsALookup) > 0 {
-		reversiones, err := persistence.ClienteTB.LookupTransfers(idsALookup)
+		reversiones, err := persistence.TB(ctx, gt.tb).LookupTransfers(idsALookup)
 		if err != nil {
-			log.Printf("ADVERTENCIA [GestorTransferencias.convertirYFiltrar]: Error al verificar reversiones: %v", err)
+			logs.L(logs.Transferencias).Warn("convertirYFiltrar: error al verificar reversiones", logs.Err(err))
 		} else {
 			for _, r := range reversiones {
 				if r.Code == models.CodigoTransferenciaReversion {
@@ -171,7 +199,7 @@ func (gt *GestorTransferencias) convertirYFiltrar(tbTransfers []types.Transfer,
 		if !monedaVisitada[ledger] {
 			monedaVisitada[ledger] = true
 			moneda := &models.Monedas{IdMoneda: int(ledger)}
-			if _, err := moneda.Dame(); err == nil && moneda.IdCuentaEmpresa != "" {
+			if mensaje, err := gt.monedas.Dame(ctx, moneda); err == nil && mensaje == "OK" && moneda.IdCuentaEmpresa != "" {
 				if parsed, errP := utils.ParsearUint128(moneda.IdCuentaEmpresa); errP == nil {
 					monedaEmpresaCache[ledger] = parsed
 				}
@@ -210,6 +238,7 @@ func (gt *GestorTransferencias) convertirYFiltrar(tbTransfers []types.Transfer,
 // filtrado que BuscarAvanzado: las transfers de reversión (Code=2) nunca aparecen,
 // las revertidas se marcan Estado="R", y si IncluyeRevertidas=false se excluyen.
 func (gt *GestorTransferencias) BuscarPorCuenta(
+	ctx context.Context,
 	IdUsuarioFinal uint64,
 	IdMoneda uint32,
 	IncluyeRevertidas bool,
@@ -218,7 +247,7 @@ func (gt *GestorTransferencias) BuscarPorCuenta(
 	Limite uint32,
 ) ([]models.Transferencias, error) {
 	cuenta := &models.Cuentas{IdUsuarioFinal: IdUsuarioFinal, IdMoneda: IdMoneda}
-	tbTransfers, err := cuenta.ListarTransferenciasCuenta(TimestampMin, TimestampMax, Limite)
+	tbTransfers, err := cuenta.ListarTransferenciasCuenta(persistence.TB(ctx, gt.tb), TimestampMin, TimestampMax, Limite)
 	if err != nil {
 		return nil, err
 	}
@@ -231,92 +260,136 @@ func (gt *GestorTransferencias) BuscarPorCuenta(
 		}
 	}
 
-	return gt.convertirYFiltrar(soloNormales, IncluyeRevertidas)
+	return gt.convertirYFiltrar(ctx, soloNormales, IncluyeRevertidas)
 }
 
 // Procesa un lote de transferencias recibido del consumidor Kafka.
 // Valida reglas de negocio antes de enviar a TigerBeetle.
 // Las transferencias que fallan validación no van a TB pero sí se notifican con su error.
 // FallidasParseo son transferencias que fallaron en el parseo del mensaje Kafka (también se notifican)
-func (gt *GestorTransferencias) CrearLote(Batch []types.Transfer, KafkaMsgs []models.KafkaTransferencias, FallidasParseo []models.TransferenciaNotificada) error {
+// Retorna el resultado de cada transferencia tal como se notificó en el webhook.
+func (gt *GestorTransferencias) CrearLote(ctx context.Context, Batch []types.Transfer, KafkaMsgs []models.KafkaTransferencias, FallidasParseo []models.TransferenciaNotificada) (notificaciones []models.TransferenciaNotificada, err error) {
+	ctx, span := trazas.Tracer().Start(ctx, "GestorTransferencias.CrearLote",
+		trace.WithAttributes(attribute.Int("transferencias", len(Batch)), attribute.Int("fallidas_parseo", len(FallidasParseo))))
+	defer func() { trazas.Finalizar(span, err) }()
+
 	var paraEnviar []types.Transfer
 	var kafkaMsgsValidos []models.KafkaTransferencias
 	fallidas := append([]models.TransferenciaNotificada{}, FallidasParseo...)
 
 	// validar existencia y saldo de cuentas antes de ir a TigerBeetle
-	erroresCuentas, err := gt.preValidarCuentas(Batch)
+	erroresCuentas, err := gt.preValidarCuentas(ctx, Batch)
 	if err != nil {
 		// error de infraestructura (TB caído): no notificar, dejar que procesarConRetry reintente
-		log.Printf("ERROR [GestorTransferencias.CrearLote]: Error de infraestructura en preValidarCuentas: %v", err)
-		return err
+		logs.L(logs.Transferencias).ErrorContext(ctx, "CrearLote: error de infraestructura en preValidarCuentas", logs.Err(err))
+		return nil, err
 	}
 
+	// motivo de rechazo de cada transferencia ("" = válida)
+	motivos := make([]string, len(Batch))
 	for i, t := range Batch {
 		if erroresCuentas[i] != "" {
-			//log.Printf("[VALIDACIÓN] Transfer ID %s rechazada: %s", utils.Uint128AStringDecimal(t.ID), erroresCuentas[i])
-			fallidas = append(fallidas, models.NewTransferenciaNotificadaError(t, KafkaMsgs[i], erroresCuentas[i]))
+			motivos[i] = erroresCuentas[i]
 			continue
 		}
 
 		// validaciones de reglas de negocio (montos, moneda, reversión)
-		var estadoError string
 		if t.Code == models.CodigoTransferenciaReversion {
 			var errInfra error
-			estadoError, errInfra = gt.validarReversion(t, KafkaMsgs[i])
+			motivos[i], errInfra = gt.validarReversion(ctx, t, KafkaMsgs[i])
 			if errInfra != nil {
-				log.Printf("ERROR [GestorTransferencias.CrearLote]: Error de infraestructura en validarReversion: %v", errInfra)
-				return errInfra
+				logs.L(logs.Transferencias).ErrorContext(ctx, "CrearLote: error de infraestructura en validarReversion", "IdTransferencia", utils.Uint128AStringDecimal(t.ID), logs.Err(errInfra))
+				return nil, errInfra
 			}
 		} else {
-			estadoError = gt.validarTransferencia(t)
+			motivos[i] = gt.validarTransferencia(ctx, t)
 		}
-		if estadoError != "" {
-			//log.Printf("[VALIDACIÓN] Transfer ID %s rechazada: %s", utils.Uint128AStringDecimal(t.ID), estadoError)
-			fallidas = append(fallidas, models.NewTransferenciaNotificadaError(t, KafkaMsgs[i], estadoError))
-		} else {
-			paraEnviar = append(paraEnviar, t)
-			kafkaMsgsValidos = append(kafkaMsgsValidos, KafkaMsgs[i])
+	}
+
+	// En un reintento del lote (respuesta de TB perdida, mensajes de Kafka reentregados) el saldo y la última
+	// transferencia de la cuenta ya incluyen lo registrado en el intento anterior, así que la validación rechaza
+	// transferencias que TB ya tiene. Esas se envían igual: TB responde TransferExists y se notifican como reintento.
+	registradas, err := gt.yaRegistradas(ctx, Batch, motivos)
+	if err != nil {
+		logs.L(logs.Transferencias).ErrorContext(ctx, "CrearLote: error de infraestructura al buscar transferencias ya registradas", logs.Err(err))
+		return nil, err
+	}
+
+	for i, t := range Batch {
+		if registrada, ok := registradas[t.ID]; motivos[i] != "" && (!ok || !mismaTransferencia(registrada, t)) {
+			logs.L(logs.Transferencias).DebugContext(ctx, "transferencia rechazada en validación", "IdTransferencia", utils.Uint128AStringDecimal(t.ID), "IdMoneda", t.Ledger, "motivo", motivos[i])
+			fallidas = append(fallidas, models.NewTransferenciaNotificadaError(t, KafkaMsgs[i], motivos[i]))
+			continue
 		}
+		paraEnviar = append(paraEnviar, t)
+		kafkaMsgsValidos = append(kafkaMsgsValidos, KafkaMsgs[i])
 	}
 
-	/*if len(fallidas) > 0 {
-		//log.Printf("VALIDACIÓN: %d de %d transfers rechazadas antes de TigerBeetle.", len(fallidas), len(Batch)+len(FallidasParseo))
-	}*/
+	if len(fallidas) > 0 {
+		logs.L(logs.Transferencias).DebugContext(ctx, "transferencias rechazadas antes de TigerBeetle", "rechazadas", len(fallidas), "total", len(Batch)+len(FallidasParseo))
+	}
 
 	var results []types.TransferEventResult
 	if len(paraEnviar) > 0 {
-		if persistence.ClienteTB == nil {
-			return errors.New("Conexión a TigerBeetle no inicializada")
+		if gt.tb == nil {
+			return nil, errors.New("Conexión a TigerBeetle no inicializada")
 		}
-		var err error
-		results, err = persistence.ClienteTB.CreateTransfers(paraEnviar)
+		results, err = persistence.TB(ctx, gt.tb).CreateTransfers(paraEnviar)
 		if err != nil {
-			log.Printf("ERROR [GestorTransferencias.CrearLote]: Error de comunicación con TigerBeetle al enviar batch de %d transfers: %v", len(paraEnviar), err)
-			return err
+			logs.L(logs.Transferencias).ErrorContext(ctx, "CrearLote: error de comunicación con TigerBeetle", "transferencias", len(paraEnviar), logs.Err(err))
+			return nil, err
 		}
 
 		if len(results) > 0 {
-			//log.Printf("RESPUESTA TB: Fallo en %d de %d transfers. Detalle de resultados:", len(results), len(paraEnviar))
+			logs.L(logs.Transferencias).DebugContext(ctx, "TigerBeetle rechazó transferencias del lote", "rechazadas", len(results), "total", len(paraEnviar))
 			for _, result := range results {
 				if int(result.Index) < len(paraEnviar) {
 					idTransferencia := utils.Uint128AStringDecimal(paraEnviar[result.Index].ID)
-					log.Printf(" -> Transfer ID %s, Resultado: %s", idTransferencia, result.Result.String())
+					logs.L(logs.Transferencias).InfoContext(ctx, "resultado de TigerBeetle", "IdTransferencia", idTransferencia, "IdMoneda", paraEnviar[result.Index].Ledger,
+						"resultado", result.Result.String(), "IdCorrelacion", kafkaMsgsValidos[result.Index].IdCorrelacion)
 				} else {
-					log.Printf(" -> Índice de resultado %d fuera de rango (tamaño batch %d)", result.Index, len(paraEnviar))
+					logs.L(logs.Transferencias).ErrorContext(ctx, "índice de resultado de TigerBeetle fuera de rango", "indice", result.Index, "transferencias", len(paraEnviar))
 				}
 			}
 		} else {
-			//log.Printf("RESPUESTA TB: Batch de %d transfers procesado exitosamente.", len(paraEnviar))
+			logs.L(logs.Transferencias).DebugContext(ctx, "lote procesado por TigerBeetle sin rechazos", "transferencias", len(paraEnviar))
 		}
+
+		// Las reversiones se auditan apenas TB las registra, antes de notificar: si después falla el webhook
+		// el lote se reintenta y la reversión ya queda auditada
+		gt.auditarReversiones(ctx, paraEnviar, kafkaMsgsValidos, results)
 	}
 
 	// Notificar todo: resultados de TB + rechazadas
-	if err := webhook.Cliente.NotificarTransferencias(paraEnviar, kafkaMsgsValidos, results, fallidas); err != nil {
-		log.Printf("ERROR [GestorTransferencias.CrearLote]: Falló la notificación del Webhook: %v", err)
-		return err
+	notificaciones, err = webhook.Cliente.NotificarTransferencias(ctx, paraEnviar, kafkaMsgsValidos, results, fallidas)
+	if err != nil {
+		logs.L(logs.Transferencias).ErrorContext(ctx, "CrearLote: falló la notificación del webhook", logs.Err(err))
+		return nil, err
 	}
 
-	return nil
+	// notificaciones: primero las enviadas a TB, después las fallidas en parseo y por último las rechazadas en validación
+	finParseo := len(paraEnviar) + len(FallidasParseo)
+	for i, n := range notificaciones {
+		if n.Estado != "E" {
+			metricas.Transferencias.WithLabelValues("ok", n.Mensaje).Inc()
+			continue
+		}
+		logs.L(logs.Transferencias).InfoContext(ctx, "transferencia rechazada", "IdTransferencia", n.IdTransferencia, "IdMoneda", n.IdMoneda,
+			"motivo", n.Mensaje, "IdCorrelacion", n.IdCorrelacion)
+		// el mensaje de un error de parseo es libre (detalle del esquema), no sirve como label
+		motivo := n.Mensaje
+		if i >= len(paraEnviar) && i < finParseo {
+			motivo = "Mensaje inválido"
+		}
+		metricas.Transferencias.WithLabelValues("rechazada", motivo).Inc()
+	}
+
+	// El registro de estados es best-effort: el lote ya está en TB y notificado
+	if err := gt.Estados.Registrar(ctx, notificaciones); err != nil {
+		logs.L(logs.Transferencias).ErrorContext(ctx, "CrearLote: no se pudo registrar el estado de las transferencias", "transferencias", len(notificaciones), logs.Err(err))
+	}
+
+	return notificaciones, nil
 }
 
 // --------------------------------------------------------------------------------
@@ -325,23 +398,23 @@ func (gt *GestorTransferencias) CrearLote(Batch []types.Transfer, KafkaMsgs []mo
 
 // Valida reglas de negocio sobre una transferencia antes de enviarla a TigerBeetle.
 // Retorna "" si la transferencia es válida, o un string con el código de error.
-func (gt *GestorTransferencias) validarTransferencia(t types.Transfer) string {
+func (gt *GestorTransferencias) validarTransferencia(ctx context.Context, t types.Transfer) string {
 	monto := binary.LittleEndian.Uint64(t.Amount[:8])
 	paramMax := &models.Parametros{Parametro: "MONTOMAXTRANSFER"}
-	if _, err := paramMax.Dame(); err == nil {
+	if _, err := gt.parametros.Dame(ctx, paramMax); err == nil {
 		if max, err := strconv.ParseUint(paramMax.Valor, 10, 64); err == nil && monto > max {
 			return "El monto excede el máximo permitido por transferencia"
 		}
 	}
 	paramMin := &models.Parametros{Parametro: "MONTOMINTRANSFER"}
-	if _, err := paramMin.Dame(); err == nil {
+	if _, err := gt.parametros.Dame(ctx, paramMin); err == nil {
 		if min, err := strconv.ParseUint(paramMin.Valor, 10, 64); err == nil && monto < min {
 			return "El monto es inferior al mínimo permitido por transferencia"
 		}
 	}
 
 	moneda := &models.Monedas{IdMoneda: int(t.Ledger)}
-	if _, err := moneda.Dame(); err != nil {
+	if mensaje, err := gt.monedas.Dame(ctx, moneda); err != nil || mensaje != "OK" {
 		return "La moneda no existe o no está activa"
 	}
 	if moneda.Estado != "A" {
@@ -351,6 +424,125 @@ func (gt *GestorTransferencias) validarTransferencia(t types.Transfer) string {
 	return ""
 }
 
+// Audita las reversiones que TB registró en este intento. Las que TB ya tenía (TransferExists) se auditan solo
+// si no tienen registro RT: el intento que las escribió pudo perder la respuesta de TB antes de auditarlas.
+func (gt *GestorTransferencias) auditarReversiones(ctx context.Context, enviadas []types.Transfer, kafkaMsgs []models.KafkaTransferencias, results []types.TransferEventResult) {
+	rechazos := make(map[uint32]types.CreateTransferResult, len(results))
+	for _, r := range results {
+		rechazos[r.Index] = r.Result
+	}
+	for i, t := range enviadas {
+		if t.Code != models.CodigoTransferenciaReversion {
+			continue
+		}
+		idOriginal := utils.Uint128AStringDecimal(t.UserData128)
+		if resultado, rechazada := rechazos[uint32(i)]; rechazada {
+			if resultado != types.TransferExists {
+				continue
+			}
+			auditadas, err := gt.auditoria.Buscar(ctx, repositorios.FiltroOperaciones{
+				TipoOperacion: models.OperacionReversionTransferencia, Entidad: "Transferencia", IdEntidad: idOriginal, Limite: 1,
+			})
+			if err != nil {
+				logs.L(logs.Transferencias).ErrorContext(ctx, "no se pudo verificar la auditoría de la reversión", "IdTransferencia", idOriginal, logs.Err(err))
+				continue
+			}
+			if len(auditadas) > 0 {
+				continue
+			}
+		}
+		antes, despues, err := gt.estadosReversion(ctx, t, kafkaMsgs[i])
+		if err != nil {
+			logs.L(logs.Transferencias).ErrorContext(ctx, "no se pudo leer el estado de la reversión para auditarla", "IdTransferencia", idOriginal, logs.Err(err))
+		}
+		auditar(ctx, gt.auditoria, models.OperacionReversionTransferencia, map[string]any{
+			"IdTransferencia": idOriginal,
+			"IdReversion":     utils.Uint128AStringDecimal(t.ID),
+			"IdMoneda":        t.Ledger,
+			"Monto":           utils.Uint128ADecimalMoneda(t.Amount),
+			"IdCorrelacion":   kafkaMsgs[i].IdCorrelacion,
+			"Antes":           antes,
+			"Despues":         despues,
+		})
+	}
+}
+
+// Estado de la transferencia original y saldo de la cuenta del usuario inmediatamente antes y después de una
+// reversión registrada, leídos de TB. El saldo sale del historial de balances de la cuenta en el Timestamp de la
+// reversión, así que es el mismo tanto si se registró en este intento como en uno anterior.
+func (gt *GestorTransferencias) estadosReversion(ctx context.Context, reversion types.Transfer, kafkaMsg models.KafkaTransferencias) (antes, despues map[string]any, err error) {
+	tb := persistence.TB(ctx, gt.tb)
+	registradas, err := tb.LookupTransfers([]types.Uint128{reversion.ID, reversion.UserData128})
+	if err != nil {
+		return nil, nil, err
+	}
+	var registrada, original types.Transfer
+	for _, r := range registradas {
+		switch r.ID {
+		case reversion.ID:
+			registrada = r
+		case reversion.UserData128:
+			original = r
+		}
+	}
+	if registrada.Timestamp == 0 || original.Timestamp == 0 {
+		return nil, nil, errors.New("Transferencia no encontrada en TigerBeetle")
+	}
+
+	// sin la reversión la original conserva el estado con el que se escribió; con ella, el que informa Dame
+	var transferenciaAntes models.Transferencias
+	transferenciaAntes.PoblarDesdeTB(original)
+	transferenciaDespues := models.Transferencias{IdTransferencia: transferenciaAntes.IdTransferencia}
+	if err := transferenciaDespues.Dame(tb); err != nil {
+		return nil, nil, err
+	}
+
+	cuenta := &models.Cuentas{IdUsuarioFinal: kafkaMsg.IdUsuarioFinal, IdMoneda: reversion.Ledger}
+	balances, err := cuenta.ListarHistorialBalances(tb, 0, registrada.Timestamp, 2)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(balances) < 2 || balances[0].Timestamp != registrada.Timestamp {
+		return nil, nil, errors.New("Historial de balances incompleto para la reversión")
+	}
+	antes = map[string]any{"Estado": transferenciaAntes.Estado,
+		"Creditos": utils.Uint128ADecimalMoneda(balances[1].CreditsPosted), "Debitos": utils.Uint128ADecimalMoneda(balances[1].DebitsPosted)}
+	despues = map[string]any{"Estado": transferenciaDespues.Estado,
+		"Creditos": utils.Uint128ADecimalMoneda(balances[0].CreditsPosted), "Debitos": utils.Uint128ADecimalMoneda(balances[0].DebitsPosted)}
+	return antes, despues, nil
+}
+
+// Transferencias rechazadas en validación que ya están registradas en TigerBeetle, por Id (una única llamada
+// batch, solo si hay rechazadas). Retorna error de infraestructura si TB no responde.
+func (gt *GestorTransferencias) yaRegistradas(ctx context.Context, batch []types.Transfer, motivos []string) (map[types.Uint128]types.Transfer, error) {
+	var ids []types.Uint128
+	for i, t := range batch {
+		if motivos[i] != "" {
+			ids = append(ids, t.ID)
+		}
+	}
+	registradas := make(map[types.Uint128]types.Transfer, len(ids))
+	if len(ids) == 0 {
+		return registradas, nil
+	}
+	transfers, err := persistence.TB(ctx, gt.tb).LookupTransfers(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range transfers {
+		registradas[t.ID] = t
+	}
+	return registradas, nil
+}
+
+// Indica si la transferencia registrada en TB es la misma que se intenta crear (un reintento y no otra
+// transferencia con el mismo Id, ej: la reversión de una reversión)
+func mismaTransferencia(registrada types.Transfer, t types.Transfer) bool {
+	return registrada.DebitAccountID == t.DebitAccountID && registrada.CreditAccountID == t.CreditAccountID &&
+		registrada.Amount == t.Amount && registrada.Ledger == t.Ledger && registrada.Code == t.Code &&
+		registrada.UserData128 == t.UserData128 && registrada.UserData64 == t.UserData64 && registrada.UserData32 == t.UserData32
+}
+
 // preValidarCuentas verifica, en una única llamada batch a TigerBeetle, que:
 //
 //	-la cuenta débito y la cuenta crédito existen,
@@ -359,7 +551,9 @@ func (gt *GestorTransferencias) validarTransferencia(t types.Transfer) string {
 //
 // Retorna (slice, nil): slice del mismo largo que batch ("" = válida, otro valor = error de negocio).
 // Retorna (nil, error): error de infraestructura (TB caído) que debe reintentarse, no notificarse.
-func (gt *GestorTransferencias) preValidarCuentas(batch []types.Transfer) ([]string, error) {
+func (gt *GestorTransferencias) preValidarCuentas(ctx context.Context, batch []types.Transfer) ([]string, error) {
+	ctx, span := trazas.Tracer().Start(ctx, "GestorTransferencias.preValidarCuentas")
+	defer span.End()
 	errores := make([]string, len(batch))
 
 	if len(batch) == 0 {
@@ -376,7 +570,7 @@ func (gt *GestorTransferencias) preValidarCuentas(batch []types.Transfer) ([]str
 		ids = append(ids, id)
 	}
 
-	accounts, err := persistence.ClienteTB.LookupAccounts(ids)
+	accounts, err := persistence.TB(ctx, gt.tb).LookupAccounts(ids)
 	if err != nil {
 		// error de infraestructura: el caller debe reintentar, no notificar como error de negocio
 		return nil, err
@@ -436,7 +630,7 @@ func (gt *GestorTransferencias) preValidarCuentas(batch []types.Transfer) ([]str
 
 // Valida que la transferencia a revertir sea la última de la cuenta.
 // Retorna ("mensaje", nil) para errores de negocio, ("", error) para errores de infraestructura.
-func (gt *GestorTransferencias) validarReversion(t types.Transfer, kafkaMsg models.KafkaTransferencias) (string, error) {
+func (gt *GestorTransferencias) validarReversion(ctx context.Context, t types.Transfer, kafkaMsg models.KafkaTransferencias) (string, error) {
 	idCuentaStr := utils.ConcatenarIDString(uint64(kafkaMsg.IdMoneda), kafkaMsg.IdUsuarioFinal)
 	idCuenta, err := utils.ParsearUint128(idCuentaStr)
 	if err != nil {
@@ -451,7 +645,7 @@ func (gt *GestorTransferencias) validarReversion(t types.Transfer, kafkaMsg mode
 		Flags:     7, // Debits + Credits + Reversed
 	}
 
-	transfers, err := persistence.ClienteTB.GetAccountTransfers(filtro)
+	transfers, err := persistence.TB(ctx, gt.tb).GetAccountTransfers(filtro)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,210 @@
+package gestores
+
+import (
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/models"
+
+	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+)
+
+type transferenciaTest struct {
+	tr  types.Transfer
+	msg models.KafkaTransferencias
+}
+
+func (e *entorno) crearLote(t *testing.T, lote ...transferenciaTest) []models.TransferenciaNotificada {
+	t.Helper()
+	batch := make([]types.Transfer, 0, len(lote))
+	msgs := make([]models.KafkaTransferencias, 0, len(lote))
+	for _, l := range lote {
+		batch = append(batch, l.tr)
+		msgs = append(msgs, l.msg)
+	}
+	notificaciones, err := e.gestorTransferencias().CrearLote(t.Context(), batch, msgs, nil)
+	if err != nil {
+		t.Fatalf("CrearLote: %v", err)
+	}
+	if len(notificaciones) != len(lote) {
+		t.Fatalf("CrearLote: %d notificaciones para %d transferencias", len(notificaciones), len(lote))
+	}
+	return notificaciones
+}
+
+func nueva(idTransferencia uint64, idUsuarioFinal uint64, tipo string, monto uint64) transferenciaTest {
+	tr, msg := transferencia(idTransferencia, idUsuarioFinal, tipo, monto)
+	return transferenciaTest{tr: tr, msg: msg}
+}
+
+// Las notificaciones llegan primero las enviadas a TB y después las rechazadas: se buscan por ID
+func notificacionDe(t *testing.T, notificaciones []models.TransferenciaNotificada, idTransferencia string) models.TransferenciaNotificada {
+	t.Helper()
+	for _, n := range notificaciones {
+		if n.IdTransferencia == idTransferencia {
+			return n
+		}
+	}
+	t.Fatalf("no hay notificación para la transferencia %s", idTransferencia)
+	return models.TransferenciaNotificada{}
+}
+
+func TestCrearLoteIngresoYEgreso(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearCuentaUsuario(t, 7)
+
+	// el saldo se valida contra lo registrado en TB antes del lote: el ingreso va en un lote previo
+	notificaciones := append(e.crearLote(t, nueva(1, 7, "I", 10000)), e.crearLote(t, nueva(2, 7, "E", 4000))...)
+	for _, n := range notificaciones {
+		if n.Estado != "F" || n.Mensaje != "OK" {
+			t.Fatalf("notificación: %+v", n)
+		}
+	}
+	c := e.dameCuenta(t, 7)
+	if c.Creditos != "100.00" || c.Debitos != "40.00" {
+		t.Fatalf("saldo: créditos %s débitos %s", c.Creditos, c.Debitos)
+	}
+
+	// reintento del mismo lote (p. ej. tras una caída del webhook): TB responde TransferExists
+	notificaciones = e.crearLote(t, nueva(1, 7, "I", 10000))
+	if notificaciones[0].Estado != "F" || notificaciones[0].Mensaje != "OK - Reintento" {
+		t.Fatalf("reintento: %+v", notificaciones[0])
+	}
+	if c := e.dameCuenta(t, 7); c.Creditos != "100.00" {
+		t.Fatalf("el reintento no debe duplicar el saldo: %s", c.Creditos)
+	}
+}
+
+func TestCrearLoteSaldoInsuficiente(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearCuentaUsuario(t, 7)
+	e.crearLote(t, nueva(1, 7, "I", 1000))
+
+	// el segundo egreso excede el saldo descontando el primero (débitos virtuales del lote)
+	notificaciones := e.crearLote(t, nueva(2, 7, "E", 600), nueva(3, 7, "E", 600))
+	if n := notificacionDe(t, notificaciones, "2"); n.Estado != "F" {
+		t.Fatalf("primer egreso: %+v", n)
+	}
+	if n := notificacionDe(t, notificaciones, "3"); n.Estado != "E" || n.Mensaje != "Saldo insuficiente en cuenta" {
+		t.Fatalf("segundo egreso: %+v", n)
+	}
+	if c := e.dameCuenta(t, 7); c.Debitos != "6.00" {
+		t.Fatalf("débitos: %s", c.Debitos)
+	}
+
+	// reintento de un egreso que ya consumió el saldo: se notifica como reintento, no como saldo insuficiente
+	if n := e.crearLote(t, nueva(2, 7, "E", 600))[0]; n.Estado != "F" || n.Mensaje != "OK - Reintento" {
+		t.Fatalf("reintento del egreso: %+v", n)
+	}
+	// otra transferencia con el mismo Id no es un reintento
+	if n := e.crearLote(t, nueva(2, 7, "E", 700))[0]; n.Mensaje != "Saldo insuficiente en cuenta" {
+		t.Fatalf("egreso distinto con Id repetido: %+v", n)
+	}
+	if c := e.dameCuenta(t, 7); c.Debitos != "6.00" {
+		t.Fatalf("débitos luego de los reintentos: %s", c.Debitos)
+	}
+}
+
+func TestCrearLoteCuentaInexistenteOCerrada(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearCuentaUsuario(t, 7)
+	cuenta := &models.Cuentas{IdMoneda: monedaTest, IdUsuarioFinal: 7}
+	if err := e.gestorCuentas().Desactivar(t.Context(), cuenta); err != nil {
+		t.Fatalf("Desactivar: %v", err)
+	}
+
+	notificaciones := e.crearLote(t, nueva(1, 8, "I", 1000), nueva(2, 7, "I", 1000))
+	if n := notificacionDe(t, notificaciones, "1"); n.Mensaje != "Cuenta no encontrada" {
+		t.Fatalf("cuenta inexistente: %+v", n)
+	}
+	if n := notificacionDe(t, notificaciones, "2"); n.Mensaje != "La cuenta está cerrada" {
+		t.Fatalf("cuenta cerrada: %+v", n)
+	}
+
+	if err := cuenta.Activar(e.tb); err != nil {
+		t.Fatalf("Activar: %v", err)
+	}
+	if n := e.crearLote(t, nueva(3, 7, "I", 1000))[0]; n.Estado != "F" {
+		t.Fatalf("ingreso luego de reactivar: %+v", n)
+	}
+}
+
+func TestCrearLoteLimitesDeMonto(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearCuentaUsuario(t, 7)
+
+	notificaciones := e.crearLote(t, nueva(1, 7, "I", montoMaxTest+1), nueva(2, 7, "I", montoMinTest-1), nueva(3, 7, "I", montoMinTest))
+	if n := notificacionDe(t, notificaciones, "1"); n.Mensaje != "El monto excede el máximo permitido por transferencia" {
+		t.Fatalf("monto máximo: %+v", n)
+	}
+	if n := notificacionDe(t, notificaciones, "2"); n.Mensaje != "El monto es inferior al mínimo permitido por transferencia" {
+		t.Fatalf("monto mínimo: %+v", n)
+	}
+	if n := notificacionDe(t, notificaciones, "3"); n.Estado != "F" {
+		t.Fatalf("monto en el límite: %+v", n)
+	}
+}
+
+func TestCrearLoteReversion(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearCuentaUsuario(t, 7)
+	primera, segunda := nueva(1, 7, "I", 1000), nueva(2, 7, "I", 2000)
+	e.crearLote(t, primera, segunda)
+
+	// solo se puede revertir la última transferencia de la cuenta
+	tr, msg := reversion(primera.tr, 7)
+	if n := e.crearLote(t, transferenciaTest{tr, msg})[0]; n.Mensaje != "Solo se puede revertir la última transferencia de la cuenta" {
+		t.Fatalf("reversión de una transferencia anterior: %+v", n)
+	}
+	tr, msg = reversion(segunda.tr, 7)
+	if n := e.crearLote(t, transferenciaTest{tr, msg})[0]; n.Estado != "F" {
+		t.Fatalf("reversión: %+v", n)
+	}
+	if c := e.dameCuenta(t, 7); c.Creditos != "30.00" || c.Debitos != "20.00" {
+		t.Fatalf("saldo luego de revertir: créditos %s débitos %s", c.Creditos, c.Debitos)
+	}
+	revRev, msgRevRev := reversion(tr, 7)
+	if n := e.crearLote(t, transferenciaTest{revRev, msgRevRev})[0]; n.Mensaje != "No se puede revertir una reversión" {
+		t.Fatalf("reversión de una reversión: %+v", n)
+	}
+
+	gt := e.gestorTransferencias()
+	vigentes, err := gt.BuscarAvanzado(t.Context(), nil, 7, 0, monedaTest, false, 0, 0, 0, 0, 100)
+	if err != nil || len(vigentes) != 1 || vigentes[0].IdTransferencia != "1" {
+		t.Fatalf("BuscarAvanzado sin revertidas: %+v %v", vigentes, err)
+	}
+	todas, err := gt.BuscarAvanzado(t.Context(), nil, 7, 0, monedaTest, true, 0, 0, 0, 0, 100)
+	if err != nil || len(todas) != 2 || todas[0].IdTransferencia != "2" || todas[0].Estado != "R" {
+		t.Fatalf("BuscarAvanzado con revertidas: %+v %v", todas, err)
+	}
+}
+
+func TestBuscarTransferencias(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearCuentaUsuario(t, 7)
+	e.crearCuentaUsuario(t, 8)
+	e.crearLote(t, nueva(1, 7, "I", 5000), nueva(2, 8, "I", 5000))
+	e.crearLote(t, nueva(3, 7, "E", 1000), nueva(4, 7, "E", 300))
+
+	gt := e.gestorTransferencias()
+	delUsuario, err := gt.BuscarPorCuenta(t.Context(), 7, monedaTest, true, 0, 0, 10)
+	if err != nil || len(delUsuario) != 3 {
+		t.Fatalf("BuscarPorCuenta: %+v %v", delUsuario, err)
+	}
+	// de la más reciente a la más antigua, con Tipo derivado de la cuenta empresa
+	if delUsuario[0].IdTransferencia != "4" || delUsuario[0].Tipo != "E" || delUsuario[2].Tipo != "I" {
+		t.Fatalf("orden o tipo: %+v", delUsuario)
+	}
+
+	porMonto, err := gt.BuscarAvanzado(t.Context(), nil, 0, 0, monedaTest, true, 500, 2000, 0, 0, 100)
+	if err != nil || len(porMonto) != 1 || porMonto[0].IdTransferencia != "3" {
+		t.Fatalf("BuscarAvanzado por monto: %+v %v", porMonto, err)
+	}
+	pagina, err := gt.BuscarAvanzado(t.Context(), nil, 0, 0, monedaTest, true, 0, 0, 0, 0, 2)
+	if err != nil || len(pagina) != 2 || pagina[0].IdTransferencia != "4" {
+		t.Fatalf("BuscarAvanzado con límite: %+v %v", pagina, err)
+	}
+	porId, err := gt.BuscarAvanzado(t.Context(), []types.Uint128{types.ToUint128(2)}, 0, 0, 0, true, 0, 0, 0, 0, 0)
+	if err != nil || len(porId) != 1 || porId[0].IdUsuarioFinal != 8 {
+		t.Fatalf("BuscarAvanzado por ID: %+v %v", porId, err)
+	}
+}
@@ -1,76 +1,363 @@
 package gestores
 
 import (
-	"MSTransaccionesFinancieras/internal/auth"
-	"MSTransaccionesFinancieras/internal/infra/persistence"
+	"MSTransaccionesFinancieras/internal/infra/logs"
 	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"MSTransaccionesFinancieras/internal/utils"
 	"context"
-	"database/sql"
+	"fmt"
+	"strconv"
 )
 
 type GestorUsuarios struct {
+	usuarios   repositorios.Usuarios
+	roles      repositorios.Roles
+	parametros repositorios.Parametros
 }
 
-func NewGestorUsuarios() *GestorUsuarios {
-	return &GestorUsuarios{}
+func NewGestorUsuarios(usuarios repositorios.Usuarios, roles repositorios.Roles, parametros repositorios.Parametros) *GestorUsuarios {
+	return &GestorUsuarios{usuarios: usuarios, roles: roles, parametros: parametros}
+}
+
+// Hash contra el que se verifica la contraseña de un usuario inexistente, para que el login tarde lo mismo
+// exista o no el usuario
+var hashInexistente, _ = utils.HashPassword("usuario inexistente")
+
+// Login rechazado porque el usuario está bloqueado por intentos fallidos (parámetros LOGIN*). Los controladores
+// responden 429 con Retry-After
+type ErrorBloqueoLogin struct {
+	Segundos int
+}
+
+func (e *ErrorBloqueoLogin) Error() string {
+	return fmt.Sprintf("Demasiados intentos fallidos. Reintente en %d segundos.", e.Segundos)
+}
+
+// Instancia los atributos del usuario (Usuario.IdUsuario).
+// tsp_dame_usuario
+func (gu *GestorUsuarios) Dame(ctx context.Context, Usuario *models.Usuarios) (string, error) {
+	return gu.usuarios.Dame(ctx, Usuario)
 }
 
 // Permite crear un usuario administrativo en estado P: Pendiente.
-// Genera una contraseña aleatoria que se devuelve para informar al usuario.
+// Genera una contraseña aleatoria que se devuelve para informar al usuario (se guarda solo su hash).
 // Al iniciar sesión por primera vez, deberá cambiar su contraseña y se activará.
 // tsp_crear_usuario
 // - Usuario.Usuario: nombre de usuario a crear
 func (gu *GestorUsuarios) Crear(ctx context.Context, Usuario models.Usuarios) (string, int, string, error) {
-	credencial, actor := auth.CredencialDesdeCtx(ctx)
-	var mensaje string
-	var id sql.NullInt64
-	var passwordTemporal sql.NullString
-	err := persistence.ClienteMySQL.QueryRow("CALL tsp_crear_usuario(?, ?, ?)", Usuario.Usuario, credencial, actor).Scan(&mensaje, &id, &passwordTemporal)
-
+	passwordTemporal, hash, err := nuevaPasswordTemporal()
 	if err != nil {
 		return "", 0, "", err
 	}
-
-	if !id.Valid {
-		return mensaje, 0, "", nil
+	mensaje, id, err := gu.usuarios.Crear(ctx, Usuario.Usuario, hash)
+	if err != nil || mensaje != "OK" {
+		return mensaje, id, "", err
 	}
-
-	return mensaje, int(id.Int64), passwordTemporal.String, nil
+	return mensaje, id, passwordTemporal, nil
 }
 
 // Permite listar todos los usuarios que cumplan con la condición de búsqueda.
 // tsp_buscar_usuarios
 // - Cadena: cadena de búsqueda para filtrar por nombre de usuario
 // - IncluyeInactivos: S para incluir usuarios inactivos, N para excluirlos
-func (gu *GestorUsuarios) Buscar(Cadena string, IncluyeInactivos string) ([]*models.Usuarios, error) {
-	rows, err := persistence.ClienteMySQL.Query("CALL tsp_buscar_usuarios(?, ?)", Cadena, IncluyeInactivos)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+func (gu *GestorUsuarios) Buscar(ctx context.Context, Cadena string, IncluyeInactivos string) ([]*models.Usuarios, error) {
+	return gu.usuarios.Buscar(ctx, Cadena, IncluyeInactivos)
+}
 
-	usuarios := make([]*models.Usuarios, 0)
-	for rows.Next() {
-		var m models.Usuarios
-		err = rows.Scan(&m.IdUsuario, &m.Usuario, &m.FechaAlta, &m.Estado, &m.Rol)
-		if err != nil {
-			return nil, err
-		}
-		usuarios = append(usuarios, &m)
-	}
+// Permite cambiar el estado de un usuario a A: Activo siempre y cuando esté inactivo.
+// tsp_activar_usuario
+func (gu *GestorUsuarios) Activar(ctx context.Context, Usuario models.Usuarios) (string, error) {
+	return gu.usuarios.Activar(ctx, Usuario.IdUsuario)
+}
 
-	return usuarios, nil
+// Permite cambiar el estado de un usuario a I: Inactivo siempre y cuando esté activo o pendiente.
+// tsp_desactivar_usuario
+func (gu *GestorUsuarios) Desactivar(ctx context.Context, Usuario models.Usuarios) (string, error) {
+	return gu.usuarios.Desactivar(ctx, Usuario.IdUsuario)
 }
 
 // Permite eliminar un usuario siempre y cuando no tenga registros en Operaciones y se encuentre Inactivo.
 // tsp_borrar_usuario
 // - Usuario.IdUsuario: ID del usuario a eliminar
 func (gu *GestorUsuarios) Borrar(ctx context.Context, Usuario models.Usuarios) (string, error) {
-	credencial, actor := auth.CredencialDesdeCtx(ctx)
-	var mensaje string
-	err := persistence.ClienteMySQL.QueryRow("CALL tsp_borrar_usuario(?, ?, ?)", Usuario.IdUsuario, credencial, actor).Scan(&mensaje)
+	return gu.usuarios.Borrar(ctx, Usuario.IdUsuario)
+}
+
+// Permite a un usuario iniciar sesión en el sistema administrativo de MSTF, creando una sesión nueva
+// (las de otros dispositivos siguen vigentes, hasta el máximo de SESIONESMAXUSUARIO).
+// Instancia Usuario con los datos del usuario y los permisos de su rol, y Sesion con la sesión, su token
+// y su refresh token.
+// Si el usuario tiene segundo factor o su rol lo exige (TOTPROLESOBLIGATORIOS), no crea la sesión: instancia
+// Desafio con el token para completar el login con el código (GestorSegundoFactor.CompletarLogin).
+// Verifica la contraseña contra el hash guardado; si es un MD5 heredado (o argon2id con otros parámetros)
+// lo reemplaza por un hash argon2id nuevo.
+// Cada contraseña inválida cuenta como intento fallido: al llegar a LOGININTENTOSMAX el login del usuario queda
+// bloqueado y devuelve *ErrorBloqueoLogin, sin verificar la contraseña, hasta que termine el bloqueo. El intento
+// se reserva antes de verificar, así los intentos en paralelo tampoco superan el máximo.
+// tsp_reservar_intento_login, tsp_dame_password_usuario, tsp_registrar_login_fallido, tsp_liberar_intento_login,
+// tsp_migrar_password_usuario, tsp_login_usuario, tsp_dame_rol
+// - Usuario.Usuario: nombre de usuario que intenta iniciar sesión
+// - Password: contraseña en texto plano
+// - Sesion.Dispositivo, Sesion.IP: datos informativos del cliente
+func (gu *GestorUsuarios) Login(ctx context.Context, Usuario *models.Usuarios, Password string, Sesion *models.Sesiones, Desafio *models.DesafiosLogin) (string, error) {
+	if err := reservarIntentoLogin(ctx, gu.usuarios, gu.parametros, Usuario.Usuario, Sesion.IP); err != nil {
+		return "", err
+	}
+	id, guardado, err := gu.usuarios.DamePassword(ctx, Usuario.Usuario)
 	if err != nil {
 		return "", err
 	}
+	valida, migrar := false, false
+	if id == 0 {
+		utils.VerificarPassword(Password, hashInexistente)
+	} else {
+		valida, migrar = utils.VerificarPassword(Password, guardado)
+	}
+	if !valida {
+		nombre := Usuario.Usuario
+		*Usuario = models.Usuarios{}
+		if err := registrarLoginFallido(ctx, gu.usuarios, gu.parametros, nombre, Sesion.IP); err != nil {
+			return "", err
+		}
+		return "Credenciales inválidas.", nil
+	}
+	liberarIntentoLogin(ctx, gu.usuarios, Usuario.Usuario)
+	if migrar {
+		guardado, err = gu.migrarPassword(ctx, id, guardado, Password)
+		if err != nil {
+			return "", err
+		}
+	}
+	if err := generarTokens(Sesion); err != nil {
+		return "", err
+	}
+	if Desafio.TokenDesafio, err = utils.GenerarToken(); err != nil {
+		return "", err
+	}
+	mensaje, err := gu.usuarios.Login(ctx, Usuario, guardado, Sesion, Desafio, obtenerPoliticaSesion(gu.parametros))
+	if err != nil || mensaje != "OK" {
+		Desafio.TokenDesafio = ""
+		return mensaje, err
+	}
+	if Desafio.TokenDesafio != "" {
+		if Desafio.Inscripcion {
+			return mensaje + " - Se requiere inscribir el segundo factor", nil
+		}
+		return mensaje + " - Se requiere el código del segundo factor", nil
+	}
+	if err := cargarPermisos(ctx, gu.roles, Usuario); err != nil {
+		return "", err
+	}
+	if Usuario.Estado == "P" {
+		mensaje += " - Se requiere cambio de contraseña temporal"
+	}
 	return mensaje, nil
 }
+
+// Permite al usuario activo cerrar su sesión actual (las de otros dispositivos siguen vigentes).
+// tsp_logout_usuario
+func (gu *GestorUsuarios) Logout(ctx context.Context) (string, error) {
+	return gu.usuarios.Logout(ctx)
+}
+
+// Permite al usuario Pendiente cambiar su contraseña temporal y activarse. Cierra sus sesiones.
+// La contraseña debe cumplir la política de contraseñas (parámetros PASSWORD*).
+// tsp_confirmar_cuenta_usuario
+// - Password: contraseña definitiva en texto plano
+func (gu *GestorUsuarios) ConfirmarCuenta(ctx context.Context, Password string) (string, error) {
+	if err := utils.ValidarFormatoPassword(Password, obtenerPoliticaPassword(gu.parametros)); err != nil {
+		return "Formato de contraseña inválido: " + err.Error(), nil
+	}
+	hash, err := utils.HashPassword(Password)
+	if err != nil {
+		return "", err
+	}
+	return gu.usuarios.ConfirmarCuenta(ctx, hash)
+}
+
+// Permite al usuario de la sesión modificar su contraseña. Cierra sus sesiones.
+// La nueva contraseña debe cumplir la política de contraseñas (parámetros PASSWORD*).
+// Una contraseña anterior inválida cuenta como intento de login fallido del usuario (ver Login), para que una
+// sesión robada no sirva para adivinarla.
+// tsp_dame_password_usuario, tsp_dame_usuario, tsp_reservar_intento_login, tsp_registrar_login_fallido,
+// tsp_liberar_intento_login, tsp_modificar_password_usuario
+// - PasswordAnterior, PasswordNuevo: contraseñas en texto plano
+// - IP: IP del cliente, informativa
+func (gu *GestorUsuarios) ModificarPassword(ctx context.Context, PasswordAnterior string, PasswordNuevo string, IP string) (string, error) {
+	if err := utils.ValidarFormatoPassword(PasswordNuevo, obtenerPoliticaPassword(gu.parametros)); err != nil {
+		return "Formato de contraseña inválido: " + err.Error(), nil
+	}
+	id, guardado, err := gu.usuarios.DamePasswordSesion(ctx)
+	if err != nil {
+		return "", err
+	}
+	if id == 0 {
+		return "La contraseña anterior es incorrecta.", nil
+	}
+	usuario := &models.Usuarios{IdUsuario: id}
+	if _, err := gu.usuarios.Dame(ctx, usuario); err != nil {
+		return "", err
+	}
+	if err := reservarIntentoLogin(ctx, gu.usuarios, gu.parametros, usuario.Usuario, IP); err != nil {
+		return "", err
+	}
+	if valida, _ := utils.VerificarPassword(PasswordAnterior, guardado); !valida {
+		if err := registrarLoginFallido(ctx, gu.usuarios, gu.parametros, usuario.Usuario, IP); err != nil {
+			return "", err
+		}
+		return "La contraseña anterior es incorrecta.", nil
+	}
+	liberarIntentoLogin(ctx, gu.usuarios, usuario.Usuario)
+	hash, err := utils.HashPassword(PasswordNuevo)
+	if err != nil {
+		return "", err
+	}
+	return gu.usuarios.ModificarPassword(ctx, guardado, hash)
+}
+
+// Restablece la contraseña de un usuario activo a una temporal, dejándolo en estado P: Pendiente.
+// Cierra sus sesiones.
+// tsp_restablecer_password_usuario
+func (gu *GestorUsuarios) RestablecerPassword(ctx context.Context, Usuario models.Usuarios) (string, string, error) {
+	passwordTemporal, hash, err := nuevaPasswordTemporal()
+	if err != nil {
+		return "", "", err
+	}
+	mensaje, err := gu.usuarios.RestablecerPassword(ctx, Usuario.IdUsuario, hash)
+	if err != nil || mensaje != "OK" {
+		return mensaje, "", err
+	}
+	return mensaje, passwordTemporal, nil
+}
+
+// Reemplaza el hash verificado por uno argon2id con los parámetros actuales y devuelve el hash vigente.
+// Si otra sesión cambió la contraseña en el medio, se conserva el hash anterior y el login lo rechaza.
+func (gu *GestorUsuarios) migrarPassword(ctx context.Context, IdUsuario int, anterior string, Password string) (string, error) {
+	nuevo, err := utils.HashPassword(Password)
+	if err != nil {
+		return "", err
+	}
+	mensaje, err := gu.usuarios.MigrarPassword(ctx, IdUsuario, anterior, nuevo)
+	if err != nil {
+		return "", err
+	}
+	if mensaje != "OK" {
+		logs.L(logs.App).WarnContext(ctx, "no se pudo migrar el hash de la contraseña", "id_usuario", IdUsuario, "mensaje", mensaje)
+		return anterior, nil
+	}
+	logs.L(logs.App).InfoContext(ctx, "hash de contraseña migrado a argon2id", "id_usuario", IdUsuario)
+	return nuevo, nil
+}
+
+// Instancia Usuario.Permisos con los permisos de su rol (al iniciar sesión)
+// tsp_dame_rol
+func cargarPermisos(ctx context.Context, roles repositorios.Roles, Usuario *models.Usuarios) error {
+	rol := &models.Roles{Rol: Usuario.Rol}
+	if _, err := roles.Dame(ctx, rol); err != nil {
+		return err
+	}
+	Usuario.Permisos = rol.Permisos
+	if Usuario.Permisos == nil {
+		Usuario.Permisos = []string{}
+	}
+	return nil
+}
+
+// Contraseña temporal para informar al usuario y su hash para guardar
+func nuevaPasswordTemporal() (string, string, error) {
+	passwordTemporal, err := utils.GenerarPasswordTemporal()
+	if err != nil {
+		return "", "", err
+	}
+	hash, err := utils.HashPassword(passwordTemporal)
+	if err != nil {
+		return "", "", err
+	}
+	return passwordTemporal, hash, nil
+}
+
+// Reserva un intento de login del usuario antes de verificar sus credenciales, contándolo como fallido hasta
+// que se confirme (registrarLoginFallido) o se libere (liberarIntentoLogin). Devuelve *ErrorBloqueoLogin si el
+// login está bloqueado o los intentos en curso ya llegan a LOGININTENTOSMAX.
+// tsp_reservar_intento_login
+func reservarIntentoLogin(ctx context.Context, usuarios repositorios.Usuarios, parametros repositorios.Parametros, Usuario string, IP string) error {
+	mensaje, segundos, err := usuarios.ReservarIntentoLogin(ctx, Usuario, IP, obtenerPoliticaBloqueoLogin(parametros))
+	if err != nil {
+		return err
+	}
+	if mensaje != "OK" {
+		return fmt.Errorf("reservar intento de login: %s", mensaje)
+	}
+	if segundos > 0 {
+		return &ErrorBloqueoLogin{Segundos: segundos}
+	}
+	return nil
+}
+
+// Devuelve el intento reservado cuando las credenciales son válidas. Si no se puede, el intento queda contado
+// como fallido: no se interrumpe el login por eso.
+// tsp_liberar_intento_login
+func liberarIntentoLogin(ctx context.Context, usuarios repositorios.Usuarios, Usuario string) {
+	if mensaje, err := usuarios.LiberarIntentoLogin(ctx, Usuario); err != nil || mensaje != "OK" {
+		logs.L(logs.App).WarnContext(ctx, "no se pudo liberar el intento de login", "usuario", Usuario, "mensaje", mensaje, logs.Err(err))
+	}
+}
+
+// Confirma como fallido el intento reservado del usuario. Devuelve *ErrorBloqueoLogin si con él quedó bloqueado.
+// tsp_registrar_login_fallido
+func registrarLoginFallido(ctx context.Context, usuarios repositorios.Usuarios, parametros repositorios.Parametros, Usuario string, IP string) error {
+	mensaje, segundos, err := usuarios.RegistrarLoginFallido(ctx, Usuario, obtenerPoliticaBloqueoLogin(parametros))
+	if err != nil {
+		return err
+	}
+	if mensaje != "OK" {
+		return fmt.Errorf("registrar login fallido: %s", mensaje)
+	}
+	if segundos > 0 {
+		logs.L(logs.App).WarnContext(ctx, "login bloqueado por intentos fallidos", "usuario", Usuario, "ip", IP, "segundos", segundos)
+		return &ErrorBloqueoLogin{Segundos: segundos}
+	}
+	return nil
+}
+
+// Política de bloqueo de login desde los parámetros LOGININTENTOSMAX, LOGINBLOQUEOSEG, LOGINBLOQUEOMAXMIN y
+// LOGINVENTANAHORAS. Los faltantes o inválidos toman el valor por defecto.
+func obtenerPoliticaBloqueoLogin(parametros repositorios.Parametros) repositorios.PoliticaBloqueoLogin {
+	politica := repositorios.PoliticaBloqueoLoginPorDefecto
+	obtenerEntero := func(parametro string, valor *int) {
+		p := &models.Parametros{Parametro: parametro}
+		if _, err := parametros.Dame(context.Background(), p); err == nil {
+			if val, err := strconv.Atoi(p.Valor); err == nil && val > 0 {
+				*valor = val
+			}
+		}
+	}
+	obtenerEntero("LOGININTENTOSMAX", &politica.IntentosMax)
+	obtenerEntero("LOGINBLOQUEOSEG", &politica.SegundosBloqueo)
+	obtenerEntero("LOGINBLOQUEOMAXMIN", &politica.MinutosBloqueoMax)
+	obtenerEntero("LOGINVENTANAHORAS", &politica.HorasVentana)
+	return politica
+}
+
+// Política de contraseñas desde los parámetros PASSWORDLONGITUDMIN, PASSWORDREQUIEREMAYUSCULA,
+// PASSWORDREQUIERENUMERO y PASSWORDREQUIERESIMBOLO (S/N). Los faltantes o inválidos toman el valor por defecto.
+func obtenerPoliticaPassword(parametros repositorios.Parametros) utils.PoliticaPassword {
+	politica := utils.PoliticaPasswordPorDefecto
+	p := &models.Parametros{Parametro: "PASSWORDLONGITUDMIN"}
+	if _, err := parametros.Dame(context.Background(), p); err == nil {
+		if val, err := strconv.Atoi(p.Valor); err == nil && val > 0 {
+			politica.LongitudMinima = val
+		}
+	}
+	obtenerSN := func(parametro string, valor *bool) {
+		p := &models.Parametros{Parametro: parametro}
+		if _, err := parametros.Dame(context.Background(), p); err == nil && (p.Valor == "S" || p.Valor == "N") {
+			*valor = p.Valor == "S"
+		}
+	}
+	obtenerSN("PASSWORDREQUIEREMAYUSCULA", &politica.RequiereMayuscula)
+	obtenerSN("PASSWORDREQUIERENUMERO", &politica.RequiereNumero)
+	obtenerSN("PASSWORDREQUIERESIMBOLO", &politica.RequiereSimbolo)
+	return politica
+}
@@ -0,0 +1,258 @@
+package gestores
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"MSTransaccionesFinancieras/internal/repositorios/memoria"
+)
+
+func ctxSesion(token string) context.Context {
+	ctx := context.WithValue(context.Background(), auth.ClaveCredencial, token)
+	return context.WithValue(ctx, auth.ClaveActor, "USUARIO")
+}
+
+func login(t *testing.T, gu *GestorUsuarios, usuario string, password string) (*models.Usuarios, string) {
+	t.Helper()
+	u := &models.Usuarios{Usuario: usuario}
+	mensaje, err := gu.Login(t.Context(), u, password, &models.Sesiones{}, &models.DesafiosLogin{})
+	if err != nil {
+		t.Fatalf("Login %s: %v", usuario, err)
+	}
+	return u, mensaje
+}
+
+func TestLoginMigraMD5(t *testing.T) {
+	bd := memoria.New()
+	// GuardarUsuario guarda MD5, como los usuarios previos a argon2id
+	admin := bd.GuardarUsuario(models.Usuarios{Usuario: "admin"}, "Admin123")
+	repos := bd.Repositorios()
+	gu := NewGestorUsuarios(repos.Usuarios, repos.Roles, repos.Parametros)
+
+	if _, mensaje := login(t, gu, "admin", "otra"); mensaje != "Credenciales inválidas." {
+		t.Fatalf("login con contraseña incorrecta: %q", mensaje)
+	}
+	if _, mensaje := login(t, gu, "nadie", "Admin123"); mensaje != "Credenciales inválidas." {
+		t.Fatalf("login de usuario inexistente: %q", mensaje)
+	}
+	if _, hash, _ := repos.Usuarios.DamePassword(t.Context(), "admin"); len(hash) != 32 {
+		t.Fatalf("un login fallido no debe migrar el hash: %q", hash)
+	}
+
+	u, mensaje := login(t, gu, "admin", "Admin123")
+	if mensaje != "OK" || u.IdUsuario != admin.IdUsuario || u.TokenSesion == "" {
+		t.Fatalf("login con MD5 heredado: %q %+v", mensaje, u)
+	}
+	if !slices.Equal(u.Permisos, auth.Permisos) {
+		t.Fatalf("el login informa los permisos del rol Administrador: %v", u.Permisos)
+	}
+	_, migrado, _ := repos.Usuarios.DamePassword(t.Context(), "admin")
+	if !strings.HasPrefix(migrado, "$argon2id$") {
+		t.Fatalf("el hash no se migró: %q", migrado)
+	}
+
+	// el hash migrado se usa tal cual en los siguientes logins
+	if _, mensaje := login(t, gu, "admin", "Admin123"); mensaje != "OK" {
+		t.Fatalf("login con argon2id: %q", mensaje)
+	}
+	if _, hash, _ := repos.Usuarios.DamePassword(t.Context(), "admin"); hash != migrado {
+		t.Fatal("un hash argon2id vigente no debe volver a migrarse")
+	}
+}
+
+func TestPoliticaPassword(t *testing.T) {
+	bd := memoria.New()
+	admin := bd.GuardarUsuario(models.Usuarios{Usuario: "admin"}, "Admin123")
+	repos := bd.Repositorios()
+	gu := NewGestorUsuarios(repos.Usuarios, repos.Roles, repos.Parametros)
+	ctxAdmin := ctxSesion(admin.TokenSesion)
+
+	mensaje, id, passwordTemporal, err := gu.Crear(ctxAdmin, models.Usuarios{Usuario: "operador"})
+	if err != nil || mensaje != "OK" || id == 0 || len(passwordTemporal) != 12 {
+		t.Fatalf("Crear: %q Id %d contraseña temporal %q %v", mensaje, id, passwordTemporal, err)
+	}
+	if _, hash, _ := repos.Usuarios.DamePassword(t.Context(), "operador"); !strings.HasPrefix(hash, "$argon2id$") {
+		t.Fatalf("la contraseña temporal debe guardarse hasheada: %q", hash)
+	}
+	operador, mensaje := login(t, gu, "operador", passwordTemporal)
+	if mensaje != "OK - Se requiere cambio de contraseña temporal" {
+		t.Fatalf("login con contraseña temporal: %q", mensaje)
+	}
+	ctxOperador := ctxSesion(operador.TokenSesion)
+
+	// política por defecto: 8 caracteres, mayúscula y número
+	for _, invalida := range []string{"Corta1", "sinmayuscula1", "SinNumeros"} {
+		if mensaje, err := gu.ConfirmarCuenta(ctxOperador, invalida); err != nil || !strings.HasPrefix(mensaje, "Formato de contraseña inválido") {
+			t.Fatalf("ConfirmarCuenta %q: %q %v", invalida, mensaje, err)
+		}
+	}
+
+	// política desde Parametros
+	bd.GuardarParametro(models.Parametros{Parametro: "PASSWORDLONGITUDMIN", Valor: "6"})
+	bd.GuardarParametro(models.Parametros{Parametro: "PASSWORDREQUIERESIMBOLO", Valor: "S"})
+	if mensaje, _ := gu.ConfirmarCuenta(ctxOperador, "Abc123"); !strings.HasPrefix(mensaje, "Formato de contraseña inválido") {
+		t.Fatalf("ConfirmarCuenta sin símbolo: %q", mensaje)
+	}
+	if mensaje, err := gu.ConfirmarCuenta(ctxOperador, "Abc12!"); err != nil || mensaje != "OK" {
+		t.Fatalf("ConfirmarCuenta: %q %v", mensaje, err)
+	}
+
+	operador, mensaje = login(t, gu, "operador", "Abc12!")
+	if mensaje != "OK" {
+		t.Fatalf("login con la contraseña confirmada: %q", mensaje)
+	}
+	if slices.Contains(operador.Permisos, auth.PermisoUsuariosAdmin) || !slices.Contains(operador.Permisos, auth.PermisoTransferenciasEscribir) {
+		t.Fatalf("permisos del rol Operador de un usuario creado: %v", operador.Permisos)
+	}
+	ctxOperador = ctxSesion(operador.TokenSesion)
+	if mensaje, _ := gu.ModificarPassword(ctxOperador, "Otra12!", "Nueva12!", "10.0.0.1"); mensaje != "La contraseña anterior es incorrecta." {
+		t.Fatalf("ModificarPassword con anterior incorrecta: %q", mensaje)
+	}
+	if mensaje, _ := gu.ModificarPassword(ctxOperador, "Abc12!", "Nueva12", "10.0.0.1"); !strings.HasPrefix(mensaje, "Formato de contraseña inválido") {
+		t.Fatalf("ModificarPassword sin símbolo: %q", mensaje)
+	}
+	if mensaje, err := gu.ModificarPassword(ctxOperador, "Abc12!", "Nueva12!", "10.0.0.1"); err != nil || mensaje != "OK" {
+		t.Fatalf("ModificarPassword: %q %v", mensaje, err)
+	}
+	if _, mensaje := login(t, gu, "operador", "Nueva12!"); mensaje != "OK" {
+		t.Fatalf("login con la contraseña modificada: %q", mensaje)
+	}
+
+	// restablecer deja una nueva contraseña temporal
+	mensaje, passwordTemporal, err = gu.RestablecerPassword(ctxAdmin, models.Usuarios{IdUsuario: id})
+	if err != nil || mensaje != "OK" || len(passwordTemporal) != 12 {
+		t.Fatalf("RestablecerPassword: %q %q %v", mensaje, passwordTemporal, err)
+	}
+	if _, mensaje := login(t, gu, "operador", "Nueva12!"); mensaje != "Credenciales inválidas." {
+		t.Fatalf("login con la contraseña anterior al restablecimiento: %q", mensaje)
+	}
+	if _, mensaje := login(t, gu, "operador", passwordTemporal); mensaje != "OK - Se requiere cambio de contraseña temporal" {
+		t.Fatalf("login con la contraseña restablecida: %q", mensaje)
+	}
+}
+
+func TestBloqueoLogin(t *testing.T) {
+	bd := memoria.New()
+	bd.GuardarUsuario(models.Usuarios{Usuario: "operador", Rol: "O"}, "Operador1")
+	bd.GuardarParametro(models.Parametros{Parametro: "LOGININTENTOSMAX", Valor: "3"})
+	repos := bd.Repositorios()
+	gu := NewGestorUsuarios(repos.Usuarios, repos.Roles, repos.Parametros)
+	intentar := func(password string) (string, error) {
+		return gu.Login(t.Context(), &models.Usuarios{Usuario: "operador"}, password, &models.Sesiones{IP: "10.0.0.1"}, &models.DesafiosLogin{})
+	}
+
+	// un login exitoso borra los intentos fallidos
+	for range 2 {
+		if mensaje, err := intentar("otra"); err != nil || mensaje != "Credenciales inválidas." {
+			t.Fatalf("login fallido: %q %v", mensaje, err)
+		}
+	}
+	if mensaje, err := intentar("Operador1"); err != nil || mensaje != "OK" {
+		t.Fatalf("login antes del bloqueo: %q %v", mensaje, err)
+	}
+
+	for range 2 {
+		intentar("otra")
+	}
+	var bloqueo *ErrorBloqueoLogin
+	if _, err := intentar("otra"); !errors.As(err, &bloqueo) || bloqueo.Segundos != 60 {
+		t.Fatalf("tercer login fallido: %v", err)
+	}
+	// bloqueado aun con la contraseña correcta
+	if _, err := intentar("Operador1"); !errors.As(err, &bloqueo) || bloqueo.Segundos < 59 || bloqueo.Segundos > 60 {
+		t.Fatalf("login bloqueado con la contraseña correcta: %v", err)
+	}
+	// otros usuarios no se ven afectados
+	if _, mensaje := login(t, gu, "nadie", "otra"); mensaje != "Credenciales inválidas." {
+		t.Fatalf("login de otro usuario: %q", mensaje)
+	}
+}
+
+// Cuenta los logins que llegan a verificar la contraseña
+type usuariosContados struct {
+	repositorios.Usuarios
+	verificados atomic.Int32
+}
+
+func (u *usuariosContados) DamePassword(ctx context.Context, Usuario string) (int, string, error) {
+	u.verificados.Add(1)
+	return u.Usuarios.DamePassword(ctx, Usuario)
+}
+
+// Los intentos en paralelo no superan LOGININTENTOSMAX: cada uno reserva el suyo antes de verificar la contraseña
+func TestBloqueoLoginConcurrente(t *testing.T) {
+	bd := memoria.New()
+	bd.GuardarUsuario(models.Usuarios{Usuario: "operador", Rol: "O"}, "Operador1")
+	bd.GuardarParametro(models.Parametros{Parametro: "LOGININTENTOSMAX", Valor: "3"})
+	repos := bd.Repositorios()
+	usuarios := &usuariosContados{Usuarios: repos.Usuarios}
+	gu := NewGestorUsuarios(usuarios, repos.Roles, repos.Parametros)
+	// migra el hash a argon2id: cada verificación tarda lo suficiente para que los intentos se superpongan
+	if _, mensaje := login(t, gu, "operador", "Operador1"); mensaje != "OK" {
+		t.Fatalf("login inicial: %q", mensaje)
+	}
+	usuarios.verificados.Store(0)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			mensaje, err := gu.Login(t.Context(), &models.Usuarios{Usuario: "operador"}, "otra", &models.Sesiones{IP: "10.0.0.1"}, &models.DesafiosLogin{})
+			var bloqueo *ErrorBloqueoLogin
+			if mensaje != "Credenciales inválidas." && !errors.As(err, &bloqueo) {
+				t.Errorf("login en paralelo: %q %v", mensaje, err)
+			}
+		})
+	}
+	wg.Wait()
+	if n := usuarios.verificados.Load(); n != 3 {
+		t.Fatalf("se verificaron %d contraseñas, se esperaban 3 (LOGININTENTOSMAX)", n)
+	}
+	var bloqueo *ErrorBloqueoLogin
+	if _, err := gu.Login(t.Context(), &models.Usuarios{Usuario: "operador"}, "Operador1", &models.Sesiones{}, &models.DesafiosLogin{}); !errors.As(err, &bloqueo) {
+		t.Fatalf("login con la contraseña correcta tras los intentos en paralelo: %v", err)
+	}
+}
+
+// Una contraseña anterior inválida al modificarla cuenta como login fallido
+func TestBloqueoModificarPassword(t *testing.T) {
+	bd := memoria.New()
+	operador := bd.GuardarUsuario(models.Usuarios{Usuario: "operador", Rol: "O"}, "Operador1")
+	bd.GuardarParametro(models.Parametros{Parametro: "LOGININTENTOSMAX", Valor: "3"})
+	repos := bd.Repositorios()
+	gu := NewGestorUsuarios(repos.Usuarios, repos.Roles, repos.Parametros)
+	ctxOperador := ctxSesion(operador.TokenSesion)
+
+	// una contraseña anterior correcta no cuenta
+	if _, mensaje := login(t, gu, "operador", "otra"); mensaje != "Credenciales inválidas." {
+		t.Fatalf("login fallido: %q", mensaje)
+	}
+	if mensaje, err := gu.ModificarPassword(ctxOperador, "Operador1", "Operador2", "10.0.0.1"); err != nil || mensaje != "OK" {
+		t.Fatalf("ModificarPassword: %q %v", mensaje, err)
+	}
+	sesion, _ := login(t, gu, "operador", "Operador2")
+	ctxOperador = ctxSesion(sesion.TokenSesion)
+
+	for range 2 {
+		if mensaje, err := gu.ModificarPassword(ctxOperador, "Otra1234", "Operador3", "10.0.0.1"); err != nil || mensaje != "La contraseña anterior es incorrecta." {
+			t.Fatalf("ModificarPassword con anterior incorrecta: %q %v", mensaje, err)
+		}
+	}
+	var bloqueo *ErrorBloqueoLogin
+	if _, err := gu.ModificarPassword(ctxOperador, "Otra1234", "Operador3", "10.0.0.1"); !errors.As(err, &bloqueo) || bloqueo.Segundos != 60 {
+		t.Fatalf("tercera contraseña anterior incorrecta: %v", err)
+	}
+	if _, err := gu.ModificarPassword(ctxOperador, "Operador2", "Operador3", "10.0.0.1"); !errors.As(err, &bloqueo) {
+		t.Fatalf("ModificarPassword bloqueado con la contraseña correcta: %v", err)
+	}
+	if _, err := gu.Login(t.Context(), &models.Usuarios{Usuario: "operador"}, "Operador2", &models.Sesiones{}, &models.DesafiosLogin{}); !errors.As(err, &bloqueo) {
+		t.Fatalf("login bloqueado por ModificarPassword: %v", err)
+	}
+}
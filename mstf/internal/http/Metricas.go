@@ -0,0 +1,15 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Handler del listener interno de métricas (METRICS_PORT): GET /metrics en formato Prometheus.
+// No pasa por el router de la API ni por su autenticación: el puerto solo se expone en la red interna.
+func HandlerMetricas() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.Handler())
+	return mux
+}
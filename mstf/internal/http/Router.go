@@ -1,90 +1,210 @@
 package http
 
 import (
+	"net"
+
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	tigerbeetle "github.com/tigerbeetle/tigerbeetle-go"
 
+	"MSTransaccionesFinancieras/internal/auth"
 	"MSTransaccionesFinancieras/internal/controllers"
+	"MSTransaccionesFinancieras/internal/correlacion"
 	"MSTransaccionesFinancieras/internal/gestores"
 	httpMiddleware "MSTransaccionesFinancieras/internal/http/middlewares"
+	"MSTransaccionesFinancieras/internal/infra/fallas"
 	"MSTransaccionesFinancieras/internal/infra/kafkamstf"
+	"MSTransaccionesFinancieras/internal/infra/limites"
+	"MSTransaccionesFinancieras/internal/ingesta"
+	"MSTransaccionesFinancieras/internal/repositorios"
 )
 
-func InitRouter(productor *kafkamstf.ProductorKafka) *echo.Echo {
+// repos: acceso a los datos (MySQL o memoria)
+// tb: cliente de TigerBeetle (instrumentado, ver persistence.InstrumentarTB)
+// proxiesConfiables: redes de los proxies inversos delante del MS (ver extractorIP)
+func InitRouter(repos repositorios.Repositorios, tb tigerbeetle.Client, productor *kafkamstf.ProductorKafka, consumidor *kafkamstf.Consumidor, fuenteHTTP *ingesta.FuenteHTTP, proxiesConfiables []*net.IPNet) *echo.Echo {
 	e := echo.New()
 	e.HideBanner = true
+	e.IPExtractor = extractorIP(proxiesConfiables)
 
 	// Middlewares
 	e.Use(
 		middleware.Recover(),
-		middleware.Logger(),
-		middleware.CORS(),
-		httpMiddleware.AutenticacionDual(func(c echo.Context) bool {
-			path := c.Request().URL.Path
-			// confirmar-cuenta SÍ usa token de sesión Estado=P; el SP valida internamente.
-			return path == "/ping" || path == "/usuarios/login" ||
-				path == "/usuarios/confirmar-cuenta"
+		middleware.LoggerWithConfig(middleware.LoggerConfig{
+			Format: `{"time":"${time_rfc3339_nano}","correlacion":"${header:X-Correlation-ID}","remote_ip":"${remote_ip}",` +
+				`"method":"${method}","uri":"${uri}","status":${status},"error":"${error}","latency_human":"${latency_human}",` +
+				`"bytes_in":${bytes_in},"bytes_out":${bytes_out}}` + "\n",
+		}),
+		middleware.CORSWithConfig(middleware.CORSConfig{
+			ExposeHeaders: []string{correlacion.HeaderHTTP},
 		}),
+		httpMiddleware.Correlacion(),
+		httpMiddleware.Trazas(),
+		httpMiddleware.Metricas(),
+		httpMiddleware.LimitarPorIP(limites.NewLimitador(), repos.Parametros, rutaSinLimite),
+		httpMiddleware.AutenticacionDual(repos.Autenticacion, rutaPublica),
+		httpMiddleware.LimitarPorCredencial(limites.NewLimitador(), repos.Parametros),
 	)
 
-	initRoutes(e, productor)
+	initRoutes(e, repos, tb, productor, consumidor, fuenteHTTP)
 
 	return e
 }
 
-func initRoutes(router *echo.Echo, productor *kafkamstf.ProductorKafka) {
+// La IP del cliente (IPs permitidas de las API keys, sesiones, límites por IP, logs). Sin proxies configurados es la
+// de la conexión. Con proxies, X-Forwarded-For se recorre desde la derecha y la IP del cliente es la primera que no
+// pertenece a un proxy confiable: lo que el cliente agregue a la izquierda no se tiene en cuenta. Las redes privadas
+// y loopback no se consideran confiables salvo que estén en la lista.
+func extractorIP(proxiesConfiables []*net.IPNet) echo.IPExtractor {
+	if len(proxiesConfiables) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	opciones := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, red := range proxiesConfiables {
+		opciones = append(opciones, echo.TrustIPRange(red))
+	}
+	return echo.ExtractIPFromXFFHeader(opciones...)
+}
+
+// Rutas que se omiten del middleware de auth (y por lo tanto no exigen permisos).
+// confirmar-cuenta SÍ usa token de sesión Estado=P; el SP valida internamente.
+func rutaPublica(c echo.Context) bool {
+	path := c.Request().URL.Path
+	return path == "/ping" || path == "/health/live" || path == "/health/ready" || path == "/usuarios/login" ||
+		path == "/usuarios/confirmar-cuenta" || path == "/usuarios/sesiones/renovar" || path == "/usuarios/login/segundo-factor" ||
+		path == "/usuarios/login/segundo-factor/inscribir"
+}
+
+// Rutas que se omiten del límite de tasa por IP: las consultan los orquestadores
+func rutaSinLimite(c echo.Context) bool {
+	path := c.Request().URL.Path
+	return path == "/ping" || path == "/health/live" || path == "/health/ready"
+}
+
+func initRoutes(router *echo.Echo, repos repositorios.Repositorios, tb tigerbeetle.Client, productor *kafkamstf.ProductorKafka, consumidor *kafkamstf.Consumidor, fuenteHTTP *ingesta.FuenteHTTP) {
 	// Inicializac de controladores
 	mainControlador := controllers.NewMainControlador()
-	gestorCuentas := gestores.NewGestorCuentas()
-	gestorTransferencias := gestores.NewGestorTransferencias()
-	cuentasControlador := controllers.NewCuentasControlador(gestorCuentas, gestorTransferencias)
-	transferenciasControlador := controllers.NewTransferenciasControlador(gestorTransferencias, productor)
-	gestorUsuarios := gestores.NewGestorUsuarios()
+	saludControlador := controllers.NewSaludControlador(repos.Parametros)
+	gestorCuentas := gestores.NewGestorCuentas(tb, repos.Monedas, repos.Auditoria)
+	gestorTransferencias := gestores.NewGestorTransferencias(tb, repos.Parametros, repos.Monedas, repos.Auditoria, gestores.NewGestorEstadosTransferencias(repos.Estados))
+	cuentasControlador := controllers.NewCuentasControlador(gestorCuentas, gestorTransferencias, repos.Parametros)
+	transferenciasControlador := controllers.NewTransferenciasControlador(gestorTransferencias, productor, fuenteHTTP, repos.Parametros)
+	gestorUsuarios := gestores.NewGestorUsuarios(repos.Usuarios, repos.Roles, repos.Parametros)
 	usuariosControlador := controllers.NewUsuariosControlador(gestorUsuarios)
-	paramControlador := controllers.NewParametrosControlador()
-	gestorMonedas := gestores.NewGestorMonedas()
+	sesionesControlador := controllers.NewSesionesControlador(gestores.NewGestorSesiones(repos.Sesiones, repos.Parametros))
+	segundoFactorControlador := controllers.NewSegundoFactorControlador(gestores.NewGestorSegundoFactor(repos.SegundoFactor, repos.Usuarios, repos.Roles, repos.Parametros))
+	paramControlador := controllers.NewParametrosControlador(gestores.NewGestorParametros(repos.Parametros))
+	gestorMonedas := gestores.NewGestorMonedas(repos.Monedas)
 	monedasControlador := controllers.NewMonedasControlador(gestorMonedas, gestorCuentas)
+	consumidorControlador := controllers.NewConsumidorControlador(consumidor, gestores.NewGestorCuarentena(repos.Cuarentena))
+	logsControlador := controllers.NewLogsControlador()
+	rolesControlador := controllers.NewRolesControlador(gestores.NewGestorRoles(repos.Roles))
+	apiKeysControlador := controllers.NewApiKeysControlador(gestores.NewGestorApiKeys(repos.ApiKeys))
+	operacionesControlador := controllers.NewOperacionesControlador(gestores.NewGestorOperaciones(repos.Auditoria))
+
+	// Cada ruta autenticada exige un permiso del rol del actor (ver auth.Permisos). Sin permiso: las rutas
+	// públicas (rutaPublica) y las de la propia cuenta y sesiones, que solo requieren estar autenticado
+	permiso := httpMiddleware.RequierePermiso
 
 	// Endpoint de prueba
 	router.GET("/ping", mainControlador.Ping)
 
+	// Health checks (liveness y readiness)
+	router.GET("/health/live", saludControlador.Live)
+	router.GET("/health/ready", saludControlador.Ready)
+
 	// Cuentas
-	router.GET("/cuentas/:idusuariofinal/:idmoneda/historial", cuentasControlador.DameHistorial)
-	router.GET("/cuentas/:idusuariofinal/:idmoneda/transferencias", cuentasControlador.DameTransferencias)
-	router.GET("/cuentas/:idusuariofinal/:idmoneda", cuentasControlador.Dame)
-	router.POST("/cuentas", cuentasControlador.Crear)
-	router.GET("/cuentas", cuentasControlador.Buscar)
-	router.PUT("/cuentas/:idusuariofinal/:idmoneda/desactivar", cuentasControlador.Desactivar)
-	router.PUT("/cuentas/:idusuariofinal/:idmoneda/activar", cuentasControlador.Activar)
+	router.GET("/cuentas/:idusuariofinal/:idmoneda/historial", cuentasControlador.DameHistorial, permiso(auth.PermisoCuentasLeer))
+	router.GET("/cuentas/:idusuariofinal/:idmoneda/transferencias", cuentasControlador.DameTransferencias, permiso(auth.PermisoCuentasLeer))
+	router.GET("/cuentas/:idusuariofinal/:idmoneda", cuentasControlador.Dame, permiso(auth.PermisoCuentasLeer))
+	router.POST("/cuentas", cuentasControlador.Crear, permiso(auth.PermisoCuentasEscribir))
+	router.GET("/cuentas", cuentasControlador.Buscar, permiso(auth.PermisoCuentasLeer))
+	router.PUT("/cuentas/:idusuariofinal/:idmoneda/desactivar", cuentasControlador.Desactivar, permiso(auth.PermisoCuentasCerrar))
+	router.PUT("/cuentas/:idusuariofinal/:idmoneda/activar", cuentasControlador.Activar, permiso(auth.PermisoCuentasCerrar))
 
 	//Transferencias
-	router.GET("/transferencias/:idtransferencia", transferenciasControlador.Dame)
-	router.GET("/transferencias", transferenciasControlador.Buscar)
-	router.POST("/transferencias", transferenciasControlador.Crear)
+	router.GET("/transferencias/:idtransferencia", transferenciasControlador.Dame, permiso(auth.PermisoTransferenciasLeer))
+	router.GET("/transferencias", transferenciasControlador.Buscar, permiso(auth.PermisoTransferenciasLeer))
+	router.GET("/transferencias/estados", transferenciasControlador.Estados, permiso(auth.PermisoTransferenciasLeer))
+	router.POST("/transferencias", transferenciasControlador.Crear, permiso(auth.PermisoTransferenciasEscribir))
+	router.POST("/transferencias/sincronica", transferenciasControlador.CrearSincronica, permiso(auth.PermisoTransferenciasEscribir))
+	router.POST("/transferencias/lote", transferenciasControlador.CrearLote, permiso(auth.PermisoTransferenciasEscribir))
 
 	// Usuarios
-	router.GET("/usuarios/:idusuario", usuariosControlador.Dame)
-	router.GET("/usuarios", usuariosControlador.Buscar)
-	router.POST("/usuarios", usuariosControlador.Crear)
+	router.GET("/usuarios/:idusuario", usuariosControlador.Dame, permiso(auth.PermisoUsuariosLeer))
+	router.GET("/usuarios", usuariosControlador.Buscar, permiso(auth.PermisoUsuariosLeer))
+	router.POST("/usuarios", usuariosControlador.Crear, permiso(auth.PermisoUsuariosAdmin))
 	router.POST("/usuarios/login", usuariosControlador.Login)
 	router.POST("/usuarios/logout", usuariosControlador.Logout)
-	router.PUT("/usuarios/activar/:idusuario", usuariosControlador.Activar)
-	router.PUT("/usuarios/desactivar/:idusuario", usuariosControlador.Desactivar)
+	router.PUT("/usuarios/activar/:idusuario", usuariosControlador.Activar, permiso(auth.PermisoUsuariosAdmin))
+	router.PUT("/usuarios/desactivar/:idusuario", usuariosControlador.Desactivar, permiso(auth.PermisoUsuariosAdmin))
 	router.PUT("/usuarios/confirmar-cuenta", usuariosControlador.ConfirmarUsuario)
 	router.PUT("/usuarios/password/modificar", usuariosControlador.ModificarPassword)
-	router.PUT("/usuarios/password/reestablecer", usuariosControlador.ReestablecerPassword)
-	router.DELETE("/usuarios/:idusuario", usuariosControlador.Borrar)
+	router.PUT("/usuarios/password/reestablecer", usuariosControlador.ReestablecerPassword, permiso(auth.PermisoUsuariosAdmin))
+	router.DELETE("/usuarios/:idusuario", usuariosControlador.Borrar, permiso(auth.PermisoUsuariosAdmin))
+
+	// Sesiones
+	router.POST("/usuarios/sesiones/renovar", sesionesControlador.Renovar)
+	router.GET("/usuarios/sesiones", sesionesControlador.Listar)
+	router.DELETE("/usuarios/sesiones/:idsesion", sesionesControlador.Revocar)
+	router.DELETE("/usuarios/:idusuario/sesiones", sesionesControlador.RevocarUsuario, permiso(auth.PermisoUsuariosAdmin))
+
+	// Segundo factor (TOTP)
+	router.POST("/usuarios/login/segundo-factor", segundoFactorControlador.CompletarLogin)
+	router.POST("/usuarios/login/segundo-factor/inscribir", segundoFactorControlador.InscribirDesafio)
+	router.POST("/usuarios/segundo-factor", segundoFactorControlador.Inscribir)
+	router.PUT("/usuarios/segundo-factor/activar", segundoFactorControlador.Activar)
+	router.DELETE("/usuarios/:idusuario/segundo-factor", segundoFactorControlador.Restablecer, permiso(auth.PermisoUsuariosAdmin))
+
+	// Roles y permisos
+	router.GET("/roles/permisos", rolesControlador.Permisos, permiso(auth.PermisoRolesLeer))
+	router.GET("/roles/:rol", rolesControlador.Dame, permiso(auth.PermisoRolesLeer))
+	router.GET("/roles", rolesControlador.Listar, permiso(auth.PermisoRolesLeer))
+	router.POST("/roles", rolesControlador.Crear, permiso(auth.PermisoRolesEscribir))
+	router.PUT("/roles/:rol", rolesControlador.Modificar, permiso(auth.PermisoRolesEscribir))
+	router.DELETE("/roles/:rol", rolesControlador.Borrar, permiso(auth.PermisoRolesEscribir))
+	router.PUT("/usuarios/:idusuario/rol", rolesControlador.AsignarUsuario, permiso(auth.PermisoRolesEscribir))
+
+	// API keys de los sistemas cliente
+	router.GET("/apikeys", apiKeysControlador.Listar, permiso(auth.PermisoApiKeysLeer))
+	router.POST("/apikeys", apiKeysControlador.Crear, permiso(auth.PermisoApiKeysEscribir))
+	router.PUT("/apikeys/:idapikey/rotar", apiKeysControlador.Rotar, permiso(auth.PermisoApiKeysEscribir))
+	router.PUT("/apikeys/:idapikey/revocar", apiKeysControlador.Revocar, permiso(auth.PermisoApiKeysEscribir))
+
+	// Auditoría de operaciones
+	router.GET("/operaciones", operacionesControlador.Buscar, permiso(auth.PermisoAuditoriaLeer))
+	router.GET("/operaciones/verificar", operacionesControlador.Verificar, permiso(auth.PermisoAuditoriaLeer))
 
 	// Parámetros
-	router.GET("/parametros/:parametro", paramControlador.Dame)
-	router.GET("/parametros", paramControlador.Buscar)
-	router.PUT("/parametros/:parametro", paramControlador.Modificar)
+	router.GET("/parametros/:parametro", paramControlador.Dame, permiso(auth.PermisoParametrosLeer))
+	router.GET("/parametros", paramControlador.Buscar, permiso(auth.PermisoParametrosLeer))
+	router.PUT("/parametros/:parametro", paramControlador.Modificar, permiso(auth.PermisoParametrosEscribir))
 
 	// Monedas
-	router.GET("/monedas/:idmoneda", monedasControlador.Dame)
-	router.POST("/monedas", monedasControlador.Crear)
-	router.DELETE("/monedas/:idmoneda", monedasControlador.Borrar)
-	router.GET("/monedas", monedasControlador.Listar)
-	router.PUT("/monedas/:idmoneda/desactivar", monedasControlador.Desactivar)
-	router.PUT("/monedas/:idmoneda/activar", monedasControlador.Activar)
+	router.GET("/monedas/:idmoneda", monedasControlador.Dame, permiso(auth.PermisoMonedasLeer))
+	router.POST("/monedas", monedasControlador.Crear, permiso(auth.PermisoMonedasEscribir))
+	router.DELETE("/monedas/:idmoneda", monedasControlador.Borrar, permiso(auth.PermisoMonedasEscribir))
+	router.GET("/monedas", monedasControlador.Listar, permiso(auth.PermisoMonedasLeer))
+	router.PUT("/monedas/:idmoneda/desactivar", monedasControlador.Desactivar, permiso(auth.PermisoMonedasEscribir))
+	router.PUT("/monedas/:idmoneda/activar", monedasControlador.Activar, permiso(auth.PermisoMonedasEscribir))
+
+	// Consumidor
+	router.GET("/consumidor/cuarentena", consumidorControlador.Cuarentena, permiso(auth.PermisoConsumidorLeer))
+	router.GET("/consumidor/estado", consumidorControlador.Estado, permiso(auth.PermisoConsumidorLeer))
+	router.GET("/consumidor/offsets", consumidorControlador.Offsets, permiso(auth.PermisoConsumidorLeer))
+	router.PUT("/consumidor/pausar", consumidorControlador.Pausar, permiso(auth.PermisoConsumidorEscribir))
+	router.PUT("/consumidor/reanudar", consumidorControlador.Reanudar, permiso(auth.PermisoConsumidorEscribir))
+	router.POST("/consumidor/reprocesar", consumidorControlador.Reprocesar, permiso(auth.PermisoConsumidorEscribir))
+
+	// Administración: nivel de log por subsistema
+	router.GET("/admin/logs", logsControlador.Niveles, permiso(auth.PermisoSistemaAdmin))
+	router.PUT("/admin/logs/:subsistema", logsControlador.ModificarNivel, permiso(auth.PermisoSistemaAdmin))
+
+	// Administración: inyección de fallas (solo con FALLAS_HABILITADAS=true)
+	if fallas.Habilitada() {
+		fallasControlador := controllers.NewFallasControlador()
+		router.GET("/admin/fallas", fallasControlador.Reglas, permiso(auth.PermisoSistemaAdmin))
+		router.PUT("/admin/fallas/:destino", fallasControlador.Configurar, permiso(auth.PermisoSistemaAdmin))
+		router.DELETE("/admin/fallas/:destino", fallasControlador.Quitar, permiso(auth.PermisoSistemaAdmin))
+	}
 }
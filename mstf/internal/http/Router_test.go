@@ -0,0 +1,323 @@
+package http
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/config"
+	"MSTransaccionesFinancieras/internal/infra/fallas"
+	"MSTransaccionesFinancieras/internal/infra/persistence"
+	"MSTransaccionesFinancieras/internal/infra/tbmemoria"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios/memoria"
+	"MSTransaccionesFinancieras/internal/salud"
+)
+
+// Rutas autenticadas que no exigen permisos: operan sobre la cuenta y las sesiones del propio usuario
+var rutasPropias = map[string]bool{
+	"POST /usuarios/logout":                true,
+	"PUT /usuarios/password/modificar":     true,
+	"GET /usuarios/sesiones":               true,
+	"DELETE /usuarios/sesiones/:idsesion":  true,
+	"POST /usuarios/segundo-factor":        true,
+	"PUT /usuarios/segundo-factor/activar": true,
+}
+
+var parametroRuta = regexp.MustCompile(`:[a-z]+`)
+
+func llamar(t *testing.T, h http.Handler, metodo string, ruta string, cabecera string, valor string) int {
+	t.Helper()
+	req := httptest.NewRequest(metodo, ruta, nil)
+	req.Header.Set(cabecera, valor)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestPermisosPorRuta(t *testing.T) {
+	bd := memoria.New()
+	bd.GuardarApiKey(models.ApiKeys{Nombre: "sistema", Sistema: "test"}, "clave")
+	bd.GuardarRol(models.Roles{Rol: "N", Nombre: "Sin permisos", Permisos: []string{}})
+	bd.GuardarRol(models.Roles{Rol: "M", Nombre: "Monedas", Permisos: []string{auth.PermisoMonedasLeer}})
+	sinPermisos := bd.GuardarUsuario(models.Usuarios{Usuario: "sinpermisos", Rol: "N"}, "sinpermisos1")
+	monedas := bd.GuardarUsuario(models.Usuarios{Usuario: "monedas", Rol: "M"}, "monedas1")
+	e := InitRouter(bd.Repositorios(), nil, nil, nil, nil, nil)
+
+	// toda ruta que no sea pública ni de la propia cuenta exige un permiso
+	verificadas := 0
+	for _, r := range e.Routes() {
+		req := httptest.NewRequest(r.Method, parametroRuta.ReplaceAllString(r.Path, "1"), nil)
+		if rutaPublica(e.NewContext(req, httptest.NewRecorder())) || rutasPropias[r.Method+" "+r.Path] {
+			continue
+		}
+		status := llamar(t, e, r.Method, req.URL.Path, "Authorization", "Bearer "+sinPermisos.TokenSesion)
+		if status != http.StatusForbidden {
+			t.Errorf("%s %s sin permisos: status %d, se esperaba 403", r.Method, r.Path, status)
+		}
+		verificadas++
+	}
+	if verificadas < 40 {
+		t.Fatalf("solo se verificaron %d rutas", verificadas)
+	}
+
+	bearer := "Bearer " + monedas.TokenSesion
+	if status := llamar(t, e, http.MethodGet, "/monedas", "Authorization", bearer); status != http.StatusOK {
+		t.Fatalf("GET /monedas con monedas:read: status %d", status)
+	}
+	if status := llamar(t, e, http.MethodPost, "/monedas", "Authorization", bearer); status != http.StatusForbidden {
+		t.Fatalf("POST /monedas sin monedas:write: status %d", status)
+	}
+	if status := llamar(t, e, http.MethodGet, "/usuarios/sesiones", "Authorization", bearer); status != http.StatusOK {
+		t.Fatalf("GET /usuarios/sesiones (propia) sin permisos: status %d", status)
+	}
+
+	// la API key del sistema tiene los permisos del rol S
+	if status := llamar(t, e, http.MethodGet, "/usuarios", "X-API-Key", "clave"); status != http.StatusOK {
+		t.Fatalf("GET /usuarios con la API key: status %d", status)
+	}
+	bd.GuardarRol(models.Roles{Rol: "S", Nombre: "Sistema", Permisos: []string{auth.PermisoMonedasLeer}})
+	if status := llamar(t, e, http.MethodGet, "/usuarios", "X-API-Key", "clave"); status != http.StatusForbidden {
+		t.Fatalf("GET /usuarios con la API key sin usuarios:read: status %d", status)
+	}
+}
+
+func TestIPDelClienteDetrasDeProxy(t *testing.T) {
+	bd := memoria.New()
+	bd.GuardarApiKey(models.ApiKeys{Nombre: "sistema", Sistema: "test", IPsPermitidas: []string{"203.0.113.7"}}, "clave")
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+
+	llamarDesde := func(e http.Handler, remoteAddr string, xff string) int {
+		req := httptest.NewRequest(http.MethodGet, "/usuarios", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-API-Key", "clave")
+		if xff != "" {
+			req.Header.Set("X-Forwarded-For", xff)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	e := InitRouter(bd.Repositorios(), nil, nil, nil, nil, []*net.IPNet{proxies})
+	casos := []struct {
+		remoteAddr string
+		xff        string
+		ok         bool
+	}{
+		// el proxy (nginx) agrega la IP del cliente
+		{"10.0.0.5:4000", "203.0.113.7", true},
+		// cadena de proxies confiables
+		{"10.0.0.5:4000", "203.0.113.7, 10.0.0.9", true},
+		// el cliente falsifica X-Forwarded-For y el proxy agrega su IP real a la derecha
+		{"10.0.0.5:4000", "203.0.113.7, 198.51.100.1", false},
+		// conexión directa, sin pasar por el proxy: el header no se tiene en cuenta
+		{"198.51.100.1:4000", "203.0.113.7", false},
+		{"203.0.113.7:4000", "", true},
+	}
+	for _, c := range casos {
+		if status := llamarDesde(e, c.remoteAddr, c.xff); (status == http.StatusOK) != c.ok {
+			t.Errorf("desde %s con X-Forwarded-For %q: status %d", c.remoteAddr, c.xff, status)
+		}
+	}
+
+	// sin proxies configurados la IP es siempre la de la conexión
+	e = InitRouter(bd.Repositorios(), nil, nil, nil, nil, nil)
+	if status := llamarDesde(e, "10.0.0.5:4000", "203.0.113.7"); status == http.StatusOK {
+		t.Fatalf("X-Forwarded-For sin proxies configurados: status %d", status)
+	}
+}
+
+func TestLimitesDeTasa(t *testing.T) {
+	bd := memoria.New()
+	bd.GuardarApiKey(models.ApiKeys{Nombre: "sistema", Sistema: "test"}, "clave")
+	bd.GuardarParametro(models.Parametros{Parametro: "TASAIPMIN", Valor: "1"})
+	bd.GuardarParametro(models.Parametros{Parametro: "TASAIPRAFAGA", Valor: "3"})
+	bd.GuardarParametro(models.Parametros{Parametro: "TASAAPIKEYMIN", Valor: "1"})
+	bd.GuardarParametro(models.Parametros{Parametro: "TASAAPIKEYRAFAGA", Valor: "2"})
+	e := InitRouter(bd.Repositorios(), nil, nil, nil, nil, nil)
+
+	// por API key: la ráfaga de 2 se agota antes que la de la IP
+	for i := 1; i <= 2; i++ {
+		if status := llamar(t, e, http.MethodGet, "/monedas", "X-API-Key", "clave"); status != http.StatusOK {
+			t.Fatalf("solicitud %d con la API key: status %d", i, status)
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "/monedas", nil)
+	req.Header.Set("X-API-Key", "clave")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Fatalf("límite por API key: status %d Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	// por IP: alcanza a las rutas públicas y a las credenciales inválidas, no a los health checks
+	if status := llamar(t, e, http.MethodGet, "/ping", "", ""); status != http.StatusOK {
+		t.Fatalf("GET /ping: status %d", status)
+	}
+	if status := llamar(t, e, http.MethodPost, "/usuarios/login", "X-API-Key", "otra"); status != http.StatusTooManyRequests {
+		t.Fatalf("límite por IP: status %d", status)
+	}
+	if status := llamar(t, e, http.MethodGet, "/health/live", "", ""); status != http.StatusOK {
+		t.Fatalf("GET /health/live: status %d", status)
+	}
+}
+
+// /health/ready responde 200 con todas las dependencias críticas en OK y 503 con el detalle si alguna cae.
+// TB con la falla inyectada; MySQL y Kafka con verificaciones que fallan a pedido.
+func TestHealthReady(t *testing.T) {
+	if err := fallas.Init(config.Config{InyeccionFallas: true}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(fallas.Limpiar)
+	tb := fallas.EnvolverTB(tbmemoria.New())
+	caidas := map[string]bool{}
+	verificarSimulada := func(nombre string) func(context.Context) error {
+		return func(context.Context) error {
+			if caidas[nombre] {
+				return errors.New(nombre + " caído")
+			}
+			return nil
+		}
+	}
+	salud.Registrar("tigerbeetle", true, func(ctx context.Context) error { return persistence.VerificarTB(ctx, tb) })
+	salud.Registrar("mysql", true, verificarSimulada("mysql"))
+	salud.Registrar("kafka_consumidor", true, verificarSimulada("kafka_consumidor"))
+	salud.Registrar("kafka_productor", false, verificarSimulada("kafka_productor"))
+	salud.MarcarInicializado()
+	e := InitRouter(memoria.New().Repositorios(), nil, nil, nil, nil, nil)
+
+	ready := func(t *testing.T, status int, estado string) salud.Reporte {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+		var reporte salud.Reporte
+		if err := json.Unmarshal(rec.Body.Bytes(), &reporte); err != nil {
+			t.Fatalf("cuerpo de /health/ready: %v %s", err, rec.Body.String())
+		}
+		if rec.Code != status || reporte.Estado != estado {
+			t.Fatalf("GET /health/ready: status %d Estado %s, se esperaba %d %s: %s", rec.Code, reporte.Estado, status, estado, rec.Body.String())
+		}
+		return reporte
+	}
+
+	if r := ready(t, http.StatusOK, salud.EstadoOK); len(r.Dependencias) != 5 {
+		t.Fatalf("dependencias informadas: %+v", r.Dependencias)
+	}
+
+	if err := fallas.Configurar(fallas.TigerBeetle, fallas.Regla{Modo: fallas.ModoError}); err != nil {
+		t.Fatal(err)
+	}
+	if d := ready(t, http.StatusServiceUnavailable, salud.EstadoError).Dependencias["tigerbeetle"]; d.Estado != salud.EstadoError || !d.Critica || d.Error == "" {
+		t.Fatalf("TB caído: %+v", d)
+	}
+	fallas.Limpiar()
+
+	for _, nombre := range []string{"mysql", "kafka_consumidor"} {
+		caidas[nombre] = true
+		d := ready(t, http.StatusServiceUnavailable, salud.EstadoError).Dependencias[nombre]
+		if d.Estado != salud.EstadoError || d.Error != nombre+" caído" {
+			t.Fatalf("%s caído: %+v", nombre, d)
+		}
+		caidas[nombre] = false
+	}
+
+	// el productor no es crítico: se informa pero el MS sigue listo
+	caidas["kafka_productor"] = true
+	if d := ready(t, http.StatusOK, salud.EstadoOK).Dependencias["kafka_productor"]; d.Estado != salud.EstadoError || d.Critica {
+		t.Fatalf("productor caído: %+v", d)
+	}
+}
+
+// /metrics no está en la API: se expone en el listener interno (HandlerMetricas), con las requests de la API
+func TestMetricasEnListenerInterno(t *testing.T) {
+	bd := memoria.New()
+	bd.GuardarApiKey(models.ApiKeys{Nombre: "sistema", Sistema: "test"}, "clave")
+	e := InitRouter(bd.Repositorios(), nil, nil, nil, nil, nil)
+
+	if status := llamar(t, e, http.MethodGet, "/metrics", "", ""); status != http.StatusUnauthorized {
+		t.Fatalf("GET /metrics en la API sin credenciales: status %d, se esperaba 401", status)
+	}
+	if status := llamar(t, e, http.MethodGet, "/metrics", "X-API-Key", "clave"); status != http.StatusNotFound {
+		t.Fatalf("GET /metrics en la API: status %d, se esperaba 404", status)
+	}
+	if status := llamar(t, e, http.MethodGet, "/ping", "", ""); status != http.StatusOK {
+		t.Fatalf("GET /ping: status %d", status)
+	}
+
+	rec := httptest.NewRecorder()
+	HandlerMetricas().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `mstf_http_requests_total{codigo="200",metodo="GET",ruta="/ping"}`) {
+		t.Fatalf("GET /metrics del listener interno: status %d\n%s", rec.Code, rec.Body.String())
+	}
+	if status := llamar(t, HandlerMetricas(), http.MethodGet, "/usuarios", "X-API-Key", "clave"); status != http.StatusNotFound {
+		t.Fatalf("el listener interno solo expone /metrics: status %d", status)
+	}
+}
+
+func TestOperacionesCSV(t *testing.T) {
+	bd := memoria.New()
+	admin := bd.GuardarUsuario(models.Usuarios{Usuario: "admin"}, "Admin123")
+	repos := bd.Repositorios()
+	if mensaje, err := repos.Auditoria.Registrar(t.Context(), "MP", map[string]any{"Parametro": "MONTOMAXTRANSFER", "Valor": "a,b"}); err != nil || mensaje != "OK" {
+		t.Fatalf("Registrar: %q %v", mensaje, err)
+	}
+	e := InitRouter(repos, nil, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/operaciones?Entidad=Parametro&IdEntidad=MONTOMAXTRANSFER", nil)
+	req.Header.Set("Authorization", "Bearer "+admin.TokenSesion)
+	req.Header.Set("Accept", "text/csv")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv; charset=utf-8" ||
+		!strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment;") {
+		t.Fatalf("GET /operaciones en CSV: status %d %v", rec.Code, rec.Header())
+	}
+	filas, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil || len(filas) != 2 || filas[0][0] != "IdOperacion" || filas[1][1] != "" || filas[1][2] != "MP" ||
+		filas[1][4] != `{"Parametro":"MONTOMAXTRANSFER","Valor":"a,b"}` || len(filas[1][5]) != 64 {
+		t.Fatalf("CSV: %q %v", filas, err)
+	}
+
+	// la cadena de hashes está íntegra (sin clave de auditoría no se verifican anclajes)
+	req = httptest.NewRequest(http.MethodGet, "/operaciones/verificar", nil)
+	req.Header.Set("Authorization", "Bearer "+admin.TokenSesion)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	var verificacion models.VerificacionOperaciones
+	if err := json.Unmarshal(rec.Body.Bytes(), &verificacion); rec.Code != http.StatusOK || err != nil || !verificacion.Integra ||
+		verificacion.OperacionesVerificadas != 1 {
+		t.Fatalf("GET /operaciones/verificar: status %d %s", rec.Code, rec.Body.String())
+	}
+
+	if status := llamar(t, e, http.MethodGet, "/operaciones?FechaInicio=ayer", "Authorization", "Bearer "+admin.TokenSesion); status != http.StatusBadRequest {
+		t.Fatalf("GET /operaciones con fecha inválida: status %d", status)
+	}
+	if status := llamar(t, e, http.MethodGet, "/operaciones?Entidad=Sesion", "Authorization", "Bearer "+admin.TokenSesion); status != http.StatusBadRequest {
+		t.Fatalf("GET /operaciones con entidad inválida: status %d", status)
+	}
+
+	// las celdas que una planilla interpretaría como fórmula se exportan como texto
+	for _, tipo := range []string{"=HYPERLINK(\"http://x\")", "+1", "-1", "@SUMA(A1)", "\tT", "\rR"} {
+		if mensaje, err := repos.Auditoria.Registrar(t.Context(), tipo, map[string]any{"Rol": "R"}); err != nil || mensaje != "OK" {
+			t.Fatalf("Registrar %q: %q %v", tipo, mensaje, err)
+		}
+		req = httptest.NewRequest(http.MethodGet, "/operaciones?Entidad=Rol&IdEntidad=R&Limite=1", nil)
+		req.Header.Set("Authorization", "Bearer "+admin.TokenSesion)
+		req.Header.Set("Accept", "text/csv")
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		filas, err = csv.NewReader(rec.Body).ReadAll()
+		if err != nil || len(filas) != 2 || filas[1][2] != "'"+tipo || filas[1][4] != `{"Rol":"R"}` {
+			t.Fatalf("CSV con %q: %q %v", tipo, filas, err)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"MSTransaccionesFinancieras/internal/correlacion"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Toma el IdCorrelacion del header X-Correlation-ID (o X-Request-ID) o genera uno nuevo.
+// Lo deja en el contexto de la request, en el header de la request (para el log HTTP) y en la respuesta.
+func Correlacion() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			id := req.Header.Get(correlacion.HeaderHTTP)
+			if id == "" {
+				id = req.Header.Get(correlacion.HeaderHTTPAlternativo)
+			}
+			id = correlacion.Normalizar(id)
+
+			req.Header.Set(correlacion.HeaderHTTP, id)
+			c.Response().Header().Set(correlacion.HeaderHTTP, id)
+			c.SetRequest(req.WithContext(correlacion.EnContexto(req.Context(), id)))
+
+			return next(c)
+		}
+	}
+}
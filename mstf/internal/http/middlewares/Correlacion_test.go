@@ -0,0 +1,59 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/correlacion"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestCorrelacion(t *testing.T) {
+	largo := strings.Repeat("a", 65)
+	casos := []struct {
+		nombre  string
+		headers map[string]string
+		// vacío: se espera uno generado
+		esperado string
+	}{
+		{"X-Correlation-ID", map[string]string{correlacion.HeaderHTTP: "pedido-42"}, "pedido-42"},
+		{"X-Request-ID", map[string]string{correlacion.HeaderHTTPAlternativo: "req.7:a_b"}, "req.7:a_b"},
+		{"X-Correlation-ID tiene prioridad", map[string]string{correlacion.HeaderHTTP: "pedido-42", correlacion.HeaderHTTPAlternativo: "otro"}, "pedido-42"},
+		{"sin header", nil, ""},
+		{"caracteres inválidos", map[string]string{correlacion.HeaderHTTP: "pedido 42"}, ""},
+		{"demasiado largo", map[string]string{correlacion.HeaderHTTP: largo}, ""},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			e := echo.New()
+			var enContexto, enRequest string
+			e.Use(Correlacion())
+			e.GET("/", func(c echo.Context) error {
+				enContexto = correlacion.DesdeContexto(c.Request().Context())
+				enRequest = c.Request().Header.Get(correlacion.HeaderHTTP)
+				return c.NoContent(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range c.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			id := rec.Header().Get(correlacion.HeaderHTTP)
+			if c.esperado != "" && id != c.esperado {
+				t.Fatalf("IdCorrelacion %q, se esperaba %q", id, c.esperado)
+			}
+			if c.esperado == "" && (id == "" || id == c.headers[correlacion.HeaderHTTP] || correlacion.Normalizar(id) != id) {
+				t.Fatalf("se esperaba un IdCorrelacion generado: %q", id)
+			}
+			if enContexto != id || enRequest != id {
+				t.Fatalf("respuesta %q, context %q, request %q", id, enContexto, enRequest)
+			}
+		})
+	}
+}
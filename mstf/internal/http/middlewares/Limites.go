@@ -0,0 +1,97 @@
+package middlewares
+
+import (
+	"MSTransaccionesFinancieras/internal/infra/limites"
+	"MSTransaccionesFinancieras/internal/infra/metricas"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"MSTransaccionesFinancieras/internal/utils"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// Límites de tasa por defecto (solicitudes por minuto y ráfaga), si el parámetro no existe o no es válido
+var limitesPorDefecto = map[string]int{
+	"TASAIPMIN":        600,
+	"TASAIPRAFAGA":     100,
+	"TASAAPIKEYMIN":    1200,
+	"TASAAPIKEYRAFAGA": 200,
+	"TASASESIONMIN":    300,
+	"TASASESIONRAFAGA": 60,
+}
+
+// Limita las solicitudes por IP del cliente (token bucket, TASAIPMIN y TASAIPRAFAGA). Va antes de la
+// autenticación para acotar también las rutas públicas (login) y las credenciales inválidas.
+// Responde 429 con Retry-After.
+func LimitarPorIP(limitador *limites.Limitador, parametros repositorios.Parametros, skipper middleware.Skipper) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if skipper(c) {
+				return next(c)
+			}
+			porMinuto, rafaga := obtenerLimite(parametros, "TASAIPMIN", "TASAIPRAFAGA")
+			if ok, espera := limitador.Tomar("ip:"+c.RealIP(), porMinuto, rafaga); !ok {
+				return rechazarPorLimite(c, "ip", espera)
+			}
+			return next(c)
+		}
+	}
+}
+
+// Limita las solicitudes por credencial autenticada por AutenticacionDual: por API key (TASAAPIKEYMIN y
+// TASAAPIKEYRAFAGA) o por sesión (TASASESIONMIN y TASASESIONRAFAGA). Sin credencial (rutas públicas) no
+// limita. Responde 429 con Retry-After.
+func LimitarPorCredencial(limitador *limites.Limitador, parametros repositorios.Parametros) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			credencial, _ := c.Get(ClaveCredencial).(string)
+			if credencial == "" {
+				return next(c)
+			}
+			limite, porMinuto, rafaga := "sesion", 0, 0
+			if c.Get(ClaveActor) == "SISTEMA" {
+				limite = "apikey"
+				porMinuto, rafaga = obtenerLimite(parametros, "TASAAPIKEYMIN", "TASAAPIKEYRAFAGA")
+			} else {
+				porMinuto, rafaga = obtenerLimite(parametros, "TASASESIONMIN", "TASASESIONRAFAGA")
+			}
+			// Se usa el hash para no guardar credenciales en memoria
+			if ok, espera := limitador.Tomar(limite+":"+utils.HashToken(credencial), porMinuto, rafaga); !ok {
+				return rechazarPorLimite(c, limite, espera)
+			}
+			return next(c)
+		}
+	}
+}
+
+// Responde 429 con los segundos a esperar (redondeados hacia arriba) en Retry-After
+func rechazarPorLimite(c echo.Context, limite string, espera time.Duration) error {
+	segundos := int(math.Ceil(espera.Seconds()))
+	if segundos < 1 {
+		segundos = 1
+	}
+	metricas.RequestsLimitadas.WithLabelValues(limite).Inc()
+	c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(segundos))
+	return c.JSON(http.StatusTooManyRequests, models.NewErrorRespuesta(fmt.Sprintf("Demasiadas solicitudes. Reintente en %d segundos.", segundos)))
+}
+
+// Solicitudes por minuto y ráfaga de los parámetros. 0 deshabilita el límite.
+func obtenerLimite(parametros repositorios.Parametros, parametroMin string, parametroRafaga string) (int, int) {
+	obtenerEntero := func(parametro string) int {
+		p := &models.Parametros{Parametro: parametro}
+		if _, err := parametros.Dame(context.Background(), p); err == nil {
+			if val, err := strconv.Atoi(p.Valor); err == nil && val >= 0 {
+				return val
+			}
+		}
+		return limitesPorDefecto[parametro]
+	}
+	return obtenerEntero(parametroMin), obtenerEntero(parametroRafaga)
+}
@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"MSTransaccionesFinancieras/internal/infra/metricas"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Registra cantidad y latencia de las requests por ruta de Echo.
+// Se usa la plantilla de la ruta (c.Path()) y no la URL para acotar la cardinalidad.
+func Metricas() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			inicio := time.Now()
+			err := next(c)
+
+			codigo := codigoRespuesta(c, err)
+			ruta := c.Path()
+			if ruta == "" {
+				ruta = "desconocida"
+			}
+			metodo := c.Request().Method
+			metricas.RequestsHTTP.WithLabelValues(metodo, ruta, strconv.Itoa(codigo)).Inc()
+			metricas.LatenciaHTTP.WithLabelValues(metodo, ruta).Observe(time.Since(inicio).Seconds())
+			return err
+		}
+	}
+}
+
+// Código de la respuesta. Si el handler devolvió error y no respondió, la respuesta la escribe después
+// el handler de errores de Echo: se toma el código del HTTPError (500 para cualquier otro error).
+func codigoRespuesta(c echo.Context, err error) int {
+	if err == nil || c.Response().Committed {
+		return c.Response().Status
+	}
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return he.Code
+	}
+	return http.StatusInternalServerError
+}
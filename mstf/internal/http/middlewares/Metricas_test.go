@@ -0,0 +1,52 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/infra/metricas"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Las requests se cuentan por la plantilla de la ruta y el código con que terminan, incluso si el handler
+// devuelve un error que responde después el handler de errores de Echo
+func TestMetricas(t *testing.T) {
+	e := echo.New()
+	e.Use(Metricas())
+	e.GET("/cuentas/:idusuariofinal", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET("/http-error", func(c echo.Context) error { return echo.NewHTTPError(http.StatusConflict) })
+	e.GET("/error", func(c echo.Context) error { return errors.New("falla") })
+
+	casos := []struct {
+		url    string
+		ruta   string
+		codigo string
+	}{
+		{"/cuentas/7", "/cuentas/:idusuariofinal", "200"},
+		{"/cuentas/8", "/cuentas/:idusuariofinal", "200"},
+		{"/http-error", "/http-error", "409"},
+		{"/error", "/error", "500"},
+	}
+	previos := map[string]float64{}
+	for _, c := range casos {
+		previos[c.ruta+c.codigo] = testutil.ToFloat64(metricas.RequestsHTTP.WithLabelValues(http.MethodGet, c.ruta, c.codigo))
+	}
+	for _, c := range casos {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, c.url, nil))
+	}
+
+	esperados := map[string]float64{"/cuentas/:idusuariofinal200": 2, "/http-error409": 1, "/error500": 1}
+	for _, c := range casos {
+		v := testutil.ToFloat64(metricas.RequestsHTTP.WithLabelValues(http.MethodGet, c.ruta, c.codigo)) - previos[c.ruta+c.codigo]
+		if v != esperados[c.ruta+c.codigo] {
+			t.Fatalf("%s %s: %v requests, se esperaban %v", c.ruta, c.codigo, v, esperados[c.ruta+c.codigo])
+		}
+	}
+	if n := testutil.CollectAndCount(metricas.RequestsHTTP, "mstf_http_requests_total"); n == 0 {
+		t.Fatal("sin series de mstf_http_requests_total")
+	}
+}
@@ -0,0 +1,22 @@
+package middlewares
+
+import (
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/models"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Middleware de ruta: exige que el actor autenticado por AutenticacionDual tenga el permiso (ver auth.Permisos).
+// Responde 403 si no lo tiene.
+func RequierePermiso(Permiso string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !auth.TienePermiso(c.Request().Context(), Permiso) {
+				return c.JSON(http.StatusForbidden, models.NewErrorRespuesta("No tienes permisos para realizar esta acción."))
+			}
+			return next(c)
+		}
+	}
+}
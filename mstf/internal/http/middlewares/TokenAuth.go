@@ -3,6 +3,7 @@ package middlewares
 import (
 	"MSTransaccionesFinancieras/internal/auth"
 	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
 	"context"
 	"net/http"
 	"strings"
@@ -13,8 +14,9 @@ import (
 
 const ClaveActor = "Actor"
 const ClaveCredencial = "Credencial"
+const ClavePermisos = "Permisos"
 
-func AutenticacionDual(skipper middleware.Skipper) echo.MiddlewareFunc {
+func AutenticacionDual(autenticacion repositorios.Autenticacion, skipper middleware.Skipper) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			if skipper(c) {
@@ -54,15 +56,21 @@ func AutenticacionDual(skipper middleware.Skipper) echo.MiddlewareFunc {
 				credencial = partes[1]
 			}
 
-			if err := models.Autenticar(credencial, actor); err != nil {
-				return c.JSON(http.StatusUnauthorized, models.NewErrorRespuesta(err.Error()))
+			mensaje, permisos, err := autenticacion.Autenticar(c.Request().Context(), credencial, actor, c.RealIP())
+			if err != nil {
+				return c.JSON(http.StatusUnauthorized, models.NewErrorRespuesta("Error de autenticación"))
+			}
+			if mensaje != "OK" {
+				return c.JSON(http.StatusUnauthorized, models.NewErrorRespuesta(mensaje))
 			}
 
 			c.Set(ClaveActor, actor)
 			c.Set(ClaveCredencial, credencial)
+			c.Set(ClavePermisos, permisos)
 
 			ctx := context.WithValue(c.Request().Context(), auth.ClaveCredencial, credencial)
 			ctx = context.WithValue(ctx, auth.ClaveActor, actor)
+			ctx = context.WithValue(ctx, auth.ClavePermisos, permisos)
 			c.SetRequest(c.Request().WithContext(ctx))
 
 			return next(c)
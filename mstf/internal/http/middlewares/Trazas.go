@@ -0,0 +1,52 @@
+package middlewares
+
+import (
+	"MSTransaccionesFinancieras/internal/correlacion"
+	"MSTransaccionesFinancieras/internal/infra/trazas"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span por request. Si el cliente envía traceparent la request continúa su traza.
+// Debe ir después de Correlacion para poder registrar el IdCorrelacion.
+func Trazas() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+			ruta := c.Path()
+			if ruta == "" {
+				ruta = req.URL.Path
+			}
+			ctx, span := trazas.Tracer().Start(ctx, req.Method+" "+ruta,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", req.Method),
+					attribute.String("http.route", ruta),
+					attribute.String("url.path", req.URL.Path),
+					attribute.String("mstf.correlacion", correlacion.DesdeContexto(req.Context())),
+				))
+			defer span.End()
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+
+			codigo := codigoRespuesta(c, err)
+			span.SetAttributes(attribute.Int("http.response.status_code", codigo))
+			if codigo >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(codigo))
+			}
+			if err != nil {
+				span.RecordError(err)
+			}
+			return err
+		}
+	}
+}
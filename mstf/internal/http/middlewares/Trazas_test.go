@@ -0,0 +1,89 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/config"
+	"MSTransaccionesFinancieras/internal/correlacion"
+	"MSTransaccionesFinancieras/internal/infra/trazas"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Registra en memoria los spans del test y vuelve al provider no-op al terminar
+func grabarSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	if _, err := trazas.Init(config.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	grabador := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(grabador)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	return grabador
+}
+
+func atributos(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	r := map[attribute.Key]attribute.Value{}
+	for _, a := range s.Attributes() {
+		r[a.Key] = a.Value
+	}
+	return r
+}
+
+// Un span por request con la plantilla de la ruta, que continúa la traza del cliente (traceparent)
+func TestTrazas(t *testing.T) {
+	grabador := grabarSpans(t)
+	e := echo.New()
+	e.Use(Correlacion(), Trazas())
+	var enHandler trace.SpanContext
+	e.GET("/cuentas/:idusuariofinal", func(c echo.Context) error {
+		enHandler = trace.SpanContextFromContext(c.Request().Context())
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/error", func(c echo.Context) error { return errors.New("falla") })
+
+	req := httptest.NewRequest(http.MethodGet, "/cuentas/7", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(correlacion.HeaderHTTP, "pedido-42")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/error", nil))
+
+	spans := grabador.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("%d spans, se esperaban 2", len(spans))
+	}
+	s := spans[0]
+	if s.Name() != "GET /cuentas/:idusuariofinal" || s.SpanKind() != trace.SpanKindServer {
+		t.Fatalf("span de la request: %s (%s)", s.Name(), s.SpanKind())
+	}
+	if s.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || s.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("el span no continúa la traza del cliente: traza %s, padre %s", s.SpanContext().TraceID(), s.Parent().SpanID())
+	}
+	if enHandler.SpanID() != s.SpanContext().SpanID() {
+		t.Fatal("el handler no recibe el span de la request en su context")
+	}
+	a := atributos(s)
+	if a["http.route"].AsString() != "/cuentas/:idusuariofinal" || a["url.path"].AsString() != "/cuentas/7" ||
+		a["http.response.status_code"].AsInt64() != http.StatusOK || a["mstf.correlacion"].AsString() != "pedido-42" {
+		t.Fatalf("atributos: %v", s.Attributes())
+	}
+	if s.Status().Code == codes.Error {
+		t.Fatal("request exitosa marcada con error")
+	}
+
+	// sin traceparent la request inicia una traza; un 500 marca el span con error
+	s = spans[1]
+	if s.Parent().IsValid() || s.Status().Code != codes.Error || atributos(s)["http.response.status_code"].AsInt64() != http.StatusInternalServerError {
+		t.Fatalf("span del error: padre %v, status %v, atributos %v", s.Parent(), s.Status(), s.Attributes())
+	}
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,6 +16,9 @@ type Cache[T any] struct {
 	mu    sync.RWMutex
 	items map[string]item[T]
 	ttl   time.Duration
+
+	aciertos atomic.Uint64
+	fallos   atomic.Uint64
 }
 
 func NewCache[T any](ttl time.Duration) *Cache[T] {
@@ -32,12 +36,19 @@ func (c *Cache[T]) Dame(clave string) (T, bool) {
 
 	it, existe := c.items[clave]
 	if !existe || time.Now().After(it.expiracion) {
+		c.fallos.Add(1)
 		var zero T
 		return zero, false
 	}
+	c.aciertos.Add(1)
 	return it.valor, true
 }
 
+// Cantidad de lecturas con Dame que encontraron la clave (aciertos) y que no (fallos)
+func (c *Cache[T]) Estadisticas() (uint64, uint64) {
+	return c.aciertos.Load(), c.fallos.Load()
+}
+
 func (c *Cache[T]) Guardar(clave string, valor T) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -0,0 +1,226 @@
+package fallas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/config"
+	"MSTransaccionesFinancieras/internal/infra/logs"
+)
+
+// Inyección de fallas controladas en los clientes de TigerBeetle, MySQL y el webhook, para probar los
+// reintentos del motor de ingesta y la idempotencia ante TransferExists. Los decoradores solo se instalan
+// con FALLAS_HABILITADAS=true; las reglas se cargan desde FALLAS (JSON) y se modifican en runtime
+// (/admin/fallas). Nunca habilitar en producción.
+
+// Destinos donde se pueden inyectar fallas
+const (
+	TigerBeetle = "tigerbeetle"
+	MySQL       = "mysql"
+	Webhook     = "webhook"
+)
+
+var destinos = []string{TigerBeetle, MySQL, Webhook}
+
+// Modos de falla
+const (
+	// Solo demora la llamada LatenciaMs
+	ModoLatencia = "LATENCIA"
+	// La llamada no se hace y retorna error
+	ModoError = "ERROR"
+	// La llamada no se hace y queda colgada TimeoutMs (o hasta que venza el context) antes de retornar error
+	ModoTimeout = "TIMEOUT"
+	// La llamada se hace (ej: TB registra las transferencias) pero la respuesta se pierde y retorna error
+	ModoRespuestaPerdida = "RESPUESTA_PERDIDA"
+)
+
+var modos = []string{ModoLatencia, ModoError, ModoTimeout, ModoRespuestaPerdida}
+
+const timeoutPorDefecto = 30 * time.Second
+
+// Error de toda falla inyectada
+var ErrInyectada = errors.New("falla inyectada")
+
+// Regla de inyección de un destino
+type Regla struct {
+	Modo string `json:"Modo"`
+	// Operaciones afectadas: método del cliente de TB (CreateTransfers), SP de MySQL (tsp_dame_parametro) o
+	// método HTTP del webhook (POST). Vacío = todas
+	Operaciones []string `json:"Operaciones,omitempty"`
+	// Demora previa a la llamada (en cualquier modo)
+	LatenciaMs int `json:"LatenciaMs,omitempty"`
+	// Duración del cuelgue en modo TIMEOUT (default 30s)
+	TimeoutMs int `json:"TimeoutMs,omitempty"`
+	// Probabilidad de inyectar en cada llamada afectada, entre 0 y 1 (0 = siempre)
+	Probabilidad float64 `json:"Probabilidad,omitempty"`
+	// Cantidad de fallas a inyectar; al agotarse la regla deja de aplicar (0 = sin límite)
+	Cantidad int `json:"Cantidad,omitempty"`
+	// Fallas inyectadas hasta ahora (solo lectura)
+	Inyectadas int `json:"Inyectadas"`
+}
+
+var (
+	mu         sync.Mutex
+	habilitada bool
+	reglas     = map[string]*Regla{}
+)
+
+// Habilita la inyección según la configuración y carga las reglas iniciales de FALLAS,
+// ej: {"tigerbeetle": {"Modo": "RESPUESTA_PERDIDA", "Operaciones": ["CreateTransfers"], "Cantidad": 1}}
+func Init(cfg config.Config) error {
+	mu.Lock()
+	habilitada = cfg.InyeccionFallas
+	mu.Unlock()
+	if !cfg.InyeccionFallas {
+		return nil
+	}
+	logs.L(logs.App).Warn("inyección de fallas habilitada: no usar en producción")
+	if cfg.FallasIniciales == "" {
+		return nil
+	}
+	iniciales := map[string]Regla{}
+	if err := json.Unmarshal([]byte(cfg.FallasIniciales), &iniciales); err != nil {
+		return fmt.Errorf("FALLAS inválido: %w", err)
+	}
+	for destino, regla := range iniciales {
+		if err := Configurar(destino, regla); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Indica si los decoradores están instalados y la API de administración disponible
+func Habilitada() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return habilitada
+}
+
+func Destinos() []string {
+	return slices.Clone(destinos)
+}
+
+// Reemplaza la regla del destino. El contador de inyectadas vuelve a cero.
+func Configurar(destino string, regla Regla) error {
+	if !slices.Contains(destinos, destino) {
+		return fmt.Errorf("destino inválido: %s (válidos: %s)", destino, strings.Join(destinos, ", "))
+	}
+	regla.Modo = strings.ToUpper(regla.Modo)
+	if !slices.Contains(modos, regla.Modo) {
+		return fmt.Errorf("modo inválido: %s (válidos: %s)", regla.Modo, strings.Join(modos, ", "))
+	}
+	if regla.LatenciaMs < 0 || regla.TimeoutMs < 0 || regla.Cantidad < 0 {
+		return errors.New("LatenciaMs, TimeoutMs y Cantidad no pueden ser negativos")
+	}
+	if regla.Probabilidad < 0 || regla.Probabilidad > 1 {
+		return errors.New("la probabilidad debe estar entre 0 y 1")
+	}
+	regla.Inyectadas = 0
+	mu.Lock()
+	defer mu.Unlock()
+	reglas[destino] = &regla
+	return nil
+}
+
+// Quita la regla del destino (las llamadas vuelven a pasar sin cambios)
+func Quitar(destino string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(reglas, destino)
+}
+
+// Quita todas las reglas
+func Limpiar() {
+	mu.Lock()
+	defer mu.Unlock()
+	clear(reglas)
+}
+
+// Copia de las reglas vigentes por destino
+func Reglas() map[string]Regla {
+	mu.Lock()
+	defer mu.Unlock()
+	copia := make(map[string]Regla, len(reglas))
+	for destino, r := range reglas {
+		copia[destino] = *r
+	}
+	return copia
+}
+
+// Regla a aplicar en la llamada, o nil si no corresponde inyectar
+func decidir(destino string, operacion string) *Regla {
+	mu.Lock()
+	defer mu.Unlock()
+	r, ok := reglas[destino]
+	if !ok || (r.Cantidad > 0 && r.Inyectadas >= r.Cantidad) {
+		return nil
+	}
+	if len(r.Operaciones) > 0 && !slices.ContainsFunc(r.Operaciones, func(op string) bool { return strings.EqualFold(op, operacion) }) {
+		return nil
+	}
+	if r.Probabilidad > 0 && rand.Float64() >= r.Probabilidad {
+		return nil
+	}
+	r.Inyectadas++
+	aplicada := *r
+	return &aplicada
+}
+
+// Ejecuta la llamada aplicando la regla del destino. descartar (opcional) libera el resultado de una
+// llamada cuya respuesta se pierde (ej: las filas de una consulta).
+func inyectar[T any](ctx context.Context, destino string, operacion string, llamada func() (T, error), descartar func(T)) (T, error) {
+	var cero T
+	r := decidir(destino, operacion)
+	if r == nil {
+		return llamada()
+	}
+	logs.L(logs.App).WarnContext(ctx, "inyectando falla", "destino", destino, "operacion", operacion, "modo", r.Modo)
+	if err := esperar(ctx, time.Duration(r.LatenciaMs)*time.Millisecond); err != nil {
+		return cero, err
+	}
+	switch r.Modo {
+	case ModoError:
+		return cero, fmt.Errorf("%w: error en %s %s", ErrInyectada, destino, operacion)
+	case ModoTimeout:
+		timeout := time.Duration(r.TimeoutMs) * time.Millisecond
+		if timeout == 0 {
+			timeout = timeoutPorDefecto
+		}
+		if err := esperar(ctx, timeout); err != nil {
+			return cero, err
+		}
+		return cero, fmt.Errorf("%w: timeout en %s %s", ErrInyectada, destino, operacion)
+	case ModoRespuestaPerdida:
+		resultado, err := llamada()
+		if err != nil {
+			return resultado, err
+		}
+		if descartar != nil {
+			descartar(resultado)
+		}
+		return cero, fmt.Errorf("%w: respuesta perdida de %s %s", ErrInyectada, destino, operacion)
+	}
+	return llamada()
+}
+
+func esperar(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,213 @@
+package fallas
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/config"
+	"MSTransaccionesFinancieras/internal/infra/tbmemoria"
+
+	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+)
+
+func configurar(t *testing.T, destino string, regla Regla) {
+	t.Helper()
+	if err := Configurar(destino, regla); err != nil {
+		t.Fatalf("Configurar %s: %v", destino, err)
+	}
+	t.Cleanup(Limpiar)
+}
+
+func TestReglas(t *testing.T) {
+	configurar(t, TigerBeetle, Regla{Modo: "error", Operaciones: []string{"CreateTransfers"}, Cantidad: 2})
+
+	if decidir(TigerBeetle, "LookupAccounts") != nil || decidir(MySQL, "CreateTransfers") != nil {
+		t.Fatal("se inyectó una falla fuera de la regla")
+	}
+	for i := range 2 {
+		if r := decidir(TigerBeetle, "createtransfers"); r == nil || r.Modo != ModoError {
+			t.Fatalf("falla %d no inyectada: %+v", i+1, r)
+		}
+	}
+	if decidir(TigerBeetle, "CreateTransfers") != nil {
+		t.Fatal("se inyectaron más fallas que Cantidad")
+	}
+	if r := Reglas()[TigerBeetle]; r.Inyectadas != 2 {
+		t.Fatalf("inyectadas: %d", r.Inyectadas)
+	}
+
+	configurar(t, Webhook, Regla{Modo: ModoLatencia, Probabilidad: 0.0001})
+	inyectadas := 0
+	for range 1000 {
+		if decidir(Webhook, "POST") != nil {
+			inyectadas++
+		}
+	}
+	if inyectadas > 5 {
+		t.Fatalf("probabilidad no respetada: %d de 1000", inyectadas)
+	}
+
+	for _, invalida := range []struct {
+		destino string
+		regla   Regla
+	}{
+		{"redis", Regla{Modo: ModoError}},
+		{MySQL, Regla{Modo: "explotar"}},
+		{MySQL, Regla{Modo: ModoError, Probabilidad: 1.5}},
+		{MySQL, Regla{Modo: ModoLatencia, LatenciaMs: -1}},
+	} {
+		if err := Configurar(invalida.destino, invalida.regla); err == nil {
+			t.Fatalf("regla inválida aceptada: %s %+v", invalida.destino, invalida.regla)
+		}
+	}
+}
+
+func TestInit(t *testing.T) {
+	t.Cleanup(func() { Init(config.Config{}) })
+	t.Cleanup(Limpiar)
+	if err := Init(config.Config{InyeccionFallas: true, FallasIniciales: `{"mysql": {"Modo": "TIMEOUT", "TimeoutMs": 50}}`}); err != nil {
+		t.Fatal(err)
+	}
+	if !Habilitada() || Reglas()[MySQL].TimeoutMs != 50 {
+		t.Fatalf("reglas iniciales: %+v", Reglas())
+	}
+	if err := Init(config.Config{InyeccionFallas: true, FallasIniciales: `{"mysql": {"Modo": "NINGUNO"}}`}); err == nil {
+		t.Fatal("FALLAS inválido aceptado")
+	}
+}
+
+func TestRespuestaPerdidaDeTB(t *testing.T) {
+	tb := tbmemoria.New()
+	cliente := EnvolverTB(tb)
+	cuentas := []types.Account{{ID: types.ToUint128(1), Ledger: 1, Code: 1}, {ID: types.ToUint128(2), Ledger: 1, Code: 1}}
+	if _, err := cliente.CreateAccounts(cuentas); err != nil {
+		t.Fatal(err)
+	}
+
+	configurar(t, TigerBeetle, Regla{Modo: ModoRespuestaPerdida, Operaciones: []string{"CreateTransfers"}, Cantidad: 1})
+	transferencia := types.Transfer{ID: types.ToUint128(10), DebitAccountID: types.ToUint128(1), CreditAccountID: types.ToUint128(2), Amount: types.ToUint128(5), Ledger: 1, Code: 1}
+	if _, err := cliente.CreateTransfers([]types.Transfer{transferencia}); !errors.Is(err, ErrInyectada) {
+		t.Fatalf("se esperaba la falla inyectada: %v", err)
+	}
+	// TB registró la transferencia aunque el cliente recibió error
+	registradas, err := tb.LookupTransfers([]types.Uint128{transferencia.ID})
+	if err != nil || len(registradas) != 1 {
+		t.Fatalf("la transferencia no se registró: %v %v", registradas, err)
+	}
+	resultados, err := cliente.CreateTransfers([]types.Transfer{transferencia})
+	if err != nil || len(resultados) != 1 || resultados[0].Result != types.TransferExists {
+		t.Fatalf("reintento: %+v %v", resultados, err)
+	}
+}
+
+func TestTimeoutRespetaElContext(t *testing.T) {
+	configurar(t, Webhook, Regla{Modo: ModoTimeout})
+	ctx, cancelar := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelar()
+	inicio := time.Now()
+	_, err := inyectar(ctx, Webhook, "POST", func() (int, error) { return 1, nil }, nil)
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(inicio) > time.Second {
+		t.Fatalf("timeout: %v luego de %s", err, time.Since(inicio))
+	}
+}
+
+func TestRespuestaPerdidaDelWebhook(t *testing.T) {
+	var recibidas atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recibidas.Add(1)
+	}))
+	defer srv.Close()
+	cliente := &http.Client{Transport: EnvolverTransporte(http.DefaultTransport)}
+
+	configurar(t, Webhook, Regla{Modo: ModoRespuestaPerdida, Operaciones: []string{"POST"}})
+	if resp, err := cliente.Head(srv.URL); err != nil {
+		t.Fatalf("HEAD fuera de la regla: %v", err)
+	} else {
+		resp.Body.Close()
+	}
+	if _, err := cliente.Post(srv.URL, "application/json", nil); !errors.Is(err, ErrInyectada) {
+		t.Fatalf("se esperaba la falla inyectada: %v", err)
+	}
+	if recibidas.Load() != 2 {
+		t.Fatalf("el webhook debe recibir la notificación aunque se pierda la respuesta: %d", recibidas.Load())
+	}
+
+	configurar(t, Webhook, Regla{Modo: ModoError})
+	if _, err := cliente.Post(srv.URL, "application/json", nil); !errors.Is(err, ErrInyectada) {
+		t.Fatalf("se esperaba la falla inyectada: %v", err)
+	}
+	if recibidas.Load() != 2 {
+		t.Fatalf("con ERROR la notificación no se envía: %d", recibidas.Load())
+	}
+}
+
+func TestMySQL(t *testing.T) {
+	base := &conectorFalso{}
+	db := sql.OpenDB(EnvolverConector(base))
+	defer db.Close()
+
+	configurar(t, MySQL, Regla{Modo: ModoRespuestaPerdida, Operaciones: []string{"tsp_registrar"}})
+	if _, err := db.ExecContext(t.Context(), "CALL tsp_registrar(?)", 1); !errors.Is(err, ErrInyectada) {
+		t.Fatalf("se esperaba la falla inyectada: %v", err)
+	}
+	if base.ejecutadas.Load() != 1 {
+		t.Fatalf("con RESPUESTA_PERDIDA el SP se ejecuta: %d", base.ejecutadas.Load())
+	}
+	filas, err := db.QueryContext(t.Context(), "CALL tsp_dame(?)", 1)
+	if err != nil {
+		t.Fatalf("SP fuera de la regla: %v", err)
+	}
+	filas.Close()
+
+	configurar(t, MySQL, Regla{Modo: ModoError, Operaciones: []string{"tsp_dame", "Ping"}})
+	if _, err := db.QueryContext(t.Context(), "CALL tsp_dame(?)", 1); !errors.Is(err, ErrInyectada) {
+		t.Fatalf("se esperaba la falla inyectada: %v", err)
+	}
+	if err := db.PingContext(t.Context()); !errors.Is(err, ErrInyectada) {
+		t.Fatalf("ping: %v", err)
+	}
+	if base.ejecutadas.Load() != 2 {
+		t.Fatalf("con ERROR el SP no se ejecuta: %d", base.ejecutadas.Load())
+	}
+}
+
+// Driver mínimo que cuenta los statements ejecutados
+type conectorFalso struct {
+	ejecutadas atomic.Int32
+}
+
+func (c *conectorFalso) Connect(context.Context) (driver.Conn, error) { return conexionFalsa{c}, nil }
+func (c *conectorFalso) Driver() driver.Driver                        { return nil }
+
+type conexionFalsa struct{ c *conectorFalso }
+
+func (cn conexionFalsa) Prepare(string) (driver.Stmt, error) { return statementFalso(cn), nil }
+func (cn conexionFalsa) Close() error                        { return nil }
+func (cn conexionFalsa) Begin() (driver.Tx, error)           { return nil, errors.New("sin transacciones") }
+
+type statementFalso struct{ c *conectorFalso }
+
+func (s statementFalso) Close() error  { return nil }
+func (s statementFalso) NumInput() int { return -1 }
+func (s statementFalso) Exec([]driver.Value) (driver.Result, error) {
+	s.c.ejecutadas.Add(1)
+	return driver.RowsAffected(1), nil
+}
+func (s statementFalso) Query([]driver.Value) (driver.Rows, error) {
+	s.c.ejecutadas.Add(1)
+	return filasFalsas{}, nil
+}
+
+type filasFalsas struct{}
+
+func (filasFalsas) Columns() []string         { return nil }
+func (filasFalsas) Close() error              { return nil }
+func (filasFalsas) Next([]driver.Value) error { return io.EOF }
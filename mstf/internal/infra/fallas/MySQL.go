@@ -0,0 +1,165 @@
+package fallas
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+)
+
+// Decorador del conector de MySQL que aplica la regla de MySQL en cada ejecución de un statement.
+// La operación es el nombre del SP (tsp_xxx) o la primera palabra de la consulta.
+//
+// La conexión decorada no implementa QueryerContext/ExecerContext: database/sql prepara siempre el
+// statement y la falla se inyecta una sola vez, al ejecutarlo (sin el decorador, el driver prepara
+// igual las consultas con parámetros).
+type conector struct {
+	base driver.Connector
+}
+
+func EnvolverConector(base driver.Connector) driver.Connector {
+	return conector{base: base}
+}
+
+func (c conector) Connect(ctx context.Context) (driver.Conn, error) {
+	cn, err := c.base.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conexion{Conn: cn}, nil
+}
+
+func (c conector) Driver() driver.Driver {
+	return c.base.Driver()
+}
+
+// Nombre de la operación: "tsp_xxx" para los SP
+func operacionMySQL(query string) string {
+	query = strings.TrimSpace(query)
+	if sp, ok := strings.CutPrefix(query, "CALL "); ok {
+		if i := strings.IndexByte(sp, '('); i > 0 {
+			sp = sp[:i]
+		}
+		return strings.TrimSpace(sp)
+	}
+	if i := strings.IndexAny(query, " \n\t"); i > 0 {
+		return query[:i]
+	}
+	return query
+}
+
+type conexion struct {
+	driver.Conn
+}
+
+var (
+	_ driver.ConnPrepareContext = conexion{}
+	_ driver.ConnBeginTx        = conexion{}
+	_ driver.Pinger             = conexion{}
+	_ driver.SessionResetter    = conexion{}
+	_ driver.Validator          = conexion{}
+	_ driver.NamedValueChecker  = conexion{}
+)
+
+func (c conexion) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c conexion) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var st driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		st, err = p.PrepareContext(ctx, query)
+	} else {
+		st, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return statement{Stmt: st, operacion: operacionMySQL(query)}, nil
+}
+
+func (c conexion) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+// El ping cuenta como operación "Ping" (health check de readiness)
+func (c conexion) Ping(ctx context.Context) error {
+	_, err := inyectar(ctx, MySQL, "Ping", func() (struct{}, error) {
+		if p, ok := c.Conn.(driver.Pinger); ok {
+			return struct{}{}, p.Ping(ctx)
+		}
+		return struct{}{}, nil
+	}, nil)
+	return err
+}
+
+func (c conexion) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c conexion) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// Conversión de argumentos del driver (ej: uint64 sin límite de int64)
+func (c conexion) CheckNamedValue(nv *driver.NamedValue) error {
+	if v, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return v.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type statement struct {
+	driver.Stmt
+	operacion string
+}
+
+var (
+	_ driver.StmtExecContext   = statement{}
+	_ driver.StmtQueryContext  = statement{}
+	_ driver.NamedValueChecker = statement{}
+)
+
+func (s statement) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return inyectar(ctx, MySQL, s.operacion, func() (driver.Result, error) {
+		if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+			return e.ExecContext(ctx, args)
+		}
+		return s.Stmt.Exec(valores(args))
+	}, nil)
+}
+
+func (s statement) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return inyectar(ctx, MySQL, s.operacion, func() (driver.Rows, error) {
+		if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+			return q.QueryContext(ctx, args)
+		}
+		return s.Stmt.Query(valores(args))
+	}, func(filas driver.Rows) {
+		filas.Close()
+	})
+}
+
+func (s statement) CheckNamedValue(nv *driver.NamedValue) error {
+	if v, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return v.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func valores(args []driver.NamedValue) []driver.Value {
+	v := make([]driver.Value, len(args))
+	for i, a := range args {
+		v[i] = a.Value
+	}
+	return v
+}
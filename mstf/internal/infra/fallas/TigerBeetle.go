@@ -0,0 +1,67 @@
+package fallas
+
+import (
+	"context"
+
+	tigerbeetle "github.com/tigerbeetle/tigerbeetle-go"
+	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+)
+
+// Decorador del cliente de TB que aplica la regla de TigerBeetle. Se instala debajo de la instrumentación,
+// así las fallas inyectadas se ven en métricas y trazas como las reales. El cliente de TB no recibe
+// context: un TIMEOUT dura siempre TimeoutMs.
+type clienteTB struct {
+	tigerbeetle.Client
+}
+
+func EnvolverTB(cliente tigerbeetle.Client) tigerbeetle.Client {
+	return clienteTB{Client: cliente}
+}
+
+func (c clienteTB) CreateAccounts(accounts []types.Account) ([]types.AccountEventResult, error) {
+	return inyectar(context.Background(), TigerBeetle, "CreateAccounts", func() ([]types.AccountEventResult, error) {
+		return c.Client.CreateAccounts(accounts)
+	}, nil)
+}
+
+func (c clienteTB) CreateTransfers(transfers []types.Transfer) ([]types.TransferEventResult, error) {
+	return inyectar(context.Background(), TigerBeetle, "CreateTransfers", func() ([]types.TransferEventResult, error) {
+		return c.Client.CreateTransfers(transfers)
+	}, nil)
+}
+
+func (c clienteTB) LookupAccounts(accountIDs []types.Uint128) ([]types.Account, error) {
+	return inyectar(context.Background(), TigerBeetle, "LookupAccounts", func() ([]types.Account, error) {
+		return c.Client.LookupAccounts(accountIDs)
+	}, nil)
+}
+
+func (c clienteTB) LookupTransfers(transferIDs []types.Uint128) ([]types.Transfer, error) {
+	return inyectar(context.Background(), TigerBeetle, "LookupTransfers", func() ([]types.Transfer, error) {
+		return c.Client.LookupTransfers(transferIDs)
+	}, nil)
+}
+
+func (c clienteTB) GetAccountTransfers(filter types.AccountFilter) ([]types.Transfer, error) {
+	return inyectar(context.Background(), TigerBeetle, "GetAccountTransfers", func() ([]types.Transfer, error) {
+		return c.Client.GetAccountTransfers(filter)
+	}, nil)
+}
+
+func (c clienteTB) GetAccountBalances(filter types.AccountFilter) ([]types.AccountBalance, error) {
+	return inyectar(context.Background(), TigerBeetle, "GetAccountBalances", func() ([]types.AccountBalance, error) {
+		return c.Client.GetAccountBalances(filter)
+	}, nil)
+}
+
+func (c clienteTB) QueryAccounts(filter types.QueryFilter) ([]types.Account, error) {
+	return inyectar(context.Background(), TigerBeetle, "QueryAccounts", func() ([]types.Account, error) {
+		return c.Client.QueryAccounts(filter)
+	}, nil)
+}
+
+func (c clienteTB) QueryTransfers(filter types.QueryFilter) ([]types.Transfer, error) {
+	return inyectar(context.Background(), TigerBeetle, "QueryTransfers", func() ([]types.Transfer, error) {
+		return c.Client.QueryTransfers(filter)
+	}, nil)
+}
@@ -0,0 +1,25 @@
+package fallas
+
+import (
+	"io"
+	"net/http"
+)
+
+// Transporte HTTP que aplica la regla del webhook. En RESPUESTA_PERDIDA el webhook recibe la notificación
+// pero el MS no se entera y reintenta el lote.
+type transporte struct {
+	base http.RoundTripper
+}
+
+func EnvolverTransporte(base http.RoundTripper) http.RoundTripper {
+	return transporte{base: base}
+}
+
+func (t transporte) RoundTrip(req *http.Request) (*http.Response, error) {
+	return inyectar(req.Context(), Webhook, req.Method, func() (*http.Response, error) {
+		return t.base.RoundTrip(req)
+	}, func(resp *http.Response) {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	})
+}
@@ -0,0 +1,46 @@
+package kafkamstf
+
+import (
+	"MSTransaccionesFinancieras/internal/config"
+	"MSTransaccionesFinancieras/internal/infra/logs"
+	"MSTransaccionesFinancieras/internal/models"
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Publica los anclajes de la cadena de auditoría (auditoria.Destino) en KAFKA_TOPIC_AUDITORIA. Con retención
+// infinita (o compactado por key) el topic conserva todos los anclajes para la verificación.
+type PublicadorAnclajes struct {
+	writer *kafka.Writer
+}
+
+func NewPublicadorAnclajes(cfg config.Config) *PublicadorAnclajes {
+	return &PublicadorAnclajes{writer: &kafka.Writer{
+		Addr:         kafka.TCP(cfg.BrokersKafka...),
+		Topic:        cfg.TopicKafkaAuditoria,
+		Balancer:     &kafka.LeastBytes{},
+		RequiredAcks: kafka.RequireAll,
+		MaxAttempts:  3,
+	}}
+}
+
+func (p *PublicadorAnclajes) Nombre() string {
+	return "kafka"
+}
+
+func (p *PublicadorAnclajes) Publicar(ctx context.Context, Anclaje models.AnclajesOperaciones) error {
+	valor, err := json.Marshal(Anclaje)
+	if err != nil {
+		return err
+	}
+	return p.writer.WriteMessages(ctx, kafka.Message{Key: []byte(strconv.Itoa(Anclaje.IdOperacion)), Value: valor})
+}
+
+func (p *PublicadorAnclajes) Close() {
+	if err := p.writer.Close(); err != nil {
+		logs.L(logs.Kafka).Error("error al cerrar el writer de Kafka (anclajes de auditoría)", logs.Err(err))
+	}
+}
@@ -2,33 +2,55 @@ package kafkamstf
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
+	"fmt"
+	"hash/fnv"
 	"io"
-	"log"
 	"strconv"
 	"sync"
 	"time"
 
 	"MSTransaccionesFinancieras/internal/config"
-	"MSTransaccionesFinancieras/internal/gestores"
-	"MSTransaccionesFinancieras/internal/infra/persistence"
+	"MSTransaccionesFinancieras/internal/correlacion"
+	"MSTransaccionesFinancieras/internal/esquemas"
+	"MSTransaccionesFinancieras/internal/infra/logs"
+	"MSTransaccionesFinancieras/internal/ingesta"
 	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
 	"MSTransaccionesFinancieras/internal/utils"
 
 	"github.com/segmentio/kafka-go"
-	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
 )
 
+// Fuente de ingesta Kafka: lee el topic de transferencias con un consumer group y entrega
+// los lotes de cada pipeline al motor de ingesta.
 type Consumidor struct {
 	reader     *kafka.Reader
 	config     config.Config
+	parametros repositorios.Parametros
 	stopChan   chan struct{}
-	wg         sync.WaitGroup
-	procesador *gestores.GestorTransferencias
+	cancelar   context.CancelFunc
+	// corta FetchMessage al cerrar, sin cancelar los lotes en curso
+	cancelarFetch context.CancelFunc
+	wg            sync.WaitGroup
+	motor         *ingesta.Motor
+	dlq           *kafka.Writer
+	offsets       *seguimientoOffsets
+	pipelines     []*pipeline
+
+	// pausa de la lectura (API de control). También protege la asignación de pipelines en Start
+	muPausa      sync.Mutex
+	pausado      bool
+	pausadoDesde time.Time
+	reanudar     chan struct{}
+	// el fetcher está bloqueado en esperarSiPausado: no tiene un fetch en curso
+	fetcherEnPausa bool
+	// hay un reproceso REAL en curso: no se puede reanudar hasta que termine
+	reprocesandoReal bool
+	// un solo reproceso a la vez
+	muReproceso sync.Mutex
 }
 
-func NewConsumidor(cfg config.Config, procesador *gestores.GestorTransferencias) *Consumidor {
+func NewConsumidor(cfg config.Config, parametros repositorios.Parametros) *Consumidor {
 	lectorKafka := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:  cfg.BrokersKafka,
 		Topic:    cfg.TopicKafka,
@@ -38,235 +60,227 @@ func NewConsumidor(cfg config.Config, procesador *gestores.GestorTransferencias)
 		MaxBytes: 10e6,
 	})
 
-	return &Consumidor{
-		procesador: procesador,
+	c := &Consumidor{
 		reader:     lectorKafka,
 		config:     cfg,
+		parametros: parametros,
 		stopChan:   make(chan struct{}),
 	}
+	c.offsets = newSeguimientoOffsets(lectorKafka.CommitMessages)
+	if cfg.TopicKafkaDLQ != "" {
+		c.dlq = &kafka.Writer{
+			Addr:         kafka.TCP(cfg.BrokersKafka...),
+			Topic:        cfg.TopicKafkaDLQ,
+			Balancer:     &kafka.LeastBytes{},
+			RequiredAcks: kafka.RequireAll,
+			MaxAttempts:  3,
+		}
+	}
+	return c
 }
 
-// Start inicia el consumidor en una goroutine nueva
-func (c *Consumidor) Start() {
+func (c *Consumidor) Nombre() string {
+	return "kafka"
+}
+
+// Start inicia el fetcher y un pipeline por shard, cada uno en su goroutine.
+// La cantidad de pipelines se lee del parámetro KAFKAPIPELINES.
+func (c *Consumidor) Start(motor *ingesta.Motor) {
+	c.motor = motor
+	cantidad := obtenerCantidadPipelines(c.parametros)
+	// buffer de 2 lotes por pipeline: el fetcher sigue leyendo el próximo lote mientras se escribe el actual en TB
+	capacidad := 2 * ingesta.ObtenerTamanoLote(c.parametros)
+
+	// el fetch se corta apenas empieza el cierre; el procesamiento solo si vence el plazo del drenado
+	ctxFetch, cancelarFetch := context.WithCancel(context.Background())
+	ctx, cancelar := context.WithCancel(context.Background())
+	c.cancelarFetch = cancelarFetch
+	c.cancelar = cancelar
+
+	pipelines := make([]*pipeline, cantidad)
+	for i := range pipelines {
+		pipelines[i] = newPipeline(i, c, capacidad)
+	}
+	// la API de control y los health checks pueden leer los pipelines antes de Start (el HTTP arranca antes)
+	c.muPausa.Lock()
+	c.pipelines = pipelines
+	c.muPausa.Unlock()
+	for _, p := range pipelines {
+		c.wg.Add(1)
+		go p.loop(ctx)
+	}
+
 	c.wg.Add(1)
-	go c.batchLoop()
-	//log.Printf("Consumidor iniciado. Kafka Topic: %s, GroupID: %s. Tamaño de lote y timeout leídos de parámetros DB (KAFKABATCHSIZE, KAFKABATCHTIMEOUTMS).", c.config.TopicKafka, c.config.GroupIDKafka)
+	go c.fetchLoop(ctxFetch)
+	logs.L(logs.Kafka).Debug("consumidor iniciado", "topic", c.config.TopicKafka, "groupID", c.config.GroupIDKafka, "pipelines", cantidad)
 }
 
-func (c *Consumidor) Close() {
+// Deja de leer de Kafka y espera a que cada pipeline termine y commitee su lote en curso (los mensajes que
+// quedaron en cola sin procesar no se commitean: Kafka los vuelve a entregar). Si ctx vence antes, se cancelan
+// los lotes en curso, incluso a mitad de un reintento.
+func (c *Consumidor) Close(ctx context.Context) {
 	close(c.stopChan)
+	if c.cancelarFetch != nil {
+		c.cancelarFetch()
+	}
+	if !ingesta.EsperarDrenado(ctx, &c.wg) {
+		logs.L(logs.Kafka).Warn("venció el plazo de drenado, se cancelan los lotes en curso")
+	}
+	if c.cancelar != nil {
+		c.cancelar()
+	}
 	c.wg.Wait()
 	if err := c.reader.Close(); err != nil {
-		log.Printf("Error al cerrar Kafka reader: %v", err)
+		logs.L(logs.Kafka).Error("error al cerrar el reader de Kafka", logs.Err(err))
 	}
-	//log.Println("Consumidor detenido.")
+	if c.dlq != nil {
+		if err := c.dlq.Close(); err != nil {
+			logs.L(logs.Kafka).Error("error al cerrar el writer de Kafka (DLQ)", logs.Err(err))
+		}
+	}
+	logs.L(logs.Kafka).Debug("consumidor detenido")
 }
 
-// loop principal que procesa lotes de transferencias
-func (c *Consumidor) batchLoop() {
+// Lee mensajes de Kafka y los reparte entre los pipelines según la cuenta afectada.
+// Si los pipelines están llenos el fetcher se bloquea (backpressure), si no, sigue leyendo
+// mientras los pipelines escriben en TB.
+func (c *Consumidor) fetchLoop(ctx context.Context) {
 	defer c.wg.Done()
-	ctx := context.Background()
 
 	for {
-		select {
-		case <-c.stopChan:
-			//log.Println("Deteniendo batchLoop...")
+		if !c.esperarSiPausado() {
 			return
-		default:
-			// Armar el lote desde Kafka
-			mensajesLote, transferenciasLote, kafkaMsgsLote, fallidasParseo := c.armarLoteDesdeKafka(ctx)
-
-			if len(transferenciasLote) == 0 && len(fallidasParseo) == 0 {
-				continue
-			}
-
-			//log.Printf("Lote de Kafka recibido. Procesando %d transferencias (%d fallidas en parseo).", len(transferenciasLote), len(fallidasParseo))
-
-			// Procesar con retry en memoria: no avanza al próximo lote hasta que el actual se procese
-			// Si el MS cae durante el retry, Kafka retoma desde el ultimo offset no commiteado
-			if err := c.procesarConRetry(ctx, mensajesLote, transferenciasLote, kafkaMsgsLote, fallidasParseo); err != nil {
+		}
+		msg, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
 				return
 			}
-		}
-	}
-}
-
-// llama a CrearLote con backoff exponencial hasta que tenga éxito.
-// El backoff empieza en 1s y se duplica en cada intento hasta el límite RETRY_MAX_BACKOFF_SECONDS.
-// Nunca abandona, bloquea hasta que el servicio caído (TB, webhook, etc.) se recupere.
-// Retorna error solo si el consumidor es detenido vía stopChan durante el espera.
-func (c *Consumidor) procesarConRetry(
-	ctx context.Context,
-	mensajesLote []kafka.Message,
-	transferenciasLote []types.Transfer,
-	kafkaMsgsLote []models.KafkaTransferencias,
-	fallidasParseo []models.TransferenciaNotificada,
-) error {
-	backoff := time.Second
-	maxBackoff := obtenerRetryMaxBackoff()
-
-	for {
-		err := c.procesador.CrearLote(transferenciasLote, kafkaMsgsLote, fallidasParseo)
-		if err == nil {
-			// Commit de offsets en Kafka (solo llega hasta acá si el procesamiento fue exitoso)
-			//log.Printf("Lote procesado exitosamente. Haciendo commit de %d offsets en Kafka.", len(mensajesLote))
-			if commitErr := c.reader.CommitMessages(ctx, mensajesLote...); commitErr != nil {
-				log.Printf("CRÍTICO [Consumidor.batchLoop]: No se pudo hacer commit de offsets: %v", commitErr)
+			if err != io.EOF {
+				logs.L(logs.Kafka).ErrorContext(ctx, "no se pudo obtener el mensaje", logs.Err(err))
+			}
+			select {
+			case <-c.stopChan:
+				return
+			case <-time.After(time.Second):
 			}
-			return nil
+			continue
 		}
 
-		log.Printf("CRÍTICO [Consumidor.batchLoop]: Falló procesamiento del lote. NO se hará commit. Reintentando en %v: %v", backoff, err)
-
+		c.offsets.Registrar(msg)
+		p := c.pipelines[c.shardDe(msg)]
 		select {
+		case p.entrada <- msg:
 		case <-c.stopChan:
-			log.Println("Consumidor detenido durante reintento. Kafka re-entregará el lote al reiniciar.")
-			return errors.New("consumidor detenido")
-		case <-time.After(backoff):
-		}
-
-		if backoff < maxBackoff {
-			backoff *= 2
-			if backoff > maxBackoff {
-				backoff = maxBackoff
-			}
+			return
 		}
 	}
 }
 
-// leer msj de kafka y armar lote de transferencias
-func (c *Consumidor) armarLoteDesdeKafka(ctx context.Context) ([]kafka.Message, []types.Transfer, []models.KafkaTransferencias, []models.TransferenciaNotificada) {
-	tamanoLote := obtenerTamanoLoteKafka()
-	timeoutLote := obtenerTimeoutLoteKafka()
-
-	mensajesLote := make([]kafka.Message, 0, tamanoLote)
-	transferenciasLote := make([]types.Transfer, 0, tamanoLote)
-	kafkaMsgsLote := make([]models.KafkaTransferencias, 0, tamanoLote)
-	var fallidasParseo []models.TransferenciaNotificada
-
-	ctxLote, cancelarLote := context.WithTimeout(ctx, timeoutLote)
-	defer cancelarLote()
-
-	for i := 0; i < tamanoLote; i++ {
-		msg, err := c.reader.FetchMessage(ctxLote)
-		if err != nil {
-			if err == context.DeadlineExceeded || err == io.EOF {
-				break
-			}
-			if err == context.Canceled && ctx.Err() == context.Canceled {
-				break
-			}
-			log.Printf("ERROR [Consumidor.armarLoteDesdeKafka]: No se pudo fetch mensaje: %v", err)
-			break
-		}
-		transfer, kafkaMsg, err := c.parseKafkaMessage(msg)
-		if err != nil {
-			log.Printf("ERROR [Consumidor.armarLoteDesdeKafka]: Mensaje Kafka inválido (Offset: %d): %v. Se notificará en el webhook.", msg.Offset, err)
-			fallidasParseo = append(fallidasParseo, models.NewTransferenciaNotificadaParseoError(kafkaMsg, err.Error()))
-			mensajesLote = append(mensajesLote, msg)
-			continue
-		}
-		mensajesLote = append(mensajesLote, msg)
-		transferenciasLote = append(transferenciasLote, transfer)
-		kafkaMsgsLote = append(kafkaMsgsLote, kafkaMsg)
+// Devuelve el índice del pipeline que procesa el mensaje: hash de (IdMoneda, IdUsuarioFinal).
+// Solo decodifica los campos de la cuenta; el parseo y validación completos se hacen en el pipeline.
+// Los mensajes que no se pueden decodificar se reparten por partición (se notifican como error de parseo).
+func (c *Consumidor) shardDe(msg kafka.Message) int {
+	idMoneda, idUsuarioFinal, ok := esquemas.ExtraerCuenta(msg.Value, formatoDe(msg))
+	if !ok {
+		return msg.Partition % len(c.pipelines)
 	}
-	return mensajesLote, transferenciasLote, kafkaMsgsLote, fallidasParseo
+	h := fnv.New32a()
+	h.Write([]byte(utils.ConcatenarIDString(uint64(idMoneda), idUsuarioFinal)))
+	return int(h.Sum32() % uint32(len(c.pipelines)))
 }
 
-// Mensaje de Kafka a Transfer de TigerBeetle. Construye DebitAccountID y CreditAccountID a partir de IdUsuarioFinal, IdMoneda y Tipo (I/E).
-func (c *Consumidor) parseKafkaMessage(msg kafka.Message) (types.Transfer, models.KafkaTransferencias, error) {
-	var kafkaMsg models.KafkaTransferencias
-
-	if err := json.Unmarshal(msg.Value, &kafkaMsg); err != nil {
-		return types.Transfer{}, kafkaMsg, errors.New("Fallo al parsear JSON: " + err.Error())
-	}
-	if kafkaMsg.IdTransferencia == "" {
-		return types.Transfer{}, kafkaMsg, errors.New("IdTransferencia está vacío")
-	}
-	if kafkaMsg.IdUsuarioFinal == 0 {
-		return types.Transfer{}, kafkaMsg, errors.New("IdUsuarioFinal no puede ser cero")
-	}
-	if kafkaMsg.Tipo != "I" && kafkaMsg.Tipo != "E" && kafkaMsg.Tipo != "R" {
-		return types.Transfer{}, kafkaMsg, errors.New("Tipo debe ser 'I' (ingreso), 'E' (egreso) o 'R' (reversión)")
-	}
-	if kafkaMsg.Tipo != "R" && kafkaMsg.Monto <= 0 {
-		return types.Transfer{}, kafkaMsg, errors.New("Monto debe ser mayor a cero")
+// Formato del mensaje según el header mstf-formato (sin header: JSON)
+func formatoDe(msg kafka.Message) string {
+	if f := headerDe(msg, esquemas.HeaderFormato); f != "" {
+		return f
 	}
+	return esquemas.FormatoJSON
+}
 
-	idTransferenciaCast, err := utils.ParsearUint128(kafkaMsg.IdTransferencia)
-	if err != nil {
-		return types.Transfer{}, kafkaMsg, errors.New("IdTransferencia formato incorrecto")
+// IdCorrelacion del header mstf-correlacion. Los mensajes que no lo traen reciben uno nuevo,
+// derivado de su ubicación para que sea el mismo si el mensaje se vuelve a leer.
+func correlacionDe(msg kafka.Message) string {
+	if id := headerDe(msg, correlacion.HeaderKafka); id != "" {
+		return correlacion.Normalizar(id)
 	}
+	return fmt.Sprintf("kafka-%d-%d", msg.Partition, msg.Offset)
+}
 
-	// Para Tipo="R", construir la transferencia de reversión a partir de la original
-	if kafkaMsg.Tipo == "R" {
-		return c.buildReversion(idTransferenciaCast, kafkaMsg)
+func headerDe(msg kafka.Message, clave string) string {
+	for _, h := range msg.Headers {
+		if h.Key == clave {
+			return string(h.Value)
+		}
 	}
+	return ""
+}
 
-	// Flujo normal para I/E
-	idCuentaUsuarioStr := utils.ConcatenarIDString(uint64(kafkaMsg.IdMoneda), kafkaMsg.IdUsuarioFinal)
-	idCuentaUsuario, err := utils.ParsearUint128(idCuentaUsuarioStr)
-	if err != nil {
-		return types.Transfer{}, kafkaMsg, errors.New("No se pudo construir ID de cuenta usuario")
+// Arma el lote de ingesta a partir de los mensajes de Kafka. Al confirmarse se commitean los offsets.
+func (c *Consumidor) armarLoteIngesta(mensajesLote []kafka.Message) ingesta.Lote {
+	mensajes := make([]ingesta.Mensaje, len(mensajesLote))
+	for i, msg := range mensajesLote {
+		mensajes[i] = ingesta.Mensaje{
+			Origen:      origenDe(msg),
+			Clave:       msg.Key,
+			Valor:       msg.Value,
+			Formato:     formatoDe(msg),
+			Correlacion: correlacionDe(msg),
+			Traza:       trazaDe(msg),
+			Ref:         msg,
+		}
 	}
-
-	// Obtener IdCuentaEmpresa de la moneda
-	moneda := &models.Monedas{IdMoneda: int(kafkaMsg.IdMoneda)}
-	if _, err := moneda.Dame(); err != nil {
-		return types.Transfer{}, kafkaMsg, errors.New("La moneda no existe o no se encuentra activa")
+	return ingesta.Lote{
+		Fuente:   c.Nombre(),
+		Mensajes: mensajes,
+		Confirmar: func(ctx context.Context) error {
+			return c.offsets.Confirmar(ctx, mensajesLote)
+		},
+		AlCuarentena: c.publicarDLQ,
 	}
-	if moneda.IdCuentaEmpresa == "" {
-		return types.Transfer{}, kafkaMsg, errors.New("La moneda no existe o no se encuentra activa")
+}
+
+func origenDe(msg kafka.Message) string {
+	return fmt.Sprintf("kafka:%s/%d/%d", msg.Topic, msg.Partition, msg.Offset)
+}
+
+// Si hay topic DLQ configurado, publica ahí el mensaje puesto en cuarentena con el error en los headers.
+func (c *Consumidor) publicarDLQ(m ingesta.Mensaje, errProceso error) error {
+	if c.dlq == nil {
+		return nil
 	}
-	idCuentaEmpresa, err := utils.ParsearUint128(moneda.IdCuentaEmpresa)
-	if err != nil {
-		return types.Transfer{}, kafkaMsg, errors.New("IdCuentaEmpresa formato incorrecto: " + err.Error())
+	msg, _ := m.Ref.(kafka.Message)
+	headers := make([]kafka.Header, 0, len(msg.Headers)+2)
+	headers = append(headers, msg.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: "mstf-error", Value: []byte(errProceso.Error())},
+		kafka.Header{Key: "mstf-origen", Value: []byte(m.Origen)},
+	)
+	mensajeDLQ := kafka.Message{
+		Key:     m.Clave,
+		Value:   m.Valor,
+		Headers: headers,
 	}
-
-	// Asignar débito/crédito según Tipo
-	var debitAccountID, creditAccountID types.Uint128
-	if kafkaMsg.Tipo == "E" {
-		debitAccountID = idCuentaUsuario
-		creditAccountID = idCuentaEmpresa
-	} else {
-		debitAccountID = idCuentaEmpresa
-		creditAccountID = idCuentaUsuario
+	if err := c.dlq.WriteMessages(context.Background(), mensajeDLQ); err != nil {
+		return fmt.Errorf("no se pudo publicar en el topic DLQ: %w", err)
 	}
+	return nil
+}
 
-	timeStampUint32, _ := utils.FechaAUserData32(kafkaMsg.Fecha)
-	transferencia := types.Transfer{
-		ID:              idTransferenciaCast,
-		DebitAccountID:  debitAccountID,
-		CreditAccountID: creditAccountID,
-		Amount:          types.ToUint128(utils.MontoDecimalAUnidadMinima(kafkaMsg.Monto)),
-		Ledger:          kafkaMsg.IdMoneda,
-		Code:            models.CodigoTransferenciaNormal,
-		UserData128:     types.ToUint128(kafkaMsg.IdUsuarioFinal),
-		UserData64:      kafkaMsg.IdCategoria,
-		UserData32:      timeStampUint32,
+func (c *Consumidor) Metricas() ingesta.MetricasIngesta {
+	if c.motor == nil {
+		return ingesta.MetricasIngesta{}
 	}
-	return transferencia, kafkaMsg, nil
+	return c.motor.Metricas()
 }
 
 // --------------------------------------------------------------------------------
 // Funciones Aux
 // --------------------------------------------------------------------------------
 
-func obtenerTamanoLoteKafka() int {
-	p := &models.Parametros{Parametro: "KAFKABATCHSIZE"}
-	if _, err := p.Dame(); err != nil || p.Valor == "" {
-		return 8000
-	}
-	val, err := strconv.Atoi(p.Valor)
-	if err != nil || val <= 0 {
-		return 8000
-	}
-	return val
-}
-
-func obtenerTimeoutLoteKafka() time.Duration {
+func obtenerTimeoutLoteKafka(parametros repositorios.Parametros) time.Duration {
 	p := &models.Parametros{Parametro: "KAFKABATCHTIMEOUTMS"}
-	if _, err := p.Dame(); err != nil || p.Valor == "" {
+	if _, err := parametros.Dame(context.Background(), p); err != nil || p.Valor == "" {
 		return 500 * time.Millisecond
 	}
 	val, err := strconv.Atoi(p.Valor)
@@ -276,53 +290,14 @@ func obtenerTimeoutLoteKafka() time.Duration {
 	return time.Duration(val) * time.Millisecond
 }
 
-func obtenerRetryMaxBackoff() time.Duration {
-	p := &models.Parametros{Parametro: "RETRYBACKOFFMAXSEG"}
-	if _, err := p.Dame(); err != nil || p.Valor == "" {
-		return 20 * time.Second
+func obtenerCantidadPipelines(parametros repositorios.Parametros) int {
+	p := &models.Parametros{Parametro: "KAFKAPIPELINES"}
+	if _, err := parametros.Dame(context.Background(), p); err != nil || p.Valor == "" {
+		return 4
 	}
 	val, err := strconv.Atoi(p.Valor)
 	if err != nil || val <= 0 {
-		return 20 * time.Second
-	}
-	return time.Duration(val) * time.Second
-}
-
-// construye una transferencia de reversión a partir de la original en TigerBeetle:
-// invierte las cuentas debit/credit
-// mismo monto
-// guarda id original en userdata128
-func (c *Consumidor) buildReversion(idOriginal types.Uint128, kafkaMsg models.KafkaTransferencias) (types.Transfer, models.KafkaTransferencias, error) {
-	if persistence.ClienteTB == nil {
-		return types.Transfer{}, kafkaMsg, errors.New("Conexión a TigerBeetle no inicializada")
-	}
-
-	originals, err := persistence.ClienteTB.LookupTransfers([]types.Uint128{idOriginal})
-	if err != nil {
-		return types.Transfer{}, kafkaMsg, errors.New("Error al buscar transferencia original: " + err.Error())
-	}
-	if len(originals) == 0 {
-		return types.Transfer{}, kafkaMsg, errors.New("No existe la transferencia a revertir")
-	}
-
-	original := originals[0]
-
-	// bit 64 encendido sobre el ID original
-	IdReversion := original.ID
-	IdReversion[8] |= 0x01
-
-	timeStampUint32, _ := utils.FechaAUserData32(kafkaMsg.Fecha)
-
-	transferencia := types.Transfer{
-		ID:              IdReversion,
-		DebitAccountID:  original.CreditAccountID, // invertido
-		CreditAccountID: original.DebitAccountID,  // invertido
-		Amount:          original.Amount,
-		Ledger:          original.Ledger,
-		Code:            models.CodigoTransferenciaReversion,
-		UserData128:     original.ID, // ref a la original
-		UserData64:      original.UserData64,
-		UserData32:      timeStampUint32,
+		return 4
 	}
-	return transferencia, kafkaMsg, nil
+	return val
 }
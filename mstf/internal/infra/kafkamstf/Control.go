@@ -0,0 +1,199 @@
+package kafkamstf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/ingesta"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Estado general del consumidor: pausa y lote en curso de cada pipeline
+type EstadoConsumidor struct {
+	Topic        string                  `json:"Topic"`
+	GroupID      string                  `json:"GroupID"`
+	Pausado      bool                    `json:"Pausado"`
+	PausadoDesde *time.Time              `json:"PausadoDesde"`
+	Pipelines    []EstadoPipeline        `json:"Pipelines"`
+	Metricas     ingesta.MetricasIngesta `json:"Metricas"`
+}
+
+// Offsets y lag de una partición del topic
+type EstadoParticion struct {
+	Particion       int   `json:"Particion"`
+	PrimerOffset    int64 `json:"PrimerOffset"`
+	UltimoOffset    int64 `json:"UltimoOffset"`    // high watermark: próximo offset a escribir
+	OffsetCommitado int64 `json:"OffsetCommitado"` // próximo offset a leer por el grupo (-1 = sin commit)
+	Lag             int64 `json:"Lag"`
+	UltimoLeido     int64 `json:"UltimoLeido"` // -1 = esta instancia no leyó de la partición
+	Pendientes      int   `json:"Pendientes"`  // leídos por esta instancia y todavía sin commit
+}
+
+// Detiene la lectura de mensajes nuevos. Los lotes que ya están en los pipelines se terminan de procesar.
+// Retorna false si ya estaba pausado.
+func (c *Consumidor) Pausar() bool {
+	c.muPausa.Lock()
+	defer c.muPausa.Unlock()
+	if c.pausado {
+		return false
+	}
+	c.pausado = true
+	c.pausadoDesde = time.Now()
+	c.reanudar = make(chan struct{})
+	return true
+}
+
+// Retoma la lectura. Falla si no estaba pausado o si hay un reproceso REAL en curso.
+func (c *Consumidor) Reanudar() error {
+	c.muPausa.Lock()
+	defer c.muPausa.Unlock()
+	if !c.pausado {
+		return ErrConsumidorNoPausado
+	}
+	if c.reprocesandoReal {
+		return ErrReprocesoEnCurso
+	}
+	c.pausado = false
+	close(c.reanudar)
+	return nil
+}
+
+// Bloquea al fetcher mientras el consumidor esté pausado. Retorna false si el consumidor se detiene.
+func (c *Consumidor) esperarSiPausado() bool {
+	c.muPausa.Lock()
+	if !c.pausado {
+		c.muPausa.Unlock()
+		return true
+	}
+	reanudar := c.reanudar
+	c.fetcherEnPausa = true
+	c.muPausa.Unlock()
+
+	defer func() {
+		c.muPausa.Lock()
+		c.fetcherEnPausa = false
+		c.muPausa.Unlock()
+	}()
+	select {
+	case <-reanudar:
+		return true
+	case <-c.stopChan:
+		return false
+	}
+}
+
+func (c *Consumidor) Estado() EstadoConsumidor {
+	c.muPausa.Lock()
+	estado := EstadoConsumidor{
+		Topic:   c.config.TopicKafka,
+		GroupID: c.config.GroupIDKafka,
+		Pausado: c.pausado,
+	}
+	if c.pausado {
+		desde := c.pausadoDesde
+		estado.PausadoDesde = &desde
+	}
+	pipelines := c.pipelines
+	c.muPausa.Unlock()
+
+	estado.Pipelines = make([]EstadoPipeline, 0, len(pipelines))
+	for _, p := range pipelines {
+		estado.Pipelines = append(estado.Pipelines, p.Estado())
+	}
+	estado.Metricas = c.Metricas()
+	return estado
+}
+
+// Consulta al cluster los offsets de cada partición del topic y el offset commiteado por el grupo,
+// y los combina con el seguimiento interno de esta instancia.
+func (c *Consumidor) Offsets(ctx context.Context) ([]EstadoParticion, error) {
+	cliente := &kafka.Client{Addr: kafka.TCP(c.config.BrokersKafka...), Timeout: 10 * time.Second}
+	topic := c.config.TopicKafka
+
+	particiones, err := particionesTopic(ctx, cliente, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	pedidos := make([]kafka.OffsetRequest, 0, 2*len(particiones))
+	for _, p := range particiones {
+		pedidos = append(pedidos, kafka.FirstOffsetOf(p), kafka.LastOffsetOf(p))
+	}
+	respOffsets, err := cliente.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{topic: pedidos},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("no se pudieron obtener los offsets del topic: %w", err)
+	}
+
+	respGrupo, err := cliente.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: c.config.GroupIDKafka,
+		Topics:  map[string][]int{topic: particiones},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("no se pudieron obtener los offsets del grupo: %w", err)
+	}
+	if respGrupo.Error != nil {
+		return nil, fmt.Errorf("no se pudieron obtener los offsets del grupo: %w", respGrupo.Error)
+	}
+
+	commits := make(map[int]int64)
+	for _, p := range respGrupo.Topics[topic] {
+		commits[p.Partition] = p.CommittedOffset
+	}
+	seguimiento := c.offsets.Estado()
+
+	resultado := make([]EstadoParticion, 0, len(particiones))
+	for _, po := range respOffsets.Topics[topic] {
+		if po.Error != nil {
+			return nil, fmt.Errorf("error en la partición %d: %w", po.Partition, po.Error)
+		}
+		ep := EstadoParticion{
+			Particion:       po.Partition,
+			PrimerOffset:    po.FirstOffset,
+			UltimoOffset:    po.LastOffset,
+			OffsetCommitado: -1,
+			UltimoLeido:     -1,
+		}
+		if commit, ok := commits[po.Partition]; ok {
+			ep.OffsetCommitado = commit
+		}
+		if ep.OffsetCommitado >= 0 {
+			ep.Lag = ep.UltimoOffset - ep.OffsetCommitado
+		} else {
+			ep.Lag = ep.UltimoOffset - ep.PrimerOffset
+		}
+		if s, ok := seguimiento[po.Partition]; ok {
+			ep.UltimoLeido = s.UltimoLeido
+			ep.Pendientes = s.Pendientes
+		}
+		resultado = append(resultado, ep)
+	}
+	sort.Slice(resultado, func(i, j int) bool { return resultado[i].Particion < resultado[j].Particion })
+	return resultado, nil
+}
+
+func particionesTopic(ctx context.Context, cliente *kafka.Client, topic string) ([]int, error) {
+	meta, err := cliente.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo obtener la metadata del topic: %w", err)
+	}
+	for _, t := range meta.Topics {
+		if t.Name != topic {
+			continue
+		}
+		if t.Error != nil {
+			return nil, fmt.Errorf("no se pudo obtener la metadata del topic: %w", t.Error)
+		}
+		particiones := make([]int, 0, len(t.Partitions))
+		for _, p := range t.Partitions {
+			particiones = append(particiones, p.ID)
+		}
+		return particiones, nil
+	}
+	return nil, errors.New("el topic no existe")
+}
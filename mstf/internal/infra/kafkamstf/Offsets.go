@@ -0,0 +1,119 @@
+package kafkamstf
+
+import (
+	"context"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Lleva el registro de los offsets leídos y procesados de cada partición.
+// Como los pipelines procesan en paralelo, un offset alto puede terminar antes que uno bajo de la misma partición:
+// solo se hace commit del prefijo contiguo de offsets ya procesados, así Kafka nunca saltea un mensaje pendiente.
+type seguimientoOffsets struct {
+	mu          sync.Mutex
+	particiones map[int]*estadoParticion
+	commit      func(ctx context.Context, msgs ...kafka.Message) error
+}
+
+type estadoParticion struct {
+	pendientes    []kafka.Message // en orden de fetch (offsets crecientes)
+	procesados    map[int64]bool
+	ultimoLeido   int64
+	ultimoCommit  int64
+	tieneLecturas bool
+}
+
+func newSeguimientoOffsets(commit func(ctx context.Context, msgs ...kafka.Message) error) *seguimientoOffsets {
+	return &seguimientoOffsets{
+		particiones: make(map[int]*estadoParticion),
+		commit:      commit,
+	}
+}
+
+// Registra un mensaje recién leído. Si el offset no es mayor al último leído de la partición
+// (re-entrega tras un rebalance del grupo), se descarta el estado pendiente de esa partición:
+// los mensajes se reprocesan y TB responde TransferExists para los que ya estaban escritos.
+func (s *seguimientoOffsets) Registrar(msg kafka.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ep, ok := s.particiones[msg.Partition]
+	if !ok {
+		ep = &estadoParticion{procesados: make(map[int64]bool), ultimoCommit: -1}
+		s.particiones[msg.Partition] = ep
+	}
+	if ep.tieneLecturas && msg.Offset <= ep.ultimoLeido {
+		ep.pendientes = ep.pendientes[:0]
+		ep.procesados = make(map[int64]bool)
+	}
+	ep.pendientes = append(ep.pendientes, msg)
+	ep.ultimoLeido = msg.Offset
+	ep.tieneLecturas = true
+}
+
+// Marca los mensajes como procesados y hace commit, por partición, del mayor offset contiguo.
+// El commit se hace con el lock tomado para que dos pipelines no puedan commitear fuera de orden.
+func (s *seguimientoOffsets) Confirmar(ctx context.Context, msgs []kafka.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// los offsets ya commiteados (lote anterior a una re-entrega) y las particiones sin lecturas se ignoran
+	for _, m := range msgs {
+		if ep, ok := s.particiones[m.Partition]; ok && m.Offset > ep.ultimoCommit {
+			ep.procesados[m.Offset] = true
+		}
+	}
+
+	var paraCommit []kafka.Message
+	for _, ep := range s.particiones {
+		avance := -1
+		for i, m := range ep.pendientes {
+			if !ep.procesados[m.Offset] {
+				break
+			}
+			delete(ep.procesados, m.Offset)
+			avance = i
+		}
+		if avance < 0 {
+			continue
+		}
+		ultimo := ep.pendientes[avance]
+		ep.pendientes = ep.pendientes[avance+1:]
+		ep.ultimoCommit = ultimo.Offset
+		paraCommit = append(paraCommit, ultimo)
+		// offsets de un lote anterior a una re-entrega que ya no están pendientes
+		for o := range ep.procesados {
+			if o <= ep.ultimoCommit {
+				delete(ep.procesados, o)
+			}
+		}
+	}
+
+	if len(paraCommit) == 0 {
+		return nil
+	}
+	return s.commit(ctx, paraCommit...)
+}
+
+// Estado interno de una partición según el seguimiento del consumidor
+type seguimientoParticion struct {
+	UltimoLeido  int64
+	UltimoCommit int64
+	Pendientes   int
+}
+
+func (s *seguimientoOffsets) Estado() map[int]seguimientoParticion {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	estado := make(map[int]seguimientoParticion, len(s.particiones))
+	for particion, ep := range s.particiones {
+		estado[particion] = seguimientoParticion{
+			UltimoLeido:  ep.ultimoLeido,
+			UltimoCommit: ep.ultimoCommit,
+			Pendientes:   len(ep.pendientes),
+		}
+	}
+	return estado
+}
@@ -0,0 +1,114 @@
+package kafkamstf
+
+import (
+	"context"
+	"maps"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Paso de un caso: registra los offsets leídos o confirma los procesados (partición -> offsets) y espera
+// el commit resultante (partición -> offset; vacío: sin commit)
+type pasoOffsets struct {
+	registrar map[int][]int64
+	confirmar map[int][]int64
+	commit    map[int]int64
+}
+
+func mensajesOffsets(offsets map[int][]int64) []kafka.Message {
+	var msgs []kafka.Message
+	for particion, os := range offsets {
+		for _, o := range os {
+			msgs = append(msgs, kafka.Message{Partition: particion, Offset: o})
+		}
+	}
+	return msgs
+}
+
+func TestSeguimientoOffsets(t *testing.T) {
+	casos := []struct {
+		nombre string
+		pasos  []pasoOffsets
+		// estado final por partición
+		estado map[int]seguimientoParticion
+	}{
+		{"prefijo contiguo", []pasoOffsets{
+			{registrar: map[int][]int64{0: {10, 11, 12}}},
+			{confirmar: map[int][]int64{0: {10, 11}}, commit: map[int]int64{0: 11}},
+			{confirmar: map[int][]int64{0: {12}}, commit: map[int]int64{0: 12}},
+		}, map[int]seguimientoParticion{0: {UltimoLeido: 12, UltimoCommit: 12}}},
+
+		// pipelines de distintos shards confirman fuera de orden: no se commitea por encima de un pendiente
+		{"confirmaciones fuera de orden entre shards", []pasoOffsets{
+			{registrar: map[int][]int64{0: {0, 1, 2, 3}, 1: {5, 6}}},
+			{confirmar: map[int][]int64{0: {2, 3}, 1: {6}}},
+			{confirmar: map[int][]int64{0: {1}, 1: {5}}, commit: map[int]int64{1: 6}},
+			{confirmar: map[int][]int64{0: {0}}, commit: map[int]int64{0: 3}},
+		}, map[int]seguimientoParticion{0: {UltimoLeido: 3, UltimoCommit: 3}, 1: {UltimoLeido: 6, UltimoCommit: 6}}},
+
+		// tras un rebalance se vuelve a leer desde 1 mientras el lote 0-2 sigue en proceso
+		{"re-entrega con un lote anterior en proceso", []pasoOffsets{
+			{registrar: map[int][]int64{0: {0, 1, 2}}},
+			{registrar: map[int][]int64{0: {1, 2, 3}}},
+			// el lote anterior terminó: 1 y 2 se procesaron, 3 sigue pendiente
+			{confirmar: map[int][]int64{0: {0, 1, 2}}, commit: map[int]int64{0: 2}},
+			// la re-entrega de 1 y 2 ya está commiteada: no vuelve a commitear ni deja estado
+			{confirmar: map[int][]int64{0: {1, 2}}},
+			{confirmar: map[int][]int64{0: {3}}, commit: map[int]int64{0: 3}},
+		}, map[int]seguimientoParticion{0: {UltimoLeido: 3, UltimoCommit: 3}}},
+
+		{"re-entrega antes de confirmar", []pasoOffsets{
+			{registrar: map[int][]int64{0: {4, 5}}},
+			{registrar: map[int][]int64{0: {4, 5}}},
+			{confirmar: map[int][]int64{0: {5}}},
+			{confirmar: map[int][]int64{0: {4}}, commit: map[int]int64{0: 5}},
+		}, map[int]seguimientoParticion{0: {UltimoLeido: 5, UltimoCommit: 5}}},
+
+		// la partición se asignó a otra instancia: su confirmación no commitea ni crea estado
+		{"confirmación de una partición no asignada", []pasoOffsets{
+			{registrar: map[int][]int64{0: {0}}},
+			{confirmar: map[int][]int64{3: {7, 8}}},
+			{confirmar: map[int][]int64{0: {0}, 3: {9}}, commit: map[int]int64{0: 0}},
+		}, map[int]seguimientoParticion{0: {UltimoLeido: 0, UltimoCommit: 0}}},
+	}
+
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			var commits []kafka.Message
+			s := newSeguimientoOffsets(func(_ context.Context, msgs ...kafka.Message) error {
+				commits = append(commits, msgs...)
+				return nil
+			})
+			for i, p := range c.pasos {
+				for _, m := range mensajesOffsets(p.registrar) {
+					s.Registrar(m)
+				}
+				commits = nil
+				if p.confirmar != nil {
+					if err := s.Confirmar(t.Context(), mensajesOffsets(p.confirmar)); err != nil {
+						t.Fatalf("paso %d: %v", i, err)
+					}
+				}
+				obtenido := map[int]int64{}
+				for _, m := range commits {
+					if _, ok := obtenido[m.Partition]; ok {
+						t.Fatalf("paso %d: más de un commit para la partición %d", i, m.Partition)
+					}
+					obtenido[m.Partition] = m.Offset
+				}
+				if !maps.Equal(obtenido, p.commit) {
+					t.Fatalf("paso %d: commit %v, se esperaba %v", i, obtenido, p.commit)
+				}
+			}
+			if estado := s.Estado(); !maps.Equal(estado, c.estado) {
+				t.Fatalf("estado %+v, se esperaba %+v", estado, c.estado)
+			}
+			for particion, ep := range s.particiones {
+				if len(ep.procesados) != 0 {
+					t.Fatalf("partición %d: quedaron offsets procesados sin commitear %v", particion, ep.procesados)
+				}
+			}
+		})
+	}
+}
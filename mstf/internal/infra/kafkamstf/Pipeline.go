@@ -0,0 +1,150 @@
+package kafkamstf
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/infra/trazas"
+	"MSTransaccionesFinancieras/internal/ingesta"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Pipeline de procesamiento de un shard de cuentas.
+// Todos los mensajes de una misma cuenta caen en el mismo pipeline, y cada pipeline procesa
+// sus lotes de a uno y en orden: así se mantiene el orden por cuenta (necesario para validar reversiones
+// y saldos) mientras los distintos pipelines escriben en TB en paralelo.
+type pipeline struct {
+	id         int
+	consumidor *Consumidor
+	entrada    chan kafka.Message
+
+	mu     sync.Mutex
+	estado EstadoPipeline
+}
+
+// Estado del lote en curso de un pipeline (para la API de control del consumidor)
+type EstadoPipeline struct {
+	IdPipeline       int        `json:"IdPipeline"`
+	Estado           string     `json:"Estado"` // ESPERANDO, PROCESANDO, REINTENTANDO, AISLANDO
+	MensajesEnCola   int        `json:"MensajesEnCola"`
+	MensajesLote     int        `json:"MensajesLote"`
+	InicioLote       *time.Time `json:"InicioLote"`
+	Intentos         int        `json:"Intentos"`
+	Backoff          string     `json:"Backoff"`
+	ProximoReintento *time.Time `json:"ProximoReintento"`
+	UltimoError      string     `json:"UltimoError"`
+}
+
+func newPipeline(id int, c *Consumidor, capacidad int) *pipeline {
+	return &pipeline{
+		id:         id,
+		consumidor: c,
+		entrada:    make(chan kafka.Message, capacidad),
+		estado:     EstadoPipeline{IdPipeline: id, Estado: "ESPERANDO"},
+	}
+}
+
+// Foto del estado del pipeline
+func (p *pipeline) Estado() EstadoPipeline {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e := p.estado
+	e.MensajesEnCola = len(p.entrada)
+	return e
+}
+
+func (p *pipeline) actualizarEstado(f func(e *EstadoPipeline)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f(&p.estado)
+}
+
+// loop principal del pipeline: arma lotes con los mensajes que le asigna el fetcher y los procesa
+func (p *pipeline) loop(ctx context.Context) {
+	defer p.consumidor.wg.Done()
+
+	for {
+		mensajesLote, inicioFetch, ok := p.armarLote()
+		if !ok {
+			return
+		}
+		if len(mensajesLote) == 0 {
+			continue
+		}
+
+		inicio := time.Now()
+		p.actualizarEstado(func(e *EstadoPipeline) {
+			*e = EstadoPipeline{IdPipeline: p.id, Estado: "PROCESANDO", MensajesLote: len(mensajesLote), InicioLote: &inicio}
+		})
+
+		// El motor reintenta hasta procesar el lote (o aislar los mensajes que lo hacen fallar) y recién ahí
+		// confirma (commit de offsets). Si el MS cae durante el retry, Kafka retoma desde el último offset commiteado.
+		// span del lote desde que llegó su primer mensaje: fetch (armado del lote) y procesamiento en el motor
+		ctxLote, span := trazas.Tracer().Start(ctx, "kafka.lote", trace.WithTimestamp(inicioFetch),
+			trace.WithAttributes(attribute.Int("kafka.pipeline", p.id), attribute.Int("kafka.mensajes", len(mensajesLote))))
+		_, spanFetch := trazas.Tracer().Start(ctxLote, "kafka.fetch", trace.WithTimestamp(inicioFetch))
+		spanFetch.End()
+
+		lote := p.consumidor.armarLoteIngesta(mensajesLote)
+		err := p.consumidor.motor.ProcesarConReintentos(ctxLote, lote, p.alReintentar)
+		trazas.Finalizar(span, err)
+		if err != nil {
+			return
+		}
+		p.actualizarEstado(func(e *EstadoPipeline) {
+			*e = EstadoPipeline{IdPipeline: p.id, Estado: "ESPERANDO"}
+		})
+	}
+}
+
+// Espera el primer mensaje del lote y a partir de ahí acumula hasta KAFKABATCHSIZE mensajes
+// o hasta que pase KAFKABATCHTIMEOUTMS. Retorna también el momento en que llegó el primer mensaje.
+// Retorna false si el consumidor fue detenido sin lote en curso.
+func (p *pipeline) armarLote() ([]kafka.Message, time.Time, bool) {
+	tamanoLote := ingesta.ObtenerTamanoLote(p.consumidor.parametros)
+	timeoutLote := obtenerTimeoutLoteKafka(p.consumidor.parametros)
+
+	var primero kafka.Message
+	select {
+	case <-p.consumidor.stopChan:
+		return nil, time.Time{}, false
+	case primero = <-p.entrada:
+	}
+	inicio := time.Now()
+
+	mensajesLote := make([]kafka.Message, 0, tamanoLote)
+	mensajesLote = append(mensajesLote, primero)
+
+	timer := time.NewTimer(timeoutLote)
+	defer timer.Stop()
+
+	for len(mensajesLote) < tamanoLote {
+		select {
+		case msg := <-p.entrada:
+			mensajesLote = append(mensajesLote, msg)
+		case <-timer.C:
+			return mensajesLote, inicio, true
+		case <-p.consumidor.stopChan:
+			return mensajesLote, inicio, true
+		}
+	}
+	return mensajesLote, inicio, true
+}
+
+// Refleja en el estado del pipeline cada intento fallido del lote en curso
+func (p *pipeline) alReintentar(r ingesta.EstadoReintento) {
+	p.actualizarEstado(func(e *EstadoPipeline) {
+		e.Estado = r.Estado
+		e.Intentos = r.Intentos
+		e.UltimoError = r.Error.Error()
+		if r.Backoff > 0 {
+			proximo := time.Now().Add(r.Backoff)
+			e.Backoff = r.Backoff.String()
+			e.ProximoReintento = &proximo
+		}
+	})
+}
@@ -2,12 +2,17 @@ package kafkamstf
 
 import (
 	"MSTransaccionesFinancieras/internal/config"
+	"MSTransaccionesFinancieras/internal/correlacion"
+	"MSTransaccionesFinancieras/internal/esquemas"
+	"MSTransaccionesFinancieras/internal/infra/logs"
+	"MSTransaccionesFinancieras/internal/infra/trazas"
 	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/utils"
 	"context"
-	"encoding/json"
-	"log"
 
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // EL PRODUCTOR SOLO EXISTE PARA PROBAR LA CREACIÓN DE TRANSFERENCIAS, NO ES PARTE DEL FLUJO NORMAL DEL MS
@@ -24,33 +29,58 @@ func InitProductor(cfg config.Config) (*ProductorKafka, error) {
 		MaxAttempts:  3,
 	}
 
-	//log.Println("Productor de Kafka conectado.")
+	logs.L(logs.Kafka).Debug("productor de Kafka conectado")
 	return &ProductorKafka{writer: writer}, nil
 }
 
 func (p *ProductorKafka) Close() {
 	if p.writer != nil {
 		if err := p.writer.Close(); err != nil {
-			//log.Printf("Error al cerrar Kafka writer (productor): %v", err)
+			logs.L(logs.Kafka).Error("error al cerrar el writer de Kafka (productor)", logs.Err(err))
 		}
 	}
 }
 
-func (p *ProductorKafka) PublicarTransferencia(ctx context.Context, msg models.KafkaTransferencias) error {
-	// Serializar a json
-	jsonValue, err := json.Marshal(msg)
+func (p *ProductorKafka) PublicarTransferencia(ctx context.Context, msg models.KafkaTransferencias) (err error) {
+	ctx, span := trazas.Tracer().Start(ctx, "kafka.PublicarTransferencia", trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("messaging.system", "kafka"), attribute.String("messaging.destination.name", p.writer.Topic)))
+	defer func() { trazas.Finalizar(span, err) }()
+
+	mensajeKafka, err := mensajeTransferencia(ctx, msg)
 	if err != nil {
-		log.Printf("ERROR [Productor.PublicarTransferencia]: Fallo al serializar JSON: %v", err)
+		logs.L(logs.Kafka).ErrorContext(ctx, "fallo al serializar la transferencia", logs.Err(err))
 		return err
 	}
-	mensajeKafka := kafka.Message{
-		Key:   []byte(msg.IdTransferencia),
-		Value: jsonValue,
-	}
 	err = p.writer.WriteMessages(ctx, mensajeKafka)
 	if err != nil {
-		log.Printf("ERROR [Productor.PublicarTransferencia]: Fallo al escribir mensaje en Kafka: %v", err)
+		logs.L(logs.Kafka).ErrorContext(ctx, "fallo al escribir el mensaje en Kafka", "IdCorrelacion", correlacionDe(mensajeKafka), logs.Err(err))
 		return err
 	}
 	return nil
 }
+
+// Mensaje de Kafka de la transferencia (JSON, sobre v2) con los headers de formato, IdCorrelacion y traza
+func mensajeTransferencia(ctx context.Context, msg models.KafkaTransferencias) (kafka.Message, error) {
+	// IdCorrelacion de la request HTTP que originó la publicación
+	idCorrelacion := correlacion.DesdeContexto(ctx)
+	if idCorrelacion == "" {
+		idCorrelacion = correlacion.Nuevo()
+	}
+
+	jsonValue, err := esquemas.CodificarJSON(msg)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	// La key es la cuenta (IdMoneda + IdUsuarioFinal): todas las transferencias de una cuenta
+	// van a la misma partición y Kafka conserva su orden
+	mensajeKafka := kafka.Message{
+		Key:   []byte(utils.ConcatenarIDString(uint64(msg.IdMoneda), msg.IdUsuarioFinal)),
+		Value: jsonValue,
+		Headers: []kafka.Header{
+			{Key: esquemas.HeaderFormato, Value: []byte(esquemas.FormatoJSON)},
+			{Key: correlacion.HeaderKafka, Value: []byte(idCorrelacion)},
+		},
+	}
+	inyectarTraza(ctx, &mensajeKafka)
+	return mensajeKafka, nil
+}
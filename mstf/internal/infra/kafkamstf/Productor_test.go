@@ -0,0 +1,72 @@
+package kafkamstf
+
+import (
+	"context"
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/correlacion"
+	"MSTransaccionesFinancieras/internal/models"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func transferenciaTest() models.KafkaTransferencias {
+	return models.KafkaTransferencias{IdTransferencia: "1", IdUsuarioFinal: 7, Monto: 10, IdMoneda: 1, Tipo: "I", Fecha: "2026-01-02"}
+}
+
+// El IdCorrelacion de la request que publica viaja en el header mstf-correlacion hasta el lote del consumidor
+func TestCorrelacionProductorConsumidor(t *testing.T) {
+	ctx := correlacion.EnContexto(context.Background(), "pedido-42")
+	msg, err := mensajeTransferencia(ctx, transferenciaTest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := headerDe(msg, correlacion.HeaderKafka); h != "pedido-42" {
+		t.Fatalf("header %s: %q", correlacion.HeaderKafka, h)
+	}
+
+	lote := (&Consumidor{}).armarLoteIngesta([]kafka.Message{msg})
+	if c := lote.Mensajes[0].Correlacion; c != "pedido-42" {
+		t.Fatalf("IdCorrelacion en el lote: %q", c)
+	}
+}
+
+// Sin IdCorrelacion en el context el productor genera uno
+func TestCorrelacionProductorSinContexto(t *testing.T) {
+	msg, err := mensajeTransferencia(context.Background(), transferenciaTest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := headerDe(msg, correlacion.HeaderKafka); h == "" || correlacion.Normalizar(h) != h {
+		t.Fatalf("header %s: %q", correlacion.HeaderKafka, h)
+	}
+}
+
+func TestCorrelacionConsumidor(t *testing.T) {
+	casos := []struct {
+		nombre  string
+		headers []kafka.Header
+		// vacío: se espera uno generado
+		esperado string
+	}{
+		{"header válido", []kafka.Header{{Key: correlacion.HeaderKafka, Value: []byte("pedido-42")}}, "pedido-42"},
+		{"sin header", nil, "kafka-3-17"},
+		{"header inválido", []kafka.Header{{Key: correlacion.HeaderKafka, Value: []byte("no válido\n")}}, ""},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			id := correlacionDe(kafka.Message{Partition: 3, Offset: 17, Headers: c.headers})
+			if c.esperado != "" && id != c.esperado {
+				t.Fatalf("IdCorrelacion %q, se esperaba %q", id, c.esperado)
+			}
+			if c.esperado == "" && (id == "no válido\n" || correlacion.Normalizar(id) != id) {
+				t.Fatalf("IdCorrelacion %q no se normalizó", id)
+			}
+		})
+	}
+	// sin header, el mismo mensaje releído recibe el mismo IdCorrelacion
+	msg := kafka.Message{Partition: 3, Offset: 17}
+	if correlacionDe(msg) != correlacionDe(msg) {
+		t.Fatal("el IdCorrelacion derivado de la ubicación cambió")
+	}
+}
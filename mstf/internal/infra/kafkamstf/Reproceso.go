@@ -0,0 +1,238 @@
+package kafkamstf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/ingesta"
+	"MSTransaccionesFinancieras/internal/models"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	ModoReprocesoSimulacion = "SIMULACION" // no escribe en TB ni notifica: informa qué pasaría
+	ModoReprocesoReal       = "REAL"       // procesa y notifica igual que el consumidor
+)
+
+var (
+	ErrReprocesoEnCurso    = errors.New("ya hay un reproceso en curso")
+	ErrReprocesoSinPausa   = errors.New("para reprocesar en modo REAL el consumidor debe estar pausado y sin lotes en curso")
+	ErrConsumidorNoPausado = errors.New("el consumidor no está pausado")
+)
+
+// Rango de una partición a reprocesar. El inicio se indica por offset o por fecha; el fin es opcional
+// (por defecto, el último mensaje de la partición al momento del pedido).
+type PedidoReproceso struct {
+	Particion   int
+	DesdeOffset *int64
+	DesdeFecha  *time.Time
+	HastaOffset *int64 // inclusive
+	HastaFecha  *time.Time
+	Modo        string
+	Limite      int
+}
+
+type ResultadoReproceso struct {
+	Particion      int                              `json:"Particion"`
+	Modo           string                           `json:"Modo"`
+	DesdeOffset    int64                            `json:"DesdeOffset"`
+	HastaOffset    int64                            `json:"HastaOffset"` // último offset leído (-1 si no se leyó ninguno)
+	Leidos         int                              `json:"Leidos"`
+	Nuevas         int                              `json:"Nuevas"`
+	Reintentos     int                              `json:"Reintentos"` // ya estaban en TB (TransferExists → "OK - Reintento")
+	Errores        int                              `json:"Errores"`
+	Truncado       bool                             `json:"Truncado"` // se alcanzó el límite antes del fin del rango
+	Transferencias []models.TransferenciaNotificada `json:"Transferencias"`
+}
+
+// Relee un rango de una partición con un reader sin grupo (no mueve los offsets del consumidor)
+// y lo reprocesa. Es seguro reprocesar mensajes ya escritos: TB responde TransferExists y se
+// informan como "OK - Reintento". En modo REAL el consumidor debe estar pausado y sin lotes en curso
+// (ErrReprocesoSinPausa), para no intercalar el reproceso con los lotes de los pipelines de las mismas
+// cuentas; mientras dura no se puede reanudar.
+func (c *Consumidor) Reprocesar(ctx context.Context, pedido PedidoReproceso) (*ResultadoReproceso, error) {
+	if pedido.Modo != ModoReprocesoSimulacion && pedido.Modo != ModoReprocesoReal {
+		return nil, errors.New("Modo debe ser " + ModoReprocesoSimulacion + " o " + ModoReprocesoReal)
+	}
+	if (pedido.DesdeOffset == nil) == (pedido.DesdeFecha == nil) {
+		return nil, errors.New("Se debe indicar DesdeOffset o DesdeFecha (solo uno)")
+	}
+	if !c.muReproceso.TryLock() {
+		return nil, ErrReprocesoEnCurso
+	}
+	defer c.muReproceso.Unlock()
+
+	if pedido.Modo == ModoReprocesoReal {
+		if !c.iniciarReprocesoReal() {
+			return nil, ErrReprocesoSinPausa
+		}
+		defer c.terminarReprocesoReal()
+	}
+
+	mensajes, resultado, err := c.leerRango(ctx, pedido)
+	if err != nil {
+		return nil, err
+	}
+	return c.reprocesarMensajes(ctx, pedido.Modo, mensajes, resultado)
+}
+
+// Marca el inicio de un reproceso REAL si el consumidor está pausado, el fetcher no tiene un fetch en curso
+// y todos los mensajes leídos ya se commitearon (los pipelines terminaron sus lotes).
+func (c *Consumidor) iniciarReprocesoReal() bool {
+	c.muPausa.Lock()
+	defer c.muPausa.Unlock()
+	if !c.pausado || (c.pipelines != nil && !c.fetcherEnPausa) {
+		return false
+	}
+	for _, ep := range c.offsets.Estado() {
+		if ep.Pendientes > 0 {
+			return false
+		}
+	}
+	c.reprocesandoReal = true
+	return true
+}
+
+func (c *Consumidor) terminarReprocesoReal() {
+	c.muPausa.Lock()
+	c.reprocesandoReal = false
+	c.muPausa.Unlock()
+}
+
+// Procesa (REAL) o simula (SIMULACION) los mensajes leídos en lotes de KAFKABATCHSIZE
+func (c *Consumidor) reprocesarMensajes(ctx context.Context, modo string, mensajes []kafka.Message, resultado *ResultadoReproceso) (*ResultadoReproceso, error) {
+	if len(mensajes) == 0 {
+		return resultado, nil
+	}
+	if c.motor == nil {
+		return nil, errors.New("el consumidor no está iniciado")
+	}
+
+	// el lote de reproceso no se confirma: los offsets del consumer group no se tocan
+	tamanoLote := ingesta.ObtenerTamanoLote(c.parametros)
+	for inicio := 0; inicio < len(mensajes); inicio += tamanoLote {
+		fin := min(inicio+tamanoLote, len(mensajes))
+		lote := c.armarLoteIngesta(mensajes[inicio:fin])
+		lote.Fuente = "kafka-reproceso"
+		lote.Confirmar = nil
+
+		var notificaciones []models.TransferenciaNotificada
+		var err error
+		if modo == ModoReprocesoReal {
+			notificaciones, err = c.motor.ProcesarLote(ctx, lote)
+		} else {
+			notificaciones, err = c.motor.SimularLote(ctx, lote)
+		}
+		resultado.agregar(notificaciones)
+		if err != nil {
+			// se devuelve lo reprocesado hasta el lote que falló
+			return resultado, fmt.Errorf("falló el reproceso a partir del offset %d: %w", mensajes[inicio].Offset, err)
+		}
+	}
+	return resultado, nil
+}
+
+// Lee los mensajes del rango pedido, hasta el fin del rango o hasta Limite mensajes.
+func (c *Consumidor) leerRango(ctx context.Context, pedido PedidoReproceso) ([]kafka.Message, *ResultadoReproceso, error) {
+	resultado := &ResultadoReproceso{
+		Particion:      pedido.Particion,
+		Modo:           pedido.Modo,
+		HastaOffset:    -1,
+		Transferencias: []models.TransferenciaNotificada{},
+	}
+
+	cliente := &kafka.Client{Addr: kafka.TCP(c.config.BrokersKafka...), Timeout: 10 * time.Second}
+	respOffsets, err := cliente.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{c.config.TopicKafka: {kafka.LastOffsetOf(pedido.Particion)}},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("no se pudieron obtener los offsets de la partición: %w", err)
+	}
+	offsets := respOffsets.Topics[c.config.TopicKafka]
+	if len(offsets) == 0 || offsets[0].Error != nil {
+		return nil, nil, fmt.Errorf("la partición %d no existe en el topic", pedido.Particion)
+	}
+	// fin del rango: último mensaje existente al momento del pedido, o HastaOffset si es menor
+	fin := offsets[0].LastOffset - 1
+	if pedido.HastaOffset != nil && *pedido.HastaOffset < fin {
+		fin = *pedido.HastaOffset
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   c.config.BrokersKafka,
+		Topic:     c.config.TopicKafka,
+		Partition: pedido.Particion,
+		MaxWait:   500 * time.Millisecond,
+		MinBytes:  1,
+		MaxBytes:  10e6,
+	})
+	defer reader.Close()
+
+	if pedido.DesdeOffset != nil {
+		err = reader.SetOffset(*pedido.DesdeOffset)
+	} else {
+		err = reader.SetOffsetAt(ctx, *pedido.DesdeFecha)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("no se pudo posicionar el reader: %w", err)
+	}
+	desde := reader.Offset()
+	resultado.DesdeOffset = desde
+	// offset negativo: no hay mensajes posteriores a DesdeFecha
+	if desde < 0 || desde > fin {
+		return nil, resultado, nil
+	}
+
+	mensajes, err := acumularRango(ctx, reader.ReadMessage, fin, pedido, resultado)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mensajes, resultado, nil
+}
+
+// Lee mensajes hasta el offset fin (inclusive), hasta el primero posterior a HastaFecha o hasta Limite mensajes
+// (Truncado). Actualiza HastaOffset y Leidos en el resultado.
+func acumularRango(ctx context.Context, leer func(context.Context) (kafka.Message, error), fin int64, pedido PedidoReproceso, resultado *ResultadoReproceso) ([]kafka.Message, error) {
+	var mensajes []kafka.Message
+	for {
+		if len(mensajes) >= pedido.Limite {
+			resultado.Truncado = true
+			break
+		}
+		msg, err := leer(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("no se pudo leer la partición: %w", err)
+		}
+		if msg.Offset > fin || (pedido.HastaFecha != nil && msg.Time.After(*pedido.HastaFecha)) {
+			break
+		}
+		mensajes = append(mensajes, msg)
+		resultado.HastaOffset = msg.Offset
+		if msg.Offset == fin {
+			break
+		}
+	}
+	resultado.Leidos = len(mensajes)
+	return mensajes, nil
+}
+
+func (r *ResultadoReproceso) agregar(notificaciones []models.TransferenciaNotificada) {
+	for _, n := range notificaciones {
+		if n.Estado == "" {
+			// mensaje de un sub-lote que no llegó a procesarse
+			continue
+		}
+		switch {
+		case n.Estado == "E":
+			r.Errores++
+		case n.Mensaje == "OK - Reintento":
+			r.Reintentos++
+		default:
+			r.Nuevas++
+		}
+		r.Transferencias = append(r.Transferencias, n)
+	}
+}
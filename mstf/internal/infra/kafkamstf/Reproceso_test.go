@@ -0,0 +1,212 @@
+package kafkamstf
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/config"
+	"MSTransaccionesFinancieras/internal/esquemas"
+	"MSTransaccionesFinancieras/internal/gestores"
+	"MSTransaccionesFinancieras/internal/infra/persistence"
+	"MSTransaccionesFinancieras/internal/infra/tbmemoria"
+	"MSTransaccionesFinancieras/internal/infra/webhook"
+	"MSTransaccionesFinancieras/internal/ingesta"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios/memoria"
+	"MSTransaccionesFinancieras/internal/utils"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const monedaTest uint32 = 1
+
+// Consumidor sin iniciar (sin reader ni pipelines) con un motor sobre TigerBeetle y repositorios en memoria,
+// y la cuenta del usuario 7
+func nuevoConsumidorTest(t *testing.T) *Consumidor {
+	t.Helper()
+	tb := persistence.InstrumentarTB(tbmemoria.New())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	webhook.Init(config.Config{URLWebhook: srv.URL})
+
+	bd := memoria.New()
+	bd.GuardarParametro(models.Parametros{Parametro: "MONTOMAXTRANSFER", Valor: "100000000"})
+	bd.GuardarParametro(models.Parametros{Parametro: "MONTOMINTRANSFER", Valor: "100"})
+	bd.GuardarParametro(models.Parametros{Parametro: "KAFKABATCHSIZE", Valor: "2"})
+	bd.GuardarMoneda(models.Monedas{IdMoneda: int(monedaTest), IdCuentaEmpresa: utils.ConcatenarIDString(uint64(monedaTest), 0)})
+	repos := bd.Repositorios()
+
+	gc := gestores.NewGestorCuentas(tb, repos.Monedas, repos.Auditoria)
+	for _, idUsuarioFinal := range []uint64{0, 7} {
+		if _, _, err := gc.Crear(t.Context(), models.Cuentas{IdMoneda: monedaTest, IdUsuarioFinal: idUsuarioFinal, Fecha: "2026-01-01"}); err != nil {
+			t.Fatalf("no se pudo crear la cuenta %d: %v", idUsuarioFinal, err)
+		}
+	}
+	gt := gestores.NewGestorTransferencias(tb, repos.Parametros, repos.Monedas, repos.Auditoria, gestores.NewGestorEstadosTransferencias(repos.Estados))
+	return &Consumidor{
+		config:     config.Config{TopicKafka: "transferencias"},
+		parametros: repos.Parametros,
+		stopChan:   make(chan struct{}),
+		offsets:    newSeguimientoOffsets(func(context.Context, ...kafka.Message) error { return nil }),
+		motor:      ingesta.NewMotor(tb, gt, gestores.NewGestorCuarentena(repos.Cuarentena), repos.Parametros, repos.Monedas),
+	}
+}
+
+// Mensajes de la partición 0 a partir del offset 10 con ingresos a la cuenta del usuario 7 (transferencias 1 a n)
+func mensajesTest(t *testing.T, n int) []kafka.Message {
+	t.Helper()
+	msgs := make([]kafka.Message, n)
+	for i := range msgs {
+		valor, err := esquemas.CodificarJSON(models.KafkaTransferencias{
+			IdTransferencia: strconv.Itoa(i + 1), IdUsuarioFinal: 7, Monto: 10, IdMoneda: monedaTest, Tipo: "I", Fecha: "2026-01-02",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs[i] = kafka.Message{Topic: "transferencias", Partition: 0, Offset: int64(10 + i), Value: valor}
+	}
+	return msgs
+}
+
+// SIMULACION no escribe en TB; REAL sí, y el reproceso siguiente informa los mensajes como reintentos
+func TestReprocesarModos(t *testing.T) {
+	c := nuevoConsumidorTest(t)
+	msgs := mensajesTest(t, 3)
+
+	pasos := []struct {
+		modo                        string
+		nuevas, reintentos, errores int
+		estado                      string
+	}{
+		{ModoReprocesoSimulacion, 3, 0, 0, "P"},
+		{ModoReprocesoSimulacion, 3, 0, 0, "P"},
+		{ModoReprocesoReal, 3, 0, 0, "F"},
+		{ModoReprocesoSimulacion, 0, 3, 0, "F"},
+		{ModoReprocesoReal, 0, 3, 0, "F"},
+	}
+	for i, p := range pasos {
+		resultado, err := c.reprocesarMensajes(t.Context(), p.modo, msgs, &ResultadoReproceso{Modo: p.modo})
+		if err != nil {
+			t.Fatalf("paso %d (%s): %v", i, p.modo, err)
+		}
+		if resultado.Nuevas != p.nuevas || resultado.Reintentos != p.reintentos || resultado.Errores != p.errores {
+			t.Fatalf("paso %d (%s): nuevas %d, reintentos %d, errores %d", i, p.modo, resultado.Nuevas, resultado.Reintentos, resultado.Errores)
+		}
+		if len(resultado.Transferencias) != len(msgs) {
+			t.Fatalf("paso %d (%s): %d transferencias", i, p.modo, len(resultado.Transferencias))
+		}
+		for _, n := range resultado.Transferencias {
+			if n.Estado != p.estado {
+				t.Fatalf("paso %d (%s): transferencia %s en estado %s, se esperaba %s", i, p.modo, n.IdTransferencia, n.Estado, p.estado)
+			}
+		}
+	}
+	if est := c.offsets.Estado(); len(est) != 0 {
+		t.Fatalf("el reproceso no debe tocar los offsets del grupo: %+v", est)
+	}
+}
+
+// El reproceso REAL exige el consumidor pausado y sin lotes en curso, y mientras dura no se puede reanudar
+func TestReprocesarRealRequierePausa(t *testing.T) {
+	c := nuevoConsumidorTest(t)
+	pedido := PedidoReproceso{Particion: 0, DesdeOffset: new(int64), Modo: ModoReprocesoReal, Limite: 10}
+
+	if _, err := c.Reprocesar(t.Context(), pedido); !errors.Is(err, ErrReprocesoSinPausa) {
+		t.Fatalf("sin pausar: %v", err)
+	}
+	if err := c.Reanudar(); !errors.Is(err, ErrConsumidorNoPausado) {
+		t.Fatalf("Reanudar sin pausar: %v", err)
+	}
+
+	c.Pausar()
+	// un mensaje leído antes de la pausa que su pipeline todavía no confirmó
+	msg := kafka.Message{Partition: 0, Offset: 10}
+	c.offsets.Registrar(msg)
+	if c.iniciarReprocesoReal() {
+		t.Fatal("se inició el reproceso con un lote en curso")
+	}
+	if err := c.offsets.Confirmar(t.Context(), []kafka.Message{msg}); err != nil {
+		t.Fatal(err)
+	}
+
+	// con los pipelines iniciados, además el fetcher tiene que estar detenido en la pausa
+	c.pipelines = []*pipeline{newPipeline(0, c, 1)}
+	if c.iniciarReprocesoReal() {
+		t.Fatal("se inició el reproceso con un fetch en curso")
+	}
+	detenido := make(chan bool)
+	go func() { detenido <- c.esperarSiPausado() }()
+	for !c.iniciarReprocesoReal() {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := c.Reanudar(); !errors.Is(err, ErrReprocesoEnCurso) {
+		t.Fatalf("Reanudar durante el reproceso: %v", err)
+	}
+	c.terminarReprocesoReal()
+	if err := c.Reanudar(); err != nil {
+		t.Fatalf("Reanudar: %v", err)
+	}
+	if !<-detenido {
+		t.Fatal("el fetcher no se reanudó")
+	}
+}
+
+func TestAcumularRango(t *testing.T) {
+	base := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	fecha := func(i int) *time.Time { f := base.Add(time.Duration(i) * time.Minute); return &f }
+
+	casos := []struct {
+		nombre     string
+		fin        int64
+		limite     int
+		hastaFecha *time.Time
+		leidos     int
+		hasta      int64
+		truncado   bool
+	}{
+		{"rango completo", 9, 100, nil, 10, 9, false},
+		{"límite antes del fin", 9, 4, nil, 4, 3, true},
+		{"límite igual al rango", 9, 10, nil, 10, 9, false},
+		{"fin por offset", 5, 100, nil, 6, 5, false},
+		{"límite igual al fin por offset", 5, 6, nil, 6, 5, false},
+		{"fin por fecha", 9, 100, fecha(2), 3, 2, false},
+		{"límite antes de la fecha", 9, 2, fecha(5), 2, 1, true},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			siguiente := int64(0)
+			leer := func(context.Context) (kafka.Message, error) {
+				msg := kafka.Message{Offset: siguiente, Time: *fecha(int(siguiente))}
+				siguiente++
+				return msg, nil
+			}
+			resultado := &ResultadoReproceso{HastaOffset: -1}
+			pedido := PedidoReproceso{Limite: c.limite, HastaFecha: c.hastaFecha}
+			mensajes, err := acumularRango(t.Context(), leer, c.fin, pedido, resultado)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(mensajes) != c.leidos || resultado.Leidos != c.leidos || resultado.HastaOffset != c.hasta || resultado.Truncado != c.truncado {
+				t.Fatalf("leídos %d (%d), HastaOffset %d, Truncado %v", len(mensajes), resultado.Leidos, resultado.HastaOffset, resultado.Truncado)
+			}
+		})
+	}
+
+	t.Run("error de lectura", func(t *testing.T) {
+		errLectura := errors.New("sin conexión")
+		leer := func(context.Context) (kafka.Message, error) { return kafka.Message{}, errLectura }
+		if _, err := acumularRango(t.Context(), leer, 9, PedidoReproceso{Limite: 10}, &ResultadoReproceso{}); !errors.Is(err, errLectura) {
+			t.Fatalf("error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package kafkamstf
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Verifica que los brokers respondan y que existan el topic de transferencias y el de cuarentena (si está configurado)
+func (c *Consumidor) VerificarConexion(ctx context.Context) error {
+	topics := []string{c.config.TopicKafka}
+	if c.config.TopicKafkaDLQ != "" {
+		topics = append(topics, c.config.TopicKafkaDLQ)
+	}
+	return verificarTopics(ctx, kafka.TCP(c.config.BrokersKafka...), topics)
+}
+
+// Verifica que el consumidor avance: falla si algún pipeline lleva más de SALUDUMBRALLOTESEG con el mismo lote,
+// ya sea procesándolo o reintentándolo. Un consumidor pausado no se considera trabado.
+func (c *Consumidor) VerificarProgreso() error {
+	umbral := obtenerUmbralLote(c.parametros)
+	c.muPausa.Lock()
+	pipelines := c.pipelines
+	c.muPausa.Unlock()
+
+	var trabados []string
+	for _, p := range pipelines {
+		e := p.Estado()
+		if e.Estado == "ESPERANDO" || e.InicioLote == nil || time.Since(*e.InicioLote) < umbral {
+			continue
+		}
+		detalle := fmt.Sprintf("pipeline %d %s desde hace %s", e.IdPipeline, e.Estado, time.Since(*e.InicioLote).Round(time.Second))
+		if e.Intentos > 0 {
+			detalle += fmt.Sprintf(" (%d intentos, último error: %s)", e.Intentos, e.UltimoError)
+		}
+		trabados = append(trabados, detalle)
+	}
+	if len(trabados) > 0 {
+		return fmt.Errorf("consumidor trabado: %s", strings.Join(trabados, "; "))
+	}
+	return nil
+}
+
+// Verifica que los brokers respondan y que exista el topic del productor
+func (p *ProductorKafka) VerificarConexion(ctx context.Context) error {
+	return verificarTopics(ctx, p.writer.Addr, []string{p.writer.Topic})
+}
+
+func verificarTopics(ctx context.Context, brokers net.Addr, topics []string) error {
+	cliente := &kafka.Client{Addr: brokers}
+	meta, err := cliente.Metadata(ctx, &kafka.MetadataRequest{Topics: topics})
+	if err != nil {
+		return fmt.Errorf("no se pudo obtener la metadata de Kafka: %w", err)
+	}
+	encontrados := make(map[string]bool, len(meta.Topics))
+	for _, t := range meta.Topics {
+		if t.Error != nil {
+			return fmt.Errorf("topic %s: %w", t.Name, t.Error)
+		}
+		encontrados[t.Name] = true
+	}
+	for _, t := range topics {
+		if !encontrados[t] {
+			return fmt.Errorf("el topic %s no existe", t)
+		}
+	}
+	return nil
+}
+
+func obtenerUmbralLote(parametros repositorios.Parametros) time.Duration {
+	p := &models.Parametros{Parametro: "SALUDUMBRALLOTESEG"}
+	if _, err := parametros.Dame(context.Background(), p); err != nil || p.Valor == "" {
+		return 60 * time.Second
+	}
+	val, err := strconv.Atoi(p.Valor)
+	if err != nil || val <= 0 {
+		return 60 * time.Second
+	}
+	return time.Duration(val) * time.Second
+}
@@ -0,0 +1,53 @@
+package kafkamstf
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Adapta los headers de un mensaje de Kafka a propagation.TextMapCarrier para propagar
+// el contexto de traza (traceparent) del productor al consumidor.
+type headersKafka struct {
+	headers *[]kafka.Header
+}
+
+func (h headersKafka) Get(clave string) string {
+	for _, hd := range *h.headers {
+		if hd.Key == clave {
+			return string(hd.Value)
+		}
+	}
+	return ""
+}
+
+func (h headersKafka) Set(clave string, valor string) {
+	for i, hd := range *h.headers {
+		if hd.Key == clave {
+			(*h.headers)[i].Value = []byte(valor)
+			return
+		}
+	}
+	*h.headers = append(*h.headers, kafka.Header{Key: clave, Value: []byte(valor)})
+}
+
+func (h headersKafka) Keys() []string {
+	claves := make([]string, len(*h.headers))
+	for i, hd := range *h.headers {
+		claves[i] = hd.Key
+	}
+	return claves
+}
+
+func inyectarTraza(ctx context.Context, msg *kafka.Message) {
+	otel.GetTextMapPropagator().Inject(ctx, headersKafka{headers: &msg.Headers})
+}
+
+// Contexto de traza del productor del mensaje (inválido si no vino en los headers)
+func trazaDe(msg kafka.Message) trace.SpanContext {
+	headers := msg.Headers
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), headersKafka{headers: &headers})
+	return trace.SpanContextFromContext(ctx)
+}
@@ -0,0 +1,77 @@
+package kafkamstf
+
+import (
+	"context"
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/config"
+	"MSTransaccionesFinancieras/internal/infra/trazas"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Registra en memoria los spans del test y vuelve al provider no-op al terminar
+func grabarSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	if _, err := trazas.Init(config.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	grabador := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(grabador)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	return grabador
+}
+
+// El contexto de traza del productor viaja en el header traceparent hasta el mensaje del lote del consumidor
+func TestTrazaProductorConsumidor(t *testing.T) {
+	grabarSpans(t)
+	ctx, span := trazas.Tracer().Start(context.Background(), "kafka.PublicarTransferencia")
+	defer span.End()
+
+	msg, err := mensajeTransferencia(ctx, transferenciaTest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if headerDe(msg, "traceparent") == "" {
+		t.Fatalf("el mensaje no lleva traceparent: %v", msg.Headers)
+	}
+
+	traza := (&Consumidor{}).armarLoteIngesta([]kafka.Message{msg}).Mensajes[0].Traza
+	if !traza.IsRemote() || traza.TraceID() != span.SpanContext().TraceID() || traza.SpanID() != span.SpanContext().SpanID() {
+		t.Fatalf("traza en el lote: %v, se esperaba la del productor %v", traza, span.SpanContext())
+	}
+}
+
+// Un mensaje sin traceparent (ej: de otro productor) no tiene traza
+func TestTrazaMensajeSinHeader(t *testing.T) {
+	grabarSpans(t)
+	if traza := trazaDe(kafka.Message{}); traza.IsValid() {
+		t.Fatalf("traza de un mensaje sin headers: %v", traza)
+	}
+}
+
+// Sin exportador (none) no se registran spans pero el contexto de traza se sigue propagando
+func TestTrazaSinExportador(t *testing.T) {
+	if _, err := trazas.Init(config.Config{ExportadorTrazas: trazas.ExportadorNinguno}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trazas.Init(config.Config{ExportadorTrazas: "jaeger"}); err == nil {
+		t.Fatal("se aceptó un exportador no soportado")
+	}
+	idTraza, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	idSpan, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(),
+		trace.NewSpanContext(trace.SpanContextConfig{TraceID: idTraza, SpanID: idSpan, TraceFlags: trace.FlagsSampled, Remote: true}))
+	msg, err := mensajeTransferencia(ctx, transferenciaTest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := headerDe(msg, "traceparent"); h != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Fatalf("traceparent: %q", h)
+	}
+}
@@ -0,0 +1,88 @@
+package limites
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Cada cuánto se descartan los buckets llenos, que equivalen a uno nuevo
+const intervaloLimpieza = time.Minute
+
+// Estado de una clave. Guarda la tasa y la capacidad con que se usó por última vez para poder limpiarlo.
+type bucket struct {
+	tokens        float64
+	ultimaRecarga time.Time
+	porSegundo    float64
+	rafaga        float64
+}
+
+// Tokens del bucket al momento ahora
+func (b *bucket) tokensA(ahora time.Time) float64 {
+	return math.Min(b.rafaga, b.tokens+ahora.Sub(b.ultimaRecarga).Seconds()*b.porSegundo)
+}
+
+// Limitador de tasa in-memory por clave (token bucket), thread-safe.
+// Cada clave tiene un bucket de capacidad rafaga que se recarga a porMinuto tokens por minuto y cada
+// solicitud consume un token. Los límites son por instancia del MS: no se comparten entre réplicas.
+type Limitador struct {
+	mu             sync.Mutex
+	buckets        map[string]*bucket
+	ultimaLimpieza time.Time
+	ahora          func() time.Time
+}
+
+func NewLimitador() *Limitador {
+	return &Limitador{
+		buckets:        make(map[string]*bucket),
+		ultimaLimpieza: time.Now(),
+		ahora:          time.Now,
+	}
+}
+
+// Consume un token del bucket de la clave. Devuelve true si había uno disponible; si no, false y el tiempo
+// hasta que haya uno. porMinuto o rafaga <= 0 deshabilitan el límite.
+func (l *Limitador) Tomar(clave string, porMinuto int, rafaga int) (bool, time.Duration) {
+	if porMinuto <= 0 || rafaga <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ahora := l.ahora()
+	if ahora.Sub(l.ultimaLimpieza) >= intervaloLimpieza {
+		l.limpiar(ahora)
+	}
+
+	b, existe := l.buckets[clave]
+	if !existe {
+		b = &bucket{tokens: float64(rafaga), ultimaRecarga: ahora}
+		l.buckets[clave] = b
+	}
+	// Un cambio de parámetros aplica desde la próxima recarga
+	b.porSegundo, b.rafaga = float64(porMinuto)/60, float64(rafaga)
+	b.tokens = b.tokensA(ahora)
+	b.ultimaRecarga = ahora
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.porSegundo * float64(time.Second))
+}
+
+// Descarta los buckets que ya se recargaron por completo. Debe llamarse con el lock tomado.
+func (l *Limitador) limpiar(ahora time.Time) {
+	for clave, b := range l.buckets {
+		if b.tokensA(ahora) >= b.rafaga {
+			delete(l.buckets, clave)
+		}
+	}
+	l.ultimaLimpieza = ahora
+}
+
+// Cantidad de claves con bucket
+func (l *Limitador) Claves() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
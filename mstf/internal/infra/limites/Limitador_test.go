@@ -0,0 +1,54 @@
+package limites
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimitadorTokenBucket(t *testing.T) {
+	l := NewLimitador()
+	ahora := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.ahora = func() time.Time { return ahora }
+	l.ultimaLimpieza = ahora
+
+	// ráfaga de 3 y 60 por minuto (uno por segundo)
+	for i := 1; i <= 3; i++ {
+		if ok, _ := l.Tomar("a", 60, 3); !ok {
+			t.Fatalf("solicitud %d de la ráfaga rechazada", i)
+		}
+	}
+	ok, espera := l.Tomar("a", 60, 3)
+	if ok || espera != time.Second {
+		t.Fatalf("cuarta solicitud: %v %v", ok, espera)
+	}
+	// las claves son independientes
+	if ok, _ := l.Tomar("b", 60, 3); !ok {
+		t.Fatalf("otra clave rechazada")
+	}
+
+	ahora = ahora.Add(500 * time.Millisecond)
+	if ok, espera := l.Tomar("a", 60, 3); ok || espera != 500*time.Millisecond {
+		t.Fatalf("a medio token: %v %v", ok, espera)
+	}
+	ahora = ahora.Add(500 * time.Millisecond)
+	if ok, _ := l.Tomar("a", 60, 3); !ok {
+		t.Fatalf("tras recargar un token: rechazada")
+	}
+
+	// sin límite
+	for i := 0; i < 10; i++ {
+		if ok, _ := l.Tomar("c", 0, 3); !ok {
+			t.Fatalf("con porMinuto 0 no debe limitar")
+		}
+	}
+
+	// pasado el intervalo de limpieza se descartan los buckets llenos
+	if l.Claves() != 2 {
+		t.Fatalf("claves: %d", l.Claves())
+	}
+	ahora = ahora.Add(intervaloLimpieza)
+	l.Tomar("d", 1, 5)
+	if l.Claves() != 1 {
+		t.Fatalf("claves tras limpiar: %d", l.Claves())
+	}
+}
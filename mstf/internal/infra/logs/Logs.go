@@ -0,0 +1,200 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/correlacion"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Subsistemas con nivel de log propio, modificable en runtime (PUT /admin/logs/:subsistema)
+const (
+	App            = "app"
+	HTTP           = "http"
+	Ingesta        = "ingesta"
+	Kafka          = "kafka"
+	Transferencias = "transferencias"
+	Cuentas        = "cuentas"
+	Webhook        = "webhook"
+	Persistencia   = "persistencia"
+)
+
+var subsistemas = []string{App, HTTP, Ingesta, Kafka, Transferencias, Cuentas, Webhook, Persistencia}
+
+var (
+	mu      sync.RWMutex
+	niveles = map[string]*slog.LevelVar{}
+	salida  slog.Handler
+	loggers = map[string]*slog.Logger{}
+)
+
+func init() {
+	configurar(os.Stdout, slog.LevelInfo)
+}
+
+// Configura la salida JSON y el nivel inicial de todos los subsistemas (LOG_LEVEL: DEBUG, INFO, WARN, ERROR).
+// Los mensajes del paquete log estándar (dependencias) se redirigen al subsistema app.
+func Init(nivel string) error {
+	return InitEn(os.Stdout, nivel)
+}
+
+// Como Init, pero escribe los logs en w (ej: os.Stderr en las herramientas que imprimen su resultado en stdout)
+func InitEn(w io.Writer, nivel string) error {
+	n, err := parsearNivel(nivel)
+	if err != nil {
+		return err
+	}
+	configurar(w, n)
+	log.SetFlags(0)
+	log.SetOutput(writerLogEstandar{})
+	return nil
+}
+
+func configurar(w io.Writer, nivel slog.Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	// el filtro por nivel lo hace cada subsistema: la salida acepta todo
+	salida = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug})
+	for _, s := range subsistemas {
+		if niveles[s] == nil {
+			niveles[s] = new(slog.LevelVar)
+		}
+		niveles[s].Set(nivel)
+		loggers[s] = slog.New(&handlerSubsistema{
+			salida: salida.WithAttrs([]slog.Attr{slog.String("subsistema", s)}),
+			nivel:  niveles[s],
+		})
+	}
+}
+
+// Logger de un subsistema. Los métodos *Context agregan los datos del context (ver handlerSubsistema.Handle).
+func L(subsistema string) *slog.Logger {
+	mu.RLock()
+	defer mu.RUnlock()
+	if l, ok := loggers[subsistema]; ok {
+		return l
+	}
+	return loggers[App]
+}
+
+// Nivel actual de cada subsistema
+func Niveles() map[string]string {
+	mu.RLock()
+	defer mu.RUnlock()
+	r := make(map[string]string, len(niveles))
+	for s, n := range niveles {
+		r[s] = n.Level().String()
+	}
+	return r
+}
+
+func Subsistemas() []string {
+	r := append([]string{}, subsistemas...)
+	sort.Strings(r)
+	return r
+}
+
+// Cambia el nivel de un subsistema sin reiniciar el MS
+func CambiarNivel(subsistema string, nivel string) error {
+	n, err := parsearNivel(nivel)
+	if err != nil {
+		return err
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	lv, ok := niveles[subsistema]
+	if !ok {
+		return fmt.Errorf("subsistema de log inexistente: %s", subsistema)
+	}
+	lv.Set(n)
+	return nil
+}
+
+func parsearNivel(nivel string) (slog.Level, error) {
+	var n slog.Level
+	if err := n.UnmarshalText([]byte(strings.ToUpper(strings.TrimSpace(nivel)))); err != nil {
+		return 0, fmt.Errorf("nivel de log inválido: %s (DEBUG, INFO, WARN, ERROR)", nivel)
+	}
+	return n, nil
+}
+
+// --------------------------------------------------------------------------------
+// Atributos del context
+// --------------------------------------------------------------------------------
+
+type claveAtributos struct{}
+
+// Agrega atributos que se incluyen en cada línea logueada con ese context (ej: lote, fuente)
+func ConAtributos(ctx context.Context, attrs ...slog.Attr) context.Context {
+	previos, _ := ctx.Value(claveAtributos{}).([]slog.Attr)
+	return context.WithValue(ctx, claveAtributos{}, append(append([]slog.Attr{}, previos...), attrs...))
+}
+
+// Atributo estándar para errores
+func Err(err error) slog.Attr {
+	if err == nil {
+		return slog.String("error", "")
+	}
+	return slog.String("error", err.Error())
+}
+
+// Filtra por el nivel de su subsistema y agrega a cada línea los datos del context:
+// IdCorrelacion, actor, trace_id y los atributos de ConAtributos.
+type handlerSubsistema struct {
+	salida slog.Handler
+	nivel  *slog.LevelVar
+}
+
+func (h *handlerSubsistema) Enabled(_ context.Context, nivel slog.Level) bool {
+	return nivel >= h.nivel.Level()
+}
+
+func (h *handlerSubsistema) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		if id := correlacion.DesdeContexto(ctx); id != "" {
+			r.AddAttrs(slog.String("IdCorrelacion", id))
+		}
+		if _, actor := auth.CredencialDesdeCtx(ctx); actor != "" {
+			r.AddAttrs(slog.String("actor", actor))
+		}
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+		}
+		if attrs, ok := ctx.Value(claveAtributos{}).([]slog.Attr); ok {
+			r.AddAttrs(attrs...)
+		}
+	}
+	return h.salida.Handle(ctx, r)
+}
+
+func (h *handlerSubsistema) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &handlerSubsistema{salida: h.salida.WithAttrs(attrs), nivel: h.nivel}
+}
+
+func (h *handlerSubsistema) WithGroup(nombre string) slog.Handler {
+	return &handlerSubsistema{salida: h.salida.WithGroup(nombre), nivel: h.nivel}
+}
+
+// Redirige el paquete log estándar al subsistema app con nivel INFO
+type writerLogEstandar struct{}
+
+func (writerLogEstandar) Write(p []byte) (int, error) {
+	L(App).Info(strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
+
+// Loguea el error en el subsistema app y termina el proceso (reemplaza a log.Fatalf)
+func Fatal(msg string, args ...any) {
+	L(App).Error(msg, args...)
+	os.Exit(1)
+}
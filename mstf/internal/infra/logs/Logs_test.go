@@ -0,0 +1,157 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/correlacion"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Redirige los logs a un buffer con el nivel inicial dado y los restaura al terminar el test
+func capturar(t *testing.T, nivel string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := InitEn(&buf, nivel); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = InitEn(os.Stdout, "INFO") })
+	return &buf
+}
+
+// Líneas JSON escritas en el buffer
+func lineas(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var r []map[string]any
+	for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if l == "" {
+			continue
+		}
+		var campos map[string]any
+		if err := json.Unmarshal([]byte(l), &campos); err != nil {
+			t.Fatalf("línea no JSON: %s", l)
+		}
+		r = append(r, campos)
+	}
+	return r
+}
+
+// El IdCorrelacion del context (request HTTP, header de Kafka) se agrega a cada línea logueada con ese context
+func TestLogIdCorrelacion(t *testing.T) {
+	buf := capturar(t, "INFO")
+	ctx := correlacion.EnContexto(context.Background(), "pedido-42")
+
+	L(Ingesta).InfoContext(ctx, "con correlación")
+	L(Ingesta).Info("sin context")
+
+	l := lineas(t, buf)
+	if len(l) != 2 {
+		t.Fatalf("se esperaban 2 líneas: %v", l)
+	}
+	if l[0]["IdCorrelacion"] != "pedido-42" || l[0]["subsistema"] != Ingesta {
+		t.Fatalf("línea con correlación: %v", l[0])
+	}
+	if _, ok := l[1]["IdCorrelacion"]; ok {
+		t.Fatalf("línea sin context: %v", l[1])
+	}
+}
+
+// Cada subsistema filtra por su nivel; cambiarlo en runtime no afecta a los demás
+func TestNivelPorSubsistema(t *testing.T) {
+	buf := capturar(t, "info")
+
+	L(Kafka).Debug("debug kafka antes")
+	if err := CambiarNivel(Kafka, "debug"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CambiarNivel(Ingesta, "ERROR"); err != nil {
+		t.Fatal(err)
+	}
+	L(Kafka).Debug("debug kafka")
+	L(Ingesta).Warn("warn ingesta")
+	L(Ingesta).Error("error ingesta")
+	L(Webhook).Debug("debug webhook")
+	L(Webhook).Info("info webhook")
+
+	var mensajes []string
+	for _, l := range lineas(t, buf) {
+		mensajes = append(mensajes, l["subsistema"].(string)+": "+l["msg"].(string))
+	}
+	esperados := []string{"kafka: debug kafka", "ingesta: error ingesta", "webhook: info webhook"}
+	if strings.Join(mensajes, "|") != strings.Join(esperados, "|") {
+		t.Fatalf("líneas:\n%v\nse esperaban\n%v", mensajes, esperados)
+	}
+	n := Niveles()
+	if len(n) != len(Subsistemas()) || n[Kafka] != "DEBUG" || n[Ingesta] != "ERROR" || n[Webhook] != "INFO" {
+		t.Fatalf("niveles: %v", n)
+	}
+}
+
+func TestCambiarNivelInvalido(t *testing.T) {
+	capturar(t, "INFO")
+	if err := CambiarNivel("redis", "DEBUG"); err == nil {
+		t.Fatal("se aceptó un subsistema inexistente")
+	}
+	if err := CambiarNivel(Kafka, "TRACE"); err == nil {
+		t.Fatal("se aceptó un nivel inválido")
+	}
+	if err := InitEn(os.Stdout, "verbose"); err == nil {
+		t.Fatal("se aceptó un LOG_LEVEL inválido")
+	}
+	if n := Niveles()[Kafka]; n != "INFO" {
+		t.Fatalf("nivel de kafka: %s", n)
+	}
+}
+
+// Cada línea lleva el subsistema, el actor, la traza y los atributos del lote agregados al context
+func TestCamposDelContexto(t *testing.T) {
+	buf := capturar(t, "INFO")
+	idTraza, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	idSpan, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: idTraza, SpanID: idSpan}))
+	ctx = context.WithValue(ctx, auth.ClaveActor, "USUARIO")
+	ctx = ConAtributos(ctx, slog.Uint64("lote", 7))
+	ctx = ConAtributos(ctx, slog.String("fuente", "http"))
+
+	L(Transferencias).With("IdTransferencia", "12").ErrorContext(ctx, "rechazada", Err(errors.New("saldo insuficiente")))
+	L("inexistente").Info("sin subsistema", Err(nil))
+
+	l := lineas(t, buf)
+	if len(l) != 2 {
+		t.Fatalf("se esperaban 2 líneas: %v", l)
+	}
+	esperados := map[string]any{
+		"level": "ERROR", "msg": "rechazada", "subsistema": Transferencias, "IdTransferencia": "12", "error": "saldo insuficiente",
+		"actor": "USUARIO", "trace_id": "4bf92f3577b34da6a3ce929d0e0e4736", "lote": float64(7), "fuente": "http",
+	}
+	for clave, valor := range esperados {
+		if l[0][clave] != valor {
+			t.Fatalf("%s: %v, se esperaba %v (%v)", clave, l[0][clave], valor, l[0])
+		}
+	}
+	// un subsistema inexistente loguea en app
+	if l[1]["subsistema"] != App || l[1]["error"] != "" {
+		t.Fatalf("línea de un subsistema inexistente: %v", l[1])
+	}
+}
+
+// Los mensajes del paquete log estándar (dependencias) se loguean en JSON en el subsistema app
+func TestLogEstandar(t *testing.T) {
+	buf := capturar(t, "INFO")
+
+	log.Printf("mensaje de una dependencia\n")
+
+	l := lineas(t, buf)
+	if len(l) != 1 || l[0]["subsistema"] != App || l[0]["level"] != "INFO" || l[0]["msg"] != "mensaje de una dependencia" {
+		t.Fatalf("líneas: %v", l)
+	}
+}
@@ -0,0 +1,118 @@
+package metricas
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Métricas del MS expuestas en GET /metrics (formato Prometheus) del listener interno METRICS_PORT.
+// Todas se registran en el registry por defecto de client_golang.
+
+var (
+	// Lotes procesados con éxito por el motor de ingesta, por fuente (kafka, http, carpeta)
+	LotesProcesados = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mstf_lotes_procesados_total",
+		Help: "Lotes procesados con éxito por el motor de ingesta.",
+	}, []string{"fuente"})
+
+	// Cantidad de mensajes por lote procesado
+	TamanoLote = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mstf_lote_tamano",
+		Help:    "Cantidad de mensajes por lote procesado.",
+		Buckets: []float64{1, 10, 50, 100, 250, 500, 1000, 2500, 5000, 8190},
+	}, []string{"fuente"})
+
+	// Transferencias procesadas por resultado (ok, rechazada) y motivo.
+	// El motivo de una rechazada es el error de preValidarCuentas/validarTransferencia o el código de TB.
+	Transferencias = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mstf_transferencias_total",
+		Help: "Transferencias procesadas por resultado y motivo.",
+	}, []string{"resultado", "motivo"})
+
+	// Latencia de las llamadas a TigerBeetle, por operación (CreateTransfers, LookupAccounts, etc.)
+	LatenciaTB = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mstf_tigerbeetle_latencia_segundos",
+		Help:    "Latencia de las llamadas a TigerBeetle por operación.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"operacion", "resultado"})
+
+	// Latencia del POST al webhook
+	LatenciaWebhook = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "mstf_webhook_latencia_segundos",
+		Help:    "Latencia de las notificaciones al webhook.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	})
+
+	// Notificaciones al webhook fallidas
+	FallasWebhook = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mstf_webhook_fallas_total",
+		Help: "Notificaciones al webhook que fallaron.",
+	})
+
+	// Intentos fallidos de procesar un lote, por fuente
+	ReintentosLote = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mstf_lote_reintentos_total",
+		Help: "Intentos fallidos de procesar un lote.",
+	}, []string{"fuente"})
+
+	// Backoff actual del lote que se está reintentando (0 = sin reintentos en curso), por fuente
+	BackoffReintento = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mstf_lote_backoff_segundos",
+		Help: "Backoff actual del lote que se está reintentando (0 si no hay reintentos en curso).",
+	}, []string{"fuente"})
+
+	// Requests HTTP por ruta de Echo (la plantilla, ej: /transferencias/:idtransferencia)
+	RequestsHTTP = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mstf_http_requests_total",
+		Help: "Requests HTTP por método, ruta y código de respuesta.",
+	}, []string{"metodo", "ruta", "codigo"})
+
+	LatenciaHTTP = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mstf_http_latencia_segundos",
+		Help:    "Latencia de las requests HTTP por método y ruta.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"metodo", "ruta"})
+
+	// Requests rechazadas con 429 por los límites de tasa, por límite (ip, apikey, sesion)
+	RequestsLimitadas = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mstf_http_requests_limitadas_total",
+		Help: "Requests HTTP rechazadas por límite de tasa.",
+	}, []string{"limite"})
+)
+
+// Caché con contadores de aciertos y fallos (ver cache.Cache.Estadisticas)
+type CacheMedible interface {
+	Estadisticas() (aciertos uint64, fallos uint64)
+}
+
+// Expone los aciertos y fallos de un caché como mstf_cache_accesos_total{cache, resultado}.
+// El hit ratio se calcula en la consulta: rate(aciertos) / rate(aciertos + fallos).
+func RegistrarCache(nombre string, c CacheMedible) {
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name:        "mstf_cache_accesos_total",
+		Help:        "Accesos a los cachés en memoria por resultado (acierto, fallo).",
+		ConstLabels: prometheus.Labels{"cache": nombre, "resultado": "acierto"},
+	}, func() float64 {
+		aciertos, _ := c.Estadisticas()
+		return float64(aciertos)
+	})
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name:        "mstf_cache_accesos_total",
+		Help:        "Accesos a los cachés en memoria por resultado (acierto, fallo).",
+		ConstLabels: prometheus.Labels{"cache": nombre, "resultado": "fallo"},
+	}, func() float64 {
+		_, fallos := c.Estadisticas()
+		return float64(fallos)
+	})
+}
+
+// Registra la duración de una llamada a TB desde inicio
+func ObservarTB(operacion string, inicio time.Time, err error) {
+	resultado := "ok"
+	if err != nil {
+		resultado = "error"
+	}
+	LatenciaTB.WithLabelValues(operacion, resultado).Observe(time.Since(inicio).Seconds())
+}
@@ -0,0 +1,41 @@
+package metricas
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type cacheFijo struct{ aciertos, fallos uint64 }
+
+func (c cacheFijo) Estadisticas() (uint64, uint64) {
+	return c.aciertos, c.fallos
+}
+
+func TestRegistrarCache(t *testing.T) {
+	RegistrarCache("prueba", cacheFijo{aciertos: 7, fallos: 3})
+
+	esperado := `
+# HELP mstf_cache_accesos_total Accesos a los cachés en memoria por resultado (acierto, fallo).
+# TYPE mstf_cache_accesos_total counter
+mstf_cache_accesos_total{cache="prueba",resultado="acierto"} 7
+mstf_cache_accesos_total{cache="prueba",resultado="fallo"} 3
+`
+	if err := testutil.GatherAndCompare(prometheus.DefaultGatherer, strings.NewReader(esperado), "mstf_cache_accesos_total"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Cada llamada a TB se observa con su operación y resultado
+func TestObservarTB(t *testing.T) {
+	antes := testutil.CollectAndCount(LatenciaTB)
+	ObservarTB("LookupAccounts", time.Now(), nil)
+	ObservarTB("LookupAccounts", time.Now(), errors.New("caído"))
+	if n := testutil.CollectAndCount(LatenciaTB) - antes; n != 2 {
+		t.Fatalf("series nuevas: %d, se esperaban 2 (ok y error)", n)
+	}
+}
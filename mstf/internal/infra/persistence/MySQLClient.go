@@ -2,18 +2,23 @@ package persistence
 
 import (
 	"MSTransaccionesFinancieras/internal/config"
+	"MSTransaccionesFinancieras/internal/infra/fallas"
+	"MSTransaccionesFinancieras/internal/infra/logs"
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
-	"log"
+	"strings"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/XSAM/otelsql"
+	"github.com/go-sql-driver/mysql"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var ClienteMySQL *sql.DB
 
 func InitMySQLClient(cfg config.Config) error {
-	var err error
-
 	// DSN: user:password@tcp(host:port)/database?parseTime=true
 	sqlConfig := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true",
 		cfg.MySQLUser,
@@ -23,25 +28,68 @@ func InitMySQLClient(cfg config.Config) error {
 		cfg.MySQLDatabase,
 	)
 
-	ClienteMySQL, err = sql.Open("mysql", sqlConfig)
+	mysqlConfig, err := mysql.ParseDSN(sqlConfig)
+	if err != nil {
+		logs.L(logs.Persistencia).Error("configuración de MySQL inválida", logs.Err(err))
+		return err
+	}
+	conector, err := mysql.NewConnector(mysqlConfig)
 	if err != nil {
-		log.Printf("Error al crear cliente de MySQL: %v", err)
+		logs.L(logs.Persistencia).Error("error al crear el cliente de MySQL", logs.Err(err))
 		return err
 	}
+	if cfg.InyeccionFallas {
+		conector = fallas.EnvolverConector(conector)
+	}
+
+	ClienteMySQL = abrirMySQL(conector)
 
 	// Verificar conexión
 	if err = ClienteMySQL.Ping(); err != nil {
-		log.Printf("Error al conectar a MySQL: %v", err)
+		logs.L(logs.Persistencia).Error("error al conectar a MySQL", logs.Err(err))
 		return err
 	}
 
-	//log.Printf("Conexión a MySQL establecida (%s:%d/%s)", cfg.MySQLHost, cfg.MySQLPort, cfg.MySQLDatabase)
+	logs.L(logs.Persistencia).Debug("conexión a MySQL establecida", "host", cfg.MySQLHost, "puerto", cfg.MySQLPort, "base", cfg.MySQLDatabase)
 	return nil
 }
 
+// otelsql registra un span por cada llamada (los SP se identifican por nombre, ver nombreSpanMySQL)
+func abrirMySQL(conector driver.Connector) *sql.DB {
+	return otelsql.OpenDB(conector,
+		otelsql.WithAttributes(attribute.String("db.system.name", "mysql")),
+		otelsql.WithSpanNameFormatter(nombreSpanMySQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitConnPrepare:      true,
+			OmitRows:             true,
+		}),
+	)
+}
+
+// Nombre del span de una llamada a MySQL: "mysql tsp_xxx" para los SP, el método en otro caso
+func nombreSpanMySQL(_ context.Context, metodo otelsql.Method, query string) string {
+	if sp, ok := strings.CutPrefix(strings.TrimSpace(query), "CALL "); ok {
+		if i := strings.IndexByte(sp, '('); i > 0 {
+			sp = sp[:i]
+		}
+		return "mysql " + strings.TrimSpace(sp)
+	}
+	return string(metodo)
+}
+
+// Verifica la conexión a MySQL (otelsql no registra spans de Ping)
+func VerificarMySQL(ctx context.Context) error {
+	if ClienteMySQL == nil {
+		return errors.New("cliente de MySQL no inicializado")
+	}
+	return ClienteMySQL.PingContext(ctx)
+}
+
 func CloseMySQLClient() {
 	if ClienteMySQL != nil {
 		ClienteMySQL.Close()
-		//log.Println("Conexión a MySQL cerrada")
+		logs.L(logs.Persistencia).Debug("conexión a MySQL cerrada")
 	}
 }
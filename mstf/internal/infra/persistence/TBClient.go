@@ -2,26 +2,61 @@ package persistence
 
 import (
 	"MSTransaccionesFinancieras/internal/config"
-	"log"
+	"MSTransaccionesFinancieras/internal/infra/fallas"
+	"MSTransaccionesFinancieras/internal/infra/logs"
+	"context"
+	"errors"
+	"fmt"
 
 	tigerbeetle "github.com/tigerbeetle/tigerbeetle-go"
 	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
 )
 
-// instancia global de cliente de TB
+// Cliente de TB del proceso (instrumentado). Solo lo lee main, que lo inyecta en los gestores y el motor
+// de ingesta igual que los repositorios.
 var ClienteTB tigerbeetle.Client
 
 func InitTBClient(cfg config.Config) error {
-	var err error
-
-	ClienteTB, err = tigerbeetle.NewClient(types.ToUint128(0), cfg.DireccionesTigerBeetle)
+	cliente, err := tigerbeetle.NewClient(types.ToUint128(0), cfg.DireccionesTigerBeetle)
 	if err != nil {
-		log.Printf("Error al crear cliente de TigerBeetle: %v", err)
+		logs.L(logs.Persistencia).Error("error al crear el cliente de TigerBeetle", logs.Err(err))
 		return err
 	}
+	if cfg.InyeccionFallas {
+		cliente = fallas.EnvolverTB(cliente)
+	}
+	ClienteTB = InstrumentarTB(cliente)
 	return nil
 }
 
+// Envuelve un cliente de TB (p. ej. tbmemoria.Cliente en tests) con la instrumentación de métricas y trazas
+func InstrumentarTB(cliente tigerbeetle.Client) tigerbeetle.Client {
+	return clienteTBInstrumentado{Client: cliente, ctx: context.Background()}
+}
+
+// Verifica que el cluster de TB responda con una consulta mínima (una cuenta inexistente).
+// Se usa el cliente sin instrumentar para que los health checks no aparezcan en métricas ni trazas.
+func VerificarTB(ctx context.Context, cliente tigerbeetle.Client) error {
+	if c, ok := cliente.(clienteTBInstrumentado); ok {
+		cliente = c.Client
+	}
+	if cliente == nil {
+		return errors.New("cliente de TigerBeetle no inicializado")
+	}
+	// el cliente de TB no recibe context: la consulta queda corriendo si vence el timeout
+	resultado := make(chan error, 1)
+	go func() {
+		_, err := cliente.LookupAccounts([]types.Uint128{types.ToUint128(1)})
+		resultado <- err
+	}()
+	select {
+	case err := <-resultado:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("TigerBeetle no respondió: %w", ctx.Err())
+	}
+}
+
 func CloseTBClient() {
 	if ClienteTB != nil {
 		ClienteTB.Close()
@@ -0,0 +1,89 @@
+package persistence
+
+import (
+	"MSTransaccionesFinancieras/internal/infra/metricas"
+	"MSTransaccionesFinancieras/internal/infra/trazas"
+	"context"
+	"time"
+
+	tigerbeetle "github.com/tigerbeetle/tigerbeetle-go"
+	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Decorador del cliente de TB: registra la latencia de cada operación en mstf_tigerbeetle_latencia_segundos
+// y un span por llamada. El cliente de TB no recibe context, así que el span cuelga de ctx
+// (ver TB) o es raíz si se usa el cliente directamente.
+type clienteTBInstrumentado struct {
+	tigerbeetle.Client
+	ctx context.Context
+}
+
+// Cliente de TB cuyos spans quedan dentro de la traza de ctx
+func TB(ctx context.Context, cliente tigerbeetle.Client) tigerbeetle.Client {
+	if c, ok := cliente.(clienteTBInstrumentado); ok {
+		c.ctx = ctx
+		return c
+	}
+	return cliente
+}
+
+func llamarTB[T any](c clienteTBInstrumentado, operacion string, cantidad int, f func() (T, error)) (T, error) {
+	_, span := trazas.Tracer().Start(c.ctx, "tigerbeetle."+operacion,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system.name", "tigerbeetle"), attribute.Int("tigerbeetle.cantidad", cantidad)))
+	inicio := time.Now()
+	r, err := f()
+	metricas.ObservarTB(operacion, inicio, err)
+	trazas.Finalizar(span, err)
+	return r, err
+}
+
+func (c clienteTBInstrumentado) CreateAccounts(accounts []types.Account) ([]types.AccountEventResult, error) {
+	return llamarTB(c, "CreateAccounts", len(accounts), func() ([]types.AccountEventResult, error) {
+		return c.Client.CreateAccounts(accounts)
+	})
+}
+
+func (c clienteTBInstrumentado) CreateTransfers(transfers []types.Transfer) ([]types.TransferEventResult, error) {
+	return llamarTB(c, "CreateTransfers", len(transfers), func() ([]types.TransferEventResult, error) {
+		return c.Client.CreateTransfers(transfers)
+	})
+}
+
+func (c clienteTBInstrumentado) LookupAccounts(accountIDs []types.Uint128) ([]types.Account, error) {
+	return llamarTB(c, "LookupAccounts", len(accountIDs), func() ([]types.Account, error) {
+		return c.Client.LookupAccounts(accountIDs)
+	})
+}
+
+func (c clienteTBInstrumentado) LookupTransfers(transferIDs []types.Uint128) ([]types.Transfer, error) {
+	return llamarTB(c, "LookupTransfers", len(transferIDs), func() ([]types.Transfer, error) {
+		return c.Client.LookupTransfers(transferIDs)
+	})
+}
+
+func (c clienteTBInstrumentado) GetAccountTransfers(filter types.AccountFilter) ([]types.Transfer, error) {
+	return llamarTB(c, "GetAccountTransfers", 1, func() ([]types.Transfer, error) {
+		return c.Client.GetAccountTransfers(filter)
+	})
+}
+
+func (c clienteTBInstrumentado) GetAccountBalances(filter types.AccountFilter) ([]types.AccountBalance, error) {
+	return llamarTB(c, "GetAccountBalances", 1, func() ([]types.AccountBalance, error) {
+		return c.Client.GetAccountBalances(filter)
+	})
+}
+
+func (c clienteTBInstrumentado) QueryAccounts(filter types.QueryFilter) ([]types.Account, error) {
+	return llamarTB(c, "QueryAccounts", 1, func() ([]types.Account, error) {
+		return c.Client.QueryAccounts(filter)
+	})
+}
+
+func (c clienteTBInstrumentado) QueryTransfers(filter types.QueryFilter) ([]types.Transfer, error) {
+	return llamarTB(c, "QueryTransfers", 1, func() ([]types.Transfer, error) {
+		return c.Client.QueryTransfers(filter)
+	})
+}
@@ -0,0 +1,163 @@
+package persistence
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/config"
+	"MSTransaccionesFinancieras/internal/infra/fallas"
+	"MSTransaccionesFinancieras/internal/infra/tbmemoria"
+	"MSTransaccionesFinancieras/internal/infra/trazas"
+
+	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Registra en memoria los spans del test y vuelve al provider no-op al terminar
+func grabarSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	if _, err := trazas.Init(config.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	grabador := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(grabador)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	return grabador
+}
+
+// Span terminado con el nombre dado. Falla el test si no hay exactamente uno.
+func spanTerminado(t *testing.T, grabador *tracetest.SpanRecorder, nombre string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	var encontrados []sdktrace.ReadOnlySpan
+	for _, s := range grabador.Ended() {
+		if s.Name() == nombre {
+			encontrados = append(encontrados, s)
+		}
+	}
+	if len(encontrados) != 1 {
+		t.Fatalf("%d spans %q, se esperaba 1", len(encontrados), nombre)
+	}
+	return encontrados[0]
+}
+
+func atributo(s sdktrace.ReadOnlySpan, clave attribute.Key) attribute.Value {
+	for _, a := range s.Attributes() {
+		if a.Key == clave {
+			return a.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+// Cada llamada a TB es un span hijo del de la operación que la hizo, marcado con error si falla
+func TestTrazasTB(t *testing.T) {
+	grabador := grabarSpans(t)
+	if err := fallas.Init(config.Config{InyeccionFallas: true}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(fallas.Limpiar)
+	cliente := InstrumentarTB(fallas.EnvolverTB(tbmemoria.New()))
+
+	ctx, padre := trazas.Tracer().Start(context.Background(), "operacion")
+	if _, err := TB(ctx, cliente).LookupAccounts([]types.Uint128{types.ToUint128(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fallas.Configurar(fallas.TigerBeetle, fallas.Regla{Modo: fallas.ModoError, Operaciones: []string{"CreateTransfers"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TB(ctx, cliente).CreateTransfers([]types.Transfer{{}}); err == nil {
+		t.Fatal("CreateTransfers debía fallar")
+	}
+	padre.End()
+
+	lookup := spanTerminado(t, grabador, "tigerbeetle.LookupAccounts")
+	if lookup.Parent().SpanID() != padre.SpanContext().SpanID() || lookup.SpanKind() != trace.SpanKindClient {
+		t.Fatalf("span de LookupAccounts fuera de la operación: padre %s, kind %s", lookup.Parent().SpanID(), lookup.SpanKind())
+	}
+	if v := atributo(lookup, "db.system.name").AsString(); v != "tigerbeetle" || atributo(lookup, "tigerbeetle.cantidad").AsInt64() != 1 {
+		t.Fatalf("atributos de LookupAccounts: %v", lookup.Attributes())
+	}
+	if lookup.Status().Code == codes.Error {
+		t.Fatal("LookupAccounts marcado con error")
+	}
+	if create := spanTerminado(t, grabador, "tigerbeetle.CreateTransfers"); create.Status().Code != codes.Error {
+		t.Fatalf("CreateTransfers fallido sin error en el span: %v", create.Status())
+	}
+
+	// el cliente sin context de operación genera spans raíz
+	if _, err := cliente.LookupAccounts([]types.Uint128{types.ToUint128(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if ended := grabador.Ended(); ended[len(ended)-1].Parent().IsValid() {
+		t.Fatal("el span sin context de operación tiene padre")
+	}
+}
+
+// Conexión de MySQL que responde cualquier consulta con una fila "OK"
+type conectorFalso struct{}
+
+func (conectorFalso) Connect(context.Context) (driver.Conn, error) { return conexionFalsa{}, nil }
+func (conectorFalso) Driver() driver.Driver                        { return nil }
+
+type conexionFalsa struct{}
+
+func (conexionFalsa) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (conexionFalsa) Close() error                        { return nil }
+func (conexionFalsa) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+func (conexionFalsa) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return &filasFalsas{}, nil
+}
+
+type filasFalsas struct{ leida bool }
+
+func (f *filasFalsas) Columns() []string { return []string{"Mensaje"} }
+func (f *filasFalsas) Close() error      { return nil }
+func (f *filasFalsas) Next(dest []driver.Value) error {
+	if f.leida {
+		return io.EOF
+	}
+	f.leida = true
+	dest[0] = "OK"
+	return nil
+}
+
+// Cada llamada a un SP es un span hijo de la operación, con el nombre del SP
+func TestTrazasMySQL(t *testing.T) {
+	grabador := grabarSpans(t)
+	db := abrirMySQL(conectorFalso{})
+	defer db.Close()
+
+	ctx, padre := trazas.Tracer().Start(context.Background(), "operacion")
+	var mensaje string
+	if err := db.QueryRowContext(ctx, "CALL tsp_dame_parametro(?)", "MONTOMAXTRANSFER").Scan(&mensaje); err != nil || mensaje != "OK" {
+		t.Fatalf("CALL: %q %v", mensaje, err)
+	}
+	padre.End()
+
+	sp := spanTerminado(t, grabador, "mysql tsp_dame_parametro")
+	if sp.Parent().SpanID() != padre.SpanContext().SpanID() || atributo(sp, "db.system.name").AsString() != "mysql" {
+		t.Fatalf("span del SP: padre %s, atributos %v", sp.Parent().SpanID(), sp.Attributes())
+	}
+}
+
+func TestNombreSpanMySQL(t *testing.T) {
+	casos := map[string]string{
+		"CALL tsp_dame_parametro(?)":  "mysql tsp_dame_parametro",
+		"  CALL tsp_listar_monedas()": "mysql tsp_listar_monedas",
+		"SELECT 1":                    "sql.conn.query",
+	}
+	for query, esperado := range casos {
+		if n := nombreSpanMySQL(context.Background(), "sql.conn.query", query); n != esperado {
+			t.Errorf("%q: %q, se esperaba %q", query, n, esperado)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package tbmemoria
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"sync"
+	"time"
+
+	tigerbeetle "github.com/tigerbeetle/tigerbeetle-go"
+	tberrors "github.com/tigerbeetle/tigerbeetle-go/pkg/errors"
+	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+)
+
+// Implementación en memoria de tigerbeetle.Client para tests herméticos (ver persistence.InstrumentarTB).
+// Reproduce la semántica de TB 0.16 que usa el MS: validaciones y códigos de resultado de CreateAccounts y
+// CreateTransfers, eventos encadenados (Linked), transferencias pendientes con post/void y timeout,
+// flags de cierre (ClosingDebit/ClosingCredit), límites de saldo, historial de balances (flag History),
+// IDs que fallaron con un error transitorio (TransferIDAlreadyFailed) y las consultas por filtro.
+// No soporta eventos importados ni GetChangeEvents.
+type Cliente struct {
+	mu      sync.Mutex
+	cerrado bool
+	reloj   func() time.Time
+	// último timestamp asignado: TB asigna timestamps únicos y crecientes a cada evento
+	ultimoTimestamp uint64
+
+	cuentas        map[types.Uint128]*types.Account
+	ordenCuentas   []*types.Account // por timestamp
+	transferencias map[types.Uint128]*types.Transfer
+	ordenTransfers []*types.Transfer // por timestamp
+	pendientes     map[types.Uint128]*pendiente
+	// IDs de transferencias rechazadas con un error transitorio: no se pueden reutilizar
+	fallidas map[types.Uint128]struct{}
+	// balances de las cuentas con flag History después de cada transferencia que las afectó
+	historial map[types.Uint128][]saldoHistorico
+
+	// acciones para revertir los cambios de la cadena de eventos en curso (ver procesarEventos)
+	deshacer []func()
+}
+
+// Tamaño máximo de un batch en TB
+const maxBatch = 8189
+
+type estadoPendiente int
+
+const (
+	pendienteAbierta estadoPendiente = iota
+	pendientePosteada
+	pendienteAnulada
+	pendienteExpirada
+)
+
+type pendiente struct {
+	transfer *types.Transfer
+	estado   estadoPendiente
+	vence    uint64 // timestamp (ns) de expiración, 0 = sin timeout
+}
+
+type saldoHistorico struct {
+	saldo    types.AccountBalance
+	transfer *types.Transfer
+}
+
+var _ tigerbeetle.Client = (*Cliente)(nil)
+
+func New() *Cliente {
+	return NewConReloj(time.Now)
+}
+
+// Cliente cuyo reloj (timestamps y expiración de pendientes) lo controla el test
+func NewConReloj(reloj func() time.Time) *Cliente {
+	return &Cliente{
+		reloj:          reloj,
+		cuentas:        make(map[types.Uint128]*types.Account),
+		transferencias: make(map[types.Uint128]*types.Transfer),
+		pendientes:     make(map[types.Uint128]*pendiente),
+		fallidas:       make(map[types.Uint128]struct{}),
+		historial:      make(map[types.Uint128][]saldoHistorico),
+	}
+}
+
+func (c *Cliente) Nop() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cerrado {
+		return tberrors.ErrClientClosed{}
+	}
+	return nil
+}
+
+func (c *Cliente) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cerrado = true
+}
+
+func (c *Cliente) GetChangeEvents(filter types.ChangeEventsFilter) ([]types.ChangeEvent, error) {
+	return nil, tberrors.ErrInvalidOperation{}
+}
+
+// Controles comunes a todas las operaciones. Se llama con c.mu tomado.
+func (c *Cliente) verificar(cantidad int) error {
+	if c.cerrado {
+		return tberrors.ErrClientClosed{}
+	}
+	if cantidad > maxBatch {
+		return tberrors.ErrMaximumBatchSizeExceeded{}
+	}
+	c.expirarPendientes()
+	return nil
+}
+
+func (c *Cliente) siguienteTimestamp() uint64 {
+	ts := uint64(c.reloj().UnixNano())
+	if ts <= c.ultimoTimestamp {
+		ts = c.ultimoTimestamp + 1
+	}
+	c.ultimoTimestamp = ts
+	return ts
+}
+
+// --------------------------------------------------------------------------------
+// Eventos encadenados
+// --------------------------------------------------------------------------------
+
+// Códigos comunes a CreateAccountResult y CreateTransferResult
+const (
+	resultadoOK            = 0
+	resultadoCadenaFallida = 1 // LinkedEventFailed
+	resultadoCadenaAbierta = 2 // LinkedEventChainOpen
+)
+
+// Aplica n eventos respetando las cadenas de TB: los eventos con flag Linked forman una cadena con el
+// siguiente, y la cadena se aplica completa o no se aplica. Si un evento de la cadena falla se revierten
+// los anteriores; el evento que falló informa su error y el resto LinkedEventFailed. Una cadena que no
+// termina en el último evento del batch falla con LinkedEventChainOpen.
+// Retorna solo los resultados distintos de OK, en orden de índice (igual que TB).
+func (c *Cliente) procesarEventos(n int, enlazado func(i int) bool, aplicar func(i int) uint32) []resultadoEvento {
+	var resultados []resultadoEvento
+	for inicio := 0; inicio < n; {
+		fin := inicio
+		for fin < n-1 && enlazado(fin) {
+			fin++
+		}
+		abierta := enlazado(fin)
+
+		c.deshacer = c.deshacer[:0]
+		fallo, codigo := -1, uint32(resultadoOK)
+		for i := inicio; i <= fin; i++ {
+			if abierta && i == fin {
+				codigo = resultadoCadenaAbierta
+			} else {
+				codigo = aplicar(i)
+			}
+			if codigo != resultadoOK {
+				fallo = i
+				break
+			}
+		}
+		if fallo >= 0 {
+			for i := len(c.deshacer) - 1; i >= 0; i-- {
+				c.deshacer[i]()
+			}
+			for i := inicio; i <= fin; i++ {
+				if i == fallo {
+					resultados = append(resultados, resultadoEvento{indice: uint32(i), codigo: codigo})
+				} else {
+					resultados = append(resultados, resultadoEvento{indice: uint32(i), codigo: resultadoCadenaFallida})
+				}
+			}
+		}
+		c.deshacer = c.deshacer[:0]
+		inicio = fin + 1
+	}
+	return resultados
+}
+
+type resultadoEvento struct {
+	indice uint32
+	codigo uint32
+}
+
+// Guarda el estado actual de la cuenta para poder revertir la cadena en curso
+func (c *Cliente) registrarCuenta(a *types.Account) {
+	anterior := *a
+	c.deshacer = append(c.deshacer, func() { *a = anterior })
+}
+
+// --------------------------------------------------------------------------------
+// Aritmética de Uint128 (little endian, igual que TB)
+// --------------------------------------------------------------------------------
+
+type u128 struct {
+	lo, hi uint64
+}
+
+var maxU128 = u128{lo: ^uint64(0), hi: ^uint64(0)}
+
+func aU128(v types.Uint128) u128 {
+	return u128{lo: binary.LittleEndian.Uint64(v[:8]), hi: binary.LittleEndian.Uint64(v[8:])}
+}
+
+func (a u128) tb() types.Uint128 {
+	var v types.Uint128
+	binary.LittleEndian.PutUint64(v[:8], a.lo)
+	binary.LittleEndian.PutUint64(v[8:], a.hi)
+	return v
+}
+
+// Suma con detección de overflow
+func (a u128) sumar(b u128) (u128, bool) {
+	lo, carry := bits.Add64(a.lo, b.lo, 0)
+	hi, overflow := bits.Add64(a.hi, b.hi, carry)
+	return u128{lo: lo, hi: hi}, overflow != 0
+}
+
+// Resta saturada en cero
+func (a u128) restar(b u128) u128 {
+	if a.comparar(b) <= 0 {
+		return u128{}
+	}
+	lo, borrow := bits.Sub64(a.lo, b.lo, 0)
+	hi, _ := bits.Sub64(a.hi, b.hi, borrow)
+	return u128{lo: lo, hi: hi}
+}
+
+func (a u128) comparar(b u128) int {
+	switch {
+	case a.hi != b.hi:
+		if a.hi < b.hi {
+			return -1
+		}
+		return 1
+	case a.lo != b.lo:
+		if a.lo < b.lo {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+func (a u128) esCero() bool {
+	return a.lo == 0 && a.hi == 0
+}
+
+func esCero(v types.Uint128) bool {
+	return aU128(v).esCero()
+}
+
+func esMaximo(v types.Uint128) bool {
+	return aU128(v) == maxU128
+}
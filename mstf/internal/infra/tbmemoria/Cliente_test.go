@@ -0,0 +1,219 @@
+package tbmemoria
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+)
+
+func cuenta(id uint64, flags types.AccountFlags) types.Account {
+	return types.Account{ID: types.ToUint128(id), Ledger: 1, Code: 1, Flags: flags.ToUint16()}
+}
+
+func transfer(id uint64, debito uint64, credito uint64, monto uint64, flags types.TransferFlags) types.Transfer {
+	return types.Transfer{
+		ID:              types.ToUint128(id),
+		DebitAccountID:  types.ToUint128(debito),
+		CreditAccountID: types.ToUint128(credito),
+		Amount:          types.ToUint128(monto),
+		Ledger:          1,
+		Code:            1,
+		Flags:           flags.ToUint16(),
+	}
+}
+
+func crearCuentas(t *testing.T, c *Cliente, cuentas ...types.Account) {
+	t.Helper()
+	r, err := c.CreateAccounts(cuentas)
+	if err != nil || len(r) > 0 {
+		t.Fatalf("CreateAccounts: %v %v", r, err)
+	}
+}
+
+func saldo(t *testing.T, c *Cliente, id uint64) types.Account {
+	t.Helper()
+	a, err := c.LookupAccounts([]types.Uint128{types.ToUint128(id)})
+	if err != nil || len(a) != 1 {
+		t.Fatalf("LookupAccounts(%d): %v %v", id, a, err)
+	}
+	return a[0]
+}
+
+func TestCrearCuentas(t *testing.T) {
+	c := New()
+	crearCuentas(t, c, cuenta(1, types.AccountFlags{}))
+
+	r, _ := c.CreateAccounts([]types.Account{
+		cuenta(1, types.AccountFlags{}),
+		cuenta(1, types.AccountFlags{History: true}),
+		{ID: types.ToUint128(2), Code: 1},
+		cuenta(3, types.AccountFlags{DebitsMustNotExceedCredits: true, CreditsMustNotExceedDebits: true}),
+	})
+	esperados := []types.CreateAccountResult{
+		types.AccountExists,
+		types.AccountExistsWithDifferentFlags,
+		types.AccountLedgerMustNotBeZero,
+		types.AccountFlagsAreMutuallyExclusive,
+	}
+	if len(r) != len(esperados) {
+		t.Fatalf("resultados: %v", r)
+	}
+	for i, e := range esperados {
+		if r[i].Index != uint32(i) || r[i].Result != e {
+			t.Errorf("evento %d: %v, se esperaba %v", i, r[i].Result, e)
+		}
+	}
+}
+
+func TestCadenaEnlazadaSeRevierte(t *testing.T) {
+	c := New()
+	crearCuentas(t, c, cuenta(1, types.AccountFlags{}), cuenta(2, types.AccountFlags{}))
+
+	r, _ := c.CreateTransfers([]types.Transfer{
+		transfer(10, 1, 2, 100, types.TransferFlags{Linked: true}),
+		transfer(11, 1, 3, 100, types.TransferFlags{}),
+		transfer(12, 1, 2, 5, types.TransferFlags{}),
+	})
+	if len(r) != 2 || r[0].Result != types.TransferLinkedEventFailed || r[1].Result != types.TransferCreditAccountNotFound {
+		t.Fatalf("resultados: %v", r)
+	}
+	if got := saldo(t, c, 1).DebitsPosted; got != types.ToUint128(5) {
+		t.Errorf("DebitsPosted = %v, se esperaba solo la transferencia fuera de la cadena", got)
+	}
+	if tr, _ := c.LookupTransfers([]types.Uint128{types.ToUint128(10)}); len(tr) != 0 {
+		t.Error("la transferencia revertida de la cadena no debe existir")
+	}
+
+	// el error transitorio impide reutilizar el ID aunque la cuenta exista después
+	crearCuentas(t, c, cuenta(3, types.AccountFlags{}))
+	r, _ = c.CreateTransfers([]types.Transfer{transfer(11, 1, 3, 100, types.TransferFlags{})})
+	if len(r) != 1 || r[0].Result != types.TransferIDAlreadyFailed {
+		t.Fatalf("reintento: %v", r)
+	}
+
+	r, _ = c.CreateTransfers([]types.Transfer{transfer(13, 1, 2, 1, types.TransferFlags{Linked: true})})
+	if len(r) != 1 || r[0].Result != types.TransferLinkedEventChainOpen {
+		t.Fatalf("cadena abierta: %v", r)
+	}
+}
+
+func TestLimitesDeSaldo(t *testing.T) {
+	c := New()
+	crearCuentas(t, c, cuenta(1, types.AccountFlags{}), cuenta(2, types.AccountFlags{DebitsMustNotExceedCredits: true}))
+	r, _ := c.CreateTransfers([]types.Transfer{
+		transfer(10, 1, 2, 100, types.TransferFlags{}),
+		transfer(11, 2, 1, 150, types.TransferFlags{}),
+		transfer(12, 2, 1, 150, types.TransferFlags{BalancingDebit: true}),
+	})
+	if len(r) != 1 || r[0].Index != 1 || r[0].Result != types.TransferExceedsCredits {
+		t.Fatalf("resultados: %v", r)
+	}
+	tr, _ := c.LookupTransfers([]types.Uint128{types.ToUint128(12)})
+	if len(tr) != 1 || tr[0].Amount != types.ToUint128(100) {
+		t.Fatalf("la transferencia de balanceo debe ajustarse al saldo: %v", tr)
+	}
+}
+
+func TestPendientes(t *testing.T) {
+	ahora := time.Unix(1_700_000_000, 0)
+	c := NewConReloj(func() time.Time { return ahora })
+	crearCuentas(t, c, cuenta(1, types.AccountFlags{}), cuenta(2, types.AccountFlags{History: true}))
+
+	r, _ := c.CreateTransfers([]types.Transfer{
+		transfer(10, 1, 2, 100, types.TransferFlags{Pending: true}),
+		transfer(11, 1, 2, 50, types.TransferFlags{Pending: true}),
+		{ID: types.ToUint128(12), PendingID: types.ToUint128(10), Amount: types.ToUint128(60), Flags: types.TransferFlags{PostPendingTransfer: true}.ToUint16()},
+		{ID: types.ToUint128(13), PendingID: types.ToUint128(11), Flags: types.TransferFlags{VoidPendingTransfer: true}.ToUint16()},
+		{ID: types.ToUint128(14), PendingID: types.ToUint128(10), Flags: types.TransferFlags{VoidPendingTransfer: true}.ToUint16()},
+	})
+	if len(r) != 1 || r[0].Index != 4 || r[0].Result != types.TransferPendingTransferAlreadyPosted {
+		t.Fatalf("resultados: %v", r)
+	}
+	a := saldo(t, c, 2)
+	if a.CreditsPosted != types.ToUint128(60) || a.CreditsPending != types.ToUint128(0) {
+		t.Fatalf("saldo: %+v", a)
+	}
+
+	// timeout: la pendiente expira al avanzar el reloj
+	p := transfer(20, 1, 2, 30, types.TransferFlags{Pending: true})
+	p.Timeout = 10
+	if r, _ := c.CreateTransfers([]types.Transfer{p}); len(r) != 0 {
+		t.Fatalf("pendiente con timeout: %v", r)
+	}
+	ahora = ahora.Add(11 * time.Second)
+	r, _ = c.CreateTransfers([]types.Transfer{{ID: types.ToUint128(21), PendingID: types.ToUint128(20), Amount: types.ToUint128(30), Flags: types.TransferFlags{PostPendingTransfer: true}.ToUint16()}})
+	if len(r) != 1 || r[0].Result != types.TransferPendingTransferExpired {
+		t.Fatalf("post de pendiente expirada: %v", r)
+	}
+	if a := saldo(t, c, 2); a.CreditsPending != types.ToUint128(0) {
+		t.Fatalf("la pendiente expirada debe liberar el saldo: %+v", a)
+	}
+
+	// historial: un balance por cada transferencia que afectó a la cuenta con History
+	balances, _ := c.GetAccountBalances(types.AccountFilter{AccountID: types.ToUint128(2), Limit: 10, Flags: types.AccountFilterFlags{Debits: true, Credits: true}.ToUint32()})
+	if len(balances) != 5 {
+		t.Fatalf("historial: %d balances, se esperaban 5", len(balances))
+	}
+}
+
+func TestCierreDeCuenta(t *testing.T) {
+	c := New()
+	crearCuentas(t, c, cuenta(1, types.AccountFlags{}), cuenta(2, types.AccountFlags{}))
+
+	r, _ := c.CreateTransfers([]types.Transfer{
+		transfer(10, 1, 2, 0, types.TransferFlags{ClosingDebit: true}),
+		transfer(11, 1, 2, 0, types.TransferFlags{Pending: true, ClosingDebit: true}),
+		transfer(12, 1, 2, 5, types.TransferFlags{}),
+	})
+	if len(r) != 2 || r[0].Result != types.TransferClosingTransferMustBePending || r[1].Result != types.TransferDebitAccountAlreadyClosed {
+		t.Fatalf("resultados: %v", r)
+	}
+	if !saldo(t, c, 1).AccountFlags().Closed {
+		t.Fatal("la cuenta débito debe quedar cerrada")
+	}
+
+	r, _ = c.CreateTransfers([]types.Transfer{
+		{ID: types.ToUint128(13), PendingID: types.ToUint128(11), Flags: types.TransferFlags{VoidPendingTransfer: true}.ToUint16()},
+		transfer(14, 1, 2, 5, types.TransferFlags{}),
+	})
+	if len(r) != 0 {
+		t.Fatalf("reapertura: %v", r)
+	}
+	if saldo(t, c, 1).AccountFlags().Closed {
+		t.Fatal("anular la pendiente de cierre debe reabrir la cuenta")
+	}
+}
+
+func TestConsultas(t *testing.T) {
+	c := New()
+	crearCuentas(t, c, cuenta(1, types.AccountFlags{}), cuenta(2, types.AccountFlags{}), cuenta(3, types.AccountFlags{}))
+	for i := uint64(0); i < 5; i++ {
+		tr := transfer(10+i, 1, 2+i%2, 1, types.TransferFlags{})
+		tr.UserData64 = i % 2
+		if r, _ := c.CreateTransfers([]types.Transfer{tr}); len(r) != 0 {
+			t.Fatalf("transfer %d: %v", i, r)
+		}
+	}
+
+	todas, _ := c.GetAccountTransfers(types.AccountFilter{AccountID: types.ToUint128(1), Limit: 10, Flags: types.AccountFilterFlags{Debits: true, Reversed: true}.ToUint32()})
+	if len(todas) != 5 || todas[0].ID != types.ToUint128(14) {
+		t.Fatalf("GetAccountTransfers: %v", todas)
+	}
+	creditos, _ := c.GetAccountTransfers(types.AccountFilter{AccountID: types.ToUint128(3), Limit: 10, Flags: types.AccountFilterFlags{Credits: true}.ToUint32()})
+	if len(creditos) != 2 {
+		t.Fatalf("GetAccountTransfers créditos: %d", len(creditos))
+	}
+	pagina, _ := c.QueryTransfers(types.QueryFilter{UserData64: 1, Limit: 1, TimestampMin: todas[2].Timestamp})
+	if len(pagina) != 1 || pagina[0].ID != types.ToUint128(13) {
+		t.Fatalf("QueryTransfers: %v", pagina)
+	}
+	if vacio, _ := c.QueryAccounts(types.QueryFilter{Ledger: 1}); len(vacio) != 0 {
+		t.Fatalf("Limit 0 no debe devolver resultados: %v", vacio)
+	}
+
+	c.Close()
+	if _, err := c.LookupAccounts(nil); err == nil {
+		t.Fatal("un cliente cerrado debe fallar")
+	}
+}
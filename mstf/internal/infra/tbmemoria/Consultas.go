@@ -0,0 +1,112 @@
+package tbmemoria
+
+import (
+	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+)
+
+// Transferencias de una cuenta (como débito y/o crédito según los flags del filtro), por timestamp.
+// Sin Debits ni Credits, o con Limit 0, el filtro es inválido y TB no devuelve nada.
+func (c *Cliente) GetAccountTransfers(filter types.AccountFilter) ([]types.Transfer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.verificar(0); err != nil {
+		return nil, err
+	}
+	r := []types.Transfer{}
+	flags := filter.AccountFilterFlags()
+	if filter.Limit == 0 || (!flags.Debits && !flags.Credits) {
+		return r, nil
+	}
+	recorrer(len(c.ordenTransfers), flags.Reversed, func(i int) bool {
+		t := c.ordenTransfers[i]
+		if !(flags.Debits && t.DebitAccountID == filter.AccountID) && !(flags.Credits && t.CreditAccountID == filter.AccountID) {
+			return true
+		}
+		if !enRango(t.Timestamp, filter.TimestampMin, filter.TimestampMax) ||
+			!coincide(t.UserData128, t.UserData64, t.UserData32, t.Code, filter.UserData128, filter.UserData64, filter.UserData32, filter.Code) {
+			return true
+		}
+		r = append(r, *t)
+		return uint32(len(r)) < filter.Limit
+	})
+	return r, nil
+}
+
+// Balances históricos de una cuenta. Solo las cuentas con flag History guardan historial.
+func (c *Cliente) GetAccountBalances(filter types.AccountFilter) ([]types.AccountBalance, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.verificar(0); err != nil {
+		return nil, err
+	}
+	r := []types.AccountBalance{}
+	flags := filter.AccountFilterFlags()
+	if filter.Limit == 0 || (!flags.Debits && !flags.Credits) {
+		return r, nil
+	}
+	historial := c.historial[filter.AccountID]
+	recorrer(len(historial), flags.Reversed, func(i int) bool {
+		h := historial[i]
+		t := h.transfer
+		if !(flags.Debits && t.DebitAccountID == filter.AccountID) && !(flags.Credits && t.CreditAccountID == filter.AccountID) {
+			return true
+		}
+		if !enRango(t.Timestamp, filter.TimestampMin, filter.TimestampMax) ||
+			!coincide(t.UserData128, t.UserData64, t.UserData32, t.Code, filter.UserData128, filter.UserData64, filter.UserData32, filter.Code) {
+			return true
+		}
+		r = append(r, h.saldo)
+		return uint32(len(r)) < filter.Limit
+	})
+	return r, nil
+}
+
+func (c *Cliente) QueryTransfers(filter types.QueryFilter) ([]types.Transfer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.verificar(0); err != nil {
+		return nil, err
+	}
+	r := []types.Transfer{}
+	if filter.Limit == 0 {
+		return r, nil
+	}
+	recorrer(len(c.ordenTransfers), filter.QueryFilterFlags().Reversed, func(i int) bool {
+		t := c.ordenTransfers[i]
+		if !enRango(t.Timestamp, filter.TimestampMin, filter.TimestampMax) ||
+			!coincide(t.UserData128, t.UserData64, t.UserData32, t.Code, filter.UserData128, filter.UserData64, filter.UserData32, filter.Code) ||
+			(filter.Ledger != 0 && t.Ledger != filter.Ledger) {
+			return true
+		}
+		r = append(r, *t)
+		return uint32(len(r)) < filter.Limit
+	})
+	return r, nil
+}
+
+// Recorre los índices 0..n-1 (o al revés) mientras seguir devuelva true
+func recorrer(n int, reverso bool, seguir func(i int) bool) {
+	for k := 0; k < n; k++ {
+		i := k
+		if reverso {
+			i = n - 1 - k
+		}
+		if !seguir(i) {
+			return
+		}
+	}
+}
+
+// Rango inclusivo de timestamps; 0 en cualquiera de los extremos significa sin límite
+func enRango(ts uint64, minimo uint64, maximo uint64) bool {
+	return (minimo == 0 || ts >= minimo) && (maximo == 0 || ts <= maximo)
+}
+
+// Los campos del filtro en cero no filtran
+func coincide(ud128 types.Uint128, ud64 uint64, ud32 uint32, code uint16,
+	f128 types.Uint128, f64 uint64, f32 uint32, fcode uint16) bool {
+	return (esCero(f128) || ud128 == f128) &&
+		(f64 == 0 || ud64 == f64) &&
+		(f32 == 0 || ud32 == f32) &&
+		(fcode == 0 || code == fcode)
+}
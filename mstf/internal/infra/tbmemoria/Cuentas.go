@@ -0,0 +1,132 @@
+package tbmemoria
+
+import (
+	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+)
+
+// Bits de AccountFlags definidos por TB (Linked .. Closed)
+const flagsCuentaValidos = 1<<6 - 1
+
+func (c *Cliente) CreateAccounts(accounts []types.Account) ([]types.AccountEventResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.verificar(len(accounts)); err != nil {
+		return nil, err
+	}
+
+	resultados := c.procesarEventos(len(accounts),
+		func(i int) bool { return accounts[i].AccountFlags().Linked },
+		func(i int) uint32 { return uint32(c.crearCuenta(accounts[i])) },
+	)
+	r := make([]types.AccountEventResult, 0, len(resultados))
+	for _, res := range resultados {
+		r = append(r, types.AccountEventResult{Index: res.indice, Result: types.CreateAccountResult(res.codigo)})
+	}
+	return r, nil
+}
+
+// Valida y crea una cuenta, en el orden de validaciones de TB
+func (c *Cliente) crearCuenta(a types.Account) types.CreateAccountResult {
+	flags := a.AccountFlags()
+	switch {
+	case flags.Imported:
+		return types.AccountImportedEventNotExpected
+	case a.Timestamp != 0:
+		return types.AccountTimestampMustBeZero
+	case a.Reserved != 0:
+		return types.AccountReservedField
+	case a.Flags&^flagsCuentaValidos != 0:
+		return types.AccountReservedFlag
+	case esCero(a.ID):
+		return types.AccountIDMustNotBeZero
+	case esMaximo(a.ID):
+		return types.AccountIDMustNotBeIntMax
+	}
+	if existente, ok := c.cuentas[a.ID]; ok {
+		return cuentaExistente(a, *existente)
+	}
+	switch {
+	case flags.DebitsMustNotExceedCredits && flags.CreditsMustNotExceedDebits:
+		return types.AccountFlagsAreMutuallyExclusive
+	case !esCero(a.DebitsPending):
+		return types.AccountDebitsPendingMustBeZero
+	case !esCero(a.DebitsPosted):
+		return types.AccountDebitsPostedMustBeZero
+	case !esCero(a.CreditsPending):
+		return types.AccountCreditsPendingMustBeZero
+	case !esCero(a.CreditsPosted):
+		return types.AccountCreditsPostedMustBeZero
+	case a.Ledger == 0:
+		return types.AccountLedgerMustNotBeZero
+	case a.Code == 0:
+		return types.AccountCodeMustNotBeZero
+	}
+
+	nueva := a
+	nueva.Timestamp = c.siguienteTimestamp()
+	c.cuentas[nueva.ID] = &nueva
+	c.ordenCuentas = append(c.ordenCuentas, &nueva)
+	c.deshacer = append(c.deshacer, func() {
+		delete(c.cuentas, nueva.ID)
+		c.ordenCuentas = c.ordenCuentas[:len(c.ordenCuentas)-1]
+	})
+	return types.AccountOK
+}
+
+// Resultado de crear una cuenta con un ID que ya existe: AccountExists solo si los datos coinciden
+func cuentaExistente(a types.Account, existente types.Account) types.CreateAccountResult {
+	switch {
+	case a.Flags != existente.Flags:
+		return types.AccountExistsWithDifferentFlags
+	case a.UserData128 != existente.UserData128:
+		return types.AccountExistsWithDifferentUserData128
+	case a.UserData64 != existente.UserData64:
+		return types.AccountExistsWithDifferentUserData64
+	case a.UserData32 != existente.UserData32:
+		return types.AccountExistsWithDifferentUserData32
+	case a.Ledger != existente.Ledger:
+		return types.AccountExistsWithDifferentLedger
+	case a.Code != existente.Code:
+		return types.AccountExistsWithDifferentCode
+	}
+	return types.AccountExists
+}
+
+// Devuelve las cuentas encontradas en el orden pedido (las inexistentes se omiten)
+func (c *Cliente) LookupAccounts(accountIDs []types.Uint128) ([]types.Account, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.verificar(len(accountIDs)); err != nil {
+		return nil, err
+	}
+	r := make([]types.Account, 0, len(accountIDs))
+	for _, id := range accountIDs {
+		if a, ok := c.cuentas[id]; ok {
+			r = append(r, *a)
+		}
+	}
+	return r, nil
+}
+
+func (c *Cliente) QueryAccounts(filter types.QueryFilter) ([]types.Account, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.verificar(0); err != nil {
+		return nil, err
+	}
+	r := []types.Account{}
+	if filter.Limit == 0 {
+		return r, nil
+	}
+	recorrer(len(c.ordenCuentas), filter.QueryFilterFlags().Reversed, func(i int) bool {
+		a := c.ordenCuentas[i]
+		if !enRango(a.Timestamp, filter.TimestampMin, filter.TimestampMax) ||
+			!coincide(a.UserData128, a.UserData64, a.UserData32, a.Code, filter.UserData128, filter.UserData64, filter.UserData32, filter.Code) ||
+			(filter.Ledger != 0 && a.Ledger != filter.Ledger) {
+			return true
+		}
+		r = append(r, *a)
+		return uint32(len(r)) < filter.Limit
+	})
+	return r, nil
+}
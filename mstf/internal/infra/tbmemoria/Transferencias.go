@@ -0,0 +1,432 @@
+package tbmemoria
+
+import (
+	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+)
+
+// Bits de TransferFlags definidos por TB (Linked .. Imported)
+const flagsTransferValidos = 1<<9 - 1
+
+// Errores transitorios: dependen del estado de las cuentas al momento del intento, por eso TB
+// no permite reintentar con el mismo ID (TransferIDAlreadyFailed)
+var resultadosTransitorios = map[types.CreateTransferResult]bool{
+	types.TransferDebitAccountNotFound:       true,
+	types.TransferCreditAccountNotFound:      true,
+	types.TransferPendingTransferNotFound:    true,
+	types.TransferExceedsCredits:             true,
+	types.TransferExceedsDebits:              true,
+	types.TransferDebitAccountAlreadyClosed:  true,
+	types.TransferCreditAccountAlreadyClosed: true,
+}
+
+func (c *Cliente) CreateTransfers(transfers []types.Transfer) ([]types.TransferEventResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.verificar(len(transfers)); err != nil {
+		return nil, err
+	}
+
+	resultados := c.procesarEventos(len(transfers),
+		func(i int) bool { return transfers[i].TransferFlags().Linked },
+		func(i int) uint32 {
+			r := c.crearTransfer(transfers[i])
+			if resultadosTransitorios[r] {
+				// se recuerda aunque la cadena se revierta
+				c.fallidas[transfers[i].ID] = struct{}{}
+			}
+			return uint32(r)
+		},
+	)
+	r := make([]types.TransferEventResult, 0, len(resultados))
+	for _, res := range resultados {
+		r = append(r, types.TransferEventResult{Index: res.indice, Result: types.CreateTransferResult(res.codigo)})
+	}
+	return r, nil
+}
+
+// Valida y aplica una transferencia, en el orden de validaciones de TB
+func (c *Cliente) crearTransfer(t types.Transfer) types.CreateTransferResult {
+	flags := t.TransferFlags()
+	switch {
+	case flags.Imported:
+		return types.TransferImportedEventNotExpected
+	case t.Timestamp != 0:
+		return types.TransferTimestampMustBeZero
+	case t.Flags&^flagsTransferValidos != 0:
+		return types.TransferReservedFlag
+	case esCero(t.ID):
+		return types.TransferIDMustNotBeZero
+	case esMaximo(t.ID):
+		return types.TransferIDMustNotBeIntMax
+	}
+	if existente, ok := c.transferencias[t.ID]; ok {
+		return transferExistente(t, *existente)
+	}
+	if _, ok := c.fallidas[t.ID]; ok {
+		return types.TransferIDAlreadyFailed
+	}
+
+	fases := 0
+	for _, f := range []bool{flags.Pending, flags.PostPendingTransfer, flags.VoidPendingTransfer} {
+		if f {
+			fases++
+		}
+	}
+	postOVoid := flags.PostPendingTransfer || flags.VoidPendingTransfer
+	balanceo := flags.BalancingDebit || flags.BalancingCredit
+	cierre := flags.ClosingDebit || flags.ClosingCredit
+	switch {
+	case fases > 1, postOVoid && (balanceo || cierre):
+		return types.TransferFlagsAreMutuallyExclusive
+	case cierre && !flags.Pending:
+		return types.TransferClosingTransferMustBePending
+	}
+	if postOVoid {
+		return c.crearPostOVoid(t, flags)
+	}
+
+	switch {
+	case esCero(t.DebitAccountID):
+		return types.TransferDebitAccountIDMustNotBeZero
+	case esMaximo(t.DebitAccountID):
+		return types.TransferDebitAccountIDMustNotBeIntMax
+	case esCero(t.CreditAccountID):
+		return types.TransferCreditAccountIDMustNotBeZero
+	case esMaximo(t.CreditAccountID):
+		return types.TransferCreditAccountIDMustNotBeIntMax
+	case t.DebitAccountID == t.CreditAccountID:
+		return types.TransferAccountsMustBeDifferent
+	case !esCero(t.PendingID):
+		return types.TransferPendingIDMustBeZero
+	case t.Timeout != 0 && !flags.Pending:
+		return types.TransferTimeoutReservedForPendingTransfer
+	case t.Ledger == 0:
+		return types.TransferLedgerMustNotBeZero
+	case t.Code == 0:
+		return types.TransferCodeMustNotBeZero
+	}
+
+	debito, ok := c.cuentas[t.DebitAccountID]
+	if !ok {
+		return types.TransferDebitAccountNotFound
+	}
+	credito, ok := c.cuentas[t.CreditAccountID]
+	if !ok {
+		return types.TransferCreditAccountNotFound
+	}
+	switch {
+	case debito.Ledger != credito.Ledger:
+		return types.TransferAccountsMustHaveTheSameLedger
+	case t.Ledger != debito.Ledger:
+		return types.TransferTransferMustHaveTheSameLedgerAsAccounts
+	case debito.AccountFlags().Closed:
+		return types.TransferDebitAccountAlreadyClosed
+	case credito.AccountFlags().Closed:
+		return types.TransferCreditAccountAlreadyClosed
+	}
+
+	monto := aU128(t.Amount)
+	// balanceo: se transfiere a lo sumo lo necesario para que la cuenta no supere su saldo
+	if flags.BalancingDebit {
+		debitos, _ := aU128(debito.DebitsPending).sumar(aU128(debito.DebitsPosted))
+		monto = minimo(monto, aU128(debito.CreditsPosted).restar(debitos))
+	}
+	if flags.BalancingCredit {
+		creditos, _ := aU128(credito.CreditsPending).sumar(aU128(credito.CreditsPosted))
+		monto = minimo(monto, aU128(credito.DebitsPosted).restar(creditos))
+	}
+
+	if r := verificarSaldos(*debito, *credito, monto, flags.Pending); r != types.TransferOK {
+		return r
+	}
+	ts := c.siguienteTimestamp()
+	if t.Timeout != 0 {
+		vence := uint64(t.Timeout) * 1e9
+		if ts+vence < ts {
+			return types.TransferOverflowsTimeout
+		}
+	}
+
+	nueva := t
+	nueva.Amount = monto.tb()
+	nueva.Timestamp = ts
+	c.registrarCuenta(debito)
+	c.registrarCuenta(credito)
+	if flags.Pending {
+		debito.DebitsPending = sumar(debito.DebitsPending, monto)
+		credito.CreditsPending = sumar(credito.CreditsPending, monto)
+		p := &pendiente{transfer: &nueva, estado: pendienteAbierta}
+		if t.Timeout != 0 {
+			p.vence = ts + uint64(t.Timeout)*1e9
+		}
+		c.pendientes[nueva.ID] = p
+		c.deshacer = append(c.deshacer, func() { delete(c.pendientes, nueva.ID) })
+		if flags.ClosingDebit {
+			debito.Flags |= types.AccountFlags{Closed: true}.ToUint16()
+		}
+		if flags.ClosingCredit {
+			credito.Flags |= types.AccountFlags{Closed: true}.ToUint16()
+		}
+	} else {
+		debito.DebitsPosted = sumar(debito.DebitsPosted, monto)
+		credito.CreditsPosted = sumar(credito.CreditsPosted, monto)
+	}
+	c.guardarTransfer(&nueva, debito, credito)
+	return types.TransferOK
+}
+
+// Post o void de una transferencia pendiente. Los campos en cero se heredan de la pendiente.
+func (c *Cliente) crearPostOVoid(t types.Transfer, flags types.TransferFlags) types.CreateTransferResult {
+	switch {
+	case esCero(t.PendingID):
+		return types.TransferPendingIDMustNotBeZero
+	case esMaximo(t.PendingID):
+		return types.TransferPendingIDMustNotBeIntMax
+	case t.PendingID == t.ID:
+		return types.TransferPendingIDMustBeDifferent
+	case t.Timeout != 0:
+		return types.TransferTimeoutReservedForPendingTransfer
+	}
+
+	p, ok := c.pendientes[t.PendingID]
+	if !ok {
+		if _, existe := c.transferencias[t.PendingID]; existe {
+			return types.TransferPendingTransferNotPending
+		}
+		return types.TransferPendingTransferNotFound
+	}
+	original := p.transfer
+	switch {
+	case !esCero(t.DebitAccountID) && t.DebitAccountID != original.DebitAccountID:
+		return types.TransferPendingTransferHasDifferentDebitAccountID
+	case !esCero(t.CreditAccountID) && t.CreditAccountID != original.CreditAccountID:
+		return types.TransferPendingTransferHasDifferentCreditAccountID
+	case t.Ledger != 0 && t.Ledger != original.Ledger:
+		return types.TransferPendingTransferHasDifferentLedger
+	case t.Code != 0 && t.Code != original.Code:
+		return types.TransferPendingTransferHasDifferentCode
+	}
+
+	montoPendiente := aU128(original.Amount)
+	monto := aU128(t.Amount)
+	if flags.PostPendingTransfer {
+		// AMOUNT_MAX postea el monto completo
+		if monto == maxU128 {
+			monto = montoPendiente
+		} else if monto.comparar(montoPendiente) > 0 {
+			return types.TransferExceedsPendingTransferAmount
+		}
+	} else {
+		if !monto.esCero() && monto != montoPendiente {
+			return types.TransferPendingTransferHasDifferentAmount
+		}
+		monto = montoPendiente
+	}
+
+	switch p.estado {
+	case pendientePosteada:
+		return types.TransferPendingTransferAlreadyPosted
+	case pendienteAnulada:
+		return types.TransferPendingTransferAlreadyVoided
+	case pendienteExpirada:
+		return types.TransferPendingTransferExpired
+	}
+
+	debito := c.cuentas[original.DebitAccountID]
+	credito := c.cuentas[original.CreditAccountID]
+	cierre := original.TransferFlags()
+	// las cuentas cerradas solo aceptan anular pendientes, o postear la pendiente que las cerró
+	if flags.PostPendingTransfer {
+		if debito.AccountFlags().Closed && !cierre.ClosingDebit {
+			return types.TransferDebitAccountAlreadyClosed
+		}
+		if credito.AccountFlags().Closed && !cierre.ClosingCredit {
+			return types.TransferCreditAccountAlreadyClosed
+		}
+	}
+
+	nueva := t
+	nueva.DebitAccountID = original.DebitAccountID
+	nueva.CreditAccountID = original.CreditAccountID
+	nueva.Ledger = original.Ledger
+	nueva.Code = original.Code
+	nueva.Amount = monto.tb()
+	nueva.Timestamp = c.siguienteTimestamp()
+
+	c.registrarCuenta(debito)
+	c.registrarCuenta(credito)
+	estadoAnterior := p.estado
+	c.deshacer = append(c.deshacer, func() { p.estado = estadoAnterior })
+
+	debito.DebitsPending = restar(debito.DebitsPending, montoPendiente)
+	credito.CreditsPending = restar(credito.CreditsPending, montoPendiente)
+	if flags.PostPendingTransfer {
+		debito.DebitsPosted = sumar(debito.DebitsPosted, monto)
+		credito.CreditsPosted = sumar(credito.CreditsPosted, monto)
+		p.estado = pendientePosteada
+	} else {
+		p.estado = pendienteAnulada
+		c.reabrir(debito, credito, cierre)
+	}
+	c.guardarTransfer(&nueva, debito, credito)
+	return types.TransferOK
+}
+
+// Verifica overflows y los límites de saldo de las cuentas para una transferencia de monto
+func verificarSaldos(debito types.Account, credito types.Account, monto u128, pendiente bool) types.CreateTransferResult {
+	dp, dpo := aU128(debito.DebitsPending), aU128(debito.DebitsPosted)
+	cp, cpo := aU128(credito.CreditsPending), aU128(credito.CreditsPosted)
+	if pendiente {
+		if _, o := dp.sumar(monto); o {
+			return types.TransferOverflowsDebitsPending
+		}
+		if _, o := cp.sumar(monto); o {
+			return types.TransferOverflowsCreditsPending
+		}
+	} else {
+		if _, o := dpo.sumar(monto); o {
+			return types.TransferOverflowsDebitsPosted
+		}
+		if _, o := cpo.sumar(monto); o {
+			return types.TransferOverflowsCreditsPosted
+		}
+	}
+	debitos, o1 := dp.sumar(dpo)
+	debitos, o2 := debitos.sumar(monto)
+	if o1 || o2 {
+		return types.TransferOverflowsDebits
+	}
+	creditos, o1 := cp.sumar(cpo)
+	creditos, o2 = creditos.sumar(monto)
+	if o1 || o2 {
+		return types.TransferOverflowsCredits
+	}
+	if debito.AccountFlags().DebitsMustNotExceedCredits && debitos.comparar(aU128(debito.CreditsPosted)) > 0 {
+		return types.TransferExceedsCredits
+	}
+	if credito.AccountFlags().CreditsMustNotExceedDebits && creditos.comparar(aU128(credito.DebitsPosted)) > 0 {
+		return types.TransferExceedsDebits
+	}
+	return types.TransferOK
+}
+
+// Anular (o que expire) una pendiente de cierre reabre la cuenta
+func (c *Cliente) reabrir(debito *types.Account, credito *types.Account, cierre types.TransferFlags) {
+	flagCerrada := types.AccountFlags{Closed: true}.ToUint16()
+	if cierre.ClosingDebit {
+		debito.Flags &^= flagCerrada
+	}
+	if cierre.ClosingCredit {
+		credito.Flags &^= flagCerrada
+	}
+}
+
+// Registra la transferencia y el balance resultante de las cuentas con flag History
+func (c *Cliente) guardarTransfer(t *types.Transfer, debito *types.Account, credito *types.Account) {
+	c.transferencias[t.ID] = t
+	c.ordenTransfers = append(c.ordenTransfers, t)
+	c.deshacer = append(c.deshacer, func() {
+		delete(c.transferencias, t.ID)
+		c.ordenTransfers = c.ordenTransfers[:len(c.ordenTransfers)-1]
+	})
+	for _, a := range []*types.Account{debito, credito} {
+		if !a.AccountFlags().History {
+			continue
+		}
+		id := a.ID
+		c.historial[id] = append(c.historial[id], saldoHistorico{
+			saldo: types.AccountBalance{
+				DebitsPending:  a.DebitsPending,
+				DebitsPosted:   a.DebitsPosted,
+				CreditsPending: a.CreditsPending,
+				CreditsPosted:  a.CreditsPosted,
+				Timestamp:      t.Timestamp,
+			},
+			transfer: t,
+		})
+		c.deshacer = append(c.deshacer, func() { c.historial[id] = c.historial[id][:len(c.historial[id])-1] })
+	}
+}
+
+// Libera las pendientes cuyo timeout venció (TB lo hace en segundo plano; acá antes de cada operación)
+func (c *Cliente) expirarPendientes() {
+	ahora := uint64(c.reloj().UnixNano())
+	for _, p := range c.pendientes {
+		if p.estado != pendienteAbierta || p.vence == 0 || p.vence > ahora {
+			continue
+		}
+		p.estado = pendienteExpirada
+		t := p.transfer
+		debito := c.cuentas[t.DebitAccountID]
+		credito := c.cuentas[t.CreditAccountID]
+		debito.DebitsPending = restar(debito.DebitsPending, aU128(t.Amount))
+		credito.CreditsPending = restar(credito.CreditsPending, aU128(t.Amount))
+		c.reabrir(debito, credito, t.TransferFlags())
+	}
+}
+
+// Resultado de crear una transferencia con un ID que ya existe: TransferExists solo si los datos coinciden.
+// En post/void los campos en cero se heredaron de la pendiente, así que no se comparan.
+func transferExistente(t types.Transfer, existente types.Transfer) types.CreateTransferResult {
+	postOVoid := t.TransferFlags().PostPendingTransfer || t.TransferFlags().VoidPendingTransfer
+	distinto := func(pedido, guardado types.Uint128) bool {
+		return pedido != guardado && !(postOVoid && esCero(pedido))
+	}
+	switch {
+	case t.Flags != existente.Flags:
+		return types.TransferExistsWithDifferentFlags
+	case t.PendingID != existente.PendingID:
+		return types.TransferExistsWithDifferentPendingID
+	case t.Timeout != existente.Timeout:
+		return types.TransferExistsWithDifferentTimeout
+	case distinto(t.DebitAccountID, existente.DebitAccountID):
+		return types.TransferExistsWithDifferentDebitAccountID
+	case distinto(t.CreditAccountID, existente.CreditAccountID):
+		return types.TransferExistsWithDifferentCreditAccountID
+	case distinto(t.Amount, existente.Amount) && !(postOVoid && esMaximo(t.Amount)) && !t.TransferFlags().BalancingDebit && !t.TransferFlags().BalancingCredit:
+		return types.TransferExistsWithDifferentAmount
+	case t.UserData128 != existente.UserData128:
+		return types.TransferExistsWithDifferentUserData128
+	case t.UserData64 != existente.UserData64:
+		return types.TransferExistsWithDifferentUserData64
+	case t.UserData32 != existente.UserData32:
+		return types.TransferExistsWithDifferentUserData32
+	case t.Ledger != existente.Ledger && !(postOVoid && t.Ledger == 0):
+		return types.TransferExistsWithDifferentLedger
+	case t.Code != existente.Code && !(postOVoid && t.Code == 0):
+		return types.TransferExistsWithDifferentCode
+	}
+	return types.TransferExists
+}
+
+func sumar(a types.Uint128, b u128) types.Uint128 {
+	r, _ := aU128(a).sumar(b)
+	return r.tb()
+}
+
+func restar(a types.Uint128, b u128) types.Uint128 {
+	return aU128(a).restar(b).tb()
+}
+
+func minimo(a u128, b u128) u128 {
+	if a.comparar(b) < 0 {
+		return a
+	}
+	return b
+}
+
+// Devuelve las transferencias encontradas en el orden pedido (las inexistentes se omiten)
+func (c *Cliente) LookupTransfers(transferIDs []types.Uint128) ([]types.Transfer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.verificar(len(transferIDs)); err != nil {
+		return nil, err
+	}
+	r := make([]types.Transfer, 0, len(transferIDs))
+	for _, id := range transferIDs {
+		if t, ok := c.transferencias[id]; ok {
+			r = append(r, *t)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,80 @@
+package trazas
+
+import (
+	"context"
+	"fmt"
+
+	"MSTransaccionesFinancieras/internal/config"
+	"MSTransaccionesFinancieras/internal/infra/logs"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	nombreTracer   = "MSTransaccionesFinancieras"
+	nombreServicio = "mstf"
+)
+
+// Exportadores soportados en OTEL_TRACES_EXPORTER
+const (
+	ExportadorNinguno = "none"
+	ExportadorOTLP    = "otlp"
+)
+
+// Configura el TracerProvider global según cfg.ExportadorTrazas y el propagador W3C (traceparent + baggage).
+// Con el exportador "none" (default) se mantiene el provider no-op de OpenTelemetry: no se registran spans,
+// pero el contexto de traza que llega en requests y mensajes se sigue propagando.
+// El endpoint OTLP se toma de las variables estándar (OTEL_EXPORTER_OTLP_ENDPOINT, etc.).
+// Retorna la función que vacía y cierra el exportador.
+func Init(cfg config.Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	switch cfg.ExportadorTrazas {
+	case "", ExportadorNinguno:
+		return func(context.Context) error { return nil }, nil
+	case ExportadorOTLP:
+	default:
+		return nil, fmt.Errorf("exportador de trazas no soportado: %s", cfg.ExportadorTrazas)
+	}
+
+	exportador, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	// OTEL_SERVICE_NAME y OTEL_RESOURCE_ATTRIBUTES tienen prioridad sobre el nombre por defecto
+	recurso, err := resource.New(context.Background(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(semconv.ServiceName(nombreServicio)),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exportador),
+		sdktrace.WithResource(recurso),
+	)
+	otel.SetTracerProvider(provider)
+	logs.L(logs.App).Info("trazas OpenTelemetry exportadas por OTLP")
+	return provider.Shutdown, nil
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(nombreTracer)
+}
+
+// Cierra el span marcándolo con error si err != nil
+func Finalizar(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -2,29 +2,56 @@ package webhook
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
 	"net/http"
 	"time"
 
 	"MSTransaccionesFinancieras/internal/config"
+	"MSTransaccionesFinancieras/internal/infra/fallas"
+	"MSTransaccionesFinancieras/internal/infra/logs"
+	"MSTransaccionesFinancieras/internal/infra/metricas"
+	"MSTransaccionesFinancieras/internal/infra/trazas"
 	"MSTransaccionesFinancieras/internal/models"
 
 	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Notificador struct {
-	cfg config.Config
+	cfg     config.Config
+	cliente *http.Client
 }
 
 var Cliente *Notificador
 
+// Error que envuelve toda falla de notificación. Permite al consumidor distinguir una caída del webhook
+// (se reintenta el lote completo) de un error causado por el contenido de un mensaje.
+var ErrWebhook = errors.New("falló la notificación del webhook")
+
+// El webhook rechazó el contenido de la notificación (400 o 422): reintentar el mismo lote no cambia el
+// resultado, así que es evidencia de que la falla es de algún mensaje del lote y no una caída.
+var ErrNotificacionRechazada = errors.New("el webhook rechazó el contenido de la notificación")
+
 func Init(cfg config.Config) {
-	Cliente = &Notificador{cfg: cfg}
+	transporte := http.DefaultTransport
+	if cfg.InyeccionFallas {
+		transporte = fallas.EnvolverTransporte(transporte)
+	}
+	// otelhttp propaga el contexto de traza (traceparent) al webhook
+	Cliente = &Notificador{cfg: cfg, cliente: &http.Client{
+		Timeout:   15 * time.Second,
+		Transport: otelhttp.NewTransport(transporte),
+	}}
 }
 
-func (n *Notificador) NotificarTransferencias(transfers []types.Transfer, kafkaMsgs []models.KafkaTransferencias, results []types.TransferEventResult, fallidas []models.TransferenciaNotificada) error {
+// Arma las notificaciones del lote (resultados de TB + rechazadas) y las envía al webhook.
+// Retorna las notificaciones armadas aunque falle el envío.
+func (n *Notificador) NotificarTransferencias(ctx context.Context, transfers []types.Transfer, kafkaMsgs []models.KafkaTransferencias, results []types.TransferEventResult, fallidas []models.TransferenciaNotificada) ([]models.TransferenciaNotificada, error) {
 	resultadosTransferenciaMap := make(map[uint32]types.TransferEventResult)
 	for _, res := range results {
 		resultadosTransferenciaMap[res.Index] = res
@@ -50,34 +77,68 @@ func (n *Notificador) NotificarTransferencias(transfers []types.Transfer, kafkaM
 		Transferencias:    notificaciones,
 	}
 
-	return n.llamarWebhook(payload)
+	ctx, span := trazas.Tracer().Start(ctx, "webhook.NotificarTransferencias",
+		trace.WithAttributes(attribute.Int("transferencias", len(notificaciones))))
+	inicio := time.Now()
+	err := n.llamarWebhook(ctx, payload)
+	trazas.Finalizar(span, err)
+	metricas.LatenciaWebhook.Observe(time.Since(inicio).Seconds())
+	if err != nil {
+		metricas.FallasWebhook.Inc()
+		return notificaciones, fmt.Errorf("%w: %w", ErrWebhook, err)
+	}
+	return notificaciones, nil
 }
 
-func (n *Notificador) llamarWebhook(payload models.LoteNotificado) error {
+func (n *Notificador) llamarWebhook(ctx context.Context, payload models.LoteNotificado) error {
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
-		log.Printf("ERROR [Notificador.llamarWebhook]: Fallo al serializar payload: %v", err)
+		logs.L(logs.Webhook).ErrorContext(ctx, "fallo al serializar el payload", logs.Err(err))
 		return err
 	}
 	urlWebhook := n.cfg.URLWebhook
 	if urlWebhook == "" {
-		//log.Printf("ADVERTENCIA Notificador: URLWebhook no configurada. Simulación de envío exitoso:\n%s", string(jsonPayload))
+		logs.L(logs.Webhook).DebugContext(ctx, "URLWebhook no configurada, se simula un envío exitoso", "transferencias", payload.CantidadProcesada)
 		return nil
 	}
-	//log.Printf("Notificador: Enviando POST Webhook a %s. Lote de %d transfers.", urlWebhook, payload.CantidadProcesada)
-	client := http.Client{
-		Timeout: 15 * time.Second,
+	logs.L(logs.Webhook).DebugContext(ctx, "enviando notificación", "url", urlWebhook, "transferencias", payload.CantidadProcesada)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, urlWebhook, bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return err
 	}
-	resp, err := client.Post(urlWebhook, "application/json; charset=utf-8", bytes.NewBuffer(jsonPayload))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	resp, err := n.cliente.Do(req)
 	if err != nil {
-		log.Printf("ERROR [Notificador.llamarWebhook]: Fallo al llamar Webhook a %s: %v", urlWebhook, err)
+		logs.L(logs.Webhook).ErrorContext(ctx, "fallo al llamar al webhook", "url", urlWebhook, logs.Err(err))
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		//log.Printf("Notificador: Webhook enviado exitosamente. Status: %s", resp.Status)
+		logs.L(logs.Webhook).DebugContext(ctx, "notificación enviada", "status", resp.Status)
 		return nil
 	}
-	log.Printf("ERROR [Notificador.llamarWebhook]: Webhook respondió con un error. Status: %s", resp.Status)
+	logs.L(logs.Webhook).ErrorContext(ctx, "el webhook respondió con un error", "url", urlWebhook, "status", resp.Status)
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnprocessableEntity {
+		return fmt.Errorf("%w: status %s", ErrNotificacionRechazada, resp.Status)
+	}
 	return errors.New("webhook devolvió status no exitoso: " + resp.Status)
 }
+
+// Verifica que el webhook sea alcanzable con un HEAD a la URL. Cualquier respuesta HTTP (incluso 4xx/5xx)
+// cuenta como alcanzable: solo se informan errores de red. Sin URLWebhook configurada no hay nada que verificar.
+func (n *Notificador) VerificarConexion(ctx context.Context) error {
+	if n.cfg.URLWebhook == "" {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, n.cfg.URLWebhook, nil)
+	if err != nil {
+		return err
+	}
+	// sin otelhttp: los health checks no generan trazas
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook no alcanzable: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,71 @@
+package ingesta
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+)
+
+// Bloqueos por cuenta de los lotes del motor. CrearLote valida el saldo y la última transferencia de cada cuenta
+// antes de escribir en TB, así que dos lotes con la misma cuenta no deben procesarse a la vez. Los pipelines de
+// Kafka ya se reparten las cuentas (Consumidor.shardDe), pero las demás fuentes (HTTP, carpeta) procesan en
+// paralelo con ellos: cada lote toma las cuentas de sus transferencias, siempre en el mismo orden para que
+// dos lotes no se bloqueen entre sí.
+type bloqueosCuentas struct {
+	mu      sync.Mutex
+	cuentas map[cuentaLote]*bloqueoCuenta
+}
+
+type cuentaLote struct {
+	idMoneda       uint32
+	idUsuarioFinal uint64
+}
+
+type bloqueoCuenta struct {
+	mu sync.Mutex
+	// lotes que tienen o esperan la cuenta: en cero se borra del mapa
+	usos int
+}
+
+func newBloqueosCuentas() *bloqueosCuentas {
+	return &bloqueosCuentas{cuentas: make(map[cuentaLote]*bloqueoCuenta)}
+}
+
+// Toma las cuentas de los items (los fallidos en parseo no van a TB) y retorna la función que las libera
+func (b *bloqueosCuentas) tomar(items []itemLote) (liberar func()) {
+	claves := make([]cuentaLote, 0, len(items))
+	for _, it := range items {
+		if it.fallida == nil {
+			claves = append(claves, cuentaLote{idMoneda: it.kafkaMsg.IdMoneda, idUsuarioFinal: it.kafkaMsg.IdUsuarioFinal})
+		}
+	}
+	slices.SortFunc(claves, func(a, c cuentaLote) int {
+		return cmp.Or(cmp.Compare(a.idMoneda, c.idMoneda), cmp.Compare(a.idUsuarioFinal, c.idUsuarioFinal))
+	})
+	claves = slices.Compact(claves)
+
+	tomados := make([]*bloqueoCuenta, len(claves))
+	for i, clave := range claves {
+		b.mu.Lock()
+		bloqueo, ok := b.cuentas[clave]
+		if !ok {
+			bloqueo = &bloqueoCuenta{}
+			b.cuentas[clave] = bloqueo
+		}
+		bloqueo.usos++
+		b.mu.Unlock()
+		bloqueo.mu.Lock()
+		tomados[i] = bloqueo
+	}
+
+	return func() {
+		for i, bloqueo := range tomados {
+			bloqueo.mu.Unlock()
+			b.mu.Lock()
+			if bloqueo.usos--; bloqueo.usos == 0 {
+				delete(b.cuentas, claves[i])
+			}
+			b.mu.Unlock()
+		}
+	}
+}
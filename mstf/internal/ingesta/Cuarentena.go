@@ -0,0 +1,154 @@
+package ingesta
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"MSTransaccionesFinancieras/internal/infra/logs"
+	"MSTransaccionesFinancieras/internal/infra/persistence"
+	"MSTransaccionesFinancieras/internal/infra/webhook"
+	"MSTransaccionesFinancieras/internal/models"
+
+	tigerbeetle "github.com/tigerbeetle/tigerbeetle-go"
+	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+)
+
+// contadores internos del motor (se leen con Metricas)
+type metricasIngesta struct {
+	lotesProcesados    atomic.Int64
+	reintentosLote     atomic.Int64
+	lotesAislados      atomic.Int64
+	mensajesCuarentena atomic.Int64
+}
+
+// Foto de las métricas de ingesta (todas las fuentes)
+type MetricasIngesta struct {
+	LotesProcesados    int64 `json:"LotesProcesados"`
+	ReintentosLote     int64 `json:"ReintentosLote"`
+	LotesAislados      int64 `json:"LotesAislados"`
+	MensajesCuarentena int64 `json:"MensajesCuarentena"`
+}
+
+func (m *Motor) Metricas() MetricasIngesta {
+	return MetricasIngesta{
+		LotesProcesados:    m.metricas.lotesProcesados.Load(),
+		ReintentosLote:     m.metricas.reintentosLote.Load(),
+		LotesAislados:      m.metricas.lotesAislados.Load(),
+		MensajesCuarentena: m.metricas.mensajesCuarentena.Load(),
+	}
+}
+
+// item que siguió fallando al procesarse solo
+type itemFallido struct {
+	item itemLote
+	err  error
+}
+
+// Divide el lote por bisección, procesando cada mitad por separado, hasta quedarse con los mensajes
+// que fallan solos. Esos mensajes se ponen en cuarentena y el resto del lote queda procesado.
+// Solo se aíslan mensajes con evidencia positiva de que la falla es del contenido y no de una caída (ver
+// fallaDelContenido); ante la duda se sigue reintentando: una caída parcial (ej: CreateTransfers con timeout
+// mientras el resto responde) no debe mandar a cuarentena los mensajes sanos de un lote.
+// Retorna true si el lote quedó completamente resuelto (procesado o en cuarentena).
+func (m *Motor) aislarMensajesFallidos(ctx context.Context, lote Lote, items []itemLote, errLote error) (bool, error) {
+	m.metricas.lotesAislados.Add(1)
+	logs.L(logs.Ingesta).WarnContext(ctx, "el lote falló de forma repetida, se divide para aislar los mensajes que lo hacen fallar", "mensajes", len(items))
+
+	var fallidos []itemFallido
+	exitos := 0
+	if len(items) == 1 {
+		fallidos = []itemFallido{{item: items[0], err: errLote}}
+	} else {
+		mitad := len(items) / 2
+		f1, e1 := m.biseccionar(ctx, items[:mitad])
+		f2, e2 := m.biseccionar(ctx, items[mitad:])
+		fallidos = append(f1, f2...)
+		exitos = e1 + e2
+	}
+
+	if len(fallidos) == 0 {
+		// procesado por partes sin errores: el fallo era transitorio
+		return true, nil
+	}
+	if !fallaDelContenido(ctx, m.tb, fallidos, exitos) {
+		logs.L(logs.Ingesta).WarnContext(ctx, "no hay evidencia de que la falla sea del contenido de los mensajes, se asume caída de un servicio y se sigue reintentando",
+			"fallidos", len(fallidos), "procesados", exitos)
+		return false, nil
+	}
+
+	for _, f := range fallidos {
+		if err := m.ponerEnCuarentena(ctx, lote, f.item, f.err); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Procesa el slice de items; si falla y tiene más de un item lo divide en dos mitades y repite.
+// Retorna los items que fallan solos y la cantidad de items procesados con éxito.
+// Las mitades se procesan en orden para no alterar el orden de las transferencias de una cuenta.
+func (m *Motor) biseccionar(ctx context.Context, items []itemLote) ([]itemFallido, int) {
+	_, err := m.procesar(ctx, items)
+	if err == nil {
+		return nil, len(items)
+	}
+	if len(items) == 1 {
+		return []itemFallido{{item: items[0], err: err}}, 0
+	}
+	mitad := len(items) / 2
+	f1, e1 := m.biseccionar(ctx, items[:mitad])
+	f2, e2 := m.biseccionar(ctx, items[mitad:])
+	return append(f1, f2...), e1 + e2
+}
+
+// La falla de los mensajes que fallan solos es de su contenido si todos sus errores lo indican (el webhook
+// rechazó la notificación), o si otra parte del lote se procesó bien, TB sigue respondiendo y ninguno de los
+// errores es una caída del webhook. Sin ninguna parte procesada solo cuentan los errores del contenido.
+func fallaDelContenido(ctx context.Context, tb tigerbeetle.Client, fallidos []itemFallido, exitos int) bool {
+	delContenido := true
+	for _, f := range fallidos {
+		if errors.Is(f.err, webhook.ErrNotificacionRechazada) {
+			continue
+		}
+		delContenido = false
+		if errors.Is(f.err, webhook.ErrWebhook) {
+			return false
+		}
+	}
+	if delContenido {
+		return true
+	}
+	if exitos == 0 || tb == nil {
+		return false
+	}
+	_, err := persistence.TB(ctx, tb).LookupAccounts([]types.Uint128{types.ToUint128(0)})
+	return err == nil
+}
+
+// Registra el mensaje en MensajesCuarentena, avisando antes a la fuente (ej: para publicarlo en un DLQ).
+func (m *Motor) ponerEnCuarentena(ctx context.Context, lote Lote, item itemLote, errProceso error) error {
+	if lote.AlCuarentena != nil {
+		if err := lote.AlCuarentena(item.msg, errProceso); err != nil {
+			return err
+		}
+	}
+
+	mensaje, err := m.cuarentena.Crear(ctx, models.MensajesCuarentena{
+		Origen:          item.msg.Origen,
+		IdTransferencia: item.kafkaMsg.IdTransferencia,
+		Contenido:       string(item.msg.Valor),
+		Error:           errProceso.Error(),
+	})
+	if err != nil {
+		return err
+	}
+	if mensaje != "OK" {
+		return errors.New(mensaje)
+	}
+
+	m.metricas.mensajesCuarentena.Add(1)
+	logs.L(logs.Ingesta).ErrorContext(ctx, "mensaje puesto en cuarentena", "origen", item.msg.Origen, "IdTransferencia", item.kafkaMsg.IdTransferencia,
+		"IdMoneda", item.kafkaMsg.IdMoneda, "IdCorrelacion", item.msg.Correlacion, logs.Err(errProceso))
+	return nil
+}
@@ -0,0 +1,157 @@
+package ingesta
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/config"
+	"MSTransaccionesFinancieras/internal/esquemas"
+	"MSTransaccionesFinancieras/internal/gestores"
+	"MSTransaccionesFinancieras/internal/infra/fallas"
+	"MSTransaccionesFinancieras/internal/infra/persistence"
+	"MSTransaccionesFinancieras/internal/infra/tbmemoria"
+	"MSTransaccionesFinancieras/internal/infra/webhook"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"MSTransaccionesFinancieras/internal/repositorios/memoria"
+	"MSTransaccionesFinancieras/internal/utils"
+)
+
+const monedaTest uint32 = 1
+
+// Motor sobre TigerBeetle en memoria (con inyección de fallas habilitada, sin reglas) y repositorios en memoria,
+// con la cuenta del usuario 7. El webhook rechaza (422) toda notificación que incluya la transferencia
+// idVeneno: reintentar su lote no cambia el resultado. parametros se agregan a los del motor.
+func nuevoMotorTest(t *testing.T, idVeneno string, parametros ...models.Parametros) (*Motor, repositorios.Repositorios) {
+	t.Helper()
+	if err := fallas.Init(config.Config{InyeccionFallas: true}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(fallas.Limpiar)
+	tb := persistence.InstrumentarTB(fallas.EnvolverTB(tbmemoria.New()))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cuerpo, _ := io.ReadAll(r.Body)
+		if idVeneno != "" && bytes.Contains(cuerpo, []byte(`"IdTransferencia":"`+idVeneno+`"`)) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	webhook.Init(config.Config{URLWebhook: srv.URL, InyeccionFallas: true})
+
+	bd := memoria.New()
+	bd.GuardarParametro(models.Parametros{Parametro: "MONTOMAXTRANSFER", Valor: "100000000"})
+	bd.GuardarParametro(models.Parametros{Parametro: "MONTOMINTRANSFER", Valor: "100"})
+	bd.GuardarParametro(models.Parametros{Parametro: "KAFKAINTENTOSAISLAR", Valor: "1"})
+	for _, p := range parametros {
+		bd.GuardarParametro(p)
+	}
+	bd.GuardarMoneda(models.Monedas{IdMoneda: int(monedaTest), IdCuentaEmpresa: utils.ConcatenarIDString(uint64(monedaTest), 0)})
+	repos := bd.Repositorios()
+
+	gc := gestores.NewGestorCuentas(tb, repos.Monedas, repos.Auditoria)
+	for _, idUsuarioFinal := range []uint64{0, 7} {
+		if _, _, err := gc.Crear(t.Context(), models.Cuentas{IdMoneda: monedaTest, IdUsuarioFinal: idUsuarioFinal, Fecha: "2026-01-01"}); err != nil {
+			t.Fatalf("no se pudo crear la cuenta %d: %v", idUsuarioFinal, err)
+		}
+	}
+	gt := gestores.NewGestorTransferencias(tb, repos.Parametros, repos.Monedas, repos.Auditoria, gestores.NewGestorEstadosTransferencias(repos.Estados))
+	return NewMotor(tb, gt, gestores.NewGestorCuarentena(repos.Cuarentena), repos.Parametros, repos.Monedas), repos
+}
+
+// Lote de ingresos a la cuenta del usuario 7 con las transferencias 1 a n. Cuenta las confirmaciones y los
+// mensajes que se avisan a la fuente al ponerlos en cuarentena.
+func loteTest(t *testing.T, n int, confirmados *atomic.Int32, aislados *atomic.Int32) Lote {
+	t.Helper()
+	lote := Lote{
+		Fuente:       "test",
+		Confirmar:    func(context.Context) error { confirmados.Add(1); return nil },
+		AlCuarentena: func(Mensaje, error) error { aislados.Add(1); return nil },
+	}
+	for i := 1; i <= n; i++ {
+		valor, err := esquemas.CodificarJSON(models.KafkaTransferencias{
+			IdTransferencia: strconv.Itoa(i), IdUsuarioFinal: 7, Monto: 10, IdMoneda: monedaTest, Tipo: "I", Fecha: "2026-01-02",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lote.Mensajes = append(lote.Mensajes, Mensaje{Origen: fmt.Sprintf("test:%d", i), Valor: valor, Formato: esquemas.FormatoJSON})
+	}
+	return lote
+}
+
+func TestCuarentenaMensajeVeneno(t *testing.T) {
+	motor, repos := nuevoMotorTest(t, "3")
+	var confirmados, aislados atomic.Int32
+
+	if err := motor.ProcesarConReintentos(t.Context(), loteTest(t, 4, &confirmados, &aislados), nil); err != nil {
+		t.Fatalf("ProcesarConReintentos: %v", err)
+	}
+	if confirmados.Load() != 1 || aislados.Load() != 1 {
+		t.Fatalf("confirmados %d, avisados a la fuente %d", confirmados.Load(), aislados.Load())
+	}
+	mensajes, err := repos.Cuarentena.Buscar(t.Context(), "", 10)
+	if err != nil || len(mensajes) != 1 || mensajes[0].IdTransferencia != "3" || mensajes[0].Origen != "test:3" {
+		t.Fatalf("cuarentena: %+v %v", mensajes, err)
+	}
+	if m := motor.Metricas(); m.LotesAislados != 1 || m.MensajesCuarentena != 1 {
+		t.Fatalf("métricas: %+v", m)
+	}
+}
+
+// Con una caída, total o parcial, ninguna parte del lote se procesa: no hay evidencia de que la falla sea
+// del contenido y ningún mensaje va a cuarentena
+func TestCuarentenaCaidaSinAislar(t *testing.T) {
+	casos := []struct {
+		nombre  string
+		destino string
+		regla   fallas.Regla
+	}{
+		{"TigerBeetle caído", fallas.TigerBeetle, fallas.Regla{Modo: fallas.ModoError}},
+		// LookupAccounts responde: antes bastaba para mandar todo el lote a cuarentena
+		{"CreateTransfers caído", fallas.TigerBeetle, fallas.Regla{Modo: fallas.ModoError, Operaciones: []string{"CreateTransfers"}}},
+		{"webhook caído", fallas.Webhook, fallas.Regla{Modo: fallas.ModoError}},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			motor, repos := nuevoMotorTest(t, "")
+			var confirmados, aislados atomic.Int32
+			lote := loteTest(t, 4, &confirmados, &aislados)
+			if err := fallas.Configurar(c.destino, c.regla); err != nil {
+				t.Fatal(err)
+			}
+
+			items := parsearLote(t.Context(), motor.tb, motor.monedas, lote.Mensajes)
+			_, errLote := motor.procesar(t.Context(), items)
+			if errLote == nil {
+				t.Fatal("el lote debía fallar")
+			}
+			resuelto, err := motor.aislarMensajesFallidos(t.Context(), lote, items, errLote)
+			if err != nil || resuelto {
+				t.Fatalf("aislarMensajesFallidos: %v %v", resuelto, err)
+			}
+			mensajes, _ := repos.Cuarentena.Buscar(t.Context(), "", 10)
+			if len(mensajes) != 0 || aislados.Load() != 0 {
+				t.Fatalf("mensajes en cuarentena durante la caída: %+v", mensajes)
+			}
+
+			// recuperado el servicio, el mismo lote se procesa completo
+			fallas.Limpiar()
+			if resuelto, err := motor.aislarMensajesFallidos(t.Context(), lote, items, errLote); err != nil || !resuelto {
+				t.Fatalf("tras la recuperación: %v %v", resuelto, err)
+			}
+			if mensajes, _ := repos.Cuarentena.Buscar(t.Context(), "", 10); len(mensajes) != 0 {
+				t.Fatalf("mensajes en cuarentena: %+v", mensajes)
+			}
+		})
+	}
+}
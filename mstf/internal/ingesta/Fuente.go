@@ -0,0 +1,60 @@
+package ingesta
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Mensaje crudo recibido por una fuente de ingesta. Valor es la transferencia en cualquiera de las
+// versiones y formatos del paquete esquemas, igual para todas las fuentes.
+type Mensaje struct {
+	Origen string // identifica el mensaje en su fuente, ej: kafka:topic/particion/offset, archivo:nombre:linea
+	Clave  []byte
+	Valor  []byte
+	// Formato de Valor: esquemas.FormatoJSON (o "") / esquemas.FormatoProtobuf
+	Formato string
+	// IdCorrelacion de la transferencia (header de Kafka, request HTTP, etc.)
+	Correlacion string
+	// Contexto de traza de quien originó el mensaje (headers de Kafka, request HTTP). El span del lote lo enlaza.
+	Traza trace.SpanContext
+	Ref   any // referencia propia de la fuente (ej: kafka.Message), la usan sus callbacks
+}
+
+// Lote de mensajes entregado por una fuente al motor de ingesta.
+type Lote struct {
+	Fuente   string
+	Mensajes []Mensaje
+	// Se llama cuando el lote quedó procesado (o sus mensajes fallidos en cuarentena): commit de offsets,
+	// mover un archivo, etc. Puede ser nil.
+	Confirmar func(ctx context.Context) error
+	// Se llama por cada mensaje puesto en cuarentena, antes de registrarlo en MySQL (ej: publicar en un topic DLQ).
+	// Puede ser nil.
+	AlCuarentena func(m Mensaje, err error) error
+}
+
+// Fuente de transferencias. Cada fuente decide cómo arma sus lotes y con cuánta concurrencia los entrega,
+// pero todas los procesan con el mismo Motor (parseo, validación, CrearLote y notificación).
+// Close deja de tomar lotes nuevos y espera a que los lotes en curso terminen y se confirmen; si ctx vence
+// antes, los cancela (sin confirmar: la fuente los vuelve a entregar al reiniciar).
+type Fuente interface {
+	Nombre() string
+	Start(motor *Motor)
+	Close(ctx context.Context)
+}
+
+// Espera a que wg llegue a cero o a que venza ctx. Retorna false si venció ctx.
+func EsperarDrenado(ctx context.Context, wg *sync.WaitGroup) bool {
+	listo := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(listo)
+	}()
+	select {
+	case <-listo:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
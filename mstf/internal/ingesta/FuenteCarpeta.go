@@ -0,0 +1,170 @@
+package ingesta
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/correlacion"
+	"MSTransaccionesFinancieras/internal/infra/logs"
+)
+
+// Fuente de ingesta para cargas masivas: revisa periódicamente una carpeta y procesa los archivos *.ndjson
+// (una transferencia JSON por línea), en orden alfabético y en lotes de KAFKABATCHSIZE.
+// Al terminar un archivo se mueve a procesados/; si no se puede leer, a errores/.
+// Quien deja los archivos debe escribirlos con otra extensión y renombrarlos al terminar, para no
+// leer archivos a medio escribir. Si el MS cae a mitad de un archivo, se vuelve a procesar completo:
+// las transferencias ya escritas se informan como "OK - Reintento".
+type FuenteCarpeta struct {
+	carpeta string
+	motor   *Motor
+	// detener corta la lectura entre lotes; cancelar corta el lote en curso (plazo de Close vencido)
+	detener  chan struct{}
+	cancelar context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// El archivo quedó a medio procesar por el cierre de la fuente: se retoma completo al reiniciar
+var errFuenteDetenida = errors.New("fuente detenida")
+
+// Largo máximo de una línea del archivo
+const maxLineaNDJSON = 1 << 20
+
+func NewFuenteCarpeta(carpeta string) *FuenteCarpeta {
+	return &FuenteCarpeta{carpeta: carpeta, detener: make(chan struct{})}
+}
+
+func (f *FuenteCarpeta) Nombre() string {
+	return "carpeta"
+}
+
+func (f *FuenteCarpeta) Start(motor *Motor) {
+	f.motor = motor
+	for _, sub := range []string{"procesados", "errores"} {
+		if err := os.MkdirAll(filepath.Join(f.carpeta, sub), 0o755); err != nil {
+			logs.L(logs.Ingesta).Error("no se pudo crear la carpeta", "fuente", f.Nombre(), "carpeta", sub, logs.Err(err))
+		}
+	}
+
+	ctx, cancelar := context.WithCancel(context.Background())
+	f.cancelar = cancelar
+	f.wg.Add(1)
+	go f.loop(ctx)
+}
+
+// Termina el lote en curso y deja el archivo en la carpeta para retomarlo al reiniciar
+func (f *FuenteCarpeta) Close(ctx context.Context) {
+	close(f.detener)
+	if !EsperarDrenado(ctx, &f.wg) {
+		logs.L(logs.Ingesta).Warn("venció el plazo de drenado, se cancela el lote en curso", "fuente", f.Nombre())
+	}
+	if f.cancelar != nil {
+		f.cancelar()
+	}
+	f.wg.Wait()
+}
+
+func (f *FuenteCarpeta) detenida() bool {
+	select {
+	case <-f.detener:
+		return true
+	default:
+		return false
+	}
+}
+
+func (f *FuenteCarpeta) loop(ctx context.Context) {
+	defer f.wg.Done()
+
+	for {
+		archivos, err := filepath.Glob(filepath.Join(f.carpeta, "*.ndjson"))
+		if err != nil {
+			logs.L(logs.Ingesta).Error("no se pudo listar la carpeta", "fuente", f.Nombre(), "carpeta", f.carpeta, logs.Err(err))
+		}
+		sort.Strings(archivos)
+		for _, archivo := range archivos {
+			if err := f.procesarArchivo(ctx, archivo); err != nil {
+				if ctx.Err() != nil || errors.Is(err, errFuenteDetenida) {
+					return
+				}
+				logs.L(logs.Ingesta).Error("no se pudo procesar el archivo", "fuente", f.Nombre(), "archivo", archivo, logs.Err(err))
+				f.mover(archivo, "errores")
+			}
+		}
+
+		select {
+		case <-f.detener:
+			return
+		case <-time.After(obtenerIntervaloCarpeta(f.motor.parametros)):
+		}
+	}
+}
+
+// Procesa el archivo lote por lote. El último lote, al confirmarse, mueve el archivo a procesados/.
+func (f *FuenteCarpeta) procesarArchivo(ctx context.Context, archivo string) error {
+	fd, err := os.Open(archivo)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	nombre := filepath.Base(archivo)
+	// un IdCorrelacion por archivo
+	idCorrelacion := correlacion.Nuevo()
+	logs.L(logs.Ingesta).Info("procesando archivo", "fuente", f.Nombre(), "archivo", nombre, "IdCorrelacion", idCorrelacion)
+	tamanoLote := ObtenerTamanoLote(f.motor.parametros)
+	scanner := bufio.NewScanner(fd)
+	scanner.Buffer(make([]byte, 64*1024), maxLineaNDJSON)
+
+	var mensajes []Mensaje
+	linea := 0
+	for scanner.Scan() {
+		linea++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		valor := append([]byte(nil), scanner.Bytes()...)
+		mensajes = append(mensajes, Mensaje{Origen: fmt.Sprintf("archivo:%s:%d", nombre, linea), Valor: valor, Correlacion: idCorrelacion})
+		if len(mensajes) == tamanoLote {
+			if f.detenida() {
+				return errFuenteDetenida
+			}
+			if err := f.motor.ProcesarConReintentos(ctx, Lote{Fuente: f.Nombre(), Mensajes: mensajes}, nil); err != nil {
+				return err
+			}
+			mensajes = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	lote := Lote{
+		Fuente:   f.Nombre(),
+		Mensajes: mensajes,
+		Confirmar: func(ctx context.Context) error {
+			f.mover(archivo, "procesados")
+			return nil
+		},
+	}
+	if len(mensajes) == 0 {
+		return lote.Confirmar(ctx)
+	}
+	if f.detenida() {
+		return errFuenteDetenida
+	}
+	return f.motor.ProcesarConReintentos(ctx, lote, nil)
+}
+
+func (f *FuenteCarpeta) mover(archivo string, destino string) {
+	nuevo := filepath.Join(f.carpeta, destino, time.Now().Format("20060102150405")+"_"+filepath.Base(archivo))
+	if err := os.Rename(archivo, nuevo); err != nil {
+		logs.L(logs.Ingesta).Error("no se pudo mover el archivo", "fuente", f.Nombre(), "archivo", archivo, "destino", destino, logs.Err(err))
+	}
+}
@@ -0,0 +1,120 @@
+package ingesta
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/infra/fallas"
+	"MSTransaccionesFinancieras/internal/models"
+)
+
+// Escribe el archivo en la carpeta: una línea por valor, separadas por \n (la última sin salto de línea)
+func escribirArchivo(t *testing.T, carpeta string, nombre string, valores ...[]byte) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(carpeta, nombre), bytes.Join(valores, []byte("\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func iniciarFuenteCarpeta(t *testing.T, motor *Motor, carpeta string) *FuenteCarpeta {
+	t.Helper()
+	f := NewFuenteCarpeta(carpeta)
+	motor.Registrar(f)
+	motor.Start()
+	return f
+}
+
+// Espera a que el archivo aparezca en la subcarpeta (procesados/ o errores/) y ya no esté en la carpeta
+func esperarMovido(t *testing.T, carpeta string, destino string, nombre string) {
+	t.Helper()
+	for limite := time.Now().Add(5 * time.Second); ; {
+		movidos, _ := filepath.Glob(filepath.Join(carpeta, destino, "*_"+nombre))
+		if _, err := os.Stat(filepath.Join(carpeta, nombre)); len(movidos) == 1 && os.IsNotExist(err) {
+			return
+		}
+		if time.Now().After(limite) {
+			t.Fatalf("el archivo %s no se movió a %s/", nombre, destino)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func creditosCuenta(t *testing.T, motor *Motor) string {
+	t.Helper()
+	c := models.Cuentas{IdMoneda: monedaTest, IdUsuarioFinal: 7}
+	if err := c.Dame(motor.tb); err != nil {
+		t.Fatal(err)
+	}
+	return c.Creditos
+}
+
+// El archivo se procesa en lotes de KAFKABATCHSIZE y al confirmarse el último se mueve a procesados/.
+// Las líneas vacías se saltean, una línea incompleta se rechaza sola y la última línea no necesita salto de línea.
+func TestFuenteCarpetaProcesaArchivo(t *testing.T) {
+	motor, _ := nuevoMotorTest(t, "", models.Parametros{Parametro: "KAFKABATCHSIZE", Valor: "2"})
+	carpeta := t.TempDir()
+	escribirArchivo(t, carpeta, "a.ndjson",
+		transferenciaHTTP(t, 1, "I", 10),
+		nil,
+		[]byte(`{"IdTransferencia":"2","IdUsuarioFinal":7`),
+		transferenciaHTTP(t, 3, "I", 20),
+		transferenciaHTTP(t, 4, "I", 30),
+	)
+	f := iniciarFuenteCarpeta(t, motor, carpeta)
+	defer f.Close(context.Background())
+
+	esperarMovido(t, carpeta, "procesados", "a.ndjson")
+	if c := creditosCuenta(t, motor); c != "60.00" {
+		t.Fatalf("créditos %s, se esperaba 60.00", c)
+	}
+	if n := motor.Metricas().LotesProcesados; n != 2 {
+		t.Fatalf("se procesaron %d lotes, se esperaban 2", n)
+	}
+}
+
+// Un archivo que no se puede leer se mueve a errores/ sin procesar ninguna línea, y el resto de la carpeta sigue
+func TestFuenteCarpetaArchivoConError(t *testing.T) {
+	motor, _ := nuevoMotorTest(t, "")
+	carpeta := t.TempDir()
+	escribirArchivo(t, carpeta, "a.ndjson", bytes.Repeat([]byte("x"), maxLineaNDJSON+1), transferenciaHTTP(t, 1, "I", 10))
+	escribirArchivo(t, carpeta, "b.ndjson", transferenciaHTTP(t, 2, "I", 20))
+	f := iniciarFuenteCarpeta(t, motor, carpeta)
+	defer f.Close(context.Background())
+
+	esperarMovido(t, carpeta, "errores", "a.ndjson")
+	esperarMovido(t, carpeta, "procesados", "b.ndjson")
+	if c := creditosCuenta(t, motor); c != "20.00" {
+		t.Fatalf("créditos %s, se esperaba 20.00", c)
+	}
+}
+
+// Close termina el lote en curso y deja el archivo en la carpeta, sin procesar los lotes siguientes
+func TestFuenteCarpetaCloseAMitadDeArchivo(t *testing.T) {
+	motor, _ := nuevoMotorTest(t, "", models.Parametros{Parametro: "KAFKABATCHSIZE", Valor: "1"})
+	if err := fallas.Configurar(fallas.Webhook, fallas.Regla{Modo: fallas.ModoLatencia, LatenciaMs: 200}); err != nil {
+		t.Fatal(err)
+	}
+	carpeta := t.TempDir()
+	escribirArchivo(t, carpeta, "a.ndjson",
+		transferenciaHTTP(t, 1, "I", 10), transferenciaHTTP(t, 2, "I", 20), transferenciaHTTP(t, 3, "I", 30))
+	f := iniciarFuenteCarpeta(t, motor, carpeta)
+	esperarLoteEnCurso(t)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	f.Close(ctx)
+
+	if _, err := os.Stat(filepath.Join(carpeta, "a.ndjson")); err != nil {
+		t.Fatalf("el archivo debía quedar en la carpeta para retomarlo: %v", err)
+	}
+	if movidos, _ := filepath.Glob(filepath.Join(carpeta, "*", "*a.ndjson")); len(movidos) != 0 {
+		t.Fatalf("el archivo se movió: %v", movidos)
+	}
+	if c := creditosCuenta(t, motor); c != "10.00" {
+		t.Fatalf("créditos %s, se esperaba 10.00 (solo el lote en curso)", c)
+	}
+}
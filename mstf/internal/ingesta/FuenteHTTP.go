@@ -0,0 +1,186 @@
+package ingesta
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/correlacion"
+	"MSTransaccionesFinancieras/internal/infra/logs"
+	"MSTransaccionesFinancieras/internal/models"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+var ErrFuenteCerrada = errors.New("la fuente de ingesta no está disponible")
+
+// Fuente de ingesta síncrona: los lotes llegan en requests HTTP y se responde con el resultado
+// de cada transferencia. Las requests concurrentes se agrupan en un mismo lote (hasta KAFKABATCHSIZE
+// mensajes o INGESTAHTTPVENTANAMS de espera) para escribir en TB en batches grandes.
+// Los lotes se procesan de a uno y en orden de llegada. No reintenta ni aísla mensajes: ante una caída
+// devuelve el error y el cliente puede reenviar (los ya escritos se informan como "OK - Reintento").
+// Cada lote toma sus cuentas en el motor (ver bloqueosCuentas): espera a que termine el lote de Kafka u otra
+// fuente que tenga alguna de ellas.
+type FuenteHTTP struct {
+	motor   *Motor
+	pedidos chan *pedidoHTTP
+	cerrar  chan struct{}
+	cerrada atomic.Bool
+	wg      sync.WaitGroup
+	lotes   atomic.Uint64
+	// el HTTP arranca antes que el motor: hasta Start los pedidos se rechazan
+	iniciada atomic.Bool
+	// cancela el lote en curso si vence el plazo de Close
+	ctx      context.Context
+	cancelar context.CancelFunc
+}
+
+type pedidoHTTP struct {
+	mensajes  []Mensaje
+	respuesta chan respuestaHTTP
+}
+
+type respuestaHTTP struct {
+	resultados []models.TransferenciaNotificada
+	err        error
+}
+
+func NewFuenteHTTP() *FuenteHTTP {
+	f := &FuenteHTTP{
+		// sin buffer: un pedido solo se acepta cuando el loop lo puede recibir
+		pedidos: make(chan *pedidoHTTP),
+		cerrar:  make(chan struct{}),
+	}
+	f.ctx, f.cancelar = context.WithCancel(context.Background())
+	return f
+}
+
+func (f *FuenteHTTP) Nombre() string {
+	return "http"
+}
+
+func (f *FuenteHTTP) Start(motor *Motor) {
+	f.motor = motor
+	f.wg.Add(1)
+	go f.loop()
+	f.iniciada.Store(true)
+}
+
+// Deja de aceptar pedidos y espera a que termine el lote en curso (los pedidos ya agrupados en él reciben
+// su resultado). Si ctx vence antes, cancela el lote y sus pedidos reciben el error.
+func (f *FuenteHTTP) Close(ctx context.Context) {
+	if f.cerrada.Swap(true) {
+		return
+	}
+	close(f.cerrar)
+	if !EsperarDrenado(ctx, &f.wg) {
+		logs.L(logs.Ingesta).Warn("venció el plazo de drenado, se cancela el lote en curso", "fuente", f.Nombre())
+		f.cancelar()
+		f.wg.Wait()
+	}
+	f.cancelar()
+}
+
+// Procesa los mensajes (JSON con el formato de KafkaTransferencias) y devuelve el resultado de cada uno,
+// en el mismo orden. Si ctx se cancela mientras el lote se procesa, el lote igual se completa y se notifica.
+func (f *FuenteHTTP) Recibir(ctx context.Context, valores [][]byte) ([]models.TransferenciaNotificada, error) {
+	if !f.iniciada.Load() || f.cerrada.Load() {
+		return nil, ErrFuenteCerrada
+	}
+
+	idPedido := f.lotes.Add(1)
+	idCorrelacion := correlacion.DesdeContexto(ctx)
+	if idCorrelacion == "" {
+		idCorrelacion = correlacion.Nuevo()
+	}
+	// el lote se procesa en el loop de la fuente: el span de la request queda enlazado al del lote
+	traza := trace.SpanContextFromContext(ctx)
+	pedido := &pedidoHTTP{
+		mensajes:  make([]Mensaje, len(valores)),
+		respuesta: make(chan respuestaHTTP, 1),
+	}
+	for i, v := range valores {
+		pedido.mensajes[i] = Mensaje{Origen: fmt.Sprintf("http:%d/%d", idPedido, i), Valor: v, Correlacion: idCorrelacion, Traza: traza}
+	}
+
+	select {
+	case f.pedidos <- pedido:
+	case <-f.cerrar:
+		return nil, ErrFuenteCerrada
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case r := <-pedido.respuesta:
+		return r.resultados, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (f *FuenteHTTP) loop() {
+	defer f.wg.Done()
+
+	for {
+		var primero *pedidoHTTP
+		select {
+		case primero = <-f.pedidos:
+		case <-f.cerrar:
+			return
+		}
+
+		pedidos := []*pedidoHTTP{primero}
+		total := len(primero.mensajes)
+		tamanoLote := ObtenerTamanoLote(f.motor.parametros)
+		timer := time.NewTimer(obtenerVentanaHTTP(f.motor.parametros))
+	acumular:
+		for total < tamanoLote {
+			select {
+			case p := <-f.pedidos:
+				pedidos = append(pedidos, p)
+				total += len(p.mensajes)
+			case <-timer.C:
+				break acumular
+			case <-f.cerrar:
+				break acumular
+			}
+		}
+		timer.Stop()
+
+		f.procesar(pedidos, total)
+	}
+}
+
+// Procesa los pedidos agrupados como un único lote y responde a cada uno con sus resultados.
+// Si el lote falla a mitad, los pedidos que quedaron completos en los sub-lotes ya procesados reciben su resultado.
+func (f *FuenteHTTP) procesar(pedidos []*pedidoHTTP, total int) {
+	mensajes := make([]Mensaje, 0, total)
+	for _, p := range pedidos {
+		mensajes = append(mensajes, p.mensajes...)
+	}
+	resultados, err := f.motor.ProcesarLote(f.ctx, Lote{Fuente: f.Nombre(), Mensajes: mensajes})
+
+	desde := 0
+	for _, p := range pedidos {
+		propios := resultados[desde : desde+len(p.mensajes)]
+		desde += len(p.mensajes)
+		if err != nil && !completos(propios) {
+			p.respuesta <- respuestaHTTP{err: err}
+			continue
+		}
+		p.respuesta <- respuestaHTTP{resultados: propios}
+	}
+}
+
+func completos(resultados []models.TransferenciaNotificada) bool {
+	for _, r := range resultados {
+		if r.Estado == "" {
+			return false
+		}
+	}
+	return true
+}
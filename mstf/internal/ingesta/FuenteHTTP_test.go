@@ -0,0 +1,201 @@
+package ingesta
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/esquemas"
+	"MSTransaccionesFinancieras/internal/infra/fallas"
+	"MSTransaccionesFinancieras/internal/models"
+)
+
+// Transferencia JSON de la cuenta del usuario 7
+func transferenciaHTTP(t *testing.T, idTransferencia int, tipo string, monto float64) []byte {
+	t.Helper()
+	valor, err := esquemas.CodificarJSON(models.KafkaTransferencias{
+		IdTransferencia: strconv.Itoa(idTransferencia), IdUsuarioFinal: 7, Monto: monto, IdMoneda: monedaTest, Tipo: tipo, Fecha: "2026-01-02",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return valor
+}
+
+func iniciarFuenteHTTP(t *testing.T, motor *Motor) *FuenteHTTP {
+	t.Helper()
+	f := NewFuenteHTTP()
+	motor.Registrar(f)
+	motor.Start()
+	t.Cleanup(func() { f.Close(context.Background()) })
+	return f
+}
+
+// Espera a que el webhook empiece a recibir la notificación del lote (regla de latencia inyectada)
+func esperarLoteEnCurso(t *testing.T) {
+	t.Helper()
+	for limite := time.Now().Add(5 * time.Second); fallas.Reglas()[fallas.Webhook].Inyectadas == 0; {
+		if time.Now().After(limite) {
+			t.Fatal("el lote no llegó al webhook")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Las requests concurrentes se procesan en un único lote y cada una recibe solo sus resultados
+func TestFuenteHTTPAgrupaPedidos(t *testing.T) {
+	motor, _ := nuevoMotorTest(t, "",
+		models.Parametros{Parametro: "KAFKABATCHSIZE", Valor: "3"}, models.Parametros{Parametro: "INGESTAHTTPVENTANAMS", Valor: "10000"})
+	f := iniciarFuenteHTTP(t, motor)
+
+	valores := [][]byte{transferenciaHTTP(t, 1, "I", 10), transferenciaHTTP(t, 2, "I", 20), transferenciaHTTP(t, 3, "I", 30)}
+	resultados := make([][]models.TransferenciaNotificada, len(valores))
+	errores := make([]error, len(valores))
+	var wg sync.WaitGroup
+	for i, v := range valores {
+		wg.Go(func() { resultados[i], errores[i] = f.Recibir(t.Context(), [][]byte{v}) })
+	}
+	wg.Wait()
+
+	for i := range valores {
+		if errores[i] != nil || len(resultados[i]) != 1 || resultados[i][0].IdTransferencia != strconv.Itoa(i+1) || resultados[i][0].Estado != "F" {
+			t.Fatalf("pedido %d: %+v %v", i+1, resultados[i], errores[i])
+		}
+	}
+	// el lote se completó al llegar a KAFKABATCHSIZE, sin esperar la ventana
+	if n := motor.Metricas().LotesProcesados; n != 1 {
+		t.Fatalf("se procesaron %d lotes, se esperaba 1", n)
+	}
+}
+
+// Cada mensaje recibe su resultado en su posición, aunque el resto del pedido se rechace
+func TestFuenteHTTPResultadosPorMensaje(t *testing.T) {
+	motor, _ := nuevoMotorTest(t, "")
+	f := iniciarFuenteHTTP(t, motor)
+
+	resultados, err := f.Recibir(t.Context(), [][]byte{
+		transferenciaHTTP(t, 1, "I", 10),
+		transferenciaHTTP(t, 2, "E", 50), // saldo insuficiente
+		[]byte("{"),
+		transferenciaHTTP(t, 3, "I", 5),
+	})
+	if err != nil || len(resultados) != 4 {
+		t.Fatalf("Recibir: %+v %v", resultados, err)
+	}
+	esperados := []struct{ id, estado string }{{"1", "F"}, {"2", "E"}, {"", "E"}, {"3", "F"}}
+	for i, e := range esperados {
+		if (e.id != "" && resultados[i].IdTransferencia != e.id) || resultados[i].Estado != e.estado {
+			t.Fatalf("resultado %d: %+v", i, resultados[i])
+		}
+	}
+}
+
+// Si falla un sub-lote, los pedidos que quedaron completos antes reciben sus resultados y el resto el error
+func TestFuenteHTTPFallaParcial(t *testing.T) {
+	motor, _ := nuevoMotorTest(t, "12",
+		models.Parametros{Parametro: "KAFKABATCHSIZE", Valor: "2"}, models.Parametros{Parametro: "INGESTAHTTPVENTANAMS", Valor: "200"})
+	f := iniciarFuenteHTTP(t, motor)
+
+	// si A llega primero el lote es [11 13 | 12]: A queda completo en el primer sub-lote y B falla en el segundo.
+	// Si llega B primero, B falla solo y A se procesa después. En los dos casos el resultado es el mismo.
+	valorA := [][]byte{transferenciaHTTP(t, 11, "I", 10)}
+	valorB := [][]byte{transferenciaHTTP(t, 13, "I", 10), transferenciaHTTP(t, 12, "I", 10)}
+	var resultadosA []models.TransferenciaNotificada
+	var errA, errB error
+	var wg sync.WaitGroup
+	wg.Go(func() { resultadosA, errA = f.Recibir(t.Context(), valorA) })
+	wg.Go(func() { _, errB = f.Recibir(t.Context(), valorB) })
+	wg.Wait()
+
+	if errA != nil || len(resultadosA) != 1 || resultadosA[0].IdTransferencia != "11" || resultadosA[0].Estado != "F" {
+		t.Fatalf("pedido completo: %+v %v", resultadosA, errA)
+	}
+	if errB == nil {
+		t.Fatal("el pedido con el sub-lote fallido debía recibir el error")
+	}
+}
+
+// Close deja de aceptar pedidos y espera al lote en curso, que responde sus pedidos
+func TestFuenteHTTPCloseDrena(t *testing.T) {
+	motor, _ := nuevoMotorTest(t, "")
+	f := iniciarFuenteHTTP(t, motor)
+	if err := fallas.Configurar(fallas.Webhook, fallas.Regla{Modo: fallas.ModoLatencia, LatenciaMs: 200}); err != nil {
+		t.Fatal(err)
+	}
+
+	valor := [][]byte{transferenciaHTTP(t, 1, "I", 10)}
+	var resultados []models.TransferenciaNotificada
+	var err error
+	var wg sync.WaitGroup
+	wg.Go(func() { resultados, err = f.Recibir(t.Context(), valor) })
+	esperarLoteEnCurso(t)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	f.Close(ctx)
+	wg.Wait()
+	if err != nil || len(resultados) != 1 || resultados[0].Estado != "F" {
+		t.Fatalf("pedido en curso durante Close: %+v %v", resultados, err)
+	}
+	if _, err := f.Recibir(t.Context(), valor); !errors.Is(err, ErrFuenteCerrada) {
+		t.Fatalf("Recibir después de Close: %v", err)
+	}
+}
+
+// Si vence el plazo de Close, el lote en curso se cancela y sus pedidos reciben el error
+func TestFuenteHTTPClosePlazoVencido(t *testing.T) {
+	motor, _ := nuevoMotorTest(t, "")
+	f := iniciarFuenteHTTP(t, motor)
+	if err := fallas.Configurar(fallas.Webhook, fallas.Regla{Modo: fallas.ModoLatencia, LatenciaMs: 10000}); err != nil {
+		t.Fatal(err)
+	}
+
+	valor := [][]byte{transferenciaHTTP(t, 1, "I", 10)}
+	var err error
+	var wg sync.WaitGroup
+	wg.Go(func() { _, err = f.Recibir(t.Context(), valor) })
+	esperarLoteEnCurso(t)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	inicio := time.Now()
+	f.Close(ctx)
+	wg.Wait()
+	if err == nil || time.Since(inicio) > 5*time.Second {
+		t.Fatalf("pedido cancelado por el plazo de Close: %v (%s)", err, time.Since(inicio))
+	}
+}
+
+// Un lote espera a que se liberen sus cuentas; los de otras cuentas no
+func TestBloqueosCuentas(t *testing.T) {
+	b := newBloqueosCuentas()
+	item := func(idUsuarioFinal uint64) itemLote {
+		return itemLote{kafkaMsg: models.KafkaTransferencias{IdMoneda: monedaTest, IdUsuarioFinal: idUsuarioFinal}}
+	}
+	liberar := b.tomar([]itemLote{item(7), item(8), item(7)})
+	b.tomar([]itemLote{item(9)})()
+
+	tomado, liberado := make(chan struct{}), make(chan struct{})
+	go func() {
+		liberarOtro := b.tomar([]itemLote{item(8), item(9)})
+		close(tomado)
+		liberarOtro()
+		close(liberado)
+	}()
+	select {
+	case <-tomado:
+		t.Fatal("la cuenta 8 estaba tomada")
+	case <-time.After(50 * time.Millisecond):
+	}
+	liberar()
+	<-liberado
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.cuentas) != 0 {
+		t.Fatalf("quedaron cuentas tomadas: %v", b.cuentas)
+	}
+}
@@ -0,0 +1,205 @@
+package ingesta
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/gestores"
+	"MSTransaccionesFinancieras/internal/infra/logs"
+	"MSTransaccionesFinancieras/internal/infra/metricas"
+	"MSTransaccionesFinancieras/internal/infra/trazas"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"MSTransaccionesFinancieras/internal/utils"
+
+	tigerbeetle "github.com/tigerbeetle/tigerbeetle-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Motor de ingesta: camino común de todas las fuentes. Parsea los mensajes, los envía a
+// GestorTransferencias.CrearLote (validación, TB y notificación al webhook), reintenta ante caídas,
+// aísla los mensajes que hacen fallar un lote y confirma el lote a su fuente.
+type Motor struct {
+	tb         tigerbeetle.Client
+	procesador *gestores.GestorTransferencias
+	cuarentena *gestores.GestorCuarentena
+	parametros repositorios.Parametros
+	monedas    repositorios.Monedas
+	fuentes    []Fuente
+	cuentas    *bloqueosCuentas
+	metricas   metricasIngesta
+	// Id de lote para logs y trazas, único por proceso
+	secuenciaLotes atomic.Uint64
+}
+
+// Estado de un lote que está reintentándose, informado a la fuente en cada intento fallido
+type EstadoReintento struct {
+	Estado   string // REINTENTANDO, AISLANDO
+	Intentos int
+	Backoff  time.Duration
+	Error    error
+}
+
+func NewMotor(tb tigerbeetle.Client, procesador *gestores.GestorTransferencias, cuarentena *gestores.GestorCuarentena, parametros repositorios.Parametros, monedas repositorios.Monedas) *Motor {
+	return &Motor{tb: tb, procesador: procesador, cuarentena: cuarentena, parametros: parametros, monedas: monedas, cuentas: newBloqueosCuentas()}
+}
+
+// Agrega una fuente. Las fuentes se inician en el orden en que se registran y se cierran en orden inverso.
+func (m *Motor) Registrar(f Fuente) {
+	m.fuentes = append(m.fuentes, f)
+}
+
+func (m *Motor) Start() {
+	for _, f := range m.fuentes {
+		f.Start(m)
+		logs.L(logs.Ingesta).Info("fuente de ingesta iniciada", "fuente", f.Nombre())
+	}
+}
+
+// Drena las fuentes en orden inverso al de inicio: cada una termina y confirma su lote en curso.
+// ctx es el plazo total del drenado (ver Fuente.Close).
+func (m *Motor) Close(ctx context.Context) {
+	for i := len(m.fuentes) - 1; i >= 0; i-- {
+		inicio := time.Now()
+		m.fuentes[i].Close(ctx)
+		logs.L(logs.Ingesta).Info("fuente de ingesta detenida", "fuente", m.fuentes[i].Nombre(), "duracion", time.Since(inicio).String())
+	}
+}
+
+// Procesa el lote una sola vez, sin reintentos, partiéndolo en sub-lotes de KAFKABATCHSIZE.
+// Retorna el resultado de cada mensaje en el mismo orden del lote. Si falla un sub-lote se devuelve
+// el error junto con los resultados de los anteriores (los mensajes sin procesar quedan con Estado vacío).
+// Confirmar se llama solo si todo el lote se procesó.
+func (m *Motor) ProcesarLote(ctx context.Context, lote Lote) (resultados []models.TransferenciaNotificada, err error) {
+	ctx, span := m.iniciarLote(ctx, "ingesta.ProcesarLote", lote)
+	defer func() { trazas.Finalizar(span, err) }()
+
+	tamanoLote := ObtenerTamanoLote(m.parametros)
+	items := parsearLote(ctx, m.tb, m.monedas, lote.Mensajes)
+
+	resultados = make([]models.TransferenciaNotificada, len(items))
+	for inicio := 0; inicio < len(items); inicio += tamanoLote {
+		fin := min(inicio+tamanoLote, len(items))
+		notificaciones, err := m.procesar(ctx, items[inicio:fin])
+		if err != nil {
+			return resultados, err
+		}
+		alinearResultados(items[inicio:fin], notificaciones, resultados[inicio:fin])
+	}
+	m.metricas.lotesProcesados.Add(1)
+	metricas.LotesProcesados.WithLabelValues(lote.Fuente).Inc()
+	metricas.TamanoLote.WithLabelValues(lote.Fuente).Observe(float64(len(lote.Mensajes)))
+
+	if lote.Confirmar != nil {
+		if err := lote.Confirmar(ctx); err != nil {
+			return resultados, err
+		}
+	}
+	return resultados, nil
+}
+
+// Procesa el lote con backoff exponencial hasta que tenga éxito y luego lo confirma a la fuente.
+// El lote no debe superar KAFKABATCHSIZE mensajes (las fuentes arman los lotes con ese límite).
+// El backoff empieza en 1s y se duplica en cada intento hasta el límite RETRYBACKOFFMAXSEG.
+// Si el lote falla KAFKAINTENTOSAISLAR veces seguidas se intenta aislar los mensajes que lo hacen fallar;
+// si no se puede determinar que la falla es del contenido (ej: TB caído) se sigue reintentando.
+// Nunca abandona, bloquea hasta que el servicio caído (TB, webhook, etc.) se recupere.
+// Retorna error solo si ctx se cancela durante la espera. alReintentar puede ser nil.
+func (m *Motor) ProcesarConReintentos(ctx context.Context, lote Lote, alReintentar func(EstadoReintento)) (err error) {
+	ctx, span := m.iniciarLote(ctx, "ingesta.ProcesarConReintentos", lote)
+	defer func() { trazas.Finalizar(span, err) }()
+
+	items := parsearLote(ctx, m.tb, m.monedas, lote.Mensajes)
+	backoff := time.Second
+	maxBackoff := obtenerRetryMaxBackoff(m.parametros)
+	intentosAislar := obtenerIntentosAntesDeAislar(m.parametros)
+	fallos := 0
+
+	for {
+		_, err := m.procesar(ctx, items)
+		if err == nil {
+			break
+		}
+		span.AddEvent("reintento", trace.WithAttributes(attribute.Int("intentos", fallos+1), attribute.String("error", err.Error())))
+		fallos++
+		m.metricas.reintentosLote.Add(1)
+		metricas.ReintentosLote.WithLabelValues(lote.Fuente).Inc()
+
+		if fallos >= intentosAislar {
+			if alReintentar != nil {
+				alReintentar(EstadoReintento{Estado: "AISLANDO", Intentos: fallos, Error: err})
+			}
+			aislado, errAislar := m.aislarMensajesFallidos(ctx, lote, items, err)
+			if errAislar != nil {
+				logs.L(logs.Ingesta).ErrorContext(ctx, "no se pudieron poner en cuarentena los mensajes fallidos", logs.Err(errAislar))
+			}
+			if aislado {
+				break
+			}
+		}
+
+		logs.L(logs.Ingesta).ErrorContext(ctx, "falló el procesamiento del lote, no se confirmará", "intentos", fallos, "backoff", backoff.String(), logs.Err(err))
+		metricas.BackoffReintento.WithLabelValues(lote.Fuente).Set(backoff.Seconds())
+		if alReintentar != nil {
+			alReintentar(EstadoReintento{Estado: "REINTENTANDO", Intentos: fallos, Backoff: backoff, Error: err})
+		}
+
+		select {
+		case <-ctx.Done():
+			logs.L(logs.Ingesta).WarnContext(ctx, "lote abandonado durante el reintento, la fuente lo volverá a entregar al reiniciar")
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		if backoff < maxBackoff {
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+	}
+	m.metricas.lotesProcesados.Add(1)
+	metricas.LotesProcesados.WithLabelValues(lote.Fuente).Inc()
+	metricas.TamanoLote.WithLabelValues(lote.Fuente).Observe(float64(len(lote.Mensajes)))
+	if fallos > 0 {
+		metricas.BackoffReintento.WithLabelValues(lote.Fuente).Set(0)
+	}
+
+	if lote.Confirmar != nil {
+		if err := lote.Confirmar(ctx); err != nil {
+			logs.L(logs.Ingesta).ErrorContext(ctx, "no se pudo confirmar el lote a la fuente", logs.Err(err))
+		}
+	}
+	return nil
+}
+
+// Envía a CrearLote los items del lote (válidos y fallidos en parseo), con sus cuentas tomadas: un lote de otra
+// fuente con alguna de esas cuentas espera a que termine.
+func (m *Motor) procesar(ctx context.Context, items []itemLote) ([]models.TransferenciaNotificada, error) {
+	liberar := m.cuentas.tomar(items)
+	defer liberar()
+	transferencias, kafkaMsgs, fallidasParseo := separarItems(items)
+	return m.procesador.CrearLote(ctx, transferencias, kafkaMsgs, fallidasParseo)
+}
+
+// CrearLote devuelve primero las transferencias enviadas a TB y después las rechazadas, así que sus
+// notificaciones se ubican en la posición de su mensaje buscándolas por IdTransferencia
+// (si un Id se repite, en el orden en que aparecen).
+func alinearResultados(items []itemLote, notificaciones []models.TransferenciaNotificada, destino []models.TransferenciaNotificada) {
+	porId := make(map[string][]int, len(notificaciones))
+	for i, n := range notificaciones {
+		porId[n.IdTransferencia] = append(porId[n.IdTransferencia], i)
+	}
+	for i, it := range items {
+		id := utils.Uint128AStringDecimal(it.transfer.ID)
+		if it.fallida != nil {
+			id = it.fallida.IdTransferencia
+		}
+		if indices := porId[id]; len(indices) > 0 {
+			destino[i] = notificaciones[indices[0]]
+			porId[id] = indices[1:]
+		}
+	}
+}
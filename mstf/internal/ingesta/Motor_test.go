@@ -0,0 +1,48 @@
+package ingesta
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/infra/fallas"
+	"MSTransaccionesFinancieras/internal/infra/metricas"
+	"MSTransaccionesFinancieras/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Métricas de Prometheus de un lote que se procesa al segundo intento: reintentos, backoff en curso
+// (vuelve a 0 al procesarse) y lotes procesados, con la fuente como label
+func TestMetricasLote(t *testing.T) {
+	motor, _ := nuevoMotorTest(t, "", models.Parametros{Parametro: "KAFKAINTENTOSAISLAR", Valor: "5"})
+	regla := fallas.Regla{Modo: fallas.ModoError, Operaciones: []string{"CreateTransfers"}, Cantidad: 1}
+	if err := fallas.Configurar(fallas.TigerBeetle, regla); err != nil {
+		t.Fatal(err)
+	}
+	var confirmados, aislados atomic.Int32
+	lote := loteTest(t, 2, &confirmados, &aislados)
+	lote.Fuente = "metricas"
+	procesados := testutil.ToFloat64(metricas.LotesProcesados.WithLabelValues(lote.Fuente))
+	reintentos := testutil.ToFloat64(metricas.ReintentosLote.WithLabelValues(lote.Fuente))
+
+	var backoff float64
+	err := motor.ProcesarConReintentos(t.Context(), lote, func(EstadoReintento) {
+		backoff = testutil.ToFloat64(metricas.BackoffReintento.WithLabelValues(lote.Fuente))
+	})
+	if err != nil || confirmados.Load() != 1 {
+		t.Fatalf("ProcesarConReintentos: %v (%d confirmados)", err, confirmados.Load())
+	}
+
+	if backoff != 1 {
+		t.Fatalf("backoff durante el reintento: %v, se esperaba 1", backoff)
+	}
+	if v := testutil.ToFloat64(metricas.BackoffReintento.WithLabelValues(lote.Fuente)); v != 0 {
+		t.Fatalf("backoff tras procesar el lote: %v", v)
+	}
+	if v := testutil.ToFloat64(metricas.ReintentosLote.WithLabelValues(lote.Fuente)) - reintentos; v != 1 {
+		t.Fatalf("reintentos: %v, se esperaba 1", v)
+	}
+	if v := testutil.ToFloat64(metricas.LotesProcesados.WithLabelValues(lote.Fuente)) - procesados; v != 1 {
+		t.Fatalf("lotes procesados: %v, se esperaba 1", v)
+	}
+}
@@ -0,0 +1,85 @@
+package ingesta
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+)
+
+// Tamaño máximo de lote que se envía a CrearLote, común a todas las fuentes.
+func ObtenerTamanoLote(parametros repositorios.Parametros) int {
+	p := &models.Parametros{Parametro: "KAFKABATCHSIZE"}
+	if _, err := parametros.Dame(context.Background(), p); err != nil || p.Valor == "" {
+		return 8000
+	}
+	val, err := strconv.Atoi(p.Valor)
+	if err != nil || val <= 0 {
+		return 8000
+	}
+	return val
+}
+
+func obtenerIntentosAntesDeAislar(parametros repositorios.Parametros) int {
+	p := &models.Parametros{Parametro: "KAFKAINTENTOSAISLAR"}
+	if _, err := parametros.Dame(context.Background(), p); err != nil || p.Valor == "" {
+		return 5
+	}
+	val, err := strconv.Atoi(p.Valor)
+	if err != nil || val <= 0 {
+		return 5
+	}
+	return val
+}
+
+func obtenerRetryMaxBackoff(parametros repositorios.Parametros) time.Duration {
+	p := &models.Parametros{Parametro: "RETRYBACKOFFMAXSEG"}
+	if _, err := parametros.Dame(context.Background(), p); err != nil || p.Valor == "" {
+		return 20 * time.Second
+	}
+	val, err := strconv.Atoi(p.Valor)
+	if err != nil || val <= 0 {
+		return 20 * time.Second
+	}
+	return time.Duration(val) * time.Second
+}
+
+func obtenerIntervaloCarpeta(parametros repositorios.Parametros) time.Duration {
+	p := &models.Parametros{Parametro: "INGESTACARPETASEG"}
+	if _, err := parametros.Dame(context.Background(), p); err != nil || p.Valor == "" {
+		return 10 * time.Second
+	}
+	val, err := strconv.Atoi(p.Valor)
+	if err != nil || val <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(val) * time.Second
+}
+
+// Tiempo máximo que se espera a otras requests para agrupar un lote HTTP
+func obtenerVentanaHTTP(parametros repositorios.Parametros) time.Duration {
+	p := &models.Parametros{Parametro: "INGESTAHTTPVENTANAMS"}
+	if _, err := parametros.Dame(context.Background(), p); err != nil || p.Valor == "" {
+		return 5 * time.Millisecond
+	}
+	val, err := strconv.Atoi(p.Valor)
+	if err != nil || val < 0 {
+		return 5 * time.Millisecond
+	}
+	return time.Duration(val) * time.Millisecond
+}
+
+// Plazo para que las fuentes terminen y confirmen sus lotes en curso al apagar el MS
+func ObtenerTimeoutDrenado(parametros repositorios.Parametros) time.Duration {
+	p := &models.Parametros{Parametro: "APAGADODRENADOSEG"}
+	if _, err := parametros.Dame(context.Background(), p); err != nil || p.Valor == "" {
+		return 30 * time.Second
+	}
+	val, err := strconv.Atoi(p.Valor)
+	if err != nil || val <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(val) * time.Second
+}
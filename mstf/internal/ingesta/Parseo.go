@@ -0,0 +1,178 @@
+package ingesta
+
+import (
+	"context"
+	"errors"
+
+	"MSTransaccionesFinancieras/internal/esquemas"
+	"MSTransaccionesFinancieras/internal/infra/logs"
+	"MSTransaccionesFinancieras/internal/infra/persistence"
+	"MSTransaccionesFinancieras/internal/infra/trazas"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"MSTransaccionesFinancieras/internal/utils"
+
+	tigerbeetle "github.com/tigerbeetle/tigerbeetle-go"
+	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+)
+
+// Mensaje de un lote junto con el resultado de su parseo
+type itemLote struct {
+	msg      Mensaje
+	transfer types.Transfer
+	kafkaMsg models.KafkaTransferencias
+	fallida  *models.TransferenciaNotificada // != nil si el mensaje no pasó el parseo
+}
+
+// Parsea los mensajes de un lote y arma las transferencias de TB.
+// Los mensajes inválidos no van a TB pero sí se notifican en el webhook.
+func parsearLote(ctx context.Context, tb tigerbeetle.Client, monedas repositorios.Monedas, mensajes []Mensaje) []itemLote {
+	ctx, span := trazas.Tracer().Start(ctx, "ingesta.parsearLote")
+	defer span.End()
+	items := make([]itemLote, 0, len(mensajes))
+
+	for _, msg := range mensajes {
+		transfer, kafkaMsg, err := ParsearMensaje(ctx, tb, monedas, msg.Valor, msg.Formato)
+		kafkaMsg.IdCorrelacion = msg.Correlacion
+		if err != nil {
+			logs.L(logs.Ingesta).WarnContext(ctx, "mensaje inválido, se notificará en el webhook", "origen", msg.Origen, "IdTransferencia", kafkaMsg.IdTransferencia,
+				"IdCorrelacion", msg.Correlacion, logs.Err(err))
+			fallida := models.NewTransferenciaNotificadaParseoError(kafkaMsg, err.Error())
+			items = append(items, itemLote{msg: msg, kafkaMsg: kafkaMsg, fallida: &fallida})
+			continue
+		}
+		items = append(items, itemLote{msg: msg, transfer: transfer, kafkaMsg: kafkaMsg})
+	}
+	return items
+}
+
+// Separa los items en los slices que recibe GestorTransferencias.CrearLote
+func separarItems(items []itemLote) ([]types.Transfer, []models.KafkaTransferencias, []models.TransferenciaNotificada) {
+	transferencias := make([]types.Transfer, 0, len(items))
+	kafkaMsgs := make([]models.KafkaTransferencias, 0, len(items))
+	var fallidasParseo []models.TransferenciaNotificada
+
+	for _, it := range items {
+		if it.fallida != nil {
+			fallidasParseo = append(fallidasParseo, *it.fallida)
+			continue
+		}
+		transferencias = append(transferencias, it.transfer)
+		kafkaMsgs = append(kafkaMsgs, it.kafkaMsg)
+	}
+	return transferencias, kafkaMsgs, fallidasParseo
+}
+
+// Mensaje de transferencia a Transfer de TigerBeetle. Construye DebitAccountID y CreditAccountID a partir de IdUsuarioFinal, IdMoneda y Tipo (I/E).
+// El mensaje se valida contra el esquema de su versión y se actualiza a la versión actual.
+func ParsearMensaje(ctx context.Context, tb tigerbeetle.Client, monedas repositorios.Monedas, valor []byte, formato string) (types.Transfer, models.KafkaTransferencias, error) {
+	kafkaMsg, err := esquemas.Decodificar(valor, formato)
+	if err != nil {
+		return types.Transfer{}, kafkaMsg, err
+	}
+	if kafkaMsg.IdTransferencia == "" {
+		return types.Transfer{}, kafkaMsg, errors.New("IdTransferencia está vacío")
+	}
+	if kafkaMsg.IdUsuarioFinal == 0 {
+		return types.Transfer{}, kafkaMsg, errors.New("IdUsuarioFinal no puede ser cero")
+	}
+	if kafkaMsg.Tipo != "I" && kafkaMsg.Tipo != "E" && kafkaMsg.Tipo != "R" {
+		return types.Transfer{}, kafkaMsg, errors.New("Tipo debe ser 'I' (ingreso), 'E' (egreso) o 'R' (reversión)")
+	}
+	if kafkaMsg.Tipo != "R" && kafkaMsg.Monto <= 0 {
+		return types.Transfer{}, kafkaMsg, errors.New("Monto debe ser mayor a cero")
+	}
+
+	idTransferenciaCast, err := utils.ParsearUint128(kafkaMsg.IdTransferencia)
+	if err != nil {
+		return types.Transfer{}, kafkaMsg, errors.New("IdTransferencia formato incorrecto")
+	}
+
+	// Para Tipo="R", construir la transferencia de reversión a partir de la original
+	if kafkaMsg.Tipo == "R" {
+		return buildReversion(ctx, tb, idTransferenciaCast, kafkaMsg)
+	}
+
+	// Flujo normal para I/E
+	idCuentaUsuarioStr := utils.ConcatenarIDString(uint64(kafkaMsg.IdMoneda), kafkaMsg.IdUsuarioFinal)
+	idCuentaUsuario, err := utils.ParsearUint128(idCuentaUsuarioStr)
+	if err != nil {
+		return types.Transfer{}, kafkaMsg, errors.New("No se pudo construir ID de cuenta usuario")
+	}
+
+	// Obtener IdCuentaEmpresa de la moneda
+	moneda := &models.Monedas{IdMoneda: int(kafkaMsg.IdMoneda)}
+	if mensaje, err := monedas.Dame(ctx, moneda); err != nil || mensaje != "OK" {
+		return types.Transfer{}, kafkaMsg, errors.New("La moneda no existe o no se encuentra activa")
+	}
+	if moneda.IdCuentaEmpresa == "" {
+		return types.Transfer{}, kafkaMsg, errors.New("La moneda no existe o no se encuentra activa")
+	}
+	idCuentaEmpresa, err := utils.ParsearUint128(moneda.IdCuentaEmpresa)
+	if err != nil {
+		return types.Transfer{}, kafkaMsg, errors.New("IdCuentaEmpresa formato incorrecto: " + err.Error())
+	}
+
+	// Asignar débito/crédito según Tipo
+	var debitAccountID, creditAccountID types.Uint128
+	if kafkaMsg.Tipo == "E" {
+		debitAccountID = idCuentaUsuario
+		creditAccountID = idCuentaEmpresa
+	} else {
+		debitAccountID = idCuentaEmpresa
+		creditAccountID = idCuentaUsuario
+	}
+
+	timeStampUint32, _ := utils.FechaAUserData32(kafkaMsg.Fecha)
+	transferencia := types.Transfer{
+		ID:              idTransferenciaCast,
+		DebitAccountID:  debitAccountID,
+		CreditAccountID: creditAccountID,
+		Amount:          types.ToUint128(utils.MontoDecimalAUnidadMinima(kafkaMsg.Monto)),
+		Ledger:          kafkaMsg.IdMoneda,
+		Code:            models.CodigoTransferenciaNormal,
+		UserData128:     types.ToUint128(kafkaMsg.IdUsuarioFinal),
+		UserData64:      kafkaMsg.IdCategoria,
+		UserData32:      timeStampUint32,
+	}
+	return transferencia, kafkaMsg, nil
+}
+
+// construye una transferencia de reversión a partir de la original en TigerBeetle:
+// invierte las cuentas debit/credit
+// mismo monto
+// guarda id original en userdata128
+func buildReversion(ctx context.Context, tb tigerbeetle.Client, idOriginal types.Uint128, kafkaMsg models.KafkaTransferencias) (types.Transfer, models.KafkaTransferencias, error) {
+	if tb == nil {
+		return types.Transfer{}, kafkaMsg, errors.New("Conexión a TigerBeetle no inicializada")
+	}
+
+	originals, err := persistence.TB(ctx, tb).LookupTransfers([]types.Uint128{idOriginal})
+	if err != nil {
+		return types.Transfer{}, kafkaMsg, errors.New("Error al buscar transferencia original: " + err.Error())
+	}
+	if len(originals) == 0 {
+		return types.Transfer{}, kafkaMsg, errors.New("No existe la transferencia a revertir")
+	}
+
+	original := originals[0]
+
+	// bit 64 encendido sobre el ID original
+	IdReversion := original.ID
+	IdReversion[8] |= 0x01
+
+	timeStampUint32, _ := utils.FechaAUserData32(kafkaMsg.Fecha)
+
+	transferencia := types.Transfer{
+		ID:              IdReversion,
+		DebitAccountID:  original.CreditAccountID, // invertido
+		CreditAccountID: original.DebitAccountID,  // invertido
+		Amount:          original.Amount,
+		Ledger:          original.Ledger,
+		Code:            models.CodigoTransferenciaReversion,
+		UserData128:     original.ID, // ref a la original
+		UserData64:      original.UserData64,
+		UserData32:      timeStampUint32,
+	}
+	return transferencia, kafkaMsg, nil
+}
@@ -0,0 +1,54 @@
+package ingesta
+
+import (
+	"context"
+	"errors"
+
+	"MSTransaccionesFinancieras/internal/infra/persistence"
+	"MSTransaccionesFinancieras/internal/models"
+
+	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
+)
+
+// Arma el resultado que tendría el lote sin escribir en TB ni notificar:
+// las transferencias que ya existen en TB se informan como "OK - Reintento", el resto como pendientes.
+func (m *Motor) SimularLote(ctx context.Context, lote Lote) ([]models.TransferenciaNotificada, error) {
+	items := parsearLote(ctx, m.tb, m.monedas, lote.Mensajes)
+
+	ids := make([]types.Uint128, 0, len(items))
+	for _, it := range items {
+		if it.fallida == nil {
+			ids = append(ids, it.transfer.ID)
+		}
+	}
+	existentes := make(map[types.Uint128]bool)
+	if len(ids) > 0 {
+		if m.tb == nil {
+			return nil, errors.New("Conexión a TigerBeetle no inicializada")
+		}
+		transfers, err := persistence.TB(ctx, m.tb).LookupTransfers(ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range transfers {
+			existentes[t.ID] = true
+		}
+	}
+
+	notificaciones := make([]models.TransferenciaNotificada, 0, len(items))
+	for _, it := range items {
+		if it.fallida != nil {
+			notificaciones = append(notificaciones, *it.fallida)
+			continue
+		}
+		if existentes[it.transfer.ID] {
+			notificaciones = append(notificaciones, models.NewTransferenciaNotificada(it.transfer, it.kafkaMsg, types.TransferEventResult{Result: types.TransferExists}))
+			continue
+		}
+		n := models.NewTransferenciaNotificada(it.transfer, it.kafkaMsg, types.TransferEventResult{Result: types.TransferOK})
+		n.Estado = "P"
+		n.Mensaje = "Pendiente - se procesaría"
+		notificaciones = append(notificaciones, n)
+	}
+	return notificaciones, nil
+}
@@ -0,0 +1,34 @@
+package ingesta
+
+import (
+	"context"
+	"log/slog"
+
+	"MSTransaccionesFinancieras/internal/infra/logs"
+	"MSTransaccionesFinancieras/internal/infra/trazas"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Asigna un id al lote, que se agrega a todas las líneas de log con el ctx devuelto, e inicia su span.
+// Un lote agrupa mensajes de distintas trazas (cada productor o request HTTP), así que en lugar de
+// un padre único el span se enlaza a cada una.
+func (m *Motor) iniciarLote(ctx context.Context, nombre string, lote Lote) (context.Context, trace.Span) {
+	idLote := m.secuenciaLotes.Add(1)
+	ctx = logs.ConAtributos(ctx, slog.Uint64("lote", idLote), slog.String("fuente", lote.Fuente))
+
+	enlaces := make([]trace.Link, 0, len(lote.Mensajes))
+	for _, m := range lote.Mensajes {
+		if m.Traza.IsValid() {
+			enlaces = append(enlaces, trace.Link{SpanContext: m.Traza})
+		}
+	}
+	return trazas.Tracer().Start(ctx, nombre,
+		trace.WithLinks(enlaces...),
+		trace.WithAttributes(
+			attribute.Int64("ingesta.lote", int64(idLote)),
+			attribute.String("ingesta.fuente", lote.Fuente),
+			attribute.Int("ingesta.mensajes", len(lote.Mensajes)),
+		))
+}
@@ -0,0 +1,79 @@
+package ingesta
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/config"
+	"MSTransaccionesFinancieras/internal/infra/trazas"
+	"MSTransaccionesFinancieras/internal/infra/webhook"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Registra en memoria los spans del test y vuelve al provider no-op al terminar
+func grabarSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	if _, err := trazas.Init(config.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	grabador := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(grabador)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	return grabador
+}
+
+// El span del lote se enlaza a la traza de cada mensaje, y las llamadas a TB y al webhook quedan dentro de
+// la traza del lote, que llega al webhook en el header traceparent
+func TestTrazasLote(t *testing.T) {
+	grabador := grabarSpans(t)
+	motor, _ := nuevoMotorTest(t, "")
+	var traceparent atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent.Store(r.Header.Get("traceparent"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	webhook.Init(config.Config{URLWebhook: srv.URL})
+
+	var confirmados, aislados atomic.Int32
+	lote := loteTest(t, 2, &confirmados, &aislados)
+	idTraza, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	idSpan, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	productor := trace.NewSpanContext(trace.SpanContextConfig{TraceID: idTraza, SpanID: idSpan, TraceFlags: trace.FlagsSampled, Remote: true})
+	lote.Mensajes[0].Traza = productor
+	if err := motor.ProcesarConReintentos(t.Context(), lote, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range grabador.Ended() {
+		spans[s.Name()] = s
+	}
+	spanLote, ok := spans["ingesta.ProcesarConReintentos"]
+	if !ok {
+		t.Fatalf("sin span del lote: %v", spans)
+	}
+	if l := spanLote.Links(); len(l) != 1 || l[0].SpanContext.TraceID() != idTraza || l[0].SpanContext.SpanID() != idSpan {
+		t.Fatalf("enlaces del lote: %+v, se esperaba solo el del mensaje con traza", l)
+	}
+	for _, nombre := range []string{"ingesta.parsearLote", "GestorTransferencias.CrearLote", "tigerbeetle.CreateTransfers", "webhook.NotificarTransferencias"} {
+		s, ok := spans[nombre]
+		if !ok {
+			t.Fatalf("sin span %s", nombre)
+		}
+		if s.SpanContext().TraceID() != spanLote.SpanContext().TraceID() {
+			t.Fatalf("el span %s no está en la traza del lote", nombre)
+		}
+	}
+	if h, _ := traceparent.Load().(string); !strings.Contains(h, spanLote.SpanContext().TraceID().String()) {
+		t.Fatalf("traceparent recibido por el webhook: %q, se esperaba la traza %s", h, spanLote.SpanContext().TraceID())
+	}
+}
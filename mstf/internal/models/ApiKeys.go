@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// API key de un sistema cliente externo (actor SISTEMA). Se guarda su SHA-256: ApiKey solo se informa al
+// crearla o rotarla. Prefijo: primeros caracteres de la API key, para identificarla.
+// Alcances: ver auth.Alcances. IPsPermitidas: IPs o redes CIDR (vacía: cualquiera).
+// FechaExpiracion nil: no vence. Estado: A (activa) o R (revocada).
+type ApiKeys struct {
+	IdApiKey        int        `json:"IdApiKey"`
+	Nombre          string     `json:"Nombre"`
+	Sistema         string     `json:"Sistema"`
+	Prefijo         string     `json:"Prefijo"`
+	Alcances        []string   `json:"Alcances"`
+	IPsPermitidas   []string   `json:"IPsPermitidas"`
+	FechaAlta       time.Time  `json:"FechaAlta"`
+	FechaExpiracion *time.Time `json:"FechaExpiracion"`
+	FechaUltimoUso  *time.Time `json:"FechaUltimoUso"`
+	Estado          string     `json:"Estado"`
+	ApiKey          string     `json:"ApiKey,omitempty"`
+}
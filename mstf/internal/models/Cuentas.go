@@ -3,12 +3,12 @@ package models
 import (
 	"errors"
 	"fmt"
-	"strconv"
 	"time"
 
-	"MSTransaccionesFinancieras/internal/infra/persistence"
+	"MSTransaccionesFinancieras/internal/infra/logs"
 	"MSTransaccionesFinancieras/internal/utils"
 
+	tigerbeetle "github.com/tigerbeetle/tigerbeetle-go"
 	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
 )
 
@@ -27,18 +27,18 @@ type Cuentas struct {
 const limiteHistorialBalancesPorDefecto uint32 = 100
 
 // Instancia los datos de la cuenta leyendo desde TigerBeetle a partir de IdUsuarioFinal e IdMoneda
-func (c *Cuentas) Dame() error {
+func (c *Cuentas) Dame(ClienteTB tigerbeetle.Client) error {
 	idCuentaStr := utils.ConcatenarIDString(uint64(c.IdMoneda), c.IdUsuarioFinal)
 	idCuentaCast, err := utils.ParsearUint128(idCuentaStr)
 	if err != nil {
 		return errors.New("Error al construir IdCuenta: " + err.Error())
 	}
 
-	if persistence.ClienteTB == nil {
+	if ClienteTB == nil {
 		return errors.New("Conexión a TigerBeetle no inicializada")
 	}
 
-	accounts, err := persistence.ClienteTB.LookupAccounts([]types.Uint128{idCuentaCast})
+	accounts, err := ClienteTB.LookupAccounts([]types.Uint128{idCuentaCast})
 	if err != nil {
 		return err
 	}
@@ -84,19 +84,19 @@ func (c *Cuentas) Dame() error {
 // - FechaInicio: timestamp mínimo (inclusive) de las transferencias a buscar
 // - FechaFin: timestamp máximo (inclusive) de las transferencias a buscar
 // - Limite: cantidad máxima de transferencias a retornar (si es 0, se usa un valor por defecto)
-func (c *Cuentas) ListarTransferenciasCuenta(FechaInicio uint64, FechaFin uint64, Limite uint32) ([]types.Transfer, error) {
+func (c *Cuentas) ListarTransferenciasCuenta(ClienteTB tigerbeetle.Client, FechaInicio uint64, FechaFin uint64, Limite uint32) ([]types.Transfer, error) {
 	idCuentaStr := utils.ConcatenarIDString(uint64(c.IdMoneda), c.IdUsuarioFinal)
 	idCuentaCast, err := utils.ParsearUint128(idCuentaStr)
 	if err != nil {
 		return nil, errors.New("Error al construir IdCuenta: " + err.Error())
 	}
 
-	if persistence.ClienteTB == nil {
+	if ClienteTB == nil {
 		return nil, errors.New("Conexión a TigerBeetle no inicializada")
 	}
 
 	if Limite <= 0 {
-		Limite = obtenerLimiteHistorialBalances()
+		Limite = limiteHistorialBalancesPorDefecto
 	}
 
 	filtro := types.AccountFilter{
@@ -107,7 +107,7 @@ func (c *Cuentas) ListarTransferenciasCuenta(FechaInicio uint64, FechaFin uint64
 		Flags:        7, // Debits(1) + Credits(2) + Reversed(4)
 	}
 
-	return persistence.ClienteTB.GetAccountTransfers(filtro)
+	return ClienteTB.GetAccountTransfers(filtro)
 }
 
 // Busca el historial de balances de la cuenta en un rango de fechas, con un límite máximo de resultados
@@ -115,19 +115,19 @@ func (c *Cuentas) ListarTransferenciasCuenta(FechaInicio uint64, FechaFin uint64
 // - FechaInicio: timestamp mínimo (inclusive) de los balances a buscar
 // - FechaFin: timestamp máximo (inclusive) de los balances a buscar
 // - Limite: cantidad máxima de balances a retornar (si es 0, se usa un valor por defecto)
-func (c *Cuentas) ListarHistorialBalances(FechaInicio uint64, FechaFin uint64, Limite uint32) ([]types.AccountBalance, error) {
+func (c *Cuentas) ListarHistorialBalances(ClienteTB tigerbeetle.Client, FechaInicio uint64, FechaFin uint64, Limite uint32) ([]types.AccountBalance, error) {
 	idCuentaStr := utils.ConcatenarIDString(uint64(c.IdMoneda), c.IdUsuarioFinal)
 	idCuentaCast, err := utils.ParsearUint128(idCuentaStr)
 	if err != nil {
 		return nil, errors.New("Error al construir IdCuenta: " + err.Error())
 	}
 
-	if persistence.ClienteTB == nil {
+	if ClienteTB == nil {
 		return nil, errors.New("Conexión a TigerBeetle no inicializada")
 	}
 
 	if Limite <= 0 {
-		Limite = obtenerLimiteHistorialBalances()
+		Limite = limiteHistorialBalancesPorDefecto
 	}
 
 	filtro := types.AccountFilter{
@@ -138,7 +138,7 @@ func (c *Cuentas) ListarHistorialBalances(FechaInicio uint64, FechaFin uint64, L
 		Flags:        7, // Debits(1) + Credits(2) + Reversed(4)
 	}
 
-	balances, err := persistence.ClienteTB.GetAccountBalances(filtro)
+	balances, err := ClienteTB.GetAccountBalances(filtro)
 	if err != nil {
 		return nil, err
 	}
@@ -148,23 +148,20 @@ func (c *Cuentas) ListarHistorialBalances(FechaInicio uint64, FechaFin uint64, L
 // Cierra una cuenta en TigerBeetle creando un pending transfer con closing_debit.
 // La cuenta empresa de la moneda actúa como cuenta crédito (monto 0, no se transfiere dinero).
 // Idempotente: si la cuenta ya está cerrada, retorna nil.
-func (c *Cuentas) Desactivar() error {
+// - Moneda: moneda de la cuenta, instanciada por el llamador
+func (c *Cuentas) Desactivar(ClienteTB tigerbeetle.Client, Moneda Monedas) error {
 	idMoneda := c.IdMoneda
 	idUsuarioFinal := c.IdUsuarioFinal
 
-	if persistence.ClienteTB == nil {
+	if ClienteTB == nil {
 		return errors.New("Conexión a TigerBeetle no inicializada")
 	}
 
-	moneda := &Monedas{IdMoneda: int(idMoneda)}
-	if _, err := moneda.Dame(); err != nil {
-		return errors.New("La moneda no existe o no está activa")
-	}
-	if moneda.Estado != "A" || moneda.IdCuentaEmpresa == "" {
+	if Moneda.IdMoneda != int(idMoneda) || Moneda.Estado != "A" || Moneda.IdCuentaEmpresa == "" {
 		return errors.New("La moneda no existe o no está activa")
 	}
 
-	idCuentaEmpresa, err := utils.ParsearUint128(moneda.IdCuentaEmpresa)
+	idCuentaEmpresa, err := utils.ParsearUint128(Moneda.IdCuentaEmpresa)
 	if err != nil {
 		return errors.New("IdCuentaEmpresa formato incorrecto")
 	}
@@ -179,7 +176,7 @@ func (c *Cuentas) Desactivar() error {
 		return errors.New("No se puede desactivar la cuenta empresa")
 	}
 
-	accounts, err := persistence.ClienteTB.LookupAccounts([]types.Uint128{idCuenta})
+	accounts, err := ClienteTB.LookupAccounts([]types.Uint128{idCuenta})
 	if err != nil {
 		return errors.New("error de comunicación con TigerBeetle")
 	}
@@ -189,7 +186,7 @@ func (c *Cuentas) Desactivar() error {
 
 	flagCerrada := types.AccountFlags{Closed: true}.ToUint16()
 	if (accounts[0].Flags & flagCerrada) != 0 {
-		//log.Printf("GestorCuentas.Desactivar: cuenta %s ya estaba cerrada", idCuentaStr)
+		logs.L(logs.Cuentas).Debug("Desactivar: la cuenta ya estaba cerrada", "IdCuenta", idCuentaStr)
 		return nil
 	}
 
@@ -214,7 +211,7 @@ func (c *Cuentas) Desactivar() error {
 		}.ToUint16(),
 	}
 
-	results, err := persistence.ClienteTB.CreateTransfers([]types.Transfer{closingTransfer})
+	results, err := ClienteTB.CreateTransfers([]types.Transfer{closingTransfer})
 	if err != nil {
 		return errors.New("error de comunicación con TigerBeetle")
 	}
@@ -222,7 +219,7 @@ func (c *Cuentas) Desactivar() error {
 		return fmt.Errorf("error al desactivar cuenta: %s", results[0].Result.String())
 	}
 
-	//log.Printf("GestorCuentas.Desactivar: cuenta %s desactivada exitosamente", idCuentaStr)
+	logs.L(logs.Cuentas).Info("cuenta desactivada", "IdCuenta", idCuentaStr, "IdMoneda", idMoneda)
 	return nil
 }
 
@@ -230,11 +227,11 @@ func (c *Cuentas) Desactivar() error {
 // Busca la transfer de cierre como la más reciente en débito de la cuenta (la única posible
 // tras el cierre, ya que TB rechaza nuevas transfers sobre cuentas cerradas).
 // Idempotente: si la cuenta ya está activa, retorna nil.
-func (c *Cuentas) Activar() error {
+func (c *Cuentas) Activar(ClienteTB tigerbeetle.Client) error {
 	idMoneda := c.IdMoneda
 	idUsuarioFinal := c.IdUsuarioFinal
 
-	if persistence.ClienteTB == nil {
+	if ClienteTB == nil {
 		return errors.New("Conexión a TigerBeetle no inicializada")
 	}
 
@@ -244,7 +241,7 @@ func (c *Cuentas) Activar() error {
 		return errors.New("Error al construir IdCuenta")
 	}
 
-	accounts, err := persistence.ClienteTB.LookupAccounts([]types.Uint128{idCuenta})
+	accounts, err := ClienteTB.LookupAccounts([]types.Uint128{idCuenta})
 	if err != nil {
 		return errors.New("error de comunicación con TigerBeetle")
 	}
@@ -254,7 +251,7 @@ func (c *Cuentas) Activar() error {
 
 	flagCerrada := types.AccountFlags{Closed: true}.ToUint16()
 	if (accounts[0].Flags & flagCerrada) == 0 {
-		//log.Printf("GestorCuentas.Activar: cuenta %s ya estaba activa", idCuentaStr)
+		logs.L(logs.Cuentas).Debug("Activar: la cuenta ya estaba activa", "IdCuenta", idCuentaStr)
 		return nil
 	}
 
@@ -265,7 +262,7 @@ func (c *Cuentas) Activar() error {
 		Limit:     1,
 		Flags:     5, // Debits(1) + Reversed(4)
 	}
-	transfers, err := persistence.ClienteTB.GetAccountTransfers(filtro)
+	transfers, err := ClienteTB.GetAccountTransfers(filtro)
 	if err != nil {
 		return errors.New("error de comunicación con TigerBeetle")
 	}
@@ -293,7 +290,7 @@ func (c *Cuentas) Activar() error {
 		Flags:     types.TransferFlags{VoidPendingTransfer: true}.ToUint16(),
 	}
 
-	results, err := persistence.ClienteTB.CreateTransfers([]types.Transfer{voidTransfer})
+	results, err := ClienteTB.CreateTransfers([]types.Transfer{voidTransfer})
 	if err != nil {
 		return errors.New("error de comunicación con TigerBeetle")
 	}
@@ -301,21 +298,6 @@ func (c *Cuentas) Activar() error {
 		return fmt.Errorf("error al activar cuenta: %s", results[0].Result.String())
 	}
 
-	//log.Printf("GestorCuentas.Activar: cuenta %s activada exitosamente", idCuentaStr)
+	logs.L(logs.Cuentas).Info("cuenta activada", "IdCuenta", idCuentaStr, "IdMoneda", idMoneda)
 	return nil
 }
-
-// --------------------------------------------------------------------------------
-// Funciones aux
-// --------------------------------------------------------------------------------
-func obtenerLimiteHistorialBalances() uint32 {
-	p := &Parametros{Parametro: "LIMITEHISTORIALBALANCE"}
-	if _, err := p.Dame(); err != nil || p.Valor == "" {
-		return limiteHistorialBalancesPorDefecto
-	}
-	val, err := strconv.ParseUint(p.Valor, 10, 32)
-	if err != nil {
-		return limiteHistorialBalancesPorDefecto
-	}
-	return uint32(val)
-}
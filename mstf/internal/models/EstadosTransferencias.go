@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Último resultado notificado de una transferencia, junto con el IdCorrelacion de la request
+// o mensaje que la originó. Permite rastrear una transferencia de punta a punta.
+type EstadosTransferencias struct {
+	IdTransferencia   string    `json:"IdTransferencia"`
+	IdCorrelacion     string    `json:"IdCorrelacion"`
+	Estado            string    `json:"Estado"`
+	Mensaje           string    `json:"Mensaje"`
+	Tipo              string    `json:"Tipo"`
+	IdMoneda          uint32    `json:"IdMoneda"`
+	IdUsuarioFinal    uint64    `json:"IdUsuarioFinal"`
+	FechaAlta         time.Time `json:"FechaAlta"`
+	FechaModificacion time.Time `json:"FechaModificacion"`
+}
@@ -9,4 +9,6 @@ type KafkaTransferencias struct {
 	Tipo            string `json:"Tipo"`
 	IdCategoria     uint64 `json:"IdCategoria"`
 	Fecha           string `json:"Fecha"`
+	// No viaja en el payload: se toma del header de correlación del mensaje
+	IdCorrelacion string `json:"-"`
 }
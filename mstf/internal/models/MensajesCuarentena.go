@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Mensaje de ingesta aislado por el consumidor: su lote falló repetidamente y la bisección
+// determinó que este mensaje es la causa. No se procesa ni se notifica, queda para revisión manual.
+type MensajesCuarentena struct {
+	IdMensaje       int       `json:"IdMensaje"`
+	Origen          string    `json:"Origen"`
+	IdTransferencia string    `json:"IdTransferencia"`
+	Contenido       string    `json:"Contenido"`
+	Error           string    `json:"Error"`
+	FechaAlta       time.Time `json:"FechaAlta"`
+}
@@ -18,6 +18,7 @@ type TransferenciaNotificada struct {
 	Estado          string `json:"Estado"`
 	Mensaje         string `json:"Mensaje"`
 	Fecha           string `json:"Fecha"`
+	IdCorrelacion   string `json:"IdCorrelacion"`
 }
 
 // struct que se envía a traves del Webhook
@@ -64,6 +65,7 @@ func NewTransferenciaNotificada(transfer types.Transfer, kafkaMsg KafkaTransfere
 		Estado:          estado,
 		Mensaje:         mensaje,
 		Fecha:           fecha,
+		IdCorrelacion:   kafkaMsg.IdCorrelacion,
 	}
 }
 
@@ -83,6 +85,7 @@ func NewTransferenciaNotificadaError(transfer types.Transfer, kafkaMsg KafkaTran
 		Estado:          "E",
 		Mensaje:         mensajeError,
 		Fecha:           fecha,
+		IdCorrelacion:   kafkaMsg.IdCorrelacion,
 	}
 }
 
@@ -106,5 +109,6 @@ func NewTransferenciaNotificadaParseoError(kafkaMsg KafkaTransferencias, mensaje
 		Estado:          "E",
 		Mensaje:         mensajeError,
 		Fecha:           fecha,
+		IdCorrelacion:   kafkaMsg.IdCorrelacion,
 	}
 }
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Operación auditada. IdUsuario es nil cuando la realizó el sistema.
+// TipoOperacion: CM, AM, DM, BM (monedas) - MP (parámetros) - CU, AU, DU, BU (usuarios) - RS (sesiones) -
+// CR, MR, BR, AR (roles) - CK, RK, VK (API keys) - RF (segundo factor) - CC, AC, DC (cuentas) - RT (reversiones)
+// Hash encadena la operación con la anterior (ver CalcularHash).
+type Operaciones struct {
+	IdOperacion    int             `json:"IdOperacion"`
+	IdUsuario      *int            `json:"IdUsuario"`
+	TipoOperacion  string          `json:"TipoOperacion"`
+	FechaOperacion time.Time       `json:"FechaOperacion"`
+	Detalles       json.RawMessage `json:"Detalles"`
+	Hash           string          `json:"Hash"`
+}
+
+// Operaciones sobre TigerBeetle que audita el MS; las administrativas las auditan los SPs.
+// Detalles incluye el estado de la cuenta o transferencia antes y después de la operación (Antes, Despues).
+const (
+	OperacionCreacionCuenta         = "CC"
+	OperacionActivacionCuenta       = "AC"
+	OperacionDesactivacionCuenta    = "DC"
+	OperacionReversionTransferencia = "RT"
+)
+
+// Hash anterior a la primera operación de la cadena
+var HashInicialOperaciones = strings.Repeat("0", 64)
+
+// Hash de la operación encadenada con la anterior, igual que trg_operaciones_encadenar: SHA-256 en hexadecimal de
+// 'HashAnterior|IdOperacion|IdUsuario|TipoOperacion|FechaOperacion|Detalles', con IdUsuario vacío para el sistema
+// y FechaOperacion como 'YYYY-MM-DD HH:MM:SS' en su zona horaria. Detalles es el JSON tal como lo devuelve MySQL.
+func (o Operaciones) CalcularHash(HashAnterior string) string {
+	idUsuario := ""
+	if o.IdUsuario != nil {
+		idUsuario = strconv.Itoa(*o.IdUsuario)
+	}
+	contenido := strings.Join([]string{
+		HashAnterior,
+		strconv.Itoa(o.IdOperacion),
+		idUsuario,
+		o.TipoOperacion,
+		o.FechaOperacion.Format(time.DateTime),
+		string(o.Detalles),
+	}, "|")
+	h := sha256.Sum256([]byte(contenido))
+	return hex.EncodeToString(h[:])
+}
+
+// Anclaje de la cadena de Operaciones: la cabeza de la cadena (IdOperacion y Hash de la última operación) en una
+// fecha, firmada con la clave ed25519 del MS. Se publica fuera de MySQL (archivo o topic de Kafka), así que quien
+// reescriba la cadena completa no puede hacer coincidir los anclajes anteriores.
+type AnclajesOperaciones struct {
+	IdOperacion int       `json:"IdOperacion"`
+	Hash        string    `json:"Hash"`
+	Fecha       time.Time `json:"Fecha"`
+	// Firma ed25519 en base64 de 'IdOperacion|Hash|Fecha' (Fecha en RFC 3339 UTC)
+	Firma string `json:"Firma"`
+}
+
+func (a AnclajesOperaciones) mensaje() []byte {
+	return fmt.Appendf(nil, "%d|%s|%s", a.IdOperacion, a.Hash, a.Fecha.UTC().Format(time.RFC3339Nano))
+}
+
+// Firma el anclaje con la clave privada del MS
+func (a *AnclajesOperaciones) Firmar(Clave ed25519.PrivateKey) {
+	a.Firma = base64.StdEncoding.EncodeToString(ed25519.Sign(Clave, a.mensaje()))
+}
+
+// La firma del anclaje corresponde a la clave pública
+func (a AnclajesOperaciones) FirmaValida(Clave ed25519.PublicKey) bool {
+	firma, err := base64.StdEncoding.DecodeString(a.Firma)
+	return err == nil && len(Clave) == ed25519.PublicKeySize && ed25519.Verify(Clave, a.mensaje(), firma)
+}
+
+// Resultado de verificar la cadena de Operaciones
+type VerificacionOperaciones struct {
+	// Ninguna incidencia
+	Integra bool `json:"Integra"`
+	// Cabeza de la cadena según CadenaOperaciones
+	IdOperacion int    `json:"IdOperacion"`
+	Hash        string `json:"Hash"`
+	// Operaciones recorridas y anclajes con firma válida comparados con la cadena
+	OperacionesVerificadas int                      `json:"OperacionesVerificadas"`
+	AnclajesVerificados    int                      `json:"AnclajesVerificados"`
+	Incidencias            []IncidenciasOperaciones `json:"Incidencias"`
+}
+
+// Tipos de incidencia de la verificación de la cadena
+const (
+	// El contenido o el Hash de la operación no coinciden con la cadena o con un anclaje
+	IncidenciaOperacionModificada = "MODIFICADA"
+	// Faltan operaciones en la cadena (huecos de IdOperacion o posteriores a la última)
+	IncidenciaOperacionEliminada = "ELIMINADA"
+	// Anclaje con firma inválida: no lo generó el MS o fue alterado
+	IncidenciaAnclajeInvalido = "ANCLAJE_INVALIDO"
+)
+
+type IncidenciasOperaciones struct {
+	IdOperacion int    `json:"IdOperacion"`
+	Tipo        string `json:"Tipo"`
+	Detalle     string `json:"Detalle"`
+}
@@ -0,0 +1,16 @@
+package models
+
+// Rol de los usuarios administrativos con los permisos que otorga (ver auth.Permisos).
+// Usuarios: cantidad de usuarios con el rol (solo al listar).
+type Roles struct {
+	Rol      string   `json:"Rol"`
+	Nombre   string   `json:"Nombre"`
+	Permisos []string `json:"Permisos"`
+	Usuarios int      `json:"Usuarios"`
+}
+
+// Permiso del catálogo que se puede otorgar a los roles
+type Permisos struct {
+	Permiso     string `json:"Permiso"`
+	Descripcion string `json:"Descripcion"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Segundo factor (TOTP, RFC 6238) de un usuario administrativo. El secreto no se informa en la API salvo al
+// iniciar la inscripción.
+// Estado: "" sin segundo factor, P pendiente de verificar el primer código, A activo.
+// UltimoPaso: último paso de 30 segundos aceptado, para que un código no se pueda usar dos veces.
+type SegundoFactor struct {
+	IdUsuario  int
+	Usuario    string
+	Secreto    string
+	Estado     string
+	UltimoPaso int64
+}
+
+// Desafío de login: la contraseña es correcta pero la sesión se crea recién al validar el segundo factor.
+// Inscripcion indica que el usuario todavía no tiene segundo factor y su rol lo exige, por lo que primero
+// debe inscribirse. TokenDesafio solo se informa al crearlo: se guarda su SHA-256.
+type DesafiosLogin struct {
+	TokenDesafio    string    `json:"TokenDesafio"`
+	Inscripcion     bool      `json:"Inscripcion"`
+	FechaExpiracion time.Time `json:"FechaExpiracion"`
+}
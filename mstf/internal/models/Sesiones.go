@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Sesión de un usuario administrativo (una por dispositivo). TokenSesion y RefreshToken solo se informan
+// al crearla o renovarla: se guarda su SHA-256.
+type Sesiones struct {
+	IdSesion             int       `json:"IdSesion"`
+	IdUsuario            int       `json:"IdUsuario"`
+	Dispositivo          string    `json:"Dispositivo"`
+	IP                   string    `json:"IP"`
+	FechaInicio          time.Time `json:"FechaInicio"`
+	FechaUltimoUso       time.Time `json:"FechaUltimoUso"`
+	FechaExpiracionToken time.Time `json:"FechaExpiracionToken"`
+	FechaExpiracion      time.Time `json:"FechaExpiracion"`
+	Actual               bool      `json:"Actual"`
+	TokenSesion          string    `json:"TokenSesion,omitempty"`
+	RefreshToken         string    `json:"RefreshToken,omitempty"`
+}
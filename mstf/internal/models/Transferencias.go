@@ -4,9 +4,9 @@ import (
 	"encoding/binary"
 	"errors"
 
-	"MSTransaccionesFinancieras/internal/infra/persistence"
 	"MSTransaccionesFinancieras/internal/utils"
 
+	tigerbeetle "github.com/tigerbeetle/tigerbeetle-go"
 	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
 )
 
@@ -31,7 +31,7 @@ type Transferencias struct {
 }
 
 // Instancia los datos de la transferencia leyendo desde TigerBeetle a partir del IdTransferencia
-func (t *Transferencias) Dame() error {
+func (t *Transferencias) Dame(ClienteTB tigerbeetle.Client) error {
 	idTransferenciaCast, err := utils.ParsearUint128(t.IdTransferencia)
 	if err != nil {
 		return errors.New("IdTransferencia inválido: " + err.Error())
@@ -41,11 +41,11 @@ func (t *Transferencias) Dame() error {
 		return errors.New("IdTransferencia no puede ser nulo ni cero")
 	}
 
-	if persistence.ClienteTB == nil {
+	if ClienteTB == nil {
 		return errors.New("Conexión a TigerBeetle no inicializada")
 	}
 
-	transfers, err := persistence.ClienteTB.LookupTransfers([]types.Uint128{idTransferenciaCast})
+	transfers, err := ClienteTB.LookupTransfers([]types.Uint128{idTransferenciaCast})
 	if err != nil {
 		return err
 	}
@@ -80,44 +80,51 @@ func (t *Transferencias) Dame() error {
 		t.Estado = "F"
 		idReversion := transferenciaTB.ID
 		idReversion[8] |= 0x01
-		reversiones, errLookup := persistence.ClienteTB.LookupTransfers([]types.Uint128{idReversion})
+		reversiones, errLookup := ClienteTB.LookupTransfers([]types.Uint128{idReversion})
 		if errLookup == nil && len(reversiones) > 0 && reversiones[0].Code == CodigoTransferenciaReversion {
 			t.Estado = "R"
 		}
 	}
 
-	// Deriva Tipo e IdUsuarioFinal comparando DebitAccountID/CreditAccountID con la cuenta empresa
-	moneda := &Monedas{IdMoneda: int(transferenciaTB.Ledger)}
-	if _, err := moneda.Dame(); err == nil && moneda.IdCuentaEmpresa != "" {
-		idCuentaEmpresa, errParse := utils.ParsearUint128(moneda.IdCuentaEmpresa)
-		if errParse == nil {
-			var idCuentaUsuario types.Uint128
-			if code == CodigoTransferenciaReversion {
-				t.Tipo = "R"
-				// En reversión: cuentas invertidas
-				if transferenciaTB.DebitAccountID == idCuentaEmpresa {
-					idCuentaUsuario = transferenciaTB.CreditAccountID
-				} else {
-					idCuentaUsuario = transferenciaTB.DebitAccountID
-				}
-			} else {
-				if transferenciaTB.DebitAccountID == idCuentaEmpresa {
-					t.Tipo = "I"
-					idCuentaUsuario = transferenciaTB.CreditAccountID
-				} else if transferenciaTB.CreditAccountID == idCuentaEmpresa {
-					t.Tipo = "E"
-					idCuentaUsuario = transferenciaTB.DebitAccountID
-				}
-			}
-
-			cuentas, errLookup := persistence.ClienteTB.LookupAccounts([]types.Uint128{idCuentaUsuario})
-			if errLookup == nil && len(cuentas) > 0 {
-				t.IdUsuarioFinal = cuentas[0].UserData64
-			}
+	return nil
+}
+
+// Deriva Tipo e IdUsuarioFinal comparando las cuentas débito/crédito con la cuenta empresa de la moneda.
+// Requiere una transferencia instanciada con Dame. Si IdCuentaEmpresa no es válido no modifica nada.
+func (t *Transferencias) DerivarTipo(ClienteTB tigerbeetle.Client, IdCuentaEmpresa string) {
+	idCuentaEmpresa, err := utils.ParsearUint128(IdCuentaEmpresa)
+	if err != nil || IdCuentaEmpresa == "" {
+		return
+	}
+	idCuentaDebito, errDebito := utils.ParsearUint128(t.IdCuentaDebito)
+	idCuentaCredito, errCredito := utils.ParsearUint128(t.IdCuentaCredito)
+	if errDebito != nil || errCredito != nil {
+		return
+	}
+
+	var idCuentaUsuario types.Uint128
+	if t.IdTransferenciaOriginal != "" {
+		t.Tipo = "R"
+		// En reversión: cuentas invertidas
+		if idCuentaDebito == idCuentaEmpresa {
+			idCuentaUsuario = idCuentaCredito
+		} else {
+			idCuentaUsuario = idCuentaDebito
+		}
+	} else {
+		if idCuentaDebito == idCuentaEmpresa {
+			t.Tipo = "I"
+			idCuentaUsuario = idCuentaCredito
+		} else if idCuentaCredito == idCuentaEmpresa {
+			t.Tipo = "E"
+			idCuentaUsuario = idCuentaDebito
 		}
 	}
 
-	return nil
+	cuentas, errLookup := ClienteTB.LookupAccounts([]types.Uint128{idCuentaUsuario})
+	if errLookup == nil && len(cuentas) > 0 {
+		t.IdUsuarioFinal = cuentas[0].UserData64
+	}
 }
 
 // Puebla el struct con los datos directamente disponibles en el Transfer de TB,
@@ -0,0 +1,240 @@
+package repositorios
+
+import (
+	"MSTransaccionesFinancieras/internal/models"
+	"context"
+	"time"
+)
+
+// Acceso a los datos administrativos del MS (MySQL). Hay dos implementaciones: sps (stored procedures,
+// producción) y memoria (tests), que devuelven los mismos mensajes: "OK" o el error de negocio como texto.
+// Las operaciones que auditan o validan permisos toman la credencial y el actor del contexto (ver auth).
+
+type Parametros interface {
+	// Instancia el parámetro por su clave (p.Parametro)
+	Dame(ctx context.Context, p *models.Parametros) (string, error)
+	// Busca los parámetros cuyo nombre contiene Cadena, ordenados por nombre. SoloModificables: 'S' o 'N'
+	Buscar(ctx context.Context, Cadena string, SoloModificables string) ([]models.Parametros, error)
+	// Modifica el valor de un parámetro modificable y audita el cambio (MP)
+	Modificar(ctx context.Context, Parametro string, Valor string) (string, error)
+}
+
+type Monedas interface {
+	// Instancia la moneda por su Id (m.IdMoneda)
+	Dame(ctx context.Context, m *models.Monedas) (string, error)
+	// IncluyeInactivos: 'N' solo activas, 'S' activas e inactivas, 'T' todas (incluye pendientes)
+	Listar(ctx context.Context, IncluyeInactivos string) ([]models.Monedas, error)
+	// Crea la moneda en estado P: Pendiente (CM)
+	Crear(ctx context.Context, Moneda models.Monedas) (string, error)
+	// P | I -> A (AM)
+	Activar(ctx context.Context, IdMoneda int) (string, error)
+	// A -> I (DM)
+	Desactivar(ctx context.Context, IdMoneda int) (string, error)
+	// Borra una moneda en estado P o I (BM)
+	Borrar(ctx context.Context, IdMoneda int) (string, error)
+}
+
+type Usuarios interface {
+	// Instancia el usuario por su Id (u.IdUsuario)
+	Dame(ctx context.Context, u *models.Usuarios) (string, error)
+	// IncluyeInactivos: 'S' todos, 'N' solo activos. Ordena por nombre de usuario
+	Buscar(ctx context.Context, Cadena string, IncluyeInactivos string) ([]*models.Usuarios, error)
+	// Crea el usuario en estado P con el hash de su contraseña temporal (CU). Devuelve mensaje e Id
+	Crear(ctx context.Context, Usuario string, Password string) (string, int, error)
+	// I -> A (AU)
+	Activar(ctx context.Context, IdUsuario int) (string, error)
+	// A | P -> I, cierra sus sesiones (DU)
+	Desactivar(ctx context.Context, IdUsuario int) (string, error)
+	// Borra un usuario no activo y sin operaciones auditadas (BU)
+	Borrar(ctx context.Context, IdUsuario int) (string, error)
+	// Id y hash de contraseña guardado del usuario (0 y "" si no existe). La verificación se hace en el MS
+	DamePassword(ctx context.Context, Usuario string) (int, string, error)
+	// Id y hash de contraseña guardado del usuario activo del token del contexto (0 y "" si la sesión no es válida)
+	DamePasswordSesion(ctx context.Context) (int, string, error)
+	// Reemplaza el hash de la contraseña solo si sigue siendo PasswordAnterior (migración desde MD5 o a
+	// nuevos parámetros de argon2id, en el login)
+	MigrarPassword(ctx context.Context, IdUsuario int, PasswordAnterior string, PasswordNuevo string) (string, error)
+	// Crea una sesión con s.TokenSesion, s.RefreshToken, s.Dispositivo y s.IP si Password es el hash guardado
+	// (ya verificado con DamePassword). Instancia u con los datos del usuario y s con los de la sesión.
+	// Si el usuario activo tiene segundo factor o su rol lo exige (Politica.RolesSegundoFactor), en lugar de la
+	// sesión crea el desafío d.TokenDesafio e instancia d (ver SegundoFactor.CompletarLogin)
+	Login(ctx context.Context, u *models.Usuarios, Password string, s *models.Sesiones, d *models.DesafiosLogin, Politica PoliticaSesion) (string, error)
+	// Cierra la sesión del token del contexto
+	Logout(ctx context.Context) (string, error)
+	// P -> A con el hash de la contraseña definitiva, identificando al usuario por el token del contexto.
+	// Cierra sus sesiones
+	ConfirmarCuenta(ctx context.Context, Password string) (string, error)
+	// Reemplaza el hash de la contraseña del usuario del token del contexto si el guardado sigue siendo
+	// PasswordAnterior (ya verificado con DamePasswordSesion). Cierra sus sesiones
+	ModificarPassword(ctx context.Context, PasswordAnterior string, PasswordNuevo string) (string, error)
+	// A -> P con el hash de una contraseña temporal. Cierra sus sesiones
+	RestablecerPassword(ctx context.Context, IdUsuario int, Password string) (string, error)
+	// Reserva un intento de login del usuario (exista o no) antes de verificar sus credenciales, contándolo como
+	// fallido. Devuelve mensaje y 0 si se reservó, o los segundos a esperar si el login está bloqueado o los
+	// intentos en curso ya llegan al máximo de la política
+	ReservarIntentoLogin(ctx context.Context, Usuario string, IP string, Politica PoliticaBloqueoLogin) (string, int, error)
+	// Devuelve un intento reservado cuyas credenciales resultaron válidas
+	LiberarIntentoLogin(ctx context.Context, Usuario string) (string, error)
+	// Confirma como fallido un intento reservado y bloquea el login según la política. Devuelve mensaje y los
+	// segundos del bloqueo aplicado (0 si no se bloqueó). Un login exitoso borra los intentos
+	RegistrarLoginFallido(ctx context.Context, Usuario string, Politica PoliticaBloqueoLogin) (string, int, error)
+}
+
+type Sesiones interface {
+	// Rota el token y el refresh token de la sesión de RefreshToken por s.TokenSesion y s.RefreshToken, si no
+	// venció por inactividad ni por su duración. Instancia s con los datos de la sesión
+	Renovar(ctx context.Context, RefreshToken string, s *models.Sesiones, MinutosToken int) (string, error)
+	// Sesiones vigentes del usuario del token del contexto, de la usada más recientemente a la más antigua
+	Listar(ctx context.Context) ([]models.Sesiones, error)
+	// Cierra una sesión del usuario del token del contexto
+	Revocar(ctx context.Context, IdSesion int) (string, error)
+	// Cierra todas las sesiones de un usuario (RS)
+	RevocarUsuario(ctx context.Context, IdUsuario int) (string, error)
+}
+
+type SegundoFactor interface {
+	// Instancia f con el segundo factor del usuario del desafío de login TokenDesafio o, si es "", del usuario
+	// activo del token del contexto
+	Dame(ctx context.Context, TokenDesafio string, f *models.SegundoFactor) (string, error)
+	// Guarda Secreto como segundo factor pendiente (P) del usuario del desafío TokenDesafio (de inscripción) o,
+	// si es "", del token del contexto. Reemplaza una inscripción pendiente; no aplica si ya está activo.
+	// Devuelve también el nombre de usuario (para la URI del secreto)
+	Inscribir(ctx context.Context, TokenDesafio string, Secreto string) (string, string, error)
+	// P -> A para el usuario del token del contexto, con el paso del código TOTP verificado y los SHA-256 de
+	// sus códigos de recuperación
+	Activar(ctx context.Context, Paso int64, CodigosRecuperacion []string) (string, error)
+	// Completa el login del desafío TokenDesafio creando la sesión s como Usuarios.Login, con el paso del código
+	// TOTP verificado (Paso > 0) o el SHA-256 de un código de recuperación, que se consume. Sin ninguno de los dos
+	// cuenta un intento fallido: al quinto se descarta el desafío. Si es de inscripción, activa el segundo
+	// factor con CodigosRecuperacion. Instancia u y s
+	CompletarLogin(ctx context.Context, TokenDesafio string, Paso int64, CodigoRecuperacion string, CodigosRecuperacion []string,
+		u *models.Usuarios, s *models.Sesiones, Politica PoliticaSesion) (string, error)
+	// Borra el segundo factor de un usuario y cierra sus sesiones (RF)
+	Restablecer(ctx context.Context, IdUsuario int) (string, error)
+}
+
+type Roles interface {
+	// Instancia el rol por su código (r.Rol) con sus permisos
+	Dame(ctx context.Context, r *models.Roles) (string, error)
+	// Roles con sus permisos y la cantidad de usuarios de cada uno, ordenados por código
+	Listar(ctx context.Context) ([]models.Roles, error)
+	// Catálogo de permisos, ordenado por nombre
+	ListarPermisos(ctx context.Context) ([]models.Permisos, error)
+	// Crea el rol con sus permisos (CR)
+	Crear(ctx context.Context, Rol models.Roles) (string, error)
+	// Modifica el nombre del rol y reemplaza sus permisos. El rol A no se puede modificar (MR)
+	Modificar(ctx context.Context, Rol models.Roles) (string, error)
+	// Borra un rol sin usuarios. Los roles A y S no se pueden borrar (BR)
+	Borrar(ctx context.Context, Rol string) (string, error)
+	// Asigna el rol a un usuario. El rol S es exclusivo de la API key del sistema (AR)
+	AsignarUsuario(ctx context.Context, IdUsuario int, Rol string) (string, error)
+}
+
+type ApiKeys interface {
+	// API keys con sus alcances, sin el hash, ordenadas por nombre
+	Listar(ctx context.Context) ([]models.ApiKeys, error)
+	// Crea la API key k.ApiKey (se guarda su SHA-256) con k.Nombre, k.Sistema, k.Alcances, k.IPsPermitidas y
+	// k.FechaExpiracion (CK). Instancia k.IdApiKey
+	Crear(ctx context.Context, k *models.ApiKeys) (string, error)
+	// Reemplaza una API key activa por ApiKey, conservando su configuración. La anterior deja de valer (RK)
+	Rotar(ctx context.Context, IdApiKey int, ApiKey string) (string, error)
+	// A -> R. La API key deja de valer de inmediato (VK)
+	Revocar(ctx context.Context, IdApiKey int) (string, error)
+}
+
+type Autenticacion interface {
+	// Valida la credencial del actor desde la IP del cliente: token de sesión (USUARIO) o API key (SISTEMA,
+	// activa, sin vencer y con IP dentro de sus IPs permitidas). Devuelve también los permisos del actor: los
+	// del rol del usuario o los del rol S (Sistema) que otorgan los alcances de la API key
+	Autenticar(ctx context.Context, Credencial string, Actor string, IP string) (string, []string, error)
+}
+
+type Auditoria interface {
+	// Registra una operación en Operaciones a nombre del actor del contexto
+	Registrar(ctx context.Context, TipoOperacion string, Detalles map[string]any) (string, error)
+	// Operaciones registradas, de la más reciente a la más antigua
+	Buscar(ctx context.Context, Filtro FiltroOperaciones) ([]models.Operaciones, error)
+	// IdOperacion y Hash de la última operación de la cadena de hashes
+	DameCabeza(ctx context.Context) (int, string, error)
+	// Hasta Limite operaciones posteriores a DesdeIdOperacion, por IdOperacion ascendente, para recorrer la cadena
+	ListarCadena(ctx context.Context, DesdeIdOperacion int, Limite int) ([]models.Operaciones, error)
+}
+
+// Mensajes que el motor de ingesta aisló porque hacían fallar su lote (MensajesCuarentena). Sin actor: solo los usa el MS
+type Cuarentena interface {
+	// Registra el mensaje con su Origen en la fuente, su payload original (Contenido) y el último Error
+	Crear(ctx context.Context, Mensaje models.MensajesCuarentena) (string, error)
+	// Hasta Limite mensajes, del más reciente al más antiguo. IdTransferencia "" no filtra
+	Buscar(ctx context.Context, IdTransferencia string, Limite int) ([]models.MensajesCuarentena, error)
+}
+
+// Último resultado notificado de cada transferencia (EstadosTransferencias). Sin actor: solo los usa el MS
+type EstadosTransferencias interface {
+	// Registra el resultado de un lote tal como se notificó. Una transferencia finalizada (F) conserva su primer registro
+	Registrar(ctx context.Context, Notificaciones []models.TransferenciaNotificada) (string, error)
+	// Hasta Limite estados, del modificado más recientemente al más antiguo. IdTransferencia e IdCorrelacion "" no filtran
+	Buscar(ctx context.Context, IdTransferencia string, IdCorrelacion string, Limite int) ([]models.EstadosTransferencias, error)
+}
+
+// Filtros de Auditoria.Buscar. Los valores cero no filtran.
+type FiltroOperaciones struct {
+	// Usuario que realizó la operación
+	IdUsuario     int
+	TipoOperacion string
+	// Entidad sobre la que se realizó la operación (ver EntidadesOperaciones) y su Id en Detalles
+	Entidad   string
+	IdEntidad string
+	// FechaInicio inclusive, FechaFin exclusive
+	FechaInicio time.Time
+	FechaFin    time.Time
+	Limite      int
+}
+
+// Entidades por las que filtra Auditoria.Buscar y la clave de Detalles que las identifica (tsp_buscar_operaciones)
+var EntidadesOperaciones = map[string]string{
+	"Moneda":        "IdMoneda",
+	"Parametro":     "Parametro",
+	"Usuario":       "IdUsuario",
+	"Rol":           "Rol",
+	"ApiKey":        "IdApiKey",
+	"Cuenta":        "IdCuenta",
+	"Transferencia": "IdTransferencia",
+}
+
+// Vencimientos y límite de las sesiones que crea Usuarios.Login (parámetros SESION*) y roles que exigen
+// segundo factor (TOTPROLESOBLIGATORIOS)
+type PoliticaSesion struct {
+	MinutosToken       int
+	MinutosInactividad int
+	HorasDuracion      int
+	MaxSesiones        int
+	RolesSegundoFactor []string
+}
+
+var PoliticaSesionPorDefecto = PoliticaSesion{MinutosToken: 15, MinutosInactividad: 30, HorasDuracion: 12, MaxSesiones: 10}
+
+// Bloqueo progresivo del login por intentos fallidos (parámetros LOGIN*): IntentosMax intentos seguidos bloquean
+// SegundosBloqueo, el doble en cada bloqueo siguiente, hasta MinutosBloqueoMax. Se olvidan tras HorasVentana sin fallos
+type PoliticaBloqueoLogin struct {
+	IntentosMax       int
+	SegundosBloqueo   int
+	MinutosBloqueoMax int
+	HorasVentana      int
+}
+
+var PoliticaBloqueoLoginPorDefecto = PoliticaBloqueoLogin{IntentosMax: 5, SegundosBloqueo: 60, MinutosBloqueoMax: 60, HorasVentana: 24}
+
+// Conjunto de repositorios que se inyecta en gestores, controladores y fuentes de ingesta
+type Repositorios struct {
+	Parametros    Parametros
+	Monedas       Monedas
+	Usuarios      Usuarios
+	Sesiones      Sesiones
+	SegundoFactor SegundoFactor
+	Roles         Roles
+	ApiKeys       ApiKeys
+	Autenticacion Autenticacion
+	Auditoria     Auditoria
+	Cuarentena    Cuarentena
+	Estados       EstadosTransferencias
+}
@@ -0,0 +1,189 @@
+package memoria
+
+import (
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/utils"
+	"context"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type ApiKeys struct {
+	b *BaseDatos
+}
+
+// Fila de ApiKeys: se guarda el SHA-256 de la API key, no la API key
+type apiKey struct {
+	models.ApiKeys
+	hash string
+}
+
+// tsp_listar_apikeys
+func (r *ApiKeys) Listar(ctx context.Context) ([]models.ApiKeys, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	apiKeys := make([]models.ApiKeys, 0, len(r.b.apiKeys))
+	for _, guardada := range r.b.apiKeys {
+		apiKeys = append(apiKeys, guardada.copia())
+	}
+	sort.Slice(apiKeys, func(i, j int) bool { return apiKeys[i].Nombre < apiKeys[j].Nombre })
+	return apiKeys, nil
+}
+
+// tsp_crear_apikey
+func (r *ApiKeys) Crear(ctx context.Context, k *models.ApiKeys) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := r.resolverActor(ctx)
+	if mensaje != "OK" {
+		return mensaje, nil
+	}
+	if strings.TrimSpace(k.Nombre) == "" {
+		return "El nombre de la API key es obligatorio.", nil
+	}
+	if strings.TrimSpace(k.Sistema) == "" {
+		return "El sistema de la API key es obligatorio.", nil
+	}
+	for _, guardada := range r.b.apiKeys {
+		if guardada.Nombre == k.Nombre {
+			return "Ya existe una API key con ese nombre.", nil
+		}
+	}
+	if len(k.Alcances) == 0 {
+		return "Debe indicar al menos un alcance.", nil
+	}
+	for _, a := range k.Alcances {
+		if !slices.Contains(auth.Alcances, a) {
+			return "El alcance " + a + " no existe.", nil
+		}
+	}
+	if k.IPsPermitidas == nil {
+		return "Las IPs permitidas deben ser un array JSON.", nil
+	}
+	if k.FechaExpiracion != nil && !k.FechaExpiracion.After(r.b.ahora()) {
+		return "La fecha de expiración debe ser futura.", nil
+	}
+
+	r.b.ultimoId.apiKey++
+	k.IdApiKey = r.b.ultimoId.apiKey
+	k.Prefijo = utils.PrefijoApiKey(k.ApiKey)
+	guardada := &apiKey{ApiKeys: *k, hash: utils.HashToken(k.ApiKey)}
+	guardada.ApiKeys = guardada.copia()
+	guardada.Alcances = distintos(k.Alcances)
+	guardada.FechaAlta = r.b.ahora()
+	guardada.FechaUltimoUso = nil
+	guardada.Estado = "A"
+	guardada.ApiKey = ""
+	r.b.apiKeys[k.IdApiKey] = guardada
+	detalles := map[string]any{"IdApiKey": k.IdApiKey, "Nombre": k.Nombre, "Sistema": k.Sistema, "Alcances": guardada.Alcances,
+		"IPsPermitidas": guardada.IPsPermitidas, "FechaExpiracion": k.FechaExpiracion}
+	if err := r.b.auditar(actor, "CK", detalles); err != nil {
+		return "", err
+	}
+	return "OK", nil
+}
+
+// tsp_rotar_apikey
+func (r *ApiKeys) Rotar(ctx context.Context, IdApiKey int, ApiKey string) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := r.resolverActor(ctx)
+	if mensaje != "OK" {
+		return mensaje, nil
+	}
+	guardada, ok := r.b.apiKeys[IdApiKey]
+	if !ok {
+		return "La API key no existe.", nil
+	}
+	if guardada.Estado != "A" {
+		return "La API key está revocada.", nil
+	}
+	if guardada.vencida(r.b) {
+		return "La API key expiró.", nil
+	}
+	guardada.hash = utils.HashToken(ApiKey)
+	guardada.Prefijo = utils.PrefijoApiKey(ApiKey)
+	if err := r.b.auditar(actor, "RK", map[string]any{"IdApiKey": IdApiKey, "Nombre": guardada.Nombre}); err != nil {
+		return "", err
+	}
+	return "OK", nil
+}
+
+// tsp_revocar_apikey
+func (r *ApiKeys) Revocar(ctx context.Context, IdApiKey int) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := r.resolverActor(ctx)
+	if mensaje != "OK" {
+		return mensaje, nil
+	}
+	guardada, ok := r.b.apiKeys[IdApiKey]
+	if !ok {
+		return "La API key no existe.", nil
+	}
+	if guardada.Estado != "A" {
+		return "La API key ya está revocada.", nil
+	}
+	guardada.Estado = "R"
+	if err := r.b.auditar(actor, "VK", map[string]any{"IdApiKey": IdApiKey, "Nombre": guardada.Nombre}); err != nil {
+		return "", err
+	}
+	return "OK", nil
+}
+
+// Actor de las operaciones sobre API keys: sesión válida y permiso apikeys:write. Debe llamarse con el lock tomado.
+func (r *ApiKeys) resolverActor(ctx context.Context) (*usuario, string) {
+	actor, mensaje := r.b.resolverActor(ctx)
+	if mensaje != "OK" {
+		return nil, mensaje
+	}
+	if actor != nil && !r.b.tienePermiso(actor, auth.PermisoApiKeysEscribir) {
+		return nil, "No tienes permisos para realizar esta acción."
+	}
+	return actor, "OK"
+}
+
+// API key activa con ese valor (sin verificar el vencimiento). Debe llamarse con el lock tomado.
+func (b *BaseDatos) apiKeyActiva(ApiKey string) *apiKey {
+	hash := utils.HashToken(ApiKey)
+	for _, k := range b.apiKeys {
+		if k.hash == hash && k.Estado == "A" {
+			return k
+		}
+	}
+	return nil
+}
+
+// Permisos del rol S que otorgan los alcances de la API key (f_permiso_en_alcances). Debe llamarse con el lock tomado.
+func (b *BaseDatos) permisosApiKey(k *apiKey) []string {
+	permisos := make([]string, 0)
+	for _, p := range b.permisosRol("S") {
+		if auth.PermisoEnAlcances(k.Alcances, p) {
+			permisos = append(permisos, p)
+		}
+	}
+	return permisos
+}
+
+// La API key venció. Debe llamarse con el lock tomado.
+func (k *apiKey) vencida(b *BaseDatos) bool {
+	return k.FechaExpiracion != nil && !k.FechaExpiracion.After(b.ahora())
+}
+
+// Copia de la fila sin el hash y sin compartir slices ni fechas
+func (k *apiKey) copia() models.ApiKeys {
+	c := k.ApiKeys
+	c.Alcances = slices.Clone(k.Alcances)
+	c.IPsPermitidas = slices.Clone(k.IPsPermitidas)
+	if k.FechaExpiracion != nil {
+		f := *k.FechaExpiracion
+		c.FechaExpiracion = &f
+	}
+	if k.FechaUltimoUso != nil {
+		f := *k.FechaUltimoUso
+		c.FechaUltimoUso = &f
+	}
+	return c
+}
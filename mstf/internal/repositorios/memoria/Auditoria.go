@@ -0,0 +1,106 @@
+package memoria
+
+import (
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"context"
+	"encoding/json"
+)
+
+type Auditoria struct {
+	b *BaseDatos
+}
+
+// tsp_registrar_operacion
+func (r *Auditoria) Registrar(ctx context.Context, TipoOperacion string, Detalles map[string]any) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := r.b.resolverActor(ctx)
+	if mensaje != "OK" {
+		return mensaje, nil
+	}
+	if TipoOperacion == "" {
+		return "El tipo de operación es obligatorio.", nil
+	}
+	if Detalles == nil {
+		Detalles = map[string]any{}
+	}
+	if err := r.b.auditar(actor, TipoOperacion, Detalles); err != nil {
+		return "", err
+	}
+	return "OK", nil
+}
+
+// tsp_buscar_operaciones
+func (r *Auditoria) Buscar(ctx context.Context, Filtro repositorios.FiltroOperaciones) ([]models.Operaciones, error) {
+	limite := Filtro.Limite
+	if limite <= 0 {
+		limite = 100
+	}
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	operaciones := make([]models.Operaciones, 0)
+	for i := len(r.b.operaciones) - 1; i >= 0 && len(operaciones) < limite; i-- {
+		op := r.b.operaciones[i]
+		if Filtro.IdUsuario != 0 && (op.IdUsuario == nil || *op.IdUsuario != Filtro.IdUsuario) {
+			continue
+		}
+		if Filtro.TipoOperacion != "" && op.TipoOperacion != Filtro.TipoOperacion {
+			continue
+		}
+		if !Filtro.FechaInicio.IsZero() && op.FechaOperacion.Before(Filtro.FechaInicio) {
+			continue
+		}
+		if !Filtro.FechaFin.IsZero() && !op.FechaOperacion.Before(Filtro.FechaFin) {
+			continue
+		}
+		if clave, ok := repositorios.EntidadesOperaciones[Filtro.Entidad]; ok && !detalleCoincide(op.Detalles, clave, Filtro.IdEntidad) {
+			continue
+		}
+		operaciones = append(operaciones, op)
+	}
+	return operaciones, nil
+}
+
+// tsp_dame_cabeza_operaciones
+func (r *Auditoria) DameCabeza(ctx context.Context) (int, string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	return r.b.cadena.idOperacion, r.b.cadena.hash, nil
+}
+
+// tsp_listar_cadena_operaciones
+func (r *Auditoria) ListarCadena(ctx context.Context, DesdeIdOperacion int, Limite int) ([]models.Operaciones, error) {
+	if Limite <= 0 {
+		Limite = 1000
+	}
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	operaciones := make([]models.Operaciones, 0)
+	for _, op := range r.b.operaciones {
+		if op.IdOperacion > DesdeIdOperacion && len(operaciones) < Limite {
+			operaciones = append(operaciones, op)
+		}
+	}
+	return operaciones, nil
+}
+
+// Detalles tiene la clave y, si se informa Valor, con ese valor (JSON_CONTAINS_PATH y JSON_UNQUOTE(JSON_EXTRACT))
+func detalleCoincide(Detalles json.RawMessage, Clave string, Valor string) bool {
+	var detalles map[string]json.RawMessage
+	if err := json.Unmarshal(Detalles, &detalles); err != nil {
+		return false
+	}
+	v, ok := detalles[Clave]
+	if !ok {
+		return false
+	}
+	if Valor == "" {
+		return true
+	}
+	var texto string
+	if err := json.Unmarshal(v, &texto); err == nil {
+		return texto == Valor
+	}
+	return string(v) == Valor
+}
@@ -0,0 +1,50 @@
+package memoria
+
+import (
+	"MSTransaccionesFinancieras/internal/auth"
+	"context"
+	"slices"
+)
+
+type Autenticacion struct {
+	b *BaseDatos
+}
+
+// tsp_autenticar_actor
+func (r *Autenticacion) Autenticar(ctx context.Context, Credencial string, Actor string, IP string) (string, []string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	switch Actor {
+	case "USUARIO":
+		u := r.b.usuarioPorToken(Credencial, "A")
+		if u == nil {
+			return "La sesión expiró. Vuelva a iniciar sesión.", nil, nil
+		}
+		r.b.sesionPorToken(Credencial).FechaUltimoUso = r.b.ahora()
+		return "OK", r.b.permisosRol(u.Rol), nil
+	case "SISTEMA":
+		k := r.b.apiKeyActiva(Credencial)
+		if k == nil {
+			return "API Key inválida.", nil, nil
+		}
+		if k.vencida(r.b) {
+			return "La API key expiró.", nil, nil
+		}
+		ahora := r.b.ahora()
+		k.FechaUltimoUso = &ahora
+		// la IP la verifica el MS (sps.Autenticacion), también con la API key en caché
+		if !auth.IPPermitida(IP, k.IPsPermitidas) {
+			return "La IP no está autorizada para usar la API key.", nil, nil
+		}
+		return "OK", r.b.permisosApiKey(k), nil
+	}
+	return "Actor inválido.", nil, nil
+}
+
+// Permisos del rol (vacío si no existe). Debe llamarse con el lock tomado.
+func (b *BaseDatos) permisosRol(Rol string) []string {
+	if r, ok := b.roles[Rol]; ok {
+		return slices.Clone(r.Permisos)
+	}
+	return []string{}
+}
@@ -0,0 +1,379 @@
+package memoria
+
+import (
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"MSTransaccionesFinancieras/internal/utils"
+	"context"
+	"encoding/json"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Implementación en memoria de los repositorios, para tests. Reproduce las validaciones, los mensajes,
+// las transiciones de estado y la auditoría (Operaciones) de los SPs de DUMP_DB.sql.
+// Todos los repositorios devueltos por Repositorios comparten las mismas tablas.
+type BaseDatos struct {
+	mu          sync.Mutex
+	parametros  map[string]models.Parametros
+	monedas     map[int]models.Monedas
+	usuarios    map[int]*usuario
+	sesiones    map[int]*sesion
+	factores    map[int]*segundoFactor
+	desafios    map[int]*desafio
+	bloqueos    map[string]*bloqueoLogin
+	roles       map[string]*models.Roles
+	permisos    []models.Permisos
+	apiKeys     map[int]*apiKey
+	operaciones []models.Operaciones
+	cadena      cabezaCadena
+	cuarentena  []models.MensajesCuarentena
+	// filas de EstadosTransferencias, de la modificada hace más tiempo a la más reciente
+	estados  []models.EstadosTransferencias
+	ultimoId struct{ usuario, sesion, desafio, apiKey, mensaje int }
+	ahora    func() time.Time
+}
+
+// Fila de Usuarios: el hash de la contraseña no forma parte del modelo
+type usuario struct {
+	models.Usuarios
+	password string
+}
+
+// Fila de BloqueosLogin, por nombre de usuario en minúsculas (la collation de MySQL no distingue mayúsculas)
+type bloqueoLogin struct {
+	intentosFallidos int
+	bloqueos         int
+	fechaUltimoFallo time.Time
+	ultimaIP         string
+	bloqueadoHasta   time.Time
+}
+
+// Fila de CadenaOperaciones: última operación de la cadena de hashes
+type cabezaCadena struct {
+	idOperacion int
+	hash        string
+}
+
+// Fila de Sesiones: se guarda el SHA-256 de los tokens, no los tokens
+type sesion struct {
+	models.Sesiones
+	tokenHash          string
+	refreshHash        string
+	minutosInactividad int
+}
+
+func New() *BaseDatos {
+	return &BaseDatos{
+		parametros: make(map[string]models.Parametros),
+		monedas:    make(map[int]models.Monedas),
+		usuarios:   make(map[int]*usuario),
+		sesiones:   make(map[int]*sesion),
+		factores:   make(map[int]*segundoFactor),
+		desafios:   make(map[int]*desafio),
+		bloqueos:   make(map[string]*bloqueoLogin),
+		roles:      rolesDump(),
+		permisos:   permisosDump(),
+		apiKeys:    make(map[int]*apiKey),
+		cadena:     cabezaCadena{hash: models.HashInicialOperaciones},
+		ahora:      time.Now,
+	}
+}
+
+func (b *BaseDatos) Repositorios() repositorios.Repositorios {
+	return repositorios.Repositorios{
+		Parametros:    &Parametros{b: b},
+		Monedas:       &Monedas{b: b},
+		Usuarios:      &Usuarios{b: b},
+		Sesiones:      &Sesiones{b: b},
+		SegundoFactor: &SegundoFactor{b: b},
+		Roles:         &Roles{b: b},
+		ApiKeys:       &ApiKeys{b: b},
+		Autenticacion: &Autenticacion{b: b},
+		Auditoria:     &Auditoria{b: b},
+		Cuarentena:    &Cuarentena{b: b},
+		Estados:       &EstadosTransferencias{b: b},
+	}
+}
+
+// Carga o reemplaza un parámetro (equivale a un INSERT en Parametros). EsModificable por defecto 'S'.
+func (b *BaseDatos) GuardarParametro(p models.Parametros) {
+	if p.EsModificable == "" {
+		p.EsModificable = "S"
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.parametros[p.Parametro] = p
+}
+
+// Carga o reemplaza una moneda. Estado por defecto 'A'.
+func (b *BaseDatos) GuardarMoneda(m models.Monedas) {
+	if m.Estado == "" {
+		m.Estado = "A"
+	}
+	if m.FechaAlta.IsZero() {
+		m.FechaAlta = b.ahora()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.monedas[m.IdMoneda] = m
+}
+
+// Carga un usuario con la contraseña en texto plano y una sesión con la política por defecto. Devuelve el
+// usuario con su Id y el token de la sesión.
+// Estado por defecto 'A' y Rol por defecto 'A' (administrador). La contraseña se guarda en MD5, como los
+// usuarios heredados del dump, y se migra a argon2id en el primer login.
+func (b *BaseDatos) GuardarUsuario(u models.Usuarios, Password string) models.Usuarios {
+	if u.Estado == "" {
+		u.Estado = "A"
+	}
+	if u.Rol == "" {
+		u.Rol = "A"
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if u.IdUsuario == 0 {
+		b.ultimoId.usuario++
+		u.IdUsuario = b.ultimoId.usuario
+	} else if u.IdUsuario > b.ultimoId.usuario {
+		b.ultimoId.usuario = u.IdUsuario
+	}
+	u.TokenSesion = ""
+	u.FechaAlta = b.ahora().Format(time.RFC3339)
+	b.usuarios[u.IdUsuario] = &usuario{Usuarios: u, password: utils.MD5Hash(Password)}
+	s := &models.Sesiones{TokenSesion: nuevoToken(), RefreshToken: nuevoToken()}
+	b.crearSesion(u.IdUsuario, s, repositorios.PoliticaSesionPorDefecto)
+	u.TokenSesion = s.TokenSesion
+	return u
+}
+
+// Carga o reemplaza un rol con sus permisos (equivale a un INSERT en Roles y RolesPermisos).
+func (b *BaseDatos) GuardarRol(r models.Roles) {
+	r.Permisos = slices.Sorted(slices.Values(r.Permisos))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roles[r.Rol] = &r
+}
+
+// Carga una API key activa con su valor en texto plano (se guarda su SHA-256). Alcances por defecto: admin.
+// Devuelve la API key con su Id.
+func (b *BaseDatos) GuardarApiKey(k models.ApiKeys, ApiKey string) models.ApiKeys {
+	if len(k.Alcances) == 0 {
+		k.Alcances = []string{auth.AlcanceAdmin}
+	}
+	if k.IPsPermitidas == nil {
+		k.IPsPermitidas = []string{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ultimoId.apiKey++
+	k.IdApiKey = b.ultimoId.apiKey
+	k.Prefijo = utils.PrefijoApiKey(ApiKey)
+	k.Estado = "A"
+	k.FechaAlta = b.ahora()
+	k.ApiKey = ""
+	guardada := &apiKey{ApiKeys: k, hash: utils.HashToken(ApiKey)}
+	guardada.ApiKeys = guardada.copia()
+	b.apiKeys[k.IdApiKey] = guardada
+	return k
+}
+
+// El rol del usuario tiene el permiso (f_tiene_permiso). Debe llamarse con el lock tomado.
+func (b *BaseDatos) tienePermiso(u *usuario, Permiso string) bool {
+	r, ok := b.roles[u.Rol]
+	return ok && slices.Contains(r.Permisos, Permiso)
+}
+
+// Resuelve la identidad del actor del contexto como los SPs: USUARIO requiere un token de sesión de un usuario
+// activo (f_valida_usuario); cualquier otro actor es el sistema (IdUsuario NULL).
+// Debe llamarse con el lock tomado.
+func (b *BaseDatos) resolverActor(ctx context.Context) (*usuario, string) {
+	credencial, actor := auth.CredencialDesdeCtx(ctx)
+	if actor != "USUARIO" {
+		return nil, "OK"
+	}
+	u := b.usuarioPorToken(credencial, "A")
+	if u == nil {
+		return nil, "La sesión expiró. Vuelva a iniciar sesión."
+	}
+	return u, "OK"
+}
+
+// Usuario de la sesión del token (f_valida_sesion) en alguno de los estados. Debe llamarse con el lock tomado.
+func (b *BaseDatos) usuarioPorToken(token string, estados ...string) *usuario {
+	s := b.sesionPorToken(token)
+	if s == nil {
+		return nil
+	}
+	u := b.usuarios[s.IdUsuario]
+	for _, e := range estados {
+		if u.Estado == e {
+			return u
+		}
+	}
+	return nil
+}
+
+// Sesión vigente cuyo token no venció (f_valida_sesion). Debe llamarse con el lock tomado.
+func (b *BaseDatos) sesionPorToken(token string) *sesion {
+	if token == "" {
+		return nil
+	}
+	hash := utils.HashToken(token)
+	for _, s := range b.sesiones {
+		if s.tokenHash == hash && s.FechaExpiracionToken.After(b.ahora()) && b.sesionVigente(s) {
+			return s
+		}
+	}
+	return nil
+}
+
+// La sesión no venció por inactividad ni por su duración. Debe llamarse con el lock tomado.
+func (b *BaseDatos) sesionVigente(s *sesion) bool {
+	ahora := b.ahora()
+	return s.FechaUltimoUso.After(ahora.Add(-time.Duration(s.minutosInactividad)*time.Minute)) && s.FechaExpiracion.After(ahora)
+}
+
+// Crea una sesión del usuario con los tokens de s, como tsp_crear_sesion: borra sus sesiones vencidas y
+// cierra las usadas hace más tiempo si alcanzó el máximo, y borra sus intentos de login fallidos.
+// Instancia s. Debe llamarse con el lock tomado.
+func (b *BaseDatos) crearSesion(IdUsuario int, s *models.Sesiones, Politica repositorios.PoliticaSesion) {
+	propias := make([]*sesion, 0)
+	for id, guardada := range b.sesiones {
+		if guardada.IdUsuario != IdUsuario {
+			continue
+		}
+		if !b.sesionVigente(guardada) {
+			delete(b.sesiones, id)
+			continue
+		}
+		propias = append(propias, guardada)
+	}
+	sort.Slice(propias, func(i, j int) bool {
+		if !propias[i].FechaUltimoUso.Equal(propias[j].FechaUltimoUso) {
+			return propias[i].FechaUltimoUso.Before(propias[j].FechaUltimoUso)
+		}
+		return propias[i].IdSesion < propias[j].IdSesion
+	})
+	for i := 0; i < len(propias)-Politica.MaxSesiones+1; i++ {
+		delete(b.sesiones, propias[i].IdSesion)
+	}
+
+	if u, ok := b.usuarios[IdUsuario]; ok {
+		delete(b.bloqueos, strings.ToLower(u.Usuario))
+	}
+
+	ahora := b.ahora()
+	b.ultimoId.sesion++
+	s.IdSesion = b.ultimoId.sesion
+	s.IdUsuario = IdUsuario
+	s.FechaInicio = ahora
+	s.FechaUltimoUso = ahora
+	s.FechaExpiracion = ahora.Add(time.Duration(Politica.HorasDuracion) * time.Hour)
+	s.FechaExpiracionToken = ahora.Add(time.Duration(Politica.MinutosToken) * time.Minute)
+	if s.FechaExpiracionToken.After(s.FechaExpiracion) {
+		s.FechaExpiracionToken = s.FechaExpiracion
+	}
+	guardada := &sesion{
+		Sesiones:           *s,
+		tokenHash:          utils.HashToken(s.TokenSesion),
+		refreshHash:        utils.HashToken(s.RefreshToken),
+		minutosInactividad: Politica.MinutosInactividad,
+	}
+	guardada.TokenSesion, guardada.RefreshToken = "", ""
+	b.sesiones[s.IdSesion] = guardada
+}
+
+// Borra las sesiones del usuario y devuelve cuántas borró. Debe llamarse con el lock tomado.
+func (b *BaseDatos) borrarSesiones(IdUsuario int) int {
+	borradas := 0
+	for id, s := range b.sesiones {
+		if s.IdUsuario == IdUsuario {
+			delete(b.sesiones, id)
+			borradas++
+		}
+	}
+	return borradas
+}
+
+// Inserta en Operaciones a nombre del actor (nil: sistema), encadenada con la anterior como
+// trg_operaciones_encadenar. Debe llamarse con el lock tomado.
+func (b *BaseDatos) auditar(actor *usuario, TipoOperacion string, Detalles map[string]any) error {
+	detalles, err := json.Marshal(Detalles)
+	if err != nil {
+		return err
+	}
+	op := models.Operaciones{
+		IdOperacion:    b.cadena.idOperacion + 1,
+		TipoOperacion:  TipoOperacion,
+		FechaOperacion: b.ahora().Truncate(time.Second),
+		Detalles:       detalles,
+	}
+	if actor != nil {
+		id := actor.IdUsuario
+		op.IdUsuario = &id
+	}
+	op.Hash = op.CalcularHash(b.cadena.hash)
+	b.cadena = cabezaCadena{idOperacion: op.IdOperacion, hash: op.Hash}
+	b.operaciones = append(b.operaciones, op)
+	return nil
+}
+
+// Modifica los Detalles de una operación directamente en la tabla, sin pasar por los SPs ni los triggers, para
+// probar la verificación de la cadena. Con RecalcularCadena además recalcula el Hash de esa operación y de las
+// siguientes y la cabeza de la cadena, como haría quien quisiera ocultar la modificación.
+func (b *BaseDatos) AlterarOperacion(IdOperacion int, Detalles string, RecalcularCadena bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	anterior := models.HashInicialOperaciones
+	alterada := false
+	for i := range b.operaciones {
+		op := &b.operaciones[i]
+		if op.IdOperacion == IdOperacion {
+			op.Detalles = json.RawMessage(Detalles)
+			alterada = true
+		}
+		if alterada && RecalcularCadena {
+			op.Hash = op.CalcularHash(anterior)
+			b.cadena = cabezaCadena{idOperacion: op.IdOperacion, hash: op.Hash}
+		}
+		anterior = op.Hash
+	}
+}
+
+// Modifica los Detalles de una operación y recalcula solo su Hash, sin pasar por los SPs ni los triggers: la
+// operación es consistente con la anterior pero la siguiente ya no encadena con ella
+func (b *BaseDatos) ReescribirOperacion(IdOperacion int, Detalles string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	anterior := models.HashInicialOperaciones
+	for i := range b.operaciones {
+		op := &b.operaciones[i]
+		if op.IdOperacion == IdOperacion {
+			op.Detalles = json.RawMessage(Detalles)
+			op.Hash = op.CalcularHash(anterior)
+			if b.cadena.idOperacion == IdOperacion {
+				b.cadena.hash = op.Hash
+			}
+			return
+		}
+		anterior = op.Hash
+	}
+}
+
+// Borra una operación directamente en la tabla, sin pasar por los triggers, para probar la verificación de la cadena
+func (b *BaseDatos) EliminarOperacion(IdOperacion int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.operaciones = slices.DeleteFunc(b.operaciones, func(op models.Operaciones) bool { return op.IdOperacion == IdOperacion })
+}
+
+// Token generado como en el MS (utils.GenerarToken), para los usuarios cargados con GuardarUsuario
+func nuevoToken() string {
+	token, _ := utils.GenerarToken()
+	return token
+}
@@ -0,0 +1,519 @@
+package memoria
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+)
+
+func ctxUsuario(token string) context.Context {
+	ctx := context.WithValue(context.Background(), auth.ClaveCredencial, token)
+	return context.WithValue(ctx, auth.ClaveActor, "USUARIO")
+}
+
+func nuevaSesion() *models.Sesiones {
+	return &models.Sesiones{TokenSesion: nuevoToken(), RefreshToken: nuevoToken()}
+}
+
+func esperarMensaje(t *testing.T, operacion string, mensaje string, err error, esperado string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %v", operacion, err)
+	}
+	if mensaje != esperado {
+		t.Fatalf("%s: mensaje %q, se esperaba %q", operacion, mensaje, esperado)
+	}
+}
+
+func TestMonedasTransiciones(t *testing.T) {
+	bd := New()
+	admin := bd.GuardarUsuario(models.Usuarios{Usuario: "admin"}, "admin1")
+	repos := bd.Repositorios()
+	ctx := ctxUsuario(admin.TokenSesion)
+
+	mensaje, err := repos.Monedas.Crear(ctx, models.Monedas{IdMoneda: 1, IdCuentaEmpresa: "18446744073709551616"})
+	esperarMensaje(t, "Crear", mensaje, err, "OK")
+	// reintento de una creación interrumpida: la moneda pendiente se deja como está
+	mensaje, err = repos.Monedas.Crear(ctx, models.Monedas{IdMoneda: 1, IdCuentaEmpresa: "18446744073709551616"})
+	esperarMensaje(t, "Crear pendiente", mensaje, err, "OK")
+
+	moneda := &models.Monedas{IdMoneda: 1}
+	mensaje, err = repos.Monedas.Dame(ctx, moneda)
+	esperarMensaje(t, "Dame", mensaje, err, "OK")
+	if moneda.Estado != "P" {
+		t.Fatalf("estado inicial: %s", moneda.Estado)
+	}
+	if activas, _ := repos.Monedas.Listar(ctx, "N"); len(activas) != 0 {
+		t.Fatalf("una moneda pendiente no se lista como activa: %v", activas)
+	}
+
+	mensaje, err = repos.Monedas.Desactivar(ctx, 1)
+	esperarMensaje(t, "Desactivar pendiente", mensaje, err, "La moneda no está en estado Activo.")
+	mensaje, err = repos.Monedas.Activar(ctx, 1)
+	esperarMensaje(t, "Activar", mensaje, err, "OK")
+	mensaje, err = repos.Monedas.Activar(ctx, 1)
+	esperarMensaje(t, "Activar activa", mensaje, err, "La moneda ya está en estado Activo.")
+	mensaje, err = repos.Monedas.Crear(ctx, models.Monedas{IdMoneda: 1, IdCuentaEmpresa: "18446744073709551616"})
+	esperarMensaje(t, "Crear activa", mensaje, err, "La moneda ya existe.")
+	mensaje, err = repos.Monedas.Borrar(ctx, 1)
+	esperarMensaje(t, "Borrar activa", mensaje, err, "Solo se pueden borrar monedas en estado Inactivo o Pendiente.")
+	mensaje, err = repos.Monedas.Desactivar(ctx, 1)
+	esperarMensaje(t, "Desactivar", mensaje, err, "OK")
+	mensaje, err = repos.Monedas.Borrar(ctx, 1)
+	esperarMensaje(t, "Borrar", mensaje, err, "OK")
+	mensaje, err = repos.Monedas.Dame(ctx, &models.Monedas{IdMoneda: 1})
+	esperarMensaje(t, "Dame borrada", mensaje, err, "La moneda no existe.")
+
+	// CM, AM, DM, BM a nombre del administrador
+	operaciones, err := repos.Auditoria.Buscar(ctx, repositorios.FiltroOperaciones{IdUsuario: admin.IdUsuario})
+	if err != nil || len(operaciones) != 4 {
+		t.Fatalf("operaciones auditadas: %d %v", len(operaciones), err)
+	}
+	if operaciones[0].TipoOperacion != "BM" || operaciones[3].TipoOperacion != "CM" {
+		t.Fatalf("orden de auditoría: %s ... %s", operaciones[0].TipoOperacion, operaciones[3].TipoOperacion)
+	}
+}
+
+func TestUsuariosCicloDeVida(t *testing.T) {
+	bd := New()
+	admin := bd.GuardarUsuario(models.Usuarios{Usuario: "admin"}, "admin1")
+	repos := bd.Repositorios()
+	ctxAdmin := ctxUsuario(admin.TokenSesion)
+
+	// los hashes son opacos para el repositorio: se generan y verifican en el gestor
+	mensaje, id, err := repos.Usuarios.Crear(ctxAdmin, "operador", "hash-temporal")
+	esperarMensaje(t, "Crear", mensaje, err, "OK")
+	if idGuardado, hash, err := repos.Usuarios.DamePassword(context.Background(), "operador"); err != nil || idGuardado != id || hash != "hash-temporal" {
+		t.Fatalf("DamePassword: Id %d (se esperaba %d), hash %q, %v", idGuardado, id, hash, err)
+	}
+
+	// login con la contraseña temporal: queda pendiente y solo puede confirmar su cuenta
+	operador := &models.Usuarios{Usuario: "operador"}
+	mensaje, err = repos.Usuarios.Login(context.Background(), operador, "hash-temporal", nuevaSesion(), &models.DesafiosLogin{}, repositorios.PoliticaSesionPorDefecto)
+	esperarMensaje(t, "Login temporal", mensaje, err, "OK")
+	if operador.Estado != "P" || operador.TokenSesion == "" {
+		t.Fatalf("Login temporal: %+v", operador)
+	}
+	mensaje, _, err = repos.Autenticacion.Autenticar(context.Background(), operador.TokenSesion, "USUARIO", "10.0.0.1")
+	esperarMensaje(t, "Autenticar pendiente", mensaje, err, "La sesión expiró. Vuelva a iniciar sesión.")
+
+	ctxOperador := ctxUsuario(operador.TokenSesion)
+	mensaje, err = repos.Usuarios.ConfirmarCuenta(ctxOperador, "")
+	esperarMensaje(t, "ConfirmarCuenta vacía", mensaje, err, "La contraseña es obligatoria.")
+	mensaje, err = repos.Usuarios.ConfirmarCuenta(ctxOperador, "hash-definitivo")
+	esperarMensaje(t, "ConfirmarCuenta", mensaje, err, "OK")
+	// confirmar cierra las sesiones: se vuelve a iniciar sesión con la contraseña definitiva
+	mensaje, err = repos.Usuarios.Login(context.Background(), &models.Usuarios{Usuario: "operador"}, "hash-temporal", nuevaSesion(), &models.DesafiosLogin{}, repositorios.PoliticaSesionPorDefecto)
+	esperarMensaje(t, "Login con la temporal", mensaje, err, "Credenciales inválidas.")
+	mensaje, err = repos.Usuarios.Login(context.Background(), operador, "hash-definitivo", nuevaSesion(), &models.DesafiosLogin{}, repositorios.PoliticaSesionPorDefecto)
+	esperarMensaje(t, "Login", mensaje, err, "OK")
+	mensaje, _, err = repos.Autenticacion.Autenticar(context.Background(), operador.TokenSesion, "USUARIO", "10.0.0.1")
+	esperarMensaje(t, "Autenticar activo", mensaje, err, "OK")
+
+	// la migración solo reemplaza el hash si sigue siendo el verificado
+	mensaje, err = repos.Usuarios.MigrarPassword(context.Background(), id, "hash-temporal", "hash-migrado")
+	esperarMensaje(t, "MigrarPassword desactualizado", mensaje, err, "La contraseña fue modificada.")
+	mensaje, err = repos.Usuarios.MigrarPassword(context.Background(), id, "hash-definitivo", "hash-migrado")
+	esperarMensaje(t, "MigrarPassword", mensaje, err, "OK")
+	ctxOperador = ctxUsuario(operador.TokenSesion)
+	mensaje, err = repos.Usuarios.ModificarPassword(ctxOperador, "hash-definitivo", "hash-nuevo")
+	esperarMensaje(t, "ModificarPassword anterior incorrecta", mensaje, err, "La contraseña anterior es incorrecta.")
+	mensaje, err = repos.Usuarios.ModificarPassword(ctxOperador, "hash-migrado", "hash-nuevo")
+	esperarMensaje(t, "ModificarPassword", mensaje, err, "OK")
+	mensaje, err = repos.Usuarios.Login(context.Background(), operador, "hash-nuevo", nuevaSesion(), &models.DesafiosLogin{}, repositorios.PoliticaSesionPorDefecto)
+	esperarMensaje(t, "Login nueva", mensaje, err, "OK")
+
+	// acciones administrativas: no sobre la propia cuenta, y un usuario activo no se borra
+	mensaje, err = repos.Usuarios.Desactivar(ctxAdmin, admin.IdUsuario)
+	esperarMensaje(t, "Desactivar propia", mensaje, err, "No puedes realizar esta acción sobre tu propia cuenta.")
+	mensaje, err = repos.Usuarios.Borrar(ctxAdmin, id)
+	esperarMensaje(t, "Borrar activo", mensaje, err, "No se puede borrar un usuario Activo.")
+	mensaje, err = repos.Usuarios.Desactivar(ctxAdmin, id)
+	esperarMensaje(t, "Desactivar", mensaje, err, "OK")
+	mensaje, _, err = repos.Autenticacion.Autenticar(context.Background(), operador.TokenSesion, "USUARIO", "10.0.0.1")
+	esperarMensaje(t, "Autenticar inactivo", mensaje, err, "La sesión expiró. Vuelva a iniciar sesión.")
+	mensaje, err = repos.Usuarios.Login(context.Background(), &models.Usuarios{Usuario: "operador"}, "hash-nuevo", nuevaSesion(), &models.DesafiosLogin{}, repositorios.PoliticaSesionPorDefecto)
+	esperarMensaje(t, "Login inactivo", mensaje, err, "El usuario está inactivo.")
+	mensaje, err = repos.Usuarios.Borrar(ctxAdmin, id)
+	esperarMensaje(t, "Borrar", mensaje, err, "OK")
+
+	// sesión cerrada
+	mensaje, err = repos.Usuarios.Logout(ctxAdmin)
+	esperarMensaje(t, "Logout", mensaje, err, "OK")
+	mensaje, _, err = repos.Usuarios.Crear(ctxAdmin, "otro", "hash-temporal")
+	esperarMensaje(t, "Crear sin sesión", mensaje, err, "La sesión expiró. Vuelva a iniciar sesión.")
+}
+
+func TestSesionesVencimientosYLimite(t *testing.T) {
+	bd := New()
+	ahora := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	bd.ahora = func() time.Time { return ahora }
+	admin := bd.GuardarUsuario(models.Usuarios{Usuario: "admin"}, "admin1")
+	operador := bd.GuardarUsuario(models.Usuarios{Usuario: "operador", Rol: "O"}, "operador1")
+	repos := bd.Repositorios()
+	_, hash, _ := repos.Usuarios.DamePassword(context.Background(), "operador")
+	politica := repositorios.PoliticaSesion{MinutosToken: 15, MinutosInactividad: 30, HorasDuracion: 2, MaxSesiones: 2}
+	autenticar := func(operacion string, token string, esperado string) {
+		t.Helper()
+		mensaje, _, err := repos.Autenticacion.Autenticar(context.Background(), token, "USUARIO", "10.0.0.1")
+		esperarMensaje(t, operacion, mensaje, err, esperado)
+	}
+	const expirada = "La sesión expiró. Vuelva a iniciar sesión."
+
+	// una sesión por dispositivo: GuardarUsuario ya creó una; al llegar al máximo se cierra la usada hace más tiempo
+	ahora = ahora.Add(time.Minute)
+	notebook := &models.Sesiones{TokenSesion: nuevoToken(), RefreshToken: nuevoToken(), Dispositivo: "notebook"}
+	mensaje, err := repos.Usuarios.Login(context.Background(), &models.Usuarios{Usuario: "operador"}, hash, notebook, &models.DesafiosLogin{}, politica)
+	esperarMensaje(t, "Login notebook", mensaje, err, "OK")
+	ahora = ahora.Add(time.Minute)
+	celular := &models.Sesiones{TokenSesion: nuevoToken(), RefreshToken: nuevoToken(), Dispositivo: "celular"}
+	mensaje, err = repos.Usuarios.Login(context.Background(), &models.Usuarios{Usuario: "operador"}, hash, celular, &models.DesafiosLogin{}, politica)
+	esperarMensaje(t, "Login celular", mensaje, err, "OK")
+	if !celular.FechaExpiracionToken.Equal(ahora.Add(15*time.Minute)) || !celular.FechaExpiracion.Equal(ahora.Add(2*time.Hour)) {
+		t.Fatalf("vencimientos de la sesión: %+v", celular)
+	}
+	autenticar("Autenticar sesión cerrada por el límite", operador.TokenSesion, expirada)
+	autenticar("Autenticar notebook", notebook.TokenSesion, "OK")
+
+	sesiones, err := repos.Sesiones.Listar(ctxUsuario(celular.TokenSesion))
+	if err != nil || len(sesiones) != 2 || sesiones[0].IdSesion != celular.IdSesion || !sesiones[0].Actual || sesiones[1].Actual {
+		t.Fatalf("Listar: %+v %v", sesiones, err)
+	}
+
+	// el token vence a los 15 minutos; el refresh token lo renueva mientras la sesión no venza por inactividad
+	ahora = ahora.Add(20 * time.Minute)
+	autenticar("Autenticar token vencido", celular.TokenSesion, expirada)
+	renovada := &models.Sesiones{TokenSesion: nuevoToken(), RefreshToken: nuevoToken()}
+	mensaje, err = repos.Sesiones.Renovar(context.Background(), celular.RefreshToken, renovada, 15)
+	esperarMensaje(t, "Renovar", mensaje, err, "OK")
+	if renovada.IdSesion != celular.IdSesion || !renovada.FechaExpiracion.Equal(celular.FechaExpiracion) {
+		t.Fatalf("la renovación no cambia la sesión ni su vencimiento: %+v", renovada)
+	}
+	autenticar("Autenticar renovada", renovada.TokenSesion, "OK")
+	mensaje, err = repos.Sesiones.Renovar(context.Background(), celular.RefreshToken, &models.Sesiones{TokenSesion: nuevoToken(), RefreshToken: nuevoToken()}, 15)
+	esperarMensaje(t, "Renovar con refresh token usado", mensaje, err, expirada)
+
+	// la notebook no se usó en 30 minutos: venció por inactividad
+	ahora = ahora.Add(10 * time.Minute)
+	mensaje, err = repos.Sesiones.Renovar(context.Background(), notebook.RefreshToken, &models.Sesiones{TokenSesion: nuevoToken(), RefreshToken: nuevoToken()}, 15)
+	esperarMensaje(t, "Renovar inactiva", mensaje, err, expirada)
+
+	// renovando a tiempo, la sesión vence a las 2 horas del login; el último token no la supera
+	for ahora.Before(celular.FechaExpiracion.Add(-10 * time.Minute)) {
+		mensaje, err = repos.Sesiones.Renovar(context.Background(), renovada.RefreshToken, renovada, 15)
+		esperarMensaje(t, "Renovar periódico", mensaje, err, "OK")
+		ahora = ahora.Add(10 * time.Minute)
+	}
+	mensaje, err = repos.Sesiones.Renovar(context.Background(), renovada.RefreshToken, renovada, 15)
+	esperarMensaje(t, "Renovar antes del vencimiento", mensaje, err, "OK")
+	if !renovada.FechaExpiracionToken.Equal(celular.FechaExpiracion) {
+		t.Fatalf("el token no debe superar el vencimiento de la sesión: %v %v", renovada.FechaExpiracionToken, celular.FechaExpiracion)
+	}
+	ahora = celular.FechaExpiracion
+	autenticar("Autenticar sesión vencida", renovada.TokenSesion, expirada)
+	mensaje, err = repos.Sesiones.Renovar(context.Background(), renovada.RefreshToken, &models.Sesiones{TokenSesion: nuevoToken(), RefreshToken: nuevoToken()}, 15)
+	esperarMensaje(t, "Renovar sesión vencida", mensaje, err, expirada)
+
+	// cada usuario revoca solo sus sesiones; el administrador revoca todas las de un usuario
+	_, hashAdmin, _ := repos.Usuarios.DamePassword(context.Background(), "admin")
+	sesionAdmin := nuevaSesion()
+	mensaje, err = repos.Usuarios.Login(context.Background(), &models.Usuarios{Usuario: "admin"}, hashAdmin, sesionAdmin, &models.DesafiosLogin{}, politica)
+	esperarMensaje(t, "Login admin", mensaje, err, "OK")
+	ctxAdmin := ctxUsuario(sesionAdmin.TokenSesion)
+	otra := nuevaSesion()
+	mensaje, err = repos.Usuarios.Login(context.Background(), &models.Usuarios{Usuario: "operador"}, hash, otra, &models.DesafiosLogin{}, politica)
+	esperarMensaje(t, "Login", mensaje, err, "OK")
+	mensaje, err = repos.Sesiones.Revocar(ctxUsuario(otra.TokenSesion), 1)
+	esperarMensaje(t, "Revocar sesión de otro usuario", mensaje, err, "La sesión no existe.")
+	mensaje, err = repos.Sesiones.RevocarUsuario(ctxUsuario(otra.TokenSesion), admin.IdUsuario)
+	esperarMensaje(t, "RevocarUsuario sin permisos", mensaje, err, "No tienes permisos para realizar esta acción.")
+	mensaje, err = repos.Sesiones.RevocarUsuario(ctxAdmin, 999)
+	esperarMensaje(t, "RevocarUsuario inexistente", mensaje, err, "El usuario no existe.")
+	mensaje, err = repos.Sesiones.RevocarUsuario(ctxAdmin, operador.IdUsuario)
+	esperarMensaje(t, "RevocarUsuario", mensaje, err, "OK")
+	autenticar("Autenticar revocada", otra.TokenSesion, expirada)
+
+	operaciones, err := repos.Auditoria.Buscar(ctxAdmin, repositorios.FiltroOperaciones{TipoOperacion: "RS"})
+	if err != nil || len(operaciones) != 1 || *operaciones[0].IdUsuario != admin.IdUsuario {
+		t.Fatalf("auditoría de la revocación: %+v %v", operaciones, err)
+	}
+	var detalles struct{ IdUsuario, Sesiones int }
+	if err := json.Unmarshal(operaciones[0].Detalles, &detalles); err != nil || detalles.IdUsuario != operador.IdUsuario || detalles.Sesiones != 1 {
+		t.Fatalf("detalles de la revocación: %s %v", operaciones[0].Detalles, err)
+	}
+}
+
+func TestParametrosYAutenticacionSistema(t *testing.T) {
+	bd := New()
+	bd.GuardarApiKey(models.ApiKeys{Nombre: "sistema", Sistema: "test"}, "clave")
+	bd.GuardarParametro(models.Parametros{Parametro: "version_api", Valor: "1.0.0", EsModificable: "N"})
+	bd.GuardarParametro(models.Parametros{Parametro: "MONTOMAXTRANSFER", Valor: "1000"})
+	repos := bd.Repositorios()
+	ctx := context.Background()
+
+	mensaje, _, err := repos.Autenticacion.Autenticar(ctx, "clave", "SISTEMA", "10.0.0.1")
+	esperarMensaje(t, "Autenticar sistema", mensaje, err, "OK")
+	mensaje, _, err = repos.Autenticacion.Autenticar(ctx, "otra", "SISTEMA", "10.0.0.1")
+	esperarMensaje(t, "Autenticar clave inválida", mensaje, err, "API Key inválida.")
+	mensaje, _, err = repos.Autenticacion.Autenticar(ctx, "clave", "OTRO", "10.0.0.1")
+	esperarMensaje(t, "Autenticar actor inválido", mensaje, err, "Actor inválido.")
+
+	mensaje, err = repos.Parametros.Modificar(ctx, "version_api", "2.0.0")
+	esperarMensaje(t, "Modificar no modificable", mensaje, err, "El parámetro no es modificable desde el sitio administrativo.")
+	mensaje, err = repos.Parametros.Modificar(ctx, "MONTOMAXTRANSFER", "2000")
+	esperarMensaje(t, "Modificar", mensaje, err, "OK")
+	p := &models.Parametros{Parametro: "MONTOMAXTRANSFER"}
+	mensaje, err = repos.Parametros.Dame(ctx, p)
+	esperarMensaje(t, "Dame", mensaje, err, "OK")
+	if p.Valor != "2000" {
+		t.Fatalf("valor modificado: %s", p.Valor)
+	}
+
+	modificables, err := repos.Parametros.Buscar(ctx, "MONTO", "S")
+	if err != nil || len(modificables) != 1 {
+		t.Fatalf("Buscar modificables: %v %v", modificables, err)
+	}
+	operaciones, err := repos.Auditoria.Buscar(ctx, repositorios.FiltroOperaciones{TipoOperacion: "MP"})
+	if err != nil || len(operaciones) != 1 || operaciones[0].IdUsuario != nil {
+		t.Fatalf("auditoría del cambio de parámetro a nombre del sistema: %+v %v", operaciones, err)
+	}
+}
+
+func TestRolesYPermisos(t *testing.T) {
+	bd := New()
+	admin := bd.GuardarUsuario(models.Usuarios{Usuario: "admin"}, "admin1")
+	operador := bd.GuardarUsuario(models.Usuarios{Usuario: "operador", Rol: "O"}, "operador1")
+	repos := bd.Repositorios()
+	ctxAdmin := ctxUsuario(admin.TokenSesion)
+
+	mensaje, permisos, err := repos.Autenticacion.Autenticar(context.Background(), operador.TokenSesion, "USUARIO", "10.0.0.1")
+	esperarMensaje(t, "Autenticar operador", mensaje, err, "OK")
+	if slices.Contains(permisos, auth.PermisoUsuariosAdmin) || !slices.Contains(permisos, auth.PermisoCuentasLeer) {
+		t.Fatalf("permisos del rol Operador: %v", permisos)
+	}
+	mensaje, err = repos.Roles.Crear(ctxUsuario(operador.TokenSesion), models.Roles{Rol: "C", Nombre: "Consulta", Permisos: []string{}})
+	esperarMensaje(t, "Crear sin roles:write", mensaje, err, "No tienes permisos para realizar esta acción.")
+
+	consulta := models.Roles{Rol: "C", Nombre: "Consulta", Permisos: []string{auth.PermisoMonedasLeer, auth.PermisoCuentasLeer, auth.PermisoMonedasLeer}}
+	mensaje, err = repos.Roles.Crear(ctxAdmin, models.Roles{Rol: "c", Nombre: "Consulta", Permisos: consulta.Permisos})
+	esperarMensaje(t, "Crear código inválido", mensaje, err, "El código del rol debe ser una letra mayúscula.")
+	mensaje, err = repos.Roles.Crear(ctxAdmin, models.Roles{Rol: "C", Nombre: "Consulta", Permisos: []string{"monedas:borrar"}})
+	esperarMensaje(t, "Crear permiso inexistente", mensaje, err, "El permiso monedas:borrar no existe.")
+	mensaje, err = repos.Roles.Crear(ctxAdmin, models.Roles{Rol: "C", Nombre: "Operador", Permisos: consulta.Permisos})
+	esperarMensaje(t, "Crear nombre repetido", mensaje, err, "Ya existe un rol con ese nombre.")
+	mensaje, err = repos.Roles.Crear(ctxAdmin, consulta)
+	esperarMensaje(t, "Crear", mensaje, err, "OK")
+	rol := &models.Roles{Rol: "C"}
+	mensaje, err = repos.Roles.Dame(ctxAdmin, rol)
+	esperarMensaje(t, "Dame", mensaje, err, "OK")
+	if !slices.Equal(rol.Permisos, []string{auth.PermisoCuentasLeer, auth.PermisoMonedasLeer}) {
+		t.Fatalf("permisos sin repetir y ordenados: %v", rol.Permisos)
+	}
+
+	mensaje, err = repos.Roles.Modificar(ctxAdmin, models.Roles{Rol: "A", Nombre: "Administrador", Permisos: []string{}})
+	esperarMensaje(t, "Modificar Administrador", mensaje, err, "El rol Administrador no se puede modificar.")
+	mensaje, err = repos.Roles.AsignarUsuario(ctxAdmin, admin.IdUsuario, "C")
+	esperarMensaje(t, "Asignar a sí mismo", mensaje, err, "No puedes realizar esta acción sobre tu propia cuenta.")
+	mensaje, err = repos.Roles.AsignarUsuario(ctxAdmin, operador.IdUsuario, "S")
+	esperarMensaje(t, "Asignar Sistema", mensaje, err, "El rol Sistema es exclusivo de la API key del sistema.")
+	mensaje, err = repos.Roles.AsignarUsuario(ctxAdmin, operador.IdUsuario, "C")
+	esperarMensaje(t, "Asignar", mensaje, err, "OK")
+
+	// los permisos del rol rigen desde el siguiente request
+	mensaje, err = repos.Roles.Modificar(ctxAdmin, models.Roles{Rol: "C", Nombre: "Consulta", Permisos: []string{auth.PermisoMonedasLeer}})
+	esperarMensaje(t, "Modificar", mensaje, err, "OK")
+	_, permisos, _ = repos.Autenticacion.Autenticar(context.Background(), operador.TokenSesion, "USUARIO", "10.0.0.1")
+	if !slices.Equal(permisos, []string{auth.PermisoMonedasLeer}) {
+		t.Fatalf("permisos tras modificar el rol: %v", permisos)
+	}
+
+	mensaje, err = repos.Roles.Borrar(ctxAdmin, "C")
+	esperarMensaje(t, "Borrar con usuarios", mensaje, err, "El rol tiene usuarios asignados.")
+	mensaje, err = repos.Roles.Borrar(ctxAdmin, "S")
+	esperarMensaje(t, "Borrar Sistema", mensaje, err, "El rol no se puede borrar.")
+	mensaje, err = repos.Roles.AsignarUsuario(ctxAdmin, operador.IdUsuario, "O")
+	esperarMensaje(t, "Asignar Operador", mensaje, err, "OK")
+	mensaje, err = repos.Roles.Borrar(ctxAdmin, "C")
+	esperarMensaje(t, "Borrar", mensaje, err, "OK")
+
+	for tipo, cantidad := range map[string]int{"CR": 1, "MR": 1, "AR": 2, "BR": 1} {
+		operaciones, err := repos.Auditoria.Buscar(ctxAdmin, repositorios.FiltroOperaciones{TipoOperacion: tipo})
+		if err != nil || len(operaciones) != cantidad {
+			t.Fatalf("auditoría %s: %+v %v", tipo, operaciones, err)
+		}
+	}
+}
+
+func TestApiKeys(t *testing.T) {
+	bd := New()
+	ahora := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	bd.ahora = func() time.Time { return ahora }
+	admin := bd.GuardarUsuario(models.Usuarios{Usuario: "admin"}, "admin1")
+	operador := bd.GuardarUsuario(models.Usuarios{Usuario: "operador", Rol: "O"}, "operador1")
+	repos := bd.Repositorios()
+	ctxAdmin := ctxUsuario(admin.TokenSesion)
+	autenticar := func(operacion string, clave string, ip string, esperado string) []string {
+		t.Helper()
+		mensaje, permisos, err := repos.Autenticacion.Autenticar(context.Background(), clave, "SISTEMA", ip)
+		esperarMensaje(t, operacion, mensaje, err, esperado)
+		return permisos
+	}
+
+	vence := ahora.Add(time.Hour)
+	lectura := &models.ApiKeys{Nombre: "reportes", Sistema: "BI", Alcances: []string{auth.AlcanceLectura},
+		IPsPermitidas: []string{"10.1.0.0/16"}, FechaExpiracion: &vence, ApiKey: "mstf_lectura"}
+	mensaje, err := repos.ApiKeys.Crear(ctxUsuario(operador.TokenSesion), lectura)
+	esperarMensaje(t, "Crear sin apikeys:write", mensaje, err, "No tienes permisos para realizar esta acción.")
+	mensaje, err = repos.ApiKeys.Crear(ctxAdmin, lectura)
+	esperarMensaje(t, "Crear", mensaje, err, "OK")
+	mensaje, err = repos.ApiKeys.Crear(ctxAdmin, &models.ApiKeys{Nombre: "reportes", Sistema: "BI", Alcances: []string{auth.AlcanceAdmin}, IPsPermitidas: []string{}})
+	esperarMensaje(t, "Crear nombre repetido", mensaje, err, "Ya existe una API key con ese nombre.")
+	mensaje, err = repos.ApiKeys.Crear(ctxAdmin, &models.ApiKeys{Nombre: "otra", Sistema: "BI", Alcances: []string{"escritura"}, IPsPermitidas: []string{}})
+	esperarMensaje(t, "Crear alcance inexistente", mensaje, err, "El alcance escritura no existe.")
+
+	// lectura: solo los permisos de consulta del rol S, y solo desde las IPs permitidas
+	permisos := autenticar("Autenticar lectura", "mstf_lectura", "10.1.2.3", "OK")
+	if !slices.Contains(permisos, auth.PermisoMonedasLeer) || slices.Contains(permisos, auth.PermisoTransferenciasEscribir) {
+		t.Fatalf("permisos del alcance lectura: %v", permisos)
+	}
+	autenticar("Autenticar desde otra IP", "mstf_lectura", "10.2.0.1", "La IP no está autorizada para usar la API key.")
+
+	transferencias := &models.ApiKeys{Nombre: "pagos", Sistema: "Pagos", Alcances: []string{auth.AlcanceTransferencias, auth.AlcanceLectura},
+		IPsPermitidas: []string{}, ApiKey: "mstf_pagos"}
+	mensaje, err = repos.ApiKeys.Crear(ctxAdmin, transferencias)
+	esperarMensaje(t, "Crear transferencias", mensaje, err, "OK")
+	permisos = autenticar("Autenticar transferencias", "mstf_pagos", "192.168.0.9", "OK")
+	if !slices.Contains(permisos, auth.PermisoTransferenciasEscribir) || slices.Contains(permisos, auth.PermisoMonedasEscribir) {
+		t.Fatalf("permisos de los alcances transferencias y lectura: %v", permisos)
+	}
+
+	// rotar: la anterior deja de valer y la nueva conserva la configuración
+	mensaje, err = repos.ApiKeys.Rotar(ctxAdmin, transferencias.IdApiKey, "mstf_pagos2")
+	esperarMensaje(t, "Rotar", mensaje, err, "OK")
+	autenticar("Autenticar rotada", "mstf_pagos", "192.168.0.9", "API Key inválida.")
+	autenticar("Autenticar nueva", "mstf_pagos2", "192.168.0.9", "OK")
+
+	// revocar
+	mensaje, err = repos.ApiKeys.Revocar(ctxAdmin, transferencias.IdApiKey)
+	esperarMensaje(t, "Revocar", mensaje, err, "OK")
+	autenticar("Autenticar revocada", "mstf_pagos2", "192.168.0.9", "API Key inválida.")
+	mensaje, err = repos.ApiKeys.Revocar(ctxAdmin, transferencias.IdApiKey)
+	esperarMensaje(t, "Revocar revocada", mensaje, err, "La API key ya está revocada.")
+	mensaje, err = repos.ApiKeys.Rotar(ctxAdmin, transferencias.IdApiKey, "mstf_pagos3")
+	esperarMensaje(t, "Rotar revocada", mensaje, err, "La API key está revocada.")
+
+	// vencimiento
+	ahora = vence
+	autenticar("Autenticar vencida", "mstf_lectura", "10.1.2.3", "La API key expiró.")
+
+	apiKeys, err := repos.ApiKeys.Listar(ctxAdmin)
+	if err != nil || len(apiKeys) != 2 || apiKeys[0].Nombre != "pagos" || apiKeys[0].Estado != "R" || apiKeys[0].Prefijo != "mstf_pagos2" ||
+		apiKeys[1].FechaUltimoUso == nil || apiKeys[1].ApiKey != "" {
+		t.Fatalf("Listar: %+v %v", apiKeys, err)
+	}
+	for _, tipo := range []string{"CK", "RK", "VK"} {
+		operaciones, err := repos.Auditoria.Buscar(ctxAdmin, repositorios.FiltroOperaciones{TipoOperacion: tipo})
+		if err != nil || len(operaciones) == 0 || *operaciones[0].IdUsuario != admin.IdUsuario {
+			t.Fatalf("auditoría %s: %+v %v", tipo, operaciones, err)
+		}
+	}
+}
+
+func TestBloqueoLoginProgresivo(t *testing.T) {
+	bd := New()
+	ahora := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	bd.ahora = func() time.Time { return ahora }
+	bd.GuardarUsuario(models.Usuarios{Usuario: "operador", Rol: "O"}, "operador1")
+	repos := bd.Repositorios()
+	politica := repositorios.PoliticaBloqueoLogin{IntentosMax: 3, SegundosBloqueo: 60, MinutosBloqueoMax: 3, HorasVentana: 24}
+	reservar := func(usuario string) int {
+		t.Helper()
+		mensaje, segundos, err := repos.Usuarios.ReservarIntentoLogin(context.Background(), usuario, "10.0.0.1", politica)
+		esperarMensaje(t, "ReservarIntentoLogin", mensaje, err, "OK")
+		return segundos
+	}
+	liberar := func() {
+		t.Helper()
+		mensaje, err := repos.Usuarios.LiberarIntentoLogin(context.Background(), "operador")
+		esperarMensaje(t, "LiberarIntentoLogin", mensaje, err, "OK")
+	}
+	fallar := func(usuario string, esperados int) {
+		t.Helper()
+		if s := reservar(usuario); s != 0 {
+			t.Fatalf("ReservarIntentoLogin: bloqueado por %d segundos", s)
+		}
+		mensaje, segundos, err := repos.Usuarios.RegistrarLoginFallido(context.Background(), usuario, politica)
+		esperarMensaje(t, "RegistrarLoginFallido", mensaje, err, "OK")
+		if segundos != esperados {
+			t.Fatalf("RegistrarLoginFallido: bloqueo de %d segundos, se esperaban %d", segundos, esperados)
+		}
+	}
+	// un intento con credenciales válidas se libera
+	bloqueo := func() int {
+		t.Helper()
+		s := reservar("operador")
+		if s == 0 {
+			liberar()
+		}
+		return s
+	}
+
+	// el bloqueo se duplica en cada uno, hasta el máximo; el nombre no distingue mayúsculas
+	fallar("operador", 0)
+	fallar("OPERADOR", 0)
+	fallar("operador", 60)
+	if s := bloqueo(); s != 60 {
+		t.Fatalf("bloqueo vigente: %d", s)
+	}
+	ahora = ahora.Add(time.Minute)
+	if s := bloqueo(); s != 0 {
+		t.Fatalf("bloqueo vencido: %d", s)
+	}
+	fallar("operador", 0)
+	fallar("operador", 0)
+	fallar("operador", 120)
+	if s := bloqueo(); s != 120 {
+		t.Fatalf("bloqueo vigente: %d", s)
+	}
+	ahora = ahora.Add(2 * time.Minute)
+	fallar("operador", 0)
+	fallar("operador", 0)
+	fallar("operador", 180)
+
+	// pasada la ventana se empieza de nuevo
+	ahora = ahora.Add(25 * time.Hour)
+	fallar("operador", 0)
+	fallar("operador", 0)
+	fallar("operador", 60)
+
+	// los intentos en curso cuentan: con el máximo reservado se rechaza sin reservar, hasta que se libere uno
+	ahora = ahora.Add(time.Minute)
+	for range 3 {
+		if s := reservar("operador"); s != 0 {
+			t.Fatalf("reserva %d", s)
+		}
+	}
+	if s := reservar("operador"); s != 60 {
+		t.Fatalf("reserva con el máximo en curso: %d", s)
+	}
+	liberar()
+	if s := reservar("operador"); s != 0 {
+		t.Fatalf("reserva tras liberar un intento: %d", s)
+	}
+	for range 3 {
+		liberar()
+	}
+
+	// un login exitoso (tsp_crear_sesion) borra los intentos
+	fallar("operador", 0)
+	bd.GuardarUsuario(models.Usuarios{IdUsuario: 1, Usuario: "operador", Rol: "O"}, "operador1")
+	if _, ok := bd.bloqueos["operador"]; ok {
+		t.Fatal("crear una sesión debe borrar los intentos fallidos")
+	}
+}
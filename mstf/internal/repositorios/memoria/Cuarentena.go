@@ -0,0 +1,41 @@
+package memoria
+
+import (
+	"MSTransaccionesFinancieras/internal/models"
+	"context"
+	"time"
+)
+
+type Cuarentena struct {
+	b *BaseDatos
+}
+
+// tsp_crear_mensaje_cuarentena
+func (r *Cuarentena) Crear(ctx context.Context, Mensaje models.MensajesCuarentena) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	if Mensaje.Origen == "" {
+		return "El origen es obligatorio.", nil
+	}
+	if len(Mensaje.Error) > 500 {
+		Mensaje.Error = Mensaje.Error[:500]
+	}
+	r.b.ultimoId.mensaje++
+	Mensaje.IdMensaje = r.b.ultimoId.mensaje
+	Mensaje.FechaAlta = r.b.ahora().Truncate(time.Second)
+	r.b.cuarentena = append(r.b.cuarentena, Mensaje)
+	return "OK", nil
+}
+
+// tsp_buscar_mensajes_cuarentena
+func (r *Cuarentena) Buscar(ctx context.Context, IdTransferencia string, Limite int) ([]models.MensajesCuarentena, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	mensajes := make([]models.MensajesCuarentena, 0)
+	for i := len(r.b.cuarentena) - 1; i >= 0 && len(mensajes) < Limite; i-- {
+		if m := r.b.cuarentena[i]; IdTransferencia == "" || m.IdTransferencia == IdTransferencia {
+			mensajes = append(mensajes, m)
+		}
+	}
+	return mensajes, nil
+}
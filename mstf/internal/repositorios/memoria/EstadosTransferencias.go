@@ -0,0 +1,58 @@
+package memoria
+
+import (
+	"MSTransaccionesFinancieras/internal/models"
+	"context"
+	"slices"
+	"time"
+)
+
+type EstadosTransferencias struct {
+	b *BaseDatos
+}
+
+// tsp_registrar_estados_transferencias
+func (r *EstadosTransferencias) Registrar(ctx context.Context, Notificaciones []models.TransferenciaNotificada) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	ahora := r.b.ahora().Truncate(time.Second)
+	for _, n := range Notificaciones {
+		if n.IdTransferencia == "" || n.Estado == "" {
+			continue
+		}
+		if len(n.Mensaje) > 255 {
+			n.Mensaje = n.Mensaje[:255]
+		}
+		e := models.EstadosTransferencias{
+			IdTransferencia: n.IdTransferencia, IdCorrelacion: n.IdCorrelacion, Estado: n.Estado, Mensaje: n.Mensaje,
+			Tipo: n.Tipo, IdMoneda: n.IdMoneda, IdUsuarioFinal: n.IdUsuarioFinal, FechaAlta: ahora,
+		}
+		// ON DUPLICATE KEY UPDATE: la fila pasa a ser la modificada más recientemente
+		i := slices.IndexFunc(r.b.estados, func(f models.EstadosTransferencias) bool { return f.IdTransferencia == n.IdTransferencia })
+		if i >= 0 {
+			anterior := r.b.estados[i]
+			r.b.estados = slices.Delete(r.b.estados, i, i+1)
+			e.Tipo, e.IdMoneda, e.IdUsuarioFinal, e.FechaAlta = anterior.Tipo, anterior.IdMoneda, anterior.IdUsuarioFinal, anterior.FechaAlta
+			if anterior.Estado == "F" {
+				e.IdCorrelacion, e.Mensaje, e.Estado = anterior.IdCorrelacion, anterior.Mensaje, anterior.Estado
+			}
+		}
+		e.FechaModificacion = ahora
+		r.b.estados = append(r.b.estados, e)
+	}
+	return "OK", nil
+}
+
+// tsp_buscar_estados_transferencias
+func (r *EstadosTransferencias) Buscar(ctx context.Context, IdTransferencia string, IdCorrelacion string, Limite int) ([]models.EstadosTransferencias, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	estados := make([]models.EstadosTransferencias, 0)
+	for i := len(r.b.estados) - 1; i >= 0 && len(estados) < Limite; i-- {
+		e := r.b.estados[i]
+		if (IdTransferencia == "" || e.IdTransferencia == IdTransferencia) && (IdCorrelacion == "" || e.IdCorrelacion == IdCorrelacion) {
+			estados = append(estados, e)
+		}
+	}
+	return estados, nil
+}
@@ -0,0 +1,148 @@
+package memoria
+
+import (
+	"MSTransaccionesFinancieras/internal/models"
+	"context"
+	"sort"
+	"strings"
+)
+
+type Monedas struct {
+	b *BaseDatos
+}
+
+// tsp_dame_moneda
+func (r *Monedas) Dame(ctx context.Context, m *models.Monedas) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	guardada, ok := r.b.monedas[m.IdMoneda]
+	if !ok {
+		*m = models.Monedas{}
+		return "La moneda no existe.", nil
+	}
+	*m = guardada
+	return "OK", nil
+}
+
+// tsp_listar_monedas
+func (r *Monedas) Listar(ctx context.Context, IncluyeInactivos string) ([]models.Monedas, error) {
+	estados := map[string]string{"N": "A", "S": "AI", "T": "AIP"}[IncluyeInactivos]
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	monedas := make([]models.Monedas, 0)
+	for _, m := range r.b.monedas {
+		if estados != "" && strings.Contains(estados, m.Estado) {
+			monedas = append(monedas, m)
+		}
+	}
+	sort.Slice(monedas, func(i, j int) bool { return monedas[i].IdMoneda < monedas[j].IdMoneda })
+	return monedas, nil
+}
+
+// tsp_crear_moneda
+func (r *Monedas) Crear(ctx context.Context, Moneda models.Monedas) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := r.b.resolverActor(ctx)
+	if mensaje != "OK" {
+		return mensaje, nil
+	}
+	if Moneda.IdMoneda <= 0 {
+		return "El Id de moneda es obligatorio.", nil
+	}
+	if strings.TrimSpace(Moneda.IdCuentaEmpresa) == "" {
+		return "El IdCuentaEmpresa de la moneda es obligatorio.", nil
+	}
+	existente, ok := r.b.monedas[Moneda.IdMoneda]
+	if ok && existente.Estado == "A" {
+		return "La moneda ya existe.", nil
+	}
+	// una moneda Pendiente o Inactiva se deja como está: el SP solo inserta si no existe
+	if ok {
+		return "OK", nil
+	}
+	r.b.monedas[Moneda.IdMoneda] = models.Monedas{IdMoneda: Moneda.IdMoneda, IdCuentaEmpresa: Moneda.IdCuentaEmpresa, Estado: "P", FechaAlta: r.b.ahora()}
+	if err := r.b.auditar(actor, "CM", map[string]any{"IdMoneda": Moneda.IdMoneda, "IdCuentaEmpresa": Moneda.IdCuentaEmpresa}); err != nil {
+		return "", err
+	}
+	return "OK", nil
+}
+
+// tsp_activar_moneda
+func (r *Monedas) Activar(ctx context.Context, IdMoneda int) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := r.b.resolverActor(ctx)
+	if mensaje != "OK" {
+		return mensaje, nil
+	}
+	m, ok := r.b.monedas[IdMoneda]
+	if !ok {
+		return "La moneda no existe.", nil
+	}
+	if m.Estado == "A" {
+		return "La moneda ya está en estado Activo.", nil
+	}
+	if m.Estado != "P" && m.Estado != "I" {
+		return "La moneda no está en estado Inactivo ni Pendiente.", nil
+	}
+	log := "Activación manual de moneda"
+	if m.Estado == "P" {
+		log = "Activación luego de creación de moneda en TigerBeetle"
+	}
+	m.Estado = "A"
+	r.b.monedas[IdMoneda] = m
+	if err := r.b.auditar(actor, "AM", map[string]any{"IdMoneda": IdMoneda, "Log": log}); err != nil {
+		return "", err
+	}
+	return "OK", nil
+}
+
+// tsp_desactivar_moneda
+func (r *Monedas) Desactivar(ctx context.Context, IdMoneda int) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := r.b.resolverActor(ctx)
+	if mensaje != "OK" {
+		return mensaje, nil
+	}
+	m, ok := r.b.monedas[IdMoneda]
+	if !ok {
+		return "La moneda no existe.", nil
+	}
+	if m.Estado != "A" {
+		return "La moneda no está en estado Activo.", nil
+	}
+	m.Estado = "I"
+	r.b.monedas[IdMoneda] = m
+	if err := r.b.auditar(actor, "DM", map[string]any{"IdMoneda": IdMoneda}); err != nil {
+		return "", err
+	}
+	return "OK", nil
+}
+
+// tsp_borrar_moneda
+func (r *Monedas) Borrar(ctx context.Context, IdMoneda int) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := r.b.resolverActor(ctx)
+	if mensaje != "OK" {
+		return mensaje, nil
+	}
+	m, ok := r.b.monedas[IdMoneda]
+	if !ok {
+		return "La moneda no existe.", nil
+	}
+	if m.Estado != "P" && m.Estado != "I" {
+		return "Solo se pueden borrar monedas en estado Inactivo o Pendiente.", nil
+	}
+	log := "Borrado manual de moneda"
+	if m.Estado == "P" {
+		log = "Rollback por error en creación de moneda"
+	}
+	delete(r.b.monedas, IdMoneda)
+	if err := r.b.auditar(actor, "BM", map[string]any{"IdMoneda": IdMoneda, "Log": log}); err != nil {
+		return "", err
+	}
+	return "OK", nil
+}
@@ -0,0 +1,67 @@
+package memoria
+
+import (
+	"MSTransaccionesFinancieras/internal/models"
+	"context"
+	"sort"
+	"strings"
+)
+
+type Parametros struct {
+	b *BaseDatos
+}
+
+// tsp_dame_parametro
+func (r *Parametros) Dame(ctx context.Context, p *models.Parametros) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	guardado, ok := r.b.parametros[p.Parametro]
+	if !ok {
+		*p = models.Parametros{}
+		return "El parámetro no existe.", nil
+	}
+	*p = guardado
+	return "OK", nil
+}
+
+// tsp_buscar_parametros
+func (r *Parametros) Buscar(ctx context.Context, Cadena string, SoloModificables string) ([]models.Parametros, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	var parametros []models.Parametros
+	for _, p := range r.b.parametros {
+		if !strings.Contains(p.Parametro, strings.TrimSpace(Cadena)) {
+			continue
+		}
+		if SoloModificables != "N" && !(SoloModificables == "S" && p.EsModificable == "S") {
+			continue
+		}
+		parametros = append(parametros, p)
+	}
+	sort.Slice(parametros, func(i, j int) bool { return parametros[i].Parametro < parametros[j].Parametro })
+	return parametros, nil
+}
+
+// tsp_modificar_parametro
+func (r *Parametros) Modificar(ctx context.Context, Parametro string, Valor string) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := r.b.resolverActor(ctx)
+	if mensaje != "OK" {
+		return mensaje, nil
+	}
+	p, ok := r.b.parametros[Parametro]
+	if !ok {
+		return "El parámetro no existe.", nil
+	}
+	if p.EsModificable == "N" {
+		return "El parámetro no es modificable desde el sitio administrativo.", nil
+	}
+	valorAnterior := p.Valor
+	p.Valor = Valor
+	r.b.parametros[Parametro] = p
+	if err := r.b.auditar(actor, "MP", map[string]any{"Parametro": Parametro, "ValorAnterior": valorAnterior, "ValorNuevo": Valor}); err != nil {
+		return "", err
+	}
+	return "OK", nil
+}
@@ -0,0 +1,246 @@
+package memoria
+
+import (
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/models"
+	"context"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type Roles struct {
+	b *BaseDatos
+}
+
+// Catálogo de Permisos de DUMP_DB.sql
+func permisosDump() []models.Permisos {
+	return []models.Permisos{
+		{Permiso: auth.PermisoApiKeysLeer, Descripcion: "Consultar las API keys de los sistemas cliente"},
+		{Permiso: auth.PermisoApiKeysEscribir, Descripcion: "Crear, rotar y revocar API keys de los sistemas cliente"},
+		{Permiso: auth.PermisoAuditoriaLeer, Descripcion: "Consultar y exportar la auditoría de operaciones"},
+		{Permiso: auth.PermisoConsumidorLeer, Descripcion: "Consultar el estado, los offsets y la cuarentena del consumidor Kafka"},
+		{Permiso: auth.PermisoConsumidorEscribir, Descripcion: "Pausar y reanudar el consumidor Kafka y reprocesar mensajes en cuarentena"},
+		{Permiso: auth.PermisoCuentasCerrar, Descripcion: "Activar y desactivar cuentas"},
+		{Permiso: auth.PermisoCuentasLeer, Descripcion: "Consultar cuentas, sus balances y sus transferencias"},
+		{Permiso: auth.PermisoCuentasEscribir, Descripcion: "Crear cuentas"},
+		{Permiso: auth.PermisoMonedasLeer, Descripcion: "Consultar monedas"},
+		{Permiso: auth.PermisoMonedasEscribir, Descripcion: "Crear, activar, desactivar y borrar monedas"},
+		{Permiso: auth.PermisoParametrosLeer, Descripcion: "Consultar parámetros"},
+		{Permiso: auth.PermisoParametrosEscribir, Descripcion: "Modificar parámetros"},
+		{Permiso: auth.PermisoRolesLeer, Descripcion: "Consultar roles y permisos"},
+		{Permiso: auth.PermisoRolesEscribir, Descripcion: "Crear, modificar y borrar roles y asignar roles a usuarios"},
+		{Permiso: auth.PermisoSistemaAdmin, Descripcion: "Administrar niveles de log e inyección de fallas"},
+		{Permiso: auth.PermisoTransferenciasLeer, Descripcion: "Consultar transferencias y sus estados"},
+		{Permiso: auth.PermisoTransferenciasEscribir, Descripcion: "Crear transferencias"},
+		{Permiso: auth.PermisoUsuariosAdmin, Descripcion: "Crear, activar, desactivar y borrar usuarios, restablecer contraseñas y cerrar sus sesiones"},
+		{Permiso: auth.PermisoUsuariosLeer, Descripcion: "Consultar usuarios"},
+	}
+}
+
+// Roles y RolesPermisos de DUMP_DB.sql: A (Administrador) y S (Sistema) con todos los permisos, O (Operador)
+// con los de consulta y operación de cuentas y transferencias
+func rolesDump() map[string]*models.Roles {
+	return map[string]*models.Roles{
+		"A": {Rol: "A", Nombre: "Administrador", Permisos: slices.Clone(auth.Permisos)},
+		"O": {Rol: "O", Nombre: "Operador", Permisos: []string{
+			auth.PermisoConsumidorLeer, auth.PermisoCuentasCerrar, auth.PermisoCuentasLeer, auth.PermisoCuentasEscribir,
+			auth.PermisoMonedasLeer, auth.PermisoParametrosLeer, auth.PermisoTransferenciasLeer, auth.PermisoTransferenciasEscribir,
+		}},
+		"S": {Rol: "S", Nombre: "Sistema", Permisos: slices.Clone(auth.Permisos)},
+	}
+}
+
+var codigoRol = regexp.MustCompile(`^[A-Z]$`)
+
+// tsp_dame_rol
+func (r *Roles) Dame(ctx context.Context, rol *models.Roles) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	guardado, ok := r.b.roles[rol.Rol]
+	if !ok {
+		return "El rol no existe.", nil
+	}
+	*rol = *guardado
+	rol.Permisos = slices.Clone(guardado.Permisos)
+	rol.Usuarios = 0
+	return "OK", nil
+}
+
+// tsp_listar_roles
+func (r *Roles) Listar(ctx context.Context) ([]models.Roles, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	roles := make([]models.Roles, 0, len(r.b.roles))
+	for _, guardado := range r.b.roles {
+		rol := *guardado
+		rol.Permisos = slices.Clone(guardado.Permisos)
+		rol.Usuarios = r.b.usuariosConRol(rol.Rol)
+		roles = append(roles, rol)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Rol < roles[j].Rol })
+	return roles, nil
+}
+
+// tsp_listar_permisos
+func (r *Roles) ListarPermisos(ctx context.Context) ([]models.Permisos, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	return slices.Clone(r.b.permisos), nil
+}
+
+// tsp_crear_rol
+func (r *Roles) Crear(ctx context.Context, Rol models.Roles) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := r.resolverActor(ctx)
+	if mensaje != "OK" {
+		return mensaje, nil
+	}
+	if !codigoRol.MatchString(Rol.Rol) {
+		return "El código del rol debe ser una letra mayúscula.", nil
+	}
+	if _, ok := r.b.roles[Rol.Rol]; ok {
+		return "El rol ya existe.", nil
+	}
+	if mensaje := r.validar(Rol); mensaje != "OK" {
+		return mensaje, nil
+	}
+	r.b.roles[Rol.Rol] = &models.Roles{Rol: Rol.Rol, Nombre: Rol.Nombre, Permisos: distintos(Rol.Permisos)}
+	if err := r.b.auditar(actor, "CR", map[string]any{"Rol": Rol.Rol, "Nombre": Rol.Nombre, "Permisos": Rol.Permisos}); err != nil {
+		return "", err
+	}
+	return "OK", nil
+}
+
+// tsp_modificar_rol
+func (r *Roles) Modificar(ctx context.Context, Rol models.Roles) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := r.resolverActor(ctx)
+	if mensaje != "OK" {
+		return mensaje, nil
+	}
+	guardado, ok := r.b.roles[Rol.Rol]
+	if !ok {
+		return "El rol no existe.", nil
+	}
+	if Rol.Rol == "A" {
+		return "El rol Administrador no se puede modificar.", nil
+	}
+	if mensaje := r.validar(Rol); mensaje != "OK" {
+		return mensaje, nil
+	}
+	guardado.Nombre = Rol.Nombre
+	guardado.Permisos = distintos(Rol.Permisos)
+	if err := r.b.auditar(actor, "MR", map[string]any{"Rol": Rol.Rol, "Nombre": Rol.Nombre, "Permisos": Rol.Permisos}); err != nil {
+		return "", err
+	}
+	return "OK", nil
+}
+
+// tsp_borrar_rol
+func (r *Roles) Borrar(ctx context.Context, Rol string) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := r.resolverActor(ctx)
+	if mensaje != "OK" {
+		return mensaje, nil
+	}
+	if _, ok := r.b.roles[Rol]; !ok {
+		return "El rol no existe.", nil
+	}
+	if Rol == "A" || Rol == "S" {
+		return "El rol no se puede borrar.", nil
+	}
+	if r.b.usuariosConRol(Rol) > 0 {
+		return "El rol tiene usuarios asignados.", nil
+	}
+	delete(r.b.roles, Rol)
+	if err := r.b.auditar(actor, "BR", map[string]any{"Rol": Rol}); err != nil {
+		return "", err
+	}
+	return "OK", nil
+}
+
+// tsp_asignar_rol_usuario
+func (r *Roles) AsignarUsuario(ctx context.Context, IdUsuario int, Rol string) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := r.resolverActor(ctx)
+	if mensaje != "OK" {
+		return mensaje, nil
+	}
+	if actor != nil && actor.IdUsuario == IdUsuario {
+		return "No puedes realizar esta acción sobre tu propia cuenta.", nil
+	}
+	u, ok := r.b.usuarios[IdUsuario]
+	if !ok {
+		return "El usuario no existe.", nil
+	}
+	if _, ok := r.b.roles[Rol]; !ok {
+		return "El rol no existe.", nil
+	}
+	if Rol == "S" {
+		return "El rol Sistema es exclusivo de la API key del sistema.", nil
+	}
+	if u.Rol == Rol {
+		return "El usuario ya tiene ese rol.", nil
+	}
+	anterior := u.Rol
+	u.Rol = Rol
+	if err := r.b.auditar(actor, "AR", map[string]any{"IdUsuario": IdUsuario, "Rol": Rol, "RolAnterior": anterior}); err != nil {
+		return "", err
+	}
+	return "OK", nil
+}
+
+// Actor de las operaciones sobre roles: sesión válida y permiso roles:write. Debe llamarse con el lock tomado.
+func (r *Roles) resolverActor(ctx context.Context) (*usuario, string) {
+	actor, mensaje := r.b.resolverActor(ctx)
+	if mensaje != "OK" {
+		return nil, mensaje
+	}
+	if actor != nil && !r.b.tienePermiso(actor, auth.PermisoRolesEscribir) {
+		return nil, "No tienes permisos para realizar esta acción."
+	}
+	return actor, "OK"
+}
+
+// Nombre único y permisos del catálogo, como tsp_crear_rol y tsp_modificar_rol. Debe llamarse con el lock tomado.
+func (r *Roles) validar(Rol models.Roles) string {
+	if strings.TrimSpace(Rol.Nombre) == "" {
+		return "El nombre del rol es obligatorio."
+	}
+	for _, guardado := range r.b.roles {
+		if guardado.Nombre == Rol.Nombre && guardado.Rol != Rol.Rol {
+			return "Ya existe un rol con ese nombre."
+		}
+	}
+	if Rol.Permisos == nil {
+		return "Los permisos deben ser un array JSON."
+	}
+	for _, permiso := range Rol.Permisos {
+		if !slices.ContainsFunc(r.b.permisos, func(p models.Permisos) bool { return p.Permiso == permiso }) {
+			return "El permiso " + permiso + " no existe."
+		}
+	}
+	return "OK"
+}
+
+// Cantidad de usuarios con el rol. Debe llamarse con el lock tomado.
+func (b *BaseDatos) usuariosConRol(Rol string) int {
+	cantidad := 0
+	for _, u := range b.usuarios {
+		if u.Rol == Rol {
+			cantidad++
+		}
+	}
+	return cantidad
+}
+
+// Permisos sin repetir y ordenados, como los devuelve GROUP_CONCAT
+func distintos(Permisos []string) []string {
+	return slices.Compact(slices.Sorted(slices.Values(Permisos)))
+}
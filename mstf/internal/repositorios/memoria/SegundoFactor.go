@@ -0,0 +1,230 @@
+package memoria
+
+import (
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"MSTransaccionesFinancieras/internal/utils"
+	"context"
+	"slices"
+	"time"
+)
+
+type SegundoFactor struct {
+	b *BaseDatos
+}
+
+// Fila de SegundoFactor con los SHA-256 de sus códigos de recuperación (CodigosRecuperacion)
+type segundoFactor struct {
+	models.SegundoFactor
+	codigos []string
+}
+
+// Fila de DesafiosLogin. tipo: V (verificar código) o I (inscribir)
+type desafio struct {
+	idDesafio       int
+	idUsuario       int
+	tokenHash       string
+	tipo            string
+	fechaExpiracion time.Time
+	intentos        int
+}
+
+// tsp_dame_segundo_factor
+func (r *SegundoFactor) Dame(ctx context.Context, TokenDesafio string, f *models.SegundoFactor) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	u, _, mensaje := r.resolverUsuario(ctx, TokenDesafio)
+	if mensaje != "OK" {
+		*f = models.SegundoFactor{}
+		return mensaje, nil
+	}
+	*f = models.SegundoFactor{IdUsuario: u.IdUsuario, Usuario: u.Usuario}
+	if sf, ok := r.b.factores[u.IdUsuario]; ok {
+		f.Secreto, f.Estado, f.UltimoPaso = sf.Secreto, sf.Estado, sf.UltimoPaso
+	}
+	return "OK", nil
+}
+
+// tsp_inscribir_segundo_factor
+func (r *SegundoFactor) Inscribir(ctx context.Context, TokenDesafio string, Secreto string) (string, string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	u, d, mensaje := r.resolverUsuario(ctx, TokenDesafio)
+	if mensaje != "OK" {
+		return mensaje, "", nil
+	}
+	if sf, ok := r.b.factores[u.IdUsuario]; (d != nil && d.tipo == "V") || (ok && sf.Estado == "A") {
+		return "El segundo factor ya está activo.", "", nil
+	}
+	if Secreto == "" {
+		return "El secreto es obligatorio.", "", nil
+	}
+	r.b.factores[u.IdUsuario] = &segundoFactor{
+		SegundoFactor: models.SegundoFactor{IdUsuario: u.IdUsuario, Usuario: u.Usuario, Secreto: Secreto, Estado: "P"},
+	}
+	return "OK", u.Usuario, nil
+}
+
+// tsp_activar_segundo_factor
+func (r *SegundoFactor) Activar(ctx context.Context, Paso int64, CodigosRecuperacion []string) (string, error) {
+	credencial, _ := auth.CredencialDesdeCtx(ctx)
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	u := r.b.usuarioPorToken(credencial, "A")
+	if u == nil {
+		return "La sesión expiró. Vuelva a iniciar sesión.", nil
+	}
+	sf, ok := r.b.factores[u.IdUsuario]
+	switch {
+	case !ok:
+		return "No hay una inscripción pendiente del segundo factor.", nil
+	case sf.Estado == "A":
+		return "El segundo factor ya está activo.", nil
+	case Paso <= sf.UltimoPaso:
+		return "El código es inválido.", nil
+	case len(CodigosRecuperacion) == 0:
+		return "Los códigos de recuperación son obligatorios.", nil
+	}
+	sf.Estado = "A"
+	sf.UltimoPaso = Paso
+	sf.codigos = slices.Clone(CodigosRecuperacion)
+	return "OK", nil
+}
+
+// tsp_completar_login_usuario
+func (r *SegundoFactor) CompletarLogin(ctx context.Context, TokenDesafio string, Paso int64, CodigoRecuperacion string, CodigosRecuperacion []string,
+	u *models.Usuarios, s *models.Sesiones, Politica repositorios.PoliticaSesion) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	d := r.b.desafioPorToken(TokenDesafio)
+	if d == nil {
+		*u = models.Usuarios{}
+		return "El desafío expiró. Vuelva a iniciar sesión.", nil
+	}
+	sf, ok := r.b.factores[d.idUsuario]
+	if d.tipo == "I" && (!ok || sf.Estado != "P") {
+		*u = models.Usuarios{}
+		return "Debe inscribir el segundo factor antes de verificar el código.", nil
+	}
+	if d.tipo == "I" && len(CodigosRecuperacion) == 0 {
+		*u = models.Usuarios{}
+		return "Los códigos de recuperación son obligatorios.", nil
+	}
+
+	valido := false
+	switch {
+	case Paso > 0 && ok && Paso > sf.UltimoPaso && (d.tipo == "I" || sf.Estado == "A"):
+		sf.UltimoPaso = Paso
+		valido = true
+	case CodigoRecuperacion != "" && ok && d.tipo == "V":
+		if i := slices.Index(sf.codigos, CodigoRecuperacion); i >= 0 {
+			sf.codigos = slices.Delete(sf.codigos, i, i+1)
+			valido = true
+		}
+	}
+	if !valido {
+		*u = models.Usuarios{}
+		d.intentos++
+		if d.intentos >= 5 {
+			delete(r.b.desafios, d.idDesafio)
+			return "Demasiados códigos inválidos. Vuelva a iniciar sesión.", nil
+		}
+		return "El código es inválido.", nil
+	}
+	if d.tipo == "I" {
+		sf.Estado = "A"
+		sf.codigos = slices.Clone(CodigosRecuperacion)
+	}
+	delete(r.b.desafios, d.idDesafio)
+	r.b.crearSesion(d.idUsuario, s, Politica)
+	*u = r.b.usuarios[d.idUsuario].Usuarios
+	u.SegundoFactor = r.b.segundoFactorActivo(d.idUsuario)
+	u.TokenSesion = s.TokenSesion
+	return "OK", nil
+}
+
+// tsp_restablecer_segundo_factor_usuario
+func (r *SegundoFactor) Restablecer(ctx context.Context, IdUsuario int) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := (&Usuarios{b: r.b}).resolverAdministrador(ctx, IdUsuario)
+	if mensaje != "OK" {
+		return mensaje, nil
+	}
+	if _, ok := r.b.usuarios[IdUsuario]; !ok {
+		return "El usuario no existe.", nil
+	}
+	if _, ok := r.b.factores[IdUsuario]; !ok {
+		return "El usuario no tiene segundo factor.", nil
+	}
+	delete(r.b.factores, IdUsuario)
+	for id, d := range r.b.desafios {
+		if d.idUsuario == IdUsuario {
+			delete(r.b.desafios, id)
+		}
+	}
+	sesiones := r.b.borrarSesiones(IdUsuario)
+	if err := r.b.auditar(actor, "RF", map[string]any{"IdUsuario": IdUsuario, "Sesiones": sesiones}); err != nil {
+		return "", err
+	}
+	return "OK", nil
+}
+
+// Usuario del desafío de login vigente TokenDesafio o, si es "", del token de sesión del contexto (activo).
+// Debe llamarse con el lock tomado.
+func (r *SegundoFactor) resolverUsuario(ctx context.Context, TokenDesafio string) (*usuario, *desafio, string) {
+	if TokenDesafio != "" {
+		d := r.b.desafioPorToken(TokenDesafio)
+		if d == nil {
+			return nil, nil, "El desafío expiró. Vuelva a iniciar sesión."
+		}
+		return r.b.usuarios[d.idUsuario], d, "OK"
+	}
+	credencial, _ := auth.CredencialDesdeCtx(ctx)
+	u := r.b.usuarioPorToken(credencial, "A")
+	if u == nil {
+		return nil, nil, "La sesión expiró. Vuelva a iniciar sesión."
+	}
+	return u, nil, "OK"
+}
+
+// Desafío de login vigente del token, de un usuario activo. Debe llamarse con el lock tomado.
+func (b *BaseDatos) desafioPorToken(token string) *desafio {
+	hash := utils.HashToken(token)
+	for _, d := range b.desafios {
+		if d.tokenHash == hash && d.fechaExpiracion.After(b.ahora()) && b.usuarios[d.idUsuario].Estado == "A" {
+			return d
+		}
+	}
+	return nil
+}
+
+// Crea el desafío de login del token para el usuario, como tsp_login_usuario: borra sus desafíos vencidos.
+// Debe llamarse con el lock tomado.
+func (b *BaseDatos) crearDesafio(IdUsuario int, Tipo string, d *models.DesafiosLogin) {
+	for id, guardado := range b.desafios {
+		if guardado.idUsuario == IdUsuario && !guardado.fechaExpiracion.After(b.ahora()) {
+			delete(b.desafios, id)
+		}
+	}
+	b.ultimoId.desafio++
+	nuevo := &desafio{
+		idDesafio:       b.ultimoId.desafio,
+		idUsuario:       IdUsuario,
+		tokenHash:       utils.HashToken(d.TokenDesafio),
+		tipo:            Tipo,
+		fechaExpiracion: b.ahora().Add(5 * time.Minute),
+	}
+	b.desafios[nuevo.idDesafio] = nuevo
+	d.Inscripcion = Tipo == "I"
+	d.FechaExpiracion = nuevo.fechaExpiracion
+}
+
+// S si el usuario tiene el segundo factor activo, N si no. Debe llamarse con el lock tomado.
+func (b *BaseDatos) segundoFactorActivo(IdUsuario int) string {
+	if sf, ok := b.factores[IdUsuario]; ok && sf.Estado == "A" {
+		return "S"
+	}
+	return "N"
+}
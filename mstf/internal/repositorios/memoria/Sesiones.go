@@ -0,0 +1,113 @@
+package memoria
+
+import (
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/utils"
+	"context"
+	"sort"
+	"time"
+)
+
+type Sesiones struct {
+	b *BaseDatos
+}
+
+// tsp_renovar_sesion
+func (r *Sesiones) Renovar(ctx context.Context, RefreshToken string, s *models.Sesiones, MinutosToken int) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	hash := utils.HashToken(RefreshToken)
+	var encontrada *sesion
+	for _, guardada := range r.b.sesiones {
+		if guardada.refreshHash == hash && r.b.sesionVigente(guardada) {
+			if u := r.b.usuarios[guardada.IdUsuario]; u.Estado == "A" || u.Estado == "P" {
+				encontrada = guardada
+			}
+			break
+		}
+	}
+	if encontrada == nil {
+		return "La sesión expiró. Vuelva a iniciar sesión.", nil
+	}
+	ahora := r.b.ahora()
+	encontrada.tokenHash = utils.HashToken(s.TokenSesion)
+	encontrada.refreshHash = utils.HashToken(s.RefreshToken)
+	encontrada.FechaUltimoUso = ahora
+	encontrada.FechaExpiracionToken = ahora.Add(time.Duration(MinutosToken) * time.Minute)
+	if encontrada.FechaExpiracionToken.After(encontrada.FechaExpiracion) {
+		encontrada.FechaExpiracionToken = encontrada.FechaExpiracion
+	}
+	s.IdSesion = encontrada.IdSesion
+	s.IdUsuario = encontrada.IdUsuario
+	s.FechaInicio = encontrada.FechaInicio
+	s.FechaExpiracionToken = encontrada.FechaExpiracionToken
+	s.FechaExpiracion = encontrada.FechaExpiracion
+	return "OK", nil
+}
+
+// tsp_buscar_sesiones
+func (r *Sesiones) Listar(ctx context.Context) ([]models.Sesiones, error) {
+	credencial, _ := auth.CredencialDesdeCtx(ctx)
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	sesiones := make([]models.Sesiones, 0)
+	u := r.b.usuarioPorToken(credencial, "A")
+	if u == nil {
+		return sesiones, nil
+	}
+	hash := utils.HashToken(credencial)
+	for _, s := range r.b.sesiones {
+		if s.IdUsuario != u.IdUsuario || !r.b.sesionVigente(s) {
+			continue
+		}
+		copia := s.Sesiones
+		copia.Actual = s.tokenHash == hash
+		sesiones = append(sesiones, copia)
+	}
+	sort.Slice(sesiones, func(i, j int) bool {
+		if !sesiones[i].FechaUltimoUso.Equal(sesiones[j].FechaUltimoUso) {
+			return sesiones[i].FechaUltimoUso.After(sesiones[j].FechaUltimoUso)
+		}
+		return sesiones[i].IdSesion > sesiones[j].IdSesion
+	})
+	return sesiones, nil
+}
+
+// tsp_revocar_sesion
+func (r *Sesiones) Revocar(ctx context.Context, IdSesion int) (string, error) {
+	credencial, _ := auth.CredencialDesdeCtx(ctx)
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	u := r.b.usuarioPorToken(credencial, "A")
+	if u == nil {
+		return "La sesión expiró. Vuelva a iniciar sesión.", nil
+	}
+	s, ok := r.b.sesiones[IdSesion]
+	if !ok || s.IdUsuario != u.IdUsuario {
+		return "La sesión no existe.", nil
+	}
+	delete(r.b.sesiones, IdSesion)
+	return "OK", nil
+}
+
+// tsp_revocar_sesiones_usuario
+func (r *Sesiones) RevocarUsuario(ctx context.Context, IdUsuario int) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := r.b.resolverActor(ctx)
+	if mensaje != "OK" {
+		return mensaje, nil
+	}
+	if actor != nil && !r.b.tienePermiso(actor, auth.PermisoUsuariosAdmin) {
+		return "No tienes permisos para realizar esta acción.", nil
+	}
+	if _, ok := r.b.usuarios[IdUsuario]; !ok {
+		return "El usuario no existe.", nil
+	}
+	borradas := r.b.borrarSesiones(IdUsuario)
+	if err := r.b.auditar(actor, "RS", map[string]any{"IdUsuario": IdUsuario, "Sesiones": borradas}); err != nil {
+		return "", err
+	}
+	return "OK", nil
+}
@@ -0,0 +1,413 @@
+package memoria
+
+import (
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Usuarios struct {
+	b *BaseDatos
+}
+
+// tsp_dame_usuario
+func (r *Usuarios) Dame(ctx context.Context, u *models.Usuarios) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	guardado, ok := r.b.usuarios[u.IdUsuario]
+	if !ok {
+		return "El usuario no existe.", nil
+	}
+	*u = guardado.Usuarios
+	u.SegundoFactor = r.b.segundoFactorActivo(u.IdUsuario)
+	return "OK", nil
+}
+
+// tsp_buscar_usuarios
+func (r *Usuarios) Buscar(ctx context.Context, Cadena string, IncluyeInactivos string) ([]*models.Usuarios, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	usuarios := make([]*models.Usuarios, 0)
+	for _, u := range r.b.usuarios {
+		if !strings.Contains(u.Usuario, strings.TrimSpace(Cadena)) {
+			continue
+		}
+		if IncluyeInactivos != "S" && !(IncluyeInactivos == "N" && u.Estado == "A") {
+			continue
+		}
+		copia := u.Usuarios
+		copia.SegundoFactor = r.b.segundoFactorActivo(u.IdUsuario)
+		usuarios = append(usuarios, &copia)
+	}
+	sort.Slice(usuarios, func(i, j int) bool { return usuarios[i].Usuario < usuarios[j].Usuario })
+	return usuarios, nil
+}
+
+// tsp_crear_usuario
+func (r *Usuarios) Crear(ctx context.Context, Usuario string, Password string) (string, int, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := r.b.resolverActor(ctx)
+	if mensaje != "OK" {
+		return mensaje, 0, nil
+	}
+	if actor != nil && !r.b.tienePermiso(actor, auth.PermisoUsuariosAdmin) {
+		return "No tienes permisos para realizar esta acción.", 0, nil
+	}
+	if Usuario == "" {
+		return "El nombre de usuario es obligatorio.", 0, nil
+	}
+	if Password == "" {
+		return "La contraseña es obligatoria.", 0, nil
+	}
+	for _, u := range r.b.usuarios {
+		if u.Usuario == Usuario {
+			return "El nombre de usuario ya existe.", 0, nil
+		}
+	}
+	r.b.ultimoId.usuario++
+	nuevo := &usuario{
+		Usuarios: models.Usuarios{
+			IdUsuario: r.b.ultimoId.usuario,
+			Usuario:   Usuario,
+			FechaAlta: r.b.ahora().Format(time.RFC3339),
+			Estado:    "P",
+			Rol:       "O",
+		},
+		password: Password,
+	}
+	r.b.usuarios[nuevo.IdUsuario] = nuevo
+	if err := r.b.auditar(actor, "CU", map[string]any{"IdUsuario": nuevo.IdUsuario, "Usuario": Usuario}); err != nil {
+		return "", 0, err
+	}
+	return "OK", nuevo.IdUsuario, nil
+}
+
+// tsp_activar_usuario
+func (r *Usuarios) Activar(ctx context.Context, IdUsuario int) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := r.resolverAdministrador(ctx, IdUsuario)
+	if mensaje != "OK" {
+		return mensaje, nil
+	}
+	u, ok := r.b.usuarios[IdUsuario]
+	if !ok {
+		return "El usuario no existe.", nil
+	}
+	switch u.Estado {
+	case "A":
+		return "El usuario ya está activo.", nil
+	case "P":
+		return "El usuario está pendiente y debe confirmar su cuenta.", nil
+	}
+	u.Estado = "A"
+	if err := r.b.auditar(actor, "AU", map[string]any{"IdUsuario": IdUsuario}); err != nil {
+		return "", err
+	}
+	return "OK", nil
+}
+
+// tsp_desactivar_usuario
+func (r *Usuarios) Desactivar(ctx context.Context, IdUsuario int) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := r.resolverAdministrador(ctx, IdUsuario)
+	if mensaje != "OK" {
+		return mensaje, nil
+	}
+	u, ok := r.b.usuarios[IdUsuario]
+	if !ok {
+		return "El usuario no existe.", nil
+	}
+	if u.Estado == "I" {
+		return "El usuario ya está inactivo.", nil
+	}
+	u.Estado = "I"
+	r.b.borrarSesiones(IdUsuario)
+	if err := r.b.auditar(actor, "DU", map[string]any{"IdUsuario": IdUsuario}); err != nil {
+		return "", err
+	}
+	return "OK", nil
+}
+
+// tsp_borrar_usuario
+func (r *Usuarios) Borrar(ctx context.Context, IdUsuario int) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := r.b.resolverActor(ctx)
+	if mensaje != "OK" {
+		return mensaje, nil
+	}
+	if actor != nil && !r.b.tienePermiso(actor, auth.PermisoUsuariosAdmin) {
+		return "No tienes permisos para realizar esta acción.", nil
+	}
+	u, ok := r.b.usuarios[IdUsuario]
+	if !ok {
+		return "El usuario no existe.", nil
+	}
+	if u.Estado == "A" {
+		return "No se puede borrar un usuario Activo.", nil
+	}
+	if actor != nil && actor.IdUsuario == IdUsuario {
+		return "No puedes realizar esta acción sobre tu propia cuenta.", nil
+	}
+	for _, op := range r.b.operaciones {
+		if op.IdUsuario != nil && *op.IdUsuario == IdUsuario {
+			return "No se puede eliminar el usuario porque tiene operaciones registradas en auditoría.", nil
+		}
+	}
+	if err := r.b.auditar(actor, "BU", map[string]any{"IdUsuario": IdUsuario, "Usuario": u.Usuario}); err != nil {
+		return "", err
+	}
+	delete(r.b.usuarios, IdUsuario)
+	r.b.borrarSesiones(IdUsuario)
+	return "OK", nil
+}
+
+// tsp_dame_password_usuario
+func (r *Usuarios) DamePassword(ctx context.Context, Usuario string) (int, string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	for _, u := range r.b.usuarios {
+		if u.Usuario == Usuario {
+			return u.IdUsuario, u.password, nil
+		}
+	}
+	return 0, "", nil
+}
+
+// tsp_dame_password_usuario (por token de sesión)
+func (r *Usuarios) DamePasswordSesion(ctx context.Context) (int, string, error) {
+	credencial, _ := auth.CredencialDesdeCtx(ctx)
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	u := r.b.usuarioPorToken(credencial, "A")
+	if u == nil {
+		return 0, "", nil
+	}
+	return u.IdUsuario, u.password, nil
+}
+
+// tsp_migrar_password_usuario
+func (r *Usuarios) MigrarPassword(ctx context.Context, IdUsuario int, PasswordAnterior string, PasswordNuevo string) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	u, ok := r.b.usuarios[IdUsuario]
+	switch {
+	case !ok:
+		return "El usuario no existe.", nil
+	case PasswordNuevo == "":
+		return "La nueva contraseña es obligatoria.", nil
+	case u.password != PasswordAnterior:
+		return "La contraseña fue modificada.", nil
+	}
+	u.password = PasswordNuevo
+	return "OK", nil
+}
+
+// tsp_login_usuario
+func (r *Usuarios) Login(ctx context.Context, u *models.Usuarios, Password string, s *models.Sesiones, d *models.DesafiosLogin, Politica repositorios.PoliticaSesion) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	var encontrado *usuario
+	for _, guardado := range r.b.usuarios {
+		if guardado.Usuario == u.Usuario && guardado.password == Password {
+			encontrado = guardado
+			break
+		}
+	}
+	if encontrado == nil {
+		*u = models.Usuarios{}
+		return "Credenciales inválidas.", nil
+	}
+	if encontrado.Estado == "I" {
+		*u = models.Usuarios{}
+		return "El usuario está inactivo.", nil
+	}
+	*u = encontrado.Usuarios
+	u.SegundoFactor = r.b.segundoFactorActivo(u.IdUsuario)
+	if encontrado.Estado == "A" {
+		tipo := ""
+		if u.SegundoFactor == "S" {
+			tipo = "V"
+		} else if slices.Contains(Politica.RolesSegundoFactor, u.Rol) {
+			tipo = "I"
+		}
+		if tipo != "" {
+			if d.TokenDesafio == "" {
+				*u = models.Usuarios{}
+				return "El token del desafío es obligatorio.", nil
+			}
+			r.b.crearDesafio(u.IdUsuario, tipo, d)
+			s.TokenSesion, s.RefreshToken = "", ""
+			return "OK", nil
+		}
+	}
+	d.TokenDesafio = ""
+	r.b.crearSesion(encontrado.IdUsuario, s, Politica)
+	u.TokenSesion = s.TokenSesion
+	return "OK", nil
+}
+
+// tsp_logout_usuario
+func (r *Usuarios) Logout(ctx context.Context) (string, error) {
+	credencial, _ := auth.CredencialDesdeCtx(ctx)
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	if r.b.usuarioPorToken(credencial, "A") == nil {
+		return "La sesión no existe o ya fue cerrada.", nil
+	}
+	delete(r.b.sesiones, r.b.sesionPorToken(credencial).IdSesion)
+	return "OK", nil
+}
+
+// tsp_confirmar_cuenta_usuario
+func (r *Usuarios) ConfirmarCuenta(ctx context.Context, Password string) (string, error) {
+	credencial, _ := auth.CredencialDesdeCtx(ctx)
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	u := r.b.usuarioPorToken(credencial, "A", "P")
+	switch {
+	case u == nil:
+		return "La sesión expiró. Vuelva a iniciar sesión.", nil
+	case u.Estado != "P":
+		return "El usuario ya está activo. Use modificar contraseña.", nil
+	case Password == "":
+		return "La contraseña es obligatoria.", nil
+	}
+	u.password = Password
+	u.Estado = "A"
+	r.b.borrarSesiones(u.IdUsuario)
+	return "OK", nil
+}
+
+// tsp_modificar_password_usuario
+func (r *Usuarios) ModificarPassword(ctx context.Context, PasswordAnterior string, PasswordNuevo string) (string, error) {
+	credencial, _ := auth.CredencialDesdeCtx(ctx)
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	u := r.b.usuarioPorToken(credencial, "A")
+	switch {
+	case u == nil || u.password != PasswordAnterior:
+		return "La contraseña anterior es incorrecta.", nil
+	case PasswordNuevo == "":
+		return "La nueva contraseña es obligatoria.", nil
+	}
+	u.password = PasswordNuevo
+	r.b.borrarSesiones(u.IdUsuario)
+	return "OK", nil
+}
+
+// tsp_restablecer_password_usuario
+func (r *Usuarios) RestablecerPassword(ctx context.Context, IdUsuario int, Password string) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	actor, mensaje := r.b.resolverActor(ctx)
+	if mensaje != "OK" {
+		return mensaje, nil
+	}
+	if actor != nil && !r.b.tienePermiso(actor, auth.PermisoUsuariosAdmin) {
+		return "No tienes permisos para realizar esta acción.", nil
+	}
+	u, ok := r.b.usuarios[IdUsuario]
+	if !ok {
+		return "El usuario no existe.", nil
+	}
+	switch u.Estado {
+	case "P":
+		return "El usuario ya está en estado pendiente.", nil
+	case "I":
+		return "El usuario está inactivo.", nil
+	}
+	if Password == "" {
+		return "La contraseña es obligatoria.", nil
+	}
+	u.password = Password
+	u.Estado = "P"
+	r.b.borrarSesiones(IdUsuario)
+	return "OK", nil
+}
+
+// tsp_reservar_intento_login
+func (r *Usuarios) ReservarIntentoLogin(ctx context.Context, Usuario string, IP string, Politica repositorios.PoliticaBloqueoLogin) (string, int, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	if Usuario == "" {
+		return "El usuario es obligatorio.", 0, nil
+	}
+	ahora := r.b.ahora()
+	bl, ok := r.b.bloqueos[strings.ToLower(Usuario)]
+	if !ok {
+		bl = &bloqueoLogin{fechaUltimoFallo: ahora, ultimaIP: IP}
+		r.b.bloqueos[strings.ToLower(Usuario)] = bl
+	} else if !bl.fechaUltimoFallo.After(ahora.Add(-time.Duration(Politica.HorasVentana) * time.Hour)) {
+		bl.intentosFallidos, bl.bloqueos = 0, 0
+	}
+	if bl.bloqueadoHasta.After(ahora) {
+		return "OK", int(bl.bloqueadoHasta.Sub(ahora) / time.Second), nil
+	}
+	if bl.intentosFallidos >= Politica.IntentosMax {
+		return "OK", Politica.SegundosBloqueo, nil
+	}
+	bl.intentosFallidos++
+	bl.fechaUltimoFallo = ahora
+	bl.ultimaIP = IP
+	return "OK", 0, nil
+}
+
+// tsp_liberar_intento_login
+func (r *Usuarios) LiberarIntentoLogin(ctx context.Context, Usuario string) (string, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	if bl, ok := r.b.bloqueos[strings.ToLower(Usuario)]; ok {
+		bl.intentosFallidos = max(bl.intentosFallidos-1, 0)
+	}
+	return "OK", nil
+}
+
+// tsp_registrar_login_fallido
+func (r *Usuarios) RegistrarLoginFallido(ctx context.Context, Usuario string, Politica repositorios.PoliticaBloqueoLogin) (string, int, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	if Usuario == "" {
+		return "El usuario es obligatorio.", 0, nil
+	}
+	ahora := r.b.ahora()
+	bl, ok := r.b.bloqueos[strings.ToLower(Usuario)]
+	if !ok {
+		return "OK", 0, nil
+	}
+	segundos := 0
+	if bl.intentosFallidos >= Politica.IntentosMax {
+		segundos = min(Politica.SegundosBloqueo<<min(bl.bloqueos, 20), Politica.MinutosBloqueoMax*60)
+		bl.intentosFallidos = 0
+		bl.bloqueos++
+		bl.bloqueadoHasta = ahora.Add(time.Duration(segundos) * time.Second)
+	}
+	return "OK", segundos, nil
+}
+
+// Actor de las acciones de un administrador sobre otro usuario (activar, desactivar): sesión válida,
+// permiso usuarios:admin y que no sea su propia cuenta. Debe llamarse con el lock tomado.
+func (r *Usuarios) resolverAdministrador(ctx context.Context, IdUsuario int) (*usuario, string) {
+	actor, mensaje := r.b.resolverActor(ctx)
+	if mensaje != "OK" {
+		return nil, mensaje
+	}
+	if actor == nil {
+		return nil, "OK"
+	}
+	if !r.b.tienePermiso(actor, auth.PermisoUsuariosAdmin) {
+		return nil, "No tienes permisos para realizar esta acción."
+	}
+	if actor.IdUsuario == IdUsuario {
+		return nil, "No puedes realizar esta acción sobre tu propia cuenta."
+	}
+	return actor, "OK"
+}
@@ -0,0 +1,120 @@
+package sps
+
+import (
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+type ApiKeys struct {
+	db            *sql.DB
+	autenticacion *Autenticacion
+}
+
+// autenticacion: su caché de API keys se vacía al rotar o revocar, para que el cambio rija de inmediato en esta réplica
+func NewApiKeys(db *sql.DB, autenticacion *Autenticacion) *ApiKeys {
+	return &ApiKeys{db: db, autenticacion: autenticacion}
+}
+
+// Permite listar las API keys de los sistemas cliente.
+// tsp_listar_apikeys
+func (r *ApiKeys) Listar(ctx context.Context) ([]models.ApiKeys, error) {
+	rows, err := r.db.QueryContext(ctx, "CALL tsp_listar_apikeys()")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	apiKeys := make([]models.ApiKeys, 0)
+	for rows.Next() {
+		var k models.ApiKeys
+		var alcances, ips sql.NullString
+		var fechaExpiracion, fechaUltimoUso sql.NullTime
+		err = rows.Scan(&k.IdApiKey, &k.Nombre, &k.Sistema, &k.Prefijo, &alcances, &ips, &k.FechaAlta,
+			&fechaExpiracion, &fechaUltimoUso, &k.Estado)
+		if err != nil {
+			return nil, err
+		}
+		k.Alcances = separarPermisos(alcances)
+		k.IPsPermitidas = []string{}
+		if ips.Valid {
+			if err = json.Unmarshal([]byte(ips.String), &k.IPsPermitidas); err != nil {
+				return nil, err
+			}
+		}
+		if fechaExpiracion.Valid {
+			k.FechaExpiracion = &fechaExpiracion.Time
+		}
+		if fechaUltimoUso.Valid {
+			k.FechaUltimoUso = &fechaUltimoUso.Time
+		}
+		apiKeys = append(apiKeys, k)
+	}
+	return apiKeys, nil
+}
+
+// Permite crear una API key para un sistema cliente.
+// tsp_crear_apikey
+func (r *ApiKeys) Crear(ctx context.Context, k *models.ApiKeys) (string, error) {
+	alcances, err := json.Marshal(k.Alcances)
+	if err != nil {
+		return "", err
+	}
+	ips, err := json.Marshal(k.IPsPermitidas)
+	if err != nil {
+		return "", err
+	}
+	k.Prefijo = utils.PrefijoApiKey(k.ApiKey)
+	credencial, actor := auth.CredencialDesdeCtx(ctx)
+	rows, err := r.db.QueryContext(ctx, "CALL tsp_crear_apikey(?, ?, ?, ?, ?, ?, ?, ?, ?)", k.Nombre, k.Sistema,
+		utils.HashToken(k.ApiKey), k.Prefijo, string(alcances), string(ips), k.FechaExpiracion, credencial, actor)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var mensaje string
+	var id sql.NullInt64
+	if !rows.Next() {
+		return "", errors.New("Error: intente nuevamente o contacte al administrador")
+	}
+	if err = rows.Scan(&mensaje, &id); err != nil {
+		return "", err
+	}
+	k.IdApiKey = int(id.Int64)
+	return mensaje, nil
+}
+
+// Permite reemplazar una API key activa por una nueva.
+// tsp_rotar_apikey
+func (r *ApiKeys) Rotar(ctx context.Context, IdApiKey int, ApiKey string) (string, error) {
+	credencial, actor := auth.CredencialDesdeCtx(ctx)
+	var mensaje string
+	err := r.db.QueryRowContext(ctx, "CALL tsp_rotar_apikey(?, ?, ?, ?, ?)", IdApiKey, utils.HashToken(ApiKey),
+		utils.PrefijoApiKey(ApiKey), credencial, actor).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	if mensaje == "OK" {
+		r.autenticacion.olvidarApiKeys()
+	}
+	return mensaje, nil
+}
+
+// Permite revocar una API key.
+// tsp_revocar_apikey
+func (r *ApiKeys) Revocar(ctx context.Context, IdApiKey int) (string, error) {
+	credencial, actor := auth.CredencialDesdeCtx(ctx)
+	var mensaje string
+	err := r.db.QueryRowContext(ctx, "CALL tsp_revocar_apikey(?, ?, ?)", IdApiKey, credencial, actor).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	if mensaje == "OK" {
+		r.autenticacion.olvidarApiKeys()
+	}
+	return mensaje, nil
+}
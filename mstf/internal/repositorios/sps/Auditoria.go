@@ -0,0 +1,117 @@
+package sps
+
+import (
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+type Auditoria struct {
+	db *sql.DB
+}
+
+func NewAuditoria(db *sql.DB) *Auditoria {
+	return &Auditoria{db: db}
+}
+
+// Registra una operación realizada fuera de los SPs (los SPs administrativos auditan por su cuenta).
+// tsp_registrar_operacion
+// - TipoOperacion: código de 2 caracteres de la operación
+// - Detalles: objeto que se guarda como JSON
+func (r *Auditoria) Registrar(ctx context.Context, TipoOperacion string, Detalles map[string]any) (string, error) {
+	credencial, actor := auth.CredencialDesdeCtx(ctx)
+	detalles, err := json.Marshal(Detalles)
+	if err != nil {
+		return "", err
+	}
+	var mensaje string
+	err = r.db.QueryRowContext(ctx, "CALL tsp_registrar_operacion(?, ?, ?, ?)", credencial, actor, TipoOperacion, string(detalles)).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	return mensaje, nil
+}
+
+// Permite buscar las operaciones auditadas, de la más reciente a la más antigua.
+// tsp_buscar_operaciones
+func (r *Auditoria) Buscar(ctx context.Context, Filtro repositorios.FiltroOperaciones) ([]models.Operaciones, error) {
+	rows, err := r.db.QueryContext(ctx, "CALL tsp_buscar_operaciones(?, ?, ?, ?, ?, ?, ?)", Filtro.IdUsuario, Filtro.TipoOperacion,
+		nulo(Filtro.Entidad), nulo(Filtro.IdEntidad), fechaNula(Filtro.FechaInicio), fechaNula(Filtro.FechaFin), Filtro.Limite)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	operaciones := make([]models.Operaciones, 0)
+	for rows.Next() {
+		var o models.Operaciones
+		var idUsuario sql.NullInt64
+		var detalles []byte
+		err = rows.Scan(&o.IdOperacion, &idUsuario, &o.TipoOperacion, &o.FechaOperacion, &detalles, &o.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if idUsuario.Valid {
+			id := int(idUsuario.Int64)
+			o.IdUsuario = &id
+		}
+		o.Detalles = detalles
+		operaciones = append(operaciones, o)
+	}
+	return operaciones, nil
+}
+
+// Permite obtener la cabeza de la cadena de hashes de Operaciones.
+// tsp_dame_cabeza_operaciones
+func (r *Auditoria) DameCabeza(ctx context.Context) (int, string, error) {
+	var idOperacion int
+	var hash string
+	if err := r.db.QueryRowContext(ctx, "CALL tsp_dame_cabeza_operaciones()").Scan(&idOperacion, &hash); err != nil {
+		return 0, "", err
+	}
+	return idOperacion, hash, nil
+}
+
+// Permite recorrer la cadena de hashes de Operaciones. La fecha y los detalles llegan como texto, tal como los
+// encadena el trigger, para recalcular el mismo hash.
+// tsp_listar_cadena_operaciones
+func (r *Auditoria) ListarCadena(ctx context.Context, DesdeIdOperacion int, Limite int) ([]models.Operaciones, error) {
+	rows, err := r.db.QueryContext(ctx, "CALL tsp_listar_cadena_operaciones(?, ?)", DesdeIdOperacion, Limite)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	operaciones := make([]models.Operaciones, 0)
+	for rows.Next() {
+		var o models.Operaciones
+		var idUsuario sql.NullInt64
+		var fecha, detalles string
+		err = rows.Scan(&o.IdOperacion, &idUsuario, &o.TipoOperacion, &fecha, &detalles, &o.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if idUsuario.Valid {
+			id := int(idUsuario.Int64)
+			o.IdUsuario = &id
+		}
+		if o.FechaOperacion, err = time.ParseInLocation(time.DateTime, fecha, time.UTC); err != nil {
+			return nil, err
+		}
+		o.Detalles = json.RawMessage(detalles)
+		operaciones = append(operaciones, o)
+	}
+	return operaciones, rows.Err()
+}
+
+// NULL para las fechas sin informar (zero value)
+func fechaNula(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,139 @@
+package sps
+
+import (
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/infra/cache"
+	"MSTransaccionesFinancieras/internal/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Vigencia de una API key validada en el caché. La revocación, la rotación y los cambios del rol S lo vacían antes
+// (ver verificarVersionApiKeys)
+const ttlApiKeys = 10 * time.Second
+
+type Autenticacion struct {
+	db      *sql.DB
+	apiKeys *cache.Cache[apiKeyCacheada]
+	// generación del caché de API keys: aumenta cada vez que se vacía. Una validación que empezó antes de vaciarlo
+	// no guarda su resultado (la API key pudo revocarse después de que el SP la validara)
+	muApiKeys  sync.Mutex
+	generacion uint64
+	// última versión de las API keys leída de MySQL (VersionApiKeys)
+	version int64
+}
+
+// API key validada por tsp_autenticar_actor: permisos de sus alcances, IPs permitidas y vencimiento (cero: no vence)
+type apiKeyCacheada struct {
+	permisos        []string
+	ipsPermitidas   []string
+	fechaExpiracion time.Time
+}
+
+func NewAutenticacion(db *sql.DB) *Autenticacion {
+	return &Autenticacion{db: db, apiKeys: cache.NewCache[apiKeyCacheada](ttlApiKeys)}
+}
+
+// Valida las credenciales del actor (SISTEMA o USUARIO) y devuelve sus permisos.
+// Para SISTEMA: cachea la API key (por su SHA-256) con sus permisos durante ttlApiKeys para no ejecutar el SP en
+// cada request. Antes de usar el caché consulta la versión de las API keys, que la revocación, la rotación y los
+// cambios del rol S aumentan en MySQL: si cambió (en cualquier réplica) vacía el caché. Las IPs permitidas y el
+// vencimiento se verifican en cada request, aunque la API key esté en caché.
+// Para USUARIO: siempre consulta la DB
+// tsp_autenticar_actor
+func (r *Autenticacion) Autenticar(ctx context.Context, Credencial string, Actor string, IP string) (string, []string, error) {
+	clave := utils.HashToken(Credencial)
+	if Actor == "SISTEMA" {
+		if _, ok := r.apiKeys.Dame(clave); ok {
+			if err := r.verificarVersionApiKeys(ctx); err != nil {
+				return "", nil, err
+			}
+			// si la versión cambió el caché quedó vacío y la API key se valida en la DB
+			if k, ok := r.apiKeys.Dame(clave); ok {
+				return k.validar(IP)
+			}
+		}
+	}
+	generacion := r.generacionApiKeys()
+
+	// SegundosVigencia: lo que falta para el vencimiento de la API key según el reloj de MySQL (NULL: no vence)
+	var mensaje string
+	var permisos, ips sql.NullString
+	var segundosVigencia sql.NullInt64
+	err := r.db.QueryRowContext(ctx, "CALL tsp_autenticar_actor(?, ?)", Credencial, Actor).Scan(&mensaje, &permisos, &ips, &segundosVigencia)
+	if err != nil {
+		return "", nil, err
+	}
+	if mensaje != "OK" {
+		return mensaje, nil, nil
+	}
+	lista := separarPermisos(permisos)
+	if Actor == "SISTEMA" {
+		k := apiKeyCacheada{permisos: lista, ipsPermitidas: []string{}}
+		if segundosVigencia.Valid {
+			k.fechaExpiracion = time.Now().Add(time.Duration(segundosVigencia.Int64) * time.Second)
+		}
+		if ips.Valid {
+			if err := json.Unmarshal([]byte(ips.String), &k.ipsPermitidas); err != nil {
+				return "", nil, err
+			}
+		}
+		r.guardarApiKey(clave, k, generacion)
+		return k.validar(IP)
+	}
+	return mensaje, lista, nil
+}
+
+// Vacía el caché de API keys: la próxima request de cada sistema vuelve a validarse en la DB
+func (r *Autenticacion) olvidarApiKeys() {
+	r.muApiKeys.Lock()
+	defer r.muApiKeys.Unlock()
+	r.generacion++
+	r.apiKeys.Limpiar()
+}
+
+// Vacía el caché de API keys si la versión de las API keys en MySQL cambió desde la última consulta
+// tsp_dame_version_apikeys
+func (r *Autenticacion) verificarVersionApiKeys(ctx context.Context) error {
+	var version int64
+	if err := r.db.QueryRowContext(ctx, "CALL tsp_dame_version_apikeys()").Scan(&version); err != nil {
+		return err
+	}
+	r.muApiKeys.Lock()
+	defer r.muApiKeys.Unlock()
+	if version != r.version {
+		r.version = version
+		r.generacion++
+		r.apiKeys.Limpiar()
+	}
+	return nil
+}
+
+func (r *Autenticacion) generacionApiKeys() uint64 {
+	r.muApiKeys.Lock()
+	defer r.muApiKeys.Unlock()
+	return r.generacion
+}
+
+// Cachea la API key validada si el caché no se vació desde que empezó la validación (generacion)
+func (r *Autenticacion) guardarApiKey(clave string, k apiKeyCacheada, generacion uint64) {
+	r.muApiKeys.Lock()
+	defer r.muApiKeys.Unlock()
+	if r.generacion == generacion {
+		r.apiKeys.Guardar(clave, k)
+	}
+}
+
+// Verifica el vencimiento y la IP del cliente de una API key activa. Devuelve el resultado de Autenticar
+func (k apiKeyCacheada) validar(IP string) (string, []string, error) {
+	if !k.fechaExpiracion.IsZero() && !time.Now().Before(k.fechaExpiracion) {
+		return "La API key expiró.", nil, nil
+	}
+	if !auth.IPPermitida(IP, k.ipsPermitidas) {
+		return "La IP no está autorizada para usar la API key.", nil, nil
+	}
+	return "OK", k.permisos, nil
+}
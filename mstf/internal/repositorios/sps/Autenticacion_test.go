@@ -0,0 +1,230 @@
+package sps
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/infra/cache"
+)
+
+// Driver de database/sql que responde tsp_autenticar_actor con el resultado de responder. Cada llamada avisa
+// en consultando y espera a continuar antes de responder, para intercalar otras operaciones.
+// tsp_dame_version_apikeys responde sin pausa la versión, que aumenta revocar.
+type driverAutenticacion struct {
+	llamadas    atomic.Int32
+	consultando chan struct{}
+	continuar   chan struct{}
+	mu          sync.Mutex
+	mensaje     string
+	version     int64
+}
+
+func (d *driverAutenticacion) Open(string) (driver.Conn, error) { return conexionAutenticacion{d}, nil }
+
+type conexionAutenticacion struct{ d *driverAutenticacion }
+
+func (c conexionAutenticacion) Prepare(consulta string) (driver.Stmt, error) {
+	return sentenciaAutenticacion{d: c.d, version: strings.Contains(consulta, "tsp_dame_version_apikeys")}, nil
+}
+func (c conexionAutenticacion) Close() error              { return nil }
+func (c conexionAutenticacion) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+type sentenciaAutenticacion struct {
+	d       *driverAutenticacion
+	version bool
+}
+
+func (s sentenciaAutenticacion) Close() error  { return nil }
+func (s sentenciaAutenticacion) NumInput() int { return -1 }
+func (s sentenciaAutenticacion) Exec([]driver.Value) (driver.Result, error) {
+	return nil, driver.ErrSkip
+}
+
+func (s sentenciaAutenticacion) Query([]driver.Value) (driver.Rows, error) {
+	if s.version {
+		s.d.mu.Lock()
+		defer s.d.mu.Unlock()
+		return &filasVersion{version: s.d.version}, nil
+	}
+	s.d.llamadas.Add(1)
+	s.d.consultando <- struct{}{}
+	<-s.d.continuar
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return &filasAutenticacion{mensaje: s.d.mensaje}, nil
+}
+
+// Una fila de tsp_autenticar_actor: Mensaje, Permisos, IPsPermitidas, SegundosVigencia
+type filasAutenticacion struct {
+	mensaje string
+	leida   bool
+}
+
+func (f *filasAutenticacion) Columns() []string {
+	return []string{"Mensaje", "Permisos", "IPsPermitidas", "SegundosVigencia"}
+}
+func (f *filasAutenticacion) Close() error { return nil }
+func (f *filasAutenticacion) Next(dest []driver.Value) error {
+	if f.leida {
+		return io.EOF
+	}
+	f.leida = true
+	dest[0], dest[1], dest[2], dest[3] = f.mensaje, "transferencias:read", nil, nil
+	if f.mensaje != "OK" {
+		dest[1] = nil
+	}
+	return nil
+}
+
+// Una fila de tsp_dame_version_apikeys: Version
+type filasVersion struct {
+	version int64
+	leida   bool
+}
+
+func (f *filasVersion) Columns() []string { return []string{"Version"} }
+func (f *filasVersion) Close() error      { return nil }
+func (f *filasVersion) Next(dest []driver.Value) error {
+	if f.leida {
+		return io.EOF
+	}
+	f.leida = true
+	dest[0] = f.version
+	return nil
+}
+
+func (d *driverAutenticacion) responder(mensaje string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mensaje = mensaje
+}
+
+// Lo que hace tsp_revocar_apikey: la API key deja de validar y aumenta la versión de las API keys
+func (d *driverAutenticacion) revocar() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mensaje = "API Key inválida."
+	d.version++
+}
+
+var numeroDriver atomic.Int32
+
+func nuevaBDTest(t *testing.T) (*sql.DB, *driverAutenticacion) {
+	t.Helper()
+	d := &driverAutenticacion{consultando: make(chan struct{}), continuar: make(chan struct{}), mensaje: "OK"}
+	nombre := fmt.Sprintf("autenticacion-test-%d", numeroDriver.Add(1))
+	sql.Register(nombre, d)
+	db, err := sql.Open(nombre, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, d
+}
+
+func nuevaAutenticacionTest(t *testing.T) (*Autenticacion, *driverAutenticacion) {
+	t.Helper()
+	db, d := nuevaBDTest(t)
+	return NewAutenticacion(db), d
+}
+
+// Autentica la API key dejando que el SP responda sin intercalar nada
+func autenticarSinPausa(t *testing.T, r *Autenticacion, d *driverAutenticacion) string {
+	t.Helper()
+	resultado := make(chan string, 1)
+	go func() {
+		mensaje, _, err := r.Autenticar(context.Background(), "clave", "SISTEMA", "10.0.0.1")
+		if err != nil {
+			t.Error(err)
+		}
+		resultado <- mensaje
+	}()
+	select {
+	case <-d.consultando:
+		d.continuar <- struct{}{}
+	case m := <-resultado:
+		return m
+	}
+	return <-resultado
+}
+
+func TestAutenticarApiKeyCacheada(t *testing.T) {
+	r, d := nuevaAutenticacionTest(t)
+	for range 3 {
+		if m := autenticarSinPausa(t, r, d); m != "OK" {
+			t.Fatalf("Autenticar: %s", m)
+		}
+	}
+	if n := d.llamadas.Load(); n != 1 {
+		t.Fatalf("la API key se validó %d veces en la DB, se esperaba 1", n)
+	}
+
+	// vencido el caché se vuelve a validar en la DB
+	r.apiKeys = cache.NewCache[apiKeyCacheada](time.Millisecond)
+	autenticarSinPausa(t, r, d)
+	time.Sleep(5 * time.Millisecond)
+	d.responder("La API key fue revocada.")
+	if m := autenticarSinPausa(t, r, d); m != "La API key fue revocada." {
+		t.Fatalf("Autenticar tras vencer el caché: %s", m)
+	}
+}
+
+// Una revocación que confirma mientras el SP valida la API key no queda pisada por el resultado de esa validación
+func TestRevocarDuranteAutenticacion(t *testing.T) {
+	r, d := nuevaAutenticacionTest(t)
+
+	enCurso := make(chan string, 1)
+	go func() {
+		mensaje, _, err := r.Autenticar(context.Background(), "clave", "SISTEMA", "10.0.0.1")
+		if err != nil {
+			t.Error(err)
+		}
+		enCurso <- mensaje
+	}()
+	<-d.consultando
+	// el SP ya validó la API key: se revoca (lo que hace ApiKeys.Revocar tras tsp_revocar_apikey) antes de que responda
+	r.olvidarApiKeys()
+	d.continuar <- struct{}{}
+	if m := <-enCurso; m != "OK" {
+		t.Fatalf("la autenticación en curso: %s", m)
+	}
+
+	d.responder("La API key fue revocada.")
+	if m := autenticarSinPausa(t, r, d); m != "La API key fue revocada." {
+		t.Fatalf("Autenticar después de revocar: %s", m)
+	}
+	if n := d.llamadas.Load(); n != 2 {
+		t.Fatalf("la API key se validó %d veces en la DB, se esperaba 2", n)
+	}
+}
+
+// Una API key revocada en una réplica deja de autenticar en otra que la tenía en caché
+func TestRevocarEnOtraReplica(t *testing.T) {
+	db, d := nuevaBDTest(t)
+	replica1, replica2 := NewAutenticacion(db), NewAutenticacion(db)
+	for _, r := range []*Autenticacion{replica1, replica2, replica2} {
+		if m := autenticarSinPausa(t, r, d); m != "OK" {
+			t.Fatalf("Autenticar: %s", m)
+		}
+	}
+	if n := d.llamadas.Load(); n != 2 {
+		t.Fatalf("la API key se validó %d veces en la DB, se esperaba una por réplica", n)
+	}
+
+	// ApiKeys.Revocar en la réplica 1: tsp_revocar_apikey y vaciar su caché
+	d.revocar()
+	replica1.olvidarApiKeys()
+	for _, r := range []*Autenticacion{replica2, replica1} {
+		if m := autenticarSinPausa(t, r, d); m != "API Key inválida." {
+			t.Fatalf("Autenticar después de revocar: %s", m)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package sps
+
+import (
+	"MSTransaccionesFinancieras/internal/models"
+	"context"
+	"database/sql"
+)
+
+type Cuarentena struct {
+	db *sql.DB
+}
+
+func NewCuarentena(db *sql.DB) *Cuarentena {
+	return &Cuarentena{db: db}
+}
+
+// Registra un mensaje aislado por el motor de ingesta.
+// tsp_crear_mensaje_cuarentena
+// - Mensaje.Origen: ubicación del mensaje en la fuente (ej: topic/partición/offset)
+// - Mensaje.Contenido: payload original del mensaje
+// - Mensaje.Error: último error obtenido al procesarlo
+func (r *Cuarentena) Crear(ctx context.Context, Mensaje models.MensajesCuarentena) (string, error) {
+	var mensaje string
+	err := r.db.QueryRowContext(ctx, "CALL tsp_crear_mensaje_cuarentena(?, ?, ?, ?)", Mensaje.Origen, Mensaje.IdTransferencia, Mensaje.Contenido, Mensaje.Error).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	return mensaje, nil
+}
+
+// Permite buscar los mensajes en cuarentena, del más reciente al más antiguo.
+// tsp_buscar_mensajes_cuarentena
+// - IdTransferencia: filtra por IdTransferencia ("" = todos)
+// - Limite: cantidad máxima de mensajes a devolver
+func (r *Cuarentena) Buscar(ctx context.Context, IdTransferencia string, Limite int) ([]models.MensajesCuarentena, error) {
+	rows, err := r.db.QueryContext(ctx, "CALL tsp_buscar_mensajes_cuarentena(?, ?)", IdTransferencia, Limite)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mensajes := make([]models.MensajesCuarentena, 0)
+	for rows.Next() {
+		var m models.MensajesCuarentena
+		err = rows.Scan(&m.IdMensaje, &m.Origen, &m.IdTransferencia, &m.Contenido, &m.Error, &m.FechaAlta)
+		if err != nil {
+			return nil, err
+		}
+		mensajes = append(mensajes, m)
+	}
+	return mensajes, rows.Err()
+}
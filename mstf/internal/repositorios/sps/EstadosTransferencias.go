@@ -0,0 +1,56 @@
+package sps
+
+import (
+	"MSTransaccionesFinancieras/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+type EstadosTransferencias struct {
+	db *sql.DB
+}
+
+func NewEstadosTransferencias(db *sql.DB) *EstadosTransferencias {
+	return &EstadosTransferencias{db: db}
+}
+
+// Registra el resultado notificado de un lote de transferencias.
+// tsp_registrar_estados_transferencias
+// - Notificaciones: resultados tal como se enviaron en el webhook
+func (r *EstadosTransferencias) Registrar(ctx context.Context, Notificaciones []models.TransferenciaNotificada) (string, error) {
+	estados, err := json.Marshal(Notificaciones)
+	if err != nil {
+		return "", err
+	}
+	var mensaje string
+	err = r.db.QueryRowContext(ctx, "CALL tsp_registrar_estados_transferencias(?)", string(estados)).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	return mensaje, nil
+}
+
+// Permite buscar el último resultado registrado de las transferencias, del más reciente al más antiguo.
+// tsp_buscar_estados_transferencias
+// - IdTransferencia: filtra por IdTransferencia ("" = todas)
+// - IdCorrelacion: filtra por IdCorrelacion ("" = todas)
+// - Limite: cantidad máxima de estados a devolver
+func (r *EstadosTransferencias) Buscar(ctx context.Context, IdTransferencia string, IdCorrelacion string, Limite int) ([]models.EstadosTransferencias, error) {
+	rows, err := r.db.QueryContext(ctx, "CALL tsp_buscar_estados_transferencias(?, ?, ?)", IdTransferencia, IdCorrelacion, Limite)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	estados := make([]models.EstadosTransferencias, 0)
+	for rows.Next() {
+		var e models.EstadosTransferencias
+		err = rows.Scan(&e.IdTransferencia, &e.IdCorrelacion, &e.Estado, &e.Mensaje, &e.Tipo, &e.IdMoneda, &e.IdUsuarioFinal, &e.FechaAlta, &e.FechaModificacion)
+		if err != nil {
+			return nil, err
+		}
+		estados = append(estados, e)
+	}
+	return estados, rows.Err()
+}
@@ -0,0 +1,126 @@
+package sps
+
+import (
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/infra/cache"
+	"MSTransaccionesFinancieras/internal/models"
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+type Monedas struct {
+	db    *sql.DB
+	cache *cache.Cache[models.Monedas]
+}
+
+func NewMonedas(db *sql.DB) *Monedas {
+	return &Monedas{db: db, cache: cache.NewCache[models.Monedas](30 * time.Minute)}
+}
+
+// Caché de Dame, para exponer sus métricas
+func (r *Monedas) Cache() *cache.Cache[models.Monedas] {
+	return r.cache
+}
+
+// Instancia los atributos de la moneda desde la base de datos.
+// tsp_dame_moneda
+func (r *Monedas) Dame(ctx context.Context, m *models.Monedas) (string, error) {
+	clave := strconv.Itoa(m.IdMoneda)
+	if cached, ok := r.cache.Dame(clave); ok {
+		*m = cached
+		return "OK", nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, "CALL tsp_dame_moneda(?)", m.IdMoneda)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var mensaje string
+	var idMoneda sql.NullInt32
+	var idCuentaEmpresa sql.NullString
+	var estado sql.NullString
+	var fechaAlta sql.NullTime
+	if rows.Next() {
+		err = rows.Scan(&mensaje, &idMoneda, &idCuentaEmpresa, &estado, &fechaAlta)
+		if err != nil {
+			return mensaje, err
+		}
+		m.IdMoneda = int(idMoneda.Int32)
+		m.IdCuentaEmpresa = idCuentaEmpresa.String
+		m.Estado = estado.String
+		m.FechaAlta = fechaAlta.Time
+		if mensaje == "OK" {
+			r.cache.Guardar(clave, *m)
+		}
+	}
+	return mensaje, nil
+}
+
+// Permite listar las monedas.
+// tsp_listar_monedas
+// - IncluyeInactivos: 'N' solo activas, 'S' activas e inactivas, 'T' todas
+func (r *Monedas) Listar(ctx context.Context, IncluyeInactivos string) ([]models.Monedas, error) {
+	rows, err := r.db.QueryContext(ctx, "CALL tsp_listar_monedas(?)", IncluyeInactivos)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	monedas := make([]models.Monedas, 0)
+	for rows.Next() {
+		var m models.Monedas
+		err = rows.Scan(&m.IdMoneda, &m.IdCuentaEmpresa, &m.Estado, &m.FechaAlta)
+		if err != nil {
+			return nil, err
+		}
+		monedas = append(monedas, m)
+	}
+	return monedas, nil
+}
+
+// Crea una moneda en estado P: Pendiente.
+// tsp_crear_moneda
+// - Moneda.IdMoneda: Id de la moneda a crear (viene de MisGastos)
+// - Moneda.IdCuentaEmpresa: Id de la cuenta empresa en TB asociada a esta moneda
+func (r *Monedas) Crear(ctx context.Context, Moneda models.Monedas) (string, error) {
+	credencial, actor := auth.CredencialDesdeCtx(ctx)
+	var mensaje string
+	err := r.db.QueryRowContext(ctx, "CALL tsp_crear_moneda(?, ?, ?, ?)", credencial, actor, Moneda.IdMoneda, Moneda.IdCuentaEmpresa).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	return mensaje, nil
+}
+
+// Activa una moneda, siempre y cuando esté en estado Pendiente o Inactiva ('P' | 'I').
+// tsp_activar_moneda
+func (r *Monedas) Activar(ctx context.Context, IdMoneda int) (string, error) {
+	return r.cambiarEstado(ctx, "CALL tsp_activar_moneda(?, ?, ?)", IdMoneda)
+}
+
+// Desactiva una moneda en estado Activo ('A').
+// tsp_desactivar_moneda
+func (r *Monedas) Desactivar(ctx context.Context, IdMoneda int) (string, error) {
+	return r.cambiarEstado(ctx, "CALL tsp_desactivar_moneda(?, ?, ?)", IdMoneda)
+}
+
+// Borra una moneda únicamente si está en estado Inactivo o Pendiente.
+// tsp_borrar_moneda
+func (r *Monedas) Borrar(ctx context.Context, IdMoneda int) (string, error) {
+	return r.cambiarEstado(ctx, "CALL tsp_borrar_moneda(?, ?, ?)", IdMoneda)
+}
+
+// Llama a un SP (credencial, actor, IdMoneda) que modifica la moneda e invalida su entrada en el caché
+func (r *Monedas) cambiarEstado(ctx context.Context, sp string, IdMoneda int) (string, error) {
+	credencial, actor := auth.CredencialDesdeCtx(ctx)
+	var mensaje string
+	err := r.db.QueryRowContext(ctx, sp, credencial, actor, IdMoneda).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	r.cache.Borrar(strconv.Itoa(IdMoneda))
+	return mensaje, nil
+}
@@ -0,0 +1,94 @@
+package sps
+
+import (
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/infra/cache"
+	"MSTransaccionesFinancieras/internal/models"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type Parametros struct {
+	db    *sql.DB
+	cache *cache.Cache[models.Parametros]
+}
+
+func NewParametros(db *sql.DB) *Parametros {
+	return &Parametros{db: db, cache: cache.NewCache[models.Parametros](5 * time.Minute)}
+}
+
+// Caché de Dame, para exponer sus métricas
+func (r *Parametros) Cache() *cache.Cache[models.Parametros] {
+	return r.cache
+}
+
+// Instancia un parámetro específico por su clave.
+// tsp_dame_parametro
+func (r *Parametros) Dame(ctx context.Context, p *models.Parametros) (string, error) {
+	if cached, ok := r.cache.Dame(p.Parametro); ok {
+		*p = cached
+		return "OK", nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, "CALL tsp_dame_parametro(?)", p.Parametro)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var mensaje string
+	var param sql.NullString
+	var valor sql.NullString
+	var descripcion sql.NullString
+	var esModificable sql.NullString
+	if rows.Next() {
+		err = rows.Scan(&mensaje, &param, &valor, &descripcion, &esModificable)
+		if err != nil {
+			return mensaje, err
+		}
+		p.Parametro = param.String
+		p.Valor = valor.String
+		p.Descripcion = descripcion.String
+		p.EsModificable = esModificable.String
+		if mensaje == "OK" {
+			r.cache.Guardar(p.Parametro, *p)
+		}
+	}
+	return mensaje, nil
+}
+
+// Permite buscar los parámetros del sistema según su nombre, ordenados por nombre.
+// tsp_buscar_parametros
+// - Cadena: texto a buscar dentro del nombre del parámetro (vacío lista todos)
+// - SoloModificables: 'S' para listar solo los modificables desde el sitio administrativo
+func (r *Parametros) Buscar(ctx context.Context, Cadena string, SoloModificables string) ([]models.Parametros, error) {
+	rows, err := r.db.QueryContext(ctx, "CALL tsp_buscar_parametros(?, ?)", Cadena, SoloModificables)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var parametros []models.Parametros
+	for rows.Next() {
+		var p models.Parametros
+		err = rows.Scan(&p.Parametro, &p.Valor, &p.Descripcion, &p.EsModificable)
+		if err != nil {
+			return nil, err
+		}
+		parametros = append(parametros, p)
+	}
+	return parametros, nil
+}
+
+// Permite modificar el valor de un parámetro siempre y cuando exista y sea modificable.
+// tsp_modificar_parametro
+func (r *Parametros) Modificar(ctx context.Context, Parametro string, Valor string) (string, error) {
+	credencial, actor := auth.CredencialDesdeCtx(ctx)
+	var mensaje string
+	err := r.db.QueryRowContext(ctx, "CALL tsp_modificar_parametro(?, ?, ?, ?)", credencial, actor, Parametro, Valor).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	r.cache.Borrar(Parametro)
+	return mensaje, nil
+}
@@ -0,0 +1,144 @@
+package sps
+
+import (
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+type Roles struct {
+	db *sql.DB
+}
+
+func NewRoles(db *sql.DB) *Roles {
+	return &Roles{db: db}
+}
+
+// Instancia un rol con sus permisos.
+// tsp_dame_rol
+func (r *Roles) Dame(ctx context.Context, rol *models.Roles) (string, error) {
+	rows, err := r.db.QueryContext(ctx, "CALL tsp_dame_rol(?)", rol.Rol)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var mensaje string
+	var codigo, nombre, permisos sql.NullString
+	if !rows.Next() {
+		return "", errors.New("Error: intente nuevamente o contacte al administrador")
+	}
+	if err = rows.Scan(&mensaje, &codigo, &nombre, &permisos); err != nil {
+		return "", err
+	}
+	if mensaje == "OK" {
+		rol.Rol = codigo.String
+		rol.Nombre = nombre.String
+		rol.Permisos = separarPermisos(permisos)
+	}
+	return mensaje, nil
+}
+
+// Permite listar los roles con sus permisos.
+// tsp_listar_roles
+func (r *Roles) Listar(ctx context.Context) ([]models.Roles, error) {
+	rows, err := r.db.QueryContext(ctx, "CALL tsp_listar_roles()")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := make([]models.Roles, 0)
+	for rows.Next() {
+		var rol models.Roles
+		var permisos sql.NullString
+		if err = rows.Scan(&rol.Rol, &rol.Nombre, &permisos, &rol.Usuarios); err != nil {
+			return nil, err
+		}
+		rol.Permisos = separarPermisos(permisos)
+		roles = append(roles, rol)
+	}
+	return roles, nil
+}
+
+// Permite listar el catálogo de permisos.
+// tsp_listar_permisos
+func (r *Roles) ListarPermisos(ctx context.Context) ([]models.Permisos, error) {
+	rows, err := r.db.QueryContext(ctx, "CALL tsp_listar_permisos()")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permisos := make([]models.Permisos, 0)
+	for rows.Next() {
+		var p models.Permisos
+		if err = rows.Scan(&p.Permiso, &p.Descripcion); err != nil {
+			return nil, err
+		}
+		permisos = append(permisos, p)
+	}
+	return permisos, nil
+}
+
+// Permite crear un rol con sus permisos.
+// tsp_crear_rol
+func (r *Roles) Crear(ctx context.Context, Rol models.Roles) (string, error) {
+	return r.guardar(ctx, "CALL tsp_crear_rol(?, ?, ?, ?, ?)", Rol)
+}
+
+// Permite modificar el nombre y los permisos de un rol.
+// tsp_modificar_rol
+func (r *Roles) Modificar(ctx context.Context, Rol models.Roles) (string, error) {
+	return r.guardar(ctx, "CALL tsp_modificar_rol(?, ?, ?, ?, ?)", Rol)
+}
+
+// Llama a un SP (rol, nombre, permisos JSON, credencial, actor) que devuelve solo el mensaje
+func (r *Roles) guardar(ctx context.Context, sp string, Rol models.Roles) (string, error) {
+	permisos, err := json.Marshal(Rol.Permisos)
+	if err != nil {
+		return "", err
+	}
+	credencial, actor := auth.CredencialDesdeCtx(ctx)
+	var mensaje string
+	err = r.db.QueryRowContext(ctx, sp, Rol.Rol, Rol.Nombre, string(permisos), credencial, actor).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	return mensaje, nil
+}
+
+// Permite borrar un rol sin usuarios.
+// tsp_borrar_rol
+func (r *Roles) Borrar(ctx context.Context, Rol string) (string, error) {
+	credencial, actor := auth.CredencialDesdeCtx(ctx)
+	var mensaje string
+	err := r.db.QueryRowContext(ctx, "CALL tsp_borrar_rol(?, ?, ?)", Rol, credencial, actor).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	return mensaje, nil
+}
+
+// Permite asignar un rol a un usuario.
+// tsp_asignar_rol_usuario
+func (r *Roles) AsignarUsuario(ctx context.Context, IdUsuario int, Rol string) (string, error) {
+	credencial, actor := auth.CredencialDesdeCtx(ctx)
+	var mensaje string
+	err := r.db.QueryRowContext(ctx, "CALL tsp_asignar_rol_usuario(?, ?, ?, ?)", IdUsuario, Rol, credencial, actor).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	return mensaje, nil
+}
+
+// Permisos separados por coma (GROUP_CONCAT); NULL si el rol no tiene permisos
+func separarPermisos(permisos sql.NullString) []string {
+	if !permisos.Valid || permisos.String == "" {
+		return []string{}
+	}
+	return strings.Split(permisos.String, ",")
+}
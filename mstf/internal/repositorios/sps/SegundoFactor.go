@@ -0,0 +1,110 @@
+package sps
+
+import (
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+type SegundoFactor struct {
+	db *sql.DB
+}
+
+func NewSegundoFactor(db *sql.DB) *SegundoFactor {
+	return &SegundoFactor{db: db}
+}
+
+// Instancia el segundo factor del usuario del desafío de login o de la sesión, para verificar el código en el MS.
+// tsp_dame_segundo_factor
+func (r *SegundoFactor) Dame(ctx context.Context, TokenDesafio string, f *models.SegundoFactor) (string, error) {
+	credencial, _ := auth.CredencialDesdeCtx(ctx)
+	var mensaje string
+	var usuario, secreto, estado sql.NullString
+	err := r.db.QueryRowContext(ctx, "CALL tsp_dame_segundo_factor(?, ?)", nulo(credencial), nulo(TokenDesafio)).
+		Scan(&mensaje, &f.IdUsuario, &usuario, &secreto, &estado, &f.UltimoPaso)
+	if err != nil {
+		return "", err
+	}
+	f.Usuario = usuario.String
+	f.Secreto = secreto.String
+	f.Estado = estado.String
+	return mensaje, nil
+}
+
+// Permite inscribir el segundo factor desde la sesión o desde un desafío de login de inscripción.
+// tsp_inscribir_segundo_factor
+// - Secreto: secreto TOTP generado por el MS
+func (r *SegundoFactor) Inscribir(ctx context.Context, TokenDesafio string, Secreto string) (string, string, error) {
+	credencial, _ := auth.CredencialDesdeCtx(ctx)
+	var mensaje string
+	var usuario sql.NullString
+	err := r.db.QueryRowContext(ctx, "CALL tsp_inscribir_segundo_factor(?, ?, ?)", nulo(credencial), nulo(TokenDesafio), Secreto).
+		Scan(&mensaje, &usuario)
+	if err != nil {
+		return "", "", err
+	}
+	return mensaje, usuario.String, nil
+}
+
+// Permite al usuario de la sesión activar su segundo factor pendiente.
+// tsp_activar_segundo_factor
+// - Paso: paso del código TOTP verificado por el MS
+// - CodigosRecuperacion: SHA-256 de los códigos de recuperación generados por el MS
+func (r *SegundoFactor) Activar(ctx context.Context, Paso int64, CodigosRecuperacion []string) (string, error) {
+	credencial, _ := auth.CredencialDesdeCtx(ctx)
+	codigos, err := json.Marshal(CodigosRecuperacion)
+	if err != nil {
+		return "", err
+	}
+	var mensaje string
+	err = r.db.QueryRowContext(ctx, "CALL tsp_activar_segundo_factor(?, ?, ?)", credencial, Paso, string(codigos)).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	return mensaje, nil
+}
+
+// Completa el login de un desafío de segundo factor creando la sesión.
+// tsp_completar_login_usuario
+// - Paso: paso del código TOTP verificado por el MS (0 si no se verificó)
+// - CodigoRecuperacion: SHA-256 del código de recuperación informado ("" si no se informó)
+// - CodigosRecuperacion: SHA-256 de los códigos de recuperación nuevos (desafíos de inscripción)
+// - s.TokenSesion, s.RefreshToken: tokens generados por el MS (se guarda su SHA-256)
+func (r *SegundoFactor) CompletarLogin(ctx context.Context, TokenDesafio string, Paso int64, CodigoRecuperacion string, CodigosRecuperacion []string,
+	u *models.Usuarios, s *models.Sesiones, Politica repositorios.PoliticaSesion) (string, error) {
+	var paso any
+	if Paso > 0 {
+		paso = Paso
+	}
+	var codigos any
+	if len(CodigosRecuperacion) > 0 {
+		b, err := json.Marshal(CodigosRecuperacion)
+		if err != nil {
+			return "", err
+		}
+		codigos = string(b)
+	}
+	rows, err := r.db.QueryContext(ctx, "CALL tsp_completar_login_usuario(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", TokenDesafio, paso,
+		nulo(CodigoRecuperacion), codigos, s.TokenSesion, s.RefreshToken, nulo(s.Dispositivo), nulo(s.IP),
+		Politica.MinutosToken, Politica.MinutosInactividad, Politica.HorasDuracion, Politica.MaxSesiones)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	return escanearLogin(rows, u, s, nil)
+}
+
+// Permite a un administrador borrar el segundo factor de un usuario.
+// tsp_restablecer_segundo_factor_usuario
+func (r *SegundoFactor) Restablecer(ctx context.Context, IdUsuario int) (string, error) {
+	credencial, actor := auth.CredencialDesdeCtx(ctx)
+	var mensaje string
+	err := r.db.QueryRowContext(ctx, "CALL tsp_restablecer_segundo_factor_usuario(?, ?, ?)", IdUsuario, credencial, actor).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	return mensaje, nil
+}
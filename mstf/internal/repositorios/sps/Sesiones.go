@@ -0,0 +1,103 @@
+package sps
+
+import (
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type Sesiones struct {
+	db *sql.DB
+}
+
+func NewSesiones(db *sql.DB) *Sesiones {
+	return &Sesiones{db: db}
+}
+
+// Permite renovar el token de una sesión con su refresh token, rotando ambos.
+// tsp_renovar_sesion
+// - RefreshToken: refresh token vigente de la sesión
+// - s.TokenSesion, s.RefreshToken: tokens nuevos generados por el MS (se guarda su SHA-256)
+// - MinutosToken: vencimiento del token nuevo (sin superar el vencimiento de la sesión)
+func (r *Sesiones) Renovar(ctx context.Context, RefreshToken string, s *models.Sesiones, MinutosToken int) (string, error) {
+	rows, err := r.db.QueryContext(ctx, "CALL tsp_renovar_sesion(?, ?, ?, ?)", RefreshToken, s.TokenSesion, s.RefreshToken, MinutosToken)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var mensaje string
+	var fechaInicio, fechaExpiracionToken, fechaExpiracion sql.NullTime
+	if !rows.Next() {
+		return "", errors.New("Error: intente nuevamente o contacte al administrador")
+	}
+	err = rows.Scan(&mensaje, &s.IdSesion, &s.IdUsuario, &fechaInicio, &fechaExpiracionToken, &fechaExpiracion)
+	if err != nil {
+		return "", err
+	}
+	s.FechaInicio = fechaInicio.Time
+	s.FechaExpiracionToken = fechaExpiracionToken.Time
+	s.FechaExpiracion = fechaExpiracion.Time
+	return mensaje, nil
+}
+
+// Permite al usuario de la sesión listar sus sesiones vigentes.
+// tsp_buscar_sesiones
+func (r *Sesiones) Listar(ctx context.Context) ([]models.Sesiones, error) {
+	credencial, _ := auth.CredencialDesdeCtx(ctx)
+	rows, err := r.db.QueryContext(ctx, "CALL tsp_buscar_sesiones(?)", credencial)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sesiones := make([]models.Sesiones, 0)
+	for rows.Next() {
+		var s models.Sesiones
+		var dispositivo, ip sql.NullString
+		var actual string
+		err = rows.Scan(&s.IdSesion, &dispositivo, &ip, &s.FechaInicio, &s.FechaUltimoUso,
+			&s.FechaExpiracionToken, &s.FechaExpiracion, &actual)
+		if err != nil {
+			return nil, err
+		}
+		s.Dispositivo = dispositivo.String
+		s.IP = ip.String
+		s.Actual = actual == "S"
+		sesiones = append(sesiones, s)
+	}
+	return sesiones, nil
+}
+
+// Permite al usuario de la sesión cerrar una de sus sesiones.
+// tsp_revocar_sesion
+func (r *Sesiones) Revocar(ctx context.Context, IdSesion int) (string, error) {
+	credencial, _ := auth.CredencialDesdeCtx(ctx)
+	var mensaje string
+	err := r.db.QueryRowContext(ctx, "CALL tsp_revocar_sesion(?, ?)", credencial, IdSesion).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	return mensaje, nil
+}
+
+// Permite a un administrador cerrar todas las sesiones de un usuario.
+// tsp_revocar_sesiones_usuario
+func (r *Sesiones) RevocarUsuario(ctx context.Context, IdUsuario int) (string, error) {
+	credencial, actor := auth.CredencialDesdeCtx(ctx)
+	var mensaje string
+	err := r.db.QueryRowContext(ctx, "CALL tsp_revocar_sesiones_usuario(?, ?, ?)", IdUsuario, credencial, actor).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	return mensaje, nil
+}
+
+// NULL para las cadenas vacías (columnas opcionales)
+func nulo(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,303 @@
+package sps
+
+import (
+	"MSTransaccionesFinancieras/internal/auth"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+type Usuarios struct {
+	db *sql.DB
+}
+
+func NewUsuarios(db *sql.DB) *Usuarios {
+	return &Usuarios{db: db}
+}
+
+// Instancia un usuario específico por su ID.
+// tsp_dame_usuario (no devuelve filas si el usuario no existe)
+func (r *Usuarios) Dame(ctx context.Context, u *models.Usuarios) (string, error) {
+	rows, err := r.db.QueryContext(ctx, "CALL tsp_dame_usuario(?)", u.IdUsuario)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var mensaje string
+	var usuario sql.NullString
+	var fechaAlta sql.NullString
+	var estado sql.NullString
+	var rol sql.NullString
+	var segundoFactor sql.NullString
+	if !rows.Next() {
+		return "El usuario no existe.", nil
+	}
+	err = rows.Scan(&mensaje, &u.IdUsuario, &usuario, &fechaAlta, &estado, &rol, &segundoFactor)
+	if err != nil {
+		return mensaje, err
+	}
+	u.Usuario = usuario.String
+	u.FechaAlta = fechaAlta.String
+	u.Estado = estado.String
+	u.Rol = rol.String
+	u.SegundoFactor = segundoFactor.String
+	return mensaje, nil
+}
+
+// Permite listar todos los usuarios que cumplan con la condición de búsqueda.
+// tsp_buscar_usuarios
+// - Cadena: cadena de búsqueda para filtrar por nombre de usuario
+// - IncluyeInactivos: S para incluir usuarios inactivos, N para excluirlos
+func (r *Usuarios) Buscar(ctx context.Context, Cadena string, IncluyeInactivos string) ([]*models.Usuarios, error) {
+	rows, err := r.db.QueryContext(ctx, "CALL tsp_buscar_usuarios(?, ?)", Cadena, IncluyeInactivos)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usuarios := make([]*models.Usuarios, 0)
+	for rows.Next() {
+		var m models.Usuarios
+		err = rows.Scan(&m.IdUsuario, &m.Usuario, &m.FechaAlta, &m.Estado, &m.Rol, &m.SegundoFactor)
+		if err != nil {
+			return nil, err
+		}
+		usuarios = append(usuarios, &m)
+	}
+
+	return usuarios, nil
+}
+
+// Permite crear un usuario administrativo en estado P: Pendiente.
+// Al iniciar sesión por primera vez, deberá cambiar su contraseña temporal y se activará.
+// tsp_crear_usuario
+// - Usuario: nombre de usuario a crear
+// - Password: hash argon2id de la contraseña temporal
+func (r *Usuarios) Crear(ctx context.Context, Usuario string, Password string) (string, int, error) {
+	credencial, actor := auth.CredencialDesdeCtx(ctx)
+	var mensaje string
+	var id sql.NullInt64
+	err := r.db.QueryRowContext(ctx, "CALL tsp_crear_usuario(?, ?, ?, ?)", Usuario, Password, credencial, actor).Scan(&mensaje, &id)
+	if err != nil {
+		return "", 0, err
+	}
+	if !id.Valid {
+		return mensaje, 0, nil
+	}
+	return mensaje, int(id.Int64), nil
+}
+
+// Permite cambiar el estado de un usuario a A: Activo siempre y cuando esté inactivo.
+// tsp_activar_usuario
+func (r *Usuarios) Activar(ctx context.Context, IdUsuario int) (string, error) {
+	return r.accionAdministrativa(ctx, "CALL tsp_activar_usuario(?, ?, ?)", IdUsuario)
+}
+
+// Permite cambiar el estado de un usuario a I: Inactivo siempre y cuando no lo esté.
+// tsp_desactivar_usuario
+func (r *Usuarios) Desactivar(ctx context.Context, IdUsuario int) (string, error) {
+	return r.accionAdministrativa(ctx, "CALL tsp_desactivar_usuario(?, ?, ?)", IdUsuario)
+}
+
+// Permite eliminar un usuario siempre y cuando no tenga registros en Operaciones y no se encuentre Activo.
+// tsp_borrar_usuario
+func (r *Usuarios) Borrar(ctx context.Context, IdUsuario int) (string, error) {
+	return r.accionAdministrativa(ctx, "CALL tsp_borrar_usuario(?, ?, ?)", IdUsuario)
+}
+
+// Llama a un SP (IdUsuario, credencial, actor) que devuelve solo el mensaje
+func (r *Usuarios) accionAdministrativa(ctx context.Context, sp string, IdUsuario int) (string, error) {
+	credencial, actor := auth.CredencialDesdeCtx(ctx)
+	var mensaje string
+	err := r.db.QueryRowContext(ctx, sp, IdUsuario, credencial, actor).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	return mensaje, nil
+}
+
+// Devuelve el Id y el hash de contraseña guardado del usuario, para verificarlo en el MS.
+// tsp_dame_password_usuario (Id 0 si el usuario no existe)
+func (r *Usuarios) DamePassword(ctx context.Context, Usuario string) (int, string, error) {
+	return r.damePassword(ctx, Usuario, nil)
+}
+
+// Devuelve el Id y el hash de contraseña guardado del usuario activo de la sesión.
+// tsp_dame_password_usuario (Id 0 si la sesión no es válida)
+func (r *Usuarios) DamePasswordSesion(ctx context.Context) (int, string, error) {
+	credencial, _ := auth.CredencialDesdeCtx(ctx)
+	return r.damePassword(ctx, nil, credencial)
+}
+
+func (r *Usuarios) damePassword(ctx context.Context, Usuario any, TokenSesion any) (int, string, error) {
+	var id int
+	var password sql.NullString
+	err := r.db.QueryRowContext(ctx, "CALL tsp_dame_password_usuario(?, ?)", Usuario, TokenSesion).Scan(&id, &password)
+	if err != nil {
+		return 0, "", err
+	}
+	return id, password.String, nil
+}
+
+// Reemplaza el hash de la contraseña si sigue siendo el verificado (migración de MD5 a argon2id en el login).
+// tsp_migrar_password_usuario
+func (r *Usuarios) MigrarPassword(ctx context.Context, IdUsuario int, PasswordAnterior string, PasswordNuevo string) (string, error) {
+	var mensaje string
+	err := r.db.QueryRowContext(ctx, "CALL tsp_migrar_password_usuario(?, ?, ?)", IdUsuario, PasswordAnterior, PasswordNuevo).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	return mensaje, nil
+}
+
+// Permite a un usuario iniciar sesión en el sistema administrativo de MSTF, creando una sesión nueva.
+// tsp_login_usuario
+// - u.Usuario: nombre de usuario que intenta iniciar sesión
+// - Password: hash guardado de la contraseña, ya verificado por el MS
+// - s.TokenSesion, s.RefreshToken: tokens generados por el MS (se guarda su SHA-256)
+// - s.Dispositivo, s.IP: datos informativos del cliente
+// - d.TokenDesafio: token generado por el MS para el desafío de segundo factor, si el usuario lo requiere
+func (r *Usuarios) Login(ctx context.Context, u *models.Usuarios, Password string, s *models.Sesiones, d *models.DesafiosLogin, Politica repositorios.PoliticaSesion) (string, error) {
+	rows, err := r.db.QueryContext(ctx, "CALL tsp_login_usuario(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", u.Usuario, Password,
+		s.TokenSesion, s.RefreshToken, nulo(s.Dispositivo), nulo(s.IP),
+		Politica.MinutosToken, Politica.MinutosInactividad, Politica.HorasDuracion, Politica.MaxSesiones,
+		d.TokenDesafio, strings.Join(Politica.RolesSegundoFactor, ","))
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	return escanearLogin(rows, u, s, d)
+}
+
+// Lee la fila de tsp_login_usuario o tsp_completar_login_usuario. Con desafío (Desafio V o I) no hay sesión:
+// FechaExpiracion es la del desafío y s queda sin tokens. d puede ser nil si el SP no crea desafíos
+func escanearLogin(rows *sql.Rows, u *models.Usuarios, s *models.Sesiones, d *models.DesafiosLogin) (string, error) {
+	var mensaje string
+	var usr sql.NullString
+	var fechaAlta sql.NullString
+	var estado sql.NullString
+	var rol sql.NullString
+	var fechaInicio, fechaExpiracionToken, fechaExpiracion sql.NullTime
+	var desafio sql.NullString
+	if !rows.Next() {
+		return "", errors.New("Error: intente nuevamente o contacte al administrador")
+	}
+	err := rows.Scan(&mensaje, &u.IdUsuario, &usr, &fechaAlta, &estado, &rol,
+		&s.IdSesion, &fechaInicio, &fechaExpiracionToken, &fechaExpiracion, &desafio)
+	if err != nil {
+		return "", err
+	}
+	u.Usuario = usr.String
+	u.FechaAlta = fechaAlta.String
+	u.Estado = estado.String
+	u.Rol = rol.String
+	u.TokenSesion = ""
+	if mensaje == "OK" && desafio.Valid && d != nil {
+		d.Inscripcion = desafio.String == "I"
+		d.FechaExpiracion = fechaExpiracion.Time
+		s.TokenSesion, s.RefreshToken = "", ""
+		return mensaje, nil
+	}
+	if d != nil {
+		d.TokenDesafio = ""
+	}
+	if mensaje == "OK" {
+		u.TokenSesion = s.TokenSesion
+	}
+	s.IdUsuario = u.IdUsuario
+	s.FechaInicio = fechaInicio.Time
+	s.FechaUltimoUso = fechaInicio.Time
+	s.FechaExpiracionToken = fechaExpiracionToken.Time
+	s.FechaExpiracion = fechaExpiracion.Time
+	return mensaje, nil
+}
+
+// Permite al usuario activo cerrar su sesión actual (las de otros dispositivos siguen vigentes).
+// tsp_logout_usuario
+func (r *Usuarios) Logout(ctx context.Context) (string, error) {
+	credencial, _ := auth.CredencialDesdeCtx(ctx)
+	var mensaje string
+	err := r.db.QueryRowContext(ctx, "CALL tsp_logout_usuario(?)", credencial).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	return mensaje, nil
+}
+
+// Permite al usuario Pendiente cambiar su contraseña temporal y activarse.
+// tsp_confirmar_cuenta_usuario
+// - Password: hash argon2id de la contraseña definitiva
+func (r *Usuarios) ConfirmarCuenta(ctx context.Context, Password string) (string, error) {
+	credencial, _ := auth.CredencialDesdeCtx(ctx)
+	var mensaje string
+	err := r.db.QueryRowContext(ctx, "CALL tsp_confirmar_cuenta_usuario(?, ?)", credencial, Password).Scan(&mensaje)
+	return mensaje, err
+}
+
+// Permite al usuario modificar su contraseña.
+// tsp_modificar_password_usuario
+// - PasswordAnterior: hash guardado de la contraseña actual, ya verificado por el MS
+// - PasswordNuevo: hash argon2id de la nueva contraseña
+func (r *Usuarios) ModificarPassword(ctx context.Context, PasswordAnterior string, PasswordNuevo string) (string, error) {
+	credencial, _ := auth.CredencialDesdeCtx(ctx)
+	var mensaje string
+	err := r.db.QueryRowContext(ctx, "CALL tsp_modificar_password_usuario(?, ?, ?)", credencial, PasswordAnterior, PasswordNuevo).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	return mensaje, nil
+}
+
+// Permite a un administrador logueado restablecer la contraseña de otro usuario.
+// tsp_restablecer_password_usuario
+// - IdUsuario: ID del usuario al que se le restablecerá la contraseña
+// - Password: hash argon2id de la contraseña temporal
+func (r *Usuarios) RestablecerPassword(ctx context.Context, IdUsuario int, Password string) (string, error) {
+	credencial, actor := auth.CredencialDesdeCtx(ctx)
+	var mensaje string
+	err := r.db.QueryRowContext(ctx, "CALL tsp_restablecer_password_usuario(?, ?, ?, ?)", IdUsuario, Password, credencial, actor).Scan(&mensaje)
+	if err != nil {
+		return "", err
+	}
+	return mensaje, nil
+}
+
+// Reserva un intento de login del usuario antes de verificar sus credenciales. Devuelve los segundos a esperar
+// si el login está bloqueado (0 si se reservó).
+// tsp_reservar_intento_login
+func (r *Usuarios) ReservarIntentoLogin(ctx context.Context, Usuario string, IP string, Politica repositorios.PoliticaBloqueoLogin) (string, int, error) {
+	var mensaje string
+	var segundos int
+	err := r.db.QueryRowContext(ctx, "CALL tsp_reservar_intento_login(?, ?, ?, ?, ?)", Usuario, nulo(IP),
+		Politica.IntentosMax, Politica.SegundosBloqueo, Politica.HorasVentana).Scan(&mensaje, &segundos)
+	if err != nil {
+		return "", 0, err
+	}
+	return mensaje, segundos, nil
+}
+
+// Devuelve un intento reservado cuyas credenciales resultaron válidas.
+// tsp_liberar_intento_login
+func (r *Usuarios) LiberarIntentoLogin(ctx context.Context, Usuario string) (string, error) {
+	var mensaje string
+	if err := r.db.QueryRowContext(ctx, "CALL tsp_liberar_intento_login(?)", Usuario).Scan(&mensaje); err != nil {
+		return "", err
+	}
+	return mensaje, nil
+}
+
+// Confirma como fallido un intento reservado y, si llega al máximo de la política, bloquea el login del usuario.
+// tsp_registrar_login_fallido
+func (r *Usuarios) RegistrarLoginFallido(ctx context.Context, Usuario string, Politica repositorios.PoliticaBloqueoLogin) (string, int, error) {
+	var mensaje string
+	var segundos int
+	err := r.db.QueryRowContext(ctx, "CALL tsp_registrar_login_fallido(?, ?, ?, ?)", Usuario,
+		Politica.IntentosMax, Politica.SegundosBloqueo, Politica.MinutosBloqueoMax).Scan(&mensaje, &segundos)
+	if err != nil {
+		return "", 0, err
+	}
+	return mensaje, segundos, nil
+}
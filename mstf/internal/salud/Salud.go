@@ -0,0 +1,143 @@
+package salud
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+)
+
+// Health checks del MS (GET /health/ready). Cada dependencia registra su verificación al iniciar (ver main);
+// el MS está listo cuando terminó la inicialización y todas las dependencias críticas responden.
+
+const (
+	EstadoOK       = "OK"
+	EstadoError    = "ERROR"
+	EstadoApagando = "APAGANDO"
+)
+
+// Resultado de la verificación de una dependencia
+type EstadoDependencia struct {
+	Estado   string `json:"Estado"`
+	Critica  bool   `json:"Critica"`
+	Latencia string `json:"Latencia"`
+	Error    string `json:"Error,omitempty"`
+}
+
+type Reporte struct {
+	Estado       string                       `json:"Estado"`
+	Dependencias map[string]EstadoDependencia `json:"Dependencias"`
+}
+
+type verificacion struct {
+	critica   bool
+	verificar func(ctx context.Context) error
+}
+
+var (
+	mu             sync.RWMutex
+	verificaciones = map[string]verificacion{}
+	inicializado   atomic.Bool
+	apagando       atomic.Bool
+)
+
+// Registra la verificación de una dependencia. Si es crítica, su falla hace que el MS no esté listo;
+// si no, solo se informa en el reporte.
+func Registrar(nombre string, critica bool, verificar func(ctx context.Context) error) {
+	mu.Lock()
+	defer mu.Unlock()
+	verificaciones[nombre] = verificacion{critica: critica, verificar: verificar}
+}
+
+// Marca el fin de la inicialización del MS (cuentas empresa en TB y monedas pendientes)
+func MarcarInicializado() {
+	inicializado.Store(true)
+}
+
+// Marca el inicio del apagado: a partir de acá el MS deja de estar listo
+func MarcarApagando() {
+	apagando.Store(true)
+}
+
+// Ejecuta en paralelo las verificaciones registradas, cada una con timeout SALUDTIMEOUTMS.
+// Durante el apagado no se verifica nada (las dependencias se están cerrando) y se informa APAGANDO.
+func Verificar(ctx context.Context, parametros repositorios.Parametros) Reporte {
+	if apagando.Load() {
+		return Reporte{Estado: EstadoApagando, Dependencias: map[string]EstadoDependencia{}}
+	}
+
+	mu.RLock()
+	pendientes := make(map[string]verificacion, len(verificaciones))
+	for nombre, v := range verificaciones {
+		pendientes[nombre] = v
+	}
+	mu.RUnlock()
+
+	timeout := obtenerTimeout(parametros)
+	reporte := Reporte{Estado: EstadoOK, Dependencias: make(map[string]EstadoDependencia, len(pendientes)+1)}
+	var muReporte sync.Mutex
+	var wg sync.WaitGroup
+	for nombre, v := range pendientes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctxVerificacion, cancelar := context.WithTimeout(ctx, timeout)
+			defer cancelar()
+			inicio := time.Now()
+			err := v.verificar(ctxVerificacion)
+			estado := EstadoDependencia{Estado: EstadoOK, Critica: v.critica, Latencia: time.Since(inicio).String()}
+			if err != nil {
+				estado.Estado = EstadoError
+				estado.Error = err.Error()
+			}
+			muReporte.Lock()
+			reporte.Dependencias[nombre] = estado
+			muReporte.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	estadoInicio := EstadoDependencia{Estado: EstadoOK, Critica: true, Latencia: "0s"}
+	if !inicializado.Load() {
+		estadoInicio.Estado = EstadoError
+		estadoInicio.Error = "inicialización de cuentas empresa en curso"
+	}
+	reporte.Dependencias["inicializacion"] = estadoInicio
+
+	for _, d := range reporte.Dependencias {
+		if d.Critica && d.Estado != EstadoOK {
+			reporte.Estado = EstadoError
+		}
+	}
+	return reporte
+}
+
+func obtenerTimeout(parametros repositorios.Parametros) time.Duration {
+	p := &models.Parametros{Parametro: "SALUDTIMEOUTMS"}
+	if _, err := parametros.Dame(context.Background(), p); err != nil || p.Valor == "" {
+		return 2 * time.Second
+	}
+	val, err := strconv.Atoi(p.Valor)
+	if err != nil || val <= 0 {
+		return 2 * time.Second
+	}
+	return time.Duration(val) * time.Millisecond
+}
+
+// Tiempo que se sigue atendiendo HTTP después de marcar el apagado, para que los balanceadores vean
+// /health/ready en 503 y dejen de enviar requests antes de cerrar el listener.
+func ObtenerEsperaApagado(parametros repositorios.Parametros) time.Duration {
+	p := &models.Parametros{Parametro: "APAGADOESPERASEG"}
+	if _, err := parametros.Dame(context.Background(), p); err != nil || p.Valor == "" {
+		return 5 * time.Second
+	}
+	val, err := strconv.Atoi(p.Valor)
+	if err != nil || val < 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(val) * time.Second
+}
@@ -0,0 +1,137 @@
+package salud
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios/memoria"
+)
+
+var errCaida = errors.New("conexión rechazada")
+
+// Deja el estado del paquete como al iniciar el MS y lo restaura al terminar el test
+func reiniciar(t *testing.T) {
+	t.Helper()
+	limpiar := func() {
+		mu.Lock()
+		verificaciones = map[string]verificacion{}
+		mu.Unlock()
+		inicializado.Store(false)
+		apagando.Store(false)
+	}
+	limpiar()
+	t.Cleanup(limpiar)
+}
+
+// Registra las dependencias del MS (ver main); las de caidas fallan
+func registrarDependencias(caidas ...string) {
+	criticas := map[string]bool{"tigerbeetle": true, "mysql": true, "kafka_consumidor": true, "kafka_productor": false}
+	for nombre, critica := range criticas {
+		var err error
+		for _, caida := range caidas {
+			if caida == nombre {
+				err = errCaida
+			}
+		}
+		Registrar(nombre, critica, func(context.Context) error { return err })
+	}
+}
+
+func TestVerificarListo(t *testing.T) {
+	reiniciar(t)
+	registrarDependencias()
+	MarcarInicializado()
+
+	reporte := Verificar(t.Context(), memoria.New().Repositorios().Parametros)
+	if reporte.Estado != EstadoOK || len(reporte.Dependencias) != 5 {
+		t.Fatalf("reporte: %+v", reporte)
+	}
+	for nombre, d := range reporte.Dependencias {
+		if d.Estado != EstadoOK || d.Error != "" || d.Latencia == "" {
+			t.Fatalf("%s: %+v", nombre, d)
+		}
+	}
+}
+
+// Una dependencia crítica caída deja al MS no listo; una no crítica solo se informa
+func TestVerificarDependenciaCaida(t *testing.T) {
+	casos := []struct {
+		caida  string
+		estado string
+	}{
+		{"tigerbeetle", EstadoError},
+		{"mysql", EstadoError},
+		{"kafka_consumidor", EstadoError},
+		{"kafka_productor", EstadoOK},
+	}
+	for _, c := range casos {
+		t.Run(c.caida, func(t *testing.T) {
+			reiniciar(t)
+			registrarDependencias(c.caida)
+			MarcarInicializado()
+
+			reporte := Verificar(t.Context(), memoria.New().Repositorios().Parametros)
+			if reporte.Estado != c.estado {
+				t.Fatalf("estado %s, se esperaba %s: %+v", reporte.Estado, c.estado, reporte)
+			}
+			for nombre, d := range reporte.Dependencias {
+				if nombre == c.caida {
+					if d.Estado != EstadoError || d.Error != errCaida.Error() {
+						t.Fatalf("%s caída: %+v", nombre, d)
+					}
+				} else if d.Estado != EstadoOK {
+					t.Fatalf("%s: %+v", nombre, d)
+				}
+			}
+		})
+	}
+}
+
+func TestVerificarSinInicializar(t *testing.T) {
+	reiniciar(t)
+	registrarDependencias()
+
+	reporte := Verificar(t.Context(), memoria.New().Repositorios().Parametros)
+	if d := reporte.Dependencias["inicializacion"]; reporte.Estado != EstadoError || d.Estado != EstadoError || d.Error == "" {
+		t.Fatalf("reporte: %+v", reporte)
+	}
+}
+
+// Una dependencia que no responde falla al vencer SALUDTIMEOUTMS, sin demorar el reporte
+func TestVerificarTimeout(t *testing.T) {
+	reiniciar(t)
+	registrarDependencias()
+	Registrar("mysql", true, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	MarcarInicializado()
+	bd := memoria.New()
+	bd.GuardarParametro(models.Parametros{Parametro: "SALUDTIMEOUTMS", Valor: "50"})
+
+	inicio := time.Now()
+	reporte := Verificar(t.Context(), bd.Repositorios().Parametros)
+	if d := reporte.Dependencias["mysql"]; reporte.Estado != EstadoError || d.Error != context.DeadlineExceeded.Error() {
+		t.Fatalf("reporte: %+v", reporte)
+	}
+	if d := time.Since(inicio); d > time.Second {
+		t.Fatalf("el reporte tardó %s", d)
+	}
+}
+
+// Durante el apagado no se verifican las dependencias
+func TestVerificarApagando(t *testing.T) {
+	reiniciar(t)
+	verificadas := 0
+	Registrar("tigerbeetle", true, func(context.Context) error { verificadas++; return nil })
+	MarcarInicializado()
+	MarcarApagando()
+
+	reporte := Verificar(t.Context(), memoria.New().Repositorios().Parametros)
+	if reporte.Estado != EstadoApagando || len(reporte.Dependencias) != 0 || verificadas != 0 {
+		t.Fatalf("reporte: %+v (%d verificaciones)", reporte, verificadas)
+	}
+}
@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Parámetros de argon2id (mínimos recomendados por OWASP). Quedan guardados en cada hash, así que cambiarlos
+// no invalida las contraseñas existentes: se re-hashean en el próximo login.
+const (
+	argon2Memoria   = 19 * 1024 // KiB
+	argon2Iteracion = 2
+	argon2Hilos     = 1
+	argon2LargoSal  = 16
+	argon2LargoHash = 32
+)
+
+// Política de contraseñas de usuarios (parámetros PASSWORD*)
+type PoliticaPassword struct {
+	LongitudMinima    int
+	RequiereMayuscula bool
+	RequiereNumero    bool
+	RequiereSimbolo   bool
+}
+
+var PoliticaPasswordPorDefecto = PoliticaPassword{LongitudMinima: 8, RequiereMayuscula: true, RequiereNumero: true}
+
+// Valida el formato de una contraseña según la política
+func ValidarFormatoPassword(p string, politica PoliticaPassword) error {
+	if len([]rune(p)) < politica.LongitudMinima {
+		return fmt.Errorf("la contraseña debe tener al menos %d caracteres", politica.LongitudMinima)
+	}
+	tieneMayuscula := false
+	tieneDigito := false
+	tieneSimbolo := false
+	for _, c := range p {
+		switch {
+		case unicode.IsUpper(c):
+			tieneMayuscula = true
+		case unicode.IsDigit(c):
+			tieneDigito = true
+		case !unicode.IsLetter(c) && !unicode.IsSpace(c):
+			tieneSimbolo = true
+		}
+	}
+	if politica.RequiereMayuscula && !tieneMayuscula {
+		return errors.New("la contraseña debe contener al menos una mayúscula")
+	}
+	if politica.RequiereNumero && !tieneDigito {
+		return errors.New("la contraseña debe contener al menos un número")
+	}
+	if politica.RequiereSimbolo && !tieneSimbolo {
+		return errors.New("la contraseña debe contener al menos un símbolo")
+	}
+	return nil
+}
+
+// Hash argon2id con sal aleatoria en formato PHC: $argon2id$v=19$m=...,t=...,p=...$sal$hash
+func HashPassword(p string) (string, error) {
+	sal := make([]byte, argon2LargoSal)
+	if _, err := rand.Read(sal); err != nil {
+		return "", err
+	}
+	hash := argon2.IDKey([]byte(p), sal, argon2Iteracion, argon2Memoria, argon2Hilos, argon2LargoHash)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memoria, argon2Iteracion, argon2Hilos,
+		base64.RawStdEncoding.EncodeToString(sal), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+// Verifica la contraseña contra el hash guardado: argon2id o MD5 heredado (sin sal, de antes de argon2id).
+// migrar indica que la contraseña es válida pero el hash debe reemplazarse por uno con los parámetros actuales.
+func VerificarPassword(p string, guardado string) (valida bool, migrar bool) {
+	if strings.HasPrefix(guardado, "$argon2id$") {
+		var version, memoria, iteraciones int
+		var hilos uint8
+		partes := strings.Split(guardado, "$")
+		if len(partes) != 6 {
+			return false, false
+		}
+		if _, err := fmt.Sscanf(partes[2], "v=%d", &version); err != nil || version != argon2.Version {
+			return false, false
+		}
+		if _, err := fmt.Sscanf(partes[3], "m=%d,t=%d,p=%d", &memoria, &iteraciones, &hilos); err != nil || memoria <= 0 || iteraciones <= 0 || hilos == 0 {
+			return false, false
+		}
+		sal, err := base64.RawStdEncoding.DecodeString(partes[4])
+		if err != nil {
+			return false, false
+		}
+		hash, err := base64.RawStdEncoding.DecodeString(partes[5])
+		if err != nil || len(hash) == 0 {
+			return false, false
+		}
+		calculado := argon2.IDKey([]byte(p), sal, uint32(iteraciones), uint32(memoria), hilos, uint32(len(hash)))
+		if subtle.ConstantTimeCompare(calculado, hash) != 1 {
+			return false, false
+		}
+		return true, memoria != argon2Memoria || iteraciones != argon2Iteracion || hilos != argon2Hilos || len(hash) != argon2LargoHash
+	}
+	if len(guardado) == md5.Size*2 {
+		return subtle.ConstantTimeCompare([]byte(MD5Hash(p)), []byte(strings.ToLower(guardado))) == 1, true
+	}
+	return false, false
+}
+
+// Contraseña temporal aleatoria de 12 caracteres con mayúsculas, minúsculas y números (sin caracteres
+// ambiguos como I, l, O, 0), que el usuario reemplaza al confirmar su cuenta
+func GenerarPasswordTemporal() (string, error) {
+	const (
+		mayusculas = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+		minusculas = "abcdefghjkmnpqrstuvwxyz"
+		numeros    = "23456789"
+	)
+	conjuntos := []string{mayusculas, minusculas, numeros}
+	todos := mayusculas + minusculas + numeros
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	p := make([]byte, len(b))
+	for i, r := range b {
+		// los tres primeros garantizan un caracter de cada conjunto
+		alfabeto := todos
+		if i < len(conjuntos) {
+			alfabeto = conjuntos[i]
+		}
+		p[i] = alfabeto[int(r)%len(alfabeto)]
+	}
+	return string(p), nil
+}
+
+// Token de sesión o refresh token: 32 caracteres hexadecimales aleatorios (128 bits)
+func GenerarToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// API key de un sistema cliente: "mstf_" y 64 caracteres hexadecimales aleatorios (256 bits)
+func GenerarApiKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "mstf_" + hex.EncodeToString(b), nil
+}
+
+// Primeros 12 caracteres de una API key, que se guardan para identificarla (ApiKeys.Prefijo)
+func PrefijoApiKey(ApiKey string) string {
+	if len(ApiKey) <= 12 {
+		return ApiKey
+	}
+	return ApiKey[:12]
+}
+
+// SHA-256 en hexadecimal de un token, igual a SHA2(token, 256) de MySQL. Los tokens se guardan solo hasheados
+func HashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// Convierte string a hash md5 (solo para verificar las contraseñas heredadas)
+func MD5Hash(text string) string {
+	hasher := md5.New()
+	hasher.Write([]byte(text))
+	return hex.EncodeToString(hasher.Sum(nil))
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Parámetros de TOTP (RFC 6238) compatibles con las apps autenticadoras: HMAC-SHA1, 6 dígitos, pasos de 30 segundos
+const (
+	totpEmisor  = "MSTF"
+	totpDigitos = 6
+	totpPeriodo = 30
+	// Pasos de tolerancia antes y después del actual, por desfase de reloj del dispositivo
+	totpTolerancia = 1
+)
+
+var base32SinRelleno = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Secreto TOTP aleatorio de 160 bits en base32 sin relleno (32 caracteres), como lo esperan las apps autenticadoras
+func GenerarSecretoTOTP() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32SinRelleno.EncodeToString(b), nil
+}
+
+// URI otpauth:// para dar de alta el secreto en una app autenticadora (se muestra como código QR)
+func URITOTP(Usuario string, Secreto string) string {
+	q := url.Values{}
+	q.Set("secret", Secreto)
+	q.Set("issuer", totpEmisor)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigitos))
+	q.Set("period", fmt.Sprint(totpPeriodo))
+	return "otpauth://totp/" + url.PathEscape(totpEmisor+":"+Usuario) + "?" + q.Encode()
+}
+
+// Paso de 30 segundos al que corresponde el instante t
+func PasoTOTP(t time.Time) int64 {
+	return t.Unix() / totpPeriodo
+}
+
+// Código TOTP de 6 dígitos del secreto para un paso
+func CodigoTOTP(Secreto string, Paso int64) (string, error) {
+	clave, err := base32SinRelleno.DecodeString(strings.ToUpper(Secreto))
+	if err != nil {
+		return "", err
+	}
+	var mensaje [8]byte
+	binary.BigEndian.PutUint64(mensaje[:], uint64(Paso))
+	mac := hmac.New(sha1.New, clave)
+	mac.Write(mensaje[:])
+	h := mac.Sum(nil)
+	desplazamiento := h[len(h)-1] & 0x0f
+	valor := binary.BigEndian.Uint32(h[desplazamiento:desplazamiento+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigitos, valor%1000000), nil
+}
+
+// Verifica un código TOTP en el instante Ahora, con un paso de tolerancia. Solo acepta pasos posteriores a
+// UltimoPaso (el último ya usado), para que un código interceptado no se pueda reutilizar.
+// Devuelve el paso del código, o 0 si es inválido.
+func VerificarTOTP(Secreto string, Codigo string, Ahora time.Time, UltimoPaso int64) int64 {
+	Codigo = strings.TrimSpace(Codigo)
+	if len(Codigo) != totpDigitos {
+		return 0
+	}
+	actual := PasoTOTP(Ahora)
+	for paso := actual - totpTolerancia; paso <= actual+totpTolerancia; paso++ {
+		if paso <= UltimoPaso {
+			continue
+		}
+		esperado, err := CodigoTOTP(Secreto, paso)
+		if err != nil {
+			return 0
+		}
+		if subtle.ConstantTimeCompare([]byte(esperado), []byte(Codigo)) == 1 {
+			return paso
+		}
+	}
+	return 0
+}
+
+// Códigos de recuperación de un solo uso para iniciar sesión sin la app autenticadora: 10 caracteres en
+// minúsculas y números sin ambiguos, en dos grupos (abcde-23456). Se guarda el SHA-256 de cada uno
+// normalizado (ver NormalizarCodigoRecuperacion).
+func GenerarCodigosRecuperacion(Cantidad int) ([]string, error) {
+	const alfabeto = "abcdefghjkmnpqrstuvwxyz23456789"
+	// se descartan los bytes >= limite para que todos los caracteres sean equiprobables (256 no es múltiplo de 31)
+	const limite = 256 - 256%len(alfabeto)
+	codigos := make([]string, Cantidad)
+	b := make([]byte, 16)
+	for i := range codigos {
+		c := make([]byte, 0, 10)
+		for len(c) < cap(c) {
+			if _, err := rand.Read(b); err != nil {
+				return nil, err
+			}
+			for _, r := range b {
+				if int(r) < limite && len(c) < cap(c) {
+					c = append(c, alfabeto[int(r)%len(alfabeto)])
+				}
+			}
+		}
+		codigos[i] = string(c[:5]) + "-" + string(c[5:])
+	}
+	return codigos, nil
+}
+
+// Código de recuperación sin espacios ni guiones y en minúsculas, tal como se hashea
+func NormalizarCodigoRecuperacion(Codigo string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(Codigo))
+}
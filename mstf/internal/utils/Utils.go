@@ -1,9 +1,7 @@
 package utils
 
 import (
-	"crypto/md5"
 	"encoding/binary"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"math/big"
@@ -11,7 +9,6 @@ import (
 	"strconv"
 	"strings"
 	"time"
-	"unicode"
 
 	"github.com/tigerbeetle/tigerbeetle-go/pkg/types"
 )
@@ -154,37 +151,6 @@ func FechaATimestampNS(s string) (uint64, error) {
 	return uint64(t.UnixNano()), nil
 }
 
-// Valida el formato de una contraseña: mínimo 8 caracteres, al menos una mayúscula y al menos un dígito.
-func ValidarFormatoPassword(p string) error {
-	if len(p) < 8 {
-		return errors.New("la contraseña debe tener al menos 8 caracteres")
-	}
-	tieneMayuscula := false
-	tieneDigito := false
-	for _, c := range p {
-		if unicode.IsUpper(c) {
-			tieneMayuscula = true
-		}
-		if unicode.IsDigit(c) {
-			tieneDigito = true
-		}
-	}
-	if !tieneMayuscula {
-		return errors.New("la contraseña debe contener al menos una mayúscula")
-	}
-	if !tieneDigito {
-		return errors.New("la contraseña debe contener al menos un número")
-	}
-	return nil
-}
-
-// Convierte string a hash md5
-func MD5Hash(text string) string {
-	hasher := md5.New()
-	hasher.Write([]byte(text))
-	return hex.EncodeToString(hasher.Sum(nil))
-}
-
 // Convierte un monto decimal a unidad mínima (centavos) multiplicando por 100.
 // Trunca en 2 decimales: 15.559 → 1555, 15.5 → 1550, 15 → 1500.
 // Usa representación string para evitar errores de aritmética flotante.
@@ -0,0 +1,213 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/config"
+	"MSTransaccionesFinancieras/internal/gestores"
+	httpRouter "MSTransaccionesFinancieras/internal/http"
+	"MSTransaccionesFinancieras/internal/infra/fallas"
+	"MSTransaccionesFinancieras/internal/infra/persistence"
+	"MSTransaccionesFinancieras/internal/infra/tbmemoria"
+	"MSTransaccionesFinancieras/internal/infra/webhook"
+	"MSTransaccionesFinancieras/internal/ingesta"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+	"MSTransaccionesFinancieras/internal/repositorios/memoria"
+	"MSTransaccionesFinancieras/internal/utils"
+)
+
+// Entorno end-to-end sin docker-compose: el router HTTP y el motor de ingesta del MS corren en el proceso
+// del test contra TigerBeetle en memoria, repositorios en memoria, un topic en memoria en lugar de Kafka
+// (FuenteMemoria) y un webhook que registra lo que recibe (ReceptorWebhook). Los estados de las transferencias
+// y la cuarentena quedan en los repositorios en memoria. La inyección de fallas
+// está habilitada (sin reglas): cada test la configura con PUT /admin/fallas/:destino.
+
+const (
+	apiKeyTest = "clave-e2e"
+	// unidad mínima (centavos)
+	montoMaxTest = 100000000
+	montoMinTest = 100
+	// plazo para que el motor procese lo publicado
+	plazoTest = 10 * time.Second
+)
+
+type Entorno struct {
+	URL     string
+	TB      *tbmemoria.Cliente
+	BD      *memoria.BaseDatos
+	Repos   repositorios.Repositorios
+	Topic   *FuenteMemoria
+	Webhook *ReceptorWebhook
+	Motor   *ingesta.Motor
+}
+
+func nuevoEntorno(t *testing.T) *Entorno {
+	t.Helper()
+	if err := fallas.Init(config.Config{InyeccionFallas: true}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(fallas.Limpiar)
+	tb := tbmemoria.New()
+	clienteTB := persistence.InstrumentarTB(fallas.EnvolverTB(tb))
+
+	receptor := nuevoReceptorWebhook(t)
+	webhook.Init(config.Config{URLWebhook: receptor.URL, InyeccionFallas: true})
+
+	bd := memoria.New()
+	bd.GuardarApiKey(models.ApiKeys{Nombre: "e2e", Sistema: "e2e"}, apiKeyTest)
+	bd.GuardarParametro(models.Parametros{Parametro: "MONTOMAXTRANSFER", Valor: strconv.Itoa(montoMaxTest)})
+	bd.GuardarParametro(models.Parametros{Parametro: "MONTOMINTRANSFER", Valor: strconv.Itoa(montoMinTest)})
+	// reintentos rápidos ante caídas
+	bd.GuardarParametro(models.Parametros{Parametro: "RETRYBACKOFFMAXSEG", Valor: "1"})
+	repos := bd.Repositorios()
+
+	gestorTransferencias := gestores.NewGestorTransferencias(clienteTB, repos.Parametros, repos.Monedas, repos.Auditoria, gestores.NewGestorEstadosTransferencias(repos.Estados))
+	motor := ingesta.NewMotor(clienteTB, gestorTransferencias, gestores.NewGestorCuarentena(repos.Cuarentena), repos.Parametros, repos.Monedas)
+	topic := NewFuenteMemoria(repos.Parametros)
+	motor.Registrar(topic)
+	fuenteHTTP := ingesta.NewFuenteHTTP()
+	motor.Registrar(fuenteHTTP)
+	motor.Start()
+	t.Cleanup(func() {
+		ctx, cancelar := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelar()
+		motor.Close(ctx)
+	})
+
+	// sin Kafka: ni productor (POST /transferencias) ni consumidor (/consumidor/*)
+	srv := httptest.NewServer(httpRouter.InitRouter(repos, clienteTB, nil, nil, fuenteHTTP, nil))
+	t.Cleanup(srv.Close)
+
+	return &Entorno{URL: srv.URL, TB: tb, BD: bd, Repos: repos, Topic: topic, Webhook: receptor, Motor: motor}
+}
+
+// Request a la API con la API key del sistema. Decodifica la respuesta en destino (si no es nil) y
+// devuelve el status.
+func (e *Entorno) llamar(t *testing.T, metodo string, ruta string, cuerpo any, destino any) int {
+	t.Helper()
+	var lector io.Reader
+	if cuerpo != nil {
+		b, err := json.Marshal(cuerpo)
+		if err != nil {
+			t.Fatalf("%s %s: %v", metodo, ruta, err)
+		}
+		lector = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(metodo, e.URL+ruta, lector)
+	if err != nil {
+		t.Fatalf("%s %s: %v", metodo, ruta, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", apiKeyTest)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", metodo, ruta, err)
+	}
+	defer resp.Body.Close()
+	if destino != nil {
+		if err := json.NewDecoder(resp.Body).Decode(destino); err != nil {
+			t.Fatalf("%s %s: respuesta inválida: %v", metodo, ruta, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// Falla el test si el status no es el esperado, mostrando el cuerpo de la respuesta
+func (e *Entorno) esperarStatus(t *testing.T, metodo string, ruta string, cuerpo any, esperado int) {
+	t.Helper()
+	var respuesta map[string]any
+	if status := e.llamar(t, metodo, ruta, cuerpo, &respuesta); status != esperado {
+		t.Fatalf("%s %s: status %d, se esperaba %d: %v", metodo, ruta, status, esperado, respuesta)
+	}
+}
+
+// Crea y activa la moneda con su cuenta empresa
+func (e *Entorno) crearMoneda(t *testing.T, idMoneda uint32) {
+	t.Helper()
+	e.esperarStatus(t, http.MethodPost, "/monedas", map[string]any{"IdMoneda": idMoneda}, http.StatusCreated)
+}
+
+func (e *Entorno) desactivarMoneda(t *testing.T, idMoneda uint32) {
+	t.Helper()
+	e.esperarStatus(t, http.MethodPut, fmt.Sprintf("/monedas/%d/desactivar", idMoneda), nil, http.StatusOK)
+}
+
+func (e *Entorno) crearCuenta(t *testing.T, idUsuarioFinal uint64, idMoneda uint32) {
+	t.Helper()
+	e.esperarStatus(t, http.MethodPost, "/cuentas", map[string]any{"IdUsuarioFinal": idUsuarioFinal, "IdMoneda": idMoneda, "Fecha": "2026-01-01"}, http.StatusCreated)
+}
+
+func (e *Entorno) desactivarCuenta(t *testing.T, idUsuarioFinal uint64, idMoneda uint32) {
+	t.Helper()
+	e.esperarStatus(t, http.MethodPut, fmt.Sprintf("/cuentas/%d/%d/desactivar", idUsuarioFinal, idMoneda), nil, http.StatusOK)
+}
+
+// Cuenta leída desde la API (IdUsuarioFinal 0: cuenta empresa)
+func (e *Entorno) cuenta(t *testing.T, idUsuarioFinal uint64, idMoneda uint32) models.Cuentas {
+	t.Helper()
+	var c models.Cuentas
+	if status := e.llamar(t, http.MethodGet, fmt.Sprintf("/cuentas/%d/%d", idUsuarioFinal, idMoneda), nil, &c); status != http.StatusOK {
+		t.Fatalf("GET cuenta %d/%d: status %d", idUsuarioFinal, idMoneda, status)
+	}
+	return c
+}
+
+// Verifica créditos y débitos de la cuenta (montos con dos decimales, ej: "150.00")
+func (e *Entorno) esperarSaldo(t *testing.T, idUsuarioFinal uint64, idMoneda uint32, creditos string, debitos string) {
+	t.Helper()
+	c := e.cuenta(t, idUsuarioFinal, idMoneda)
+	if c.Creditos != creditos || c.Debitos != debitos {
+		t.Fatalf("cuenta %d/%d: créditos %s débitos %s, se esperaba %s / %s", idUsuarioFinal, idMoneda, c.Creditos, c.Debitos, creditos, debitos)
+	}
+}
+
+// Publica las transferencias en el topic y espera a que el motor las procese
+func (e *Entorno) procesar(t *testing.T, transferencias ...models.KafkaTransferencias) {
+	t.Helper()
+	e.Topic.Publicar(t, transferencias...)
+	e.Topic.Esperar(t, plazoTest)
+}
+
+func ingreso(idTransferencia uint64, idUsuarioFinal uint64, idMoneda uint32, monto float64) models.KafkaTransferencias {
+	return models.KafkaTransferencias{
+		IdTransferencia: strconv.FormatUint(idTransferencia, 10),
+		IdUsuarioFinal:  idUsuarioFinal,
+		Monto:           monto,
+		IdMoneda:        idMoneda,
+		Tipo:            "I",
+		Fecha:           "2026-01-02",
+	}
+}
+
+func egreso(idTransferencia uint64, idUsuarioFinal uint64, idMoneda uint32, monto float64) models.KafkaTransferencias {
+	t := ingreso(idTransferencia, idUsuarioFinal, idMoneda, monto)
+	t.Tipo = "E"
+	return t
+}
+
+// Reversión de la transferencia idOriginal: el MS la registra con el Id de la original con el bit 64 encendido
+func reversion(idOriginal uint64, idUsuarioFinal uint64, idMoneda uint32) models.KafkaTransferencias {
+	return models.KafkaTransferencias{
+		IdTransferencia: strconv.FormatUint(idOriginal, 10),
+		IdUsuarioFinal:  idUsuarioFinal,
+		IdMoneda:        idMoneda,
+		Tipo:            "R",
+		Fecha:           "2026-01-03",
+	}
+}
+
+func idReversion(idOriginal uint64) string {
+	id, _ := utils.ParsearUint128(strconv.FormatUint(idOriginal, 10))
+	id[8] |= 0x01
+	return utils.Uint128AStringDecimal(id)
+}
@@ -0,0 +1,333 @@
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/correlacion"
+	"MSTransaccionesFinancieras/internal/esquemas"
+	"MSTransaccionesFinancieras/internal/models"
+)
+
+const monedaTest uint32 = 1
+
+// Verifica estado y mensaje de la última notificación de la transferencia
+func esperarNotificacion(t *testing.T, e *Entorno, idTransferencia string, estado string, mensaje string) models.TransferenciaNotificada {
+	t.Helper()
+	n := e.Webhook.Notificacion(t, idTransferencia)
+	if n.Estado != estado || n.Mensaje != mensaje {
+		t.Fatalf("notificación de %s: %s %q, se esperaba %s %q", idTransferencia, n.Estado, n.Mensaje, estado, mensaje)
+	}
+	return n
+}
+
+func TestIngresosYEgresos(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearMoneda(t, monedaTest)
+	e.crearCuenta(t, 10, monedaTest)
+	e.crearCuenta(t, 11, monedaTest)
+
+	e.procesar(t, ingreso(1, 10, monedaTest, 100), ingreso(2, 11, monedaTest, 50.25))
+	e.procesar(t, egreso(3, 10, monedaTest, 30.5))
+
+	e.esperarSaldo(t, 10, monedaTest, "100.00", "30.50")
+	e.esperarSaldo(t, 11, monedaTest, "50.25", "0.00")
+	// la cuenta empresa es la contraparte de todas las transferencias
+	e.esperarSaldo(t, 0, monedaTest, "30.50", "150.25")
+
+	lotes := e.Webhook.Lotes()
+	if len(lotes) != 2 || lotes[0].CantidadProcesada != 2 || lotes[1].CantidadProcesada != 1 {
+		t.Fatalf("se esperaban lotes de 2 y 1 notificaciones: %+v", lotes)
+	}
+	n := esperarNotificacion(t, e, "1", "F", "OK")
+	if n.Tipo != "I" || n.Monto != "100.00" || n.IdUsuarioFinal != 10 || n.IdMoneda != monedaTest || n.Fecha != "2026-01-02 00:00:00" {
+		t.Fatalf("notificación del ingreso: %+v", n)
+	}
+	if n.IdCorrelacion != "e2e-0" {
+		t.Fatalf("IdCorrelacion del ingreso: %q", n.IdCorrelacion)
+	}
+	n = esperarNotificacion(t, e, "3", "F", "OK")
+	if n.Tipo != "E" || n.Monto != "30.50" {
+		t.Fatalf("notificación del egreso: %+v", n)
+	}
+}
+
+func TestLoteSincronicoHTTP(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearMoneda(t, monedaTest)
+	e.crearCuenta(t, 10, monedaTest)
+
+	var lote []json.RawMessage
+	for _, tr := range []models.KafkaTransferencias{ingreso(1, 10, monedaTest, 20), egreso(2, 10, monedaTest, 25)} {
+		valor, err := esquemas.CodificarJSON(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lote = append(lote, valor)
+	}
+	var respuesta models.LoteNotificado
+	if status := e.llamar(t, http.MethodPost, "/transferencias/lote", lote, &respuesta); status != http.StatusOK {
+		t.Fatalf("POST /transferencias/lote: status %d", status)
+	}
+	if respuesta.CantidadProcesada != 2 || respuesta.Transferencias[0].Estado != "F" || respuesta.Transferencias[1].Mensaje != "Saldo insuficiente en cuenta" {
+		t.Fatalf("resultados del lote: %+v", respuesta)
+	}
+	// el webhook recibe los mismos resultados que la respuesta
+	esperarNotificacion(t, e, "1", "F", "OK")
+	esperarNotificacion(t, e, "2", "E", "Saldo insuficiente en cuenta")
+	e.esperarSaldo(t, 10, monedaTest, "20.00", "0.00")
+}
+
+// El IdCorrelacion de la request HTTP se devuelve en la respuesta y llega a la notificación y al estado de la transferencia
+func TestCorrelacionHTTP(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearMoneda(t, monedaTest)
+	e.crearCuenta(t, 10, monedaTest)
+
+	transferir := func(t *testing.T, tr models.KafkaTransferencias, header string, id string) string {
+		t.Helper()
+		valor, err := esquemas.CodificarJSON(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest(http.MethodPost, e.URL+"/transferencias/sincronica", bytes.NewReader(valor))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", apiKeyTest)
+		if header != "" {
+			req.Header.Set(header, id)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("POST /transferencias/sincronica: status %d", resp.StatusCode)
+		}
+		return resp.Header.Get(correlacion.HeaderHTTP)
+	}
+
+	if id := transferir(t, ingreso(1, 10, monedaTest, 20), correlacion.HeaderHTTP, "pedido-1"); id != "pedido-1" {
+		t.Fatalf("IdCorrelacion de la respuesta: %q", id)
+	}
+	if id := transferir(t, ingreso(2, 10, monedaTest, 20), correlacion.HeaderHTTPAlternativo, "pedido-2"); id != "pedido-2" {
+		t.Fatalf("IdCorrelacion de la respuesta con X-Request-ID: %q", id)
+	}
+	generado := transferir(t, ingreso(3, 10, monedaTest, 20), "", "")
+	if generado == "" {
+		t.Fatal("la respuesta no trae el IdCorrelacion generado")
+	}
+
+	for idTransferencia, id := range map[string]string{"1": "pedido-1", "2": "pedido-2", "3": generado} {
+		if n := esperarNotificacion(t, e, idTransferencia, "F", "OK"); n.IdCorrelacion != id {
+			t.Fatalf("IdCorrelacion notificado de %s: %q, se esperaba %q", idTransferencia, n.IdCorrelacion, id)
+		}
+		var r struct {
+			Estados []models.EstadosTransferencias
+		}
+		if status := e.llamar(t, http.MethodGet, "/transferencias/estados?IdCorrelacion="+id, nil, &r); status != http.StatusOK ||
+			len(r.Estados) != 1 || r.Estados[0].IdTransferencia != idTransferencia {
+			t.Fatalf("estados de %s: %d %+v", id, status, r)
+		}
+	}
+}
+
+func TestSaldoInsuficiente(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearMoneda(t, monedaTest)
+	e.crearCuenta(t, 10, monedaTest)
+
+	e.procesar(t, ingreso(1, 10, monedaTest, 20))
+	e.procesar(t, egreso(2, 10, monedaTest, 20.01))
+	esperarNotificacion(t, e, "2", "E", "Saldo insuficiente en cuenta")
+	e.esperarSaldo(t, 10, monedaTest, "20.00", "0.00")
+
+	// el saldo exacto sí se puede retirar
+	e.procesar(t, egreso(3, 10, monedaTest, 20))
+	esperarNotificacion(t, e, "3", "F", "OK")
+	e.esperarSaldo(t, 10, monedaTest, "20.00", "20.00")
+
+	// cuenta sin crear
+	e.procesar(t, egreso(4, 99, monedaTest, 1))
+	esperarNotificacion(t, e, "4", "E", "Cuenta no encontrada")
+
+	// la validación de saldo es conservadora: los créditos del mismo lote no cuentan como saldo disponible
+	e.procesar(t, ingreso(5, 10, monedaTest, 10), egreso(6, 10, monedaTest, 5))
+	esperarNotificacion(t, e, "5", "F", "OK")
+	esperarNotificacion(t, e, "6", "E", "Saldo insuficiente en cuenta")
+	e.esperarSaldo(t, 10, monedaTest, "30.00", "20.00")
+}
+
+func TestReversiones(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearMoneda(t, monedaTest)
+	e.crearCuenta(t, 10, monedaTest)
+
+	e.procesar(t, ingreso(1, 10, monedaTest, 80), ingreso(2, 10, monedaTest, 40))
+
+	// solo se revierte la última transferencia de la cuenta
+	e.procesar(t, reversion(1, 10, monedaTest))
+	esperarNotificacion(t, e, idReversion(1), "E", "Solo se puede revertir la última transferencia de la cuenta")
+	e.esperarSaldo(t, 10, monedaTest, "120.00", "0.00")
+
+	e.procesar(t, reversion(2, 10, monedaTest))
+	n := esperarNotificacion(t, e, idReversion(2), "F", "OK")
+	if n.Tipo != "R" || n.Monto != "40.00" {
+		t.Fatalf("notificación de la reversión: %+v", n)
+	}
+	e.esperarSaldo(t, 10, monedaTest, "120.00", "40.00")
+
+	// reenviar la misma reversión no la duplica
+	e.procesar(t, reversion(2, 10, monedaTest))
+	esperarNotificacion(t, e, idReversion(2), "F", "OK - Reintento")
+	e.esperarSaldo(t, 10, monedaTest, "120.00", "40.00")
+
+	// una reversión no se revierte
+	revRev := reversion(2, 10, monedaTest)
+	revRev.IdTransferencia = idReversion(2)
+	e.procesar(t, revRev)
+	esperarNotificacion(t, e, idReversion(2), "E", "No se puede revertir una reversión")
+	e.esperarSaldo(t, 10, monedaTest, "120.00", "40.00")
+
+	// reversión de una transferencia inexistente: falla en el parseo
+	e.procesar(t, reversion(77, 10, monedaTest))
+	esperarNotificacion(t, e, "77", "E", "No existe la transferencia a revertir")
+}
+
+func TestCuentaCerrada(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearMoneda(t, monedaTest)
+	e.crearCuenta(t, 10, monedaTest)
+	e.procesar(t, ingreso(1, 10, monedaTest, 10))
+	e.procesar(t, egreso(2, 10, monedaTest, 10))
+
+	e.desactivarCuenta(t, 10, monedaTest)
+	if c := e.cuenta(t, 10, monedaTest); c.Estado != "I" {
+		t.Fatalf("estado de la cuenta desactivada: %s", c.Estado)
+	}
+	e.procesar(t, ingreso(3, 10, monedaTest, 5))
+	esperarNotificacion(t, e, "3", "E", "La cuenta está cerrada")
+	e.esperarSaldo(t, 10, monedaTest, "10.00", "10.00")
+
+	// reactivada vuelve a operar
+	e.esperarStatus(t, http.MethodPut, "/cuentas/10/1/activar", nil, http.StatusOK)
+	e.procesar(t, ingreso(4, 10, monedaTest, 5))
+	esperarNotificacion(t, e, "4", "F", "OK")
+	e.esperarSaldo(t, 10, monedaTest, "15.00", "10.00")
+}
+
+func TestMonedaDesactivada(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearMoneda(t, monedaTest)
+	e.crearMoneda(t, 2)
+	e.crearCuenta(t, 10, monedaTest)
+	e.crearCuenta(t, 10, 2)
+
+	e.procesar(t, ingreso(1, 10, 2, 10))
+	esperarNotificacion(t, e, "1", "F", "OK")
+
+	e.desactivarMoneda(t, 2)
+	// en un mismo lote: la moneda inactiva se rechaza y la otra moneda no se ve afectada
+	e.procesar(t, ingreso(2, 10, 2, 10), ingreso(3, 10, monedaTest, 10))
+	esperarNotificacion(t, e, "2", "E", "La moneda no existe o no está activa")
+	esperarNotificacion(t, e, "3", "F", "OK")
+	e.esperarSaldo(t, 10, 2, "10.00", "0.00")
+	e.esperarSaldo(t, 10, monedaTest, "10.00", "0.00")
+
+	e.esperarStatus(t, http.MethodPut, "/monedas/2/activar", nil, http.StatusOK)
+	e.procesar(t, ingreso(4, 10, 2, 10))
+	esperarNotificacion(t, e, "4", "F", "OK")
+	e.esperarSaldo(t, 10, 2, "20.00", "0.00")
+}
+
+func TestReintentoAnteCaidaDelWebhook(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearMoneda(t, monedaTest)
+	e.crearCuenta(t, 10, monedaTest)
+
+	e.Webhook.Caer()
+	e.Topic.Publicar(t, ingreso(1, 10, monedaTest, 30))
+	limite := time.Now().Add(plazoTest)
+	for e.Webhook.IntentosFallidos() < 2 {
+		if time.Now().After(limite) {
+			t.Fatal("el motor no reintentó la notificación")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// TB ya registró la transferencia, pero el lote no se confirma hasta notificarlo
+	if e.Topic.Pendientes() != 1 {
+		t.Fatalf("el lote se confirmó sin notificar: %d pendientes", e.Topic.Pendientes())
+	}
+	e.esperarSaldo(t, 10, monedaTest, "30.00", "0.00")
+
+	e.Webhook.Recuperar()
+	e.Topic.Esperar(t, plazoTest)
+	// el reintento no duplica la transferencia y se informa como tal
+	esperarNotificacion(t, e, "1", "F", "OK - Reintento")
+	e.esperarSaldo(t, 10, monedaTest, "30.00", "0.00")
+	if len(e.Webhook.Notificaciones()) != 1 {
+		t.Fatalf("se esperaba una sola notificación exitosa: %+v", e.Webhook.Notificaciones())
+	}
+	if reintentos := e.Topic.Reintentos(); len(reintentos) < 2 || reintentos[0].Estado != "REINTENTANDO" {
+		t.Fatalf("reintentos informados a la fuente: %+v", reintentos)
+	}
+}
+
+// GET /transferencias/estados: último resultado de cada transferencia, del más reciente al más antiguo. Una
+// transferencia finalizada conserva su primer registro; una con error se actualiza al reenviarla
+func TestEstadosTransferencias(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearMoneda(t, monedaTest)
+	e.crearCuenta(t, 10, monedaTest)
+
+	type respuestaEstados struct {
+		Total   int
+		Estados []models.EstadosTransferencias
+	}
+	buscar := func(t *testing.T, filtro string) respuestaEstados {
+		t.Helper()
+		var r respuestaEstados
+		if status := e.llamar(t, http.MethodGet, "/transferencias/estados"+filtro, nil, &r); status != http.StatusOK {
+			t.Fatalf("GET /transferencias/estados%s: status %d", filtro, status)
+		}
+		return r
+	}
+
+	e.procesar(t, ingreso(1, 10, monedaTest, 20))
+	e.procesar(t, egreso(2, 10, monedaTest, 25))
+	esperarNotificacion(t, e, "2", "E", "Saldo insuficiente en cuenta")
+
+	r := buscar(t, "")
+	if r.Total != 2 || r.Estados[0].IdTransferencia != "2" || r.Estados[1].IdTransferencia != "1" {
+		t.Fatalf("estados: %+v", r)
+	}
+	if s := r.Estados[1]; s.Estado != "F" || s.Mensaje != "OK" || s.IdCorrelacion != "e2e-0" || s.Tipo != "I" || s.IdUsuarioFinal != 10 || s.IdMoneda != monedaTest {
+		t.Fatalf("estado del ingreso: %+v", s)
+	}
+	if r := buscar(t, "?IdCorrelacion=e2e-1"); r.Total != 1 || r.Estados[0].IdTransferencia != "2" || r.Estados[0].Estado != "E" {
+		t.Fatalf("estados de e2e-1: %+v", r)
+	}
+
+	// el reintento del ingreso no cambia su registro; el egreso, reenviado con saldo, pasa a finalizado
+	e.procesar(t, ingreso(1, 10, monedaTest, 20), ingreso(3, 10, monedaTest, 10))
+	esperarNotificacion(t, e, "1", "F", "OK - Reintento")
+	e.procesar(t, egreso(2, 10, monedaTest, 25))
+	esperarNotificacion(t, e, "2", "F", "OK")
+
+	if r := buscar(t, "?IdTransferencia=1"); r.Total != 1 || r.Estados[0].Mensaje != "OK" || r.Estados[0].IdCorrelacion != "e2e-0" {
+		t.Fatalf("estado del ingreso reintentado: %+v", r)
+	}
+	if r := buscar(t, "?IdTransferencia=2"); r.Total != 1 || r.Estados[0].Estado != "F" || r.Estados[0].IdCorrelacion != "e2e-4" {
+		t.Fatalf("estado del egreso reenviado: %+v", r)
+	}
+	if r := buscar(t, "?Limite=2"); r.Total != 2 || r.Estados[0].IdTransferencia != "2" {
+		t.Fatalf("estados con Limite: %+v", r)
+	}
+	e.esperarStatus(t, http.MethodGet, "/transferencias/estados?Limite=1001", nil, http.StatusBadRequest)
+}
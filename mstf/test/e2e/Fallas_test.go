@@ -0,0 +1,126 @@
+package e2e
+
+import (
+	"net/http"
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/infra/fallas"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+)
+
+// Escenarios con fallas inyectadas: el motor reintenta el lote y TB responde TransferExists para lo que
+// ya registró, así que nada se duplica y toda transferencia se notifica.
+
+func (e *Entorno) inyectar(t *testing.T, destino string, regla fallas.Regla) {
+	t.Helper()
+	e.esperarStatus(t, http.MethodPut, "/admin/fallas/"+destino, regla, http.StatusOK)
+}
+
+// Verifica que la regla del destino se haya aplicado la cantidad de veces esperada
+func esperarInyectadas(t *testing.T, destino string, cantidad int) {
+	t.Helper()
+	if r := fallas.Reglas()[destino]; r.Inyectadas != cantidad {
+		t.Fatalf("fallas inyectadas en %s: %d, se esperaban %d", destino, r.Inyectadas, cantidad)
+	}
+}
+
+func TestRespuestaPerdidaDeTB(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearMoneda(t, monedaTest)
+	e.crearCuenta(t, 10, monedaTest)
+	e.procesar(t, ingreso(1, 10, monedaTest, 100))
+
+	// TB registra el lote pero la respuesta se pierde: el reintento no debe duplicar ni rechazar nada,
+	// aunque el egreso ya consumió el saldo que valida
+	e.inyectar(t, fallas.TigerBeetle, fallas.Regla{Modo: fallas.ModoRespuestaPerdida, Operaciones: []string{"CreateTransfers"}, Cantidad: 1})
+	e.procesar(t, ingreso(2, 10, monedaTest, 20), egreso(3, 10, monedaTest, 100))
+	esperarInyectadas(t, fallas.TigerBeetle, 1)
+
+	esperarNotificacion(t, e, "2", "F", "OK - Reintento")
+	esperarNotificacion(t, e, "3", "F", "OK - Reintento")
+	e.esperarSaldo(t, 10, monedaTest, "120.00", "100.00")
+	if reintentos := e.Topic.Reintentos(); len(reintentos) != 1 {
+		t.Fatalf("se esperaba un reintento del lote: %+v", reintentos)
+	}
+}
+
+func TestRespuestaPerdidaDeTBEnReversion(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearMoneda(t, monedaTest)
+	e.crearCuenta(t, 10, monedaTest)
+	e.procesar(t, ingreso(1, 10, monedaTest, 50))
+
+	// en el reintento la última transferencia de la cuenta ya es la reversión
+	e.inyectar(t, fallas.TigerBeetle, fallas.Regla{Modo: fallas.ModoRespuestaPerdida, Operaciones: []string{"CreateTransfers"}, Cantidad: 1})
+	e.procesar(t, reversion(1, 10, monedaTest))
+	esperarInyectadas(t, fallas.TigerBeetle, 1)
+
+	esperarNotificacion(t, e, idReversion(1), "F", "OK - Reintento")
+	e.esperarSaldo(t, 10, monedaTest, "50.00", "50.00")
+
+	// el intento que escribió la reversión no llegó a auditarla: la audita el reintento
+	revertidas, err := e.Repos.Auditoria.Buscar(t.Context(), repositorios.FiltroOperaciones{TipoOperacion: models.OperacionReversionTransferencia})
+	if err != nil || len(revertidas) != 1 {
+		t.Fatalf("auditoría RT: %+v %v", revertidas, err)
+	}
+}
+
+func TestErroresDeTB(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearMoneda(t, monedaTest)
+	e.crearCuenta(t, 10, monedaTest)
+
+	// las dos primeras consultas de cuentas fallan: el lote se reintenta sin llegar a registrarse
+	e.inyectar(t, fallas.TigerBeetle, fallas.Regla{Modo: fallas.ModoError, Operaciones: []string{"LookupAccounts"}, Cantidad: 2})
+	e.procesar(t, ingreso(1, 10, monedaTest, 40))
+	esperarInyectadas(t, fallas.TigerBeetle, 2)
+
+	esperarNotificacion(t, e, "1", "F", "OK")
+	e.esperarSaldo(t, 10, monedaTest, "40.00", "0.00")
+	if len(e.Webhook.Notificaciones()) != 1 {
+		t.Fatalf("se esperaba una sola notificación: %+v", e.Webhook.Notificaciones())
+	}
+}
+
+func TestRespuestaPerdidaDelWebhook(t *testing.T) {
+	e := nuevoEntorno(t)
+	e.crearMoneda(t, monedaTest)
+	e.crearCuenta(t, 10, monedaTest)
+
+	// el webhook recibe la notificación pero el MS no se entera: la vuelve a enviar como reintento
+	e.inyectar(t, fallas.Webhook, fallas.Regla{Modo: fallas.ModoRespuestaPerdida, Operaciones: []string{"POST"}, Cantidad: 1})
+	e.procesar(t, ingreso(1, 10, monedaTest, 15))
+	esperarInyectadas(t, fallas.Webhook, 1)
+
+	notificaciones := e.Webhook.Notificaciones()
+	if len(notificaciones) != 2 || notificaciones[0].Mensaje != "OK" || notificaciones[1].Mensaje != "OK - Reintento" {
+		t.Fatalf("notificaciones recibidas: %+v", notificaciones)
+	}
+	e.esperarSaldo(t, 10, monedaTest, "15.00", "0.00")
+}
+
+func TestAdministracionDeFallas(t *testing.T) {
+	e := nuevoEntorno(t)
+
+	e.esperarStatus(t, http.MethodPut, "/admin/fallas/redis", fallas.Regla{Modo: fallas.ModoError}, http.StatusBadRequest)
+	e.esperarStatus(t, http.MethodPut, "/admin/fallas/mysql", fallas.Regla{Modo: "explotar"}, http.StatusBadRequest)
+	e.esperarStatus(t, http.MethodPut, "/admin/fallas/mysql", fallas.Regla{Modo: fallas.ModoLatencia, Probabilidad: 2}, http.StatusBadRequest)
+	e.inyectar(t, fallas.MySQL, fallas.Regla{Modo: "timeout", Operaciones: []string{"tsp_dame_parametro"}, TimeoutMs: 100})
+
+	var respuesta struct {
+		Destinos []string
+		Reglas   map[string]fallas.Regla
+	}
+	if status := e.llamar(t, http.MethodGet, "/admin/fallas", nil, &respuesta); status != http.StatusOK {
+		t.Fatalf("GET /admin/fallas: status %d", status)
+	}
+	if len(respuesta.Destinos) != 3 || respuesta.Reglas[fallas.MySQL].Modo != fallas.ModoTimeout || respuesta.Reglas[fallas.MySQL].TimeoutMs != 100 {
+		t.Fatalf("reglas: %+v", respuesta)
+	}
+
+	e.esperarStatus(t, http.MethodDelete, "/admin/fallas/mysql", nil, http.StatusOK)
+	if len(fallas.Reglas()) != 0 {
+		t.Fatalf("la regla no se quitó: %+v", fallas.Reglas())
+	}
+}
@@ -0,0 +1,165 @@
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"MSTransaccionesFinancieras/internal/esquemas"
+	"MSTransaccionesFinancieras/internal/ingesta"
+	"MSTransaccionesFinancieras/internal/models"
+	"MSTransaccionesFinancieras/internal/repositorios"
+)
+
+// Topic en memoria que reemplaza a Kafka: los mensajes publicados se entregan al motor en lotes de hasta
+// KAFKABATCHSIZE, en orden y de a un lote por vez, con la semántica del consumidor: ProcesarConReintentos
+// bloquea hasta que el lote se procesa y recién entonces se confirma el offset.
+type FuenteMemoria struct {
+	motor      *ingesta.Motor
+	parametros repositorios.Parametros
+
+	mu          sync.Mutex
+	mensajes    []ingesta.Mensaje
+	confirmados int // offset confirmado: los mensajes anteriores ya se procesaron
+	reintentos  []ingesta.EstadoReintento
+
+	nuevos   chan struct{}
+	ctx      context.Context
+	cancelar context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+var _ ingesta.Fuente = (*FuenteMemoria)(nil)
+
+func NewFuenteMemoria(parametros repositorios.Parametros) *FuenteMemoria {
+	f := &FuenteMemoria{parametros: parametros, nuevos: make(chan struct{}, 1)}
+	f.ctx, f.cancelar = context.WithCancel(context.Background())
+	return f
+}
+
+func (f *FuenteMemoria) Nombre() string {
+	return "memoria"
+}
+
+func (f *FuenteMemoria) Start(motor *ingesta.Motor) {
+	f.motor = motor
+	f.wg.Add(1)
+	go f.loop()
+}
+
+// Espera el lote en curso; si ctx vence antes, lo cancela sin confirmar
+func (f *FuenteMemoria) Close(ctx context.Context) {
+	parar := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			f.cancelar()
+		case <-parar:
+		}
+	}()
+	close(f.nuevos)
+	f.wg.Wait()
+	close(parar)
+	f.cancelar()
+}
+
+// Publica las transferencias en el topic (JSON, sobre v2). El IdCorrelacion de cada mensaje es e2e-<offset>.
+// Retorna el offset del primer mensaje publicado.
+func (f *FuenteMemoria) Publicar(t *testing.T, transferencias ...models.KafkaTransferencias) int {
+	t.Helper()
+	f.mu.Lock()
+	primero := len(f.mensajes)
+	for _, tr := range transferencias {
+		valor, err := esquemas.CodificarJSON(tr)
+		if err != nil {
+			f.mu.Unlock()
+			t.Fatalf("no se pudo serializar la transferencia %s: %v", tr.IdTransferencia, err)
+		}
+		offset := len(f.mensajes)
+		f.mensajes = append(f.mensajes, ingesta.Mensaje{
+			Origen:      fmt.Sprintf("memoria:%d", offset),
+			Valor:       valor,
+			Formato:     esquemas.FormatoJSON,
+			Correlacion: fmt.Sprintf("e2e-%d", offset),
+		})
+	}
+	f.mu.Unlock()
+	f.avisar()
+	return primero
+}
+
+// Espera a que todos los mensajes publicados estén confirmados. Falla el test si no ocurre en plazo.
+func (f *FuenteMemoria) Esperar(t *testing.T, plazo time.Duration) {
+	t.Helper()
+	limite := time.Now().Add(plazo)
+	for f.Pendientes() > 0 {
+		if time.Now().After(limite) {
+			t.Fatalf("quedan %d mensajes sin confirmar después de %s", f.Pendientes(), plazo)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Mensajes publicados que todavía no se confirmaron
+func (f *FuenteMemoria) Pendientes() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.mensajes) - f.confirmados
+}
+
+// Intentos fallidos informados por el motor en todos los lotes
+func (f *FuenteMemoria) Reintentos() []ingesta.EstadoReintento {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]ingesta.EstadoReintento(nil), f.reintentos...)
+}
+
+func (f *FuenteMemoria) avisar() {
+	select {
+	case f.nuevos <- struct{}{}:
+	default:
+	}
+}
+
+func (f *FuenteMemoria) loop() {
+	defer f.wg.Done()
+	for range f.nuevos {
+		for f.ctx.Err() == nil {
+			lote, ok := f.siguienteLote()
+			if !ok {
+				break
+			}
+			if err := f.motor.ProcesarConReintentos(f.ctx, lote, f.alReintentar); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (f *FuenteMemoria) siguienteLote() (ingesta.Lote, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.confirmados == len(f.mensajes) {
+		return ingesta.Lote{}, false
+	}
+	fin := min(f.confirmados+ingesta.ObtenerTamanoLote(f.parametros), len(f.mensajes))
+	mensajes := append([]ingesta.Mensaje(nil), f.mensajes[f.confirmados:fin]...)
+	return ingesta.Lote{
+		Fuente:   f.Nombre(),
+		Mensajes: mensajes,
+		Confirmar: func(context.Context) error {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.confirmados = fin
+			return nil
+		},
+	}, true
+}
+
+func (f *FuenteMemoria) alReintentar(estado ingesta.EstadoReintento) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reintentos = append(f.reintentos, estado)
+}
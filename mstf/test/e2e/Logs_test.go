@@ -0,0 +1,51 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/infra/logs"
+)
+
+// El nivel de log de un subsistema se cambia en runtime con PUT /admin/logs/:subsistema
+func TestAdministracionDeLogs(t *testing.T) {
+	e := nuevoEntorno(t)
+	var buf bytes.Buffer
+	if err := logs.InitEn(&buf, "INFO"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = logs.InitEn(os.Stdout, "INFO") })
+
+	e.esperarStatus(t, http.MethodPut, "/admin/logs/kafka", map[string]string{"Nivel": "debug"}, http.StatusOK)
+	e.esperarStatus(t, http.MethodPut, "/admin/logs/ingesta", map[string]string{"Nivel": "TRACE"}, http.StatusBadRequest)
+	e.esperarStatus(t, http.MethodPut, "/admin/logs/redis", map[string]string{"Nivel": "DEBUG"}, http.StatusBadRequest)
+	e.esperarStatus(t, http.MethodPut, "/admin/logs/kafka", map[string]string{}, http.StatusBadRequest)
+
+	var respuesta struct {
+		Subsistemas []string
+		Niveles     map[string]string
+	}
+	if status := e.llamar(t, http.MethodGet, "/admin/logs", nil, &respuesta); status != http.StatusOK {
+		t.Fatalf("GET /admin/logs: status %d", status)
+	}
+	if len(respuesta.Subsistemas) != len(logs.Subsistemas()) || len(respuesta.Niveles) != len(respuesta.Subsistemas) {
+		t.Fatalf("subsistemas: %+v", respuesta)
+	}
+	for s, n := range respuesta.Niveles {
+		if (s == logs.Kafka && n != "DEBUG") || (s != logs.Kafka && n != "INFO") {
+			t.Fatalf("niveles: %v", respuesta.Niveles)
+		}
+	}
+
+	// el cambio aplica a los loggers ya creados, solo en el subsistema modificado
+	if !logs.L(logs.Kafka).Enabled(context.Background(), slog.LevelDebug) || logs.L(logs.Ingesta).Enabled(context.Background(), slog.LevelDebug) {
+		t.Fatal("el nivel DEBUG no quedó aplicado solo a kafka")
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"msg":"nivel de log modificado"`)) || !bytes.Contains(buf.Bytes(), []byte(`"actor":"SISTEMA"`)) {
+		t.Fatalf("el cambio de nivel no se registró con su actor:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,100 @@
+package e2e
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"MSTransaccionesFinancieras/internal/models"
+)
+
+// Webhook de prueba: registra cada lote notificado por el MS. Con Caer responde 503 a todas las
+// notificaciones (el MS las reintenta) hasta que se llame a Recuperar.
+type ReceptorWebhook struct {
+	*httptest.Server
+
+	mu               sync.Mutex
+	lotes            []models.LoteNotificado
+	intentosFallidos int
+	caido            bool
+}
+
+func nuevoReceptorWebhook(t *testing.T) *ReceptorWebhook {
+	t.Helper()
+	r := &ReceptorWebhook{}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.recibir))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *ReceptorWebhook) recibir(w http.ResponseWriter, req *http.Request) {
+	// HEAD: health check del notificador
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.caido {
+		r.intentosFallidos++
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var lote models.LoteNotificado
+	if err := json.NewDecoder(req.Body).Decode(&lote); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.lotes = append(r.lotes, lote)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *ReceptorWebhook) Caer() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.caido = true
+}
+
+func (r *ReceptorWebhook) Recuperar() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.caido = false
+}
+
+// Notificaciones rechazadas mientras el webhook estaba caído
+func (r *ReceptorWebhook) IntentosFallidos() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.intentosFallidos
+}
+
+// Lotes recibidos, en orden de llegada
+func (r *ReceptorWebhook) Lotes() []models.LoteNotificado {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]models.LoteNotificado(nil), r.lotes...)
+}
+
+// Notificaciones de todos los lotes recibidos, en orden de llegada
+func (r *ReceptorWebhook) Notificaciones() []models.TransferenciaNotificada {
+	var notificaciones []models.TransferenciaNotificada
+	for _, l := range r.Lotes() {
+		notificaciones = append(notificaciones, l.Transferencias...)
+	}
+	return notificaciones
+}
+
+// Última notificación recibida de la transferencia. Falla el test si no se notificó.
+func (r *ReceptorWebhook) Notificacion(t *testing.T, IdTransferencia string) models.TransferenciaNotificada {
+	t.Helper()
+	notificaciones := r.Notificaciones()
+	for i := len(notificaciones) - 1; i >= 0; i-- {
+		if notificaciones[i].IdTransferencia == IdTransferencia {
+			return notificaciones[i]
+		}
+	}
+	t.Fatalf("la transferencia %s no se notificó al webhook", IdTransferencia)
+	return models.TransferenciaNotificada{}
+}
@@ -12,7 +12,9 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -32,8 +34,35 @@ var (
 	totalTransfers   = flag.Int("transferencias", 100000, "Cantidad total de transferencias a simular")
 	dockerService    = flag.String("docker-service", "mstf", "Nombre del servicio del MS en docker-compose")
 	autoDocker       = flag.Bool("auto-docker", false, "Si es true, el script hará stop/start del contenedor automáticamente")
+	archivoEscenario = flag.String("escenario", "", "Archivo JSON con el escenario (monedas, cuentas y mezcla de transferencias). Sin archivo: solo ingresos de 100.50")
+	represa          = flag.Bool("represa", true, "Si es true, llena Kafka con el ms apagado y mide el drenado. Si es false, publica con el ms encendido")
+	timeout          = flag.Duration("timeout", 50*time.Minute, "Tiempo máximo de espera de las notificaciones")
 )
 
+// Escenario de carga. Los pesos de Mezcla son relativos (ej: 60/25/5/5/5).
+type Escenario struct {
+	Monedas          []int   `json:"Monedas"`
+	CuentasPorMoneda int     `json:"CuentasPorMoneda"`
+	Transferencias   int     `json:"Transferencias"`
+	Mezcla           Mezcla  `json:"Mezcla"`
+	MontoMin         float64 `json:"MontoMin"`
+	MontoMax         float64 `json:"MontoMax"`
+	Fecha            string  `json:"Fecha"`
+	// transferencias por segundo al publicar (solo sin represa). 0 = sin límite
+	TPS     int   `json:"TPS"`
+	Semilla int64 `json:"Semilla"`
+}
+
+type Mezcla struct {
+	Ingresos    int `json:"Ingresos"`
+	Egresos     int `json:"Egresos"`
+	Reversiones int `json:"Reversiones"`
+	// monto cero, cuenta inexistente o JSON malformado (en rotación)
+	Invalidas int `json:"Invalidas"`
+	// reenvío de un ingreso ya publicado (mismo IdTransferencia)
+	Duplicadas int `json:"Duplicadas"`
+}
+
 type ReqMoneda struct {
 	IdMoneda int `json:"IdMoneda"`
 }
@@ -55,8 +84,58 @@ type KafkaMsg struct {
 	Fecha           string  `json:"Fecha"`
 }
 
+// Estructura idem models.LoteNotificado
 type LoteWebhook struct {
-	CantidadProcesada int `json:"CantidadProcesada"`
+	CantidadProcesada int                   `json:"CantidadProcesada"`
+	Transferencias    []NotificacionWebhook `json:"Transferencias"`
+}
+
+type NotificacionWebhook struct {
+	IdTransferencia string `json:"IdTransferencia"`
+	Estado          string `json:"Estado"`
+	Mensaje         string `json:"Mensaje"`
+	IdCorrelacion   string `json:"IdCorrelacion"`
+}
+
+// Clases de operación del escenario
+const (
+	claseIngreso   = "I"
+	claseEgreso    = "E"
+	claseReversion = "R"
+	claseInvalida  = "INVALIDA"
+	claseDuplicada = "DUPLICADA"
+)
+
+// Cuenta de usuario (IdUsuarioFinal 0: cuenta empresa de la moneda)
+type Cuenta struct {
+	IdMoneda       uint32
+	IdUsuarioFinal uint64
+}
+
+// Saldo en centavos
+type Saldo struct {
+	Creditos uint64
+	Debitos  uint64
+}
+
+// Transferencia publicada. Cada una lleva su propio IdCorrelacion, que el MS devuelve en el webhook.
+type Operacion struct {
+	Clase       string
+	Cuenta      Cuenta
+	Centavos    uint64
+	Correlacion string
+	Valor       []byte
+	// transferencia revertida (R) o reenviada (DUPLICADA)
+	Original  *Operacion
+	IdTransf  string
+	Publicada time.Time
+}
+
+// Resultado recibido en el webhook para una operación (la última notificación, si hubo reintentos)
+type Resultado struct {
+	Estado  string
+	Mensaje string
+	Llegada time.Time // primera notificación
 }
 
 var (
@@ -65,69 +144,252 @@ var (
 	finTimer    time.Time
 	primerLote  sync.Once
 	doneChan    = make(chan bool)
+
+	// IdCorrelacion de las operaciones de esta corrida: se ignoran las notificaciones de otros mensajes del topic
+	correlaciones map[string]bool
+	muResultados  sync.Mutex
+	resultados    = make(map[string]*Resultado)
 )
 
 func main() {
 	flag.Parse()
 
 	log.Println("=== INICIANDO TEST DE ESTRÉS ===")
+	esc := cargarEscenario()
 
 	// FASE 1: SETUP
 	log.Println("\n1) El ms DEBE estar encendido...")
-	paresCuentas := setupDatos()
+	cuentas := setupDatos(esc)
 
-	if len(paresCuentas) == 0 {
+	if len(cuentas) == 0 {
 		log.Fatal("No se pudieron crear cuentas válidas para la prueba.")
 	}
+	// saldos antes de la prueba: la base puede tener transferencias de corridas anteriores
+	saldosIniciales := leerSaldos(cuentas, esc.Monedas)
+	operaciones := generarOperaciones(esc, cuentas, saldosIniciales)
+	correlaciones = make(map[string]bool, len(operaciones))
+	for _, op := range operaciones {
+		correlaciones[op.Correlacion] = true
+	}
 
-	// FASE 2: DETENCIÓN Y LLENADO (LA REPRESA)
-	log.Println("\n2) Llenado de kafka (apagar ms)...")
-	manejarDocker("stop")
-
-	llenarKafka(paresCuentas)
-
-	// FASE 3: MEDICIÓN (APERTURA DE COMPUERTAS)
-	log.Println("\n3) Levantar webhook (levantar de nuevo el ms)...")
 	go iniciarServidorWebhook()
-
 	// Pequeña pausa para asegurar que el server levantó
 	time.Sleep(1 * time.Second)
-	manejarDocker("start")
 
-	log.Println("Esperando procesamiento de", *totalTransfers, "transferencias...")
+	if *represa {
+		// FASE 2: DETENCIÓN Y LLENADO (LA REPRESA)
+		log.Println("\n2) Llenado de kafka (apagar ms)...")
+		manejarDocker("stop")
+		llenarKafka(operaciones, 0)
+
+		// FASE 3: MEDICIÓN (APERTURA DE COMPUERTAS)
+		log.Println("\n3) Levantar de nuevo el ms...")
+		manejarDocker("start")
+	} else {
+		log.Println("\n2) Publicando con el ms encendido...")
+		// el timer arranca con la publicación, no con el primer webhook
+		primerLote.Do(func() { inicioTimer = time.Now() })
+		llenarKafka(operaciones, esc.TPS)
+	}
+
+	log.Println("Esperando procesamiento de", len(operaciones), "transferencias...")
 
-	// Timeout de seguridad de 20 minutos
 	select {
 	case <-doneChan:
-		calcularResultados()
-	case <-time.After(50 * time.Minute):
-		log.Println("TIMEOUT: Pasaron 50 minutos y no se completaron todas las transferencias.")
-		calcularResultados()
+	case <-time.After(*timeout):
+		log.Printf("TIMEOUT: Pasaron %s y no se completaron todas las transferencias.", *timeout)
+		finTimer = time.Now()
+	}
+
+	// FASE 4: VERIFICACIÓN
+	log.Println("\n4) Verificando saldos en TigerBeetle y resultados del webhook...")
+	muResultados.Lock()
+	modelo, discrepancias := verificar(operaciones, resultados, saldosIniciales)
+	muResultados.Unlock()
+	discrepancias = append(discrepancias, compararSaldos(modelo, leerSaldos(cuentas, esc.Monedas))...)
+	calcularResultados(operaciones, discrepancias)
+}
+
+// --- ESCENARIO ---
+
+func cargarEscenario() Escenario {
+	// sin archivo: el test original (solo ingresos de 100.50), configurable por flags
+	esc := Escenario{
+		CuentasPorMoneda: *cuentasPorMoneda,
+		Transferencias:   *totalTransfers,
+		Mezcla:           Mezcla{Ingresos: 1},
+		MontoMin:         100.50,
+		MontoMax:         100.50,
+		Fecha:            "2026-03-11",
+		Semilla:          time.Now().UnixNano(),
+	}
+	for i := 1; i <= *numMonedas; i++ {
+		esc.Monedas = append(esc.Monedas, i)
+	}
+	if *archivoEscenario == "" {
+		return esc
+	}
+	contenido, err := os.ReadFile(*archivoEscenario)
+	if err != nil {
+		log.Fatalf("No se pudo leer el escenario: %v", err)
+	}
+	if err := json.Unmarshal(contenido, &esc); err != nil {
+		log.Fatalf("Escenario inválido: %v", err)
+	}
+	m := esc.Mezcla
+	if len(esc.Monedas) == 0 || esc.CuentasPorMoneda <= 0 || esc.Transferencias <= 0 || m.Ingresos+m.Egresos+m.Reversiones+m.Invalidas+m.Duplicadas <= 0 {
+		log.Fatal("Escenario inválido: se requieren Monedas, CuentasPorMoneda, Transferencias y una Mezcla con algún peso")
+	}
+	if esc.MontoMin <= 0 || esc.MontoMax < esc.MontoMin {
+		log.Fatal("Escenario inválido: se requiere 0 < MontoMin <= MontoMax")
 	}
+	log.Printf("Escenario %s: %d monedas, %d cuentas por moneda, %d transferencias, mezcla %+v", *archivoEscenario, len(esc.Monedas), esc.CuentasPorMoneda, esc.Transferencias, m)
+	return esc
+}
+
+// Arma las transferencias del escenario. Lleva un saldo optimista por cuenta (como si todas se aceptaran)
+// para que la mayoría de los egresos tengan fondos; el resultado real lo decide el MS y se verifica después.
+func generarOperaciones(esc Escenario, cuentas []Cuenta, saldos map[Cuenta]Saldo) []*Operacion {
+	r := rand.New(rand.NewSource(esc.Semilla))
+	minimo, maximo := aCentavos(esc.MontoMin), aCentavos(esc.MontoMax)
+	// IDs < 2^64: la reversión enciende el bit 64 del Id original
+	base := uint64(time.Now().Unix()) * 10_000_000
+	prefijoCorrelacion := strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	optimista := make(map[Cuenta]int64, len(cuentas))
+	for _, c := range cuentas {
+		optimista[c] = int64(saldos[c].Creditos) - int64(saldos[c].Debitos)
+	}
+	// última transferencia revertible de cada cuenta
+	ultima := make(map[Cuenta]*Operacion)
+	var conUltima []Cuenta
+	var ingresos []*Operacion
+	invalidas := 0
+
+	pesos := []int{esc.Mezcla.Ingresos, esc.Mezcla.Egresos, esc.Mezcla.Reversiones, esc.Mezcla.Invalidas, esc.Mezcla.Duplicadas}
+	clases := []string{claseIngreso, claseEgreso, claseReversion, claseInvalida, claseDuplicada}
+	total := 0
+	for _, p := range pesos {
+		total += p
+	}
+	elegirClase := func() string {
+		n := r.Intn(total)
+		for i, p := range pesos {
+			if n < p {
+				return clases[i]
+			}
+			n -= p
+		}
+		return claseIngreso
+	}
+	monto := func(limite int64) uint64 {
+		hasta := maximo
+		if limite >= int64(minimo) && uint64(limite) < hasta {
+			hasta = uint64(limite)
+		}
+		return minimo + uint64(r.Int63n(int64(hasta-minimo)+1))
+	}
+
+	operaciones := make([]*Operacion, 0, esc.Transferencias)
+	for i := 0; i < esc.Transferencias; i++ {
+		op := &Operacion{Clase: elegirClase(), Cuenta: cuentas[r.Intn(len(cuentas))], Correlacion: fmt.Sprintf("stress-%s-%d", prefijoCorrelacion, i)}
+		// sin transferencias previas para revertir o reenviar: ingreso
+		if op.Clase == claseReversion && len(conUltima) == 0 || op.Clase == claseDuplicada && len(ingresos) == 0 {
+			op.Clase = claseIngreso
+		}
+		msg := KafkaMsg{IdTransferencia: strconv.FormatUint(base+uint64(i), 10), IdCategoria: 1, Fecha: esc.Fecha}
+
+		switch op.Clase {
+		case claseIngreso:
+			op.Centavos = monto(-1)
+			optimista[op.Cuenta] += int64(op.Centavos)
+			ingresos = append(ingresos, op)
+		case claseEgreso:
+			op.Centavos = monto(optimista[op.Cuenta])
+			if int64(op.Centavos) <= optimista[op.Cuenta] {
+				optimista[op.Cuenta] -= int64(op.Centavos)
+			}
+		case claseReversion:
+			j := r.Intn(len(conUltima))
+			op.Cuenta = conUltima[j]
+			conUltima = slices.Delete(conUltima, j, j+1)
+			op.Original = ultima[op.Cuenta]
+			delete(ultima, op.Cuenta)
+			op.Centavos = op.Original.Centavos
+			msg.IdTransferencia = op.Original.IdTransf
+			if op.Original.Clase == claseIngreso {
+				optimista[op.Cuenta] -= int64(op.Centavos)
+			} else {
+				optimista[op.Cuenta] += int64(op.Centavos)
+			}
+		case claseDuplicada:
+			op.Original = ingresos[r.Intn(len(ingresos))]
+			op.Cuenta = op.Original.Cuenta
+			op.Centavos = op.Original.Centavos
+			msg.IdTransferencia = op.Original.IdTransf
+		case claseInvalida:
+			op.Centavos = monto(-1)
+			switch invalidas % 3 {
+			case 0:
+				op.Centavos = 0
+			case 1:
+				op.Cuenta.IdUsuarioFinal = 900_000_000 + uint64(i)
+			}
+		}
+
+		msg.IdUsuarioFinal = op.Cuenta.IdUsuarioFinal
+		msg.IdMoneda = op.Cuenta.IdMoneda
+		msg.Monto = float64(op.Centavos) / 100
+		msg.Tipo = op.Clase
+		switch op.Clase {
+		case claseDuplicada:
+			msg.Tipo = claseIngreso
+		case claseInvalida:
+			msg.Tipo = claseIngreso
+		}
+		op.IdTransf = msg.IdTransferencia
+		op.Valor, _ = json.Marshal(msg)
+		if op.Clase == claseInvalida {
+			if invalidas%3 == 2 {
+				op.Valor = op.Valor[:len(op.Valor)/2]
+			}
+			invalidas++
+		}
+
+		// solo se revierte la última transferencia de la cuenta
+		if op.Clase == claseIngreso || op.Clase == claseEgreso {
+			if _, ok := ultima[op.Cuenta]; !ok {
+				conUltima = append(conUltima, op.Cuenta)
+			}
+			ultima[op.Cuenta] = op
+		}
+		operaciones = append(operaciones, op)
+	}
+	return operaciones
 }
 
 // --- FUNCIONES DE FASE 1 (API) ---
 
-func setupDatos() []ReqCuenta {
+func setupDatos(esc Escenario) []Cuenta {
 	client := &http.Client{Timeout: 5 * time.Second}
-	var cuentasValidas []ReqCuenta
+	var cuentasValidas []Cuenta
 
-	for i := 1; i <= *numMonedas; i++ {
+	for _, idMoneda := range esc.Monedas {
 		// Crear Moneda
-		reqMoneda := ReqMoneda{IdMoneda: i}
+		reqMoneda := ReqMoneda{IdMoneda: idMoneda}
 		enviarPOST(client, *apiURL+"/monedas", reqMoneda)
 
 		// Crear Cuentas
-		for j := 1; j <= *cuentasPorMoneda; j++ {
+		for j := 1; j <= esc.CuentasPorMoneda; j++ {
 			reqCuenta := ReqCuenta{
 				IdUsuarioFinal: uint64(j),
-				IdMoneda:       uint32(i),
+				IdMoneda:       uint32(idMoneda),
 				Fecha:          "2026-03-11",
 			}
 			status := enviarPOST(client, *apiURL+"/cuentas", reqCuenta)
 			// Si devuelve 201 (Creado) o 200 (Ya existía), la consideramos válida para la prueba
 			if status == http.StatusCreated || status == http.StatusOK {
-				cuentasValidas = append(cuentasValidas, reqCuenta)
+				cuentasValidas = append(cuentasValidas, Cuenta{IdMoneda: reqCuenta.IdMoneda, IdUsuarioFinal: reqCuenta.IdUsuarioFinal})
 			}
 		}
 	}
@@ -137,14 +399,21 @@ func setupDatos() []ReqCuenta {
 
 func enviarPOST(client *http.Client, url string, payload interface{}) int {
 	jsonData, _ := json.Marshal(payload)
-	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-API-Key", *apiKey)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("Error conectando a %s: %v", url, err)
-		return 0
+	var resp *http.Response
+	for {
+		req, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", *apiKey)
+
+		var err error
+		resp, err = client.Do(req)
+		if err != nil {
+			log.Printf("Error conectando a %s: %v", url, err)
+			return 0
+		}
+		if !esperarLimite(resp) {
+			break
+		}
 	}
 	defer resp.Body.Close()
 
@@ -155,6 +424,54 @@ func enviarPOST(client *http.Client, url string, payload interface{}) int {
 	return resp.StatusCode
 }
 
+// Saldos de las cuentas de usuario y de las cuentas empresa leídos de TigerBeetle (GET /cuentas)
+func leerSaldos(cuentas []Cuenta, monedas []int) map[Cuenta]Saldo {
+	client := &http.Client{Timeout: 5 * time.Second}
+	todas := append([]Cuenta(nil), cuentas...)
+	for _, m := range monedas {
+		todas = append(todas, Cuenta{IdMoneda: uint32(m)})
+	}
+	saldos := make(map[Cuenta]Saldo, len(todas))
+	for i := 0; i < len(todas); i++ {
+		c := todas[i]
+		req, _ := http.NewRequest("GET", fmt.Sprintf("%s/cuentas/%d/%d", *apiURL, c.IdUsuarioFinal, c.IdMoneda), nil)
+		req.Header.Set("X-API-Key", *apiKey)
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Fatalf("Error leyendo la cuenta %d/%d: %v", c.IdUsuarioFinal, c.IdMoneda, err)
+		}
+		if esperarLimite(resp) {
+			i--
+			continue
+		}
+		var cuenta struct {
+			Creditos string
+			Debitos  string
+		}
+		err = json.NewDecoder(resp.Body).Decode(&cuenta)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			log.Fatalf("Error leyendo la cuenta %d/%d [%d]: %v", c.IdUsuarioFinal, c.IdMoneda, resp.StatusCode, err)
+		}
+		saldos[c] = Saldo{Creditos: decimalACentavos(cuenta.Creditos), Debitos: decimalACentavos(cuenta.Debitos)}
+	}
+	return saldos
+}
+
+// Si el MS respondió 429 (límite de tasa) cierra la respuesta, espera lo que indica Retry-After y devuelve true
+func esperarLimite(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return false
+	}
+	resp.Body.Close()
+	segundos, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || segundos < 1 {
+		segundos = 1
+	}
+	time.Sleep(time.Duration(segundos) * time.Second)
+	return true
+}
+
 // FUNC AUX P DOCKER
 
 func manejarDocker(accion string) {
@@ -176,7 +493,9 @@ func manejarDocker(accion string) {
 }
 
 // FUNCIONES P LA SEGUNDA PARTE (KAFKA)
-func llenarKafka(cuentas []ReqCuenta) {
+
+// Publica las operaciones en lotes de 500. tps > 0 limita la tasa de publicación.
+func llenarKafka(operaciones []*Operacion, tps int) {
 	log.Println("Verificando conexión con Kafka en", *kafkaBroker, "...")
 	conn, err := kafka.Dial("tcp", *kafkaBroker)
 	if err != nil {
@@ -185,58 +504,59 @@ func llenarKafka(cuentas []ReqCuenta) {
 	conn.Close()
 	log.Println("Kafka responde correctamente. Preparando test...")
 
+	// la key es la cuenta y el balancer por hash: las transferencias de una cuenta conservan su orden,
+	// del que depende el modelo de saldos
 	writer := &kafka.Writer{
 		Addr:                   kafka.TCP(*kafkaBroker),
 		Topic:                  *kafkaTopic,
+		Balancer:               &kafka.Hash{},
 		AllowAutoTopicCreation: true,
 	}
 	defer writer.Close()
 
-	var mensajes []kafka.Message
-
-	for i := 1; i <= *totalTransfers; i++ {
-		cuenta := cuentas[rand.Intn(len(cuentas))]
-
-		msg := KafkaMsg{
-			IdTransferencia: strconv.FormatInt(time.Now().UnixNano(), 10) + strconv.Itoa(i),
-			IdUsuarioFinal:  cuenta.IdUsuarioFinal,
-			Monto:           100.50,
-			IdMoneda:        cuenta.IdMoneda,
-			Tipo:            "I",
-			IdCategoria:     1,
-			Fecha:           "2026-03-11",
+	tamanoLote := 500
+	if tps > 0 && tps < tamanoLote {
+		tamanoLote = tps
+	}
+	inicio := time.Now()
+	for desde := 0; desde < len(operaciones); desde += tamanoLote {
+		hasta := min(desde+tamanoLote, len(operaciones))
+		if tps > 0 {
+			// ritmo: el lote sale cuando corresponde según la tasa pedida
+			if espera := time.Until(inicio.Add(time.Duration(float64(desde) / float64(tps) * float64(time.Second)))); espera > 0 {
+				time.Sleep(espera)
+			}
+		}
+		mensajes := make([]kafka.Message, 0, hasta-desde)
+		for _, op := range operaciones[desde:hasta] {
+			mensajes = append(mensajes, kafka.Message{
+				Key:     []byte(fmt.Sprintf("%d-%d", op.Cuenta.IdMoneda, op.Cuenta.IdUsuarioFinal)),
+				Value:   op.Valor,
+				Headers: []kafka.Header{{Key: "mstf-correlacion", Value: []byte(op.Correlacion)}},
+			})
 		}
 
-		b, _ := json.Marshal(msg)
-		mensajes = append(mensajes, kafka.Message{Value: b})
-
-		// Publicar en lotes de 500
-		if i%500 == 0 {
-			var errWrite error
-			//Reintenta hasta 5 veces si Kafka corta la conexión
-			for intentos := 1; intentos <= 5; intentos++ {
-				errWrite = writer.WriteMessages(context.Background(), mensajes...)
-				if errWrite == nil {
-					break
+		var errWrite error
+		//Reintenta hasta 5 veces si Kafka corta la conexión
+		for intentos := 1; intentos <= 5; intentos++ {
+			publicada := time.Now()
+			errWrite = writer.WriteMessages(context.Background(), mensajes...)
+			if errWrite == nil {
+				for _, op := range operaciones[desde:hasta] {
+					op.Publicada = publicada
 				}
-				log.Printf("Aviso: Corte en Kafka (EOF) - Intento %d/5. Reintentando en 1s...", intentos)
-				time.Sleep(1 * time.Second)
-			}
-
-			if errWrite != nil {
-				log.Fatalf("\nError fatal escribiendo en Kafka tras 5 intentos: %v", errWrite)
+				break
 			}
-
-			mensajes = nil // Limpiar buffer
-			fmt.Printf("\rEnviados: %d / %d", i, *totalTransfers)
+			log.Printf("Aviso: Corte en Kafka (EOF) - Intento %d/5. Reintentando en 1s...", intentos)
+			time.Sleep(1 * time.Second)
 		}
-	}
 
-	// Enviar el remanente si la cantidad no es múltiplo de 500
-	if len(mensajes) > 0 {
-		_ = writer.WriteMessages(context.Background(), mensajes...)
+		if errWrite != nil {
+			log.Fatalf("\nError fatal escribiendo en Kafka tras 5 intentos: %v", errWrite)
+		}
+		fmt.Printf("\rEnviados: %d / %d", hasta, len(operaciones))
 	}
-	fmt.Printf("\rEnviados: %d / %d\n", *totalTransfers, *totalTransfers)
+	fmt.Println()
 }
 
 //FUNCIONES DE 3ERA PARTE (WEBHOOK )
@@ -255,13 +575,28 @@ func iniciarServidorWebhook() {
 			inicioTimer = time.Now()
 			log.Println("Recibido 1er batch. Inicia timer...")
 		})
+		procesadas.Add(int64(lote.CantidadProcesada))
 
-		actual := procesadas.Add(int64(lote.CantidadProcesada))
+		llegada := time.Now()
+		muResultados.Lock()
+		for _, n := range lote.Transferencias {
+			if !correlaciones[n.IdCorrelacion] {
+				continue
+			}
+			res, ok := resultados[n.IdCorrelacion]
+			if !ok {
+				res = &Resultado{Llegada: llegada}
+				resultados[n.IdCorrelacion] = res
+			}
+			res.Estado, res.Mensaje = n.Estado, n.Mensaje
+		}
+		completas := len(resultados) >= len(correlaciones)
+		muResultados.Unlock()
 
 		w.WriteHeader(http.StatusOK)
 
-		if actual >= int64(*totalTransfers) {
-			finTimer = time.Now()
+		if completas {
+			finTimer = llegada
 			select {
 			case doneChan <- true:
 			default:
@@ -273,19 +608,196 @@ func iniciarServidorWebhook() {
 	log.Fatal(http.ListenAndServe(":"+*webhookPort, nil))
 }
 
-func calcularResultados() {
+// --- FUNCIONES DE VERIFICACIÓN ---
+
+// Rechazos que dependen de cómo el MS armó los lotes y no son errores: la validación de saldo no cuenta los
+// créditos del mismo lote, y una reversión no encuentra su original si ésta viene en el mismo lote.
+var rechazosPorLote = map[string]bool{
+	"Saldo insuficiente en cuenta":          true,
+	"TransferExceedsCredits":                true,
+	"No existe la transferencia a revertir": true,
+}
+
+// Recorre las operaciones en el orden en que se publicaron (el MS conserva el orden por cuenta) y compara el
+// resultado de cada una en el webhook con el esperado según el saldo del modelo, que se actualiza con las
+// aceptadas. Retorna el saldo final esperado de cada cuenta (incluidas las cuentas empresa) y las discrepancias.
+func verificar(operaciones []*Operacion, resultados map[string]*Resultado, iniciales map[Cuenta]Saldo) (map[Cuenta]Saldo, []string) {
+	modelo := make(map[Cuenta]Saldo, len(iniciales))
+	for c, s := range iniciales {
+		modelo[c] = s
+	}
+	aceptadas := make(map[*Operacion]bool)
+	var discrepancias []string
+	discrepancia := func(op *Operacion, formato string, args ...any) {
+		discrepancias = append(discrepancias, fmt.Sprintf("%s %s (cuenta %d/%d, correlación %s): ", op.Clase, op.IdTransf, op.Cuenta.IdUsuarioFinal, op.Cuenta.IdMoneda, op.Correlacion)+fmt.Sprintf(formato, args...))
+	}
+	// mueve el monto de debito a credito en el modelo
+	mover := func(debito Cuenta, credito Cuenta, centavos uint64) {
+		d := modelo[debito]
+		d.Debitos += centavos
+		modelo[debito] = d
+		c := modelo[credito]
+		c.Creditos += centavos
+		modelo[credito] = c
+	}
+
+	for _, op := range operaciones {
+		res, ok := resultados[op.Correlacion]
+		if !ok {
+			discrepancia(op, "sin notificación en el webhook")
+			continue
+		}
+		empresa := Cuenta{IdMoneda: op.Cuenta.IdMoneda}
+		s := modelo[op.Cuenta]
+		disponible := int64(s.Creditos) - int64(s.Debitos)
+
+		switch op.Clase {
+		case claseInvalida:
+			if res.Estado != "E" {
+				discrepancia(op, "una transferencia inválida se aceptó (%s %q)", res.Estado, res.Mensaje)
+			}
+		case claseIngreso:
+			if res.Estado != "F" {
+				discrepancia(op, "ingreso rechazado: %q", res.Mensaje)
+				continue
+			}
+			mover(empresa, op.Cuenta, op.Centavos)
+			aceptadas[op] = true
+		case claseDuplicada:
+			if res.Estado != "F" {
+				discrepancia(op, "reenvío de un ingreso rechazado: %q", res.Mensaje)
+			} else if !aceptadas[op.Original] {
+				discrepancia(op, "reenvío aceptado de un ingreso que no se registró")
+			}
+		case claseEgreso:
+			if res.Estado == "F" {
+				if disponible < int64(op.Centavos) {
+					discrepancia(op, "egreso aceptado sin saldo: disponible %d, monto %d", disponible, op.Centavos)
+				}
+				mover(op.Cuenta, empresa, op.Centavos)
+				aceptadas[op] = true
+			} else if !rechazosPorLote[res.Mensaje] {
+				discrepancia(op, "egreso rechazado: %q", res.Mensaje)
+			}
+		case claseReversion:
+			if !aceptadas[op.Original] {
+				if res.Estado == "F" {
+					discrepancia(op, "reversión aceptada de una transferencia que no se registró")
+				}
+				continue
+			}
+			if res.Estado != "F" {
+				if !rechazosPorLote[res.Mensaje] {
+					discrepancia(op, "reversión rechazada: %q", res.Mensaje)
+				}
+				continue
+			}
+			if op.Original.Clase == claseIngreso {
+				if disponible < int64(op.Centavos) {
+					discrepancia(op, "reversión de ingreso aceptada sin saldo: disponible %d, monto %d", disponible, op.Centavos)
+				}
+				mover(op.Cuenta, empresa, op.Centavos)
+			} else {
+				mover(empresa, op.Cuenta, op.Centavos)
+			}
+			aceptadas[op] = true
+		}
+	}
+	return modelo, discrepancias
+}
+
+// Compara los saldos leídos de TigerBeetle con los del modelo
+func compararSaldos(modelo map[Cuenta]Saldo, reales map[Cuenta]Saldo) []string {
+	var discrepancias []string
+	for c, esperado := range modelo {
+		real := reales[c]
+		if real != esperado {
+			discrepancias = append(discrepancias, fmt.Sprintf("cuenta %d/%d: TB créditos %s débitos %s, el modelo espera %s / %s", c.IdUsuarioFinal, c.IdMoneda,
+				centavosADecimal(real.Creditos), centavosADecimal(real.Debitos), centavosADecimal(esperado.Creditos), centavosADecimal(esperado.Debitos)))
+		}
+	}
+	slices.Sort(discrepancias)
+	return discrepancias
+}
+
+func calcularResultados(operaciones []*Operacion, discrepancias []string) {
 	total := procesadas.Load()
 	duracion := finTimer.Sub(inicioTimer)
 	segundos := duracion.Seconds()
 	tps := float64(total) / segundos
 
+	// latencia de cada operación: publicación en Kafka -> primera notificación en el webhook
+	porClase := make(map[string]int)
+	var latencias []time.Duration
+	rechazadas := 0
+	muResultados.Lock()
+	for _, op := range operaciones {
+		porClase[op.Clase]++
+		if res, ok := resultados[op.Correlacion]; ok {
+			latencias = append(latencias, res.Llegada.Sub(op.Publicada))
+			if res.Estado == "E" {
+				rechazadas++
+			}
+		}
+	}
+	muResultados.Unlock()
+	slices.Sort(latencias)
+
 	fmt.Println("\n==================================================")
 	fmt.Println("             RESULTADOS DEL TEST              ")
 	fmt.Println("==================================================")
-	fmt.Printf("Total esperado:       %d\n", *totalTransfers)
+	fmt.Printf("Total esperado:       %d\n", len(operaciones))
 	fmt.Printf("Total procesado:      %d\n", total)
+	fmt.Printf("Notificadas:          %d (%d rechazadas)\n", len(latencias), rechazadas)
+	fmt.Printf("Mezcla:               I %d / E %d / R %d / inválidas %d / duplicadas %d\n",
+		porClase[claseIngreso], porClase[claseEgreso], porClase[claseReversion], porClase[claseInvalida], porClase[claseDuplicada])
 	fmt.Printf("Tiempo total:         %.3f segundos\n", segundos)
 	fmt.Printf("THROUGHPUT OBTENIDO:  %.2f TPS (Transacciones/seg)\n", tps)
+	if len(latencias) > 0 {
+		fmt.Printf("Latencia Kafka->webhook: p50 %s | p90 %s | p99 %s | máx %s\n",
+			percentil(latencias, 50), percentil(latencias, 90), percentil(latencias, 99), latencias[len(latencias)-1])
+		if *represa {
+			fmt.Println("  (con represa la latencia incluye el tiempo que el ms estuvo apagado)")
+		}
+	}
+	fmt.Println("--------------------------------------------------")
+	if len(discrepancias) == 0 {
+		fmt.Println("VERIFICACIÓN OK: saldos y resultados coinciden con el modelo")
+		fmt.Println("==================================================")
+		os.Exit(0)
+	}
+	fmt.Printf("DISCREPANCIAS:        %d\n", len(discrepancias))
+	for i, d := range discrepancias {
+		if i == 50 {
+			fmt.Printf("  ... y %d más\n", len(discrepancias)-i)
+			break
+		}
+		fmt.Println("  " + d)
+	}
 	fmt.Println("==================================================")
-	os.Exit(0)
+	os.Exit(1)
+}
+
+// --- AUX ---
+
+// p-ésimo percentil de latencias ordenadas
+func percentil(latencias []time.Duration, p int) time.Duration {
+	i := (len(latencias)*p + 99) / 100
+	return latencias[max(i-1, 0)].Round(time.Microsecond)
+}
+
+func aCentavos(monto float64) uint64 {
+	return uint64(monto*100 + 0.5)
+}
+
+// "123.45" -> 12345
+func decimalACentavos(s string) uint64 {
+	entera, decimales, _ := strings.Cut(s, ".")
+	decimales = (decimales + "00")[:2]
+	n, _ := strconv.ParseUint(entera+decimales, 10, 64)
+	return n
+}
+
+func centavosADecimal(c uint64) string {
+	return fmt.Sprintf("%d.%02d", c/100, c%100)
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func operacion(clase string, cuenta Cuenta, centavos uint64, original *Operacion) *Operacion {
+	op := &Operacion{Clase: clase, Cuenta: cuenta, Centavos: centavos, Original: original}
+	op.Correlacion = "c" + strconv.Itoa(int(centavos)) + clase
+	return op
+}
+
+func TestVerificarModeloDeSaldos(t *testing.T) {
+	cuenta := Cuenta{IdMoneda: 1, IdUsuarioFinal: 7}
+	empresa := Cuenta{IdMoneda: 1}
+	iniciales := map[Cuenta]Saldo{cuenta: {Creditos: 1000}, empresa: {}}
+
+	ingreso := operacion(claseIngreso, cuenta, 500, nil)
+	egreso := operacion(claseEgreso, cuenta, 1200, nil)
+	sinFondos := operacion(claseEgreso, cuenta, 5000, nil)
+	conservador := operacion(claseEgreso, cuenta, 100, nil)
+	duplicada := operacion(claseDuplicada, cuenta, 500, ingreso)
+	duplicada.Correlacion = "dup"
+	reversion := operacion(claseReversion, cuenta, 1200, egreso)
+	invalida := operacion(claseInvalida, Cuenta{IdMoneda: 1, IdUsuarioFinal: 999}, 1, nil)
+	operaciones := []*Operacion{ingreso, egreso, sinFondos, conservador, duplicada, reversion, invalida}
+
+	resultados := map[string]*Resultado{
+		ingreso.Correlacion:     {Estado: "F", Mensaje: "OK"},
+		egreso.Correlacion:      {Estado: "F", Mensaje: "OK"},
+		sinFondos.Correlacion:   {Estado: "E", Mensaje: "Saldo insuficiente en cuenta"},
+		conservador.Correlacion: {Estado: "E", Mensaje: "Saldo insuficiente en cuenta"},
+		duplicada.Correlacion:   {Estado: "F", Mensaje: "OK - Reintento"},
+		reversion.Correlacion:   {Estado: "F", Mensaje: "OK"},
+		invalida.Correlacion:    {Estado: "E", Mensaje: "Cuenta no encontrada"},
+	}
+	modelo, discrepancias := verificar(operaciones, resultados, iniciales)
+	if len(discrepancias) != 0 {
+		t.Fatalf("discrepancias inesperadas: %v", discrepancias)
+	}
+	// 10.00 iniciales + 5.00 de ingreso + 12.00 de la reversión del egreso; 12.00 de egreso
+	if modelo[cuenta] != (Saldo{Creditos: 2700, Debitos: 1200}) {
+		t.Fatalf("saldo de la cuenta: %+v", modelo[cuenta])
+	}
+	if modelo[empresa] != (Saldo{Creditos: 1200, Debitos: 1700}) {
+		t.Fatalf("saldo de la cuenta empresa: %+v", modelo[empresa])
+	}
+
+	// ingreso rechazado (los egresos posteriores quedan sin fondos en el modelo) y operación sin notificar
+	resultados[sinFondos.Correlacion] = &Resultado{Estado: "F", Mensaje: "OK"}
+	resultados[ingreso.Correlacion] = &Resultado{Estado: "E", Mensaje: "Cuenta no encontrada"}
+	delete(resultados, invalida.Correlacion)
+	_, discrepancias = verificar(operaciones, resultados, iniciales)
+	esperadas := []string{"egreso aceptado sin saldo", "ingreso rechazado", "reenvío aceptado de un ingreso que no se registró", "sin notificación"}
+	if len(discrepancias) != 5 {
+		t.Fatalf("discrepancias: %v", discrepancias)
+	}
+	for _, e := range esperadas {
+		if !strings.Contains(strings.Join(discrepancias, "\n"), e) {
+			t.Fatalf("falta la discrepancia %q en %v", e, discrepancias)
+		}
+	}
+}
+
+func TestCompararSaldos(t *testing.T) {
+	cuenta := Cuenta{IdMoneda: 2, IdUsuarioFinal: 3}
+	modelo := map[Cuenta]Saldo{cuenta: {Creditos: 10050, Debitos: 50}}
+	if d := compararSaldos(modelo, map[Cuenta]Saldo{cuenta: {Creditos: 10050, Debitos: 50}}); len(d) != 0 {
+		t.Fatalf("saldos iguales: %v", d)
+	}
+	d := compararSaldos(modelo, map[Cuenta]Saldo{cuenta: {Creditos: 10050}})
+	if len(d) != 1 || !strings.Contains(d[0], "débitos 0.00, el modelo espera 100.50 / 0.50") {
+		t.Fatalf("discrepancia de saldo: %v", d)
+	}
+}
+
+func TestGenerarOperaciones(t *testing.T) {
+	esc := Escenario{
+		Monedas: []int{1}, CuentasPorMoneda: 3, Transferencias: 2000, Fecha: "2026-03-11", Semilla: 42,
+		Mezcla:   Mezcla{Ingresos: 50, Egresos: 30, Reversiones: 10, Invalidas: 5, Duplicadas: 5},
+		MontoMin: 1, MontoMax: 250.75,
+	}
+	cuentas := []Cuenta{{1, 1}, {1, 2}, {1, 3}}
+	operaciones := generarOperaciones(esc, cuentas, map[Cuenta]Saldo{})
+	if len(operaciones) != esc.Transferencias {
+		t.Fatalf("operaciones generadas: %d", len(operaciones))
+	}
+
+	porClase := make(map[string]int)
+	ultima := make(map[Cuenta]*Operacion)
+	correlaciones := make(map[string]bool)
+	for _, op := range operaciones {
+		porClase[op.Clase]++
+		if correlaciones[op.Correlacion] {
+			t.Fatalf("IdCorrelacion repetido: %s", op.Correlacion)
+		}
+		correlaciones[op.Correlacion] = true
+		if _, err := strconv.ParseUint(op.IdTransf, 10, 64); err != nil {
+			t.Fatalf("el Id %s no entra en 64 bits (la reversión enciende el bit 64): %v", op.IdTransf, err)
+		}
+		switch op.Clase {
+		case claseIngreso, claseEgreso:
+			if op.Centavos < 100 || op.Centavos > 25075 {
+				t.Fatalf("monto fuera de rango: %d", op.Centavos)
+			}
+			ultima[op.Cuenta] = op
+		case claseReversion:
+			// solo se revierte la última transferencia de la cuenta, una sola vez
+			if ultima[op.Cuenta] != op.Original || op.IdTransf != op.Original.IdTransf {
+				t.Fatalf("reversión de %s, que no es la última transferencia de la cuenta", op.Original.IdTransf)
+			}
+			delete(ultima, op.Cuenta)
+		case claseDuplicada:
+			if op.Original.Clase != claseIngreso || op.IdTransf != op.Original.IdTransf || string(op.Valor) != string(op.Original.Valor) {
+				t.Fatalf("reenvío distinto del ingreso original: %s / %s", op.Valor, op.Original.Valor)
+			}
+		}
+	}
+	for _, clase := range []string{claseIngreso, claseEgreso, claseReversion, claseInvalida, claseDuplicada} {
+		if porClase[clase] == 0 {
+			t.Fatalf("la mezcla no generó operaciones %s: %v", clase, porClase)
+		}
+	}
+}
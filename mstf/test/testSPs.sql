@@ -6,8 +6,13 @@
 call tsp_autenticar_actor('APIKEY_INVALIDA', 'SISTEMA');
 call tsp_autenticar_actor('CAMBIAR_ESTE_VALOR', 'SISTEMA');-- OK
 
+-- Los tokens y refresh tokens los genera el MS: acá se usan literales de 32 caracteres
+-- Política de sesión: token 15 min, inactividad 30 min, duración 12 h, máximo 10 sesiones
+call tsp_login_usuario('admin', 'e64b78fc3bc91bcbc7dc232ba8ec59e0', 'tokenadmin0000000000000000000000', 'refreshadmin00000000000000000000', 'testSPs', '127.0.0.1', 15, 30, 12, 10, NULL, '');-- OK
+set @tokenAdmin = 'tokenadmin0000000000000000000000';
+
 call tsp_autenticar_actor('tokeninvalidoxxxxxxxxxxxxxxxxxxx', 'USUARIO');
-call tsp_autenticar_actor((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- OK
+call tsp_autenticar_actor(@tokenAdmin, 'USUARIO');-- OK
 
 -- 02. Usuarios
 call tsp_buscar_usuarios('', 'S');
@@ -16,14 +21,16 @@ call tsp_buscar_usuarios('adm', 'S');
 call tsp_buscar_usuarios('noexiste', 'S');
 
 -- Crear usuario
-call tsp_crear_usuario('', (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');
-call tsp_crear_usuario('admin', (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');
-call tsp_crear_usuario('usuario2', (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- OK
-call tsp_crear_usuario('usuario2', (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- duplicado
+-- Las contraseñas se hashean con argon2id en el MS: los SPs reciben el hash como texto opaco
+call tsp_crear_usuario('', 'hash_temporal', @tokenAdmin, 'USUARIO');
+call tsp_crear_usuario('admin', 'hash_temporal', @tokenAdmin, 'USUARIO');
+call tsp_crear_usuario('usuario2', '', @tokenAdmin, 'USUARIO');-- contraseña obligatoria
+call tsp_crear_usuario('usuario2', 'hash_temporal', @tokenAdmin, 'USUARIO');-- OK
+call tsp_crear_usuario('usuario2', 'hash_temporal', @tokenAdmin, 'USUARIO');-- duplicado
 
 -- Crear usuario via SISTEMA
-call tsp_crear_usuario('usuario3', 'CAMBIAR_ESTE_VALOR', 'SISTEMA');-- OK
-call tsp_crear_usuario('usuario3', 'CAMBIAR_ESTE_VALOR', 'SISTEMA');-- duplicado
+call tsp_crear_usuario('usuario3', 'hash_temporal', 'CAMBIAR_ESTE_VALOR', 'SISTEMA');-- OK
+call tsp_crear_usuario('usuario3', 'hash_temporal', 'CAMBIAR_ESTE_VALOR', 'SISTEMA');-- duplicado
 
 -- Obtener usuario
 call tsp_dame_usuario(1);
@@ -32,62 +39,207 @@ call tsp_dame_usuario(3);
 call tsp_dame_usuario(999);
 
 -- Confirmar cuenta usuario2 (Estado P → A)
--- Nota: el servidor aplica md5() antes de llamar al SP. Las validaciones de longitud/letra/número
--- solo son testeables en la capa HTTP, ya que md5 siempre produce 32 hex chars válidos.
-call tsp_confirmar_cuenta_usuario('tokeninvalidoxxxxxxxxxxxxxxxxxx', md5('user123'), md5('user123'));
-call tsp_confirmar_cuenta_usuario((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 2), md5('user123'), md5('user456'));-- mismatch
-call tsp_confirmar_cuenta_usuario((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 2), md5('user123'), md5('user123'));-- OK
-call tsp_confirmar_cuenta_usuario((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 2), md5('user456'), md5('user456'));-- ya activo (idempotencia)
+-- Nota: la política de contraseñas (parámetros PASSWORD*) y la confirmación se validan en el MS,
+-- solo son testeables en la capa HTTP.
+call tsp_login_usuario('usuario2', 'hash_temporal', 'tokenusuario20000000000000000000', 'refreshusuario200000000000000000', NULL, NULL, 15, 30, 12, 10, NULL, '');-- OK (Estado P)
+set @tokenUsuario2 = 'tokenusuario20000000000000000000';
+call tsp_confirmar_cuenta_usuario('tokeninvalidoxxxxxxxxxxxxxxxxxx', 'hash_user123');
+call tsp_confirmar_cuenta_usuario(@tokenUsuario2, '');-- contraseña obligatoria
+call tsp_confirmar_cuenta_usuario(@tokenUsuario2, 'hash_user123');-- OK (cierra las sesiones de usuario2)
+call tsp_confirmar_cuenta_usuario(@tokenUsuario2, 'hash_user456');-- sesión cerrada
 
 -- Confirmar cuenta usuario3
-call tsp_confirmar_cuenta_usuario((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 3), md5('user123'), md5('user123'));-- OK
+call tsp_login_usuario('usuario3', 'hash_temporal', 'tokenusuario30000000000000000000', 'refreshusuario300000000000000000', NULL, NULL, 15, 30, 12, 10, NULL, '');-- OK (Estado P)
+call tsp_confirmar_cuenta_usuario('tokenusuario30000000000000000000', 'hash_user123');-- OK
 
 -- Login
-call tsp_login_usuario('noexiste', md5('user123'));
-call tsp_login_usuario('usuario2', md5('wrongpass'));
-call tsp_login_usuario('usuario2', md5('user123'));-- OK (token se regenera)
-
--- Modificar password usuario2
-call tsp_modificar_password_usuario('tokeninvalidoxxxxxxxxxxxxxxxxxx', md5('user123'), md5('newpass1'), md5('newpass1'));
-call tsp_modificar_password_usuario((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 2), md5('wrongpass'), md5('newpass1'), md5('newpass1'));
-call tsp_modificar_password_usuario((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 2), md5('user123'), md5('newpass1'), md5('newpass2'));-- mismatch
-call tsp_modificar_password_usuario((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 2), md5('user123'), md5('newpass1'), md5('newpass1'));-- OK
-call tsp_modificar_password_usuario((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 2), md5('newpass1'), md5('user123'), md5('user123'));-- OK (restaura)
+call tsp_dame_password_usuario('noexiste', NULL);-- IdUsuario 0
+call tsp_dame_password_usuario('usuario2', NULL);
+call tsp_dame_password_usuario(NULL, @tokenAdmin);
+call tsp_login_usuario('noexiste', 'hash_user123', 'tokenx00000000000000000000000000', 'refreshx000000000000000000000000', NULL, NULL, 15, 30, 12, 10, NULL, '');
+call tsp_login_usuario('usuario2', 'hash_wrongpass', 'tokenx00000000000000000000000000', 'refreshx000000000000000000000000', NULL, NULL, 15, 30, 12, 10, NULL, '');
+call tsp_login_usuario('usuario2', 'hash_user123', 'tokenusuario20000000000000000000', 'refreshusuario200000000000000000', 'navegador', '10.0.0.1', 15, 30, 12, 10, NULL, '');-- OK
+call tsp_login_usuario('usuario2', 'hash_user123', 'tokenusuario2b000000000000000000', 'refreshusuario2b0000000000000000', 'celular', '10.0.0.2', 15, 30, 12, 10, NULL, '');-- OK (segunda sesión)
+call tsp_login_usuario('usuario2', 'hash_user123', 'tokenusuario2c000000000000000000', 'refreshusuario2c0000000000000000', 'tablet', '10.0.0.3', 15, 30, 12, 2, NULL, '');-- OK (cierra la sesión usada hace más tiempo)
+call tsp_autenticar_actor(@tokenUsuario2, 'USUARIO');-- sesión cerrada por el límite
+set @tokenUsuario2 = 'tokenusuario2b000000000000000000';
+
+-- Migrar hash (MD5 heredado → argon2id en el login)
+call tsp_migrar_password_usuario(999, 'hash_user123', 'hash_migrado');-- no existe
+call tsp_migrar_password_usuario(2, 'hash_wrongpass', 'hash_migrado');-- hash desactualizado
+call tsp_migrar_password_usuario(2, 'hash_user123', 'hash_migrado');-- OK
+call tsp_migrar_password_usuario(2, 'hash_migrado', 'hash_user123');-- OK (restaura)
 
 -- Logout
 call tsp_logout_usuario('tokeninvalidoxxxxxxxxxxxxxxxxxx');
-set @tokenLogout = (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 2);
-call tsp_logout_usuario(@tokenLogout);-- OK
-call tsp_logout_usuario(@tokenLogout);-- sesión ya cerrada
+call tsp_logout_usuario('tokenusuario2c000000000000000000');-- OK
+call tsp_logout_usuario('tokenusuario2c000000000000000000');-- sesión ya cerrada
+
+-- Sesiones
+call tsp_buscar_sesiones('tokeninvalidoxxxxxxxxxxxxxxxxxx');-- vacío
+call tsp_buscar_sesiones(@tokenUsuario2);-- la actual con Actual = 'S'
+call tsp_renovar_sesion('refreshinvalidoxxxxxxxxxxxxxxxxx', 'tokenx00000000000000000000000000', 'refreshx000000000000000000000000', 15);
+call tsp_renovar_sesion('refreshusuario2b0000000000000000', 'tokenusuario2d000000000000000000', 'refreshusuario2d0000000000000000', 15);-- OK (rota ambos tokens)
+call tsp_renovar_sesion('refreshusuario2b0000000000000000', 'tokenusuario2e000000000000000000', 'refreshusuario2e0000000000000000', 15);-- refresh token ya usado
+call tsp_autenticar_actor(@tokenUsuario2, 'USUARIO');-- token anterior a la renovación
+set @tokenUsuario2 = 'tokenusuario2d000000000000000000';
+call tsp_login_usuario('usuario2', 'hash_user123', 'tokenusuario2f000000000000000000', 'refreshusuario2f0000000000000000', 'navegador', '10.0.0.1', 15, 30, 12, 10, NULL, '');-- OK
+call tsp_revocar_sesion(@tokenUsuario2, 999);-- no existe
+call tsp_revocar_sesion(@tokenUsuario2, (SELECT MIN(IdSesion) FROM Sesiones WHERE IdUsuario = 1));-- de otro usuario
+call tsp_revocar_sesion(@tokenUsuario2, (SELECT IdSesion FROM Sesiones WHERE TokenHash = SHA2('tokenusuario2f000000000000000000', 256)));-- OK
+call tsp_revocar_sesiones_usuario(999, @tokenAdmin, 'USUARIO');-- no existe
+call tsp_revocar_sesiones_usuario(1, @tokenUsuario2, 'USUARIO');-- sin permisos
+call tsp_revocar_sesiones_usuario(2, @tokenAdmin, 'USUARIO');-- OK
+call tsp_buscar_sesiones(@tokenUsuario2);-- vacío
+
+-- Modificar password usuario2
+call tsp_login_usuario('usuario2', 'hash_user123', 'tokenusuario2h000000000000000000', 'refreshusuario2h0000000000000000', NULL, NULL, 15, 30, 12, 10, NULL, '');-- OK
+set @tokenUsuario2 = 'tokenusuario2h000000000000000000';
+call tsp_modificar_password_usuario('tokeninvalidoxxxxxxxxxxxxxxxxxx', 'hash_user123', 'hash_newpass1');
+call tsp_modificar_password_usuario(@tokenUsuario2, 'hash_wrongpass', 'hash_newpass1');
+call tsp_modificar_password_usuario(@tokenUsuario2, 'hash_user123', '');-- nueva obligatoria
+call tsp_modificar_password_usuario(@tokenUsuario2, 'hash_user123', 'hash_newpass1');-- OK (cierra las sesiones de usuario2)
+call tsp_modificar_password_usuario(@tokenUsuario2, 'hash_newpass1', 'hash_user123');-- sesión cerrada
+call tsp_login_usuario('usuario2', 'hash_newpass1', 'tokenusuario2i000000000000000000', 'refreshusuario2i0000000000000000', NULL, NULL, 15, 30, 12, 10, NULL, '');-- OK
+call tsp_modificar_password_usuario('tokenusuario2i000000000000000000', 'hash_newpass1', 'hash_user123');-- OK (restaura)
 
 -- Restablecer password (solo Admin)
-call tsp_restablecer_password_usuario(999, (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- no existe
-call tsp_restablecer_password_usuario(2, (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- OK (usuario2 vuelve a P)
-call tsp_restablecer_password_usuario(2, (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- ya pendiente
-call tsp_confirmar_cuenta_usuario((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 2), md5('user123'), md5('user123'));-- OK (reactiva)
+call tsp_restablecer_password_usuario(999, 'hash_temporal', @tokenAdmin, 'USUARIO');-- no existe
+call tsp_restablecer_password_usuario(2, 'hash_temporal', @tokenAdmin, 'USUARIO');-- OK (usuario2 vuelve a P)
+call tsp_restablecer_password_usuario(2, 'hash_temporal', @tokenAdmin, 'USUARIO');-- ya pendiente
+call tsp_login_usuario('usuario2', 'hash_temporal', 'tokenusuario2g000000000000000000', 'refreshusuario2g0000000000000000', NULL, NULL, 15, 30, 12, 10, NULL, '');-- OK (Estado P)
+call tsp_confirmar_cuenta_usuario('tokenusuario2g000000000000000000', 'hash_user123');-- OK (reactiva)
+
+-- Roles y permisos
+call tsp_listar_permisos();
+call tsp_listar_roles();
+call tsp_dame_rol('O');
+call tsp_dame_rol('Z');-- no existe
+call tsp_login_usuario('usuario2', 'hash_user123', 'tokenusuario2r000000000000000000', 'refreshusuario2r0000000000000000', NULL, NULL, 15, 30, 12, 10, NULL, '');-- OK
+set @tokenUsuario2 = 'tokenusuario2r000000000000000000';
+call tsp_autenticar_actor(@tokenUsuario2, 'USUARIO');-- OK, permisos del rol O
+call tsp_autenticar_actor('CAMBIAR_ESTE_VALOR', 'SISTEMA');-- OK, permisos del rol S
+call tsp_restablecer_password_usuario(1, 'hash_temporal', @tokenUsuario2, 'USUARIO');-- sin usuarios:admin
+call tsp_crear_rol('C', 'Consulta', '["monedas:read"]', @tokenUsuario2, 'USUARIO');-- sin roles:write
+call tsp_crear_rol('c', 'Consulta', '["monedas:read"]', @tokenAdmin, 'USUARIO');-- código inválido
+call tsp_crear_rol('C', '', '["monedas:read"]', @tokenAdmin, 'USUARIO');-- nombre obligatorio
+call tsp_crear_rol('C', 'Operador', '["monedas:read"]', @tokenAdmin, 'USUARIO');-- nombre repetido
+call tsp_crear_rol('C', 'Consulta', '{"monedas":"read"}', @tokenAdmin, 'USUARIO');-- no es array
+call tsp_crear_rol('C', 'Consulta', '["monedas:borrar"]', @tokenAdmin, 'USUARIO');-- permiso inexistente
+call tsp_crear_rol('C', 'Consulta', '["monedas:read", "cuentas:read"]', @tokenAdmin, 'USUARIO');-- OK
+call tsp_crear_rol('C', 'Consulta', '["monedas:read"]', @tokenAdmin, 'USUARIO');-- ya existe
+call tsp_modificar_rol('A', 'Administrador', '[]', @tokenAdmin, 'USUARIO');-- no se puede modificar
+call tsp_modificar_rol('Z', 'Otro', '[]', @tokenAdmin, 'USUARIO');-- no existe
+call tsp_modificar_rol('C', 'Consulta de monedas', '["monedas:read"]', @tokenAdmin, 'USUARIO');-- OK
+call tsp_asignar_rol_usuario(1, 'C', @tokenAdmin, 'USUARIO');-- automodificación
+call tsp_asignar_rol_usuario(999, 'C', @tokenAdmin, 'USUARIO');-- usuario no existe
+call tsp_asignar_rol_usuario(2, 'Z', @tokenAdmin, 'USUARIO');-- rol no existe
+call tsp_asignar_rol_usuario(2, 'S', @tokenAdmin, 'USUARIO');-- exclusivo de la API key
+call tsp_asignar_rol_usuario(2, 'C', @tokenAdmin, 'USUARIO');-- OK
+call tsp_asignar_rol_usuario(2, 'C', @tokenAdmin, 'USUARIO');-- ya tiene el rol
+call tsp_autenticar_actor(@tokenUsuario2, 'USUARIO');-- OK, solo monedas:read
+call tsp_borrar_rol('C', @tokenAdmin, 'USUARIO');-- tiene usuarios
+call tsp_borrar_rol('S', @tokenAdmin, 'USUARIO');-- no se puede borrar
+call tsp_asignar_rol_usuario(2, 'O', 'CAMBIAR_ESTE_VALOR', 'SISTEMA');-- OK via SISTEMA
+call tsp_borrar_rol('C', @tokenAdmin, 'USUARIO');-- OK
+call tsp_listar_roles();
+
+-- API keys
+-- Las API keys las genera el MS y los SPs reciben su SHA-256: acá se usa SHA2 sobre literales
+call tsp_listar_apikeys();
+call tsp_crear_apikey('reportes', 'BI', SHA2('mstf_reportes', 256), 'mstf_reporte', '["lectura"]', '[]', NULL, @tokenUsuario2, 'USUARIO');-- sin apikeys:write
+call tsp_crear_apikey('', 'BI', SHA2('mstf_reportes', 256), 'mstf_reporte', '["lectura"]', '[]', NULL, @tokenAdmin, 'USUARIO');-- nombre obligatorio
+call tsp_crear_apikey('sistema', 'BI', SHA2('mstf_reportes', 256), 'mstf_reporte', '["lectura"]', '[]', NULL, @tokenAdmin, 'USUARIO');-- nombre repetido
+call tsp_crear_apikey('reportes', 'BI', SHA2('mstf_reportes', 256), 'mstf_reporte', '[]', '[]', NULL, @tokenAdmin, 'USUARIO');-- sin alcances
+call tsp_crear_apikey('reportes', 'BI', SHA2('mstf_reportes', 256), 'mstf_reporte', '["escritura"]', '[]', NULL, @tokenAdmin, 'USUARIO');-- alcance inexistente
+call tsp_crear_apikey('reportes', 'BI', SHA2('mstf_reportes', 256), 'mstf_reporte', '["lectura"]', '[]', '2020-01-01', @tokenAdmin, 'USUARIO');-- vencimiento pasado
+call tsp_crear_apikey('reportes', 'BI', SHA2('mstf_reportes', 256), 'mstf_reporte', '["lectura", "transferencias"]', '["10.0.0.0/8"]', NOW() + INTERVAL 1 DAY, @tokenAdmin, 'USUARIO');-- OK
+set @idApiKey = LAST_INSERT_ID();
+call tsp_autenticar_actor('mstf_reportes', 'SISTEMA');-- OK, permisos de consulta y de transferencias, IPs y segundos de vigencia
+call tsp_dame_version_apikeys();
+call tsp_rotar_apikey(@idApiKey, SHA2('mstf_reportes2', 256), 'mstf_reporte', @tokenAdmin, 'USUARIO');-- OK
+call tsp_autenticar_actor('mstf_reportes', 'SISTEMA');-- API Key inválida
+call tsp_autenticar_actor('mstf_reportes2', 'SISTEMA');-- OK
+call tsp_revocar_apikey(@idApiKey, @tokenAdmin, 'USUARIO');-- OK
+call tsp_revocar_apikey(@idApiKey, @tokenAdmin, 'USUARIO');-- ya revocada
+call tsp_dame_version_apikeys();-- dos más que antes de rotar (rotación y revocación)
+call tsp_rotar_apikey(@idApiKey, SHA2('mstf_reportes3', 256), 'mstf_reporte', @tokenAdmin, 'USUARIO');-- revocada
+call tsp_rotar_apikey(999, SHA2('mstf_reportes3', 256), 'mstf_reporte', @tokenAdmin, 'USUARIO');-- no existe
+call tsp_autenticar_actor('mstf_reportes2', 'SISTEMA');-- API Key inválida
+call tsp_listar_apikeys();
+
+-- Segundo factor
+-- El MS genera el secreto y verifica los códigos TOTP: los SPs reciben el paso del código y el SHA-256 de los códigos de recuperación
+call tsp_login_usuario('usuario2', 'hash_user123', 'tokenusuario2t000000000000000000', 'refreshusuario2t0000000000000000', NULL, NULL, 15, 30, 12, 10, NULL, '');-- OK
+set @tokenUsuario2 = 'tokenusuario2t000000000000000000';
+call tsp_dame_segundo_factor(@tokenUsuario2, NULL);-- sin segundo factor (Estado NULL)
+call tsp_activar_segundo_factor(@tokenUsuario2, 100, JSON_ARRAY(SHA2('codigo1', 256)));-- sin inscripción pendiente
+call tsp_inscribir_segundo_factor(@tokenUsuario2, NULL, '');-- secreto obligatorio
+call tsp_inscribir_segundo_factor(@tokenUsuario2, NULL, 'JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP');-- OK (pendiente)
+call tsp_login_usuario('usuario2', 'hash_user123', 'tokenusuario2u000000000000000000', 'refreshusuario2u0000000000000000', NULL, NULL, 15, 30, 12, 10, 'desafiousuario2a0000000000000000', '');-- OK, sin desafío (pendiente)
+call tsp_activar_segundo_factor(@tokenUsuario2, 100, '[]');-- códigos de recuperación obligatorios
+call tsp_activar_segundo_factor(@tokenUsuario2, 100, JSON_ARRAY(SHA2('codigo1', 256), SHA2('codigo2', 256)));-- OK
+call tsp_inscribir_segundo_factor(@tokenUsuario2, NULL, 'JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP');-- ya activo
+call tsp_buscar_usuarios('usuario2', 'S');-- SegundoFactor = 'S'
+call tsp_login_usuario('usuario2', 'hash_user123', 'tokenusuario2v000000000000000000', 'refreshusuario2v0000000000000000', NULL, NULL, 15, 30, 12, 10, 'desafiousuario2b0000000000000000', '');-- OK, Desafio = 'V' sin sesión
+call tsp_dame_segundo_factor(NULL, 'desafiousuario2b0000000000000000');-- OK
+call tsp_completar_login_usuario('desafiousuario2b0000000000000000', 100, NULL, NULL, 'tokenusuario2v000000000000000000', 'refreshusuario2v0000000000000000', NULL, NULL, 15, 30, 12, 10);-- paso ya usado
+call tsp_completar_login_usuario('desafiousuario2b0000000000000000', 101, NULL, NULL, 'tokenusuario2v000000000000000000', 'refreshusuario2v0000000000000000', NULL, NULL, 15, 30, 12, 10);-- OK
+call tsp_completar_login_usuario('desafiousuario2b0000000000000000', 102, NULL, NULL, 'tokenusuario2w000000000000000000', 'refreshusuario2w0000000000000000', NULL, NULL, 15, 30, 12, 10);-- desafío ya usado
+call tsp_login_usuario('usuario2', 'hash_user123', 'tokenusuario2w000000000000000000', 'refreshusuario2w0000000000000000', NULL, NULL, 15, 30, 12, 10, 'desafiousuario2c0000000000000000', '');-- OK, Desafio = 'V'
+call tsp_completar_login_usuario('desafiousuario2c0000000000000000', NULL, SHA2('codigo1', 256), NULL, 'tokenusuario2w000000000000000000', 'refreshusuario2w0000000000000000', NULL, NULL, 15, 30, 12, 10);-- OK (consume el código de recuperación)
+call tsp_login_usuario('usuario2', 'hash_user123', 'tokenusuario2x000000000000000000', 'refreshusuario2x0000000000000000', NULL, NULL, 15, 30, 12, 10, 'desafiousuario2d0000000000000000', '');-- OK, Desafio = 'V'
+call tsp_completar_login_usuario('desafiousuario2d0000000000000000', NULL, SHA2('codigo1', 256), NULL, 'tokenusuario2x000000000000000000', 'refreshusuario2x0000000000000000', NULL, NULL, 15, 30, 12, 10);-- código de recuperación ya usado
+call tsp_restablecer_segundo_factor_usuario(2, 'tokenusuario2w000000000000000000', 'USUARIO');-- sin usuarios:admin
+call tsp_restablecer_segundo_factor_usuario(1, @tokenAdmin, 'USUARIO');-- automodificación
+call tsp_restablecer_segundo_factor_usuario(999, @tokenAdmin, 'USUARIO');-- no existe
+call tsp_restablecer_segundo_factor_usuario(2, @tokenAdmin, 'USUARIO');-- OK (cierra las sesiones y desafíos de usuario2)
+call tsp_restablecer_segundo_factor_usuario(2, @tokenAdmin, 'USUARIO');-- sin segundo factor
+-- Rol que exige segundo factor: el login devuelve un desafío de inscripción
+call tsp_login_usuario('usuario2', 'hash_user123', 'tokenusuario2y000000000000000000', 'refreshusuario2y0000000000000000', NULL, NULL, 15, 30, 12, 10, 'desafiousuario2e0000000000000000', 'O');-- OK, Desafio = 'I'
+call tsp_completar_login_usuario('desafiousuario2e0000000000000000', 100, NULL, JSON_ARRAY(SHA2('codigo3', 256)), 'tokenusuario2y000000000000000000', 'refreshusuario2y0000000000000000', NULL, NULL, 15, 30, 12, 10);-- debe inscribir
+call tsp_inscribir_segundo_factor(NULL, 'desafiousuario2e0000000000000000', 'JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP');-- OK
+call tsp_completar_login_usuario('desafiousuario2e0000000000000000', 100, NULL, JSON_ARRAY(SHA2('codigo3', 256)), 'tokenusuario2y000000000000000000', 'refreshusuario2y0000000000000000', NULL, NULL, 15, 30, 12, 10);-- OK (activa)
+call tsp_restablecer_segundo_factor_usuario(2, 'CAMBIAR_ESTE_VALOR', 'SISTEMA');-- OK via SISTEMA
+
+-- Bloqueo de login por intentos fallidos (3 intentos, 60 segundos, máximo 2 minutos, ventana de 24 horas)
+call tsp_reservar_intento_login('', '10.0.0.1', 3, 60, 24);-- usuario obligatorio
+call tsp_reservar_intento_login('noexiste', '10.0.0.1', 3, 60, 24);-- OK, 0 (también para usuarios inexistentes)
+call tsp_registrar_login_fallido('noexiste', 3, 60, 2);-- OK, 0
+call tsp_reservar_intento_login('usuario2', '10.0.0.1', 3, 60, 24);-- OK, 0
+call tsp_liberar_intento_login('usuario2');-- OK (credenciales válidas, no cuenta)
+call tsp_reservar_intento_login('usuario2', '10.0.0.1', 3, 60, 24);-- OK, 0
+call tsp_reservar_intento_login('usuario2', '10.0.0.1', 3, 60, 24);-- OK, 0
+call tsp_reservar_intento_login('usuario2', '10.0.0.1', 3, 60, 24);-- OK, 0
+call tsp_reservar_intento_login('usuario2', '10.0.0.1', 3, 60, 24);-- OK, 60 (los intentos en curso completan el máximo)
+call tsp_registrar_login_fallido('usuario2', 3, 60, 2);-- OK, 60
+call tsp_registrar_login_fallido('usuario2', 3, 60, 2);-- OK, 0 (el bloqueo ya se aplicó)
+call tsp_reservar_intento_login('usuario2', '10.0.0.1', 3, 60, 24);-- OK, ~60 segundos (bloqueado)
+call tsp_login_usuario('usuario2', 'hash_user123', 'tokenusuario2z000000000000000000', 'refreshusuario2z0000000000000000', NULL, NULL, 15, 30, 12, 10, NULL, '');-- OK, borra los intentos (tsp_crear_sesion)
+call tsp_reservar_intento_login('usuario2', '10.0.0.1', 3, 60, 24);-- OK, 0
 
 -- Desactivar usuario
-call tsp_desactivar_usuario(1, (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- automodificación
-call tsp_desactivar_usuario(999, (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- no existe
-call tsp_desactivar_usuario(2, (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- OK
-call tsp_desactivar_usuario(2, (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- ya inactivo
+call tsp_desactivar_usuario(1, @tokenAdmin, 'USUARIO');-- automodificación
+call tsp_desactivar_usuario(999, @tokenAdmin, 'USUARIO');-- no existe
+call tsp_desactivar_usuario(2, @tokenAdmin, 'USUARIO');-- OK
+call tsp_desactivar_usuario(2, @tokenAdmin, 'USUARIO');-- ya inactivo
 
 -- Activar usuario
-call tsp_activar_usuario(1, (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- automodificación
-call tsp_activar_usuario(999, (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- no existe
-call tsp_activar_usuario(2, (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- OK
-call tsp_activar_usuario(2, (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- ya activo
+call tsp_activar_usuario(1, @tokenAdmin, 'USUARIO');-- automodificación
+call tsp_activar_usuario(999, @tokenAdmin, 'USUARIO');-- no existe
+call tsp_activar_usuario(2, @tokenAdmin, 'USUARIO');-- OK
+call tsp_activar_usuario(2, @tokenAdmin, 'USUARIO');-- ya activo
 
 call tsp_buscar_usuarios('', 'S');
 
 -- Borrar usuario
-call tsp_borrar_usuario(1, (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- automodificación
-call tsp_borrar_usuario(999, (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- no existe
-call tsp_borrar_usuario(2, (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- activo, no se puede
-call tsp_desactivar_usuario(2, (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- OK
-call tsp_borrar_usuario(2, (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- OK
-call tsp_desactivar_usuario(3, (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- OK
-call tsp_borrar_usuario(3, (SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO');-- OK
+call tsp_borrar_usuario(1, @tokenAdmin, 'USUARIO');-- automodificación
+call tsp_borrar_usuario(999, @tokenAdmin, 'USUARIO');-- no existe
+call tsp_borrar_usuario(2, @tokenAdmin, 'USUARIO');-- activo, no se puede
+call tsp_desactivar_usuario(2, @tokenAdmin, 'USUARIO');-- OK
+call tsp_borrar_usuario(2, @tokenAdmin, 'USUARIO');-- OK
+call tsp_desactivar_usuario(3, @tokenAdmin, 'USUARIO');-- OK
+call tsp_borrar_usuario(3, @tokenAdmin, 'USUARIO');-- OK
 
 call tsp_buscar_usuarios('', 'S');
 
@@ -101,15 +253,15 @@ call tsp_dame_parametro('KAFKABATCHSIZE');
 call tsp_dame_parametro('noexiste');
 
 -- Modificar parámetro no modificable (EsModificable='N')
-call tsp_modificar_parametro((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', 'KAFKABATCHSIZE', '100');
+call tsp_modificar_parametro(@tokenAdmin, 'USUARIO', 'KAFKABATCHSIZE', '100');
 -- Modificar parámetro inexistente
-call tsp_modificar_parametro((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', 'noexiste', '100');
+call tsp_modificar_parametro(@tokenAdmin, 'USUARIO', 'noexiste', '100');
 -- Modificar sin valor
-call tsp_modificar_parametro((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', 'LIMITEBUSCARCUENTAS', NULL);
+call tsp_modificar_parametro(@tokenAdmin, 'USUARIO', 'LIMITEBUSCARCUENTAS', NULL);
 -- Modificar parámetro modificable
-call tsp_modificar_parametro((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', 'LIMITEBUSCARCUENTAS', '200');-- OK
+call tsp_modificar_parametro(@tokenAdmin, 'USUARIO', 'LIMITEBUSCARCUENTAS', '200');-- OK
 call tsp_dame_parametro('LIMITEBUSCARCUENTAS');
-call tsp_modificar_parametro((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', 'LIMITEBUSCARCUENTAS', '500');-- OK restaura
+call tsp_modificar_parametro(@tokenAdmin, 'USUARIO', 'LIMITEBUSCARCUENTAS', '500');-- OK restaura
 -- Via SISTEMA
 call tsp_modificar_parametro('CAMBIAR_ESTE_VALOR', 'SISTEMA', 'MONTOMAXTRANSFER', '200000');-- OK
 call tsp_modificar_parametro('CAMBIAR_ESTE_VALOR', 'SISTEMA', 'MONTOMAXTRANSFER', '100000');-- OK restaura
@@ -122,12 +274,12 @@ call tsp_listar_monedas('S');-- activas e inactivas
 call tsp_listar_monedas('T');-- todas (A, I, P)
 
 -- Crear moneda (Estado P: Pendiente)
-call tsp_crear_moneda((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', 0, 'cuenta-empresa-ars');-- id inválido
-call tsp_crear_moneda((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', NULL, 'cuenta-empresa-ars');-- id nulo
-call tsp_crear_moneda((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', 1, '');-- sin IdCuentaEmpresa
-call tsp_crear_moneda((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', 1, NULL);-- IdCuentaEmpresa nulo
-call tsp_crear_moneda((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', 1, 'cuenta-empresa-ars');-- OK (P)
-call tsp_crear_moneda((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', 1, 'cuenta-empresa-ars');-- idempotente (ya en P, retorna OK)
+call tsp_crear_moneda(@tokenAdmin, 'USUARIO', 0, 'cuenta-empresa-ars');-- id inválido
+call tsp_crear_moneda(@tokenAdmin, 'USUARIO', NULL, 'cuenta-empresa-ars');-- id nulo
+call tsp_crear_moneda(@tokenAdmin, 'USUARIO', 1, '');-- sin IdCuentaEmpresa
+call tsp_crear_moneda(@tokenAdmin, 'USUARIO', 1, NULL);-- IdCuentaEmpresa nulo
+call tsp_crear_moneda(@tokenAdmin, 'USUARIO', 1, 'cuenta-empresa-ars');-- OK (P)
+call tsp_crear_moneda(@tokenAdmin, 'USUARIO', 1, 'cuenta-empresa-ars');-- idempotente (ya en P, retorna OK)
 call tsp_crear_moneda('CAMBIAR_ESTE_VALOR', 'SISTEMA', 2, 'cuenta-empresa-usd');-- OK
 call tsp_crear_moneda('CAMBIAR_ESTE_VALOR', 'SISTEMA', 3, 'cuenta-empresa-eur');-- OK
 
@@ -139,28 +291,53 @@ call tsp_dame_moneda(2);
 call tsp_dame_moneda(999);
 
 -- Activar moneda (P → A)
-call tsp_activar_moneda((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', 999);-- no existe
-call tsp_activar_moneda((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', 1);-- OK
-call tsp_activar_moneda((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', 1);-- ya activa
+call tsp_activar_moneda(@tokenAdmin, 'USUARIO', 999);-- no existe
+call tsp_activar_moneda(@tokenAdmin, 'USUARIO', 1);-- OK
+call tsp_activar_moneda(@tokenAdmin, 'USUARIO', 1);-- ya activa
 call tsp_activar_moneda('CAMBIAR_ESTE_VALOR', 'SISTEMA', 2);-- OK
 call tsp_activar_moneda('CAMBIAR_ESTE_VALOR', 'SISTEMA', 3);-- OK
 
 call tsp_listar_monedas('N');-- 3 activas
 
 -- Desactivar moneda (A → I)
-call tsp_desactivar_moneda((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', 999);-- no existe
-call tsp_desactivar_moneda((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', 3);-- OK
-call tsp_desactivar_moneda((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', 3);-- ya inactiva
+call tsp_desactivar_moneda(@tokenAdmin, 'USUARIO', 999);-- no existe
+call tsp_desactivar_moneda(@tokenAdmin, 'USUARIO', 3);-- OK
+call tsp_desactivar_moneda(@tokenAdmin, 'USUARIO', 3);-- ya inactiva
 
 call tsp_listar_monedas('S');-- 1 y 2 activas, 3 inactiva
 
 -- Borrar moneda (solo P o I)
-call tsp_borrar_moneda((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', 999);-- no existe
-call tsp_borrar_moneda((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', 1);-- activa, no se puede
-call tsp_borrar_moneda((SELECT TokenSesion FROM Usuarios WHERE IdUsuario = 1), 'USUARIO', 3);-- OK (I → borrada)
+call tsp_borrar_moneda(@tokenAdmin, 'USUARIO', 999);-- no existe
+call tsp_borrar_moneda(@tokenAdmin, 'USUARIO', 1);-- activa, no se puede
+call tsp_borrar_moneda(@tokenAdmin, 'USUARIO', 3);-- OK (I → borrada)
 
 call tsp_listar_monedas('S');-- quedan 1 y 2
 call tsp_listar_monedas('T');-- igual, quedan 1 y 2
 call tsp_listar_monedas('N');-- solo activas
 call tsp_listar_monedas('S');-- activas e inactivas
-call tsp_listar_monedas('T');-- todas (A, I, P)
\ No newline at end of file
+call tsp_listar_monedas('T');-- todas (A, I, P)
+-- ----------------------------- --
+-- 05. Auditoría de operaciones
+-- ----------------------------- --
+-- Las operaciones sobre TigerBeetle (CC, AC, DC, RT) las registra el MS; acá se registra una a mano como el sistema
+call tsp_registrar_operacion('CAMBIAR_ESTE_VALOR', 'SISTEMA', 'DC', '{"IdCuenta": "18446744073709551623", "IdMoneda": 1, "IdUsuarioFinal": 7, "Antes": {"Estado": "A"}, "Despues": {"Estado": "I"}}');-- OK
+
+call tsp_buscar_operaciones(NULL, NULL, NULL, NULL, NULL, NULL, NULL);-- últimas 100, de la más reciente a la más antigua
+call tsp_buscar_operaciones(1, NULL, NULL, NULL, NULL, NULL, 10);-- realizadas por el admin
+call tsp_buscar_operaciones(NULL, 'CM', NULL, NULL, NULL, NULL, NULL);-- creaciones de monedas
+call tsp_buscar_operaciones(NULL, NULL, 'Moneda', '1', NULL, NULL, NULL);-- sobre la moneda 1 (CM, AM)
+call tsp_buscar_operaciones(NULL, NULL, 'Moneda', NULL, NULL, NULL, NULL);-- sobre cualquier moneda
+call tsp_buscar_operaciones(NULL, NULL, 'Parametro', 'MONTOMAXTRANSFER', NULL, NULL, NULL);-- modificaciones del parámetro
+call tsp_buscar_operaciones(NULL, NULL, 'Cuenta', '18446744073709551623', NULL, NULL, NULL);-- la desactivación registrada arriba
+call tsp_buscar_operaciones(NULL, NULL, NULL, NULL, CURDATE(), CURDATE() + INTERVAL 1 DAY, NULL);-- las de hoy
+call tsp_buscar_operaciones(NULL, NULL, NULL, NULL, CURDATE() + INTERVAL 1 DAY, NULL, NULL);-- ninguna
+
+-- Cadena de hashes: la cabeza es la última operación y cada Hash encadena el de la anterior
+call tsp_dame_cabeza_operaciones();
+call tsp_listar_cadena_operaciones(0, 10);-- las primeras 10, en orden ascendente
+call tsp_listar_cadena_operaciones(0, NULL);-- hasta 1000
+SELECT o.IdOperacion, o.Hash = SHA2(CONCAT_WS('|', IFNULL(a.Hash, REPEAT('0', 64)), o.IdOperacion, IFNULL(o.IdUsuario, ''), o.TipoOperacion,
+	DATE_FORMAT(o.FechaOperacion, '%Y-%m-%d %H:%i:%s'), CAST(o.Detalles AS CHAR)), 256) Valido
+FROM Operaciones o LEFT JOIN Operaciones a ON a.IdOperacion = o.IdOperacion - 1 ORDER BY o.IdOperacion;-- todas 1
+UPDATE Operaciones SET TipoOperacion = 'DM' WHERE IdOperacion = 1;-- Error 1644: Operaciones solo admite inserciones.
+DELETE FROM Operaciones WHERE IdOperacion = 1;-- Error 1644: Operaciones solo admite inserciones.
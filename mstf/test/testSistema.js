@@ -5,6 +5,7 @@
 // Requiere: k6 instalado, servidor corriendo, Kafka activo.
 import http from 'k6/http';
 import { sleep, check, group } from 'k6';
+import crypto from 'k6/crypto';
 
 export const options = {
   vus: 1,
@@ -18,12 +19,12 @@ export const options = {
 // URL base del servidor
 const BASE = 'http://localhost:8080';
 
-// API Key del actor SISTEMA (debe coincidir con el parámetro APIKEY_SISTEMA en MySQL)
+// API Key del actor SISTEMA (la API key 'sistema' del dump, con alcance admin)
 const APIKEY_SISTEMA = 'CAMBIAR_ESTE_VALOR';
 
 // Usuario admin ACTIVO en MySQL (para obtener Bearer token en pruebas de actor USUARIO)
 const ADMIN_USUARIO  = 'admin';
-const ADMIN_PASSWORD = 'Admin123'; // plain text; el servidor aplica MD5
+const ADMIN_PASSWORD = 'Admin123'; // plain text; el servidor la verifica (MD5 heredado del dump, migrado a argon2id en el primer login)
 
 // ═══════════════════════════════════════════════════════════════════════════
 // IDs FIJOS — prefijo 9999 (no colisiona con otros tests del proyecto)
@@ -97,6 +98,28 @@ function logRes(label, res) {
   console.log(`  [${label}] status=${res.status}  body=${res.body}`);
 }
 
+// Código TOTP (RFC 6238: HMAC-SHA1, 6 dígitos, pasos de 30 s) del secreto base32, desfasado en pasos
+function codigoTOTP(secreto, desfase = 0) {
+  const alfabeto = 'ABCDEFGHIJKLMNOPQRSTUVWXYZ234567';
+  const clave = [];
+  let bits = 0, valor = 0;
+  for (const c of secreto.toUpperCase()) {
+    valor = (valor << 5) | alfabeto.indexOf(c);
+    bits += 5;
+    if (bits >= 8) {
+      clave.push((valor >>> (bits - 8)) & 0xff);
+      bits -= 8;
+    }
+  }
+  const paso = Math.floor(Date.now() / 30000) + desfase;
+  const mensaje = new Uint8Array(8);
+  for (let i = 7, p = paso; i >= 0; i--, p = Math.floor(p / 256)) mensaje[i] = p & 0xff;
+  const h = new Uint8Array(crypto.hmac('sha1', new Uint8Array(clave).buffer, mensaje.buffer, 'binary'));
+  const o = h[h.length - 1] & 0x0f;
+  const n = ((h[o] & 0x7f) << 24) | (h[o + 1] << 16) | (h[o + 2] << 8) | h[o + 3];
+  return String(n % 1000000).padStart(6, '0');
+}
+
 function buildQS(params) {
   return Object.entries(params)
     .flatMap(([k, v]) =>
@@ -139,6 +162,7 @@ export default function () {
   console.log(`  KAFKA_WAIT: ${KAFKA_WAIT}s`);
 
   let tokenAdmin       = '';
+  let refreshAdmin     = '';
   let PARAMS_USUARIO   = makeBearer('');
   let idUsuarioNuevo   = 0;
   let passTemp         = '';
@@ -204,6 +228,7 @@ export default function () {
     if (res.status === 200) {
       const b = parseBody(res);
       tokenAdmin     = b.TokenSesion || '';
+      refreshAdmin   = b.RefreshToken || '';
       PARAMS_USUARIO = makeBearer(tokenAdmin);
       console.log(`  Token admin obtenido: ${tokenAdmin ? tokenAdmin.substring(0, 8) + '...' : 'NONE'}`);
       check(null, { 'token admin obtenido': () => tokenAdmin !== '' });
@@ -1557,11 +1582,14 @@ export default function () {
       tokenNuevoUsr = b.TokenSesion || tokenNuevoUsr;
       console.log(`  Token actualizado: ${tokenNuevoUsr ? tokenNuevoUsr.substring(0, 8) + '...' : 'NONE'}`);
       console.log(`  Mensaje: ${b.Mensaje}  (esperado: "OK")`);
-      check(null, { 'login pass definitivo -> Estado=A': () => b.Mensaje === 'OK' });
+      check(null, {
+        'login pass definitivo -> Estado=A': () => b.Mensaje === 'OK',
+        'permisos del rol Operador':         () => Array.isArray(b.Permisos) && b.Permisos.includes('cuentas:read') && !b.Permisos.includes('usuarios:admin'),
+      });
     }
   });
 
-  // F9-19 y F9-20 van ANTES de F9-18: tsp_modificar_password_usuario invalida la sesión
+  // F9-19 y F9-20 van ANTES de F9-18: tsp_modificar_password_usuario cierra las sesiones
   // al cambiar la contraseña con éxito. Si corrieran después de F9-18, el token quedaría
   // muerto y el middleware devolvería 401 en lugar del 400 esperado del controller.
   group('F9-19: PUT /usuarios/password/modificar — campos vacíos -> 400', () => {
@@ -1678,6 +1706,234 @@ export default function () {
     check(res, { 'activar usuario id=0 -> 400': (r) => r.status === 400 });
   });
 
+  // Sesiones: el token vence a los SESIONTOKENMIN minutos y se renueva con el refresh token (que se rota)
+  group('F9-26b: POST /usuarios/sesiones/renovar — renovar token admin', () => {
+    if (refreshAdmin === '') { console.log('  SKIP (sin refreshAdmin)'); return; }
+    const res = http.post(
+      `${BASE}/usuarios/sesiones/renovar`,
+      JSON.stringify({ RefreshToken: refreshAdmin }),
+      PARAMS_NO_AUTH
+    );
+    logRes('renovar-sesion', res);
+    check(res, { 'renovar sesión -> 200': (r) => r.status === 200 });
+    if (res.status === 200) {
+      const b = parseBody(res);
+      check(b, { 'renovar rota los tokens': (x) => x.TokenSesion !== tokenAdmin && x.RefreshToken !== refreshAdmin });
+      tokenAdmin     = b.TokenSesion || tokenAdmin;
+      PARAMS_USUARIO = makeBearer(tokenAdmin);
+    }
+  });
+
+  group('F9-26c: POST /usuarios/sesiones/renovar — refresh token ya usado -> 401', () => {
+    if (refreshAdmin === '') { console.log('  SKIP (sin refreshAdmin)'); return; }
+    const res = http.post(
+      `${BASE}/usuarios/sesiones/renovar`,
+      JSON.stringify({ RefreshToken: refreshAdmin }),
+      PARAMS_NO_AUTH
+    );
+    logRes('renovar-refresh-usado', res);
+    check(res, { 'refresh token usado -> 401': (r) => r.status === 401 });
+  });
+
+  group('F9-26d: GET /usuarios/sesiones + DELETE /usuarios/sesiones/:id — cerrar la sesión de otro dispositivo', () => {
+    if (tokenAdmin === '') { console.log('  SKIP (sin tokenAdmin)'); return; }
+    const login = http.post(
+      `${BASE}/usuarios/login`,
+      JSON.stringify({ Usuario: ADMIN_USUARIO, Password: ADMIN_PASSWORD, Dispositivo: 'k6 segundo dispositivo' }),
+      PARAMS_NO_AUTH
+    );
+    check(login, { 'login segundo dispositivo -> 200': (r) => r.status === 200 });
+    const idOtra = parseBody(login).IdSesion || 0;
+    const res = http.get(`${BASE}/usuarios/sesiones`, PARAMS_USUARIO);
+    logRes('listar-sesiones', res);
+    check(res, { 'listar sesiones -> 200': (r) => r.status === 200 });
+    const sesiones = res.status === 200 ? parseBody(res) : [];
+    check(null, {
+      'sesión actual marcada': () => Array.isArray(sesiones) && sesiones.some((s) => s.Actual && s.IdSesion !== idOtra),
+      'lista la sesión del otro dispositivo': () => Array.isArray(sesiones) && sesiones.some((s) => s.IdSesion === idOtra),
+    });
+    const del = http.del(`${BASE}/usuarios/sesiones/${idOtra}`, null, PARAMS_USUARIO);
+    logRes('revocar-sesion', del);
+    check(del, { 'revocar sesión -> 200': (r) => r.status === 200 });
+    const otra = http.del(`${BASE}/usuarios/sesiones/${idOtra}`, null, PARAMS_USUARIO);
+    check(otra, { 'revocar sesión ya cerrada -> 400': (r) => r.status === 400 });
+  });
+
+  group(`F9-26e: DELETE /usuarios/${idUsuarioNuevo || 1}/sesiones — cerrar todas las sesiones (SISTEMA)`, () => {
+    if (idUsuarioNuevo <= 0) { console.log('  SKIP'); return; }
+    const res = http.del(`${BASE}/usuarios/${idUsuarioNuevo}/sesiones`, null, PARAMS_SISTEMA);
+    logRes('revocar-sesiones-usuario', res);
+    check(res, { 'revocar sesiones del usuario -> 200': (r) => r.status === 200 });
+    const inexistente = http.del(`${BASE}/usuarios/999999999/sesiones`, null, PARAMS_SISTEMA);
+    check(inexistente, { 'revocar sesiones de usuario inexistente -> 400': (r) => r.status === 400 });
+  });
+
+  // Roles: cada ruta exige un permiso del rol del actor (la API key tiene los del rol S)
+  group('F9-26f: GET /roles + GET /roles/permisos — roles y catálogo de permisos', () => {
+    const roles = http.get(`${BASE}/roles`, PARAMS_SISTEMA);
+    logRes('listar-roles', roles);
+    check(roles, { 'listar roles -> 200': (r) => r.status === 200 });
+    const lista = roles.status === 200 ? parseBody(roles) : [];
+    check(null, { 'roles A, O y S': () => ['A', 'O', 'S'].every((c) => lista.some((r) => r.Rol === c)) });
+    const permisos = http.get(`${BASE}/roles/permisos`, PARAMS_SISTEMA);
+    logRes('listar-permisos', permisos);
+    check(permisos, { 'listar permisos -> 200': (r) => r.status === 200 });
+    const modificarAdmin = http.put(`${BASE}/roles/A`, JSON.stringify({ Nombre: 'Administrador', Permisos: [] }), PARAMS_SISTEMA);
+    check(modificarAdmin, { 'modificar rol Administrador -> 400': (r) => r.status === 400 });
+  });
+
+  group(`F9-26g: POST /roles + PUT /usuarios/${idUsuarioNuevo || 1}/rol — rol de solo consulta de monedas`, () => {
+    if (idUsuarioNuevo <= 0) { console.log('  SKIP'); return; }
+    http.del(`${BASE}/roles/K`, null, PARAMS_SISTEMA); // restos de una corrida anterior
+    const crear = http.post(`${BASE}/roles`, JSON.stringify({ Rol: 'K', Nombre: 'Consulta k6', Permisos: ['monedas:read'] }), PARAMS_SISTEMA);
+    logRes('crear-rol', crear);
+    check(crear, { 'crear rol -> 201': (r) => r.status === 201 });
+    const invalido = http.post(`${BASE}/roles`, JSON.stringify({ Rol: 'J', Nombre: 'Inválido k6', Permisos: ['monedas:borrar'] }), PARAMS_SISTEMA);
+    check(invalido, { 'permiso inexistente -> 400': (r) => r.status === 400 });
+    const asignar = http.put(`${BASE}/usuarios/${idUsuarioNuevo}/rol`, JSON.stringify({ Rol: 'K' }), PARAMS_SISTEMA);
+    logRes('asignar-rol', asignar);
+    check(asignar, { 'asignar rol -> 200': (r) => r.status === 200 });
+
+    const login = http.post(`${BASE}/usuarios/login`, JSON.stringify({ Usuario: NOMBRE_USR_NUEVO, Password: PASS_NUEVO }), PARAMS_NO_AUTH);
+    check(login, { 'login con rol K -> 200': (r) => r.status === 200 });
+    const b = login.status === 200 ? parseBody(login) : {};
+    check(null, { 'Permisos = [monedas:read]': () => JSON.stringify(b.Permisos) === '["monedas:read"]' });
+    const params = makeBearer(b.TokenSesion || '');
+    check(http.get(`${BASE}/monedas`, params), { 'GET /monedas con monedas:read -> 200': (r) => r.status === 200 });
+    check(http.get(`${BASE}/usuarios`, params), { 'GET /usuarios sin usuarios:read -> 403': (r) => r.status === 403 });
+    check(http.post(`${BASE}/roles`, JSON.stringify({ Rol: 'J', Nombre: 'Otro k6', Permisos: [] }), params), { 'POST /roles sin roles:write -> 403': (r) => r.status === 403 });
+  });
+
+  group('F9-26h: DELETE /roles/K — restaurar rol Operador y borrar el rol', () => {
+    if (idUsuarioNuevo <= 0) { console.log('  SKIP'); return; }
+    const conUsuarios = http.del(`${BASE}/roles/K`, null, PARAMS_SISTEMA);
+    check(conUsuarios, { 'borrar rol con usuarios -> 400': (r) => r.status === 400 });
+    const asignar = http.put(`${BASE}/usuarios/${idUsuarioNuevo}/rol`, JSON.stringify({ Rol: 'O' }), PARAMS_SISTEMA);
+    check(asignar, { 'restaurar rol Operador -> 200': (r) => r.status === 200 });
+    const borrar = http.del(`${BASE}/roles/K`, null, PARAMS_SISTEMA);
+    logRes('borrar-rol', borrar);
+    check(borrar, { 'borrar rol -> 200': (r) => r.status === 200 });
+  });
+
+  group('F9-26i: POST /apikeys — API key de solo lectura, rotación y revocación inmediata', () => {
+    const sufijo = Date.now(); // los nombres son únicos y las revocadas se conservan
+    const crear = http.post(`${BASE}/apikeys`, JSON.stringify({ Nombre: `k6-lectura-${sufijo}`, Sistema: 'k6', Alcances: ['lectura'] }), PARAMS_SISTEMA);
+    logRes('crear-apikey', crear);
+    check(crear, { 'crear API key -> 201': (r) => r.status === 201 });
+    const k = crear.status === 201 ? parseBody(crear) : {};
+    check(null, { 'devuelve la API key una sola vez': () => typeof k.ApiKey === 'string' && k.ApiKey.startsWith(k.Prefijo || '-') });
+    const params = { headers: { 'Content-Type': 'application/json', 'X-API-Key': k.ApiKey || '' } };
+    check(http.get(`${BASE}/monedas`, params), { 'GET /monedas con alcance lectura -> 200': (r) => r.status === 200 });
+    check(http.post(`${BASE}/monedas`, JSON.stringify({}), params), { 'POST /monedas con alcance lectura -> 403': (r) => r.status === 403 });
+
+    const listar = http.get(`${BASE}/apikeys`, PARAMS_SISTEMA);
+    check(listar, { 'listar API keys -> 200': (r) => r.status === 200 });
+    check(null, { 'el listado no incluye la API key': () => !listar.body.includes(k.ApiKey || '-') });
+
+    const rotar = http.put(`${BASE}/apikeys/${k.IdApiKey}/rotar`, null, PARAMS_SISTEMA);
+    logRes('rotar-apikey', rotar);
+    check(rotar, { 'rotar API key -> 200': (r) => r.status === 200 });
+    const nueva = rotar.status === 200 ? parseBody(rotar).ApiKey : '';
+    check(http.get(`${BASE}/monedas`, params), { 'API key anterior a la rotación -> 401': (r) => r.status === 401 });
+    const paramsNueva = { headers: { 'Content-Type': 'application/json', 'X-API-Key': nueva } };
+    check(http.get(`${BASE}/monedas`, paramsNueva), { 'API key rotada -> 200': (r) => r.status === 200 });
+
+    const revocar = http.put(`${BASE}/apikeys/${k.IdApiKey}/revocar`, null, PARAMS_SISTEMA);
+    logRes('revocar-apikey', revocar);
+    check(revocar, { 'revocar API key -> 200': (r) => r.status === 200 });
+    check(http.get(`${BASE}/monedas`, paramsNueva), { 'API key revocada (aunque estaba en caché) -> 401': (r) => r.status === 401 });
+
+    const restringida = http.post(`${BASE}/apikeys`, JSON.stringify({ Nombre: `k6-ip-${sufijo}`, Sistema: 'k6', Alcances: ['admin'], IPsPermitidas: ['203.0.113.0/24'] }), PARAMS_SISTEMA);
+    check(restringida, { 'crear API key con IPs permitidas -> 201': (r) => r.status === 201 });
+    const r = restringida.status === 201 ? parseBody(restringida) : {};
+    check(http.get(`${BASE}/monedas`, { headers: { 'X-API-Key': r.ApiKey || '' } }), { 'API key desde una IP no permitida -> 401': (res) => res.status === 401 });
+    http.put(`${BASE}/apikeys/${r.IdApiKey}/revocar`, null, PARAMS_SISTEMA);
+  });
+
+  // Segundo factor: cada código TOTP vale una vez; un código de recuperación reemplaza a la app autenticadora
+  group(`F9-26j: /usuarios/segundo-factor — activar, login en dos pasos y restablecer (${idUsuarioNuevo || 1})`, () => {
+    if (idUsuarioNuevo <= 0) { console.log('  SKIP'); return; }
+    const loginUsuario = () => http.post(`${BASE}/usuarios/login`, JSON.stringify({ Usuario: NOMBRE_USR_NUEVO, Password: PASS_NUEVO }), PARAMS_NO_AUTH);
+    const login = loginUsuario();
+    const params = makeBearer(login.status === 200 ? parseBody(login).TokenSesion || '' : '');
+    const inscribir = http.post(`${BASE}/usuarios/segundo-factor`, null, params);
+    logRes('inscribir-segundo-factor', inscribir);
+    check(inscribir, { 'inscribir segundo factor -> 200': (r) => r.status === 200 });
+    const secreto = inscribir.status === 200 ? parseBody(inscribir).Secreto : '';
+    if (!secreto) return;
+    check(http.put(`${BASE}/usuarios/segundo-factor/activar`, JSON.stringify({ Codigo: 'abcdef' }), params), { 'activar con código inválido -> 400': (r) => r.status === 400 });
+    const activar = http.put(`${BASE}/usuarios/segundo-factor/activar`, JSON.stringify({ Codigo: codigoTOTP(secreto) }), params);
+    logRes('activar-segundo-factor', activar);
+    check(activar, { 'activar segundo factor -> 200': (r) => r.status === 200 });
+    const codigos = activar.status === 200 ? parseBody(activar).CodigosRecuperacion || [] : [];
+    check(null, { '10 códigos de recuperación': () => codigos.length === 10 });
+
+    let desafio = parseBody(loginUsuario());
+    check(null, { 'login devuelve desafío sin sesión': () => !!desafio.TokenDesafio && !desafio.TokenSesion && desafio.Inscripcion === false });
+    const reutilizado = http.post(`${BASE}/usuarios/login/segundo-factor`, JSON.stringify({ TokenDesafio: desafio.TokenDesafio, Codigo: codigoTOTP(secreto) }), PARAMS_NO_AUTH);
+    check(reutilizado, { 'código TOTP ya usado -> 400': (r) => r.status === 400 });
+    const completar = http.post(`${BASE}/usuarios/login/segundo-factor`, JSON.stringify({ TokenDesafio: desafio.TokenDesafio, Codigo: codigoTOTP(secreto, 1) }), PARAMS_NO_AUTH);
+    logRes('completar-login', completar);
+    check(completar, { 'completar login con código TOTP -> 200': (r) => r.status === 200 && !!parseBody(r).TokenSesion });
+
+    desafio = parseBody(loginUsuario());
+    const recuperacion = http.post(`${BASE}/usuarios/login/segundo-factor`, JSON.stringify({ TokenDesafio: desafio.TokenDesafio, Codigo: codigos[0] || '-' }), PARAMS_NO_AUTH);
+    check(recuperacion, { 'completar login con código de recuperación -> 200': (r) => r.status === 200 });
+    desafio = parseBody(loginUsuario());
+    const usado = http.post(`${BASE}/usuarios/login/segundo-factor`, JSON.stringify({ TokenDesafio: desafio.TokenDesafio, Codigo: codigos[0] || '-' }), PARAMS_NO_AUTH);
+    check(usado, { 'código de recuperación ya usado -> 400': (r) => r.status === 400 });
+
+    const restablecer = http.del(`${BASE}/usuarios/${idUsuarioNuevo}/segundo-factor`, null, PARAMS_SISTEMA);
+    logRes('restablecer-segundo-factor', restablecer);
+    check(restablecer, { 'restablecer segundo factor -> 200': (r) => r.status === 200 });
+    check(loginUsuario(), { 'login sin segundo factor tras restablecer': (r) => r.status === 200 && !!parseBody(r).TokenSesion });
+  });
+
+  // Bloqueo progresivo: también para usuarios inexistentes, para no revelar cuáles existen (LOGININTENTOSMAX = 5)
+  group('F9-26k: POST /usuarios/login — bloqueo por intentos fallidos -> 429 con Retry-After', () => {
+    const body = JSON.stringify({ Usuario: `k6-bloq-${Date.now()}`, Password: 'incorrecta' });
+    for (let i = 1; i <= 4; i++) {
+      check(http.post(`${BASE}/usuarios/login`, body, PARAMS_NO_AUTH), { [`intento fallido ${i} -> 400`]: (r) => r.status === 400 });
+    }
+    const quinto = http.post(`${BASE}/usuarios/login`, body, PARAMS_NO_AUTH);
+    logRes('login-bloqueado', quinto);
+    check(quinto, { 'quinto intento fallido bloquea -> 429': (r) => r.status === 429 && r.headers['Retry-After'] === '60' });
+    const bloqueado = http.post(`${BASE}/usuarios/login`, body, PARAMS_NO_AUTH);
+    check(bloqueado, { 'login bloqueado -> 429 con Retry-After': (r) => r.status === 429 && Number(r.headers['Retry-After']) > 0 });
+  });
+
+  // Auditoría: la desactivación y reactivación de la cuenta UB (F7) quedan registradas con el estado anterior y posterior
+  group(`F9-26l: GET /operaciones — auditoría de la cuenta ${ID_UB}/${ID_MONEDA_PRINCIPAL} y exportación CSV`, () => {
+    const res = http.get(`${BASE}/operaciones?Entidad=Cuenta&Limite=50`, PARAMS_SISTEMA);
+    logRes('buscar-operaciones', res);
+    const ops = res.status === 200 ? parseBody(res) : [];
+    const deCuenta = (tipo) => ops.filter((o) => o.TipoOperacion === tipo && o.Detalles.IdUsuarioFinal === ID_UB && o.Detalles.IdMoneda === ID_MONEDA_PRINCIPAL);
+    check(res, {
+      'buscar operaciones -> 200': (r) => r.status === 200,
+      'desactivación auditada (A -> I)': () => deCuenta('DC').some((o) => o.Detalles.Antes.Estado === 'A' && o.Detalles.Despues.Estado === 'I'),
+      'activación auditada (I -> A)': () => deCuenta('AC').some((o) => o.Detalles.Antes.Estado === 'I' && o.Detalles.Despues.Estado === 'A'),
+    });
+    const csv = http.get(`${BASE}/operaciones?TipoOperacion=DC&Formato=csv`, PARAMS_SISTEMA);
+    check(csv, {
+      'exportar CSV -> 200': (r) => r.status === 200 && r.headers['Content-Type'].startsWith('text/csv'),
+      'CSV con encabezado': (r) => r.body.startsWith('IdOperacion,IdUsuario,TipoOperacion,FechaOperacion,Detalles,Hash'),
+    });
+    check(http.get(`${BASE}/operaciones?Entidad=Sesion`, PARAMS_SISTEMA), { 'entidad inválida -> 400': (r) => r.status === 400 });
+  });
+
+  group('F9-26m: GET /operaciones/verificar — cadena de hashes de la auditoría', () => {
+    const res = http.get(`${BASE}/operaciones/verificar`, PARAMS_SISTEMA);
+    logRes('verificar-operaciones', res);
+    const v = res.status === 200 ? parseBody(res) : {};
+    if (v.Incidencias && v.Incidencias.length > 0) console.log(`  Incidencias: ${JSON.stringify(v.Incidencias)}`);
+    check(res, {
+      'verificar operaciones -> 200': (r) => r.status === 200,
+      'cadena íntegra': () => v.Integra === true && v.Incidencias.length === 0,
+      'recorre hasta la cabeza': () => v.OperacionesVerificadas > 0 && v.OperacionesVerificadas === v.IdOperacion,
+    });
+    check(http.get(`${BASE}/operaciones/verificar`, PARAMS_NO_AUTH), { 'verificar sin auth -> 401': (r) => r.status === 401 });
+  });
+
   group(`F9-27: DELETE /usuarios/${idUsuarioNuevo || 1} — borrar usuario (SISTEMA)`, () => {
     if (idUsuarioNuevo <= 0) { console.log('  SKIP'); return; }
     const res = http.del(`${BASE}/usuarios/${idUsuarioNuevo}`, null, PARAMS_SISTEMA);